@@ -0,0 +1,70 @@
+// Command datasetdiff compares two dataset files and summarizes the address ranges
+// added, removed and changed per country, to review a vendor update before importing
+// it.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/datasetdiff"
+	"ip-geolocation-service/internal/repository"
+)
+
+func main() {
+	oldFile := flag.String("old", "", "Dataset currently in use (CSV, optionally .gz or .zst)")
+	newFile := flag.String("new", "", "Updated dataset to review")
+	maxRanges := flag.Int("ranges", 50, "Changed ranges to list after the summary (-1 lists all)")
+	jsonOutput := flag.Bool("json", false, "Print the whole report as JSON")
+	flag.Parse()
+
+	if *oldFile == "" || *newFile == "" {
+		fmt.Fprintln(os.Stderr, "datasetdiff: -old and -new are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*oldFile, *newFile, *maxRanges, *jsonOutput); err != nil {
+		fmt.Fprintf(os.Stderr, "datasetdiff: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(oldFile, newFile string, maxRanges int, jsonOutput bool) error {
+	oldRecords, err := loadRecords(oldFile)
+	if err != nil {
+		return err
+	}
+	newRecords, err := loadRecords(newFile)
+	if err != nil {
+		return err
+	}
+
+	report, err := datasetdiff.Diff(oldRecords, newRecords)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return report.WriteText(os.Stdout, maxRanges)
+}
+
+// loadRecords loads a dataset file the way the service does and lists its records.
+// Skipped records are logged to stderr, keeping the report on stdout clean.
+func loadRecords(path string) ([]repository.Record, error) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil)).With("file", path)
+	repo := repository.NewFileRepository(&config.DatabaseConfig{Type: config.DatabaseTypeCSV, FilePath: path}, logger)
+	if err := repo.Initialize(context.Background()); err != nil {
+		return nil, err
+	}
+	defer repo.Close()
+	return repo.Records(), nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/netip"
+	"os"
+	"strings"
+
+	"ip-geolocation-service/internal/ipclass"
+)
+
+// loadIPs reads the addresses in the first column of a dataset CSV, skipping the
+// header and anything that isn't an IP address
+func loadIPs(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	var ips []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if addr, err := netip.ParseAddr(strings.TrimSpace(record[0])); err == nil {
+			ips = append(ips, addr.String())
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IP addresses in %s", path)
+	}
+	return ips, nil
+}
+
+// randomIPs generates n random public IPv4 addresses
+func randomIPs(n int) []string {
+	if n <= 0 {
+		n = 1
+	}
+	ips := make([]string, 0, n)
+	for len(ips) < n {
+		addr := netip.AddrFrom4([4]byte{byte(rand.IntN(256)), byte(rand.IntN(256)), byte(rand.IntN(256)), byte(rand.IntN(256))})
+		if ipclass.Classify(addr).Public {
+			ips = append(ips, addr.String())
+		}
+	}
+	return ips
+}
+
+// ipPicker chooses the address for each request. It is used by the scheduler
+// goroutine only and isn't safe for concurrent use.
+type ipPicker struct {
+	ips  []string
+	zipf *rand.Zipf // nil picks uniformly
+}
+
+// newIPPicker creates a picker over ips. With the zipf distribution a few addresses
+// receive most of the traffic, like a real client population; which ones is random.
+func newIPPicker(ips []string, dist string, s float64) (*ipPicker, error) {
+	picker := &ipPicker{ips: ips}
+	switch dist {
+	case "uniform":
+	case "zipf":
+		if s <= 1 {
+			return nil, fmt.Errorf("-zipf-s must be greater than 1")
+		}
+		picker.ips = append([]string(nil), ips...)
+		rand.Shuffle(len(picker.ips), func(i, j int) {
+			picker.ips[i], picker.ips[j] = picker.ips[j], picker.ips[i]
+		})
+		r := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+		picker.zipf = rand.NewZipf(r, s, 1, uint64(len(ips)-1))
+	default:
+		return nil, fmt.Errorf("unknown -dist %q: must be uniform or zipf", dist)
+	}
+	return picker, nil
+}
+
+func (p *ipPicker) next() string {
+	if p.zipf != nil {
+		return p.ips[p.zipf.Uint64()]
+	}
+	return p.ips[rand.IntN(len(p.ips))]
+}
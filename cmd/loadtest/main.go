@@ -0,0 +1,189 @@
+// Command loadtest drives a running IP geolocation service with lookup traffic and
+// reports latency percentiles and error rates.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// options are the command line settings
+type options struct {
+	target      string
+	path        string
+	rps         int
+	concurrency int
+	duration    time.Duration
+	timeout     time.Duration
+	dist        string
+	zipfS       float64
+	ipsFile     string
+	poolSize    int
+	apiKey      string
+	jsonOutput  bool
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.target, "url", "http://localhost:8080", "Base URL of the service")
+	flag.StringVar(&opts.path, "path", "/v1/find-country", "Lookup path; the address is sent as ?ip=")
+	flag.IntVar(&opts.rps, "rps", 100, "Requests per second to send (0 sends as fast as the workers allow)")
+	flag.IntVar(&opts.concurrency, "concurrency", 10, "Number of concurrent workers")
+	flag.DurationVar(&opts.duration, "duration", 30*time.Second, "How long to run")
+	flag.DurationVar(&opts.timeout, "timeout", 5*time.Second, "Per-request timeout")
+	flag.StringVar(&opts.dist, "dist", "uniform", "IP distribution: uniform or zipf")
+	flag.Float64Var(&opts.zipfS, "zipf-s", 1.1, "Zipf skew (> 1); higher values concentrate traffic on fewer addresses")
+	flag.StringVar(&opts.ipsFile, "ips", "", "CSV dataset to draw addresses from (first column); random public IPv4 addresses if empty")
+	flag.IntVar(&opts.poolSize, "pool", 10000, "Number of random addresses to generate when -ips is empty")
+	flag.StringVar(&opts.apiKey, "api-key", "", "API key sent in X-API-Key")
+	flag.BoolVar(&opts.jsonOutput, "json", false, "Print the report as JSON")
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(opts options) error {
+	if opts.concurrency <= 0 || opts.rps < 0 || opts.duration <= 0 {
+		return fmt.Errorf("concurrency and duration must be positive and rps non-negative")
+	}
+	base, err := url.Parse(strings.TrimSuffix(opts.target, "/") + opts.path)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return fmt.Errorf("invalid -url %q", opts.target)
+	}
+
+	var ips []string
+	if opts.ipsFile != "" {
+		if ips, err = loadIPs(opts.ipsFile); err != nil {
+			return err
+		}
+	} else {
+		ips = randomIPs(opts.poolSize)
+	}
+	picker, err := newIPPicker(ips, opts.dist, opts.zipfS)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.duration)
+	defer cancel()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := &http.Client{
+		Timeout: opts.timeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        opts.concurrency,
+			MaxIdleConnsPerHost: opts.concurrency,
+		},
+	}
+
+	if !opts.jsonOutput {
+		fmt.Printf("🚀 Load testing %s for %v (rps=%d, concurrency=%d, dist=%s, %d addresses)\n",
+			base, opts.duration, opts.rps, opts.concurrency, opts.dist, len(ips))
+	}
+
+	jobs := make(chan string, opts.concurrency)
+	results := make([]*recorder, opts.concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		results[i] = newRecorder()
+		wg.Add(1)
+		go func(rec *recorder) {
+			defer wg.Done()
+			for ip := range jobs {
+				rec.record(send(client, base, ip, opts.apiKey))
+			}
+		}(results[i])
+	}
+
+	start := time.Now()
+	sent, missed := schedule(ctx, jobs, picker, opts.rps)
+	close(jobs)
+	wg.Wait()
+
+	report := buildReport(results, time.Since(start), sent, missed)
+	if opts.jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	report.print(os.Stdout)
+	return nil
+}
+
+// schedule feeds addresses to the workers until ctx is done. With a target rate,
+// requests are paced from the start time and a request is counted as missed when
+// every worker is still busy at its send time, so an overloaded service shows up
+// as missed requests rather than silently lower load.
+func schedule(ctx context.Context, jobs chan<- string, picker *ipPicker, rps int) (sent, missed int) {
+	if rps == 0 {
+		for {
+			select {
+			case <-ctx.Done():
+				return sent, missed
+			case jobs <- picker.next():
+				sent++
+			}
+		}
+	}
+
+	interval := time.Second / time.Duration(rps)
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for i := 0; ; i++ {
+		timer.Reset(time.Until(start.Add(time.Duration(i) * interval)))
+		select {
+		case <-ctx.Done():
+			return sent, missed
+		case <-timer.C:
+		}
+
+		select {
+		case jobs <- picker.next():
+			sent++
+		default:
+			missed++
+		}
+	}
+}
+
+// send performs one lookup
+func send(client *http.Client, base *url.URL, ip, apiKey string) result {
+	u := *base
+	query := u.Query()
+	query.Set("ip", ip)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return result{err: err}
+	}
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return result{latency: time.Since(start), err: err}
+	}
+	// Drain the body so the connection is reused
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return result{latency: time.Since(start), status: resp.StatusCode, err: err}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// result is the outcome of one request; status is 0 when no response arrived
+type result struct {
+	latency time.Duration
+	status  int
+	err     error
+}
+
+// recorder collects the results of one worker
+type recorder struct {
+	latencies []time.Duration
+	statuses  map[int]int
+	failures  int // Requests without a complete response
+}
+
+func newRecorder() *recorder {
+	return &recorder{statuses: make(map[int]int)}
+}
+
+func (r *recorder) record(res result) {
+	if res.err != nil {
+		r.failures++
+		return
+	}
+	r.latencies = append(r.latencies, res.latency)
+	r.statuses[res.status]++
+}
+
+// latencyReport holds latency percentiles in milliseconds
+type latencyReport struct {
+	Mean float64 `json:"mean_ms"`
+	P50  float64 `json:"p50_ms"`
+	P90  float64 `json:"p90_ms"`
+	P95  float64 `json:"p95_ms"`
+	P99  float64 `json:"p99_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+// report summarizes a load test
+type report struct {
+	Duration   float64        `json:"duration_seconds"`
+	Sent       int            `json:"sent"`
+	Missed     int            `json:"missed"` // Not sent because every worker was busy
+	Completed  int            `json:"completed"`
+	Failures   int            `json:"failures"` // Connection errors and timeouts
+	Throughput float64        `json:"throughput_rps"`
+	ErrorRate  float64        `json:"error_rate"` // Failures and 5xx responses over sent requests
+	Statuses   map[string]int `json:"statuses"`
+	Latency    latencyReport  `json:"latency"`
+}
+
+// buildReport merges the worker results
+func buildReport(recorders []*recorder, elapsed time.Duration, sent, missed int) report {
+	var latencies []time.Duration
+	statuses := make(map[string]int)
+	failures, serverErrors := 0, 0
+	for _, rec := range recorders {
+		latencies = append(latencies, rec.latencies...)
+		failures += rec.failures
+		for status, count := range rec.statuses {
+			statuses[strconv.Itoa(status)] += count
+			if status >= 500 {
+				serverErrors += count
+			}
+		}
+	}
+	slices.Sort(latencies)
+
+	rep := report{
+		Duration:  elapsed.Seconds(),
+		Sent:      sent,
+		Missed:    missed,
+		Completed: len(latencies),
+		Failures:  failures,
+		Statuses:  statuses,
+	}
+	if elapsed > 0 {
+		rep.Throughput = float64(len(latencies)) / elapsed.Seconds()
+	}
+	if sent > 0 {
+		rep.ErrorRate = float64(failures+serverErrors) / float64(sent)
+	}
+	if len(latencies) > 0 {
+		var total time.Duration
+		for _, latency := range latencies {
+			total += latency
+		}
+		rep.Latency = latencyReport{
+			Mean: milliseconds(total / time.Duration(len(latencies))),
+			P50:  milliseconds(percentile(latencies, 50)),
+			P90:  milliseconds(percentile(latencies, 90)),
+			P95:  milliseconds(percentile(latencies, 95)),
+			P99:  milliseconds(percentile(latencies, 99)),
+			Max:  milliseconds(latencies[len(latencies)-1]),
+		}
+	}
+	return rep
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d.Microseconds())) / 1000
+}
+
+func (r report) print(w io.Writer) {
+	fmt.Fprintln(w, "==========================================")
+	fmt.Fprintf(w, "Duration:    %.1fs\n", r.Duration)
+	fmt.Fprintf(w, "Sent:        %d\n", r.Sent)
+	if r.Missed > 0 {
+		fmt.Fprintf(w, "Missed:      %d (every worker was busy; raise -concurrency or lower -rps)\n", r.Missed)
+	}
+	fmt.Fprintf(w, "Completed:   %d (%.1f req/s)\n", r.Completed, r.Throughput)
+	fmt.Fprintf(w, "Failures:    %d\n", r.Failures)
+	fmt.Fprintf(w, "Error rate:  %.2f%%\n", r.ErrorRate*100)
+
+	codes := make([]string, 0, len(r.Statuses))
+	for code := range r.Statuses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	fmt.Fprintln(w, "Statuses:")
+	for _, code := range codes {
+		fmt.Fprintf(w, "  %s: %d\n", code, r.Statuses[code])
+	}
+
+	fmt.Fprintln(w, "Latency:")
+	fmt.Fprintf(w, "  mean %.3fms  p50 %.3fms  p90 %.3fms  p95 %.3fms  p99 %.3fms  max %.3fms\n",
+		r.Latency.Mean, r.Latency.P50, r.Latency.P90, r.Latency.P95, r.Latency.P99, r.Latency.Max)
+	fmt.Fprintln(w, "==========================================")
+}
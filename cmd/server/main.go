@@ -1,13 +1,19 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
+	"ip-geolocation-service/internal/app"
 	"ip-geolocation-service/internal/config"
 )
 
 func main() {
+	selfTest := flag.Bool("self-test", false, "Load the configuration and datasets, verify sample lookups and health, then exit")
+	selfTestFile := flag.String("self-test-file", "./data/self_test.csv", "Verification file of ip,city,country rows used by -self-test")
+	flag.Parse()
+
 	// Load configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -16,23 +22,39 @@ func main() {
 	}
 
 	// Create application
-	app, err := NewApp(cfg)
+	application, err := app.New(cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create application: %v\n", err)
 		os.Exit(1)
 	}
 
+	// Pre-flight check: exit non-zero unless every sample lookup and health check passes
+	if *selfTest {
+		err := application.SelfTest(*selfTestFile, os.Stdout)
+		application.Stop()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Self-test failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Self-test passed")
+		return
+	}
+
 	// Start application
-	if err := app.Start(); err != nil {
+	if err := application.Start(); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to start application: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Wait for shutdown signal
-	waitForShutdownSignal()
+	// Wait for shutdown signal, handing the socket to a new binary on SIGUSR2 if enabled
+	var upgrade func()
+	if cfg.Server.SocketHandoff {
+		upgrade = application.Upgrade
+	}
+	waitForShutdownSignal(upgrade)
 
 	// Stop application gracefully
-	if err := app.Stop(); err != nil {
+	if err := application.Stop(); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to stop application: %v\n", err)
 		os.Exit(1)
 	}
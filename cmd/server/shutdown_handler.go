@@ -4,12 +4,26 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+
+	"ip-geolocation-service/internal/app"
 )
 
 // waitForShutdownSignal waits for interrupt signals to gracefully shutdown the server
-// Handles SIGINT (Ctrl+C) and SIGTERM (Docker/Systemd termination)
-func waitForShutdownSignal() {
+// Handles SIGINT (Ctrl+C) and SIGTERM (Docker/Systemd termination). When upgrade is
+// non-nil it is called on SIGUSR2 and the process keeps running.
+func waitForShutdownSignal(upgrade func()) {
+	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	if upgrade != nil && app.UpgradeSignal != nil {
+		signals = append(signals, app.UpgradeSignal)
+	}
+
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, signals...)
+	for sig := range quit {
+		if app.UpgradeSignal != nil && sig == app.UpgradeSignal {
+			upgrade()
+			continue
+		}
+		return
+	}
 }
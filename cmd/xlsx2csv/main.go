@@ -0,0 +1,81 @@
+// Command xlsx2csv converts the first sheet of an Excel workbook into a CSV dataset,
+// mapping the sheet's header names to dataset columns, and checks the result the way
+// the service would load it.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"ip-geolocation-service/internal/repository"
+	"ip-geolocation-service/internal/xlsx"
+)
+
+func main() {
+	in := flag.String("in", "", "Workbook to convert (.xlsx)")
+	out := flag.String("out", "", "CSV dataset to write (default stdout)")
+	columns := xlsx.DefaultColumns
+	flag.StringVar(&columns.IP, "ip", columns.IP, "Header of the IP address column")
+	flag.StringVar(&columns.City, "city", columns.City, "Header of the city column")
+	flag.StringVar(&columns.Country, "country", columns.Country, "Header of the country column")
+	flag.StringVar(&columns.Latitude, "latitude", columns.Latitude, "Header of the optional latitude column")
+	flag.StringVar(&columns.Longitude, "longitude", columns.Longitude, "Header of the optional longitude column")
+	flag.Parse()
+
+	if *in == "" {
+		fmt.Fprintln(os.Stderr, "xlsx2csv: -in is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	valid, err := run(*in, *out, columns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xlsx2csv: %v\n", err)
+		os.Exit(1)
+	}
+	if !valid {
+		os.Exit(1)
+	}
+}
+
+// run converts the workbook and reports whether the dataset would load cleanly
+func run(in, out string, columns xlsx.Columns) (bool, error) {
+	var converted bytes.Buffer
+	stats, err := xlsx.Convert(in, columns, &converted)
+	if err != nil {
+		return false, err
+	}
+
+	report, _, err := repository.ValidateDataset(context.Background(), bytes.NewReader(converted.Bytes()), 0)
+	if err != nil {
+		return false, err
+	}
+
+	var w io.Writer = os.Stdout
+	if out != "" {
+		file, err := os.Create(out)
+		if err != nil {
+			return false, err
+		}
+		defer file.Close()
+		w = file
+	}
+	if _, err := w.Write(converted.Bytes()); err != nil {
+		return false, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Converted %d rows (%d empty skipped), %d addresses\n", stats.Rows, stats.Empty, report.Records)
+	for _, issue := range report.Errors {
+		fmt.Fprintf(os.Stderr, "line %d: %s\n", issue.Line, issue.Message)
+	}
+	if report.Fatal != "" {
+		fmt.Fprintf(os.Stderr, "The dataset won't load: %s\n", report.Fatal)
+	} else if !report.Valid {
+		fmt.Fprintf(os.Stderr, "%d invalid and %d conflicting rows\n", report.Invalid, report.Conflicts)
+	}
+	return report.Valid, nil
+}
@@ -1,3 +1,3 @@
 module ip-geolocation-service
 
-go 1.21
+go 1.24
@@ -0,0 +1,128 @@
+// Package accesspolicy decides whether clients from a location may be served, from a
+// configured list of blocked or allowed countries, so other systems can use the
+// service as a geo-fencing decision point.
+package accesspolicy
+
+import (
+	"fmt"
+	"strings"
+
+	"ip-geolocation-service/internal/countries"
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/models"
+)
+
+// Policy modes
+const (
+	ModeDeny  = "deny"  // The listed countries are blocked, every other one is allowed
+	ModeAllow = "allow" // Only the listed countries are allowed
+)
+
+// Decision reasons
+const (
+	ReasonCountryBlocked    = "country_blocked"     // Listed in deny mode
+	ReasonCountryNotBlocked = "country_not_blocked" // Not listed in deny mode
+	ReasonCountryAllowed    = "country_allowed"     // Listed in allow mode
+	ReasonCountryNotAllowed = "country_not_allowed" // Not listed in allow mode
+	ReasonUnknownLocation   = "unknown_location"    // No country could be determined
+)
+
+// Decision is the verdict for one location
+type Decision struct {
+	Allowed bool
+	Reason  string
+	Country string // ISO 3166-1 alpha-2 code the verdict was based on ("" when unknown)
+}
+
+// Policy blocks or allows locations by country
+type Policy struct {
+	mode        string
+	countries   map[string]bool // ISO 3166-1 alpha-2 codes
+	denyUnknown bool
+
+	decisions *metrics.CounterVec
+}
+
+// New creates a policy. countries are names, aliases or ISO codes; denyUnknown
+// decides locations whose country can't be determined, such as unknown addresses.
+func New(mode string, list []string, denyUnknown bool) (*Policy, error) {
+	if mode != ModeDeny && mode != ModeAllow {
+		return nil, fmt.Errorf("invalid access policy mode %q, must be %s or %s", mode, ModeDeny, ModeAllow)
+	}
+	p := &Policy{
+		mode:        mode,
+		countries:   make(map[string]bool, len(list)),
+		denyUnknown: denyUnknown,
+	}
+	var unknown []string
+	for _, name := range list {
+		country, ok := countries.Lookup(name)
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		p.countries[country.Alpha2] = true
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown countries in access policy: %s", strings.Join(unknown, ", "))
+	}
+	return p, nil
+}
+
+// RegisterMetrics exposes decision counts on the registry
+func (p *Policy) RegisterMetrics(registry *metrics.Registry) {
+	p.decisions = registry.NewCounterVec("ipgeo_access_decisions_total",
+		"Access policy decisions by outcome and reason",
+		[]string{"decision", "reason"})
+}
+
+// Mode returns the policy mode, ModeDeny or ModeAllow
+func (p *Policy) Mode() string {
+	return p.mode
+}
+
+// Check decides whether clients at location may be served; a nil location is unknown
+func (p *Policy) Check(location *models.Location) Decision {
+	decision := p.decide(countryCode(location))
+	if p.decisions != nil {
+		outcome := "deny"
+		if decision.Allowed {
+			outcome = "allow"
+		}
+		p.decisions.Inc(outcome, decision.Reason)
+	}
+	return decision
+}
+
+// decide applies the policy to an ISO 3166-1 alpha-2 code
+func (p *Policy) decide(code string) Decision {
+	if code == "" {
+		return Decision{Allowed: !p.denyUnknown, Reason: ReasonUnknownLocation}
+	}
+	listed := p.countries[code]
+	switch {
+	case p.mode == ModeAllow && listed:
+		return Decision{Allowed: true, Reason: ReasonCountryAllowed, Country: code}
+	case p.mode == ModeAllow:
+		return Decision{Allowed: false, Reason: ReasonCountryNotAllowed, Country: code}
+	case listed:
+		return Decision{Allowed: false, Reason: ReasonCountryBlocked, Country: code}
+	default:
+		return Decision{Allowed: true, Reason: ReasonCountryNotBlocked, Country: code}
+	}
+}
+
+// countryCode returns the alpha-2 code of a location, resolving datasets that only
+// carry country names
+func countryCode(location *models.Location) string {
+	if location == nil {
+		return ""
+	}
+	if location.CountryCode != "" {
+		return strings.ToUpper(location.CountryCode)
+	}
+	if country, ok := countries.Lookup(location.Country); ok {
+		return country.Alpha2
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package accesspolicy
+
+import (
+	"testing"
+
+	"ip-geolocation-service/internal/models"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	us := &models.Location{Country: "United States"}
+	fr := &models.Location{Country: "France", CountryCode: "fr"}
+	unknown := &models.Location{Country: "Atlantis"}
+
+	tests := []struct {
+		mode        string
+		denyUnknown bool
+		location    *models.Location
+		allowed     bool
+		reason      string
+	}{
+		{ModeDeny, false, us, false, ReasonCountryBlocked},
+		{ModeDeny, false, fr, true, ReasonCountryNotBlocked},
+		{ModeAllow, false, us, true, ReasonCountryAllowed},
+		{ModeAllow, false, fr, false, ReasonCountryNotAllowed},
+		{ModeDeny, false, unknown, true, ReasonUnknownLocation},
+		{ModeDeny, true, nil, false, ReasonUnknownLocation},
+	}
+	for _, tt := range tests {
+		policy, err := New(tt.mode, []string{"usa", "Germany"}, tt.denyUnknown)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := policy.Check(tt.location)
+		if got.Allowed != tt.allowed || got.Reason != tt.reason {
+			t.Errorf("%s mode, %+v: got %+v, want allowed=%v reason=%s", tt.mode, tt.location, got, tt.allowed, tt.reason)
+		}
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	if _, err := New("block", []string{"US"}, false); err == nil {
+		t.Error("Expected an invalid mode to fail")
+	}
+	if _, err := New(ModeDeny, []string{"US", "Narnia"}, false); err == nil {
+		t.Error("Expected an unknown country to fail")
+	}
+}
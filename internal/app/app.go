@@ -0,0 +1,1138 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/accesspolicy"
+	"ip-geolocation-service/internal/audit"
+	"ip-geolocation-service/internal/buildinfo"
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/consumer"
+	"ip-geolocation-service/internal/demodata"
+	"ip-geolocation-service/internal/egress"
+	"ip-geolocation-service/internal/errreport"
+	"ip-geolocation-service/internal/experiments"
+	"ip-geolocation-service/internal/flags"
+	"ip-geolocation-service/internal/handlers"
+	"ip-geolocation-service/internal/health"
+	"ip-geolocation-service/internal/idempotency"
+	"ip-geolocation-service/internal/jws"
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/middleware"
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/objectstore"
+	"ip-geolocation-service/internal/quota"
+	"ip-geolocation-service/internal/report"
+	"ip-geolocation-service/internal/repository"
+	"ip-geolocation-service/internal/resolver"
+	"ip-geolocation-service/internal/runtimelimits"
+	"ip-geolocation-service/internal/secrets"
+	"ip-geolocation-service/internal/services"
+	"ip-geolocation-service/internal/shard"
+	"ip-geolocation-service/internal/threatintel"
+	"ip-geolocation-service/internal/usage"
+	"ip-geolocation-service/internal/watchdog"
+)
+
+// App represents the application and its dependencies
+type App struct {
+	config      *config.Config
+	build       buildinfo.Info
+	logger      *slog.Logger
+	server      *http.Server
+	adminServer *http.Server // Serves operational endpoints when ADMIN_PORT is set
+	datasets    *services.DatasetService
+	stats       *datasetStats // Load statistics of each dataset for the startup summary
+	lookup      services.IPService
+	auditLog    *audit.Log
+	rateLimiter *middleware.RateLimiter
+	warmUp      *middleware.WarmUp // Finished once the startup warm-up is done
+	watchdog    *watchdog.Watchdog // Probes the public handler in the background while running
+
+	torExits       *threatintel.TorExitList // Refreshed in the background while running
+	flags          *flags.Set               // Flag file reloaded in the background while running
+	quotaStore     *quota.MemoryStore       // Flushed in the background while running
+	usageExporter  *usage.Exporter          // Exports usage in the background while running
+	reports        *report.Scheduler        // Generates scheduled reports in the background while running
+	errorReporter  *errreport.Sentry        // Sends error reports in the background while running
+	consumer       *consumer.Consumer       // Enriches queued IPs in the background in consumer mode
+	consumerDone   chan struct{}            // Closed once the consumer has stopped
+	secrets        *secrets.Cache           // Checked for rotated secrets in the background while running
+	pending        map[string]string        // Datasets whose load is retried in the background, by name
+	stopBackground context.CancelFunc
+
+	listeners       []net.Listener // Public sockets, all handed to a successor
+	adminListener   net.Listener
+	listenerMetrics *listenerMetrics
+	upgrading       atomic.Bool
+}
+
+// New creates a new application instance with all dependencies
+func New(cfg *config.Config) (*App, error) {
+	logger, logLevel := setupLogger(cfg.Logging, cfg.Privacy)
+
+	// Fit GOMAXPROCS and GOMEMLIMIT to the container before anything starts working
+	runtimeSettings := runtimelimits.Apply(runtimelimits.Config{
+		AutoMaxProcs:     cfg.Runtime.AutoMaxProcs,
+		AutoMemoryLimit:  cfg.Runtime.AutoMemoryLimit,
+		MemoryLimitRatio: float64(cfg.Runtime.MemoryLimitPercent) / 100,
+	})
+	if runtimeSettings.DetectionFailed != "" {
+		logger.Warn("⚠️ Could not read container limits, runtime defaults kept", "error", runtimeSettings.DetectionFailed)
+	}
+	logger.Info("⚙️ Runtime settings",
+		"cgroup", runtimeSettings.Limits.Cgroup,
+		"cpu_quota", runtimeSettings.Limits.CPUQuota,
+		"memory_limit", runtimeSettings.Limits.MemoryLimit,
+		"gomaxprocs", runtimeSettings.GOMAXPROCS,
+		"gomaxprocs_source", runtimeSettings.GOMAXPROCSFrom,
+		"gomemlimit", runtimeSettings.GOMEMLIMIT,
+		"gomemlimit_source", runtimeSettings.GOMEMLIMITFrom,
+	)
+
+	// Route the service's outbound requests, starting with dataset downloads, through
+	// the configured proxies. Its clients share one transport rather than changing
+	// http.DefaultTransport, which belongs to the program embedding the service.
+	var outbound http.RoundTripper
+	if proxies := cfg.Egress.Proxies; proxies != nil && proxies.Enabled() {
+		outbound = proxies.Transport()
+		logger.Info("🛰️ Egress proxy enabled",
+			"proxy", egress.Redact(cfg.Egress.Proxy),
+			"no_proxy", len(cfg.Egress.NoProxy),
+			"overrides", len(cfg.Egress.Overrides),
+		)
+	}
+
+	// Load the primary dataset and any additional named datasets
+	ctx := context.Background()
+	stats := newDatasetStats()
+	pools := repository.NewPoolMonitor()
+	datasets := services.NewDatasetService(cfg.Datasets.Default, newDatasetLoader(cfg, logger, stats, pools, outbound))
+	sources := map[string]string{cfg.Datasets.Default: cfg.Database.FilePath}
+	maps.Copy(sources, cfg.Datasets.Sources)
+	pending := make(map[string]string)
+	for name, path := range sources {
+		err := datasets.Load(ctx, name, path)
+		if err == nil {
+			continue
+		}
+		// With load retry on, serve and report not ready until the dataset turns up
+		if !cfg.Database.LoadRetry {
+			datasets.Close()
+			return nil, err
+		}
+		logger.Warn("⏳ Dataset failed to load, retrying in the background", "dataset", name, "error", err)
+		datasets.MarkLoading(name)
+		pending[name] = path
+	}
+
+	// Manual overrides take precedence over every dataset
+	overrides := services.NewOverrideStore(cfg.Datasets.OverridesFile)
+	if err := overrides.Load(); err != nil {
+		datasets.Close()
+		return nil, err
+	}
+	if overrides.Len() > 0 {
+		logger.Info("✏️ Location overrides loaded", "count", overrides.Len())
+	}
+	lookupService := services.NewOverrideService(datasets, overrides)
+
+	// Create rate limiter
+	rateLimiter, err := middleware.NewRateLimiterWithAlgorithm(
+		cfg.RateLimit.Algorithm,
+		cfg.RateLimit.RequestsPerSecond,
+		cfg.RateLimit.BurstSize,
+		cfg.RateLimit.WindowSize,
+		cfg.RateLimit.CleanupInterval,
+		cfg.RateLimit.InactiveThreshold,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create metrics registry
+	registry := metrics.NewRegistry()
+	rateLimiter.RegisterMetrics(registry)
+	build := buildinfo.Get()
+	build.RegisterMetrics(registry)
+	pools.RegisterMetrics(registry)
+
+	// Datasets older than MAX_DATASET_AGE are reported, and rejected if asked to
+	if cfg.Database.MaxAge > 0 {
+		datasets.SetMaxAge(cfg.Database.MaxAge, cfg.Database.StalePolicy == config.StalePolicyReject)
+		datasets.RegisterFreshnessMetrics(registry)
+		logger.Info("⏳ Dataset freshness enforced", "max_age", cfg.Database.MaxAge, "policy", cfg.Database.StalePolicy)
+	}
+
+	// Probes and internal checks that never consume rate limit tokens
+	var rateLimitExempt *middleware.RateLimitExemptions
+	if len(cfg.RateLimit.ExemptPaths) > 0 || len(cfg.RateLimit.ExemptCIDRs) > 0 {
+		rateLimitExempt, err = middleware.NewRateLimitExemptions(cfg.RateLimit.ExemptPaths, cfg.RateLimit.ExemptCIDRs)
+		if err != nil {
+			datasets.Close()
+			return nil, err
+		}
+		rateLimitExempt.RegisterMetrics(registry)
+	}
+
+	// Feature flags gating risky features, reloaded from their file while running
+	featureFlags, err := flags.New(cfg.Flags.Values, cfg.Flags.File, cfg.Flags.ReloadInterval)
+	if err != nil {
+		datasets.Close()
+		return nil, err
+	}
+	featureFlags.RegisterMetrics(registry)
+
+	// Proxies whose forwarding headers shape generated links
+	trustedProxies, err := middleware.NewTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		datasets.Close()
+		return nil, err
+	}
+
+	// Create optional global limiter
+	var globalLimiter *middleware.GlobalLimiter
+	if cfg.RateLimit.GlobalRequestsPerSecond > 0 || cfg.RateLimit.GlobalMaxConcurrent > 0 {
+		globalLimiter = middleware.NewGlobalLimiter(
+			cfg.RateLimit.GlobalRequestsPerSecond,
+			cfg.RateLimit.GlobalBurstSize,
+			cfg.RateLimit.GlobalMaxConcurrent,
+		)
+		globalLimiter.RegisterMetrics(registry)
+	}
+
+	// Create optional load shedder
+	var loadShedder *middleware.LoadShedder
+	if cfg.LoadShed.MaxInFlight > 0 {
+		loadShedder = middleware.NewLoadShedder(cfg.LoadShed.MaxInFlight, cfg.LoadShed.QueueDepth, cfg.LoadShed.QueueTimeout)
+		loadShedder.RegisterMetrics(registry)
+	}
+
+	// Credentials resolved from a secret manager at startup, checked for rotation while running
+	if store := cfg.Secrets.Store; store != nil {
+		store.RegisterMetrics(registry)
+		store.OnRotate(func(ref string) {
+			logger.Warn("🔐 Secret rotated, restart or hand off the socket to apply it", "secret", ref)
+		})
+	}
+
+	// Create maintenance toggle
+	maintenance := middleware.NewMaintenanceMode(cfg.Admin.MaintenanceMode, cfg.Admin.MaintenanceMessage)
+	maintenance.RegisterMetrics(registry)
+	if cfg.Admin.MaintenanceMode {
+		logger.Warn("🛠️ Starting in maintenance mode")
+	}
+	if cfg.Admin.ReadOnly {
+		logger.Info("🔒 Read-only mode: admin mutations are disabled")
+	}
+	adminCredential := cfg.Admin.Token != "" || len(cfg.Auth.APIKeys) > 0 ||
+		len(cfg.Auth.HMAC.Keys) > 0 || cfg.Auth.JWT.JWKSURL != ""
+	switch {
+	case !adminCredential && cfg.Admin.Insecure:
+		logger.Warn("⚠️ ADMIN_INSECURE is set: admin endpoints are open to anyone")
+	case !adminCredential:
+		logger.Warn("🔒 Admin endpoints disabled: set ADMIN_TOKEN or an admin API key, or ADMIN_INSECURE=true")
+	}
+
+	// Create readiness toggle for /admin/drain
+	drain := middleware.NewDrainMode()
+	drain.RegisterMetrics(registry)
+
+	// Readiness held back until the datasets are warmed up
+	var warmUp *middleware.WarmUp
+	if cfg.WarmUp.Lookups > 0 {
+		warmUp = middleware.NewWarmUp()
+		warmUp.RegisterMetrics(registry)
+	}
+
+	// Recent health check results, served at /health/history
+	var healthHistory *health.History
+	if cfg.Health.HistorySize > 0 {
+		healthHistory = health.NewHistory(cfg.Health.HistorySize)
+		healthHistory.RegisterMetrics(registry)
+	}
+
+	// Synthetic lookups through the full stack, started with the background tasks
+	var lookupWatchdog *watchdog.Watchdog
+	if cfg.Watchdog.Enabled {
+		lookupWatchdog = watchdog.New(watchdog.Config{
+			Interval:  cfg.Watchdog.Interval,
+			Timeout:   cfg.Watchdog.Timeout,
+			Threshold: cfg.Watchdog.Threshold,
+			Failures:  cfg.Watchdog.Failures,
+			Path:      watchdog.ProbePath(cfg.Server.BasePath, cfg.Watchdog.IP),
+			APIKey:    cfg.Watchdog.APIKey,
+		})
+		lookupWatchdog.RegisterMetrics(registry)
+		logger.Info("🐕 Watchdog enabled",
+			"interval", cfg.Watchdog.Interval,
+			"latency_threshold", cfg.Watchdog.Threshold,
+			"failures", cfg.Watchdog.Failures,
+			"ip", cfg.Watchdog.IP,
+		)
+	}
+
+	// Optional anonymizer detection
+	var threatChecker *threatintel.Checker
+	var torExits *threatintel.TorExitList
+	if cfg.Threats.Enabled {
+		var providers []threatintel.Provider
+		if cfg.Threats.TorExitListURL != "" {
+			torExits = threatintel.NewTorExitList(cfg.Threats.TorExitListURL, cfg.Threats.TorRefresh, outbound)
+			torExits.RegisterMetrics(registry)
+			providers = append(providers, torExits)
+		}
+		if cfg.Threats.AnonymizerListFile != "" {
+			list, err := threatintel.LoadStaticList("anonymizer_list", cfg.Threats.AnonymizerListFile)
+			if err != nil {
+				datasets.Close()
+				return nil, err
+			}
+			logger.Info("🕵️ Anonymizer list loaded", "entries", list.Len())
+			providers = append(providers, list)
+		}
+		threatChecker = threatintel.NewChecker(providers...)
+	}
+
+	// Optional hostname resolution for /v1/find-host
+	var hostResolver handlers.HostResolver
+	if cfg.Hosts.Enabled {
+		r, err := resolver.New(resolver.Config{
+			Server:       cfg.Hosts.Resolver,
+			Family:       cfg.Hosts.Family,
+			Timeout:      cfg.Hosts.Timeout,
+			MaxAddresses: cfg.Hosts.MaxAddresses,
+			HTTPClient:   &http.Client{Transport: outbound},
+		})
+		if err != nil {
+			datasets.Close()
+			return nil, err
+		}
+		hostResolver = r
+	}
+
+	// Optional detached signing of lookup responses
+	var signer *jws.Signer
+	if cfg.Signing.Key != "" {
+		key, err := jws.ParsePrivateKey(cfg.Signing.Key)
+		if err != nil {
+			datasets.Close()
+			return nil, err
+		}
+		signer = jws.NewSigner(key, cfg.Signing.KeyID)
+		logger.Info("✍️ Response signing enabled", "kid", signer.KeyID())
+	}
+
+	// Optional shard hints for sharded deployments
+	var shardRing *shard.Ring
+	if len(cfg.Shard.Nodes) > 0 {
+		shardRing, err = shard.New(cfg.Shard.Nodes, cfg.Shard.Self, cfg.Shard.VirtualNodes)
+		if err != nil {
+			datasets.Close()
+			return nil, err
+		}
+		logger.Info("🧭 Shard hints enabled", "self", cfg.Shard.Self, "nodes", len(cfg.Shard.Nodes))
+	}
+
+	// Optional country access policy
+	var accessPolicy *accesspolicy.Policy
+	if cfg.Access.Mode != "" {
+		accessPolicy, err = accesspolicy.New(cfg.Access.Mode, cfg.Access.Countries, cfg.Access.DenyUnknown)
+		if err != nil {
+			datasets.Close()
+			return nil, err
+		}
+		accessPolicy.RegisterMetrics(registry)
+		logger.Info("🚧 Country access policy enabled", "mode", cfg.Access.Mode, "countries", len(cfg.Access.Countries))
+	}
+
+	// Optional usage quotas for authenticated clients
+	var quotaStore *quota.MemoryStore
+	var quotaTracker *quota.Tracker
+	if cfg.Quota.Daily > 0 || cfg.Quota.Monthly > 0 {
+		quotaStore = quota.NewMemoryStore(cfg.Quota.File)
+		if err := quotaStore.Load(); err != nil {
+			datasets.Close()
+			return nil, err
+		}
+		quotaTracker = quota.NewTracker(quotaStore, quota.Limits{Daily: int64(cfg.Quota.Daily), Monthly: int64(cfg.Quota.Monthly)})
+		quotaTracker.RegisterMetrics(registry)
+		logger.Info("📊 Usage quotas enabled", "daily", cfg.Quota.Daily, "monthly", cfg.Quota.Monthly, "counters", quotaStore.Len())
+	}
+
+	// Optional usage export for billing
+	var usageRecorder *usage.Recorder
+	var usageExporter *usage.Exporter
+	if cfg.Usage.Dir != "" || cfg.Usage.URL != "" {
+		var sinks []usage.Sink
+		if cfg.Usage.Dir != "" {
+			sink, err := usage.NewFileSink(cfg.Usage.Dir, cfg.Usage.Format)
+			if err != nil {
+				datasets.Close()
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		}
+		if cfg.Usage.URL != "" {
+			sinks = append(sinks, usage.NewHTTPSink(cfg.Usage.URL, 30*time.Second, outbound))
+		}
+		usageRecorder = usage.NewRecorder()
+		usageExporter = usage.NewExporter(usageRecorder, cfg.Usage.Interval, sinks...)
+		usageExporter.RegisterMetrics(registry)
+		logger.Info("🧾 Usage export enabled", "interval", cfg.Usage.Interval, "dir", cfg.Usage.Dir, "url_set", cfg.Usage.URL != "")
+	}
+
+	// Optional scheduled traffic reports
+	var reportCollector *report.Collector
+	var reportScheduler *report.Scheduler
+	if cfg.Reports.Schedule != "" {
+		schedule, err := report.ParseSchedule(cfg.Reports.Schedule)
+		if err != nil {
+			datasets.Close()
+			return nil, err
+		}
+		var sinks []report.Sink
+		if cfg.Reports.Dir != "" {
+			sink, err := report.NewFileSink(cfg.Reports.Dir)
+			if err != nil {
+				datasets.Close()
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		}
+		if cfg.Reports.WebhookURL != "" {
+			sinks = append(sinks, report.NewWebhookSink(cfg.Reports.WebhookURL, 30*time.Second, outbound))
+		}
+		reportCollector = report.NewCollector(cfg.Reports.TopN)
+		reportScheduler = report.NewScheduler(reportCollector, schedule, sinks...)
+		reportScheduler.RegisterMetrics(registry)
+		logger.Info("📈 Scheduled reports enabled", "schedule", cfg.Reports.Schedule, "dir", cfg.Reports.Dir, "webhook_set", cfg.Reports.WebhookURL != "")
+	}
+
+	// Dataset coverage, tracked per prefix for /admin/misses
+	var missTracker *services.MissTracker
+	if cfg.Coverage.MissPrefixes > 0 {
+		missTracker = services.NewMissTracker(cfg.Coverage.MissPrefixes)
+		missTracker.RegisterMetrics(registry)
+	}
+
+	// Optional p99 latency budgets, alerting before customers notice slow routes
+	var latencyBudgets *middleware.LatencyBudgets
+	if len(cfg.Latency.Routes) > 0 {
+		latencyBudgets = middleware.NewLatencyBudgets(middleware.LatencyBudgetOptions{
+			Budgets:     cfg.Latency.Routes,
+			Window:      cfg.Latency.Window,
+			Windows:     cfg.Latency.Windows,
+			MinRequests: cfg.Latency.MinRequests,
+		}, logger)
+		latencyBudgets.RegisterMetrics(registry)
+		logger.Info("⏱️ Latency budgets enabled", "routes", len(cfg.Latency.Routes), "window", cfg.Latency.Window)
+	}
+
+	// Optional shadow traffic for validating a secondary backend
+	var shadower *middleware.Shadower
+	if cfg.Shadow.URL != "" {
+		shadower, err = middleware.NewShadower(cfg.Shadow.URL, cfg.Shadow.Percent, cfg.Shadow.Timeout, cfg.Shadow.MaxInFlight, outbound, logger)
+		if err != nil {
+			datasets.Close()
+			return nil, err
+		}
+		shadower.RegisterMetrics(registry)
+		logger.Info("🔀 Shadow traffic enabled", "url", egress.Redact(cfg.Shadow.URL), "percent", cfg.Shadow.Percent)
+	}
+
+	// Panics are always counted; with a DSN they and other server errors are also
+	// sent to the error tracker
+	var errorReporter *errreport.Sentry
+	var reporter errreport.Reporter
+	if cfg.Errors.SentryDSN != "" {
+		errorReporter, err = errreport.NewSentry(cfg.Errors.SentryDSN, cfg.Errors.Environment, cfg.Errors.Timeout, outbound)
+		if err != nil {
+			datasets.Close()
+			return nil, err
+		}
+		errorReporter.RegisterMetrics(registry)
+		reporter = errorReporter
+		logger.Info("🚨 Error reporting enabled", "environment", cfg.Errors.Environment)
+	}
+	recoverer := middleware.NewPanicRecoverer(logger, reporter)
+	recoverer.RegisterMetrics(registry)
+
+	// Optional fault injection for resilience testing in staging
+	var chaos *middleware.Chaos
+	if cfg.Chaos.Enabled {
+		chaos = middleware.NewChaos(middleware.ChaosOptions{
+			LatencyPercent: cfg.Chaos.LatencyPercent,
+			Latency:        cfg.Chaos.Latency,
+			Jitter:         cfg.Chaos.Jitter,
+			ErrorPercent:   cfg.Chaos.ErrorPercent,
+			ErrorStatus:    cfg.Chaos.ErrorStatus,
+			Paths:          cfg.Chaos.Paths,
+		})
+		chaos.RegisterMetrics(registry)
+		logger.Warn("🐒 Fault injection enabled, do not use in production",
+			"latency_percent", cfg.Chaos.LatencyPercent, "latency", cfg.Chaos.Latency,
+			"error_percent", cfg.Chaos.ErrorPercent, "error_status", cfg.Chaos.ErrorStatus)
+	}
+
+	// Consumer mode also enriches IPs from a message queue with the same lookup stack
+	var queueConsumer *consumer.Consumer
+	if cfg.Server.RunMode == config.RunModeConsumer {
+		url := cfg.Consumer.URL
+		queueConsumer = consumer.New(func(ctx context.Context) (consumer.Broker, error) {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			return consumer.DialNATS(ctx, url)
+		}, lookupService, consumer.Options{
+			Input:       cfg.Consumer.InputSubject,
+			Output:      cfg.Consumer.OutputSubject,
+			Queue:       cfg.Consumer.QueueGroup,
+			Concurrency: cfg.Consumer.Concurrency,
+			ParseMode:   models.ParseMode(cfg.Server.IPParseMode),
+		})
+		queueConsumer.RegisterMetrics(registry)
+	}
+
+	// Resolve API keys and the roles they carry
+	apiKeys, err := middleware.NewAPIKeyStoreWithRoles(cfg.Auth.APIKeys, cfg.Auth.KeyRoles)
+	if err != nil {
+		datasets.Close()
+		return nil, err
+	}
+
+	// Optional JWT validation; a provider outage at startup isn't fatal since keys are refetched on demand
+	var jwtValidator *middleware.JWTValidator
+	if cfg.Auth.JWT.JWKSURL != "" {
+		jwtValidator = middleware.NewJWTValidator(middleware.JWTConfig{
+			JWKSURL:       cfg.Auth.JWT.JWKSURL,
+			Issuer:        cfg.Auth.JWT.Issuer,
+			Audience:      cfg.Auth.JWT.Audience,
+			RolesClaim:    cfg.Auth.JWT.RolesClaim,
+			RoleMapping:   cfg.Auth.JWT.RoleMapping,
+			IdentityClaim: cfg.Auth.JWT.IdentityClaim,
+			JWKSRefresh:   cfg.Auth.JWT.JWKSRefresh,
+			Transport:     outbound,
+		})
+		if err := jwtValidator.Refresh(context.Background()); err != nil {
+			logger.Warn("⚠️ Failed to fetch JWKS", "url", cfg.Auth.JWT.JWKSURL, "error", err)
+		} else {
+			logger.Info("🔑 JWT authentication enabled", "issuer", cfg.Auth.JWT.Issuer)
+		}
+	}
+
+	// Optional request signing for server-to-server clients
+	var hmacVerifier *middleware.HMACVerifier
+	if len(cfg.Auth.HMAC.Keys) > 0 {
+		hmacVerifier, err = middleware.NewHMACVerifier(cfg.Auth.HMAC.Keys, cfg.Auth.HMAC.KeyRoles, cfg.Auth.HMAC.MaxSkew)
+		if err != nil {
+			datasets.Close()
+			return nil, err
+		}
+	}
+
+	// Open the admin audit log and check it hasn't been tampered with
+	auditLog, err := audit.NewLog(cfg.Admin.AuditLogFile)
+	if err != nil {
+		datasets.Close()
+		return nil, err
+	}
+	if count, err := auditLog.Verify(); err != nil {
+		logger.Error("⚠️ Audit log verification failed", "error", err)
+	} else if count > 0 {
+		logger.Info("📜 Audit log verified", "entries", count)
+	}
+
+	// Remember admin mutations by Idempotency-Key so retries aren't applied twice
+	idempotencyStore := idempotency.NewStore(cfg.Admin.IdempotencyFile, cfg.Admin.IdempotencyTTL)
+	if err := idempotencyStore.Load(); err != nil {
+		datasets.Close()
+		return nil, err
+	}
+	idempotencyStore.RegisterMetrics(registry)
+
+	// Canary experiments requests opt into with X-Experiment
+	experimentSet, err := experiments.Parse(cfg.Experiments.Definitions)
+	if err != nil {
+		datasets.Close()
+		return nil, err
+	}
+	if experimentSet.Len() > 0 {
+		experimentSet.RegisterMetrics(registry)
+		for _, name := range experimentSet.Names() {
+			if e, _ := experimentSet.Lookup(name); e.Dataset != "" && !datasets.Has(e.Dataset) {
+				logger.Warn("⚠️ Experiment names a dataset that isn't loaded", "experiment", name, "dataset", e.Dataset)
+			}
+		}
+		logger.Info("🧪 Experiments enabled", "experiments", experimentSet.Names())
+	}
+
+	if len(cfg.Server.DisabledMiddleware) > 0 {
+		logger.Warn("🧩 Middleware stages disabled", "stages", cfg.Server.DisabledMiddleware)
+	}
+
+	// Create router with rate limiters and metrics
+	router := handlers.NewRouterWithOptions(lookupService, logger, handlers.RouterOptions{
+		RateLimiter:        rateLimiter,
+		RateLimitExempt:    rateLimitExempt,
+		GlobalLimiter:      globalLimiter,
+		LoadShedder:        loadShedder,
+		Shadower:           shadower,
+		Chaos:              chaos,
+		TrustedProxies:     trustedProxies,
+		Build:              build,
+		Flags:              featureFlags,
+		Recoverer:          recoverer,
+		ErrorReporter:      reporter,
+		Quota:              quotaTracker,
+		Usage:              usageRecorder,
+		Reports:            reportCollector,
+		Misses:             missTracker,
+		Metrics:            registry,
+		LatencyBudgets:     latencyBudgets,
+		DebugClientIDMode:  debugClientIDMode(cfg),
+		BasePath:           cfg.Server.BasePath,
+		DisabledMiddleware: cfg.Server.DisabledMiddleware,
+		Experiments:        experimentSet,
+		Runtime:            &runtimeSettings,
+		Timeouts: middleware.TimeoutConfig{
+			Default:      cfg.Timeouts.Request,
+			Routes:       cfg.Timeouts.Routes,
+			ClientHeader: cfg.Timeouts.Header,
+		},
+		Maintenance:    maintenance,
+		Drain:          drain,
+		WarmUp:         warmUp,
+		HealthHistory:  healthHistory,
+		Watchdog:       lookupWatchdog,
+		AdminToken:     cfg.Admin.Token,
+		AdminInsecure:  cfg.Admin.Insecure,
+		ReadOnly:       cfg.Admin.ReadOnly,
+		Datasets:       datasets,
+		Overrides:      overrides,
+		Audit:          auditLog,
+		Idempotency:    idempotencyStore,
+		APIKeys:        apiKeys,
+		JWT:            jwtValidator,
+		HMAC:           hmacVerifier,
+		PrivacyMode:    cfg.Privacy.AnonymizeIPs || cfg.Privacy.DoNotStore,
+		LogLevel:       logLevel,
+		LogSampler:     middleware.NewLogSampler(cfg.Logging.SampleRate),
+		AuthRequired:   cfg.Auth.Required,
+		DatasetHeader:  cfg.Datasets.HeaderEnabled,
+		LocalizeErrors: cfg.Server.LocalizeErrors,
+		ServiceRegion:  cfg.Server.Region,
+		DatasetRegions: cfg.Datasets.Regions,
+		Shards:         shardRing,
+		ThreatIntel:    threatChecker,
+		SeparateAdmin:  cfg.Admin.Port != "",
+		IPParseMode:    models.ParseMode(cfg.Server.IPParseMode),
+		HostResolver:   hostResolver,
+		AccessPolicy:   accessPolicy,
+		Signer:         signer,
+		Batch: handlers.BatchOptions{
+			MaxIPs:       cfg.Batch.MaxIPs,
+			MaxStreamIPs: cfg.Batch.MaxStreamIPs,
+			Concurrency:  cfg.Batch.Concurrency,
+		},
+	})
+
+	// Setup routes with middleware
+	handler := router.SetupRoutesWithMiddleware(rateLimiter)
+
+	// Create server
+	server := newHTTPServer(cfg, cfg.GetServerAddress(), handler)
+
+	// Cleartext HTTP/2 for proxies that speak h2c to the backend
+	if cfg.Server.H2C {
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	// Operational endpoints on their own internal listener, with their own middleware
+	var adminServer *http.Server
+	if addr := cfg.GetAdminAddress(); addr != "" {
+		adminServer = newHTTPServer(cfg, addr, router.SetupAdminRoutesWithMiddleware())
+	}
+
+	return &App{
+		config:          cfg,
+		logger:          logger,
+		build:           build,
+		server:          server,
+		adminServer:     adminServer,
+		datasets:        datasets,
+		stats:           stats,
+		lookup:          lookupService,
+		auditLog:        auditLog,
+		rateLimiter:     rateLimiter,
+		warmUp:          warmUp,
+		watchdog:        lookupWatchdog,
+		torExits:        torExits,
+		flags:           featureFlags,
+		quotaStore:      quotaStore,
+		usageExporter:   usageExporter,
+		reports:         reportScheduler,
+		errorReporter:   errorReporter,
+		consumer:        queueConsumer,
+		secrets:         cfg.Secrets.Store,
+		pending:         pending,
+		listenerMetrics: newListenerMetrics(registry),
+	}, nil
+}
+
+// Start starts the background tasks and the application server
+func (a *App) Start() error {
+	// Background refreshers run until Stop
+	ctx := a.runBackground()
+
+	// Reuse the sockets from systemd or a previous process when they were passed in
+	inherited, source, err := inheritedListeners()
+	if err != nil {
+		return err
+	}
+	if len(inherited) == 0 {
+		source = "bound"
+	}
+	listeners, err := openListeners(a.server.Addr, max(a.config.Server.Listeners, 1), inherited)
+	if err != nil {
+		return err
+	}
+	a.listeners = listeners
+
+	// The admin socket is passed on by a predecessor too, so both ports keep accepting
+	if a.adminServer != nil {
+		adminListener, err := inheritedAdminListener()
+		if err == nil && adminListener == nil {
+			adminListener, err = net.Listen("tcp", a.adminServer.Addr)
+		}
+		if err != nil {
+			closeListeners(listeners)
+			return err
+		}
+		a.adminListener = adminListener
+	}
+
+	// Each public socket gets its own accept loop
+	for i, l := range listeners {
+		go func() {
+			if err := a.server.Serve(a.listenerMetrics.instrument(l, i)); err != nil && err != http.ErrServerClosed {
+				a.logger.Error("❌ Server failed to start", "listener", i, "error", err)
+			}
+		}()
+	}
+	started := []any{slog.Group("public", "addr", listeners[0].Addr().String(), "socket", source, "listeners", len(listeners))}
+	if a.adminServer != nil {
+		go func() {
+			if err := a.adminServer.Serve(a.adminListener); err != nil && err != http.ErrServerClosed {
+				a.logger.Error("❌ Admin server failed to start", "error", err)
+			}
+		}()
+		started = append(started, slog.Group("admin", "addr", a.adminListener.Addr().String()))
+	}
+	a.logStarted(started...)
+
+	// Warm up before reporting ready; a predecessor keeps serving until then
+	if a.warmUp != nil {
+		go func() {
+			a.runWarmUp(ctx)
+			a.releasePredecessor()
+		}()
+		return nil
+	}
+
+	// Now that we are accepting connections, let a predecessor drain and exit
+	a.releasePredecessor()
+	return nil
+}
+
+// StartBackground starts the background tasks and the warm-up without serving
+// anything, for when the handlers are mounted into another server
+func (a *App) StartBackground() {
+	ctx := a.runBackground()
+	a.logStarted()
+	if a.warmUp != nil {
+		go a.runWarmUp(ctx)
+	}
+}
+
+// runBackground starts the background refreshers, which run until Stop, and returns
+// their context
+func (a *App) runBackground() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopBackground = cancel
+	if a.torExits != nil {
+		go a.torExits.Run(ctx, func(err error) {
+			a.logger.Warn("Failed to refresh Tor exit list", "error", err)
+		})
+	}
+	if a.config.Flags.File != "" {
+		go a.flags.Run(ctx, func(err error) {
+			a.logger.Warn("Failed to reload feature flags", "error", err)
+		})
+	}
+	if a.usageExporter != nil {
+		go a.usageExporter.Run(ctx, func(err error) {
+			a.logger.Warn("Failed to export usage", "error", err)
+		})
+	}
+	if a.reports != nil {
+		go a.reports.Run(ctx, func(err error) {
+			a.logger.Warn("Failed to deliver scheduled report", "error", err)
+		})
+	}
+	if a.errorReporter != nil {
+		go a.errorReporter.Run(ctx, func(err error) {
+			a.logger.Warn("Failed to send error report", "error", err)
+		})
+	}
+	if a.consumer != nil {
+		a.consumerDone = make(chan struct{})
+		a.logger.Info("📨 Consumer starting",
+			"input", a.config.Consumer.InputSubject,
+			"output", a.config.Consumer.OutputSubject,
+			"queue_group", a.config.Consumer.QueueGroup)
+		go func() {
+			defer close(a.consumerDone)
+			a.consumer.Run(ctx, func(err error) {
+				a.logger.Warn("Consumer disconnected, reconnecting", "error", err)
+			})
+		}()
+	}
+	if a.secrets != nil && a.config.Secrets.RefreshInterval > 0 {
+		go a.secrets.Run(ctx, a.config.Secrets.RefreshInterval, func(err error) {
+			a.logger.Warn("Failed to refresh secrets", "error", err)
+		})
+	}
+	for name, source := range a.pending {
+		go func() {
+			err := a.datasets.LoadWithRetry(ctx, name, source, a.config.Database.RetryMax, func(err error, wait time.Duration) {
+				a.logger.Warn("Failed to load dataset, retrying", "dataset", name, "retry_in", wait, "error", err)
+			})
+			if err == nil {
+				a.logger.Info("✅ Dataset loaded", "dataset", name)
+			}
+		}()
+	}
+	if a.quotaStore != nil && a.config.Quota.File != "" {
+		go a.quotaStore.Run(ctx, a.config.Quota.FlushInterval, func(err error) {
+			a.logger.Warn("Failed to persist quota usage", "error", err)
+		})
+	}
+	if a.config.Database.MaxAge > 0 {
+		go a.datasets.WatchFreshness(ctx, services.FreshnessCheckInterval, func(info services.DatasetInfo) {
+			if info.Stale {
+				a.logger.Warn("⏳ Dataset is older than the maximum dataset age", "dataset", info.Name, "modified_at", info.ModifiedAt, "max_age", a.config.Database.MaxAge, "policy", a.config.Database.StalePolicy)
+			} else {
+				a.logger.Info("⏳ Dataset is fresh again", "dataset", info.Name, "modified_at", info.ModifiedAt)
+			}
+		})
+	}
+	if a.watchdog != nil {
+		go a.watchdog.Run(ctx, a.server.Handler, func(state watchdog.State) {
+			if state.Degraded {
+				a.logger.Warn("🐕 Watchdog lookups degraded", "result", state.LastProbe.Result, "error", state.LastProbe.Error, "duration_ms", state.LastProbe.DurationMS)
+			} else {
+				a.logger.Info("🐕 Watchdog lookups recovered", "duration_ms", state.LastProbe.DurationMS)
+			}
+		})
+	}
+	return ctx
+}
+
+// Handler returns the public API handler with its middleware. It serves the
+// operational endpoints too unless they have their own admin port.
+func (a *App) Handler() http.Handler {
+	return a.server.Handler
+}
+
+// AdminHandler returns the operational endpoints handler, or nil when they are
+// served by Handler
+func (a *App) AdminHandler() http.Handler {
+	if a.adminServer == nil {
+		return nil
+	}
+	return a.adminServer.Handler
+}
+
+// Service returns the lookup service, with overrides applied over every dataset
+func (a *App) Service() services.IPService {
+	return a.lookup
+}
+
+// runWarmUp makes the configured lookups in every dataset, bounded by the warm-up
+// timeout, then lets /health report the instance ready
+func (a *App) runWarmUp(ctx context.Context) {
+	defer a.warmUp.Finish()
+
+	ctx, cancel := context.WithTimeout(ctx, a.config.WarmUp.Timeout)
+	defer cancel()
+	a.logger.Info("🔥 Warming up datasets", "lookups", a.config.WarmUp.Lookups, "timeout", a.config.WarmUp.Timeout)
+	result := a.datasets.WarmUp(ctx, a.config.WarmUp.Lookups)
+	a.logger.Info("🔥 Warm-up finished",
+		"datasets", result.Datasets,
+		"lookups", result.Lookups,
+		"duration_ms", result.Duration.Milliseconds(),
+		"complete", result.Complete,
+	)
+}
+
+// releasePredecessor lets a predecessor that started this process drain and exit
+func (a *App) releasePredecessor() {
+	if err := notifyHandoffParent(); err != nil {
+		a.logger.Warn("Failed to notify previous process", "error", err)
+	}
+}
+
+// Upgrade starts a new copy of the binary sharing the listening sockets. This process
+// keeps serving until the new one is ready and sends it SIGTERM.
+func (a *App) Upgrade() {
+	if !a.upgrading.CompareAndSwap(false, true) {
+		a.logger.Warn("Upgrade already in progress")
+		return
+	}
+
+	cmd, err := startSuccessor(a.listeners, a.adminListener)
+	if err != nil {
+		a.upgrading.Store(false)
+		a.logger.Error("❌ Failed to start new process", "error", err)
+		return
+	}
+	a.logger.Info("🔁 Handing sockets to new process", "pid", cmd.Process.Pid, "listeners", len(a.listeners))
+
+	go func() {
+		// Reaching here means the new process exited before taking over
+		err := cmd.Wait()
+		a.upgrading.Store(false)
+		a.logger.Error("❌ New process exited during handoff", "pid", cmd.Process.Pid, "error", err)
+	}()
+}
+
+// Stop gracefully stops the application
+func (a *App) Stop() error {
+	a.logger.Info("🛑 Shutting down server...")
+
+	if a.stopBackground != nil {
+		a.stopBackground()
+	}
+
+	// Let in-flight queue lookups finish before their datasets close
+	if a.consumerDone != nil {
+		<-a.consumerDone
+	}
+
+	// Create a deadline for shutdown
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Shutdown server; a forced shutdown still runs the cleanup below
+	var errs []error
+	if err := a.server.Shutdown(shutdownCtx); err != nil {
+		a.logger.Error("❌ Server forced to shutdown", "error", err)
+		errs = append(errs, err)
+	}
+	if a.adminServer != nil {
+		if err := a.adminServer.Shutdown(shutdownCtx); err != nil {
+			a.logger.Error("❌ Admin server forced to shutdown", "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	// Close datasets and their repositories once no request can still look them up
+	if err := a.datasets.Close(); err != nil {
+		a.logger.Error("Failed to close repository", "error", err)
+		errs = append(errs, err)
+	}
+
+	// Export the last usage window once no request can still be recorded
+	if a.usageExporter != nil {
+		if err := a.usageExporter.Export(shutdownCtx); err != nil {
+			a.logger.Error("Failed to export usage", "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	// Send error reports queued by the last requests
+	if a.errorReporter != nil {
+		if err := a.errorReporter.Flush(shutdownCtx); err != nil {
+			a.logger.Error("Failed to send error reports", "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	// Persist quota usage once no request can still consume it
+	if a.quotaStore != nil {
+		if err := a.quotaStore.Flush(); err != nil {
+			a.logger.Error("Failed to persist quota usage", "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	// Close audit log once no admin request can still write to it
+	if err := a.auditLog.Close(); err != nil {
+		a.logger.Error("Failed to close audit log", "error", err)
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	a.logger.Info("✅ Server exited gracefully")
+	return nil
+}
+
+// newHTTPServer creates a server for addr with the configured timeouts and limits
+func newHTTPServer(cfg *config.Config, addr string, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:           addr,
+		Handler:        handler,
+		ReadTimeout:    cfg.Server.ReadTimeout,
+		WriteTimeout:   cfg.Server.WriteTimeout,
+		IdleTimeout:    cfg.Server.IdleTimeout,
+		MaxHeaderBytes: cfg.Server.MaxHeaderBytes,
+		HTTP2: &http.HTTP2Config{
+			MaxConcurrentStreams: cfg.Server.HTTP2MaxConcurrentStreams,
+		},
+	}
+	server.SetKeepAlivesEnabled(cfg.Server.KeepAlivesEnabled)
+	return server
+}
+
+// newDatasetLoader returns a loader that builds a repository and lookup service for a
+// dataset file, using the primary database settings with the file path replaced.
+// Datasets in object storage (s3:// or gs://) are downloaded and loaded from the copy.
+// Repositories with a connection pool are watched by pools.
+func newDatasetLoader(cfg *config.Config, logger *slog.Logger, stats *datasetStats, pools *repository.PoolMonitor, transport http.RoundTripper) services.DatasetLoader {
+	downloader := objectstore.NewDownloader(cfg.Database.CacheDir, transport)
+	return func(ctx context.Context, name, source string) (services.IPService, func() error, error) {
+		dbConfig := cfg.Database
+		dbConfig.FilePath = source
+		// DATA_CHECKSUM pins the primary data file and DATABASE_TIER_FILE holds its
+		// local copy; signatures apply to every dataset
+		if source != cfg.Database.FilePath {
+			dbConfig.Checksum = ""
+			dbConfig.Tier.LocalFile = ""
+		}
+		// EMBEDDED_DATA replaces the primary dataset with the compiled-in demo
+		dbConfig.Embedded = cfg.Database.Embedded && source == cfg.Database.FilePath
+		if dbConfig.Embedded {
+			logger.Info("🧪 Serving the embedded demo dataset", "dataset", name)
+		} else if objectstore.IsURL(source) {
+			local, err := downloadDataset(ctx, downloader, source, cfg.Database.PublicKey != "", logger)
+			if err != nil {
+				return nil, nil, err
+			}
+			logger.Info("☁️ Dataset downloaded", "dataset", name, "source", source, "path", local)
+			dbConfig.FilePath = local
+		}
+
+		repo, err := repository.NewRepositoryFactory(&dbConfig, logger.With("dataset", name)).CreateRepositoryFromConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := repo.Initialize(ctx); err != nil {
+			return nil, nil, err
+		}
+		pools.Track(name, repo)
+
+		if statsProvider, ok := repo.(repository.MemoryStatsProvider); ok {
+			memStats := statsProvider.MemoryStats()
+			stats.set(name, memStats)
+			logger.Info("📦 Dataset loaded",
+				"dataset", name,
+				"records", memStats.Records,
+				"unique_locations", memStats.UniqueLocations,
+				"unique_strings", memStats.UniqueStrings,
+				"naive_bytes", memStats.NaiveBytes,
+				"compact_bytes", memStats.CompactBytes,
+				"saved_bytes", memStats.SavedBytes(),
+				"heap_before", memStats.HeapBefore,
+				"heap_after", memStats.HeapAfter,
+				"load_duration_ms", memStats.LoadDurationMS,
+				"duplicates", memStats.Duplicates,
+				"conflicts", memStats.Conflicts,
+			)
+		}
+
+		// Localized names are optional and live next to the dataset file
+		var translations *services.Translations
+		if dbConfig.Embedded {
+			translations, err = services.LoadTranslationsFS(demodata.FS, demodata.Translations)
+		} else {
+			translations, err = services.LoadTranslations(services.TranslationsPath(dbConfig.FilePath))
+		}
+		if err != nil {
+			repo.Close()
+			return nil, nil, err
+		}
+		if translations != nil {
+			logger.Info("🌍 Translations loaded", "dataset", name, "names", translations.Len())
+		}
+
+		// Each dataset gets its own cache and prefetcher so results never mix
+		serviceOpts := services.ServiceOptions{
+			DoNotStore:        cfg.Privacy.DoNotStore,
+			Translations:      translations,
+			Backend:           dbConfig.Type,
+			LookupTimeout:     cfg.Timeouts.Service,
+			RepositoryTimeout: cfg.Timeouts.Repository,
+			HealthTimeout:     cfg.Timeouts.Health,
+		}
+		if dbConfig.Embedded {
+			serviceOpts.Backend = "embedded"
+		}
+		if cfg.Cache.Size > 0 {
+			serviceOpts.Cache = services.NewLocationCacheWithHardTTL(cfg.Cache.Size, cfg.Cache.TTL, cfg.Cache.HardTTL)
+		}
+		if cfg.Prefetch.Enabled {
+			serviceOpts.Prefetcher = services.NewPrefetcher(repo, serviceOpts.Cache, cfg.Prefetch.Trigger, cfg.Prefetch.Window)
+		}
+
+		return services.NewIPServiceWithOptions(repo, serviceOpts), repo.Close, nil
+	}
+}
+
+// downloadDataset fetches a dataset from object storage along with its signature,
+// when signatures are checked, and its optional translations, and returns the local
+// path of the dataset
+func downloadDataset(ctx context.Context, downloader *objectstore.Downloader, source string, signed bool, logger *slog.Logger) (string, error) {
+	local, err := downloader.Download(ctx, source)
+	if err != nil {
+		return "", err
+	}
+	if signed {
+		if _, err := downloader.Download(ctx, source+repository.SignatureSuffix); err != nil {
+			return "", err
+		}
+	}
+
+	translations := services.TranslationsPath(source)
+	if _, err := downloader.Download(ctx, translations); errors.Is(err, objectstore.ErrNotFound) {
+		// Drop a copy left from when the object existed
+		if path, err := downloader.LocalPath(translations); err == nil {
+			os.Remove(path)
+		}
+	} else if err != nil {
+		// Buckets without list access answer 403 for missing objects, so translations
+		// that can't be read are skipped rather than failing the dataset
+		logger.Warn("Translations not downloaded", "source", translations, "error", err)
+	}
+	return local, nil
+}
+
+// debugClientIDMode returns how /debug/rate-limiter renders client IDs; privacy mode never shows raw IPs
+func debugClientIDMode(cfg *config.Config) string {
+	privacyMode := cfg.Privacy.AnonymizeIPs || cfg.Privacy.DoNotStore
+	if privacyMode && cfg.RateLimit.DebugClientIDMode == middleware.ClientIDModeRaw {
+		return middleware.ClientIDModeTruncate
+	}
+	return cfg.RateLimit.DebugClientIDMode
+}
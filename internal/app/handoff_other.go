@@ -0,0 +1,33 @@
+//go:build !unix
+
+package app
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+)
+
+// UpgradeSignal is unavailable on this platform
+var UpgradeSignal os.Signal
+
+// inheritedListeners never finds an inherited socket on this platform
+func inheritedListeners() ([]net.Listener, string, error) {
+	return nil, "", nil
+}
+
+// inheritedAdminListener never finds an inherited socket on this platform
+func inheritedAdminListener() (net.Listener, error) {
+	return nil, nil
+}
+
+// startSuccessor is not supported on this platform
+func startSuccessor(listeners []net.Listener, adminListener net.Listener) (*exec.Cmd, error) {
+	return nil, errors.New("socket handoff is not supported on this platform")
+}
+
+// notifyHandoffParent is a no-op on this platform
+func notifyHandoffParent() error {
+	return nil
+}
@@ -0,0 +1,182 @@
+//go:build unix
+
+package app
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Environment variables passed to a successor process during a socket handoff
+const (
+	inheritedFDEnv      = "IPGEO_INHERITED_FD" // Comma-separated public sockets
+	inheritedAdminFDEnv = "IPGEO_INHERITED_ADMIN_FD"
+	handoffParentEnv    = "IPGEO_HANDOFF_PARENT"
+)
+
+// systemdFirstFD is the first file descriptor passed by systemd socket activation
+const systemdFirstFD = 3
+
+// UpgradeSignal asks a running server to hand its socket to a new process
+var UpgradeSignal os.Signal = syscall.SIGUSR2
+
+// inheritedListeners returns the listening sockets passed in by systemd socket
+// activation (the first one) or by a predecessor process (all of its public
+// sockets), and where they came from. It returns no listeners when the process
+// should open its own.
+func inheritedListeners() ([]net.Listener, string, error) {
+	if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid == os.Getpid() {
+		if count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS")); count >= 1 {
+			os.Unsetenv("LISTEN_PID")
+			os.Unsetenv("LISTEN_FDS")
+			os.Unsetenv("LISTEN_FDNAMES")
+			listener, source, err := fileListener(systemdFirstFD, "systemd")
+			if err != nil {
+				return nil, "", err
+			}
+			return []net.Listener{listener}, source, nil
+		}
+	}
+
+	value := os.Getenv(inheritedFDEnv)
+	if value == "" {
+		return nil, "", nil
+	}
+	os.Unsetenv(inheritedFDEnv)
+	var listeners []net.Listener
+	for _, field := range strings.Split(value, ",") {
+		fd, err := strconv.Atoi(field)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, "", fmt.Errorf("invalid %s: %s", inheritedFDEnv, value)
+		}
+		listener, _, err := fileListener(fd, "handoff")
+		if err != nil {
+			closeListeners(listeners)
+			return nil, "", err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, "handoff", nil
+}
+
+// inheritedAdminListener returns the admin listening socket passed in by a
+// predecessor process, or nil when the process should open its own
+func inheritedAdminListener() (net.Listener, error) {
+	value := os.Getenv(inheritedAdminFDEnv)
+	if value == "" {
+		return nil, nil
+	}
+	os.Unsetenv(inheritedAdminFDEnv)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", inheritedAdminFDEnv, value)
+	}
+	listener, _, err := fileListener(fd, "handoff")
+	return listener, err
+}
+
+func fileListener(fd int, source string) (net.Listener, string, error) {
+	file := os.NewFile(uintptr(fd), source+"-listener")
+	defer file.Close()
+
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to use %s socket: %w", source, err)
+	}
+	return listener, source, nil
+}
+
+// startSuccessor re-executes the current binary with every public socket and the
+// admin socket attached (adminListener may be nil). Both processes accept
+// connections on the sockets until the successor signals this process to shut down.
+func startSuccessor(listeners []net.Listener, adminListener net.Listener) (*exec.Cmd, error) {
+	var files []*os.File
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	// ExtraFiles[i] becomes fd 3+i in the child
+	var fds []string
+	for _, listener := range listeners {
+		file, err := listenerFile(listener)
+		if err != nil {
+			return nil, err
+		}
+		fds = append(fds, strconv.Itoa(3+len(files)))
+		files = append(files, file)
+	}
+
+	if adminListener != nil {
+		adminFile, err := listenerFile(adminListener)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, adminFile)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	var env []string
+	for _, entry := range os.Environ() {
+		if !strings.HasPrefix(entry, inheritedFDEnv+"=") && !strings.HasPrefix(entry, inheritedAdminFDEnv+"=") &&
+			!strings.HasPrefix(entry, handoffParentEnv+"=") {
+			env = append(env, entry)
+		}
+	}
+	env = append(env,
+		inheritedFDEnv+"="+strings.Join(fds, ","),
+		handoffParentEnv+"="+strconv.Itoa(os.Getpid()),
+	)
+	if adminListener != nil {
+		env = append(env, inheritedAdminFDEnv+"="+strconv.Itoa(3+len(listeners)))
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start successor: %w", err)
+	}
+	return cmd, nil
+}
+
+// listenerFile duplicates the socket of listener so it can be passed to a child
+func listenerFile(listener net.Listener) (*os.File, error) {
+	filer, ok := listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("listener does not support handoff")
+	}
+	file, err := filer.File()
+	if err != nil {
+		return nil, fmt.Errorf("failed to duplicate listener: %w", err)
+	}
+	return file, nil
+}
+
+// notifyHandoffParent tells the process that started us (if any) that we are serving,
+// so it can shut down gracefully
+func notifyHandoffParent() error {
+	value := os.Getenv(handoffParentEnv)
+	if value == "" {
+		return nil
+	}
+	os.Unsetenv(handoffParentEnv)
+
+	pid, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", handoffParentEnv, value)
+	}
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
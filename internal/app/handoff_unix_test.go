@@ -0,0 +1,56 @@
+//go:build unix
+
+package app
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestInheritedListeners_Handoff(t *testing.T) {
+	var fds []string
+	var addrs []string
+	for range 2 {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen() error = %v", err)
+		}
+		defer l.Close()
+		file, err := listenerFile(l)
+		if err != nil {
+			t.Fatalf("listenerFile() error = %v", err)
+		}
+		// inheritedListeners takes ownership of a bare descriptor, as of a passed one
+		fd, err := syscall.Dup(int(file.Fd()))
+		file.Close()
+		if err != nil {
+			t.Fatalf("Dup() error = %v", err)
+		}
+		fds = append(fds, strconv.Itoa(fd))
+		addrs = append(addrs, l.Addr().String())
+	}
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv(inheritedFDEnv, strings.Join(fds, ","))
+
+	listeners, source, err := inheritedListeners()
+	if err != nil {
+		t.Fatalf("inheritedListeners() error = %v", err)
+	}
+	defer closeListeners(listeners)
+	if source != "handoff" || len(listeners) != 2 {
+		t.Fatalf("inheritedListeners() = %d listeners from %q, want 2 from handoff", len(listeners), source)
+	}
+	for i, l := range listeners {
+		if l.Addr().String() != addrs[i] {
+			t.Errorf("Listener %d is on %s, want %s", i, l.Addr(), addrs[i])
+		}
+	}
+
+	t.Setenv(inheritedFDEnv, "x")
+	if _, _, err := inheritedListeners(); err == nil {
+		t.Error("Expected an error for a malformed descriptor list")
+	}
+}
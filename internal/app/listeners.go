@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// listenerMetrics counts connections per public listener, so an unbalanced spread
+// across SO_REUSEPORT sockets shows up
+type listenerMetrics struct {
+	accepted *metrics.CounterVec
+	active   *metrics.GaugeVec
+}
+
+func newListenerMetrics(registry *metrics.Registry) *listenerMetrics {
+	return &listenerMetrics{
+		accepted: registry.NewCounterVec("ipgeo_listener_accepted_connections_total",
+			"Connections accepted by each public listener", []string{"listener"}),
+		active: registry.NewGaugeVec("ipgeo_listener_active_connections",
+			"Open connections accepted by each public listener", []string{"listener"}),
+	}
+}
+
+// openListeners returns count listeners on addr, starting with the inherited ones
+// when sockets were passed in. Every inherited socket is served, even beyond count,
+// so connections already queued on it aren't dropped. With more than one, every new
+// socket is opened with SO_REUSEPORT so the kernel spreads incoming connections
+// across their accept loops.
+func openListeners(addr string, count int, inherited []net.Listener) ([]net.Listener, error) {
+	listeners := slices.Clone(inherited)
+
+	var lc net.ListenConfig
+	if count > len(listeners) && count > 1 {
+		if !reusePortSupported {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("LISTENERS=%d needs SO_REUSEPORT, which this platform lacks", count)
+		}
+		lc.Control = reusePort
+	}
+	if len(inherited) > 0 {
+		// Later sockets join the inherited ones' port
+		addr = inherited[0].Addr().String()
+	}
+	for len(listeners) < count {
+		l, err := lc.Listen(context.Background(), "tcp", addr)
+		if err != nil {
+			closeListeners(listeners)
+			if len(inherited) > 0 {
+				return nil, fmt.Errorf("failed to open another listener beside the inherited socket, which needs SO_REUSEPORT: %w", err)
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+		// With port 0, the remaining sockets share the port the first one got
+		addr = l.Addr().String()
+	}
+	return listeners, nil
+}
+
+// closeListeners closes every listener in listeners
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// instrument counts the connections l accepts under the listener label index
+func (m *listenerMetrics) instrument(l net.Listener, index int) net.Listener {
+	if m == nil {
+		return l
+	}
+	return &countingListener{Listener: l, label: strconv.Itoa(index), metrics: m}
+}
+
+// countingListener records accepted and open connections
+type countingListener struct {
+	net.Listener
+	label   string
+	metrics *listenerMetrics
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.metrics.accepted.Inc(l.label)
+	l.metrics.active.Add(1, l.label)
+	return &countingConn{Conn: conn, listener: l}, nil
+}
+
+// countingConn leaves the open connection count once, however often it is closed
+type countingConn struct {
+	net.Conn
+	listener *countingListener
+	once     sync.Once
+}
+
+func (c *countingConn) Close() error {
+	c.once.Do(func() { c.listener.metrics.active.Add(-1, c.listener.label) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestOpenListeners_SharePort(t *testing.T) {
+	if !reusePortSupported {
+		t.Skip("SO_REUSEPORT is not available on this platform")
+	}
+
+	listeners, err := openListeners("127.0.0.1:0", 2, nil)
+	if err != nil {
+		t.Fatalf("openListeners() error = %v", err)
+	}
+	defer closeListeners(listeners)
+
+	if len(listeners) != 2 {
+		t.Fatalf("Expected 2 listeners, got %d", len(listeners))
+	}
+	if first, second := listeners[0].Addr().String(), listeners[1].Addr().String(); first != second {
+		t.Errorf("Expected the listeners to share a port, got %s and %s", first, second)
+	}
+}
+
+func TestOpenListeners_Inherited(t *testing.T) {
+	if !reusePortSupported {
+		t.Skip("SO_REUSEPORT is not available on this platform")
+	}
+	lc := net.ListenConfig{Control: reusePort}
+	inherited, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	// The inherited socket comes first and the others join its port
+	listeners, err := openListeners("127.0.0.1:0", 3, []net.Listener{inherited})
+	if err != nil {
+		t.Fatalf("openListeners() error = %v", err)
+	}
+	defer closeListeners(listeners)
+	if len(listeners) != 3 || listeners[0] != inherited {
+		t.Fatalf("Expected the inherited listener and 2 more, got %v", listeners)
+	}
+	for i, l := range listeners {
+		if l.Addr().String() != inherited.Addr().String() {
+			t.Errorf("Listener %d is on %s, want %s", i, l.Addr(), inherited.Addr())
+		}
+	}
+
+	// Every inherited socket is served, even beyond the count
+	served, err := openListeners("127.0.0.1:0", 1, listeners)
+	if err != nil {
+		t.Fatalf("openListeners() error = %v", err)
+	}
+	if len(served) != 3 {
+		t.Errorf("Expected all 3 inherited listeners, got %d", len(served))
+	}
+}
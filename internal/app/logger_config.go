@@ -0,0 +1,47 @@
+package app
+
+import (
+	"log/slog"
+	"os"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/privacy"
+)
+
+// setupLogger configures the logger based on configuration. The returned level
+// can be changed at runtime.
+func setupLogger(cfg config.LoggingConfig, privacyCfg config.PrivacyConfig) (*slog.Logger, *slog.LevelVar) {
+	level := new(slog.LevelVar)
+	switch cfg.Level {
+	case "debug":
+		level.Set(slog.LevelDebug)
+	case "info":
+		level.Set(slog.LevelInfo)
+	case "warn":
+		level.Set(slog.LevelWarn)
+	case "error":
+		level.Set(slog.LevelError)
+	default:
+		level.Set(slog.LevelInfo)
+	}
+
+	var handler slog.Handler
+	if cfg.Format == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+			Level: level,
+		})
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+			Level: level,
+		})
+	}
+
+	// Every record passes through IP redaction (do-not-store) or anonymization (privacy mode)
+	if privacyCfg.DoNotStore {
+		handler = privacy.NewRedactingLogHandler(handler)
+	} else if privacyCfg.AnonymizeIPs {
+		handler = privacy.NewLogHandler(handler)
+	}
+
+	return slog.New(handler), level
+}
@@ -0,0 +1,20 @@
+//go:build (linux && !mips && !mipsle && !mips64 && !mips64le) || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package app
+
+import "syscall"
+
+// reusePortSupported reports whether several sockets can share a port
+const reusePortSupported = true
+
+// reusePort sets SO_REUSEPORT on a socket before it is bound
+func reusePort(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,16 @@
+//go:build !((linux && !mips && !mipsle && !mips64 && !mips64le) || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package app
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePortSupported reports whether several sockets can share a port
+const reusePortSupported = false
+
+// reusePort is unavailable on this platform
+func reusePort(network, address string, c syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
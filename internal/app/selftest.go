@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"ip-geolocation-service/internal/models"
+)
+
+// selfTestTimeout bounds the whole self-test
+const selfTestTimeout = 30 * time.Second
+
+// selfTestCase is one expected lookup result from the verification file
+type selfTestCase struct {
+	ip      string
+	city    string // "" skips the city check
+	country string
+}
+
+// loadSelfTestCases reads a verification file of "ip,city,country" rows, with an
+// optional header
+func loadSelfTestCases(path string) ([]selfTestCase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open verification file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 3
+	reader.Comment = '#'
+
+	var cases []selfTestCase
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("verification file %s: %w", path, err)
+		}
+		if line == 1 && record[0] == "ip" {
+			continue // Header
+		}
+		cases = append(cases, selfTestCase{
+			ip:      strings.TrimSpace(record[0]),
+			city:    strings.TrimSpace(record[1]),
+			country: strings.TrimSpace(record[2]),
+		})
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("verification file %s has no lookups", path)
+	}
+	return cases, nil
+}
+
+// SelfTest checks that the loaded datasets answer the lookups in the verification
+// file and that the service reports healthy, writing one line per check to out.
+// It returns an error if any check failed.
+func (a *App) SelfTest(verificationFile string, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+	defer cancel()
+
+	var failures []error
+	check := func(name string, err error) {
+		if err != nil {
+			fmt.Fprintf(out, "❌ %s: %v\n", name, err)
+			failures = append(failures, fmt.Errorf("%s: %w", name, err))
+			return
+		}
+		fmt.Fprintf(out, "✅ %s\n", name)
+	}
+
+	cases, err := loadSelfTestCases(verificationFile)
+	check("load "+verificationFile, err)
+	for _, tc := range cases {
+		var location *models.Location
+		addr, err := models.ParseIP(tc.ip)
+		if err == nil {
+			location, err = a.lookup.FindLocation(ctx, addr)
+		}
+		switch {
+		case err != nil:
+		case location.Country != tc.country:
+			err = fmt.Errorf("country = %q, want %q", location.Country, tc.country)
+		case tc.city != "" && location.City != tc.city:
+			err = fmt.Errorf("city = %q, want %q", location.City, tc.city)
+		}
+		check("lookup "+tc.ip, err)
+	}
+
+	check("service health", a.lookup.HealthCheck(ctx))
+
+	// The health endpoint goes through the full middleware chain
+	w := httptest.NewRecorder()
+	a.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil).WithContext(ctx))
+	if w.Code != http.StatusOK {
+		err = fmt.Errorf("status %d: %s", w.Code, strings.TrimSpace(w.Body.String()))
+	} else {
+		err = nil
+	}
+	check("GET /health", err)
+
+	return errors.Join(failures...)
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+
+	"ip-geolocation-service/internal/repository"
+)
+
+// datasetStats keeps the load statistics of each dataset, reported in the startup summary
+type datasetStats struct {
+	mu     sync.Mutex
+	byName map[string]repository.MemoryStats
+}
+
+func newDatasetStats() *datasetStats {
+	return &datasetStats{byName: make(map[string]repository.MemoryStats)}
+}
+
+// set records the statistics of the latest load of a dataset
+func (s *datasetStats) set(name string, stats repository.MemoryStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byName[name] = stats
+}
+
+// get returns the statistics of a dataset, if its repository reports them
+func (s *datasetStats) get(name string) (repository.MemoryStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats, ok := s.byName[name]
+	return stats, ok
+}
+
+// logStarted emits the single "service started" event: build info, listeners, every
+// dataset, the enabled features and the resolved configuration with credentials
+// redacted. Its event attribute lets log pipelines pick it out.
+func (a *App) logStarted(listeners ...any) {
+	a.logger.Info("🚀 Service started",
+		"event", "service_started",
+		slog.Group("build",
+			"version", a.build.Version,
+			"commit", a.build.Commit,
+			"build_date", a.build.BuildDate,
+			"go_version", a.build.GoVersion,
+			"modified", a.build.Modified,
+		),
+		slog.Group("listeners", listeners...),
+		slog.Group("datasets", a.datasetSummary()...),
+		"features", a.config.Features(),
+		"config", a.config,
+	)
+}
+
+// datasetSummary describes each dataset by name, including those still loading
+func (a *App) datasetSummary() []any {
+	var attrs []any
+	for _, info := range a.datasets.List() {
+		fields := []any{
+			"status", "loaded",
+			"source", info.Source,
+			"version", info.Version,
+			"default", info.Default,
+		}
+		if stats, ok := a.stats.get(info.Name); ok {
+			fields = append(fields,
+				"records", stats.Records,
+				"unique_locations", stats.UniqueLocations,
+				"compact_bytes", stats.CompactBytes,
+				"load_duration_ms", stats.LoadDurationMS,
+			)
+		}
+		attrs = append(attrs, slog.Group(info.Name, fields...))
+	}
+
+	pending := make([]string, 0, len(a.pending))
+	for name := range a.pending {
+		pending = append(pending, name)
+	}
+	sort.Strings(pending)
+	for _, name := range pending {
+		if !a.datasets.Has(name) {
+			attrs = append(attrs, slog.Group(name, "status", "loading", "source", a.pending[name]))
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,270 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultMaxEntries is how many recent entries are kept in memory for queries
+const DefaultMaxEntries = 10000
+
+// Entry is a single audited admin operation. Entries form a hash chain: each
+// entry's Hash covers its own fields and the previous entry's hash, so editing,
+// removing or reordering lines in the log breaks verification.
+type Entry struct {
+	Seq        uint64          `json:"seq"`
+	Time       time.Time       `json:"time"`
+	Actor      string          `json:"actor"`
+	RemoteAddr string          `json:"remote_addr,omitempty"`
+	Action     string          `json:"action"`
+	Target     string          `json:"target,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// computeHash returns the chain hash of the entry (with Hash itself excluded)
+func (e Entry) computeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Filter selects entries returned by Query
+type Filter struct {
+	Actor  string
+	Action string
+	Target string
+	Since  time.Time
+	Until  time.Time
+	Limit  int // Maximum entries returned, newest first (0 means all)
+}
+
+func (f Filter) matches(e Entry) bool {
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if f.Target != "" && e.Target != f.Target {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Log is an append-only, hash-chained audit log written as JSON lines. The most
+// recent entries are also kept in memory to serve queries.
+type Log struct {
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	entries    []Entry
+	maxEntries int
+	lastSeq    uint64
+	lastHash   string
+}
+
+// NewLog opens (or creates) the audit log at path and resumes its hash chain.
+// An empty path keeps the log in memory only.
+func NewLog(path string) (*Log, error) {
+	l := &Log{path: path, maxEntries: DefaultMaxEntries}
+	if path == "" {
+		return l, nil
+	}
+
+	entries, err := readEntries(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		l.remember(entry)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	l.file = file
+	return l, nil
+}
+
+// Record appends an entry for an admin operation. before and after describe the
+// affected state and may be nil.
+func (l *Log) Record(actor, remoteAddr, action, target string, before, after interface{}) (Entry, error) {
+	beforeJSON, err := marshalState(before)
+	if err != nil {
+		return Entry{}, err
+	}
+	afterJSON, err := marshalState(after)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := Entry{
+		Seq:        l.lastSeq + 1,
+		Time:       time.Now().UTC(),
+		Actor:      actor,
+		RemoteAddr: remoteAddr,
+		Action:     action,
+		Target:     target,
+		Before:     beforeJSON,
+		After:      afterJSON,
+		PrevHash:   l.lastHash,
+	}
+	if entry.Hash, err = entry.computeHash(); err != nil {
+		return Entry{}, fmt.Errorf("failed to hash audit entry: %w", err)
+	}
+
+	if l.file != nil {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return Entry{}, fmt.Errorf("failed to encode audit entry: %w", err)
+		}
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			return Entry{}, fmt.Errorf("failed to write audit entry: %w", err)
+		}
+		if err := l.file.Sync(); err != nil {
+			return Entry{}, fmt.Errorf("failed to sync audit log: %w", err)
+		}
+	}
+
+	l.remember(entry)
+	return entry, nil
+}
+
+// Query returns matching in-memory entries, newest first
+func (l *Log) Query(filter Filter) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make([]Entry, 0)
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		if filter.matches(l.entries[i]) {
+			result = append(result, l.entries[i])
+			if filter.Limit > 0 && len(result) == filter.Limit {
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Verify checks the hash chain. With a file it re-reads the whole log from disk;
+// otherwise it checks the in-memory entries. It returns the number of entries checked.
+func (l *Log) Verify() (int, error) {
+	l.mu.Lock()
+	entries := l.entries
+	path := l.path
+	l.mu.Unlock()
+
+	if path != "" {
+		var err error
+		if entries, err = readEntries(path); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), verifyChain(entries)
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// remember appends entry to the in-memory window and advances the chain; caller must hold the lock
+func (l *Log) remember(entry Entry) {
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > l.maxEntries {
+		l.entries = append(l.entries[:0:0], l.entries[len(l.entries)-l.maxEntries:]...)
+	}
+	l.lastSeq = entry.Seq
+	l.lastHash = entry.Hash
+}
+
+// verifyChain checks that every entry's hash is intact and links to its predecessor
+func verifyChain(entries []Entry) error {
+	for i, entry := range entries {
+		if i > 0 {
+			previous := entries[i-1]
+			if entry.PrevHash != previous.Hash || entry.Seq != previous.Seq+1 {
+				return fmt.Errorf("audit chain broken at seq %d: does not follow seq %d", entry.Seq, previous.Seq)
+			}
+		}
+		hash, err := entry.computeHash()
+		if err != nil {
+			return err
+		}
+		if hash != entry.Hash {
+			return fmt.Errorf("audit chain broken at seq %d: entry was modified", entry.Seq)
+		}
+	}
+	return nil
+}
+
+// readEntries parses every line of the log file
+func readEntries(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+func marshalState(state interface{}) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit state: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLog_RecordAndQuery(t *testing.T) {
+	log, err := NewLog("")
+	if err != nil {
+		t.Fatalf("NewLog() error = %v", err)
+	}
+
+	log.Record("admin-token", "10.0.0.1:1234", "override.set", "8.8.8.8", nil, map[string]string{"country": "X"})
+	log.Record("admin-token", "10.0.0.1:1234", "maintenance.update", "", map[string]bool{"enabled": false}, map[string]bool{"enabled": true})
+	log.Record("anonymous", "10.0.0.2:1234", "override.delete", "8.8.8.8", map[string]string{"country": "X"}, nil)
+
+	entries := log.Query(Filter{})
+	if len(entries) != 3 || entries[0].Seq != 3 {
+		t.Fatalf("Query() returned %d entries, newest seq %d; want 3 newest first", len(entries), entries[0].Seq)
+	}
+
+	if got := log.Query(Filter{Target: "8.8.8.8"}); len(got) != 2 {
+		t.Errorf("Query(target) returned %d entries, want 2", len(got))
+	}
+	if got := log.Query(Filter{Actor: "anonymous"}); len(got) != 1 || got[0].Action != "override.delete" {
+		t.Errorf("Query(actor) = %+v", got)
+	}
+	if got := log.Query(Filter{Limit: 1}); len(got) != 1 {
+		t.Errorf("Query(limit) returned %d entries, want 1", len(got))
+	}
+	if got := log.Query(Filter{Since: time.Now().Add(time.Hour)}); len(got) != 0 {
+		t.Errorf("Query(since future) returned %d entries, want 0", len(got))
+	}
+
+	if count, err := log.Verify(); err != nil || count != 3 {
+		t.Errorf("Verify() = %d, %v", count, err)
+	}
+}
+
+func TestLog_PersistsAndDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	log, err := NewLog(path)
+	if err != nil {
+		t.Fatalf("NewLog() error = %v", err)
+	}
+	log.Record("admin-token", "", "dataset.load", "free", nil, map[string]string{"source": "free.csv"})
+	log.Record("admin-token", "", "dataset.set_default", "free", nil, nil)
+	log.Close()
+
+	// Reopening resumes the chain
+	log, err = NewLog(path)
+	if err != nil {
+		t.Fatalf("NewLog() reopen error = %v", err)
+	}
+	entry, err := log.Record("admin-token", "", "dataset.remove", "old", nil, nil)
+	if err != nil || entry.Seq != 3 {
+		t.Fatalf("Record() after reopen = seq %d, %v; want seq 3", entry.Seq, err)
+	}
+	log.Close()
+
+	if count, err := log.Verify(); err != nil || count != 3 {
+		t.Fatalf("Verify() = %d, %v", count, err)
+	}
+
+	// Editing a line breaks verification
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), "free.csv", "evil.csv", 1)), 0o600)
+	if _, err := log.Verify(); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Errorf("Verify() after edit error = %v, want modification detected", err)
+	}
+
+	// Deleting a line breaks verification
+	lines := strings.SplitAfter(string(data), "\n")
+	os.WriteFile(path, []byte(lines[0]+lines[2]), 0o600)
+	if _, err := log.Verify(); err == nil || !strings.Contains(err.Error(), "chain broken") {
+		t.Errorf("Verify() after deletion error = %v, want broken chain", err)
+	}
+}
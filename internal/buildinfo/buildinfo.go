@@ -0,0 +1,70 @@
+// Package buildinfo describes the running binary. Release builds set the version,
+// commit and build date with linker flags:
+//
+//	go build -ldflags "-X ip-geolocation-service/internal/buildinfo.Version=1.2.0 \
+//	  -X ip-geolocation-service/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X ip-geolocation-service/internal/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// Set at link time; see the package documentation
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// Info is the build metadata of the running binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a working tree with uncommitted changes
+}
+
+// Get returns the build metadata. Without a linked commit, the commit falls back to
+// the VCS stamp the go command embeds when building inside a git checkout.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: Date,
+		GoVersion: runtime.Version(),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info = withVCS(info, build.Settings)
+	}
+	return info
+}
+
+// withVCS fills a commit missing from info from VCS build settings
+func withVCS(info Info, settings []debug.BuildSetting) Info {
+	fromVCS := info.Commit == ""
+	for _, setting := range settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.modified":
+			if fromVCS {
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// RegisterMetrics exposes the build metadata as the labels of a constant gauge
+func (i Info) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeVec("ipgeo_build_info",
+		"Build metadata of the running binary, always 1",
+		[]string{"version", "commit", "go_version"}).Set(1, i.Version, i.Commit, i.GoVersion)
+}
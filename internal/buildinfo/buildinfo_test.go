@@ -0,0 +1,51 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+func TestGet(t *testing.T) {
+	info := Get()
+	if info.Version != Version {
+		t.Errorf("Version = %s, want %s", info.Version, Version)
+	}
+	if info.GoVersion != runtime.Version() {
+		t.Errorf("GoVersion = %s, want %s", info.GoVersion, runtime.Version())
+	}
+}
+
+func TestWithVCS(t *testing.T) {
+	settings := []debug.BuildSetting{
+		{Key: "vcs", Value: "git"},
+		{Key: "vcs.revision", Value: "4f1c2e9"},
+		{Key: "vcs.modified", Value: "true"},
+	}
+
+	info := withVCS(Info{Version: "dev"}, settings)
+	if info.Commit != "4f1c2e9" || !info.Modified {
+		t.Errorf("Expected the VCS commit of a modified tree, got %+v", info)
+	}
+
+	// A linked commit wins, and says nothing about the VCS tree
+	info = withVCS(Info{Version: "1.2.0", Commit: "abc123", BuildDate: "2026-03-10T12:00:00Z"}, settings)
+	if info.Commit != "abc123" || info.Modified || info.BuildDate != "2026-03-10T12:00:00Z" {
+		t.Errorf("Expected linked metadata to be kept, got %+v", info)
+	}
+}
+
+func TestInfo_RegisterMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	Info{Version: "1.2.0", Commit: "abc123", GoVersion: "go1.24.0"}.RegisterMetrics(registry)
+
+	var out strings.Builder
+	registry.Write(&out)
+	want := `ipgeo_build_info{version="1.2.0",commit="abc123",go_version="go1.24.0"} 1`
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %s in:\n%s", want, out.String())
+	}
+}
@@ -1,19 +1,71 @@
 package config
 
 import (
+	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"ip-geolocation-service/internal/countries"
+	"ip-geolocation-service/internal/egress"
+	"ip-geolocation-service/internal/experiments"
+	"ip-geolocation-service/internal/jws"
+	"ip-geolocation-service/internal/resolver"
+	"ip-geolocation-service/internal/secrets"
+	"ip-geolocation-service/internal/shard"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Server    ServerConfig
-	Database  DatabaseConfig
-	RateLimit RateLimitConfig
-	Logging   LoggingConfig
+	// Settings whose value failed to parse, reported by Validate
+	envProblems []*FieldError
+
+	Server      ServerConfig
+	Database    DatabaseConfig
+	RateLimit   RateLimitConfig
+	LoadShed    LoadShedConfig
+	Logging     LoggingConfig
+	Privacy     PrivacyConfig
+	Threats     ThreatIntelConfig
+	Hosts       HostLookupConfig
+	Access      AccessPolicyConfig
+	Signing     ResponseSigningConfig
+	Shadow      ShadowConfig
+	Experiments ExperimentsConfig
+	Chaos       ChaosConfig
+	Errors      ErrorReportingConfig
+	Quota       QuotaConfig
+	Usage       UsageExportConfig
+	Reports     ReportConfig
+	Coverage    CoverageConfig
+	Flags       FlagsConfig
+	Cache       CacheConfig
+	Prefetch    PrefetchConfig
+	WarmUp      WarmUpConfig
+	Health      HealthConfig
+	Watchdog    WatchdogConfig
+	Batch       BatchConfig
+	Consumer    ConsumerConfig
+	Timeouts    TimeoutConfig
+	Latency     LatencyBudgetConfig
+	Admin       AdminConfig
+	Datasets    DatasetsConfig
+	Shard       ShardConfig
+	Auth        AuthConfig
+	Secrets     SecretsConfig
+	Egress      EgressConfig
+	Runtime     RuntimeConfig
 }
 
 // Database types
@@ -24,8 +76,12 @@ const (
 	DatabaseTypePostgres = "postgres"
 	DatabaseTypeMySQL    = "mysql"
 	DatabaseTypeRedis    = "redis"
+	DatabaseTypeParquet  = "parquet" // Read-only, loaded by the file repository
 )
 
+// DefaultDatabaseTable is the table PostgreSQL and MySQL datasets are read from
+const DefaultDatabaseTable = "ip_locations"
+
 // Log levels
 const (
 	LogLevelDebug = "debug"
@@ -46,60 +102,766 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+	// SocketHandoff lets SIGUSR2 start a new binary on the same listening socket
+	SocketHandoff bool
+	// MaxHeaderBytes caps request header size (0 uses net/http's 1MB default)
+	MaxHeaderBytes int
+	// KeepAlivesEnabled allows HTTP/1.1 connection reuse
+	KeepAlivesEnabled bool
+	// HTTP2MaxConcurrentStreams caps streams per HTTP/2 connection (0 uses the Go default)
+	HTTP2MaxConcurrentStreams int
+	// H2C serves HTTP/2 over cleartext for proxies that speak it to the backend
+	H2C bool
+	// RunMode is server, or consumer to also enrich IPs from a message queue
+	RunMode string
+	// IPParseMode decides whether client addresses that parse but aren't written
+	// canonically are rejected, normalized or leniently read
+	IPParseMode string
+	// TrustedProxies are peer ranges whose X-Forwarded-Proto and X-Forwarded-Host
+	// are used for generated links (empty trusts no proxy)
+	TrustedProxies []string
+	// BasePath mounts the API under a path prefix, e.g. /geo, for gateways that
+	// forward requests without rewriting them (empty serves from the root)
+	BasePath string
+	// DisabledMiddleware lists middleware stages left out of both listeners' chains;
+	// middleware that routes or admits requests always runs
+	DisabledMiddleware []string
+	// Listeners is the number of public sockets, each with its own accept loop (0 opens
+	// one); more than one share the port with SO_REUSEPORT
+	Listeners int
+	// Region names where this instance is deployed, e.g. eu-west-1, reported in the
+	// lookup metadata envelope (empty leaves it out)
+	Region string
+	// LocalizeErrors translates public error messages into the language clients ask
+	// for with Accept-Language
+	LocalizeErrors bool
 }
 
+// Run modes
+const (
+	RunModeServer   = "server"
+	RunModeConsumer = "consumer"
+)
+
+// maxListeners bounds the public sockets opened with SO_REUSEPORT
+const maxListeners = 256
+
+// Middleware stages that can be disabled; panic recovery always runs
+const (
+	MiddlewareStageLogging   = "logging"
+	MiddlewareStageAuth      = "auth"
+	MiddlewareStageRateLimit = "ratelimit"
+	MiddlewareStageCORS      = "cors"
+	MiddlewareStageSecurity  = "security"
+	MiddlewareStageCustom    = "custom"
+)
+
+// IP parse modes
+const (
+	IPParseModeStrict    = "strict"
+	IPParseModeNormalize = "normalize"
+	IPParseModeLenient   = "lenient"
+)
+
 // DatabaseConfig holds database-related configuration
 type DatabaseConfig struct {
-	Type     string
-	FilePath string
-	Host     string
-	Port     int
-	Username string
-	Password string
+	Type       string
+	FilePath   string
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	Name       string        // Database holding the dataset table (postgres, mysql)
+	Table      string        // Dataset table (postgres, mysql)
+	MaxRecords int           // Most addresses a dataset may hold (0 uses the repository default)
+	Checksum   string        // Expected hex SHA-256 of the data file ("" skips the check)
+	PublicKey  string        // Ed25519 key (hex or base64) that signed the data file ("" skips the check)
+	Duplicates string        // Which row keeps an address listed with different locations (DuplicatePolicy*)
+	CacheDir   string        // Where datasets downloaded from object storage are kept
+	Embedded   bool          // Serve the demo dataset compiled into the binary instead of FilePath
+	LoadRetry  bool          // Serve while retrying datasets that fail to load at startup
+	RetryMax   time.Duration // Longest wait between load retries
+	Pool       PoolConfig    // Connection pool of SQL and Redis backends
+	Tier       TierConfig    // Local store fronting a network backend
+	// Freshness: data last modified more than MaxAge ago is stale (0 disables)
+	MaxAge      time.Duration
+	StalePolicy string // What happens to lookups in a stale dataset (StalePolicy*)
 }
 
+// PoolConfig tunes the connection pool of network backends (postgres, mysql, redis).
+// Zero leaves a setting to the backend's driver.
+type PoolConfig struct {
+	Size        int           // Most open connections
+	MaxIdle     int           // Most idle connections kept for reuse
+	IdleTimeout time.Duration // How long a connection may sit idle before it's closed
+	MaxLifetime time.Duration // How long a connection may be reused before it's replaced
+}
+
+// TierConfig puts a local CSV store in front of a network backend (postgres, mysql,
+// redis). Lookups are answered locally within the consistency window and read
+// through to the backend otherwise.
+type TierConfig struct {
+	LocalFile  string        // CSV file of the local store ("" disables tiering)
+	Window     time.Duration // How long a local answer is trusted (0 trusts it until replaced)
+	QueueSize  int           // Most pending local writes (0 uses the repository default)
+	MaxTracked int           // Most local answers whose sync time is kept (0 uses the repository default)
+}
+
+// poolSettings are the variables tuning the connection pool of network backends
+var poolSettings = []string{"DATABASE_POOL_SIZE", "DATABASE_POOL_MAX_IDLE", "DATABASE_POOL_IDLE_TIMEOUT", "DATABASE_POOL_MAX_LIFETIME"}
+
+// Pooled reports whether the database type holds a connection pool that Pool tunes
+func (d DatabaseConfig) Pooled() bool {
+	switch d.Type {
+	case DatabaseTypePostgres, DatabaseTypeMySQL, DatabaseTypeRedis:
+		return true
+	default:
+		return false
+	}
+}
+
+// Duplicate address policies
+const (
+	DuplicatePolicyFirst        = "first"
+	DuplicatePolicyLast         = "last"
+	DuplicatePolicyMostSpecific = "most_specific"
+	DuplicatePolicyError        = "error"
+)
+
+// Stale dataset policies
+const (
+	StalePolicyWarn   = "warn"   // Keep serving; report degraded health, log and export metrics
+	StalePolicyReject = "reject" // As warn, and fail lookups in the stale dataset with 503
+)
+
+// Rate limiting algorithms
+const (
+	RateLimitAlgorithmTokenBucket   = "token_bucket"
+	RateLimitAlgorithmSlidingWindow = "sliding_window"
+	RateLimitAlgorithmLeakyBucket   = "leaky_bucket"
+)
+
 // RateLimitConfig holds rate limiting configuration
 type RateLimitConfig struct {
 	RequestsPerSecond int
 	BurstSize         int
+	Algorithm         string        // token_bucket, sliding_window or leaky_bucket
+	WindowSize        time.Duration // Window length for the sliding_window algorithm
+	// Global (service-wide) limits, 0 disables
+	GlobalRequestsPerSecond int
+	GlobalBurstSize         int
+	GlobalMaxConcurrent     int
 	// Cleanup configuration
 	CleanupInterval   time.Duration // How often to run cleanup (default: 1 minute)
 	InactiveThreshold time.Duration // How long before client is considered inactive (default: 5 minutes)
+	// Debug output
+	DebugClientIDMode string // How /debug/rate-limiter renders client IDs: raw, hash or truncate
+	// Exemptions, matched before any token is consumed
+	ExemptPaths []string // Path prefixes that bypass rate limiting
+	ExemptCIDRs []string // Peer address ranges that bypass rate limiting
+}
+
+// LoadShedConfig holds concurrency limiting and load shedding configuration
+type LoadShedConfig struct {
+	MaxInFlight  int           // Concurrent requests processed (0 disables load shedding)
+	QueueDepth   int           // Requests allowed to wait for a slot before shedding
+	QueueTimeout time.Duration // How long a queued request waits before being shed
+}
+
+// CacheConfig holds service-level lookup cache configuration
+type CacheConfig struct {
+	Size int           // Maximum cached entries (0 disables the cache)
+	TTL  time.Duration // Entry lifetime (0 means entries never expire)
+	// HardTTL is how long an entry may be served stale, while it is refreshed in the
+	// background, before it is dropped (0 disables stale serving)
+	HardTTL time.Duration
+}
+
+// BatchConfig bounds the batch lookup endpoint; zero values use the handler defaults
+type BatchConfig struct {
+	MaxIPs       int // Addresses accepted in a JSON batch request
+	MaxStreamIPs int // Addresses accepted in an NDJSON batch request
+	Concurrency  int // Lookups in flight per batch request
+}
+
+// ConsumerConfig holds the message queue used when RunMode is consumer
+type ConsumerConfig struct {
+	URL           string // NATS server (nats://host:4222, or tls:// for TLS)
+	InputSubject  string // Subject IPs are read from
+	OutputSubject string // Subject enriched results are published to
+	QueueGroup    string // Queue group shared by consumer replicas ("" receives every message)
+	Concurrency   int    // Messages enriched at once
+}
+
+// PrefetchConfig holds sequential-scan prefetch configuration
+type PrefetchConfig struct {
+	Enabled bool
+	Trigger int // Consecutive sequential lookups before prefetching starts
+	Window  int // Number of neighboring addresses to warm per prefetch
+}
+
+// HealthConfig holds the health check history served at /health/history
+type HealthConfig struct {
+	HistorySize int // Most recent health checks kept (0 keeps none)
+}
+
+// WatchdogConfig holds the synthetic lookups the service sends through itself
+type WatchdogConfig struct {
+	Enabled   bool
+	Interval  time.Duration // Time between synthetic lookups
+	Timeout   time.Duration // Longest a lookup may take before it counts as failed
+	Threshold time.Duration // Latency over which a lookup counts as slow
+	Failures  int           // Consecutive bad lookups that mark the instance degraded, and good ones that clear it
+	IP        string        // Address looked up
+	APIKey    string        // Sent as X-API-Key when AUTH_REQUIRED is set
+}
+
+// ShardConfig places this instance in a sharded deployment, where each instance
+// holds a partition of the dataset, so clients can be told which one holds an address
+type ShardConfig struct {
+	Nodes        map[string]string // Instance name -> base URL (empty disables sharding hints)
+	Self         string            // Name of this instance among Nodes
+	VirtualNodes int               // Points per instance on the hash ring
+}
+
+// MaxHealthHistorySize bounds the health check history
+const MaxHealthHistorySize = 10_000
+
+// WarmUpConfig holds the lookups run after startup before the instance reports ready
+type WarmUpConfig struct {
+	Lookups int           // Lookups of sampled addresses per dataset (0 disables warm-up)
+	Timeout time.Duration // Longest the warm-up may hold back readiness
+}
+
+// TimeoutConfig holds request, service and repository timeouts
+type TimeoutConfig struct {
+	Request    time.Duration            // Default per-request deadline enforced by middleware (0 disables)
+	Routes     map[string]time.Duration // Per-route overrides keyed by path prefix
+	Header     bool                     // Honour client X-Request-Timeout / Grpc-Timeout headers
+	Service    time.Duration            // Deadline for a whole service lookup
+	Repository time.Duration            // Deadline for a single repository call (0 inherits the service deadline)
+	Health     time.Duration            // Deadline for health checks
+}
+
+// LatencyBudgetConfig holds per-route p99 latency budgets watched for sustained violations
+type LatencyBudgetConfig struct {
+	Routes      map[string]time.Duration // Path prefix -> p99 budget; longest prefix wins (empty disables)
+	Window      time.Duration            // Length of each evaluation window
+	Windows     int                      // Consecutive violating windows before a WARN event
+	MinRequests int                      // Requests a window needs before its p99 counts
+}
+
+// AdminConfig holds operator endpoint and maintenance mode configuration
+type AdminConfig struct {
+	Token              string        // Bearer token for /admin endpoints
+	Insecure           bool          // Serve /admin with no admin credential configured instead of disabling it
+	MaintenanceMode    bool          // Start with public endpoints returning 503
+	MaintenanceMessage string        // Message returned to clients while in maintenance
+	ReadOnly           bool          // Reject every admin mutation, whatever the credentials
+	AuditLogFile       string        // JSON lines file for the admin audit log ("" keeps it in memory)
+	IdempotencyFile    string        // JSON file persisting Idempotency-Key outcomes ("" keeps them in memory)
+	IdempotencyTTL     time.Duration // How long a stored outcome is replayed to retries (0 uses 24h)
+	// Port serves /admin, /metrics, /debug and /version on a separate listener and
+	// removes them from the public one ("" keeps them on the public port)
+	Port string
+}
+
+// DatasetsConfig holds multi-dataset configuration. The primary dataset is loaded
+// from Database and registered under Default; Sources adds further named datasets.
+type DatasetsConfig struct {
+	Default       string            // Name of the primary dataset
+	Sources       map[string]string // Additional dataset name -> file path
+	HeaderEnabled bool              // Allow clients to pick a dataset with the X-Dataset header
+	OverridesFile string            // CSV file persisting manual location overrides ("" keeps them in memory)
+	Regions       map[string]string // Dataset name -> regional variant it holds, reported in the lookup metadata envelope
 }
 
+// AuthConfig holds API key configuration
+type AuthConfig struct {
+	APIKeys  map[string]string // API key -> dataset it is pinned to (empty uses the default)
+	KeyRoles map[string]string // API key -> "|"-separated roles (keys without an entry are readers)
+	Required bool              // Reject requests without an API key or token on /v1, /metrics and /debug
+	JWT      JWTConfig
+	HMAC     HMACConfig
+}
+
+// HMACConfig holds request signing settings for server-to-server clients
+type HMACConfig struct {
+	Keys     map[string]string // Signing key ID -> shared secret
+	KeyRoles map[string]string // Signing key ID -> "|"-separated roles (keys without an entry are readers)
+	MaxSkew  time.Duration     // Allowed clock difference for signature timestamps
+}
+
+// minHMACSecretLength is the shortest accepted signing secret
+const minHMACSecretLength = 32
+
+// JWTConfig holds bearer token validation settings for deployments behind an identity provider
+type JWTConfig struct {
+	JWKSURL       string            // Signing keys endpoint; empty disables JWT authentication
+	Issuer        string            // Required "iss" claim
+	Audience      string            // Required "aud" claim entry
+	RolesClaim    string            // Claim holding roles (dots address nested claims)
+	RoleMapping   map[string]string // Claim value -> "|"-separated roles
+	IdentityClaim string            // Claim used as the rate-limit identity
+	JWKSRefresh   time.Duration     // How long fetched keys are cached
+}
+
+// apiKeyRoles are the roles accepted in API_KEY_ROLES
+var apiKeyRoles = []string{"reader", "metrics", "admin"}
+
 // LoggingConfig holds logging configuration
 type LoggingConfig struct {
-	Level  string
-	Format string
+	Level      string
+	Format     string
+	SampleRate int // Log one in N successful requests (errors are always logged)
+}
+
+// PrivacyConfig holds IP retention settings
+type PrivacyConfig struct {
+	AnonymizeIPs bool // Truncate client and queried IPs in logs, debug output and the audit log
+	DoNotStore   bool // Never retain queried IPs: logs redact them and caches use hashed keys
+}
+
+// ThreatIntelConfig holds anonymizer (Tor, VPN, proxy) detection settings
+type ThreatIntelConfig struct {
+	Enabled            bool          // Flag lookups with is_anonymizer
+	TorExitListURL     string        // Tor exit list to download ("" disables the Tor provider)
+	TorRefresh         time.Duration // How often the Tor exit list is downloaded
+	AnonymizerListFile string        // Optional file of VPN/proxy IPs and CIDRs
+}
+
+// HostLookupConfig holds hostname resolution settings for /v1/find-host
+type HostLookupConfig struct {
+	Enabled      bool          // Serve /v1/find-host
+	Resolver     string        // DNS server as host:port or a DNS-over-HTTPS URL ("" uses the system resolver)
+	Family       string        // Records resolved: any (A and AAAA), ipv4 or ipv6
+	Timeout      time.Duration // Limit for one resolution
+	MaxAddresses int           // Addresses geolocated per hostname
+}
+
+// AccessPolicyConfig holds the country access policy for /v1/check-access
+type AccessPolicyConfig struct {
+	Mode        string   // deny blocks the listed countries, allow serves only them ("" disables the policy)
+	Countries   []string // Country names or ISO codes
+	DenyUnknown bool     // Deny addresses whose country can't be determined
+}
+
+// Access policy modes
+const (
+	AccessModeDeny  = "deny"
+	AccessModeAllow = "allow"
+)
+
+// Host lookup address families
+const (
+	HostFamilyAny  = "any"
+	HostFamilyIPv4 = "ipv4"
+	HostFamilyIPv6 = "ipv6"
+)
+
+// ShadowConfig holds shadow traffic configuration
+type ShadowConfig struct {
+	URL         string        // Secondary backend receiving mirrored requests ("" disables shadowing)
+	Percent     int           // Share of GET /v1 requests mirrored (0-100)
+	Timeout     time.Duration // How long to wait for a shadow response
+	MaxInFlight int           // Concurrent shadow requests; further samples are dropped
+}
+
+// ExperimentsConfig holds the canary experiments requests opt into with X-Experiment
+type ExperimentsConfig struct {
+	// Definitions are settings by experiment name, such as "dataset:geo-parquet|cache:bypass"
+	// (empty ignores the header)
+	Definitions map[string]string
+}
+
+// ChaosConfig holds fault injection settings for resilience testing; never enable it in production
+type ChaosConfig struct {
+	Enabled        bool          // Inject faults into matching requests
+	LatencyPercent int           // Share of matching requests delayed (0-100)
+	Latency        time.Duration // Delay added to those requests
+	Jitter         time.Duration // Random extra delay, up to this much
+	ErrorPercent   int           // Share of matching requests failed (0-100)
+	ErrorStatus    int           // Status code of failed requests
+	Paths          []string      // Path prefixes eligible for injection (empty means /v1/)
+}
+
+// ResponseSigningConfig holds detached JWS signing of lookup responses
+type ResponseSigningConfig struct {
+	Key   string // Ed25519 private key or seed, hex or base64 ("" leaves responses unsigned)
+	KeyID string // "kid" set in signatures ("" uses the key's RFC 7638 thumbprint)
+}
+
+// ErrorReportingConfig holds forwarding of panics and server errors to an external error tracker
+type ErrorReportingConfig struct {
+	SentryDSN   string        // Sentry-compatible DSN ("" disables reporting)
+	Environment string        // Environment tag attached to reports
+	Timeout     time.Duration // How long to wait when sending a report
+}
+
+// QuotaConfig holds long-horizon usage quotas for authenticated clients
+type QuotaConfig struct {
+	Daily         int           // Requests per client per UTC day (0 is unlimited)
+	Monthly       int           // Requests per client per UTC month (0 is unlimited)
+	File          string        // File persisting usage across restarts ("" keeps it in memory)
+	FlushInterval time.Duration // How often usage is written to File
+}
+
+// UsageExportConfig holds the periodic per-client usage export used for billing
+type UsageExportConfig struct {
+	Interval time.Duration // How often usage is exported
+	Dir      string        // Directory receiving one report file per interval ("" disables)
+	Format   string        // File format: csv or json
+	URL      string        // Endpoint receiving each report as a JSON POST ("" disables)
+}
+
+// ReportConfig holds scheduled traffic summary reports
+type ReportConfig struct {
+	Schedule   string // Cron expression in UTC, e.g. "0 * * * *" or "@daily" ("" disables)
+	Dir        string // Directory receiving one JSON file per report ("" disables)
+	WebhookURL string // Endpoint receiving each report as a JSON POST ("" disables)
+	TopN       int    // Countries and clients listed per report
+}
+
+// CoverageConfig holds dataset miss tracking
+type CoverageConfig struct {
+	MissPrefixes int // Network prefixes tracked by /admin/misses (0 disables)
+}
+
+// Secrets providers
+const (
+	SecretsProviderVault = "vault"
+)
+
+// SecretsConfig holds the external secret manager that credentials are resolved from.
+// Settings holding credentials also accept a KEY_FILE variant naming a file that
+// holds the value, and "secret:name#field" references resolved through the provider.
+type SecretsConfig struct {
+	Provider        string        // External secret manager: "" (none) or vault
+	VaultAddr       string        // Vault server address
+	VaultToken      string        // Vault token, usually from VAULT_TOKEN_FILE
+	VaultNamespace  string        // Vault Enterprise namespace
+	VaultMount      string        // Vault KV version 2 mount path
+	CacheTTL        time.Duration // How long fetched secrets are reused
+	RefreshInterval time.Duration // How often resolved secrets are checked for rotation (0 disables)
+	// Store resolves references while running; nil without a provider
+	Store *secrets.Cache
+}
+
+// EgressConfig holds the forward proxies outbound requests go through. Without
+// EGRESS_PROXY the standard HTTPS_PROXY, HTTP_PROXY and NO_PROXY variables apply.
+type EgressConfig struct {
+	Proxy   string   // http(s):// or socks5(h):// proxy for every destination ("" uses the environment)
+	NoProxy []string // Destinations reached directly despite Proxy (defaults to NO_PROXY)
+	// Overrides maps destination patterns to a proxy URL or "direct", taking
+	// precedence over Proxy and the environment
+	Overrides map[string]string
+	// Proxies picks the proxy of each request
+	Proxies *egress.Proxies
+}
+
+// RuntimeConfig holds how the Go runtime is fitted to the container's limits.
+// GOMAXPROCS and GOMEMLIMIT, when set, always win.
+type RuntimeConfig struct {
+	AutoMaxProcs    bool // Set GOMAXPROCS from the cgroup CPU quota
+	AutoMemoryLimit bool // Set GOMEMLIMIT from the cgroup memory limit
+	// MemoryLimitPercent is the share of the memory limit GOMEMLIMIT is set to (0 uses 90)
+	MemoryLimitPercent int
+}
+
+// FlagsConfig holds feature flag sources
+type FlagsConfig struct {
+	Values         map[string]string // Flag values by name, true or false
+	File           string            // JSON file of flag values reloaded while running (empty disables)
+	ReloadInterval time.Duration     // How often the file is checked for changes
 }
 
 // LoadConfig loads configuration from environment variables
 func LoadConfig() (*Config, error) {
+	return LoadConfigWithProvider(nil)
+}
+
+// LoadConfigWithProvider loads configuration like LoadConfig, resolving secret
+// references through provider instead of the one SECRETS_PROVIDER selects
+func LoadConfigWithProvider(provider secrets.Provider) (*Config, error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	parseProblems = validator{}
+
+	egressConfig, err := loadEgressConfig()
+	if err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+	secretsConfig, err := loadSecretsConfig(provider, egressConfig.Proxies)
+	if err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+	env := &secretEnv{store: secretsConfig.Store}
+
 	config := &Config{
 		Server: ServerConfig{
-			Port:         getEnv("PORT", "8080"),
-			ReadTimeout:  getDurationEnv("READ_TIMEOUT", 30*time.Second),
-			WriteTimeout: getDurationEnv("WRITE_TIMEOUT", 30*time.Second),
-			IdleTimeout:  getDurationEnv("IDLE_TIMEOUT", 120*time.Second),
+			Port:                      getEnv("PORT", "8080"),
+			ReadTimeout:               getDurationEnv("READ_TIMEOUT", 30*time.Second),
+			WriteTimeout:              getDurationEnv("WRITE_TIMEOUT", 30*time.Second),
+			IdleTimeout:               getDurationEnv("IDLE_TIMEOUT", 120*time.Second),
+			SocketHandoff:             getBoolEnv("SOCKET_HANDOFF_ENABLED", false),
+			MaxHeaderBytes:            getIntEnv("MAX_HEADER_BYTES", 1<<20),
+			KeepAlivesEnabled:         getBoolEnv("KEEP_ALIVES_ENABLED", true),
+			HTTP2MaxConcurrentStreams: getIntEnv("HTTP2_MAX_CONCURRENT_STREAMS", 250),
+			H2C:                       getBoolEnv("H2C_ENABLED", false),
+			RunMode:                   getEnv("RUN_MODE", RunModeServer),
+			IPParseMode:               getEnv("IP_PARSE_MODE", IPParseModeNormalize),
+			TrustedProxies:            getStringSliceEnv("TRUSTED_PROXIES"),
+			BasePath:                  strings.TrimSuffix(getEnv("BASE_PATH", ""), "/"),
+			DisabledMiddleware:        getStringSliceEnv("MIDDLEWARE_DISABLED"),
+			Listeners:                 getIntEnv("LISTENERS", 1),
+			Region:                    getEnv("SERVICE_REGION", ""),
+			LocalizeErrors:            getBoolEnv("LOCALIZE_ERRORS", true),
 		},
 		Database: DatabaseConfig{
-			Type:     getEnv("DATABASE_TYPE", DatabaseTypeCSV),
-			FilePath: getEnv("DATABASE_FILE_PATH", "./data/ip_locations.csv"),
-			Host:     getEnv("DATABASE_HOST", "localhost"),
-			Port:     getIntEnv("DATABASE_PORT", 5432),
-			Username: getEnv("DATABASE_USERNAME", ""),
-			Password: getEnv("DATABASE_PASSWORD", ""),
+			Type:       getEnv("DATABASE_TYPE", DatabaseTypeCSV),
+			FilePath:   getEnv("DATABASE_FILE_PATH", "./data/ip_locations.csv"),
+			Host:       getEnv("DATABASE_HOST", "localhost"),
+			Port:       getIntEnv("DATABASE_PORT", 5432),
+			Username:   getEnv("DATABASE_USERNAME", ""),
+			Password:   env.get("DATABASE_PASSWORD"),
+			Name:       getEnv("DATABASE_NAME", "ipgeo"),
+			Table:      getEnv("DATABASE_TABLE", DefaultDatabaseTable),
+			MaxRecords: getIntEnv("DATABASE_MAX_RECORDS", 0),
+			Checksum:   getEnv("DATA_CHECKSUM", ""),
+			PublicKey:  getEnv("DATA_PUBKEY", ""),
+			Duplicates: getEnv("DATABASE_DUPLICATE_POLICY", DuplicatePolicyLast),
+			CacheDir:   getEnv("DATABASE_CACHE_DIR", filepath.Join(os.TempDir(), "ipgeo-datasets")),
+			Embedded:   getBoolEnv("EMBEDDED_DATA", false),
+			LoadRetry:  getBoolEnv("DATABASE_LOAD_RETRY", false),
+			RetryMax:   getDurationEnv("DATABASE_LOAD_RETRY_MAX_INTERVAL", 30*time.Second),
+			Pool: PoolConfig{
+				Size:        getIntEnv("DATABASE_POOL_SIZE", 10),
+				MaxIdle:     getIntEnv("DATABASE_POOL_MAX_IDLE", 5),
+				IdleTimeout: getDurationEnv("DATABASE_POOL_IDLE_TIMEOUT", 5*time.Minute),
+				MaxLifetime: getDurationEnv("DATABASE_POOL_MAX_LIFETIME", 30*time.Minute),
+			},
+			Tier: TierConfig{
+				LocalFile:  getEnv("DATABASE_TIER_FILE", ""),
+				Window:     getDurationEnv("DATABASE_TIER_WINDOW", time.Minute),
+				QueueSize:  getIntEnv("DATABASE_TIER_QUEUE_SIZE", 0),
+				MaxTracked: getIntEnv("DATABASE_TIER_MAX_TRACKED", 0),
+			},
+			MaxAge:      getDurationEnv("MAX_DATASET_AGE", 0),
+			StalePolicy: getEnv("DATASET_STALE_POLICY", StalePolicyWarn),
 		},
 		RateLimit: RateLimitConfig{
-			RequestsPerSecond: getIntEnv("RATE_LIMIT_RPS", 20),
-			BurstSize:         getIntEnv("RATE_LIMIT_BURST", 20),
-			CleanupInterval:   getDurationEnv("RATE_LIMIT_CLEANUP_INTERVAL", 1*time.Minute),
-			InactiveThreshold: getDurationEnv("RATE_LIMIT_INACTIVE_THRESHOLD", 5*time.Minute),
+			RequestsPerSecond:       getIntEnv("RATE_LIMIT_RPS", 20),
+			BurstSize:               getIntEnv("RATE_LIMIT_BURST", 20),
+			Algorithm:               getEnv("RATE_LIMIT_ALGORITHM", RateLimitAlgorithmTokenBucket),
+			WindowSize:              getDurationEnv("RATE_LIMIT_WINDOW", 1*time.Second),
+			GlobalRequestsPerSecond: getIntEnv("GLOBAL_RATE_LIMIT_RPS", 0),
+			GlobalBurstSize:         getIntEnv("GLOBAL_RATE_LIMIT_BURST", 0),
+			GlobalMaxConcurrent:     getIntEnv("GLOBAL_MAX_CONCURRENT", 0),
+			CleanupInterval:         getDurationEnv("RATE_LIMIT_CLEANUP_INTERVAL", 1*time.Minute),
+			InactiveThreshold:       getDurationEnv("RATE_LIMIT_INACTIVE_THRESHOLD", 5*time.Minute),
+			DebugClientIDMode:       getEnv("RATE_LIMIT_DEBUG_CLIENT_IDS", "hash"),
+			ExemptPaths:             getStringSliceEnv("RATE_LIMIT_EXEMPT_PATHS"),
+			ExemptCIDRs:             getStringSliceEnv("RATE_LIMIT_EXEMPT_CIDRS"),
+		},
+		LoadShed: LoadShedConfig{
+			MaxInFlight:  getIntEnv("LOAD_SHED_MAX_IN_FLIGHT", 0),
+			QueueDepth:   getIntEnv("LOAD_SHED_QUEUE_DEPTH", 0),
+			QueueTimeout: getDurationEnv("LOAD_SHED_QUEUE_TIMEOUT", 100*time.Millisecond),
 		},
 		Logging: LoggingConfig{
-			Level:  getEnv("LOG_LEVEL", LogLevelInfo),
-			Format: getEnv("LOG_FORMAT", LogFormatJSON),
+			Level:      getEnv("LOG_LEVEL", LogLevelInfo),
+			Format:     getEnv("LOG_FORMAT", LogFormatJSON),
+			SampleRate: getIntEnv("LOG_SAMPLE_RATE", 1),
+		},
+		Privacy: PrivacyConfig{
+			AnonymizeIPs: getBoolEnv("PRIVACY_MODE", false),
+			DoNotStore:   getBoolEnv("DO_NOT_STORE", false),
+		},
+		Threats: ThreatIntelConfig{
+			Enabled:            getBoolEnv("THREAT_INTEL_ENABLED", false),
+			TorExitListURL:     getEnv("TOR_EXIT_LIST_URL", "https://check.torproject.org/torbulkexitlist"),
+			TorRefresh:         getDurationEnv("TOR_EXIT_LIST_REFRESH", time.Hour),
+			AnonymizerListFile: getEnv("ANONYMIZER_LIST_FILE", ""),
+		},
+		Hosts: HostLookupConfig{
+			Enabled:      getBoolEnv("HOST_LOOKUP_ENABLED", false),
+			Resolver:     getEnv("HOST_LOOKUP_RESOLVER", ""),
+			Family:       getEnv("HOST_LOOKUP_FAMILY", HostFamilyAny),
+			Timeout:      getDurationEnv("HOST_LOOKUP_TIMEOUT", 2*time.Second),
+			MaxAddresses: getIntEnv("HOST_LOOKUP_MAX_ADDRESSES", 16),
+		},
+		Access: AccessPolicyConfig{
+			Mode:        getEnv("ACCESS_POLICY_MODE", ""),
+			Countries:   getStringSliceEnv("ACCESS_POLICY_COUNTRIES"),
+			DenyUnknown: getBoolEnv("ACCESS_POLICY_DENY_UNKNOWN", false),
+		},
+		Quota: QuotaConfig{
+			Daily:         getIntEnv("QUOTA_DAILY_LIMIT", 0),
+			Monthly:       getIntEnv("QUOTA_MONTHLY_LIMIT", 0),
+			File:          getEnv("QUOTA_FILE", ""),
+			FlushInterval: getDurationEnv("QUOTA_FLUSH_INTERVAL", 30*time.Second),
+		},
+		Usage: UsageExportConfig{
+			Interval: getDurationEnv("USAGE_EXPORT_INTERVAL", time.Hour),
+			Dir:      getEnv("USAGE_EXPORT_DIR", ""),
+			Format:   getEnv("USAGE_EXPORT_FORMAT", "csv"),
+			URL:      env.get("USAGE_EXPORT_URL"),
+		},
+		Shadow: ShadowConfig{
+			URL:         getEnv("SHADOW_URL", ""),
+			Percent:     getIntEnv("SHADOW_PERCENT", 10),
+			Timeout:     getDurationEnv("SHADOW_TIMEOUT", 2*time.Second),
+			MaxInFlight: getIntEnv("SHADOW_MAX_IN_FLIGHT", 50),
+		},
+		Experiments: ExperimentsConfig{
+			Definitions: getStringMapEnv("EXPERIMENTS"),
 		},
+		Runtime: RuntimeConfig{
+			AutoMaxProcs:       getBoolEnv("AUTO_GOMAXPROCS", true),
+			AutoMemoryLimit:    getBoolEnv("AUTO_GOMEMLIMIT", true),
+			MemoryLimitPercent: getIntEnv("GOMEMLIMIT_PERCENT", 90),
+		},
+		Chaos: ChaosConfig{
+			Enabled:        getBoolEnv("CHAOS_ENABLED", false),
+			LatencyPercent: getIntEnv("CHAOS_LATENCY_PERCENT", 0),
+			Latency:        getDurationEnv("CHAOS_LATENCY", 0),
+			Jitter:         getDurationEnv("CHAOS_LATENCY_JITTER", 0),
+			ErrorPercent:   getIntEnv("CHAOS_ERROR_PERCENT", 0),
+			ErrorStatus:    getIntEnv("CHAOS_ERROR_STATUS", 503),
+			Paths:          getStringSliceEnv("CHAOS_PATHS"),
+		},
+		Reports: ReportConfig{
+			Schedule:   getEnv("REPORT_SCHEDULE", ""),
+			Dir:        getEnv("REPORT_DIR", ""),
+			WebhookURL: env.get("REPORT_WEBHOOK_URL"),
+			TopN:       getIntEnv("REPORT_TOP_N", 10),
+		},
+		Coverage: CoverageConfig{
+			MissPrefixes: getIntEnv("MISS_TRACKER_PREFIXES", 1000),
+		},
+		Flags: FlagsConfig{
+			Values:         getStringMapEnv("FEATURE_FLAGS"),
+			File:           getEnv("FEATURE_FLAGS_FILE", ""),
+			ReloadInterval: getDurationEnv("FEATURE_FLAGS_RELOAD_INTERVAL", 10*time.Second),
+		},
+		Errors: ErrorReportingConfig{
+			SentryDSN:   env.get("SENTRY_DSN"),
+			Environment: getEnv("SENTRY_ENVIRONMENT", "production"),
+			Timeout:     getDurationEnv("SENTRY_TIMEOUT", 5*time.Second),
+		},
+		Cache: CacheConfig{
+			Size:    getIntEnv("CACHE_SIZE", 0),
+			TTL:     getDurationEnv("CACHE_TTL", 0),
+			HardTTL: getDurationEnv("CACHE_HARD_TTL", 0),
+		},
+		Prefetch: PrefetchConfig{
+			Enabled: getBoolEnv("PREFETCH_ENABLED", false),
+			Trigger: getIntEnv("PREFETCH_TRIGGER", 3),
+			Window:  getIntEnv("PREFETCH_WINDOW", 16),
+		},
+		WarmUp: WarmUpConfig{
+			Lookups: getIntEnv("WARMUP_LOOKUPS", 0),
+			Timeout: getDurationEnv("WARMUP_TIMEOUT", 30*time.Second),
+		},
+		Health: HealthConfig{
+			HistorySize: getIntEnv("HEALTH_HISTORY_SIZE", 100),
+		},
+		Watchdog: WatchdogConfig{
+			Enabled:   getBoolEnv("WATCHDOG_ENABLED", false),
+			Interval:  getDurationEnv("WATCHDOG_INTERVAL", 30*time.Second),
+			Timeout:   getDurationEnv("WATCHDOG_TIMEOUT", 5*time.Second),
+			Threshold: getDurationEnv("WATCHDOG_LATENCY_THRESHOLD", 250*time.Millisecond),
+			Failures:  getIntEnv("WATCHDOG_FAILURES", 3),
+			IP:        getEnv("WATCHDOG_IP", "8.8.8.8"),
+			APIKey:    env.get("WATCHDOG_API_KEY"),
+		},
+		Batch: BatchConfig{
+			MaxIPs:       getIntEnv("BATCH_MAX_IPS", 1000),
+			MaxStreamIPs: getIntEnv("BATCH_MAX_STREAM_IPS", 100_000),
+			Concurrency:  getIntEnv("BATCH_CONCURRENCY", 8),
+		},
+		Consumer: ConsumerConfig{
+			URL:           env.get("CONSUMER_URL"),
+			InputSubject:  getEnv("CONSUMER_INPUT_SUBJECT", "ipgeo.lookup"),
+			OutputSubject: getEnv("CONSUMER_OUTPUT_SUBJECT", "ipgeo.enriched"),
+			QueueGroup:    getEnv("CONSUMER_QUEUE_GROUP", "ipgeo"),
+			Concurrency:   getIntEnv("CONSUMER_CONCURRENCY", 8),
+		},
+		Timeouts: TimeoutConfig{
+			Request:    getDurationEnv("REQUEST_TIMEOUT", 10*time.Second),
+			Routes:     getDurationMapEnv("ROUTE_TIMEOUTS"),
+			Header:     getBoolEnv("REQUEST_TIMEOUT_HEADER_ENABLED", true),
+			Service:    getDurationEnv("SERVICE_TIMEOUT", 5*time.Second),
+			Repository: getDurationEnv("REPOSITORY_TIMEOUT", 0),
+			Health:     getDurationEnv("HEALTH_TIMEOUT", 2*time.Second),
+		},
+		Latency: LatencyBudgetConfig{
+			Routes:      getDurationMapEnv("LATENCY_BUDGETS"),
+			Window:      getDurationEnv("LATENCY_BUDGET_WINDOW", time.Minute),
+			Windows:     getIntEnv("LATENCY_BUDGET_WINDOWS", 3),
+			MinRequests: getIntEnv("LATENCY_BUDGET_MIN_REQUESTS", 50),
+		},
+		Admin: AdminConfig{
+			Token:              env.get("ADMIN_TOKEN"),
+			Insecure:           getBoolEnv("ADMIN_INSECURE", false),
+			MaintenanceMode:    getBoolEnv("MAINTENANCE_MODE", false),
+			MaintenanceMessage: getEnv("MAINTENANCE_MESSAGE", "Service is under maintenance. Please try again later."),
+			ReadOnly:           getBoolEnv("READ_ONLY", false),
+			AuditLogFile:       getEnv("AUDIT_LOG_FILE", ""),
+			IdempotencyFile:    getEnv("IDEMPOTENCY_FILE", ""),
+			IdempotencyTTL:     getDurationEnv("IDEMPOTENCY_TTL", 24*time.Hour),
+			Port:               getEnv("ADMIN_PORT", ""),
+		},
+		Datasets: DatasetsConfig{
+			Default:       getEnv("DEFAULT_DATASET", "default"),
+			Sources:       getStringMapEnv("DATASETS"),
+			HeaderEnabled: getBoolEnv("DATASET_HEADER_ENABLED", true),
+			OverridesFile: getEnv("OVERRIDES_FILE", ""),
+			Regions:       getStringMapEnv("DATASET_REGIONS"),
+		},
+		Shard: ShardConfig{
+			Nodes:        getStringMapEnv("SHARD_NODES"),
+			Self:         getEnv("SHARD_SELF", ""),
+			VirtualNodes: getIntEnv("SHARD_VIRTUAL_NODES", shard.DefaultVirtualNodes),
+		},
+		Auth: AuthConfig{
+			APIKeys:  parseStringMap(env.get("API_KEYS")),
+			KeyRoles: parseStringMap(env.get("API_KEY_ROLES")),
+			Required: getBoolEnv("AUTH_REQUIRED", false),
+			JWT: JWTConfig{
+				JWKSURL:       getEnv("JWT_JWKS_URL", ""),
+				Issuer:        getEnv("JWT_ISSUER", ""),
+				Audience:      getEnv("JWT_AUDIENCE", ""),
+				RolesClaim:    getEnv("JWT_ROLES_CLAIM", "roles"),
+				RoleMapping:   getStringMapEnv("JWT_ROLE_MAPPING"),
+				IdentityClaim: getEnv("JWT_IDENTITY_CLAIM", "sub"),
+				JWKSRefresh:   getDurationEnv("JWT_JWKS_REFRESH", time.Hour),
+			},
+			HMAC: HMACConfig{
+				Keys:     parseStringMap(env.get("HMAC_KEYS")),
+				KeyRoles: getStringMapEnv("HMAC_KEY_ROLES"),
+				MaxSkew:  getDurationEnv("HMAC_MAX_SKEW", 5*time.Minute),
+			},
+		},
+		Signing: ResponseSigningConfig{
+			Key:   env.get("RESPONSE_SIGNING_KEY"),
+			KeyID: getEnv("RESPONSE_SIGNING_KEY_ID", ""),
+		},
+	}
+
+	config.Secrets = secretsConfig
+	config.Egress = egressConfig
+	// File backends hold no connection pool, so pool settings would silently do nothing
+	if !config.Database.Pooled() {
+		for _, key := range poolSettings {
+			if value := os.Getenv(key); value != "" {
+				parseProblems.add(key, value, "DATABASE_TYPE=%s has no connection pool", config.Database.Type)
+			}
+		}
+	}
+	config.envProblems = parseProblems.problems
+	if err := env.err(); err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
 	}
 
 	if err := config.Validate(); err != nil {
@@ -109,51 +871,646 @@ func LoadConfig() (*Config, error) {
 	return config, nil
 }
 
-// Validate validates the configuration
+// Validate checks the whole configuration and returns a *ValidationError listing
+// every invalid setting, not just the first
 func (c *Config) Validate() error {
+	v := &validator{problems: slices.Clone(c.envProblems)}
+
 	// Validate server config
 	if c.Server.Port == "" {
-		return fmt.Errorf("server port cannot be empty")
+		v.add("Server.Port", c.Server.Port, "server port cannot be empty")
+	}
+
+	if c.Admin.Port != "" && c.Admin.Port == c.Server.Port {
+		v.add("Admin.Port", c.Admin.Port, "admin port must differ from the server port")
+	}
+
+	if c.Admin.ReadOnly && c.Admin.MaintenanceMode {
+		v.add("Admin.MaintenanceMode", c.Admin.MaintenanceMode, "maintenance mode could never be turned off on a read-only instance")
+	}
+	if c.Admin.IdempotencyTTL < 0 {
+		v.add("Admin.IdempotencyTTL", c.Admin.IdempotencyTTL, "idempotency TTL cannot be negative")
+	}
+
+	if c.Server.MaxHeaderBytes < 0 {
+		v.add("Server.MaxHeaderBytes", c.Server.MaxHeaderBytes, "max header bytes cannot be negative")
+	}
+
+	if c.Server.HTTP2MaxConcurrentStreams < 0 {
+		v.add("Server.HTTP2MaxConcurrentStreams", c.Server.HTTP2MaxConcurrentStreams, "HTTP/2 max concurrent streams cannot be negative")
+	}
+
+	if c.Server.Listeners < 0 || c.Server.Listeners > maxListeners {
+		v.add("Server.Listeners", c.Server.Listeners, "listeners must be between 0 and %d", maxListeners)
+	}
+
+	for i, cidr := range c.Server.TrustedProxies {
+		if !validRange(cidr) {
+			v.add(fmt.Sprintf("Server.TrustedProxies[%d]", i), cidr, "invalid trusted proxy range")
+		}
+	}
+
+	if bp := c.Server.BasePath; bp != "" && (!strings.HasPrefix(bp, "/") || path.Clean(bp) != bp || strings.ContainsAny(bp, "?#% ")) {
+		v.add("Server.BasePath", bp, "invalid base path, must be a clean path starting with /")
+	}
+
+	validStages := []string{MiddlewareStageLogging, MiddlewareStageAuth, MiddlewareStageRateLimit,
+		MiddlewareStageCORS, MiddlewareStageSecurity, MiddlewareStageCustom}
+	for i, stage := range c.Server.DisabledMiddleware {
+		if !contains(validStages, stage) {
+			v.add(fmt.Sprintf("Server.DisabledMiddleware[%d]", i), stage, "invalid middleware stage, must be one of: %s", strings.Join(validStages, ", "))
+		}
+	}
+
+	validParseModes := []string{IPParseModeStrict, IPParseModeNormalize, IPParseModeLenient}
+	if c.Server.IPParseMode != "" && !contains(validParseModes, c.Server.IPParseMode) {
+		v.add("Server.IPParseMode", c.Server.IPParseMode, "invalid IP parse mode, must be one of: %s", strings.Join(validParseModes, ", "))
 	}
 
 	// Validate database config
-	validDBTypes := []string{DatabaseTypeCSV, DatabaseTypePostgres, DatabaseTypeMySQL, DatabaseTypeRedis}
+	validDBTypes := []string{DatabaseTypeCSV, DatabaseTypeParquet, DatabaseTypePostgres, DatabaseTypeMySQL, DatabaseTypeRedis}
 	if !contains(validDBTypes, c.Database.Type) {
-		return fmt.Errorf("invalid database type: %s, must be one of: %s",
-			c.Database.Type, strings.Join(validDBTypes, ", "))
+		v.add("Database.Type", c.Database.Type, "invalid database type, must be one of: %s", strings.Join(validDBTypes, ", "))
 	}
 
 	if c.Database.Type == "csv" && c.Database.FilePath == "" {
-		return fmt.Errorf("database file path is required when using CSV database")
+		v.add("Database.FilePath", c.Database.FilePath, "database file path is required when using CSV database")
+	}
+	if c.Database.Type == DatabaseTypeParquet && c.Database.FilePath == "" {
+		v.add("Database.FilePath", c.Database.FilePath, "database file path is required when using Parquet database")
+	}
+	if c.Database.Type == DatabaseTypePostgres || c.Database.Type == DatabaseTypeMySQL {
+		if !isSQLIdentifier(c.Database.Table) {
+			v.add("Database.Table", c.Database.Table, "database table must be a plain identifier of letters, digits and underscores")
+		}
+		// The service links no SQL driver; programs embedding it through pkg/ipgeo
+		// import one, which registers under the database type's name
+		if !slices.Contains(sql.Drivers(), c.Database.Type) {
+			v.add("Database.Type", c.Database.Type, "DATABASE_TYPE=%s needs a database/sql driver registered as %q, which this binary doesn't include", c.Database.Type, c.Database.Type)
+		}
+	}
+	if c.Database.Embedded && c.Database.Type != DatabaseTypeCSV {
+		v.add("Database.Type", c.Database.Type, "EMBEDDED_DATA requires DATABASE_TYPE=csv")
+	}
+	if c.Database.MaxRecords < 0 {
+		v.add("Database.MaxRecords", c.Database.MaxRecords, "database max records cannot be negative")
+	}
+	validDuplicatePolicies := []string{DuplicatePolicyFirst, DuplicatePolicyLast, DuplicatePolicyMostSpecific, DuplicatePolicyError}
+	if c.Database.Duplicates != "" && !contains(validDuplicatePolicies, c.Database.Duplicates) {
+		v.add("Database.Duplicates", c.Database.Duplicates, "invalid duplicate policy, must be one of: %s", strings.Join(validDuplicatePolicies, ", "))
+	}
+	if sum := c.Database.Checksum; sum != "" {
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != 64 {
+			v.add("Database.Checksum", sum, "DATA_CHECKSUM must be a hex SHA-256 digest")
+		}
+	}
+	if c.Database.LoadRetry && c.Database.RetryMax <= 0 {
+		v.add("Database.RetryMax", c.Database.RetryMax, "database load retry max interval must be positive")
+	}
+	pool := c.Database.Pool
+	if pool.Size < 0 {
+		v.add("Database.Pool.Size", pool.Size, "database pool size cannot be negative")
+	}
+	if pool.MaxIdle < 0 {
+		v.add("Database.Pool.MaxIdle", pool.MaxIdle, "database pool max idle connections cannot be negative")
+	} else if pool.Size > 0 && pool.MaxIdle > pool.Size {
+		v.add("Database.Pool.MaxIdle", pool.MaxIdle, "database pool max idle connections cannot exceed the pool size (%d)", pool.Size)
+	}
+	if pool.IdleTimeout < 0 {
+		v.add("Database.Pool.IdleTimeout", pool.IdleTimeout, "database pool idle timeout cannot be negative")
+	}
+	if pool.MaxLifetime < 0 {
+		v.add("Database.Pool.MaxLifetime", pool.MaxLifetime, "database pool max lifetime cannot be negative")
+	}
+	tier := c.Database.Tier
+	if tier.LocalFile != "" && !c.Database.Pooled() {
+		v.add("Database.Tier.LocalFile", tier.LocalFile, "DATABASE_TIER_FILE fronts a network backend, DATABASE_TYPE=%s is already local", c.Database.Type)
+	}
+	if tier.LocalFile != "" && c.Privacy.DoNotStore {
+		v.add("Database.Tier.LocalFile", tier.LocalFile, "DATABASE_TIER_FILE cannot be set with DO_NOT_STORE (it writes looked-up IPs to disk)")
+	}
+	if tier.Window < 0 {
+		v.add("Database.Tier.Window", tier.Window, "tier consistency window cannot be negative")
+	}
+	if tier.QueueSize < 0 {
+		v.add("Database.Tier.QueueSize", tier.QueueSize, "tier queue size cannot be negative")
+	}
+	if tier.MaxTracked < 0 {
+		v.add("Database.Tier.MaxTracked", tier.MaxTracked, "tier max tracked answers cannot be negative")
+	}
+	if c.Database.MaxAge < 0 {
+		v.add("Database.MaxAge", c.Database.MaxAge, "max dataset age cannot be negative")
+	}
+	validStalePolicies := []string{StalePolicyWarn, StalePolicyReject}
+	if c.Database.MaxAge > 0 && !contains(validStalePolicies, c.Database.StalePolicy) {
+		v.add("Database.StalePolicy", c.Database.StalePolicy, "invalid stale dataset policy, must be one of: %s", strings.Join(validStalePolicies, ", "))
 	}
 
 	// Validate rate limit config
 	if c.RateLimit.RequestsPerSecond <= 0 {
-		return fmt.Errorf("rate limit requests per second must be positive")
+		v.add("RateLimit.RequestsPerSecond", c.RateLimit.RequestsPerSecond, "rate limit requests per second must be positive")
 	}
 
 	if c.RateLimit.BurstSize <= 0 {
-		return fmt.Errorf("rate limit burst size must be positive")
+		v.add("RateLimit.BurstSize", c.RateLimit.BurstSize, "rate limit burst size must be positive")
+	}
+
+	validAlgorithms := []string{RateLimitAlgorithmTokenBucket, RateLimitAlgorithmSlidingWindow, RateLimitAlgorithmLeakyBucket}
+	if c.RateLimit.Algorithm != "" && !contains(validAlgorithms, c.RateLimit.Algorithm) {
+		v.add("RateLimit.Algorithm", c.RateLimit.Algorithm, "invalid rate limit algorithm, must be one of: %s", strings.Join(validAlgorithms, ", "))
+	}
+
+	if c.RateLimit.Algorithm == RateLimitAlgorithmSlidingWindow {
+		if c.RateLimit.WindowSize <= 0 {
+			v.add("RateLimit.WindowSize", c.RateLimit.WindowSize, "rate limit window must be positive when using the sliding_window algorithm")
+		} else if c.RateLimit.RequestsPerSecond > 0 && float64(c.RateLimit.RequestsPerSecond)*c.RateLimit.WindowSize.Seconds() < 1 {
+			v.add("RateLimit.WindowSize", c.RateLimit.WindowSize, "rate limit window must allow at least one request (RATE_LIMIT_RPS × window ≥ 1)")
+		}
+	}
+
+	if c.RateLimit.GlobalRequestsPerSecond < 0 {
+		v.add("RateLimit.GlobalRequestsPerSecond", c.RateLimit.GlobalRequestsPerSecond, "global rate limits cannot be negative")
+	}
+	if c.RateLimit.GlobalBurstSize < 0 {
+		v.add("RateLimit.GlobalBurstSize", c.RateLimit.GlobalBurstSize, "global rate limits cannot be negative")
+	}
+	if c.RateLimit.GlobalMaxConcurrent < 0 {
+		v.add("RateLimit.GlobalMaxConcurrent", c.RateLimit.GlobalMaxConcurrent, "global rate limits cannot be negative")
+	}
+
+	// Validate load shedding config
+	if c.LoadShed.MaxInFlight < 0 {
+		v.add("LoadShed.MaxInFlight", c.LoadShed.MaxInFlight, "load shedding limits cannot be negative")
+	}
+	if c.LoadShed.QueueDepth < 0 {
+		v.add("LoadShed.QueueDepth", c.LoadShed.QueueDepth, "load shedding limits cannot be negative")
+	}
+
+	if c.LoadShed.MaxInFlight > 0 && c.LoadShed.QueueDepth > 0 && c.LoadShed.QueueTimeout <= 0 {
+		v.add("LoadShed.QueueTimeout", c.LoadShed.QueueTimeout, "load shedding queue timeout must be positive when queueing is enabled")
+	}
+
+	for i, path := range c.RateLimit.ExemptPaths {
+		if !strings.HasPrefix(path, "/") {
+			v.add(fmt.Sprintf("RateLimit.ExemptPaths[%d]", i), path, "rate limit exempt path must start with '/'")
+		}
+	}
+	for i, cidr := range c.RateLimit.ExemptCIDRs {
+		if !validRange(cidr) {
+			v.add(fmt.Sprintf("RateLimit.ExemptCIDRs[%d]", i), cidr, "invalid rate limit exempt range")
+		}
+	}
+
+	validClientIDModes := []string{"raw", "hash", "truncate"}
+	if c.RateLimit.DebugClientIDMode != "" && !contains(validClientIDModes, c.RateLimit.DebugClientIDMode) {
+		v.add("RateLimit.DebugClientIDMode", c.RateLimit.DebugClientIDMode, "invalid rate limit debug client ID mode, must be one of: %s", strings.Join(validClientIDModes, ", "))
 	}
 
 	// Validate logging config
 	validLogLevels := []string{"debug", "info", "warn", "error"}
 	if !contains(validLogLevels, c.Logging.Level) {
-		return fmt.Errorf("invalid log level: %s, must be one of: %s",
-			c.Logging.Level, strings.Join(validLogLevels, ", "))
+		v.add("Logging.Level", c.Logging.Level, "invalid log level, must be one of: %s", strings.Join(validLogLevels, ", "))
 	}
 
 	validLogFormats := []string{"json", "text"}
 	if !contains(validLogFormats, c.Logging.Format) {
-		return fmt.Errorf("invalid log format: %s, must be one of: %s",
-			c.Logging.Format, strings.Join(validLogFormats, ", "))
+		v.add("Logging.Format", c.Logging.Format, "invalid log format, must be one of: %s", strings.Join(validLogFormats, ", "))
+	}
+	if c.Logging.SampleRate < 0 {
+		v.add("Logging.SampleRate", c.Logging.SampleRate, "log sample rate cannot be negative")
+	}
+
+	// Validate cache and prefetch config
+	if c.Cache.Size < 0 {
+		v.add("Cache.Size", c.Cache.Size, "cache size cannot be negative")
+	}
+	if c.Cache.HardTTL != 0 {
+		if c.Cache.TTL <= 0 {
+			v.add("Cache.TTL", c.Cache.TTL, "cache hard TTL requires a cache TTL (CACHE_TTL > 0)")
+		} else if c.Cache.HardTTL < c.Cache.TTL {
+			v.add("Cache.HardTTL", c.Cache.HardTTL, "cache hard TTL cannot be shorter than the cache TTL")
+		}
+	}
+
+	if c.Prefetch.Enabled && c.Privacy.DoNotStore {
+		v.add("Prefetch.Enabled", c.Prefetch.Enabled, "prefetch cannot be enabled with DO_NOT_STORE (it tracks raw queried IPs)")
+	}
+	if c.Prefetch.Enabled {
+		if c.Cache.Size == 0 {
+			v.add("Cache.Size", c.Cache.Size, "prefetch requires the lookup cache to be enabled (CACHE_SIZE > 0)")
+		}
+		if c.Prefetch.Trigger <= 0 {
+			v.add("Prefetch.Trigger", c.Prefetch.Trigger, "prefetch trigger must be positive")
+		}
+		if c.Prefetch.Window <= 0 {
+			v.add("Prefetch.Window", c.Prefetch.Window, "prefetch window must be positive")
+		}
+	}
+
+	if c.WarmUp.Lookups < 0 {
+		v.add("WarmUp.Lookups", c.WarmUp.Lookups, "warm-up lookups cannot be negative")
+	}
+	if c.WarmUp.Lookups > 0 && c.WarmUp.Timeout <= 0 {
+		v.add("WarmUp.Timeout", c.WarmUp.Timeout, "warm-up timeout must be positive")
+	}
+	if c.Health.HistorySize < 0 || c.Health.HistorySize > MaxHealthHistorySize {
+		v.add("Health.HistorySize", c.Health.HistorySize, "health history size must be between 0 and %d", MaxHealthHistorySize)
+	}
+	if c.Watchdog.Enabled {
+		if c.Watchdog.Interval <= 0 {
+			v.add("Watchdog.Interval", c.Watchdog.Interval, "watchdog interval must be positive")
+		}
+		if c.Watchdog.Timeout <= 0 {
+			v.add("Watchdog.Timeout", c.Watchdog.Timeout, "watchdog timeout must be positive")
+		}
+		if c.Watchdog.Threshold <= 0 {
+			v.add("Watchdog.Threshold", c.Watchdog.Threshold, "watchdog latency threshold must be positive")
+		}
+		if c.Watchdog.Failures < 1 {
+			v.add("Watchdog.Failures", c.Watchdog.Failures, "watchdog failures must be at least 1")
+		}
+		if _, err := netip.ParseAddr(c.Watchdog.IP); err != nil {
+			v.add("Watchdog.IP", c.Watchdog.IP, "watchdog IP must be an IP address")
+		}
+	}
+
+	if c.Batch.MaxIPs < 0 {
+		v.add("Batch.MaxIPs", c.Batch.MaxIPs, "batch limits cannot be negative")
+	}
+	if c.Batch.MaxStreamIPs < 0 {
+		v.add("Batch.MaxStreamIPs", c.Batch.MaxStreamIPs, "batch limits cannot be negative")
+	}
+	if c.Batch.Concurrency < 0 {
+		v.add("Batch.Concurrency", c.Batch.Concurrency, "batch limits cannot be negative")
+	}
+
+	// Validate timeouts
+	for _, t := range []struct {
+		field   string
+		timeout time.Duration
+	}{
+		{"Timeouts.Request", c.Timeouts.Request},
+		{"Timeouts.Service", c.Timeouts.Service},
+		{"Timeouts.Repository", c.Timeouts.Repository},
+		{"Timeouts.Health", c.Timeouts.Health},
+	} {
+		if t.timeout < 0 {
+			v.add(t.field, t.timeout, "timeouts cannot be negative")
+		}
+	}
+	for _, route := range sortedKeys(c.Timeouts.Routes) {
+		field := fmt.Sprintf("Timeouts.Routes[%s]", route)
+		if !strings.HasPrefix(route, "/") {
+			v.add(field, route, "route timeout path must start with '/'")
+		}
+		if timeout := c.Timeouts.Routes[route]; timeout < 0 {
+			v.add(field, timeout, "route timeout cannot be negative")
+		}
+	}
+
+	// Validate latency budgets
+	for _, route := range sortedKeys(c.Latency.Routes) {
+		field := fmt.Sprintf("Latency.Routes[%s]", route)
+		if !strings.HasPrefix(route, "/") {
+			v.add(field, route, "latency budget path must start with '/'")
+		}
+		if budget := c.Latency.Routes[route]; budget <= 0 {
+			v.add(field, budget, "latency budget must be positive")
+		}
+	}
+	if len(c.Latency.Routes) > 0 {
+		if c.Latency.Window <= 0 {
+			v.add("Latency.Window", c.Latency.Window, "latency budget window must be positive")
+		}
+		if c.Latency.Windows <= 0 {
+			v.add("Latency.Windows", c.Latency.Windows, "latency budget windows must be positive")
+		}
+		if c.Latency.MinRequests <= 0 {
+			v.add("Latency.MinRequests", c.Latency.MinRequests, "latency budget min requests must be positive")
+		}
+	}
+
+	// Validate datasets and API keys
+	for _, name := range sortedKeys(c.Datasets.Sources) {
+		field := fmt.Sprintf("Datasets.Sources[%s]", name)
+		if name == c.Datasets.Default {
+			v.add(field, name, "dataset is already the default dataset")
+		}
+		if path := c.Datasets.Sources[name]; path == "" {
+			v.add(field, path, "dataset requires a file path")
+		}
+	}
+	for _, name := range sortedKeys(c.Datasets.Regions) {
+		field := fmt.Sprintf("Datasets.Regions[%s]", name)
+		if !c.HasDataset(name) {
+			v.add(field, name, "DATASET_REGIONS refers to unknown dataset")
+		}
+		if region := c.Datasets.Regions[name]; region == "" {
+			v.add(field, region, "dataset region cannot be empty")
+		}
+	}
+
+	// Validate sharding hints
+	if len(c.Shard.Nodes) > 0 {
+		if _, exists := c.Shard.Nodes[c.Shard.Self]; !exists {
+			v.add("Shard.Self", c.Shard.Self, "SHARD_SELF must name one of SHARD_NODES")
+		}
+		for _, name := range sortedKeys(c.Shard.Nodes) {
+			if u, err := url.Parse(c.Shard.Nodes[name]); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.add(fmt.Sprintf("Shard.Nodes[%s]", name), c.Shard.Nodes[name], "shard URL must be an absolute http or https URL")
+			}
+		}
+		if c.Shard.VirtualNodes < 1 || c.Shard.VirtualNodes > shard.MaxVirtualNodes {
+			v.add("Shard.VirtualNodes", c.Shard.VirtualNodes, "shard virtual nodes must be between 1 and %d", shard.MaxVirtualNodes)
+		}
+	} else if c.Shard.Self != "" {
+		v.add("Shard.Self", c.Shard.Self, "SHARD_SELF requires SHARD_NODES")
+	}
+	// API keys are secrets, so problems name the dataset or roles rather than the key
+	for _, key := range sortedKeys(c.Auth.APIKeys) {
+		if dataset := c.Auth.APIKeys[key]; dataset != "" && !c.HasDataset(dataset) {
+			v.add("Auth.APIKeys", dataset, "API key refers to unknown dataset")
+		}
+	}
+	for _, key := range sortedKeys(c.Auth.KeyRoles) {
+		if _, exists := c.Auth.APIKeys[key]; !exists {
+			v.add("Auth.KeyRoles", secret(key), "API_KEY_ROLES refers to a key missing from API_KEYS")
+		}
+		if err := validateRoles(c.Auth.KeyRoles[key]); err != nil {
+			v.add("Auth.KeyRoles", c.Auth.KeyRoles[key], "%v", err)
+		}
+	}
+	if c.Auth.Required && len(c.Auth.APIKeys) == 0 && c.Auth.JWT.JWKSURL == "" && len(c.Auth.HMAC.Keys) == 0 {
+		v.add("Auth.Required", c.Auth.Required, "AUTH_REQUIRED requires API_KEYS, JWT_JWKS_URL or HMAC_KEYS")
+	}
+
+	// Validate request signing
+	for _, id := range sortedKeys(c.Auth.HMAC.Keys) {
+		if len(c.Auth.HMAC.Keys[id]) < minHMACSecretLength {
+			v.add(fmt.Sprintf("Auth.HMAC.Keys[%s]", id), secret(c.Auth.HMAC.Keys[id]), "HMAC secret must be at least %d characters", minHMACSecretLength)
+		}
+	}
+	for _, id := range sortedKeys(c.Auth.HMAC.KeyRoles) {
+		field := fmt.Sprintf("Auth.HMAC.KeyRoles[%s]", id)
+		if _, exists := c.Auth.HMAC.Keys[id]; !exists {
+			v.add(field, id, "HMAC_KEY_ROLES refers to unknown signing key")
+		}
+		if err := validateRoles(c.Auth.HMAC.KeyRoles[id]); err != nil {
+			v.add(field, c.Auth.HMAC.KeyRoles[id], "%v", err)
+		}
+	}
+
+	// Validate response signing
+	if c.Signing.Key != "" {
+		if _, err := jws.ParsePrivateKey(c.Signing.Key); err != nil {
+			v.add("Signing.Key", secret(c.Signing.Key), "RESPONSE_SIGNING_KEY must be an Ed25519 private key or seed as hex or base64")
+		}
+	}
+	if len(c.Auth.HMAC.Keys) > 0 && c.Auth.HMAC.MaxSkew <= 0 {
+		v.add("Auth.HMAC.MaxSkew", c.Auth.HMAC.MaxSkew, "HMAC max skew must be positive")
+	}
+
+	// Validate JWT authentication
+	if jwt := c.Auth.JWT; jwt.JWKSURL != "" {
+		if !isHTTPURL(jwt.JWKSURL) {
+			v.add("Auth.JWT.JWKSURL", jwt.JWKSURL, "JWT_JWKS_URL must be an http(s) URL")
+		}
+		if jwt.Issuer == "" {
+			v.add("Auth.JWT.Issuer", jwt.Issuer, "JWT_JWKS_URL requires JWT_ISSUER and JWT_AUDIENCE")
+		}
+		if jwt.Audience == "" {
+			v.add("Auth.JWT.Audience", jwt.Audience, "JWT_JWKS_URL requires JWT_ISSUER and JWT_AUDIENCE")
+		}
+		if jwt.JWKSRefresh <= 0 {
+			v.add("Auth.JWT.JWKSRefresh", jwt.JWKSRefresh, "JWT JWKS refresh interval must be positive")
+		}
+		for _, claim := range sortedKeys(jwt.RoleMapping) {
+			if err := validateRoles(jwt.RoleMapping[claim]); err != nil {
+				v.add(fmt.Sprintf("Auth.JWT.RoleMapping[%s]", claim), jwt.RoleMapping[claim], "%v", err)
+			}
+		}
 	}
 
+	// Validate hostname lookups
+	if h := c.Hosts; h.Enabled {
+		validFamilies := []string{HostFamilyAny, HostFamilyIPv4, HostFamilyIPv6}
+		if !contains(validFamilies, h.Family) {
+			v.add("Hosts.Family", h.Family, "invalid host lookup family, must be one of: %s", strings.Join(validFamilies, ", "))
+		}
+		if resolver.IsDoH(h.Resolver) {
+			if u, err := url.Parse(h.Resolver); err != nil || u.Host == "" {
+				v.add("Hosts.Resolver", h.Resolver, "HOST_LOOKUP_RESOLVER must be a valid https:// DNS-over-HTTPS URL")
+			}
+		} else if h.Resolver != "" {
+			if _, _, err := net.SplitHostPort(h.Resolver); err != nil {
+				v.add("Hosts.Resolver", h.Resolver, "HOST_LOOKUP_RESOLVER must be host:port or an https:// DNS-over-HTTPS URL")
+			}
+		}
+		if h.Timeout <= 0 {
+			v.add("Hosts.Timeout", h.Timeout, "host lookup timeout must be positive")
+		}
+		if h.MaxAddresses <= 0 {
+			v.add("Hosts.MaxAddresses", h.MaxAddresses, "host lookup max addresses must be positive")
+		}
+	}
+
+	// Validate the country access policy
+	if a := c.Access; a.Mode != "" {
+		validModes := []string{AccessModeDeny, AccessModeAllow}
+		if !contains(validModes, a.Mode) {
+			v.add("Access.Mode", a.Mode, "invalid access policy mode, must be one of: %s", strings.Join(validModes, ", "))
+		}
+		if len(a.Countries) == 0 {
+			v.add("Access.Countries", a.Countries, "ACCESS_POLICY_MODE requires ACCESS_POLICY_COUNTRIES")
+		}
+		for i, country := range a.Countries {
+			if _, ok := countries.Lookup(country); !ok {
+				v.add(fmt.Sprintf("Access.Countries[%d]", i), country, "unknown country")
+			}
+		}
+	}
+
+	// Validate threat intelligence
+	if t := c.Threats; t.Enabled {
+		if t.TorExitListURL == "" && t.AnonymizerListFile == "" {
+			v.add("Threats.Enabled", t.Enabled, "THREAT_INTEL_ENABLED requires TOR_EXIT_LIST_URL or ANONYMIZER_LIST_FILE")
+		}
+		if t.TorExitListURL != "" && !isHTTPURL(t.TorExitListURL) {
+			v.add("Threats.TorExitListURL", t.TorExitListURL, "TOR_EXIT_LIST_URL must be an http(s) URL")
+		}
+		if t.TorExitListURL != "" && t.TorRefresh <= 0 {
+			v.add("Threats.TorRefresh", t.TorRefresh, "Tor exit list refresh interval must be positive")
+		}
+	}
+
+	// Validate quotas
+	if c.Quota.Daily < 0 {
+		v.add("Quota.Daily", c.Quota.Daily, "quota limits cannot be negative")
+	}
+	if c.Quota.Monthly < 0 {
+		v.add("Quota.Monthly", c.Quota.Monthly, "quota limits cannot be negative")
+	}
+	if c.Quota.File != "" && c.Quota.FlushInterval <= 0 {
+		v.add("Quota.FlushInterval", c.Quota.FlushInterval, "quota flush interval must be positive when QUOTA_FILE is set")
+	}
+
+	// Validate usage export
+	if u := c.Usage; u.Dir != "" || u.URL != "" {
+		if u.Interval <= 0 {
+			v.add("Usage.Interval", u.Interval, "usage export interval must be positive")
+		}
+		if u.Dir != "" && u.Format != "csv" && u.Format != "json" {
+			v.add("Usage.Format", u.Format, "invalid usage export format, must be one of: csv, json")
+		}
+		if u.URL != "" && !isHTTPURL(u.URL) {
+			v.add("Usage.URL", u.URL, "USAGE_EXPORT_URL must be an http(s) URL")
+		}
+	}
+
+	// Validate scheduled reports; the schedule itself is parsed when the scheduler is created
+	if r := c.Reports; r.Schedule != "" {
+		if r.Dir == "" && r.WebhookURL == "" {
+			v.add("Reports.Schedule", r.Schedule, "REPORT_SCHEDULE requires REPORT_DIR or REPORT_WEBHOOK_URL")
+		}
+		if r.WebhookURL != "" && !isHTTPURL(r.WebhookURL) {
+			v.add("Reports.WebhookURL", r.WebhookURL, "REPORT_WEBHOOK_URL must be an http(s) URL")
+		}
+		if r.TopN < 0 {
+			v.add("Reports.TopN", r.TopN, "report top N cannot be negative")
+		}
+	}
+
+	if c.Coverage.MissPrefixes < 0 {
+		v.add("Coverage.MissPrefixes", c.Coverage.MissPrefixes, "miss tracker prefixes cannot be negative")
+	}
+
+	for _, name := range sortedKeys(c.Flags.Values) {
+		if _, err := strconv.ParseBool(c.Flags.Values[name]); err != nil {
+			v.add(fmt.Sprintf("Flags.Values[%s]", name), c.Flags.Values[name], "invalid feature flag value, must be true or false")
+		}
+	}
+	if c.Flags.ReloadInterval < 0 {
+		v.add("Flags.ReloadInterval", c.Flags.ReloadInterval, "feature flag reload interval cannot be negative")
+	}
+
+	if _, err := experiments.Parse(c.Experiments.Definitions); err != nil {
+		v.add("Experiments.Definitions", c.Experiments.Definitions, "%v", err)
+	}
+
+	// Validate shadow traffic
+	if s := c.Shadow; s.URL != "" {
+		if !isHTTPURL(s.URL) {
+			v.add("Shadow.URL", s.URL, "SHADOW_URL must be an http(s) URL")
+		}
+		if c.Privacy.DoNotStore {
+			v.add("Shadow.URL", s.URL, "SHADOW_URL cannot be set with DO_NOT_STORE (it sends queried IPs to another backend)")
+		}
+		if s.Percent < 0 || s.Percent > 100 {
+			v.add("Shadow.Percent", s.Percent, "shadow percent must be between 0 and 100")
+		}
+		if s.Timeout <= 0 {
+			v.add("Shadow.Timeout", s.Timeout, "shadow timeout must be positive")
+		}
+		if s.MaxInFlight <= 0 {
+			v.add("Shadow.MaxInFlight", s.MaxInFlight, "shadow max in-flight must be positive")
+		}
+	}
+
+	// Validate consumer mode
+	switch c.Server.RunMode {
+	case "", RunModeServer:
+	case RunModeConsumer:
+		cc := c.Consumer
+		if !strings.HasPrefix(cc.URL, "nats://") && !strings.HasPrefix(cc.URL, "tls://") {
+			v.add("Consumer.URL", cc.URL, "RUN_MODE=consumer requires CONSUMER_URL as a nats:// or tls:// URL")
+		}
+		if cc.InputSubject == "" {
+			v.add("Consumer.InputSubject", cc.InputSubject, "consumer input and output subjects are required")
+		}
+		if cc.OutputSubject == "" {
+			v.add("Consumer.OutputSubject", cc.OutputSubject, "consumer input and output subjects are required")
+		}
+		if cc.InputSubject != "" && cc.InputSubject == cc.OutputSubject {
+			v.add("Consumer.OutputSubject", cc.OutputSubject, "consumer input and output subjects must differ")
+		}
+		if cc.Concurrency < 0 {
+			v.add("Consumer.Concurrency", cc.Concurrency, "consumer concurrency cannot be negative")
+		}
+	default:
+		v.add("Server.RunMode", c.Server.RunMode, "invalid run mode, must be one of: %s, %s", RunModeServer, RunModeConsumer)
+	}
+
+	// Validate error reporting
+	if e := c.Errors; e.SentryDSN != "" {
+		if !isHTTPURL(e.SentryDSN) {
+			v.add("Errors.SentryDSN", secret(e.SentryDSN), "SENTRY_DSN must be an http(s) URL")
+		}
+		if e.Timeout <= 0 {
+			v.add("Errors.Timeout", e.Timeout, "SENTRY_TIMEOUT must be positive")
+		}
+	}
+
+	if p := c.Runtime.MemoryLimitPercent; p < 0 || p > 100 {
+		v.add("Runtime.MemoryLimitPercent", p, "GOMEMLIMIT_PERCENT must be between 1 and 100")
+	}
+
+	// Validate fault injection
+	if ch := c.Chaos; ch.Enabled {
+		if ch.LatencyPercent < 0 || ch.LatencyPercent > 100 {
+			v.add("Chaos.LatencyPercent", ch.LatencyPercent, "chaos percentages must be between 0 and 100")
+		}
+		if ch.ErrorPercent < 0 || ch.ErrorPercent > 100 {
+			v.add("Chaos.ErrorPercent", ch.ErrorPercent, "chaos percentages must be between 0 and 100")
+		}
+		if ch.Latency < 0 {
+			v.add("Chaos.Latency", ch.Latency, "chaos latency cannot be negative")
+		}
+		if ch.Jitter < 0 {
+			v.add("Chaos.Jitter", ch.Jitter, "chaos jitter cannot be negative")
+		}
+		if ch.ErrorStatus < 400 || ch.ErrorStatus > 599 {
+			v.add("Chaos.ErrorStatus", ch.ErrorStatus, "CHAOS_ERROR_STATUS must be a 4xx or 5xx status code")
+		}
+	}
+
+	return v.err()
+}
+
+// validRange reports whether s is a CIDR range or a single address
+func validRange(s string) bool {
+	if _, err := netip.ParsePrefix(s); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+// isHTTPURL reports whether s is an http:// or https:// URL
+func isHTTPURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+}
+
+// validateRoles checks a "|"-separated role list
+func validateRoles(roles string) error {
+	for _, role := range strings.Split(roles, "|") {
+		if role = strings.TrimSpace(role); role != "" && !contains(apiKeyRoles, role) {
+			return fmt.Errorf("invalid API key role: %s (must be one of %s)", role, strings.Join(apiKeyRoles, ", "))
+		}
+	}
 	return nil
 }
 
 // Helper functions for environment variable parsing
 
+// parseProblems collects problems with the environment found while a configuration
+// loads, such as settings the get*Env helpers couldn't parse and fell back to the
+// default for; Validate reports them. loadMu keeps concurrent loads from mixing up
+// their problems.
+var (
+	loadMu        sync.Mutex
+	parseProblems validator
+)
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -163,22 +1520,90 @@ func getEnv(key, defaultValue string) string {
 
 func getIntEnv(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			parseProblems.add(key, value, "must be an integer")
+			return defaultValue
+		}
+		return intValue
+	}
+	return defaultValue
+}
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			parseProblems.add(key, value, "must be true or false")
+			return defaultValue
 		}
+		return boolValue
 	}
 	return defaultValue
 }
 
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
-			return duration
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			parseProblems.add(key, value, "must be a duration such as 500ms or 2m")
+			return defaultValue
 		}
+		return duration
 	}
 	return defaultValue
 }
 
+// getStringSliceEnv reads a comma-separated list, skipping empty entries
+func getStringSliceEnv(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getStringMapEnv parses "key=value,key2=value2"; a bare "key" maps to an empty value
+func getStringMapEnv(key string) map[string]string {
+	return parseStringMap(os.Getenv(key))
+}
+
+// parseStringMap parses "key=value,key2=value2" like getStringMapEnv
+func parseStringMap(value string) map[string]string {
+	result := make(map[string]string)
+	if value == "" {
+		return result
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		if k = strings.TrimSpace(k); k == "" {
+			continue
+		}
+		result[k] = strings.TrimSpace(v)
+	}
+	return result
+}
+
+// getDurationMapEnv parses "key=duration" pairs separated by commas, recording
+// malformed durations as problems
+func getDurationMapEnv(key string) map[string]time.Duration {
+	result := make(map[string]time.Duration)
+	pairs := getStringMapEnv(key)
+	for _, k := range sortedKeys(pairs) {
+		v := pairs[k]
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			parseProblems.add(key, k+"="+v, "%s must map to a duration such as 500ms or 2m", k)
+			continue
+		}
+		result[k] = duration
+	}
+	return result
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
@@ -188,7 +1613,45 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
+// isSQLIdentifier reports whether name can be spliced into SQL as a table name: a
+// letter or underscore followed by letters, digits and underscores. BulkLoad appends
+// suffixes to it, so it is kept well under the 63 byte limit of PostgreSQL.
+func isSQLIdentifier(name string) bool {
+	if name == "" || len(name) > 48 || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedKeys returns the keys of m in order, so problems are listed the same way every run
+func sortedKeys[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
+}
+
+// HasDataset reports whether name is the default or an additional configured dataset
+func (c *Config) HasDataset(name string) bool {
+	if name == c.Datasets.Default {
+		return true
+	}
+	_, exists := c.Datasets.Sources[name]
+	return exists
+}
+
 // GetServerAddress returns the full server address
 func (c *Config) GetServerAddress() string {
 	return ":" + c.Server.Port
 }
+
+// GetAdminAddress returns the admin listener address, or "" when operational
+// endpoints share the public listener
+func (c *Config) GetAdminAddress() string {
+	if c.Admin.Port == "" {
+		return ""
+	}
+	return ":" + c.Admin.Port
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+
+	"ip-geolocation-service/internal/egress"
+)
+
+// loadEgressConfig reads the outbound proxy settings. They are loaded before the
+// secrets provider, so the secret manager is reached through them too.
+func loadEgressConfig() (EgressConfig, error) {
+	cfg := EgressConfig{
+		Proxy:     getEnv("EGRESS_PROXY", ""),
+		NoProxy:   getStringSliceEnv("EGRESS_NO_PROXY"),
+		Overrides: getStringMapEnv("EGRESS_PROXY_OVERRIDES"),
+	}
+	// The destinations NO_PROXY exempts from the environment's proxy are exempt from
+	// EGRESS_PROXY too, unless EGRESS_NO_PROXY replaces them
+	if _, set := os.LookupEnv("EGRESS_NO_PROXY"); !set {
+		cfg.NoProxy = getStringSliceEnv("NO_PROXY")
+		if cfg.NoProxy == nil {
+			cfg.NoProxy = getStringSliceEnv("no_proxy")
+		}
+	}
+
+	var err error
+	cfg.Proxies, err = egress.New(egress.Config{
+		Proxy:     cfg.Proxy,
+		NoProxy:   cfg.NoProxy,
+		Overrides: cfg.Overrides,
+	})
+	if err != nil {
+		v := &validator{}
+		v.add("Egress", cfg.Proxy, "invalid egress proxy settings: %v", err)
+		return cfg, v.err()
+	}
+	return cfg, nil
+}
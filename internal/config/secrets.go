@@ -0,0 +1,110 @@
+package config
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"ip-geolocation-service/internal/egress"
+	"ip-geolocation-service/internal/secrets"
+)
+
+// secretTimeout bounds resolving one secret reference at startup
+const secretTimeout = 30 * time.Second
+
+// loadSecretsConfig reads the secrets provider settings and creates the store that
+// resolves references; provider, when set, replaces the one SECRETS_PROVIDER selects.
+// The secret manager is reached through proxies.
+func loadSecretsConfig(provider secrets.Provider, proxies *egress.Proxies) (SecretsConfig, error) {
+	v := &validator{}
+	cfg := SecretsConfig{
+		Provider:        getEnv("SECRETS_PROVIDER", ""),
+		VaultAddr:       getEnv("VAULT_ADDR", ""),
+		VaultNamespace:  getEnv("VAULT_NAMESPACE", ""),
+		VaultMount:      getEnv("VAULT_MOUNT", secrets.DefaultVaultMount),
+		CacheTTL:        getDurationEnv("SECRETS_CACHE_TTL", secrets.DefaultTTL),
+		RefreshInterval: getDurationEnv("SECRETS_REFRESH_INTERVAL", 0),
+	}
+	// The Vault token can't itself come from Vault
+	token := &secretEnv{}
+	cfg.VaultToken = token.get("VAULT_TOKEN")
+	v.problems = append(v.problems, token.problems...)
+
+	if cfg.CacheTTL <= 0 {
+		v.add("Secrets.CacheTTL", cfg.CacheTTL, "secrets cache TTL must be positive")
+	}
+	if cfg.RefreshInterval < 0 {
+		v.add("Secrets.RefreshInterval", cfg.RefreshInterval, "secrets refresh interval cannot be negative")
+	}
+
+	switch {
+	case provider != nil:
+	case cfg.Provider == "":
+	case cfg.Provider == SecretsProviderVault:
+		if !isHTTPURL(cfg.VaultAddr) {
+			v.add("Secrets.VaultAddr", cfg.VaultAddr, "SECRETS_PROVIDER=vault requires VAULT_ADDR as an http(s) URL")
+		}
+		if cfg.VaultToken == "" {
+			v.add("Secrets.VaultToken", secret(cfg.VaultToken), "SECRETS_PROVIDER=vault requires VAULT_TOKEN or VAULT_TOKEN_FILE")
+		}
+		provider = secrets.NewVault(secrets.VaultConfig{
+			Addr:      cfg.VaultAddr,
+			Token:     cfg.VaultToken,
+			Namespace: cfg.VaultNamespace,
+			Mount:     cfg.VaultMount,
+			Transport: proxies.Transport(),
+		})
+	default:
+		v.add("Secrets.Provider", cfg.Provider, "invalid secrets provider, must be one of: %s", SecretsProviderVault)
+	}
+	if err := v.err(); err != nil {
+		return cfg, err
+	}
+
+	if provider != nil {
+		cfg.Store = secrets.NewCache(provider, cfg.CacheTTL)
+	}
+	return cfg, nil
+}
+
+// secretEnv reads settings that hold credentials. KEY_FILE names a file holding the
+// value, such as a mounted Kubernetes or Docker secret, and a "secret:name#field"
+// value is resolved through the store. Problems name the variable, never the value.
+type secretEnv struct {
+	validator
+	store *secrets.Cache
+}
+
+// get returns the value of the credential setting key, or "" after recording a problem
+func (e *secretEnv) get(key string) string {
+	value := os.Getenv(key)
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		if value != "" {
+			e.add(key+"_FILE", path, "set either %s or %s_FILE, not both", key, key)
+			return ""
+		}
+		var err error
+		if value, err = secrets.ReadFile(path); err != nil {
+			e.add(key+"_FILE", path, "%v", err)
+			return ""
+		}
+	}
+
+	ref, ok := strings.CutPrefix(value, secrets.Prefix)
+	if !ok {
+		return value
+	}
+	if e.store == nil {
+		e.add(key, ref, "secret references require SECRETS_PROVIDER")
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	resolved, err := e.store.Resolve(ctx, ref)
+	if err != nil {
+		e.add(key, ref, "%v", err)
+		return ""
+	}
+	return resolved
+}
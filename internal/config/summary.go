@@ -0,0 +1,150 @@
+package config
+
+import "log/slog"
+
+// LogValue summarizes the resolved configuration for the startup event. Credentials
+// never appear: settings that hold them only report whether they are set, and URLs
+// have their userinfo redacted.
+func (c *Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Group("server",
+			"port", c.Server.Port,
+			"admin_port", c.Admin.Port,
+			"base_path", c.Server.BasePath,
+			"disabled_middleware", c.Server.DisabledMiddleware,
+			"run_mode", c.Server.RunMode,
+			"region", c.Server.Region,
+			"localize_errors", c.Server.LocalizeErrors,
+			"listeners", c.Server.Listeners,
+			"h2c", c.Server.H2C,
+			"keep_alives", c.Server.KeepAlivesEnabled,
+			"socket_handoff", c.Server.SocketHandoff,
+			"read_timeout", c.Server.ReadTimeout,
+			"write_timeout", c.Server.WriteTimeout,
+			"idle_timeout", c.Server.IdleTimeout,
+		),
+		slog.Group("database",
+			"type", c.Database.Type,
+			"file_path", redactURL(c.Database.FilePath),
+			"table", c.Database.Table,
+			"tier_file", c.Database.Tier.LocalFile,
+			"tier_window", c.Database.Tier.Window,
+			"embedded", c.Database.Embedded,
+			"duplicates", c.Database.Duplicates,
+			"max_records", c.Database.MaxRecords,
+			"checksum_set", c.Database.Checksum != "",
+			"signed", c.Database.PublicKey != "",
+			"load_retry", c.Database.LoadRetry,
+			"pool_size", c.Database.Pool.Size,
+			"pool_max_idle", c.Database.Pool.MaxIdle,
+			"max_age", c.Database.MaxAge,
+			"stale_policy", c.Database.StalePolicy,
+		),
+		slog.Group("datasets",
+			"default", c.Datasets.Default,
+			"additional", len(c.Datasets.Sources),
+			"header_enabled", c.Datasets.HeaderEnabled,
+			"regions", c.Datasets.Regions,
+		),
+		slog.Group("shard",
+			"self", c.Shard.Self,
+			"nodes", len(c.Shard.Nodes),
+		),
+		slog.Group("rate_limit",
+			"rps", c.RateLimit.RequestsPerSecond,
+			"burst", c.RateLimit.BurstSize,
+			"algorithm", c.RateLimit.Algorithm,
+			"global_rps", c.RateLimit.GlobalRequestsPerSecond,
+		),
+		slog.Group("logging",
+			"level", c.Logging.Level,
+			"format", c.Logging.Format,
+			"sample_rate", c.Logging.SampleRate,
+		),
+		slog.Group("cache",
+			"size", c.Cache.Size,
+			"ttl", c.Cache.TTL,
+			"hard_ttl", c.Cache.HardTTL,
+		),
+		slog.Group("access",
+			"mode", c.Access.Mode,
+			"countries", c.Access.Countries,
+			"deny_unknown", c.Access.DenyUnknown,
+		),
+		slog.Group("auth",
+			"required", c.Auth.Required,
+			"api_keys", len(c.Auth.APIKeys),
+			"hmac_keys", len(c.Auth.HMAC.Keys),
+			"jwks_url", redactURL(c.Auth.JWT.JWKSURL),
+			"admin_token_set", c.Admin.Token != "",
+			"admin_insecure", c.Admin.Insecure,
+		),
+		slog.Group("signing",
+			"key_set", c.Signing.Key != "",
+			"key_id", c.Signing.KeyID,
+		),
+		slog.Group("egress",
+			"proxy", redactURL(c.Egress.Proxy),
+			"no_proxy", c.Egress.NoProxy,
+			"overrides", len(c.Egress.Overrides),
+		),
+		slog.Group("runtime",
+			"auto_gomaxprocs", c.Runtime.AutoMaxProcs,
+			"auto_gomemlimit", c.Runtime.AutoMemoryLimit,
+			"gomemlimit_percent", c.Runtime.MemoryLimitPercent,
+		),
+		slog.Group("secrets",
+			"provider", c.Secrets.Provider,
+			"vault_addr", redactURL(c.Secrets.VaultAddr),
+			"refresh_interval", c.Secrets.RefreshInterval,
+		),
+	)
+}
+
+// Features lists the optional features the configuration turns on, in a fixed order
+func (c *Config) Features() []string {
+	features := []struct {
+		name    string
+		enabled bool
+	}{
+		{"cache", c.Cache.Size > 0},
+		{"prefetch", c.Prefetch.Enabled},
+		{"warm_up", c.WarmUp.Lookups > 0},
+		{"watchdog", c.Watchdog.Enabled},
+		{"load_retry", c.Database.LoadRetry},
+		{"dataset_freshness", c.Database.MaxAge > 0},
+		{"shard_hints", len(c.Shard.Nodes) > 0},
+		{"global_rate_limit", c.RateLimit.GlobalRequestsPerSecond > 0 || c.RateLimit.GlobalMaxConcurrent > 0},
+		{"load_shedding", c.LoadShed.MaxInFlight > 0},
+		{"threat_intel", c.Threats.Enabled},
+		{"host_lookups", c.Hosts.Enabled},
+		{"access_policy", c.Access.Mode != ""},
+		{"quotas", c.Quota.Daily > 0 || c.Quota.Monthly > 0},
+		{"usage_export", c.Usage.Dir != "" || c.Usage.URL != ""},
+		{"scheduled_reports", c.Reports.Schedule != ""},
+		{"coverage", c.Coverage.MissPrefixes > 0},
+		{"latency_budgets", len(c.Latency.Routes) > 0},
+		{"shadow_traffic", c.Shadow.URL != ""},
+		{"experiments", len(c.Experiments.Definitions) > 0},
+		{"error_reporting", c.Errors.SentryDSN != ""},
+		{"fault_injection", c.Chaos.Enabled},
+		{"consumer", c.Server.RunMode == RunModeConsumer},
+		{"jwt", c.Auth.JWT.JWKSURL != ""},
+		{"request_signing", len(c.Auth.HMAC.Keys) > 0},
+		{"response_signing", c.Signing.Key != ""},
+		{"maintenance_mode", c.Admin.MaintenanceMode},
+		{"read_only", c.Admin.ReadOnly},
+		{"feature_flags", c.Flags.File != ""},
+		{"secrets", c.Secrets.Provider != ""},
+		{"egress_proxy", c.Egress.Proxy != "" || len(c.Egress.Overrides) > 0},
+		{"privacy_anonymize", c.Privacy.AnonymizeIPs},
+		{"do_not_store", c.Privacy.DoNotStore},
+	}
+	var enabled []string
+	for _, feature := range features {
+		if feature.enabled {
+			enabled = append(enabled, feature.name)
+		}
+	}
+	return enabled
+}
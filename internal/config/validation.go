@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// redacted stands in for secrets in validation errors
+const redacted = "[redacted]"
+
+// secret marks a value that must never appear in validation errors
+type secret string
+
+// FieldError is one invalid setting
+type FieldError struct {
+	Field   string // Path of the setting, e.g. RateLimit.BurstSize
+	Value   string // Offending value as configured, with secrets redacted
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s (got %s)", e.Field, e.Message, e.Value)
+}
+
+// ValidationError lists every invalid setting found by Validate, so they can all be
+// fixed in one pass
+type ValidationError struct {
+	Problems []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d problems:", len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(p.Error())
+	}
+	return b.String()
+}
+
+// Unwrap returns the individual problems
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Problems))
+	for i, p := range e.Problems {
+		errs[i] = p
+	}
+	return errs
+}
+
+// validator collects problems instead of stopping at the first one
+type validator struct {
+	problems []*FieldError
+}
+
+// add records that field holds an invalid value
+func (v *validator) add(field string, value any, format string, args ...any) {
+	v.problems = append(v.problems, &FieldError{
+		Field:   field,
+		Value:   formatValue(value),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// err returns the collected problems, or nil if there were none
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+// formatValue renders a setting for an error message; secrets are redacted and so
+// are credentials embedded in URLs
+func formatValue(value any) string {
+	switch value := value.(type) {
+	case secret:
+		return redacted
+	case string:
+		return fmt.Sprintf("%q", redactURL(value))
+	case []string:
+		quoted := make([]string, len(value))
+		for i, s := range value {
+			quoted[i] = fmt.Sprintf("%q", redactURL(s))
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	case time.Duration:
+		return value.String()
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// redactURL replaces the userinfo of a URL, such as a DSN key or a broker password;
+// anything that isn't a URL with credentials is returned unchanged
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		// An unparseable URL may still carry credentials
+		if strings.Contains(s, "@") {
+			return redacted
+		}
+		return s
+	}
+	if u.User == nil {
+		return s
+	}
+	u.User = url.User("redacted")
+	return u.String()
+}
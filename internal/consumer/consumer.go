@@ -0,0 +1,235 @@
+// Package consumer enriches IP addresses read from a message queue with their
+// location and publishes the results to another subject
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/services"
+)
+
+// DefaultConcurrency is the number of messages enriched at once when unset
+const DefaultConcurrency = 8
+
+// Reconnect backoff bounds
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// Message is a payload received on a subject
+type Message struct {
+	Subject string
+	Data    []byte
+}
+
+// Broker is a connection to a message queue. The channel returned by Subscribe is
+// closed when the connection ends, after which Err reports why.
+type Broker interface {
+	Subscribe(subject, queue string) (<-chan Message, error)
+	Publish(subject string, data []byte) error
+	Err() error
+	Close() error
+}
+
+// Dialer opens a broker connection
+type Dialer func(ctx context.Context) (Broker, error)
+
+// Options configures a Consumer
+type Options struct {
+	Input       string // Subject IPs are read from
+	Output      string // Subject results are published to
+	Queue       string // Queue group shared by consumer replicas ("" receives every message)
+	Concurrency int    // Messages enriched at once (0 uses DefaultConcurrency)
+	// ParseMode is the treatment of non-canonical addresses ("" normalizes them)
+	ParseMode models.ParseMode
+}
+
+// Error codes set on results that have no location
+const (
+	CodeInvalidMessage = "invalid_message"
+	CodeInvalidIP      = "invalid_ip"
+	CodeNotFound       = "not_found"
+	CodeLookupFailed   = "lookup_failed"
+)
+
+// Consumer reads IPs from the input subject and publishes them with their location.
+// A message is either a bare IP address or a JSON object with an "ip" field; objects
+// are published with every original field kept and "location" added, or "error" and
+// "code" when the lookup failed, so the output can be joined with upstream events.
+type Consumer struct {
+	dial   Dialer
+	lookup services.IPService
+	opts   Options
+
+	connected     atomic.Bool
+	received      atomic.Uint64
+	enriched      atomic.Uint64
+	failed        atomic.Uint64
+	publishFailed atomic.Uint64
+	reconnects    atomic.Uint64
+}
+
+// New creates a consumer enriching messages with lookup
+func New(dial Dialer, lookup services.IPService, opts Options) *Consumer {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	return &Consumer{dial: dial, lookup: lookup, opts: opts}
+}
+
+// Run consumes messages until ctx is cancelled, reconnecting with backoff when the
+// connection is lost and reporting connection failures to onError
+func (c *Consumer) Run(ctx context.Context, onError func(error)) {
+	backoff := minBackoff
+	for {
+		started := time.Now()
+		err := c.consume(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if onError != nil && err != nil {
+			onError(err)
+		}
+
+		// A connection that held for a while starts the backoff over
+		if time.Since(started) > maxBackoff {
+			backoff = minBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+		c.reconnects.Add(1)
+	}
+}
+
+// consume processes messages from one connection until it ends or ctx is cancelled
+func (c *Consumer) consume(ctx context.Context) error {
+	broker, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer broker.Close()
+
+	messages, err := broker.Subscribe(c.opts.Input, c.opts.Queue)
+	if err != nil {
+		return err
+	}
+	c.connected.Store(true)
+	defer c.connected.Store(false)
+
+	// Closing the broker on cancellation closes messages and stops the workers
+	stop := context.AfterFunc(ctx, func() { broker.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	for range c.opts.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range messages {
+				c.received.Add(1)
+				if err := broker.Publish(c.opts.Output, c.Enrich(ctx, msg.Data)); err != nil {
+					c.publishFailed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := broker.Err(); err != nil {
+		return fmt.Errorf("consumer connection lost: %w", err)
+	}
+	return errors.New("consumer connection closed")
+}
+
+// Enrich returns the result published for an input message
+func (c *Consumer) Enrich(ctx context.Context, data []byte) []byte {
+	fields := make(map[string]any)
+	var ip string
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		raw := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(trimmed, &raw); err != nil || json.Unmarshal(raw["ip"], &ip) != nil {
+			c.failed.Add(1)
+			return encodeResult(map[string]any{"error": "Message must be an IP address or a JSON object with an ip field", "code": CodeInvalidMessage})
+		}
+		for name, value := range raw {
+			fields[name] = value
+		}
+	} else {
+		ip = string(trimmed)
+		fields["ip"] = ip
+	}
+
+	location, message, code := c.find(ctx, ip)
+	if location == nil {
+		c.failed.Add(1)
+		fields["error"], fields["code"] = message, code
+		delete(fields, "location")
+		return encodeResult(fields)
+	}
+	c.enriched.Add(1)
+	fields["location"] = location
+	return encodeResult(fields)
+}
+
+// find looks up ip, returning an error message and code when there is no location
+func (c *Consumer) find(ctx context.Context, ip string) (*models.Location, string, string) {
+	addr, err := models.ParseIPMode(ip, c.opts.ParseMode)
+	if err != nil {
+		return nil, "Invalid IP address format", CodeInvalidIP
+	}
+	location, err := c.lookup.FindLocation(ctx, addr)
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return nil, "Location not found for the provided IP address", CodeNotFound
+	case err != nil:
+		return nil, "Lookup failed", CodeLookupFailed
+	}
+	return location, "", ""
+}
+
+// encodeResult marshals a result; every value is JSON-encodable
+func encodeResult(fields map[string]any) []byte {
+	data, _ := json.Marshal(fields)
+	return data
+}
+
+// RegisterMetrics exposes consumer throughput and connection state on the registry
+func (c *Consumer) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("ipgeo_consumer_connected",
+		"Whether the consumer is connected to the message queue (1) or not (0)",
+		func() float64 {
+			if c.connected.Load() {
+				return 1
+			}
+			return 0
+		})
+	registry.NewCounterFunc("ipgeo_consumer_messages_total",
+		"Total messages received from the input subject",
+		func() float64 { return float64(c.received.Load()) })
+	registry.NewCounterFunc("ipgeo_consumer_enriched_total",
+		"Total messages published with a location",
+		func() float64 { return float64(c.enriched.Load()) })
+	registry.NewCounterFunc("ipgeo_consumer_failed_total",
+		"Total messages published with an error instead of a location",
+		func() float64 { return float64(c.failed.Load()) })
+	registry.NewCounterFunc("ipgeo_consumer_publish_errors_total",
+		"Total results that could not be published",
+		func() float64 { return float64(c.publishFailed.Load()) })
+	registry.NewCounterFunc("ipgeo_consumer_reconnects_total",
+		"Total reconnection attempts to the message queue",
+		func() float64 { return float64(c.reconnects.Load()) })
+}
@@ -0,0 +1,175 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/services"
+)
+
+// fakeBroker delivers queued messages and records what is published
+type fakeBroker struct {
+	messages  chan Message
+	mu        sync.Mutex
+	published []Message
+	closeOnce sync.Once
+}
+
+func newFakeBroker(payloads ...string) *fakeBroker {
+	b := &fakeBroker{messages: make(chan Message, len(payloads))}
+	for _, p := range payloads {
+		b.messages <- Message{Subject: "in", Data: []byte(p)}
+	}
+	return b
+}
+
+func (b *fakeBroker) Subscribe(subject, queue string) (<-chan Message, error) {
+	return b.messages, nil
+}
+
+func (b *fakeBroker) Publish(subject string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published = append(b.published, Message{Subject: subject, Data: data})
+	return nil
+}
+
+func (b *fakeBroker) Err() error { return nil }
+
+func (b *fakeBroker) Close() error {
+	b.closeOnce.Do(func() { close(b.messages) })
+	return nil
+}
+
+func (b *fakeBroker) results() []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	results := make([]map[string]any, 0, len(b.published))
+	for _, msg := range b.published {
+		var result map[string]any
+		json.Unmarshal(msg.Data, &result)
+		results = append(results, result)
+	}
+	return results
+}
+
+func newTestConsumer(dial Dialer) *Consumer {
+	repo := services.NewMockRepository()
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	return New(dial, services.NewIPService(repo), Options{Input: "in", Output: "out", Concurrency: 2})
+}
+
+func TestConsumer_Enrich(t *testing.T) {
+	c := newTestConsumer(nil)
+
+	tests := []struct {
+		name    string
+		payload string
+		code    string
+		fields  map[string]any
+	}{
+		{"bare IP", "8.8.8.8\n", "", map[string]any{"ip": "8.8.8.8"}},
+		{"JSON keeps fields", `{"ip": "8.8.8.8", "event_id": 7}`, "", map[string]any{"ip": "8.8.8.8", "event_id": float64(7)}},
+		{"not found", `{"ip": "1.2.3.4", "event_id": 8}`, CodeNotFound, map[string]any{"event_id": float64(8)}},
+		{"invalid IP", "not-an-ip", CodeInvalidIP, map[string]any{"ip": "not-an-ip"}},
+		{"missing ip field", `{"addr": "8.8.8.8"}`, CodeInvalidMessage, nil},
+		{"malformed JSON", `{"ip":`, CodeInvalidMessage, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result map[string]any
+			if err := json.Unmarshal(c.Enrich(context.Background(), []byte(tt.payload)), &result); err != nil {
+				t.Fatalf("Enrich returned invalid JSON: %v", err)
+			}
+			if code, _ := result["code"].(string); code != tt.code {
+				t.Errorf("code = %q, want %q (result %v)", code, tt.code, result)
+			}
+			if _, ok := result["location"]; ok != (tt.code == "") {
+				t.Errorf("location present = %v, want %v", ok, tt.code == "")
+			}
+			for name, want := range tt.fields {
+				if result[name] != want {
+					t.Errorf("%s = %v, want %v", name, result[name], want)
+				}
+			}
+		})
+	}
+
+	if got := c.enriched.Load(); got != 2 {
+		t.Errorf("enriched = %d, want 2", got)
+	}
+	if got := c.failed.Load(); got != 4 {
+		t.Errorf("failed = %d, want 4", got)
+	}
+}
+
+func TestConsumer_Run(t *testing.T) {
+	broker := newFakeBroker("8.8.8.8", `{"ip":"1.2.3.4"}`)
+	dials := 0
+	c := newTestConsumer(func(ctx context.Context) (Broker, error) {
+		dials++
+		return broker, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx, nil)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(broker.results()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !c.connected.Load() {
+		t.Error("Expected consumer to report connected")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not stop after cancellation")
+	}
+
+	results := broker.results()
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 published results, got %d", len(results))
+	}
+	for _, msg := range broker.published {
+		if msg.Subject != "out" {
+			t.Errorf("Published to %q, want out", msg.Subject)
+		}
+	}
+	if dials != 1 || c.connected.Load() {
+		t.Errorf("dials = %d, connected = %v after stop", dials, c.connected.Load())
+	}
+}
+
+func TestConsumer_RunReportsDialErrors(t *testing.T) {
+	c := newTestConsumer(func(ctx context.Context) (Broker, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go c.Run(ctx, func(err error) {
+		errs <- err
+		cancel()
+	})
+
+	select {
+	case err := <-errs:
+		if err.Error() != "connection refused" {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected dial error to be reported")
+	}
+}
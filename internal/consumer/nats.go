@@ -0,0 +1,307 @@
+package consumer
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxControlLine bounds a protocol line from the server; payloads are read separately
+const maxControlLine = 4096
+
+// messageBuffer is how many received messages may wait for the consumer before the
+// read loop blocks and the server sees a slow consumer
+const messageBuffer = 256
+
+// NATS is a minimal client for the core NATS text protocol: one connection, one
+// subscription, fire-and-forget publishing. Delivery is at most once, as with any
+// core NATS subscriber.
+type NATS struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	mu     sync.Mutex // Serializes writes
+	writer *bufio.Writer
+
+	messages   chan Message
+	subscribed bool
+
+	closeOnce sync.Once
+	closing   chan struct{} // Closed when the connection is being closed
+	done      chan struct{}
+	err       error // Why the read loop stopped, set before done is closed
+}
+
+// natsInfo is the part of the server's INFO line the client uses
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// natsConnect is the CONNECT options sent after INFO
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+// DialNATS connects to rawURL (nats://[user:pass@|token@]host:port, or tls:// for
+// TLS) and waits for the server to accept the connection
+func DialNATS(ctx context.Context, rawURL string) (*NATS, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid NATS URL: %s", rawURL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	reader := bufio.NewReaderSize(conn, maxControlLine)
+	line, err := readLine(reader)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read NATS server info: %w", err)
+	}
+	payload, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected NATS greeting: %q", line)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(payload), &info); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("invalid NATS server info: %w", err)
+	}
+
+	if u.Scheme == "tls" || info.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("NATS TLS handshake failed: %w", err)
+		}
+		conn = tlsConn
+		reader = bufio.NewReaderSize(conn, maxControlLine)
+	}
+
+	options := natsConnect{Name: "ipgeo-consumer", Lang: "go", Version: "1.0", Protocol: 1}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			options.User, options.Pass = u.User.Username(), pass
+		} else {
+			options.Token = u.User.Username()
+		}
+	}
+	connect, _ := json.Marshal(options)
+
+	// PING after CONNECT: the PONG confirms the server accepted the credentials
+	writer := bufio.NewWriter(conn)
+	fmt.Fprintf(writer, "CONNECT %s\r\nPING\r\n", connect)
+	if err := writer.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send NATS connect: %w", err)
+	}
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+		}
+		if line == "PONG" {
+			break
+		}
+		if msg, ok := strings.CutPrefix(line, "-ERR "); ok {
+			conn.Close()
+			return nil, fmt.Errorf("NATS server rejected connection: %s", strings.Trim(msg, "'"))
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	n := &NATS{
+		conn:     conn,
+		reader:   reader,
+		writer:   writer,
+		messages: make(chan Message, messageBuffer),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go n.readLoop()
+	return n, nil
+}
+
+// Subscribe subscribes to subject, sharing its messages with other members of queue
+// when queue is set. The channel is closed when the connection is lost or closed.
+func (n *NATS) Subscribe(subject, queue string) (<-chan Message, error) {
+	if !validSubject(subject) || strings.ContainsAny(queue, " \t\r\n") {
+		return nil, fmt.Errorf("invalid NATS subject: %q", subject)
+	}
+	if queue != "" {
+		subject += " " + queue
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.subscribed {
+		return nil, errors.New("NATS client is already subscribed")
+	}
+	n.writer.WriteString("SUB " + subject + " 1\r\n")
+	if err := n.writer.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to NATS: %w", err)
+	}
+	n.subscribed = true
+	return n.messages, nil
+}
+
+// Publish sends data to subject
+func (n *NATS) Publish(subject string, data []byte) error {
+	if !validSubject(subject) || strings.ContainsAny(subject, "*>") {
+		return fmt.Errorf("invalid NATS subject: %q", subject)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	fmt.Fprintf(n.writer, "PUB %s %d\r\n", subject, len(data))
+	n.writer.Write(data)
+	n.writer.WriteString("\r\n")
+	if err := n.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+	return nil
+}
+
+// Err waits for the connection to stop and returns why; call it once the message
+// channel is closed. It is nil after Close.
+func (n *NATS) Err() error {
+	<-n.done
+	return n.err
+}
+
+// Close closes the connection
+func (n *NATS) Close() error {
+	err := n.shutdown()
+	<-n.done
+	return err
+}
+
+// shutdown closes the connection once, unblocking the read loop
+func (n *NATS) shutdown() error {
+	var err error
+	n.closeOnce.Do(func() {
+		close(n.closing)
+		err = n.conn.Close()
+	})
+	return err
+}
+
+// write sends a protocol line
+func (n *NATS) write(line string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.writer.WriteString(line)
+	if err := n.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write to NATS: %w", err)
+	}
+	return nil
+}
+
+// readLoop delivers messages and answers server pings until the connection ends
+func (n *NATS) readLoop() {
+	err := n.read()
+	n.shutdown()
+	if errors.Is(err, net.ErrClosed) {
+		err = nil // Closed by Close
+	}
+	n.err = err
+	close(n.messages)
+	close(n.done)
+}
+
+func (n *NATS) read() error {
+	for {
+		line, err := readLine(n.reader)
+		if err != nil {
+			return err
+		}
+
+		verb, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "MSG":
+			msg, err := n.readMessage(args)
+			if err != nil {
+				return err
+			}
+			select {
+			case n.messages <- msg:
+			case <-n.closing:
+				return net.ErrClosed
+			}
+		case "PING":
+			if err := n.write("PONG\r\n"); err != nil {
+				return err
+			}
+		case "-ERR":
+			return fmt.Errorf("NATS server error: %s", strings.Trim(args, "'"))
+		case "PONG", "+OK", "INFO":
+		default:
+			return fmt.Errorf("unexpected NATS protocol line: %q", line)
+		}
+	}
+}
+
+// readMessage reads the payload of a MSG line: <subject> <sid> [reply-to] <#bytes>
+func (n *NATS) readMessage(args string) (Message, error) {
+	fields := strings.Fields(args)
+	if len(fields) < 3 || len(fields) > 4 {
+		return Message{}, fmt.Errorf("invalid NATS message line: %q", args)
+	}
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || size < 0 {
+		return Message{}, fmt.Errorf("invalid NATS message size: %q", args)
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(n.reader, data); err != nil {
+		return Message{}, err
+	}
+	return Message{Subject: fields[0], Data: data[:size]}, nil
+}
+
+// readLine reads one CRLF-terminated protocol line
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", fmt.Errorf("NATS protocol line exceeds %d bytes", maxControlLine)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// validSubject reports whether subject is a non-empty NATS subject without whitespace
+func validSubject(subject string) bool {
+	return subject != "" && !strings.ContainsAny(subject, " \t\r\n")
+}
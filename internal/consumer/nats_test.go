@@ -0,0 +1,176 @@
+package consumer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeNATSServer accepts one connection and hands the test its protocol lines
+type fakeNATSServer struct {
+	listener net.Listener
+	conns    chan net.Conn
+}
+
+func newFakeNATSServer(t *testing.T) *fakeNATSServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	s := &fakeNATSServer{listener: listener, conns: make(chan net.Conn, 1)}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"max_payload\":1048576}\r\n")
+		s.conns <- conn
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *fakeNATSServer) url(userinfo string) string {
+	return "nats://" + userinfo + s.listener.Addr().String()
+}
+
+// accept returns the client connection once CONNECT and PING have been answered
+func (s *fakeNATSServer) accept(t *testing.T, reply string) (net.Conn, *bufio.Reader, string) {
+	t.Helper()
+	conn := <-s.conns
+	t.Cleanup(func() { conn.Close() })
+	reader := bufio.NewReader(conn)
+	connect, _ := reader.ReadString('\n')
+	if ping, _ := reader.ReadString('\n'); ping != "PING\r\n" {
+		t.Fatalf("Expected PING after CONNECT, got %q", ping)
+	}
+	fmt.Fprint(conn, reply)
+	return conn, reader, connect
+}
+
+func TestNATS_SubscribePublish(t *testing.T) {
+	server := newFakeNATSServer(t)
+	type dialed struct {
+		client *NATS
+		err    error
+	}
+	result := make(chan dialed, 1)
+	go func() {
+		client, err := DialNATS(context.Background(), server.url("alice:secret@"))
+		result <- dialed{client, err}
+	}()
+
+	conn, reader, connect := server.accept(t, "PONG\r\n")
+	r := <-result
+	if r.err != nil {
+		t.Fatalf("DialNATS() error = %v", r.err)
+	}
+	client := r.client
+	defer client.Close()
+	if !strings.Contains(connect, `"user":"alice"`) || !strings.Contains(connect, `"pass":"secret"`) {
+		t.Errorf("Expected credentials in CONNECT, got %q", connect)
+	}
+
+	messages, err := client.Subscribe("ipgeo.lookup", "workers")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if line, _ := reader.ReadString('\n'); line != "SUB ipgeo.lookup workers 1\r\n" {
+		t.Errorf("Unexpected SUB line %q", line)
+	}
+
+	// Server pings are answered and messages delivered, including a reply-to subject
+	fmt.Fprint(conn, "PING\r\nMSG ipgeo.lookup 1 7\r\n8.8.8.8\r\nMSG ipgeo.lookup 1 _INBOX.1 7\r\n1.1.1.1\r\n")
+	if line, _ := reader.ReadString('\n'); line != "PONG\r\n" {
+		t.Errorf("Expected PONG, got %q", line)
+	}
+	for _, want := range []string{"8.8.8.8", "1.1.1.1"} {
+		select {
+		case msg := <-messages:
+			if string(msg.Data) != want || msg.Subject != "ipgeo.lookup" {
+				t.Errorf("Received %s %q, want %q", msg.Subject, msg.Data, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for %s", want)
+		}
+	}
+
+	if err := client.Publish("ipgeo.enriched", []byte(`{"ip":"8.8.8.8"}`)); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	line, _ := reader.ReadString('\n')
+	payload, _ := reader.ReadString('\n')
+	if line != "PUB ipgeo.enriched 16\r\n" || payload != "{\"ip\":\"8.8.8.8\"}\r\n" {
+		t.Errorf("Unexpected PUB %q %q", line, payload)
+	}
+	if err := client.Publish("ipgeo.*", nil); err == nil {
+		t.Error("Expected wildcard publish subject to be rejected")
+	}
+
+	// A server error ends the connection and is reported by Err
+	fmt.Fprint(conn, "-ERR 'Slow Consumer'\r\n")
+	for range messages {
+	}
+	if err := client.Err(); err == nil || !strings.Contains(err.Error(), "Slow Consumer") {
+		t.Errorf("Err() = %v, want slow consumer error", err)
+	}
+}
+
+func TestNATS_DialRejected(t *testing.T) {
+	server := newFakeNATSServer(t)
+	result := make(chan error, 1)
+	go func() {
+		_, err := DialNATS(context.Background(), server.url("badtoken@"))
+		result <- err
+	}()
+
+	_, _, connect := server.accept(t, "-ERR 'Authorization Violation'\r\n")
+	if !strings.Contains(connect, `"auth_token":"badtoken"`) {
+		t.Errorf("Expected token in CONNECT, got %q", connect)
+	}
+	if err := <-result; err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Errorf("DialNATS() error = %v, want authorization error", err)
+	}
+}
+
+func TestNATS_CloseStopsSubscription(t *testing.T) {
+	server := newFakeNATSServer(t)
+	result := make(chan *NATS, 1)
+	go func() {
+		client, _ := DialNATS(context.Background(), server.url(""))
+		result <- client
+	}()
+	server.accept(t, "PONG\r\n")
+	client := <-result
+	if client == nil {
+		t.Fatal("DialNATS() failed")
+	}
+
+	messages, err := client.Subscribe("ipgeo.lookup", "")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if _, err := client.Subscribe("ipgeo.other", ""); err == nil {
+		t.Error("Expected a second subscription to be rejected")
+	}
+	client.Close()
+	if _, ok := <-messages; ok {
+		t.Error("Expected messages to be closed")
+	}
+	if err := client.Err(); err != nil {
+		t.Errorf("Err() after Close = %v, want nil", err)
+	}
+}
+
+func TestDialNATS_InvalidURL(t *testing.T) {
+	for _, url := range []string{"http://localhost:4222", "nats://", "::"} {
+		if _, err := DialNATS(context.Background(), url); err == nil {
+			t.Errorf("DialNATS(%q) expected error", url)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package countries maps country display names to ISO 3166-1 codes and continents
+// using an embedded table, so datasets that only carry names can still report codes.
+package countries
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"strings"
+)
+
+// Continent names keyed by their two-letter code
+var continentNames = map[string]string{
+	"AF": "Africa",
+	"AN": "Antarctica",
+	"AS": "Asia",
+	"EU": "Europe",
+	"NA": "North America",
+	"OC": "Oceania",
+	"SA": "South America",
+}
+
+// Country describes a country from the ISO 3166-1 table
+type Country struct {
+	Name      string // Common English name
+	Alpha2    string // ISO 3166-1 alpha-2 code, e.g. "US"
+	Alpha3    string // ISO 3166-1 alpha-3 code, e.g. "USA"
+	Continent string // Continent name, e.g. "North America"
+}
+
+//go:embed countries.csv
+var countriesCSV string
+
+// byKey indexes countries by normalized name, alias and codes
+var byKey = mustParse(countriesCSV)
+
+// Lookup resolves a country name, alias or ISO code (case-insensitive)
+func Lookup(name string) (Country, bool) {
+	country, ok := byKey[normalize(name)]
+	return country, ok
+}
+
+// normalize folds case and surrounding whitespace for matching
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// mustParse builds the lookup index from the embedded table
+func mustParse(data string) map[string]Country {
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("countries: invalid embedded table: %v", err))
+	}
+
+	index := make(map[string]Country, len(records)*3)
+	var codes []Country
+	for _, record := range records[1:] { // Skip header
+		continent, ok := continentNames[record[2]]
+		if !ok {
+			panic(fmt.Sprintf("countries: unknown continent %q for %s", record[2], record[0]))
+		}
+		country := Country{Name: record[3], Alpha2: record[0], Alpha3: record[1], Continent: continent}
+		codes = append(codes, country)
+
+		index[normalize(country.Name)] = country
+		if record[4] != "" {
+			for _, alias := range strings.Split(record[4], "|") {
+				index[normalize(alias)] = country
+			}
+		}
+	}
+
+	// Codes are indexed last so a name or alias is never shadowed by a code
+	for _, country := range codes {
+		for _, code := range []string{country.Alpha2, country.Alpha3} {
+			if _, exists := index[normalize(code)]; !exists {
+				index[normalize(code)] = country
+			}
+		}
+	}
+	return index
+}
@@ -0,0 +1,57 @@
+package countries
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name      string
+		alpha2    string
+		alpha3    string
+		continent string
+	}{
+		{"United States", "US", "USA", "North America"},
+		{"united kingdom", "GB", "GBR", "Europe"},
+		{"  Germany ", "DE", "DEU", "Europe"},
+		{"Ivory Coast", "CI", "CIV", "Africa"},
+		{"Côte d'Ivoire", "CI", "CIV", "Africa"},
+		{"South Korea", "KR", "KOR", "Asia"},
+		{"Russian Federation", "RU", "RUS", "Europe"},
+		{"Czech Republic", "CZ", "CZE", "Europe"},
+		{"Vatican City", "VA", "VAT", "Europe"},
+		{"Australia", "AU", "AUS", "Oceania"},
+		{"Brazil", "BR", "BRA", "South America"},
+		{"UK", "GB", "GBR", "Europe"},
+		{"fr", "FR", "FRA", "Europe"},
+		{"JPN", "JP", "JPN", "Asia"},
+	}
+
+	for _, tt := range tests {
+		country, ok := Lookup(tt.name)
+		if !ok {
+			t.Errorf("Lookup(%q) found nothing", tt.name)
+			continue
+		}
+		if country.Alpha2 != tt.alpha2 || country.Alpha3 != tt.alpha3 || country.Continent != tt.continent {
+			t.Errorf("Lookup(%q) = %+v, want %s/%s/%s", tt.name, country, tt.alpha2, tt.alpha3, tt.continent)
+		}
+	}
+
+	for _, name := range []string{"", "Private", "Atlantis"} {
+		if country, ok := Lookup(name); ok {
+			t.Errorf("Lookup(%q) = %+v, want no match", name, country)
+		}
+	}
+}
+
+func TestTableCompleteness(t *testing.T) {
+	alpha2 := make(map[string]bool)
+	for _, country := range byKey {
+		alpha2[country.Alpha2] = true
+		if len(country.Alpha2) != 2 || len(country.Alpha3) != 3 || country.Continent == "" {
+			t.Errorf("Malformed entry: %+v", country)
+		}
+	}
+	if len(alpha2) != 249 {
+		t.Errorf("Expected 249 ISO 3166-1 countries, got %d", len(alpha2))
+	}
+}
@@ -0,0 +1,243 @@
+// Package datasetdiff compares two versions of a dataset, summarizing the address
+// ranges added, removed and changed per country so vendor updates can be reviewed
+// before they are imported.
+package datasetdiff
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"text/tabwriter"
+
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/repository"
+)
+
+// Change kinds
+const (
+	Added   = "added"   // Address only in the new dataset
+	Removed = "removed" // Address only in the old dataset
+	Changed = "changed" // Address in both with a different location
+)
+
+// Range is a run of consecutive addresses with the same kind of change between the
+// same countries
+type Range struct {
+	Kind        string     `json:"kind"`
+	Start       netip.Addr `json:"start"`
+	End         netip.Addr `json:"end"`
+	Addresses   int        `json:"addresses"`
+	FromCountry string     `json:"from_country,omitempty"` // Country in the old dataset (removed and changed)
+	ToCountry   string     `json:"to_country,omitempty"`   // Country in the new dataset (added and changed)
+}
+
+// CountrySummary counts the changes attributed to one country: additions and
+// changes to the country the new dataset gives, removals to the old one
+type CountrySummary struct {
+	Country       string `json:"country"`
+	Added         int    `json:"added"`
+	Removed       int    `json:"removed"`
+	Changed       int    `json:"changed"`
+	AddedRanges   int    `json:"added_ranges"`
+	RemovedRanges int    `json:"removed_ranges"`
+	ChangedRanges int    `json:"changed_ranges"`
+}
+
+// Report is the difference between two datasets. Address counts are in the top-level
+// fields; Countries are ordered by the number of addresses affected, most first, and
+// Ranges by address.
+type Report struct {
+	OldRecords int              `json:"old_records"`
+	NewRecords int              `json:"new_records"`
+	Added      int              `json:"added"`
+	Removed    int              `json:"removed"`
+	Changed    int              `json:"changed"`
+	Unchanged  int              `json:"unchanged"`
+	Countries  []CountrySummary `json:"countries"`
+	Ranges     []Range          `json:"ranges"`
+}
+
+// Diff compares two datasets whose records are sorted by address, as returned by
+// repository.RecordLister
+func Diff(oldRecords, newRecords []repository.Record) (*Report, error) {
+	d := &differ{
+		report: &Report{
+			OldRecords: len(oldRecords),
+			NewRecords: len(newRecords),
+			Countries:  []CountrySummary{},
+			Ranges:     []Range{},
+		},
+		countries: make(map[string]*CountrySummary),
+	}
+
+	i, j := 0, 0
+	for i < len(oldRecords) || j < len(newRecords) {
+		var oldAddr, newAddr netip.Addr
+		var err error
+		if i < len(oldRecords) {
+			if oldAddr, err = netip.ParseAddr(oldRecords[i].IP); err != nil {
+				return nil, fmt.Errorf("old dataset: %w", err)
+			}
+		}
+		if j < len(newRecords) {
+			if newAddr, err = netip.ParseAddr(newRecords[j].IP); err != nil {
+				return nil, fmt.Errorf("new dataset: %w", err)
+			}
+		}
+
+		switch {
+		case j == len(newRecords) || (i < len(oldRecords) && oldAddr.Less(newAddr)):
+			d.record(Removed, oldAddr, oldRecords[i].Location.Country, "")
+			i++
+		case i == len(oldRecords) || newAddr.Less(oldAddr):
+			d.record(Added, newAddr, "", newRecords[j].Location.Country)
+			j++
+		default:
+			if sameLocation(&oldRecords[i].Location, &newRecords[j].Location) {
+				d.report.Unchanged++
+				d.flush()
+			} else {
+				d.record(Changed, newAddr, oldRecords[i].Location.Country, newRecords[j].Location.Country)
+			}
+			i++
+			j++
+		}
+	}
+	d.flush()
+
+	for _, summary := range d.countries {
+		d.report.Countries = append(d.report.Countries, *summary)
+	}
+	slices.SortFunc(d.report.Countries, func(a, b CountrySummary) int {
+		if c := cmp.Compare(b.Added+b.Removed+b.Changed, a.Added+a.Removed+a.Changed); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Country, b.Country)
+	})
+	return d.report, nil
+}
+
+// differ accumulates a report, extending the current range while consecutive
+// addresses share its change
+type differ struct {
+	report    *Report
+	countries map[string]*CountrySummary
+	current   *Range
+}
+
+// record counts one changed address
+func (d *differ) record(kind string, addr netip.Addr, from, to string) {
+	country := to
+	if kind == Removed {
+		country = from
+	}
+	summary := d.country(country)
+
+	switch kind {
+	case Added:
+		d.report.Added++
+		summary.Added++
+	case Removed:
+		d.report.Removed++
+		summary.Removed++
+	case Changed:
+		d.report.Changed++
+		summary.Changed++
+	}
+
+	if r := d.current; r != nil && r.Kind == kind && r.FromCountry == from && r.ToCountry == to && r.End.Next() == addr {
+		r.End = addr
+		r.Addresses++
+		return
+	}
+	d.flush()
+	d.current = &Range{Kind: kind, Start: addr, End: addr, Addresses: 1, FromCountry: from, ToCountry: to}
+	switch kind {
+	case Added:
+		summary.AddedRanges++
+	case Removed:
+		summary.RemovedRanges++
+	case Changed:
+		summary.ChangedRanges++
+	}
+}
+
+// flush ends the current range
+func (d *differ) flush() {
+	if d.current != nil {
+		d.report.Ranges = append(d.report.Ranges, *d.current)
+		d.current = nil
+	}
+}
+
+// country returns the summary for name, starting one if needed
+func (d *differ) country(name string) *CountrySummary {
+	summary, ok := d.countries[name]
+	if !ok {
+		summary = &CountrySummary{Country: name}
+		d.countries[name] = summary
+	}
+	return summary
+}
+
+// sameLocation reports whether two dataset locations have the same names and
+// coordinates; derived fields aren't compared
+func sameLocation(a, b *models.Location) bool {
+	if a.Country != b.Country || a.City != b.City {
+		return false
+	}
+	latA, lonA, okA := a.Coordinates()
+	latB, lonB, okB := b.Coordinates()
+	return okA == okB && latA == latB && lonA == lonB
+}
+
+// WriteText writes the report as a table per country followed by up to maxRanges
+// ranges (all of them when maxRanges is negative)
+func (r *Report) WriteText(w io.Writer, maxRanges int) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Records:\t%d old\t%d new\n", r.OldRecords, r.NewRecords)
+	fmt.Fprintf(tw, "Addresses:\t%d added\t%d removed\t%d changed\t%d unchanged\n\n", r.Added, r.Removed, r.Changed, r.Unchanged)
+
+	if len(r.Countries) > 0 {
+		fmt.Fprintln(tw, "Country\tAdded\tRemoved\tChanged\tRanges (+/-/~)")
+		for _, c := range r.Countries {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d/%d/%d\n", c.Country, c.Added, c.Removed, c.Changed, c.AddedRanges, c.RemovedRanges, c.ChangedRanges)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	ranges := r.Ranges
+	if maxRanges >= 0 && len(ranges) > maxRanges {
+		ranges = ranges[:maxRanges]
+	}
+	if len(ranges) > 0 {
+		fmt.Fprintln(w)
+	}
+	for _, rng := range ranges {
+		span := rng.Start.String()
+		if rng.End != rng.Start {
+			span += "-" + rng.End.String()
+		}
+		var countries string
+		switch rng.Kind {
+		case Added:
+			countries = rng.ToCountry
+		case Removed:
+			countries = rng.FromCountry
+		default:
+			countries = rng.FromCountry + " -> " + rng.ToCountry
+		}
+		if _, err := fmt.Fprintf(w, "%-8s %s (%d) %s\n", rng.Kind, span, rng.Addresses, countries); err != nil {
+			return err
+		}
+	}
+	if len(ranges) < len(r.Ranges) {
+		_, err := fmt.Fprintf(w, "... %d more ranges\n", len(r.Ranges)-len(ranges))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package datasetdiff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/repository"
+)
+
+func record(ip, city, country string) repository.Record {
+	return repository.Record{IP: ip, Location: models.Location{Country: country, City: city}}
+}
+
+func TestDiff(t *testing.T) {
+	oldRecords := []repository.Record{
+		record("1.0.0.1", "Sydney", "Australia"),
+		record("1.0.0.2", "Sydney", "Australia"),
+		record("8.8.8.8", "Mountain View", "United States"),
+		record("9.9.9.9", "Zurich", "Switzerland"),
+		record("9.9.9.10", "Zurich", "Switzerland"),
+	}
+	newRecords := []repository.Record{
+		record("1.0.0.1", "Sydney", "Australia"),
+		record("2.2.2.2", "Paris", "France"),
+		record("2.2.2.3", "Lyon", "France"),
+		record("2.2.2.5", "Paris", "France"),
+		record("8.8.8.8", "Reston", "United States"),
+		record("9.9.9.9", "Berlin", "Germany"),
+		record("9.9.9.10", "Munich", "Germany"),
+	}
+
+	report, err := Diff(oldRecords, newRecords)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Added != 3 || report.Removed != 1 || report.Changed != 3 || report.Unchanged != 1 {
+		t.Errorf("Unexpected totals: %+v", report)
+	}
+
+	want := []Range{
+		{Kind: Removed, Addresses: 1, FromCountry: "Australia"},
+		{Kind: Added, Addresses: 2, ToCountry: "France"}, // 2.2.2.2-2.2.2.3; cities don't split ranges
+		{Kind: Added, Addresses: 1, ToCountry: "France"}, // 2.2.2.5 isn't adjacent
+		{Kind: Changed, Addresses: 1, FromCountry: "United States", ToCountry: "United States"},
+		{Kind: Changed, Addresses: 2, FromCountry: "Switzerland", ToCountry: "Germany"},
+	}
+	if len(report.Ranges) != len(want) {
+		t.Fatalf("Expected %d ranges, got %+v", len(want), report.Ranges)
+	}
+	for i, w := range want {
+		got := report.Ranges[i]
+		if got.Kind != w.Kind || got.Addresses != w.Addresses || got.FromCountry != w.FromCountry || got.ToCountry != w.ToCountry {
+			t.Errorf("Range %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if got := report.Ranges[1]; got.Start.String() != "2.2.2.2" || got.End.String() != "2.2.2.3" {
+		t.Errorf("Expected 2.2.2.2-2.2.2.3, got %s-%s", got.Start, got.End)
+	}
+
+	// France has the most addresses affected
+	if report.Countries[0].Country != "France" || report.Countries[0].Added != 3 || report.Countries[0].AddedRanges != 2 {
+		t.Errorf("Expected France first with 3 additions in 2 ranges, got %+v", report.Countries[0])
+	}
+	for _, c := range report.Countries {
+		if c.Country == "Switzerland" {
+			t.Errorf("Changes are attributed to the new country, got %+v", c)
+		}
+	}
+}
+
+func TestDiff_CoordinatesChange(t *testing.T) {
+	lat, lon := 37.38, -122.08
+	moved := record("8.8.8.8", "Mountain View", "United States")
+	moved.Location.Latitude, moved.Location.Longitude = &lat, &lon
+
+	report, err := Diff([]repository.Record{record("8.8.8.8", "Mountain View", "United States")}, []repository.Record{moved})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Changed != 1 {
+		t.Errorf("Expected new coordinates to count as a change, got %+v", report)
+	}
+}
+
+func TestReport_WriteText(t *testing.T) {
+	report, err := Diff(nil, []repository.Record{
+		record("2.2.2.2", "Paris", "France"),
+		record("2.2.2.4", "Paris", "France"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteText(&out, 1); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+	for _, want := range []string{"2 added", "France", "added    2.2.2.2 (1) France", "... 1 more ranges"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected output to contain %q:\n%s", want, text)
+		}
+	}
+}
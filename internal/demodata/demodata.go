@@ -0,0 +1,16 @@
+// Package demodata embeds a small sample dataset, a copy of data/ip_locations.csv and
+// its translations, so the service can run with EMBEDDED_DATA=true and no data files.
+package demodata
+
+import "embed"
+
+// Files of the embedded dataset, relative to FS
+const (
+	Dataset      = "ip_locations.csv"
+	Translations = "ip_locations.translations.csv"
+)
+
+// FS holds Dataset and Translations
+//
+//go:embed ip_locations.csv ip_locations.translations.csv
+var FS embed.FS
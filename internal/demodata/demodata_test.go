@@ -0,0 +1,24 @@
+package demodata
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// The embedded files are copies of the sample data; keep them in sync
+func TestMatchesSampleData(t *testing.T) {
+	for _, name := range []string{Dataset, Translations} {
+		embedded, err := FS.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sample, err := os.ReadFile("../../data/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(embedded, sample) {
+			t.Errorf("%s differs from data/%s; copy it again", name, name)
+		}
+	}
+}
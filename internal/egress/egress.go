@@ -0,0 +1,221 @@
+// Package egress routes the service's outbound HTTP requests, such as dataset
+// downloads, JWKS and threat feed fetches and webhooks, through forward proxies.
+package egress
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Direct is the override value that reaches a destination without a proxy
+const Direct = "direct"
+
+// proxySchemes are the proxy protocols net/http speaks
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// Config selects the proxy of each outbound request
+type Config struct {
+	Proxy   string   // Proxy for every destination ("" uses HTTPS_PROXY, HTTP_PROXY and NO_PROXY)
+	NoProxy []string // Destinations reached directly despite Proxy
+	// Overrides maps destination patterns to a proxy URL or Direct, taking precedence
+	// over Proxy and the environment
+	Overrides map[string]string
+}
+
+// Proxies picks the proxy of each outbound request. Destination patterns are a host
+// name, which also matches its subdomains, a name with a leading "." or "*.", which
+// matches only subdomains, an IP address or CIDR, or "*" for everything; any of these
+// may carry a ":port". Where several overrides match, the longest pattern wins.
+type Proxies struct {
+	proxy     *url.URL
+	noProxy   []pattern
+	overrides []override
+	// environment picks the proxy when Proxy isn't set
+	environment func(*http.Request) (*url.URL, error)
+}
+
+// override sends destinations matching a pattern through proxy, or directly when nil
+type override struct {
+	pattern pattern
+	proxy   *url.URL
+}
+
+// pattern matches destinations by host and, optionally, port
+type pattern struct {
+	raw     string
+	any     bool
+	domain  string // Matches the name and its subdomains
+	suffix  string // Matches subdomains only, with the leading dot
+	network netip.Prefix
+	port    string
+}
+
+// New validates cfg and creates the proxy selector it describes
+func New(cfg Config) (*Proxies, error) {
+	p := &Proxies{environment: http.ProxyFromEnvironment}
+	if cfg.Proxy != "" {
+		proxy, err := parseProxy(cfg.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		p.proxy = proxy
+	}
+	for _, raw := range cfg.NoProxy {
+		pat, err := parsePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		p.noProxy = append(p.noProxy, pat)
+	}
+	for raw, target := range cfg.Overrides {
+		pat, err := parsePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		o := override{pattern: pat}
+		if !strings.EqualFold(target, Direct) {
+			if o.proxy, err = parseProxy(target); err != nil {
+				return nil, fmt.Errorf("override for %s: %w", raw, err)
+			}
+		}
+		p.overrides = append(p.overrides, o)
+	}
+	// Most specific first; equal lengths in a fixed order
+	slices.SortFunc(p.overrides, func(a, b override) int {
+		if len(a.pattern.raw) != len(b.pattern.raw) {
+			return len(b.pattern.raw) - len(a.pattern.raw)
+		}
+		return strings.Compare(a.pattern.raw, b.pattern.raw)
+	})
+	return p, nil
+}
+
+// Enabled reports whether anything beyond the environment's proxies is configured
+func (p *Proxies) Enabled() bool {
+	return p.proxy != nil || len(p.overrides) > 0
+}
+
+// Proxy returns the proxy for req, or nil to connect directly; it fits http.Transport.Proxy.
+// Loopback and link-local destinations, such as cloud metadata endpoints, only go
+// through a proxy an override names.
+func (p *Proxies) Proxy(req *http.Request) (*url.URL, error) {
+	host, port := req.URL.Hostname(), req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	for _, o := range p.overrides {
+		if o.pattern.matches(host, port) {
+			return o.proxy, nil
+		}
+	}
+	if p.proxy == nil {
+		return p.environment(req)
+	}
+	if local(host) {
+		return nil, nil
+	}
+	for _, pat := range p.noProxy {
+		if pat.matches(host, port) {
+			return nil, nil
+		}
+	}
+	return p.proxy, nil
+}
+
+// Transport returns a transport like http.DefaultTransport that routes through p.
+// The service's outbound clients share it; http.DefaultTransport is left alone.
+func (p *Proxies) Transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = p.Proxy
+	return transport
+}
+
+// parseProxy parses a proxy URL with a scheme net/http can speak
+func parseProxy(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", Redact(value))
+	}
+	if !slices.Contains(proxySchemes, strings.ToLower(u.Scheme)) {
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be one of %s", Redact(value), strings.Join(proxySchemes, ", "))
+	}
+	return u, nil
+}
+
+// parsePattern parses a destination pattern
+func parsePattern(raw string) (pattern, error) {
+	pat := pattern{raw: raw}
+	value := strings.ToLower(strings.TrimSpace(raw))
+	if value == "*" {
+		pat.any = true
+		return pat, nil
+	}
+	if network, err := netip.ParsePrefix(value); err == nil {
+		pat.network = network.Masked()
+		return pat, nil
+	}
+	if host, port, err := net.SplitHostPort(value); err == nil {
+		value, pat.port = host, port
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(value, "[]")); err == nil {
+		pat.network = netip.PrefixFrom(addr, addr.BitLen())
+		return pat, nil
+	}
+	value = strings.TrimPrefix(value, "*")
+	if value == "" || value == "." || strings.ContainsAny(value, "*/@ ") {
+		return pat, fmt.Errorf("invalid destination pattern %q", raw)
+	}
+	if strings.HasPrefix(value, ".") {
+		pat.suffix = value
+	} else {
+		pat.domain = value
+	}
+	return pat, nil
+}
+
+// matches reports whether the destination host and port match the pattern
+func (pat pattern) matches(host, port string) bool {
+	if pat.port != "" && pat.port != port {
+		return false
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	switch {
+	case pat.any:
+		return true
+	case pat.network.IsValid():
+		addr, err := netip.ParseAddr(host)
+		return err == nil && pat.network.Contains(addr.Unmap())
+	case pat.suffix != "":
+		return strings.HasSuffix(host, pat.suffix)
+	default:
+		return host == pat.domain || strings.HasSuffix(host, "."+pat.domain)
+	}
+}
+
+// local reports whether host is a loopback or link-local destination
+func local(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && (addr.IsLoopback() || addr.IsLinkLocalUnicast())
+}
+
+// Redact hides the credentials of a proxy URL for logs and errors
+func Redact(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	u.User = url.User("redacted")
+	return u.String()
+}
@@ -0,0 +1,105 @@
+// Package errreport forwards server errors to an external error tracker
+package errreport
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"ip-geolocation-service/internal/privacy"
+)
+
+// Event levels
+const (
+	LevelFatal = "fatal"
+	LevelError = "error"
+)
+
+// Filtered replaces values that may carry credentials
+const Filtered = "[Filtered]"
+
+// Reporter receives errors to forward to an error tracker. Capture must not block.
+type Reporter interface {
+	Capture(event Event)
+}
+
+// Frame is one stack frame
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// Request is the sanitized request an error occurred on
+type Request struct {
+	Method  string
+	Path    string
+	Query   string            // Encoded query with IPs anonymized and unknown parameters filtered
+	Headers map[string]string // Only headers known to be safe
+}
+
+// Event is an error to report
+type Event struct {
+	Level       string
+	Type        string // Error or panic value type
+	Message     string
+	Fingerprint string  // Groups repeated occurrences of the same error
+	Frames      []Frame // Innermost frame first
+	Status      int     // Response status, when one was written
+	Request     *Request
+	RequestID   string
+	Time        time.Time
+}
+
+// safeParams are query parameters whose values are reported, with IPs anonymized
+var safeParams = map[string]bool{
+	"ip": true, "ip1": true, "ip2": true, "lat": true, "lon": true, "radius_km": true,
+	"lang": true, "include_meta": true, "dataset": true,
+}
+
+// safeHeaders are request headers reported verbatim
+var safeHeaders = []string{
+	"Accept", "Accept-Language", "Content-Length", "Content-Type",
+	"User-Agent", "X-Request-ID", "X-Request-Timeout", "Grpc-Timeout",
+}
+
+// SanitizeRequest extracts the parts of r that are safe to send to a third party:
+// credentials, cookies and the client address never leave the service
+func SanitizeRequest(r *http.Request) *Request {
+	req := &Request{Method: r.Method, Path: r.URL.Path}
+
+	query := r.URL.Query()
+	if len(query) > 0 {
+		keys := make([]string, 0, len(query))
+		for key := range query {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var b strings.Builder
+		for _, key := range keys {
+			for _, value := range query[key] {
+				if !safeParams[key] {
+					value = Filtered
+				}
+				if b.Len() > 0 {
+					b.WriteByte('&')
+				}
+				b.WriteString(url.QueryEscape(key) + "=" + url.QueryEscape(privacy.AnonymizeText(value)))
+			}
+		}
+		req.Query = b.String()
+	}
+
+	for _, name := range safeHeaders {
+		if value := r.Header.Get(name); value != "" {
+			if req.Headers == nil {
+				req.Headers = make(map[string]string)
+			}
+			req.Headers[name] = value
+		}
+	}
+	return req
+}
@@ -0,0 +1,27 @@
+package errreport
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSanitizeRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=203.0.113.45&api_key=secret&lang=de", nil)
+	req.Header.Set("X-API-Key", "secret")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "session=secret")
+	req.Header.Set("User-Agent", "client/1.0")
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+
+	got := SanitizeRequest(req)
+
+	if got.Method != "GET" || got.Path != "/v1/find-country" {
+		t.Errorf("Unexpected method/path %q %q", got.Method, got.Path)
+	}
+	if want := "api_key=%5BFiltered%5D&ip=203.0.113.0&lang=de"; got.Query != want {
+		t.Errorf("Query = %q, want %q", got.Query, want)
+	}
+	if len(got.Headers) != 1 || got.Headers["User-Agent"] != "client/1.0" {
+		t.Errorf("Expected only User-Agent to be kept, got %v", got.Headers)
+	}
+}
@@ -0,0 +1,244 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/privacy"
+)
+
+// DefaultQueueSize bounds events waiting to be sent; further events are dropped
+const DefaultQueueSize = 100
+
+// Sentry sends events to a Sentry-compatible store endpoint. Capture never blocks:
+// events are queued and sent by Run, and dropped when the queue is full.
+type Sentry struct {
+	endpoint    string
+	auth        string
+	environment string
+	client      *http.Client
+	queue       chan Event
+
+	sent    atomic.Uint64
+	failed  atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// NewSentry creates a client for dsn (https://<key>@<host>/<project>) sending
+// through transport (nil uses http.DefaultTransport)
+func NewSentry(dsn, environment string, timeout time.Duration, transport http.RoundTripper) (*Sentry, error) {
+	endpoint, key, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &Sentry{
+		endpoint:    endpoint,
+		auth:        "Sentry sentry_version=7, sentry_client=ipgeo/1.0, sentry_key=" + key,
+		environment: environment,
+		client:      &http.Client{Timeout: timeout, Transport: transport},
+		queue:       make(chan Event, DefaultQueueSize),
+	}, nil
+}
+
+// parseDSN returns the store endpoint and public key of a Sentry DSN
+func parseDSN(dsn string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", "", fmt.Errorf("invalid Sentry DSN")
+	}
+	key := u.User.Username()
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	if key == "" || slash < 0 || slash == len(path)-1 {
+		return "", "", fmt.Errorf("invalid Sentry DSN: missing key or project")
+	}
+	prefix, project := path[:slash], path[slash+1:]
+	return fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project), key, nil
+}
+
+// Capture queues event for sending
+func (s *Sentry) Capture(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	select {
+	case s.queue <- event:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Run sends queued events until ctx is cancelled, reporting failures to onError.
+// Callers should Flush after Run returns so queued events aren't lost.
+func (s *Sentry) Run(ctx context.Context, onError func(error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.queue:
+			if err := s.send(ctx, event); err != nil && onError != nil && ctx.Err() == nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Flush sends every queued event, stopping at the first failure
+func (s *Sentry) Flush(ctx context.Context) error {
+	for {
+		select {
+		case event := <-s.queue:
+			if err := s.send(ctx, event); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// sentryEvent is the store endpoint's event payload
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	Environment string            `json:"environment,omitempty"`
+	Fingerprint []string          `json:"fingerprint,omitempty"`
+	Exception   sentryExceptions  `json:"exception"`
+	Request     *sentryRequest    `json:"request,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryRequest struct {
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	QueryString string            `json:"query_string,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+// payload converts event to the store endpoint's format
+func (s *Sentry) payload(event Event) sentryEvent {
+	var id [16]byte
+	rand.Read(id[:])
+
+	exception := sentryException{Type: event.Type, Value: privacy.AnonymizeText(event.Message)}
+	if len(event.Frames) > 0 {
+		// Sentry lists frames outermost first
+		frames := make([]sentryFrame, 0, len(event.Frames))
+		for i := len(event.Frames) - 1; i >= 0; i-- {
+			f := event.Frames[i]
+			frames = append(frames, sentryFrame{
+				Function: f.Function,
+				AbsPath:  f.File,
+				Lineno:   f.Line,
+				InApp:    strings.HasPrefix(f.Function, "ip-geolocation-service/"),
+			})
+		}
+		exception.Stacktrace = &sentryStacktrace{Frames: frames}
+	}
+
+	payload := sentryEvent{
+		EventID:     hex.EncodeToString(id[:]),
+		Timestamp:   event.Time.UTC().Format(time.RFC3339),
+		Level:       event.Level,
+		Platform:    "go",
+		Logger:      "ipgeo",
+		Environment: s.environment,
+		Exception:   sentryExceptions{Values: []sentryException{exception}},
+	}
+	if event.Fingerprint != "" {
+		payload.Fingerprint = []string{event.Fingerprint}
+	}
+	if req := event.Request; req != nil {
+		payload.Request = &sentryRequest{Method: req.Method, URL: req.Path, QueryString: req.Query, Headers: req.Headers}
+	}
+	tags := make(map[string]string)
+	if event.RequestID != "" {
+		tags["request_id"] = event.RequestID
+	}
+	if event.Status != 0 {
+		tags["status"] = strconv.Itoa(event.Status)
+	}
+	if len(tags) > 0 {
+		payload.Tags = tags
+	}
+	return payload
+}
+
+// send posts one event; any non-2xx response is a failure
+func (s *Sentry) send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(s.payload(event))
+	if err != nil {
+		s.failed.Add(1)
+		return fmt.Errorf("failed to encode error report: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		s.failed.Add(1)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.failed.Add(1)
+		return fmt.Errorf("failed to send error report: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		s.failed.Add(1)
+		return fmt.Errorf("failed to send error report: status %d", resp.StatusCode)
+	}
+	s.sent.Add(1)
+	return nil
+}
+
+// RegisterMetrics exposes reporting health on the registry
+func (s *Sentry) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewCounterFunc("ipgeo_error_reports_sent_total",
+		"Total error reports delivered",
+		func() float64 { return float64(s.sent.Load()) })
+	registry.NewCounterFunc("ipgeo_error_reports_failed_total",
+		"Total error reports that could not be delivered",
+		func() float64 { return float64(s.failed.Load()) })
+	registry.NewCounterFunc("ipgeo_error_reports_dropped_total",
+		"Total error reports dropped because the queue was full",
+		func() float64 { return float64(s.dropped.Load()) })
+}
@@ -0,0 +1,93 @@
+package errreport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		endpoint string
+		key      string
+		wantErr  bool
+	}{
+		{"https://abc@o1.ingest.sentry.io/42", "https://o1.ingest.sentry.io/api/42/store/", "abc", false},
+		{"http://abc@errors.internal/sentry/7/", "http://errors.internal/sentry/api/7/store/", "abc", false},
+		{"https://o1.ingest.sentry.io/42", "", "", true},
+		{"https://abc@o1.ingest.sentry.io", "", "", true},
+		{"ftp://abc@host/1", "", "", true},
+	}
+
+	for _, tt := range tests {
+		endpoint, key, err := parseDSN(tt.dsn)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.dsn, err, tt.wantErr)
+			continue
+		}
+		if endpoint != tt.endpoint || key != tt.key {
+			t.Errorf("%s: got %q %q, want %q %q", tt.dsn, endpoint, key, tt.endpoint, tt.key)
+		}
+	}
+}
+
+func TestSentry_Send(t *testing.T) {
+	var auth string
+	var event sentryEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("X-Sentry-Auth")
+		json.NewDecoder(r.Body).Decode(&event)
+	}))
+	defer server.Close()
+
+	sentry, err := NewSentry("http://secret@"+strings.TrimPrefix(server.URL, "http://")+"/3", "staging", time.Second, nil)
+	if err != nil {
+		t.Fatalf("NewSentry() error = %v", err)
+	}
+
+	sentry.Capture(Event{
+		Level:   LevelError,
+		Type:    "string",
+		Message: "boom",
+		Frames: []Frame{
+			{Function: "ip-geolocation-service/internal/handlers.inner", File: "inner.go", Line: 10},
+			{Function: "net/http.HandlerFunc.ServeHTTP", File: "server.go", Line: 20},
+		},
+		Status:    http.StatusInternalServerError,
+		Request:   &Request{Method: "GET", Path: "/v1/find-country", Query: "ip=8.8.8.0"},
+		RequestID: "req-1",
+	})
+	if err := sentry.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if !strings.Contains(auth, "sentry_key=secret") {
+		t.Errorf("Expected auth header with key, got %q", auth)
+	}
+	if event.Environment != "staging" || event.Tags["request_id"] != "req-1" || event.Tags["status"] != "500" ||
+		event.Request.Method != "GET" || event.Request.QueryString != "ip=8.8.8.0" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	frames := event.Exception.Values[0].Stacktrace.Frames
+	if len(frames) != 2 || frames[1].Function != "ip-geolocation-service/internal/handlers.inner" || !frames[1].InApp || frames[0].InApp {
+		t.Errorf("Expected frames outermost first with in_app set, got %+v", frames)
+	}
+}
+
+func TestSentry_DropsWhenFull(t *testing.T) {
+	sentry, err := NewSentry("https://key@localhost/1", "", time.Second, nil)
+	if err != nil {
+		t.Fatalf("NewSentry() error = %v", err)
+	}
+	for range DefaultQueueSize + 5 {
+		sentry.Capture(Event{Level: LevelError})
+	}
+	if dropped := sentry.dropped.Load(); dropped != 5 {
+		t.Errorf("Expected 5 dropped events, got %d", dropped)
+	}
+}
@@ -0,0 +1,160 @@
+// Package experiments lets individual requests opt into alternate code paths for
+// canary testing. A client names an allowlisted experiment in the X-Experiment
+// header; the experiment's settings travel with the request context to the layers
+// that honor them, and every request is logged and counted under its experiment.
+package experiments
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+// Header names the experiment a request opts into
+const Header = "X-Experiment"
+
+// Settings of an experiment definition, written as "key:value" separated by "|"
+const (
+	SettingDataset = "dataset" // dataset:<name> answers lookups from another dataset
+	SettingCache   = "cache"   // cache:bypass skips the lookup cache
+)
+
+// CacheBypass is the only cache setting
+const CacheBypass = "bypass"
+
+// validName matches experiment names; they become metric labels, so they stay short
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Experiment is an alternate code path requests can opt into
+type Experiment struct {
+	Name        string
+	Dataset     string // Dataset answering lookups ("" keeps the usual one)
+	BypassCache bool   // Look up without reading or filling the cache
+}
+
+// Set is the allowlist of experiments
+type Set struct {
+	experiments map[string]Experiment
+	requests    *metrics.CounterVec
+}
+
+// Parse builds the allowlist from definitions by name, such as
+// "parquet-backend" => "dataset:geo-parquet|cache:bypass"
+func Parse(definitions map[string]string) (*Set, error) {
+	s := &Set{experiments: make(map[string]Experiment, len(definitions))}
+	for name, definition := range definitions {
+		if !validName.MatchString(name) {
+			return nil, fmt.Errorf("invalid experiment name %q: use up to 64 lowercase letters, digits, - and _", name)
+		}
+		e := Experiment{Name: name}
+		for _, setting := range strings.Split(definition, "|") {
+			key, value, _ := strings.Cut(strings.TrimSpace(setting), ":")
+			switch {
+			case key == SettingDataset && value != "":
+				e.Dataset = value
+			case key == SettingCache && value == CacheBypass:
+				e.BypassCache = true
+			default:
+				return nil, fmt.Errorf("experiment %s: invalid setting %q, expected %s:<name> or %s:%s",
+					name, setting, SettingDataset, SettingCache, CacheBypass)
+			}
+		}
+		s.experiments[name] = e
+	}
+	return s, nil
+}
+
+// Len returns the number of experiments
+func (s *Set) Len() int {
+	return len(s.experiments)
+}
+
+// Names returns the experiment names in order
+func (s *Set) Names() []string {
+	names := make([]string, 0, len(s.experiments))
+	for name := range s.experiments {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Lookup returns the experiment called name
+func (s *Set) Lookup(name string) (Experiment, bool) {
+	e, ok := s.experiments[name]
+	return e, ok
+}
+
+// RegisterMetrics counts requests per experiment on the registry
+func (s *Set) RegisterMetrics(registry *metrics.Registry) {
+	s.requests = registry.NewCounterVec("ipgeo_experiment_requests_total",
+		"Requests that opted into an experiment with X-Experiment, by experiment and status class",
+		[]string{"experiment", "status_class"})
+}
+
+// experimentKey carries the request's experiment through the context
+var experimentKey = requestcontext.NewKey[Experiment]("experiment")
+
+// WithExperiment returns a copy of ctx opted into e
+func WithExperiment(ctx context.Context, e Experiment) context.Context {
+	return experimentKey.With(ctx, e)
+}
+
+// FromContext returns the experiment the request opted into, if any
+func FromContext(ctx context.Context) (Experiment, bool) {
+	return experimentKey.Value(ctx)
+}
+
+// Middleware opts requests carrying an allowlisted X-Experiment into it and echoes
+// the header on the response. Unknown experiments are rejected with 400 and logged
+// here, since they never reach the logging middleware inside.
+func (s *Set) Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := r.Header.Get(Header)
+			if name == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			e, ok := s.Lookup(name)
+			if !ok {
+				logger.Warn("Request for an unknown experiment rejected", "path", r.URL.Path, "experiment", strconv.Quote(name))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "Unknown experiment", "code": "unknown_experiment"}`))
+				return
+			}
+
+			w.Header().Set(Header, e.Name)
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r.WithContext(WithExperiment(r.Context(), e)))
+			if s.requests != nil {
+				s.requests.Inc(e.Name, strconv.Itoa(recorder.status/100)+"xx")
+			}
+		})
+	}
+}
+
+// statusRecorder keeps the status of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer (e.g. to flush)
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
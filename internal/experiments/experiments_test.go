@@ -0,0 +1,80 @@
+package experiments
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+func TestParse(t *testing.T) {
+	set, err := Parse(map[string]string{
+		"parquet-backend": "dataset:geo-parquet|cache:bypass",
+		"no-cache":        "cache:bypass",
+	})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if e, ok := set.Lookup("parquet-backend"); !ok || e.Dataset != "geo-parquet" || !e.BypassCache {
+		t.Errorf("Lookup(parquet-backend) = %+v, %v", e, ok)
+	}
+	if e, _ := set.Lookup("no-cache"); e.Dataset != "" || !e.BypassCache {
+		t.Errorf("Lookup(no-cache) = %+v", e)
+	}
+	if names := set.Names(); strings.Join(names, ",") != "no-cache,parquet-backend" {
+		t.Errorf("Names() = %v", names)
+	}
+
+	for _, definitions := range []map[string]string{
+		{"Upper": "cache:bypass"},
+		{"x": "cache:warm"},
+		{"x": "dataset:"},
+		{"x": ""},
+	} {
+		if _, err := Parse(definitions); err == nil {
+			t.Errorf("Parse(%v) error = nil", definitions)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	set, _ := Parse(map[string]string{"canary": "dataset:next"})
+	registry := metrics.NewRegistry()
+	set.RegisterMetrics(registry)
+
+	var seen Experiment
+	var opted bool
+	handler := set.Middleware(slog.Default())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, opted = FromContext(r.Context())
+	}))
+
+	send := func(experiment string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/find-country?ip=8.8.8.8", nil)
+		if experiment != "" {
+			req.Header.Set(Header, experiment)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(""); rec.Code != http.StatusOK || opted {
+		t.Errorf("Without the header: %d, opted in = %v", rec.Code, opted)
+	}
+	rec := send("canary")
+	if !opted || seen.Dataset != "next" || rec.Header().Get(Header) != "canary" {
+		t.Errorf("With canary: opted in = %v, experiment = %+v, echoed %q", opted, seen, rec.Header().Get(Header))
+	}
+	if rec := send("unknown"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unknown_experiment") {
+		t.Errorf("Unknown experiment = %d %s, want 400 unknown_experiment", rec.Code, rec.Body.String())
+	}
+
+	var out strings.Builder
+	registry.Write(&out)
+	if !strings.Contains(out.String(), `ipgeo_experiment_requests_total{experiment="canary",status_class="2xx"} 1`) {
+		t.Errorf("Metrics missing the canary request:\n%s", out.String())
+	}
+}
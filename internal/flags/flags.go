@@ -0,0 +1,289 @@
+// Package flags gates risky features so rollouts can be staged per environment.
+// A flag's value comes from, lowest precedence first: its built-in default, the
+// FEATURE_FLAGS environment variable, a JSON file reloaded while running, and
+// runtime overrides set through /admin/flags.
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// Known flags
+const (
+	AnonymizerDetection = "anonymizer_detection"
+	DebugEndpoints      = "debug_endpoints"
+)
+
+// DefaultReloadInterval is how often the flag file is checked for changes when unset
+const DefaultReloadInterval = 10 * time.Second
+
+// maxFlagFileBytes bounds the flag file
+const maxFlagFileBytes = 1 << 20
+
+// definition describes a known flag
+type definition struct {
+	Default     bool
+	Description string
+}
+
+// Defaults keep every feature as it behaved before it was gated
+var definitions = map[string]definition{
+	AnonymizerDetection: {true, "Check lookups against anonymizer lists (requires THREAT_INTEL_ENABLED)"},
+	DebugEndpoints:      {true, "Serve /debug/rate-limiter, /debug/lookup-stats and /debug/runtime"},
+}
+
+// Flag value sources, lowest precedence first
+const (
+	SourceDefault  = "default"
+	SourceEnv      = "env"
+	SourceFile     = "file"
+	SourceOverride = "override"
+)
+
+// ErrUnknownFlag is returned for flag names that aren't defined
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// State describes the current value of one flag
+type State struct {
+	Name        string `json:"name"`
+	Enabled     bool   `json:"enabled"`
+	Source      string `json:"source"`
+	Default     bool   `json:"default"`
+	Description string `json:"description"`
+}
+
+// Set holds the flag values of the running service. A nil *Set reports every flag
+// at its default.
+type Set struct {
+	env      map[string]bool
+	file     string
+	interval time.Duration
+
+	mu        sync.RWMutex
+	fromFile  map[string]bool
+	fileStamp fileStamp
+	overrides map[string]bool
+
+	reloads  atomic.Uint64
+	failures atomic.Uint64
+}
+
+// fileStamp identifies a version of the flag file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New creates a flag set from environment values ("true"/"false" by name) and an
+// optional JSON file of {"name": true} checked for changes every interval (0 uses
+// DefaultReloadInterval)
+func New(values map[string]string, file string, interval time.Duration) (*Set, error) {
+	env := make(map[string]bool, len(values))
+	for name, value := range values {
+		if _, ok := definitions[name]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for feature flag %s", value, name)
+		}
+		env[name] = enabled
+	}
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	s := &Set{
+		env:       env,
+		file:      file,
+		interval:  interval,
+		fromFile:  map[string]bool{},
+		overrides: map[string]bool{},
+	}
+	if file != "" {
+		if _, err := s.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Enabled reports whether the named flag is on; unknown flags are off
+func (s *Set) Enabled(name string) bool {
+	enabled, _ := s.value(name)
+	return enabled
+}
+
+// value returns the effective value of name and where it came from
+func (s *Set) value(name string) (bool, string) {
+	def, ok := definitions[name]
+	if !ok {
+		return false, ""
+	}
+	if s == nil {
+		return def.Default, SourceDefault
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if enabled, ok := s.overrides[name]; ok {
+		return enabled, SourceOverride
+	}
+	if enabled, ok := s.fromFile[name]; ok {
+		return enabled, SourceFile
+	}
+	if enabled, ok := s.env[name]; ok {
+		return enabled, SourceEnv
+	}
+	return def.Default, SourceDefault
+}
+
+// States returns every known flag, sorted by name
+func (s *Set) States() []State {
+	states := make([]State, 0, len(definitions))
+	for name, def := range definitions {
+		enabled, source := s.value(name)
+		states = append(states, State{
+			Name:        name,
+			Enabled:     enabled,
+			Source:      source,
+			Default:     def.Default,
+			Description: def.Description,
+		})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// State returns the current value of one flag
+func (s *Set) State(name string) (State, bool) {
+	def, ok := definitions[name]
+	if !ok {
+		return State{}, false
+	}
+	enabled, source := s.value(name)
+	return State{Name: name, Enabled: enabled, Source: source, Default: def.Default, Description: def.Description}, true
+}
+
+// Override sets name at runtime, taking precedence over every other source until
+// cleared or the process restarts
+func (s *Set) Override(name string, enabled bool) error {
+	if _, ok := definitions[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.overrides[name] = enabled
+	return nil
+}
+
+// ClearOverride removes a runtime override of name
+func (s *Set) ClearOverride(name string) error {
+	if _, ok := definitions[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.overrides, name)
+	return nil
+}
+
+// Reload reads the flag file if it changed since the last read, reporting whether
+// it did. An invalid file is rejected as a whole and the previous values are kept.
+func (s *Set) Reload() (bool, error) {
+	if s.file == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(s.file)
+	if err != nil {
+		s.failures.Add(1)
+		return false, fmt.Errorf("failed to read feature flag file: %w", err)
+	}
+	stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+	s.mu.RLock()
+	unchanged := stamp == s.fileStamp
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	values, err := readFile(s.file)
+	if err != nil {
+		s.failures.Add(1)
+		return false, err
+	}
+
+	s.mu.Lock()
+	s.fromFile, s.fileStamp = values, stamp
+	s.mu.Unlock()
+	s.reloads.Add(1)
+	return true, nil
+}
+
+// readFile parses a flag file of {"name": true}
+func readFile(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feature flag file: %w", err)
+	}
+	if len(data) > maxFlagFileBytes {
+		return nil, fmt.Errorf("feature flag file exceeds %d bytes", maxFlagFileBytes)
+	}
+
+	var values map[string]bool
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("invalid feature flag file: %w", err)
+	}
+	for name := range values {
+		if _, ok := definitions[name]; !ok {
+			return nil, fmt.Errorf("invalid feature flag file: %w: %s", ErrUnknownFlag, name)
+		}
+	}
+	if values == nil {
+		values = map[string]bool{}
+	}
+	return values, nil
+}
+
+// Run checks the flag file for changes every interval until ctx is done. Failures
+// are passed to onError (which may be nil).
+func (s *Set) Run(ctx context.Context, onError func(error)) {
+	if s.file == "" {
+		return
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.Reload(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// RegisterMetrics exposes flag file reloads on the registry
+func (s *Set) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewCounterFunc("ipgeo_feature_flag_reloads_total",
+		"Total versions of the feature flag file applied, including the initial load",
+		func() float64 { return float64(s.reloads.Load()) })
+	registry.NewCounterFunc("ipgeo_feature_flag_reload_failures_total",
+		"Total feature flag file reads that failed or were invalid",
+		func() float64 { return float64(s.failures.Load()) })
+}
@@ -0,0 +1,125 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSet_Precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.json")
+	if err := os.WriteFile(path, []byte(`{"debug_endpoints": true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := New(map[string]string{DebugEndpoints: "false", AnonymizerDetection: "false"}, path, 0)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// The file wins over the environment
+	if state, _ := set.State(DebugEndpoints); !state.Enabled || state.Source != SourceFile {
+		t.Errorf("Expected debug_endpoints on from the file, got %+v", state)
+	}
+	if state, _ := set.State(AnonymizerDetection); state.Enabled || state.Source != SourceEnv {
+		t.Errorf("Expected anonymizer_detection off from the environment, got %+v", state)
+	}
+
+	// Runtime overrides win over everything until cleared
+	if err := set.Override(DebugEndpoints, false); err != nil {
+		t.Fatalf("Override() error = %v", err)
+	}
+	if state, _ := set.State(DebugEndpoints); state.Enabled || state.Source != SourceOverride {
+		t.Errorf("Expected debug_endpoints overridden off, got %+v", state)
+	}
+	set.ClearOverride(DebugEndpoints)
+	if !set.Enabled(DebugEndpoints) {
+		t.Error("Expected the file value after clearing the override")
+	}
+
+	if err := set.Override("jsonp", true); !errors.Is(err, ErrUnknownFlag) {
+		t.Errorf("Override(unknown) error = %v, want ErrUnknownFlag", err)
+	}
+	if set.Enabled("jsonp") {
+		t.Error("Expected unknown flags to be off")
+	}
+}
+
+func TestSet_Nil(t *testing.T) {
+	var set *Set
+	for _, state := range set.States() {
+		if state.Enabled != state.Default || state.Source != SourceDefault {
+			t.Errorf("Expected %s at its default, got %+v", state.Name, state)
+		}
+	}
+	if !set.Enabled(DebugEndpoints) {
+		t.Error("Expected debug endpoints enabled by default")
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	unknown := filepath.Join(dir, "unknown.json")
+	os.WriteFile(unknown, []byte(`{"jsonp": true}`), 0o644)
+	malformed := filepath.Join(dir, "malformed.json")
+	os.WriteFile(malformed, []byte(`{"debug_endpoints": "yes"}`), 0o644)
+
+	tests := []struct {
+		name   string
+		values map[string]string
+		file   string
+	}{
+		{"unknown env flag", map[string]string{"jsonp": "true"}, ""},
+		{"invalid env value", map[string]string{DebugEndpoints: "maybe"}, ""},
+		{"unknown file flag", nil, unknown},
+		{"malformed file", nil, malformed},
+		{"missing file", nil, filepath.Join(dir, "missing.json")},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.values, tt.file, 0); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestSet_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.json")
+	os.WriteFile(path, []byte(`{"debug_endpoints": false}`), 0o644)
+
+	set, err := New(nil, path, 5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if changed, err := set.Reload(); changed || err != nil {
+		t.Errorf("Reload() of an unchanged file = %v, %v", changed, err)
+	}
+
+	// An invalid edit is rejected and the previous values kept
+	os.WriteFile(path, []byte(`{"debug_endpoints": tru`), 0o644)
+	if _, err := set.Reload(); err == nil {
+		t.Error("Expected an invalid file to be rejected")
+	}
+	if set.Enabled(DebugEndpoints) {
+		t.Error("Expected the previous value to be kept")
+	}
+
+	// Run picks up the next valid version
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go set.Run(ctx, nil)
+	os.WriteFile(path, []byte(`{"debug_endpoints": true, "anonymizer_detection": false}`), 0o644)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !set.Enabled(DebugEndpoints) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the flag file to reload")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if set.Enabled(AnonymizerDetection) {
+		t.Error("Expected anonymizer_detection off after reload")
+	}
+}
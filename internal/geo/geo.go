@@ -0,0 +1,30 @@
+// Package geo provides great-circle distance calculations between coordinates.
+package geo
+
+import "math"
+
+// EarthRadiusKm is the mean Earth radius used for distances
+const EarthRadiusKm = 6371.0
+
+// DistanceKm returns the haversine distance in kilometers between two points given
+// in decimal degrees
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := radians(lat1), radians(lat2)
+	dPhi := radians(lat2 - lat1)
+	dLambda := radians(lon2 - lon1)
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	// Rounding can push a slightly above 1 for antipodal points
+	a = math.Min(a, 1)
+	return 2 * EarthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// ValidCoordinates reports whether lat and lon are within [-90, 90] and [-180, 180]
+func ValidCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
@@ -0,0 +1,35 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistanceKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 51.5074, -0.1278, 51.5074, -0.1278, 0},
+		{"London to Paris", 51.5074, -0.1278, 48.8566, 2.3522, 343.6},
+		{"New York to Los Angeles", 40.7128, -74.0060, 34.0522, -118.2437, 3935.7},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111.2},
+		{"antipodes", 0, 0, 0, 180, math.Pi * EarthRadiusKm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DistanceKm(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+			if math.Abs(got-tt.want) > 0.5 {
+				t.Errorf("DistanceKm() = %.1f, want %.1f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidCoordinates(t *testing.T) {
+	if !ValidCoordinates(-90, 180) || ValidCoordinates(90.1, 0) || ValidCoordinates(0, -180.1) || ValidCoordinates(math.NaN(), 0) {
+		t.Error("ValidCoordinates() accepted or rejected the wrong values")
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/services"
+)
+
+// accessResponse is the body of /v1/check-access
+type accessResponse struct {
+	IP       string           `json:"ip"`
+	Decision string           `json:"decision"` // allow or deny
+	Reason   string           `json:"reason"`
+	Country  string           `json:"country_code,omitempty"`
+	Location *models.Location `json:"location,omitempty"`
+}
+
+// CheckAccess handles GET /v1/check-access requests, answering whether a client at
+// the address may be served under the country access policy. Addresses without a
+// location are decided as unknown rather than failing.
+func (h *IPHandler) CheckAccess(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		h.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.accessPolicy == nil {
+		h.sendErrorWithCode(w, "Access policy is not configured", "access_policy_disabled", http.StatusNotImplemented)
+		return
+	}
+
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+	ip := query.Get("ip")
+	if ip == "" {
+		h.sendError(w, "Missing required parameter: ip", http.StatusBadRequest)
+		return
+	}
+	addr, err := h.parseIP(ip)
+	if err != nil {
+		h.sendLookupError(w, err)
+		return
+	}
+	h.setShardHeaders(w, addr)
+
+	ctx, ok := h.datasetContext(r)
+	if !ok {
+		h.sendDatasetForbidden(w)
+		return
+	}
+
+	ctx, info := services.WithLookupInfo(ctx)
+	location, err := h.findLocation(ctx, addr)
+	if err != nil {
+		if !errors.Is(err, services.ErrNotFound) {
+			h.sendLookupError(w, err)
+			return
+		}
+		location = nil
+	}
+
+	decision := h.accessPolicy.Check(location)
+	response := accessResponse{
+		IP:       ip,
+		Decision: "deny",
+		Reason:   decision.Reason,
+		Country:  decision.Country,
+		Location: location,
+	}
+	if decision.Allowed {
+		response.Decision = "allow"
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal access response", "error", err)
+		h.sendError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.writeSigned(w, body, info)
+}
+
+// markBlocked returns a copy of location flagged with the access policy's verdict;
+// the location may be shared with the cache, so it is never modified in place
+func (h *IPHandler) markBlocked(location *models.Location) *models.Location {
+	blocked := !h.accessPolicy.Check(location).Allowed
+	marked := *location
+	marked.Blocked = &blocked
+	return &marked
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ip-geolocation-service/internal/accesspolicy"
+	"ip-geolocation-service/internal/models"
+)
+
+func TestIPHandler_CheckAccess(t *testing.T) {
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	service.SetLocation("1.1.1.1", &models.Location{Country: "Australia", CountryCode: "AU", City: "Sydney"})
+	handler := NewIPHandler(service, slog.Default())
+
+	// Without a policy the endpoint is disabled
+	w := httptest.NewRecorder()
+	handler.CheckAccess(w, httptest.NewRequest("GET", "/v1/check-access?ip=8.8.8.8", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("Expected status 501 without a policy, got %d", w.Code)
+	}
+
+	policy, err := accesspolicy.New(accesspolicy.ModeDeny, []string{"US"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.accessPolicy = policy
+
+	tests := []struct {
+		ip       string
+		decision string
+		reason   string
+	}{
+		{"8.8.8.8", "deny", accesspolicy.ReasonCountryBlocked},
+		{"1.1.1.1", "allow", accesspolicy.ReasonCountryNotBlocked},
+		{"192.0.2.1", "deny", accesspolicy.ReasonUnknownLocation},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.CheckAccess(w, httptest.NewRequest("GET", "/v1/check-access?ip="+tt.ip, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", tt.ip, w.Code, w.Body.String())
+		}
+		var response accessResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Decision != tt.decision || response.Reason != tt.reason {
+			t.Errorf("%s: got %s (%s), want %s (%s)", tt.ip, response.Decision, response.Reason, tt.decision, tt.reason)
+		}
+	}
+
+	// Lookups are marked with the verdict
+	w = httptest.NewRecorder()
+	handler.FindCountry(w, httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil))
+	var location models.Location
+	if err := json.Unmarshal(w.Body.Bytes(), &location); err != nil {
+		t.Fatal(err)
+	}
+	if location.Blocked == nil || !*location.Blocked {
+		t.Errorf("Expected the lookup to be marked blocked, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,888 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ip-geolocation-service/internal/audit"
+	"ip-geolocation-service/internal/flags"
+	"ip-geolocation-service/internal/middleware"
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/privacy"
+	"ip-geolocation-service/internal/repository"
+	"ip-geolocation-service/internal/requestcontext"
+	"ip-geolocation-service/internal/services"
+)
+
+// maxAdminBodyBytes bounds admin request bodies
+const maxAdminBodyBytes = 1 << 20
+
+// maxImportBodyBytes bounds datasets uploaded to /admin/import
+const maxImportBodyBytes = 512 << 20
+
+// AdminOptions holds the components managed through admin endpoints
+type AdminOptions struct {
+	Maintenance *middleware.MaintenanceMode
+	Drain       *middleware.DrainMode
+	Datasets    *services.DatasetService
+	Overrides   *services.OverrideStore
+	Audit       *audit.Log
+	PrivacyMode bool // Truncate remote addresses recorded in the audit log
+	LogLevel    *slog.LevelVar
+	LogSampler  *middleware.LogSampler
+	Misses      *services.MissTracker
+	Flags       *flags.Set
+	// TrustedProxies are the proxies whose forwarding headers shape pagination links
+	TrustedProxies *middleware.TrustedProxies
+}
+
+// AdminHandler handles operator endpoints under /admin
+type AdminHandler struct {
+	maintenance *middleware.MaintenanceMode
+	drain       *middleware.DrainMode
+	datasets    *services.DatasetService
+	overrides   *services.OverrideStore
+	audit       *audit.Log
+	privacyMode bool
+	logLevel    *slog.LevelVar
+	logSampler  *middleware.LogSampler
+	misses      *services.MissTracker
+	flags       *flags.Set
+	proxies     *middleware.TrustedProxies
+	logger      *slog.Logger
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(opts AdminOptions, logger *slog.Logger) *AdminHandler {
+	return &AdminHandler{
+		maintenance: opts.Maintenance,
+		drain:       opts.Drain,
+		datasets:    opts.Datasets,
+		overrides:   opts.Overrides,
+		audit:       opts.Audit,
+		privacyMode: opts.PrivacyMode,
+		logLevel:    opts.LogLevel,
+		logSampler:  opts.LogSampler,
+		misses:      opts.Misses,
+		flags:       opts.Flags,
+		proxies:     opts.TrustedProxies,
+		logger:      logger,
+	}
+}
+
+// maintenanceRequest is the body accepted by PUT /admin/maintenance
+type maintenanceRequest struct {
+	Enabled *bool  `json:"enabled"`
+	Message string `json:"message"`
+}
+
+// Maintenance handles GET (inspect) and PUT/POST (toggle) on /admin/maintenance
+func (h *AdminHandler) Maintenance(w http.ResponseWriter, r *http.Request) {
+	if h.maintenance == nil {
+		http.Error(w, "Maintenance mode not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var req maintenanceRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&req); err != nil || req.Enabled == nil {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": `Request body must be JSON with an "enabled" field`})
+			return
+		}
+
+		before := h.maintenance.State()
+		if *req.Enabled {
+			h.maintenance.Enable(req.Message)
+		} else {
+			h.maintenance.Disable()
+		}
+		h.record(r, "maintenance.update", "", before, h.maintenance.State())
+
+		h.logger.Warn("🛠️ Maintenance mode changed",
+			"enabled", *req.Enabled,
+			"remote_addr", r.RemoteAddr,
+		)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, h.maintenance.State())
+}
+
+// Drain handles GET (inspect) and POST (start draining) on /admin/drain. While
+// draining, /health reports the instance as not ready but requests are still
+// served.
+func (h *AdminHandler) Drain(w http.ResponseWriter, r *http.Request) {
+	h.setDraining(w, r, true)
+}
+
+// Undrain handles GET (inspect) and POST (stop draining) on /admin/undrain
+func (h *AdminHandler) Undrain(w http.ResponseWriter, r *http.Request) {
+	h.setDraining(w, r, false)
+}
+
+func (h *AdminHandler) setDraining(w http.ResponseWriter, r *http.Request, draining bool) {
+	if h.drain == nil {
+		http.Error(w, "Drain mode not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		before := h.drain.State()
+		action := "drain.start"
+		if draining {
+			h.drain.Drain()
+		} else {
+			action = "drain.stop"
+			h.drain.Undrain()
+		}
+		h.record(r, action, "", before, h.drain.State())
+
+		h.logger.Warn("🚰 Drain mode changed",
+			"draining", draining,
+			"remote_addr", r.RemoteAddr,
+		)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, h.drain.State())
+}
+
+// datasetRequest is the body accepted by POST /admin/datasets
+type datasetRequest struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Default bool   `json:"default"`
+}
+
+// datasetsResponse lists loaded datasets
+type datasetsResponse struct {
+	Default    string                 `json:"default"`
+	Datasets   []services.DatasetInfo `json:"datasets"`
+	Pagination *listPage              `json:"pagination,omitempty"` // Set on GET; mutations return every dataset
+}
+
+// datasetListing lists the datasets returned by GET /admin/datasets
+var datasetListing = listSpec[services.DatasetInfo]{
+	fields: []listField[services.DatasetInfo]{
+		{"name", func(d services.DatasetInfo) any { return d.Name }},
+		{"source", func(d services.DatasetInfo) any { return d.Source }},
+		{"version", func(d services.DatasetInfo) any { return d.Version }},
+		{"default", func(d services.DatasetInfo) any { return d.Default }},
+		{"loaded_at", func(d services.DatasetInfo) any { return d.LoadedAt }},
+		{"modified_at", func(d services.DatasetInfo) any { return d.ModifiedAt }},
+		{"stale", func(d services.DatasetInfo) any { return d.Stale }},
+	},
+	key:         func(d services.DatasetInfo) string { return d.Name },
+	defaultSort: "name",
+}
+
+// Datasets handles /admin/datasets:
+//   - GET lists loaded datasets, with the listing parameters of listSpec
+//   - POST loads (or reloads) a dataset, optionally making it the default
+//   - PUT with {"name": ..., "default": true} switches the default dataset
+//   - DELETE ?name= unloads a dataset
+func (h *AdminHandler) Datasets(w http.ResponseWriter, r *http.Request) {
+	if h.datasets == nil {
+		http.Error(w, "Datasets not available", http.StatusServiceUnavailable)
+		return
+	}
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		datasets, page, err := datasetListing.list(h.datasets.List(), query)
+		if err != nil {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		page.link(r, h.absoluteURL)
+		h.writeJSON(w, http.StatusOK, datasetsResponse{Default: h.datasets.Default(), Datasets: datasets, Pagination: &page})
+		return
+	case http.MethodPost, http.MethodPut:
+		var req datasetRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&req); err != nil || req.Name == "" {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": `Request body must be JSON with a "name" field`})
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			if req.Source == "" {
+				h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": `Loading a dataset requires a "source" field`})
+				return
+			}
+			before, existed := h.datasets.Info(req.Name)
+			if err := h.datasets.Load(r.Context(), req.Name, req.Source); err != nil {
+				h.logger.Error("Failed to load dataset", "dataset", req.Name, "error", err)
+				h.writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+				return
+			}
+			h.logger.Info("📦 Dataset loaded via admin endpoint", "dataset", req.Name, "source", req.Source)
+			after, _ := h.datasets.Info(req.Name)
+			if existed {
+				h.record(r, "dataset.load", req.Name, before, after)
+			} else {
+				h.record(r, "dataset.load", req.Name, nil, after)
+			}
+		}
+
+		if req.Default {
+			previous := h.datasets.Default()
+			if err := h.datasets.SetDefault(req.Name); err != nil {
+				h.writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+				return
+			}
+			h.logger.Warn("📦 Default dataset changed", "dataset", req.Name)
+			h.record(r, "dataset.set_default", req.Name, map[string]string{"default": previous}, map[string]string{"default": req.Name})
+		}
+	case http.MethodDelete:
+		name := query.Get("name")
+		before, _ := h.datasets.Info(name)
+		if err := h.datasets.Remove(name); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, services.ErrUnknownDataset) {
+				status = http.StatusNotFound
+			}
+			h.writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		h.logger.Info("📦 Dataset unloaded", "dataset", name)
+		h.record(r, "dataset.remove", name, before, nil)
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, datasetsResponse{
+		Default:  h.datasets.Default(),
+		Datasets: h.datasets.List(),
+	})
+}
+
+// Compare handles GET /admin/compare?a=&b=&sample=, reporting how many sampled
+// addresses resolve differently between two loaded datasets. a defaults to the
+// default dataset.
+func (h *AdminHandler) Compare(w http.ResponseWriter, r *http.Request) {
+	if h.datasets == nil {
+		http.Error(w, "Datasets not available", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+	a, b := query.Get("a"), query.Get("b")
+	if a == "" {
+		a = h.datasets.Default()
+	}
+	if b == "" || a == b {
+		h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": `Query must name a dataset "b" different from "a"`})
+		return
+	}
+
+	sample := services.DefaultComparisonSample
+	if value := query.Get("sample"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > services.MaxComparisonSample {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "sample must be between 1 and " + strconv.Itoa(services.MaxComparisonSample),
+			})
+			return
+		}
+		sample = n
+	}
+
+	report, err := h.datasets.Compare(r.Context(), a, b, sample)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrUnknownDataset):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrComparisonUnsupported):
+			status = http.StatusBadRequest
+		}
+		h.writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("📦 Datasets compared",
+		"a", a,
+		"b", b,
+		"sampled", report.Sampled,
+		"different", report.Different,
+	)
+	h.writeJSON(w, http.StatusOK, report)
+}
+
+// Import handles POST /admin/import?dataset=&dry_run=, validating the CSV dataset in
+// the body and, unless dry_run is true, replacing the dataset's data with it. The
+// report is returned with 200 when the file is valid and 422 when it isn't. dataset
+// defaults to the default dataset.
+func (h *AdminHandler) Import(w http.ResponseWriter, r *http.Request) {
+	if h.datasets == nil {
+		http.Error(w, "Datasets not available", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+	name := query.Get("dataset")
+	if name == "" {
+		name = h.datasets.Default()
+	}
+	dryRun := false
+	if value := query.Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "dry_run must be true or false"})
+			return
+		}
+	}
+
+	before, _ := h.datasets.Info(name)
+	result, err := h.datasets.Import(r.Context(), name, http.MaxBytesReader(w, r.Body, maxImportBodyBytes), dryRun)
+	if err != nil && (result == nil || !result.Applied) {
+		status := http.StatusInternalServerError
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, services.ErrUnknownDataset):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrReadOnly):
+			status = http.StatusConflict
+		case errors.As(err, &maxBytesErr):
+			status = http.StatusRequestEntityTooLarge
+		}
+		h.logger.Error("Failed to import dataset", "dataset", name, "dry_run", dryRun, "error", err)
+		h.writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if result.Applied {
+		after, _ := h.datasets.Info(name)
+		h.record(r, "dataset.import", name, before, after)
+		h.logger.Warn("📦 Dataset imported via admin endpoint",
+			"dataset", name,
+			"records", result.Records,
+			"record_delta", result.RecordDelta,
+		)
+	}
+	if err != nil {
+		// The data was swapped in but couldn't be written back to its file
+		h.logger.Error("Failed to persist imported dataset", "dataset", name, "error", err)
+		h.writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	if !result.Valid {
+		status = http.StatusUnprocessableEntity
+	}
+	h.writeJSON(w, status, result)
+}
+
+// overridesResponse lists overrides
+type overridesResponse struct {
+	Overrides  []services.Override `json:"overrides"`
+	Pagination listPage            `json:"pagination"`
+}
+
+// overrideListing lists the overrides returned by GET /admin/overrides
+var overrideListing = listSpec[services.Override]{
+	fields: []listField[services.Override]{
+		{"target", func(o services.Override) any { return o.Target }},
+		{"country", func(o services.Override) any { return o.Country }},
+		{"city", func(o services.Override) any { return o.City }},
+		{"reason", func(o services.Override) any { return o.Reason }},
+		{"updated_at", func(o services.Override) any { return o.UpdatedAt }},
+	},
+	key:         func(o services.Override) string { return o.Target },
+	defaultSort: "target",
+}
+
+// Overrides handles /admin/overrides:
+//   - GET lists overrides with the listing parameters of listSpec, or returns the
+//     one for ?target=
+//   - POST/PUT creates or replaces an override from a JSON Override body
+//   - DELETE ?target= removes an override
+func (h *AdminHandler) Overrides(w http.ResponseWriter, r *http.Request) {
+	if h.overrides == nil {
+		http.Error(w, "Overrides not available", http.StatusServiceUnavailable)
+		return
+	}
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if target := query.Get("target"); target != "" {
+			override, ok := h.overrides.Get(target)
+			if !ok {
+				h.writeJSON(w, http.StatusNotFound, map[string]string{"error": "Override not found"})
+				return
+			}
+			h.writeJSON(w, http.StatusOK, override)
+			return
+		}
+		overrides, page, err := overrideListing.list(h.overrides.List(), query)
+		if err != nil {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		page.link(r, h.absoluteURL)
+		h.writeJSON(w, http.StatusOK, overridesResponse{Overrides: overrides, Pagination: page})
+	case http.MethodPost, http.MethodPut:
+		var req services.Override
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&req); err != nil {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Request body must be a JSON override"})
+			return
+		}
+		req.UpdatedAt = time.Time{}
+
+		before, existed := h.overrides.Get(req.Target)
+		override, err := h.overrides.Set(req)
+		if err != nil {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		h.logger.Info("✏️ Override set",
+			"target", override.Target,
+			"country", override.Country,
+			"city", override.City,
+		)
+		if existed {
+			h.record(r, "override.set", override.Target, before, override)
+		} else {
+			h.record(r, "override.set", override.Target, nil, override)
+		}
+		h.writeJSON(w, http.StatusOK, override)
+	case http.MethodDelete:
+		target := query.Get("target")
+		before, _ := h.overrides.Get(target)
+		if err := h.overrides.Delete(target); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, services.ErrOverrideNotFound) {
+				status = http.StatusNotFound
+			}
+			h.writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+
+		h.logger.Info("✏️ Override deleted", "target", target)
+		h.record(r, "override.delete", before.Target, before, nil)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+}
+
+// auditResponse lists audit entries
+type auditResponse struct {
+	Entries    []audit.Entry `json:"entries"`
+	Count      int           `json:"count"`
+	Pagination listPage      `json:"pagination"`
+}
+
+// auditListing lists the entries returned by GET /admin/audit
+var auditListing = listSpec[audit.Entry]{
+	fields: []listField[audit.Entry]{
+		{"seq", func(e audit.Entry) any { return e.Seq }},
+		{"time", func(e audit.Entry) any { return e.Time }},
+		{"actor", func(e audit.Entry) any { return e.Actor }},
+		{"action", func(e audit.Entry) any { return e.Action }},
+		{"target", func(e audit.Entry) any { return e.Target }},
+	},
+	key:         func(e audit.Entry) string { return strconv.FormatUint(e.Seq, 10) },
+	defaultSort: "-seq",
+}
+
+// Audit handles GET /admin/audit, returning audit entries newest first. Besides the
+// listing parameters of listSpec, since and until (RFC 3339) bound the entry times.
+// GET /admin/audit/verify checks the log's hash chain.
+func (h *AdminHandler) Audit(w http.ResponseWriter, r *http.Request) {
+	if h.audit == nil {
+		http.Error(w, "Audit log not available", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	if r.URL.Path == "/admin/audit/verify" {
+		count, err := h.audit.Verify()
+		if err != nil {
+			h.writeJSON(w, http.StatusConflict, map[string]interface{}{"valid": false, "error": err.Error()})
+			return
+		}
+		h.writeJSON(w, http.StatusOK, map[string]interface{}{"valid": true, "entries": count})
+		return
+	}
+
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+	var filter audit.Filter
+	var err error
+	if value := query.Get("since"); value != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, value); err != nil {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid since parameter, expected RFC 3339"})
+			return
+		}
+	}
+	if value := query.Get("until"); value != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, value); err != nil {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid until parameter, expected RFC 3339"})
+			return
+		}
+	}
+
+	entries, page, err := auditListing.list(h.audit.Query(filter), query)
+	if err != nil {
+		h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	page.link(r, h.absoluteURL)
+	h.writeJSON(w, http.StatusOK, auditResponse{Entries: entries, Count: len(entries), Pagination: page})
+}
+
+// logLevelState is the body returned and accepted by /admin/log-level
+type logLevelState struct {
+	Level      string `json:"level"`
+	SampleRate int    `json:"sample_rate,omitempty"`
+}
+
+// logLevelRequest is the body accepted by PUT /admin/log-level
+type logLevelRequest struct {
+	Level      string `json:"level"`
+	SampleRate *int   `json:"sample_rate"`
+}
+
+// LogLevel handles GET (inspect) and PUT/POST (change) on /admin/log-level
+func (h *AdminHandler) LogLevel(w http.ResponseWriter, r *http.Request) {
+	if h.logLevel == nil {
+		http.Error(w, "Log level control not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var req logLevelRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&req); err != nil || (req.Level == "" && req.SampleRate == nil) {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": `Request body must be JSON with a "level" or "sample_rate" field`})
+			return
+		}
+
+		level := h.logLevel.Level()
+		if req.Level != "" {
+			var ok bool
+			if level, ok = parseLogLevel(req.Level); !ok {
+				h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid level, must be one of: debug, info, warn, error"})
+				return
+			}
+		}
+		if req.SampleRate != nil && (*req.SampleRate < 1 || h.logSampler == nil) {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid sample_rate, must be at least 1"})
+			return
+		}
+
+		before := h.logLevelState()
+		h.logLevel.Set(level)
+		if req.SampleRate != nil {
+			h.logSampler.SetRate(*req.SampleRate)
+		}
+		after := h.logLevelState()
+		h.record(r, "log_level.update", "", before, after)
+
+		h.logger.Warn("📝 Log level changed", "level", after.Level, "sample_rate", after.SampleRate)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, h.logLevelState())
+}
+
+func (h *AdminHandler) logLevelState() logLevelState {
+	state := logLevelState{Level: strings.ToLower(h.logLevel.Level().String())}
+	if h.logSampler != nil {
+		state.SampleRate = h.logSampler.Rate()
+	}
+	return state
+}
+
+// parseLogLevel parses one of the configurable log levels
+func parseLogLevel(value string) (slog.Level, bool) {
+	switch strings.ToLower(value) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "info":
+		return slog.LevelInfo, true
+	case "warn":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	default:
+		return 0, false
+	}
+}
+
+// flagsResponse is the body returned by /admin/flags
+type flagsResponse struct {
+	Flags []flags.State `json:"flags"`
+}
+
+// flagRequest is the body accepted by PUT /admin/flags; a null enabled clears the
+// runtime override
+type flagRequest struct {
+	Name    string `json:"name"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// Flags handles GET (list) and PUT/POST (override at runtime) on /admin/flags
+func (h *AdminHandler) Flags(w http.ResponseWriter, r *http.Request) {
+	if h.flags == nil {
+		http.Error(w, "Feature flags not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var req flagRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&req); err != nil || req.Name == "" {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": `Request body must be JSON with a "name" field`})
+			return
+		}
+		before, ok := h.flags.State(req.Name)
+		if !ok {
+			h.writeJSON(w, http.StatusNotFound, map[string]string{"error": "Unknown feature flag"})
+			return
+		}
+
+		action := "flag.override"
+		if req.Enabled != nil {
+			h.flags.Override(req.Name, *req.Enabled)
+		} else {
+			action = "flag.clear_override"
+			h.flags.ClearOverride(req.Name)
+		}
+		after, _ := h.flags.State(req.Name)
+		h.record(r, action, req.Name, before, after)
+
+		h.logger.Warn("🚩 Feature flag changed",
+			"flag", req.Name,
+			"enabled", after.Enabled,
+			"source", after.Source,
+			"remote_addr", r.RemoteAddr,
+		)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, flagsResponse{Flags: h.flags.States()})
+}
+
+// defaultMissesLimit is how many prefixes /admin/misses lists by default
+const defaultMissesLimit = 50
+
+// missesResponse is the body returned by GET /admin/misses
+type missesResponse struct {
+	Lookups  uint64                  `json:"lookups"`
+	Misses   uint64                  `json:"misses"`
+	MissRate float64                 `json:"miss_rate"`
+	Tracked  int                     `json:"tracked_prefixes"`
+	Capacity int                     `json:"capacity"`
+	Prefixes []services.PrefixMisses `json:"prefixes"`
+}
+
+// Misses handles GET on /admin/misses, listing the network prefixes whose lookups
+// most often find no location
+func (h *AdminHandler) Misses(w http.ResponseWriter, r *http.Request) {
+	if h.misses == nil {
+		http.Error(w, "Miss tracking not available", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultMissesLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > h.misses.Capacity() {
+			h.writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "limit must be between 1 and " + strconv.Itoa(h.misses.Capacity()),
+			})
+			return
+		}
+		limit = n
+	}
+
+	lookups, misses := h.misses.Totals()
+	resp := missesResponse{Lookups: lookups, Misses: misses, Capacity: h.misses.Capacity()}
+	if lookups > 0 {
+		resp.MissRate = float64(misses) / float64(lookups)
+	}
+	all := h.misses.Top(-1)
+	resp.Tracked = len(all)
+	resp.Prefixes = all[:min(limit, len(all))]
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// locationsResponse lists the records of a dataset
+type locationsResponse struct {
+	Dataset    string          `json:"dataset"`
+	Version    string          `json:"version,omitempty"`
+	Locations  []locationEntry `json:"locations"`
+	Pagination listPage        `json:"pagination"`
+}
+
+// locationEntry is one address of a dataset and its location
+type locationEntry struct {
+	IP string `json:"ip"`
+	models.Location
+}
+
+// locationListing lists the records returned by GET /admin/locations
+var locationListing = listSpec[repository.Record]{
+	fields: []listField[repository.Record]{
+		{"ip", func(r repository.Record) any { addr, _ := netip.ParseAddr(r.IP); return addr }},
+		{"country", func(r repository.Record) any { return r.Location.Country }},
+		{"country_code", func(r repository.Record) any { return r.Location.CountryCode }},
+		{"city", func(r repository.Record) any { return r.Location.City }},
+		{"continent", func(r repository.Record) any { return r.Location.Continent }},
+	},
+	key:         func(r repository.Record) string { return r.IP },
+	defaultSort: "ip",
+}
+
+// Locations handles GET on /admin/locations, listing the addresses of ?dataset= (the
+// default dataset when unset) and their locations with the listing parameters of listSpec
+func (h *AdminHandler) Locations(w http.ResponseWriter, r *http.Request) {
+	if h.datasets == nil {
+		http.Error(w, "Datasets not available", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+	info, records, err := h.datasets.Records(query.Get("dataset"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrUnknownDataset):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrListingUnsupported):
+			status = http.StatusNotImplemented
+		}
+		h.writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+
+	page, pagination, err := locationListing.list(records, query)
+	if err != nil {
+		h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	pagination.link(r, h.absoluteURL)
+	locations := make([]locationEntry, len(page))
+	for i, record := range page {
+		locations[i] = locationEntry{IP: record.IP, Location: record.Location}
+	}
+	h.writeJSON(w, http.StatusOK, locationsResponse{
+		Dataset:    info.Name,
+		Version:    info.Version,
+		Locations:  locations,
+		Pagination: pagination,
+	})
+}
+
+// record appends an admin mutation to the audit log, if one is configured
+func (h *AdminHandler) record(r *http.Request, action, target string, before, after interface{}) {
+	if h.audit == nil {
+		return
+	}
+
+	actor := middleware.AdminActorFromContext(r.Context())
+	remoteAddr := r.RemoteAddr
+	if h.privacyMode {
+		remoteAddr = privacy.AnonymizeIP(remoteAddr)
+	}
+	if _, err := h.audit.Record(actor, remoteAddr, action, target, before, after); err != nil {
+		h.logger.Error("Failed to write audit entry", "action", action, "target", target, "error", err)
+	}
+}
+
+// absoluteURL returns the URL clients use to reach path, as Router.absoluteURL does
+func (h *AdminHandler) absoluteURL(r *http.Request, path string, query url.Values) string {
+	return h.proxies.AbsoluteURL(r, requestcontext.BasePath(r.Context())+path, query)
+}
+
+// writeJSON writes v as an indented JSON response
+func (h *AdminHandler) writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(jsonData)
+}
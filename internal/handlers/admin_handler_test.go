@@ -0,0 +1,538 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/audit"
+	"ip-geolocation-service/internal/flags"
+	"ip-geolocation-service/internal/middleware"
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/services"
+)
+
+func TestAdminHandler_Maintenance(t *testing.T) {
+	mode := middleware.NewMaintenanceMode(false, "")
+	handler := NewAdminHandler(AdminOptions{Maintenance: mode}, slog.Default())
+
+	req := httptest.NewRequest("PUT", "/admin/maintenance", strings.NewReader(`{"enabled": true, "message": "Swapping datasets"}`))
+	w := httptest.NewRecorder()
+	handler.Maintenance(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Maintenance() status = %v, want %v", w.Code, http.StatusOK)
+	}
+	if state := mode.State(); !state.Enabled || state.Message != "Swapping datasets" {
+		t.Errorf("Maintenance() state = %+v, want enabled with message", state)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/maintenance", nil)
+	w = httptest.NewRecorder()
+	handler.Maintenance(w, req)
+
+	if !strings.Contains(w.Body.String(), `"enabled": true`) {
+		t.Errorf("Maintenance() body = %v, want enabled state", w.Body.String())
+	}
+
+	req = httptest.NewRequest("PUT", "/admin/maintenance", strings.NewReader(`{"enabled": false}`))
+	w = httptest.NewRecorder()
+	handler.Maintenance(w, req)
+
+	if mode.State().Enabled {
+		t.Error("Maintenance() did not disable maintenance mode")
+	}
+}
+
+func TestAdminHandler_Maintenance_InvalidRequests(t *testing.T) {
+	handler := NewAdminHandler(AdminOptions{Maintenance: middleware.NewMaintenanceMode(false, "")}, slog.Default())
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"invalid JSON", "PUT", "{", http.StatusBadRequest},
+		{"missing enabled", "PUT", `{"message": "hi"}`, http.StatusBadRequest},
+		{"wrong method", "DELETE", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/admin/maintenance", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		handler.Maintenance(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %v, want %v", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestAdminHandler_LogLevel(t *testing.T) {
+	level := new(slog.LevelVar)
+	sampler := middleware.NewLogSampler(1)
+	auditLog, _ := audit.NewLog("")
+	handler := NewAdminHandler(AdminOptions{LogLevel: level, LogSampler: sampler, Audit: auditLog}, slog.Default())
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"inspect", "GET", "", http.StatusOK},
+		{"change level", "PUT", `{"level": "DEBUG"}`, http.StatusOK},
+		{"change sample rate", "PUT", `{"sample_rate": 100}`, http.StatusOK},
+		{"invalid level", "PUT", `{"level": "verbose"}`, http.StatusBadRequest},
+		{"invalid sample rate", "PUT", `{"sample_rate": 0}`, http.StatusBadRequest},
+		{"empty body", "PUT", `{}`, http.StatusBadRequest},
+		{"wrong method", "DELETE", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/admin/log-level", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		handler.LogLevel(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %v, want %v (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	if level.Level() != slog.LevelDebug || sampler.Rate() != 100 {
+		t.Errorf("Expected level debug and rate 100, got %v and %d", level.Level(), sampler.Rate())
+	}
+	if entries := auditLog.Query(audit.Filter{Action: "log_level.update"}); len(entries) != 2 {
+		t.Errorf("Expected 2 audited log level changes, got %d", len(entries))
+	}
+}
+
+func TestAdminHandler_Flags(t *testing.T) {
+	featureFlags, err := flags.New(nil, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog, _ := audit.NewLog("")
+	handler := NewAdminHandler(AdminOptions{Flags: featureFlags, Audit: auditLog}, slog.Default())
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"inspect", "GET", "", http.StatusOK},
+		{"override", "PUT", `{"name": "debug_endpoints", "enabled": false}`, http.StatusOK},
+		{"override anonymizer detection", "POST", `{"name": "anonymizer_detection", "enabled": false}`, http.StatusOK},
+		{"clear override", "PUT", `{"name": "anonymizer_detection", "enabled": null}`, http.StatusOK},
+		{"unknown flag", "PUT", `{"name": "jsonp", "enabled": true}`, http.StatusNotFound},
+		{"missing name", "PUT", `{"enabled": true}`, http.StatusBadRequest},
+		{"wrong method", "DELETE", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/admin/flags", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		handler.Flags(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %v, want %v (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	if featureFlags.Enabled(flags.DebugEndpoints) || !featureFlags.Enabled(flags.AnonymizerDetection) {
+		t.Errorf("Expected debug endpoints off and anonymizer detection back on, got %+v", featureFlags.States())
+	}
+	if entries := auditLog.Query(audit.Filter{Action: "flag.override"}); len(entries) != 2 {
+		t.Errorf("Expected 2 audited overrides, got %d", len(entries))
+	}
+
+	// The listing reports where each value comes from
+	req := httptest.NewRequest("GET", "/admin/flags", nil)
+	w := httptest.NewRecorder()
+	handler.Flags(w, req)
+	if !strings.Contains(w.Body.String(), `"source": "override"`) {
+		t.Errorf("Expected an overridden flag in %s", w.Body.String())
+	}
+}
+
+func TestRouter_DebugEndpointsFlag(t *testing.T) {
+	featureFlags, _ := flags.New(map[string]string{flags.DebugEndpoints: "false"}, "", 0)
+	router := NewRouterWithOptions(NewMockIPService(), slog.Default(), RouterOptions{
+		RateLimiter: middleware.NewRateLimiter(100, 200, 1, time.Minute, 5*time.Minute),
+		Flags:       featureFlags,
+	})
+	mux := router.SetupRoutes()
+
+	for _, path := range []string{"/debug/rate-limiter", "/debug/lookup-stats", "/debug/runtime"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d with the flag off, want 404", path, w.Code)
+		}
+	}
+
+	featureFlags.Override(flags.DebugEndpoints, true)
+	req := httptest.NewRequest("GET", "/debug/rate-limiter", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected /debug/rate-limiter served once enabled, got %d", w.Code)
+	}
+}
+
+func TestAdminHandler_Misses(t *testing.T) {
+	tracker := services.NewMissTracker(5)
+	tracker.Record(netip.MustParseAddr("203.0.113.7"), false)
+	tracker.Record(netip.MustParseAddr("203.0.113.8"), false)
+	tracker.Record(netip.MustParseAddr("198.51.100.1"), false)
+	tracker.Record(netip.MustParseAddr("8.8.8.8"), true)
+	handler := NewAdminHandler(AdminOptions{Misses: tracker}, slog.Default())
+
+	req := httptest.NewRequest("GET", "/admin/misses?limit=1", nil)
+	w := httptest.NewRecorder()
+	handler.Misses(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %v, want 200 (%s)", w.Code, w.Body.String())
+	}
+
+	var resp missesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if resp.Lookups != 4 || resp.Misses != 3 || resp.MissRate != 0.75 || resp.Tracked != 2 || resp.Capacity != 5 {
+		t.Errorf("Response = %+v", resp)
+	}
+	if len(resp.Prefixes) != 1 || resp.Prefixes[0].Prefix.String() != "203.0.113.0/24" || resp.Prefixes[0].Misses != 2 {
+		t.Errorf("Prefixes = %+v, want 203.0.113.0/24 only", resp.Prefixes)
+	}
+	if strings.Contains(w.Body.String(), "203.0.113.7") {
+		t.Error("Expected addresses to be aggregated to prefixes")
+	}
+
+	for _, tc := range []struct {
+		method, target string
+		want           int
+	}{
+		{"GET", "/admin/misses?limit=0", http.StatusBadRequest},
+		{"GET", "/admin/misses?limit=6", http.StatusBadRequest},
+		{"POST", "/admin/misses", http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		handler.Misses(w, httptest.NewRequest(tc.method, tc.target, nil))
+		if w.Code != tc.want {
+			t.Errorf("%s %s: status = %v, want %v", tc.method, tc.target, w.Code, tc.want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	NewAdminHandler(AdminOptions{}, slog.Default()).Misses(w, httptest.NewRequest("GET", "/admin/misses", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Without a tracker: status = %v, want 503", w.Code)
+	}
+}
+
+func TestRouter_MaintenanceMode(t *testing.T) {
+	mode := middleware.NewMaintenanceMode(true, "")
+	router := NewRouterWithOptions(NewMockIPService(), slog.Default(), RouterOptions{
+		Maintenance: mode,
+		AdminToken:  "secret",
+	})
+	handler := router.SetupRoutesWithMiddleware(middleware.NewRateLimiter(100, 200, 1, time.Minute, 5*time.Minute))
+
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Public endpoint status = %v, want %v", w.Code, http.StatusServiceUnavailable)
+	}
+
+	req = httptest.NewRequest("GET", "/health", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Health status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	req = httptest.NewRequest("PUT", "/admin/maintenance", strings.NewReader(`{"enabled": false}`))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Unauthenticated admin status = %v, want %v", w.Code, http.StatusUnauthorized)
+	}
+
+	req = httptest.NewRequest("PUT", "/admin/maintenance", strings.NewReader(`{"enabled": false}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || mode.State().Enabled {
+		t.Errorf("Admin toggle status = %v, enabled = %v", w.Code, mode.State().Enabled)
+	}
+}
+
+func TestAdminHandler_Datasets(t *testing.T) {
+	loader := func(ctx context.Context, name, source string) (services.IPService, func() error, error) {
+		if source == "missing.csv" {
+			return nil, nil, errors.New("file not found")
+		}
+		return NewMockIPService(), nil, nil
+	}
+	datasets := services.NewDatasetService("default", loader)
+	datasets.Add("default", "default.csv", NewMockIPService(), nil)
+	handler := NewAdminHandler(AdminOptions{Datasets: datasets}, slog.Default())
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"load", "POST", "/admin/datasets", `{"name": "free", "source": "free.csv"}`, http.StatusOK},
+		{"load failure", "POST", "/admin/datasets", `{"name": "bad", "source": "missing.csv"}`, http.StatusUnprocessableEntity},
+		{"load without source", "POST", "/admin/datasets", `{"name": "free"}`, http.StatusBadRequest},
+		{"switch default", "PUT", "/admin/datasets", `{"name": "free", "default": true}`, http.StatusOK},
+		{"switch to unknown", "PUT", "/admin/datasets", `{"name": "nope", "default": true}`, http.StatusNotFound},
+		{"remove default", "DELETE", "/admin/datasets?name=free", "", http.StatusBadRequest},
+		{"remove", "DELETE", "/admin/datasets?name=default", "", http.StatusOK},
+		{"remove unknown", "DELETE", "/admin/datasets?name=default", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		handler.Datasets(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %v, want %v (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	if datasets.Default() != "free" || datasets.Has("default") {
+		t.Errorf("Datasets() left default=%s, datasets=%+v", datasets.Default(), datasets.List())
+	}
+}
+
+func TestAdminHandler_Compare(t *testing.T) {
+	current := services.NewMockRepository()
+	current.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	next := services.NewMockRepository()
+	next.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "San Jose"})
+
+	datasets := services.NewDatasetService("default", nil)
+	datasets.Add("default", "default.csv", services.NewIPService(current), nil)
+	datasets.Add("next", "next.csv", services.NewIPService(next), nil)
+	handler := NewAdminHandler(AdminOptions{Datasets: datasets}, slog.Default())
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"compare with default", "GET", "/admin/compare?b=next&sample=10", http.StatusOK},
+		{"missing b", "GET", "/admin/compare?a=default", http.StatusBadRequest},
+		{"same dataset", "GET", "/admin/compare?a=next&b=next", http.StatusBadRequest},
+		{"invalid sample", "GET", "/admin/compare?b=next&sample=lots", http.StatusBadRequest},
+		{"sample too large", "GET", "/admin/compare?b=next&sample=1000000", http.StatusBadRequest},
+		{"unknown dataset", "GET", "/admin/compare?b=missing", http.StatusNotFound},
+		{"wrong method", "POST", "/admin/compare?b=next", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.Compare(w, httptest.NewRequest(tt.method, tt.target, nil))
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %v, want %v (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+		if tt.want == http.StatusOK && !strings.Contains(w.Body.String(), `"city_changed": 1`) {
+			t.Errorf("%s: body = %s, want one city change", tt.name, w.Body.String())
+		}
+	}
+}
+
+func TestAdminHandler_Import(t *testing.T) {
+	datasets := services.NewDatasetService("default", nil)
+	datasets.Add("default", "default.csv", services.NewIPService(services.NewMockRepository()), nil)
+	handler := NewAdminHandler(AdminOptions{Datasets: datasets}, slog.Default())
+
+	valid := "ip,city,country\n8.8.8.8,Mountain View,United States\n"
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"dry run", "POST", "/admin/import?dry_run=true", valid, http.StatusOK},
+		{"dry run of invalid data", "POST", "/admin/import?dry_run=1", "ip,city,country\n8.8.8.8,Mountain View\n", http.StatusUnprocessableEntity},
+		{"read-only dataset", "POST", "/admin/import", valid, http.StatusConflict},
+		{"unknown dataset", "POST", "/admin/import?dataset=missing&dry_run=true", valid, http.StatusNotFound},
+		{"invalid dry_run", "POST", "/admin/import?dry_run=maybe", valid, http.StatusBadRequest},
+		{"wrong method", "GET", "/admin/import", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.Import(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %v, want %v (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+		if tt.want == http.StatusOK && !strings.Contains(w.Body.String(), `"record_delta": 1`) {
+			t.Errorf("%s: body = %s, want a record delta of 1", tt.name, w.Body.String())
+		}
+	}
+}
+
+func TestAdminHandler_Overrides(t *testing.T) {
+	store := services.NewOverrideStore("")
+	handler := NewAdminHandler(AdminOptions{Overrides: store}, slog.Default())
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"create", "POST", "/admin/overrides", `{"target": "8.8.8.8", "country": "Corrected", "city": "Fixed", "reason": "ticket 42"}`, http.StatusOK},
+		{"create range", "PUT", "/admin/overrides", `{"target": "9.9.0.0/16", "country": "Range", "city": "Any"}`, http.StatusOK},
+		{"invalid target", "POST", "/admin/overrides", `{"target": "nope", "country": "X", "city": "Y"}`, http.StatusBadRequest},
+		{"invalid body", "POST", "/admin/overrides", `{`, http.StatusBadRequest},
+		{"get", "GET", "/admin/overrides?target=8.8.8.8", "", http.StatusOK},
+		{"get missing", "GET", "/admin/overrides?target=1.1.1.1", "", http.StatusNotFound},
+		{"list", "GET", "/admin/overrides", "", http.StatusOK},
+		{"delete", "DELETE", "/admin/overrides?target=9.9.0.0/16", "", http.StatusNoContent},
+		{"delete missing", "DELETE", "/admin/overrides?target=9.9.0.0/16", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		handler.Overrides(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %v, want %v (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	if store.Len() != 1 {
+		t.Errorf("Overrides() left %d overrides, want 1", store.Len())
+	}
+}
+
+func TestAdminHandler_Locations(t *testing.T) {
+	repo := services.NewMockRepository()
+	repo.SetLocation("10.0.0.1", &models.Location{Country: "Israel", City: "Tel Aviv", CountryCode: "IL"})
+	repo.SetLocation("9.9.9.9", &models.Location{Country: "Switzerland", City: "Zurich", CountryCode: "CH"})
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View", CountryCode: "US"})
+	datasets := services.NewDatasetService("default", nil)
+	datasets.Add("default", "default.csv", services.NewIPService(repo), nil)
+	datasets.Add("opaque", "opaque", NewMockIPService(), nil)
+	handler := NewAdminHandler(AdminOptions{Datasets: datasets}, slog.Default())
+
+	w := httptest.NewRecorder()
+	handler.Locations(w, httptest.NewRequest("GET", "/admin/locations?limit=2", nil))
+	var response struct {
+		Dataset   string `json:"dataset"`
+		Locations []struct {
+			IP      string `json:"ip"`
+			Country string `json:"country"`
+		} `json:"locations"`
+		Pagination listPage `json:"pagination"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Locations() returned invalid JSON: %v", err)
+	}
+	// Addresses sort numerically, so 8.8.8.8 comes before 10.0.0.1
+	if response.Dataset != "default" || len(response.Locations) != 2 || response.Locations[0].IP != "8.8.8.8" || response.Locations[1].IP != "9.9.9.9" {
+		t.Errorf("Locations() = %+v", response)
+	}
+	if response.Pagination.Total != 3 || response.Pagination.NextCursor == "" {
+		t.Errorf("Locations() pagination = %+v", response.Pagination)
+	}
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/admin/locations?country_code=il", http.StatusOK},
+		{"/admin/locations?sort=-city", http.StatusOK},
+		{"/admin/locations?sort=latitude", http.StatusBadRequest},
+		{"/admin/locations?dataset=missing", http.StatusNotFound},
+		{"/admin/locations?dataset=opaque", http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.Locations(w, httptest.NewRequest("GET", tt.target, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %v, want %v (%s)", tt.target, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
+
+func TestAdminHandler_AuditRecordsMutations(t *testing.T) {
+	auditLog, _ := audit.NewLog("")
+	handler := NewAdminHandler(AdminOptions{
+		Maintenance: middleware.NewMaintenanceMode(false, ""),
+		Overrides:   services.NewOverrideStore(""),
+		Audit:       auditLog,
+	}, slog.Default())
+
+	handler.Maintenance(httptest.NewRecorder(), httptest.NewRequest("PUT", "/admin/maintenance", strings.NewReader(`{"enabled": true}`)))
+	handler.Overrides(httptest.NewRecorder(), httptest.NewRequest("POST", "/admin/overrides", strings.NewReader(`{"target": "8.8.8.8", "country": "X", "city": "Y"}`)))
+	handler.Overrides(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/admin/overrides?target=8.8.8.8", nil))
+
+	// Reads and failed mutations are not audited
+	handler.Maintenance(httptest.NewRecorder(), httptest.NewRequest("GET", "/admin/maintenance", nil))
+	handler.Overrides(httptest.NewRecorder(), httptest.NewRequest("POST", "/admin/overrides", strings.NewReader(`{"target": "bad"}`)))
+
+	req := httptest.NewRequest("GET", "/admin/audit?target=8.8.8.8", nil)
+	w := httptest.NewRecorder()
+	handler.Audit(w, req)
+
+	var response struct {
+		Entries []audit.Entry `json:"entries"`
+		Count   int           `json:"count"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Audit() returned invalid JSON: %v", err)
+	}
+	if response.Count != 2 || response.Entries[0].Action != "override.delete" || response.Entries[1].Action != "override.set" {
+		t.Errorf("Audit() entries = %+v", response.Entries)
+	}
+	if response.Entries[0].Actor != middleware.AdminActorAnonymous || len(response.Entries[0].Before) == 0 {
+		t.Errorf("Audit() entry missing actor or before state: %+v", response.Entries[0])
+	}
+	if got := auditLog.Query(audit.Filter{}); len(got) != 3 {
+		t.Errorf("Audit log has %d entries, want 3", len(got))
+	}
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/admin/audit/verify", http.StatusOK},
+		{"/admin/audit?since=yesterday", http.StatusBadRequest},
+		{"/admin/audit?limit=0", http.StatusBadRequest},
+		{"/admin/audit?sort=remote_addr", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.Audit(w, httptest.NewRequest("GET", tt.target, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %v, want %v", tt.target, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sync"
+
+	"ip-geolocation-service/internal/models"
+)
+
+// ContentTypeNDJSON selects streaming batch lookups: one JSON value per line in both
+// the request and the response
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// Batch defaults
+const (
+	DefaultBatchMaxIPs       = 1000
+	DefaultBatchMaxStreamIPs = 100_000
+	DefaultBatchConcurrency  = 8
+
+	// maxBatchLineBytes bounds one NDJSON request line, and the request body per
+	// address for JSON requests
+	maxBatchLineBytes = 1024
+)
+
+// errBatchTooLarge ends an NDJSON request that exceeds its address limit
+var errBatchTooLarge = errors.New("batch too large")
+
+// BatchOptions bounds POST /v1/batch; zero values use the defaults
+type BatchOptions struct {
+	MaxIPs       int // Addresses accepted in a JSON request (default 1000)
+	MaxStreamIPs int // Addresses accepted in an NDJSON request (default 100,000)
+	Concurrency  int // Lookups in flight per request (default 8)
+}
+
+// withDefaults fills unset limits with the defaults
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.MaxIPs <= 0 {
+		o.MaxIPs = DefaultBatchMaxIPs
+	}
+	if o.MaxStreamIPs <= 0 {
+		o.MaxStreamIPs = DefaultBatchMaxStreamIPs
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultBatchConcurrency
+	}
+	return o
+}
+
+// batchRequest is the body of a JSON batch request
+type batchRequest struct {
+	IPs []string `json:"ips"`
+}
+
+// batchLine is one line of an NDJSON batch request
+type batchLine struct {
+	IP string `json:"ip"`
+}
+
+// batchResponse is the body of a JSON batch response
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// batchResult is the answer for one address. Failed lookups carry the status, error
+// and code a single lookup of the address would have returned.
+type batchResult struct {
+	Index    int              `json:"index"` // Position of the address in the request
+	IP       string           `json:"ip"`
+	Location *models.Location `json:"location,omitempty"`
+	Status   int              `json:"status,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Code     string           `json:"code,omitempty"`
+}
+
+// batchJob is an address waiting to be looked up; err is set when its request line
+// couldn't be decoded
+type batchJob struct {
+	index int
+	ip    string
+	err   error
+}
+
+// Batch handles POST /v1/batch requests, looking up many addresses at once. A JSON
+// body ({"ips": [...]}) is answered with every result, in request order. An NDJSON
+// body (one {"ip": ...} object per line) is answered with one NDJSON result per
+// address, streamed as lookups complete so neither side buffers the whole batch.
+func (h *IPHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		h.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, ok := h.datasetContext(r)
+	if !ok {
+		h.sendDatasetForbidden(w)
+		return
+	}
+
+	mediaType := "application/json"
+	if value := r.Header.Get("Content-Type"); value != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(value); err != nil {
+			h.sendError(w, "Invalid Content-Type", http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	switch mediaType {
+	case "application/json":
+		h.batchJSON(ctx, w, r)
+	case ContentTypeNDJSON:
+		h.batchStream(ctx, w, r)
+	default:
+		h.sendError(w, "Batch requests must be application/json or "+ContentTypeNDJSON, http.StatusUnsupportedMediaType)
+	}
+}
+
+// batchJSON answers a JSON batch request once every lookup has finished
+func (h *IPHandler) batchJSON(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, int64(h.batch.MaxIPs)*maxBatchLineBytes)
+	var req batchRequest
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.sendBatchTooLarge(w)
+			return
+		}
+		h.sendError(w, "Invalid batch request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.IPs) == 0 {
+		h.sendError(w, "Batch must contain at least one IP address", http.StatusBadRequest)
+		return
+	}
+	if len(req.IPs) > h.batch.MaxIPs {
+		h.sendBatchTooLarge(w)
+		return
+	}
+
+	results := make([]batchResult, len(req.IPs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(h.batch.Concurrency, len(req.IPs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = h.lookupBatchItem(ctx, batchJob{index: i, ip: req.IPs[i]})
+			}
+		}()
+	}
+	for i := range req.IPs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	h.sendJSON(w, batchResponse{Results: results})
+}
+
+// batchStream answers an NDJSON batch request, reading addresses and writing results
+// concurrently. Problems that end the stream early (a timeout, too many addresses, an
+// unreadable body) are reported by a final {"error", "code"} line.
+func (h *IPHandler) batchStream(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// HTTP/1.x closes the request body once the response starts unless the
+	// connection is switched to full duplex; HTTP/2 always is
+	rc := http.NewResponseController(w)
+	rc.EnableFullDuplex()
+
+	jobs := make(chan batchJob)
+	var readErr error // Set before jobs is closed
+	go func() {
+		defer close(jobs)
+
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 0, maxBatchLineBytes), maxBatchLineBytes)
+		index := 0
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if index >= h.batch.MaxStreamIPs {
+				readErr = errBatchTooLarge
+				return
+			}
+
+			job := batchJob{index: index}
+			var item batchLine
+			if err := json.Unmarshal(line, &item); err != nil {
+				job.err = err
+			}
+			job.ip = item.IP
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+			index++
+		}
+		readErr = scanner.Err()
+	}()
+
+	results := make(chan batchResult, h.batch.Concurrency)
+	var wg sync.WaitGroup
+	for range h.batch.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				// Stop on cancellation even while the reader waits on a slow client
+				var job batchJob
+				select {
+				case next, ok := <-jobs:
+					if !ok {
+						return
+					}
+					job = next
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case results <- h.lookupBatchItem(ctx, job):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	w.Header().Set("Content-Type", ContentTypeNDJSON)
+	w.WriteHeader(http.StatusOK)
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+	var writeErr error
+	for result := range results {
+		if writeErr != nil {
+			continue // The client is gone; drain until the workers stop
+		}
+		writeErr = encoder.Encode(result)
+		// Flush whenever no other result is ready, so results reach the client as
+		// they complete without a flush per line under load
+		if writeErr == nil && len(results) == 0 {
+			if writeErr = out.Flush(); writeErr == nil {
+				rc.Flush()
+			}
+		}
+		if writeErr != nil {
+			cancel()
+		}
+	}
+	if writeErr != nil {
+		return
+	}
+
+	// readErr is only read once the reader is known to have finished: the workers
+	// stop early only on cancellation
+	var trailer *models.ErrorResponse
+	switch {
+	case ctx.Err() != nil:
+		trailer = models.NewErrorResponseWithCode("Request timed out", "request_timeout")
+	case errors.Is(readErr, errBatchTooLarge):
+		trailer = models.NewErrorResponseWithCode(fmt.Sprintf("Batch exceeds %d addresses", h.batch.MaxStreamIPs), "batch_too_large")
+	case errors.Is(readErr, bufio.ErrTooLong):
+		trailer = models.NewErrorResponseWithCode(fmt.Sprintf("Batch line exceeds %d bytes", maxBatchLineBytes), "batch_line_too_long")
+	case readErr != nil:
+		trailer = models.NewErrorResponseWithCode("Failed to read batch request body", "invalid_request_body")
+	}
+	if trailer != nil {
+		encoder.Encode(trailer)
+	}
+	if out.Flush() == nil {
+		rc.Flush()
+	}
+}
+
+// lookupBatchItem looks up one address of a batch
+func (h *IPHandler) lookupBatchItem(ctx context.Context, job batchJob) batchResult {
+	result := batchResult{Index: job.index, IP: job.ip}
+	if job.err != nil {
+		result.Status, result.Error, result.Code = http.StatusBadRequest, "Invalid batch line", "invalid_batch_line"
+		return result
+	}
+
+	addr, err := h.parseIP(job.ip)
+	if err != nil {
+		result.Status, result.Error, result.Code = lookupError(err)
+		return result
+	}
+	location, err := h.findLocation(ctx, addr)
+	if err != nil {
+		result.Status, result.Error, result.Code = lookupError(err)
+		return result
+	}
+	result.Location = location
+	return result
+}
+
+// sendBatchTooLarge rejects a JSON batch over the address limit
+func (h *IPHandler) sendBatchTooLarge(w http.ResponseWriter) {
+	h.sendErrorWithCode(w, fmt.Sprintf("Batch exceeds %d addresses", h.batch.MaxIPs), "batch_too_large", http.StatusRequestEntityTooLarge)
+}
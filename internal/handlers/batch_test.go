@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/middleware"
+	"ip-geolocation-service/internal/models"
+)
+
+func newBatchTestHandler() *IPHandler {
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	service.SetLocation("1.1.1.1", &models.Location{Country: "Australia", City: "Sydney"})
+	return NewIPHandler(service, slog.Default())
+}
+
+// readNDJSON decodes every line of an NDJSON body into maps
+func readNDJSON(t *testing.T, body io.Reader) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Invalid NDJSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestIPHandler_Batch_JSON(t *testing.T) {
+	handler := newBatchTestHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/batch",
+		strings.NewReader(`{"ips": ["8.8.8.8", "not-an-ip", "9.9.9.9", "1.1.1.1"]}`))
+	w := httptest.NewRecorder()
+	handler.Batch(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Batch() status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var response batchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(response.Results))
+	}
+
+	// Results keep request order, and failures carry the status of a single lookup
+	want := []struct {
+		ip     string
+		city   string
+		status int
+	}{
+		{"8.8.8.8", "Mountain View", 0},
+		{"not-an-ip", "", http.StatusBadRequest},
+		{"9.9.9.9", "", http.StatusNotFound},
+		{"1.1.1.1", "Sydney", 0},
+	}
+	for i, w := range want {
+		result := response.Results[i]
+		if result.Index != i || result.IP != w.ip || result.Status != w.status {
+			t.Errorf("Result %d = %+v, want %s with status %d", i, result, w.ip, w.status)
+		}
+		if w.city != "" && (result.Location == nil || result.Location.City != w.city) {
+			t.Errorf("Result %d location = %+v, want %s", i, result.Location, w.city)
+		}
+	}
+}
+
+func TestIPHandler_Batch_Rejects(t *testing.T) {
+	handler := newBatchTestHandler()
+	handler.batch = BatchOptions{MaxIPs: 2}.withDefaults()
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{"wrong method", http.MethodGet, "", "", http.StatusMethodNotAllowed},
+		{"unsupported content type", http.MethodPost, "text/csv", "8.8.8.8", http.StatusUnsupportedMediaType},
+		{"invalid body", http.MethodPost, "application/json", `{"ips": `, http.StatusBadRequest},
+		{"empty batch", http.MethodPost, "application/json", `{"ips": []}`, http.StatusBadRequest},
+		{"too many addresses", http.MethodPost, "application/json", `{"ips": ["1.1.1.1", "8.8.8.8", "9.9.9.9"]}`, http.StatusRequestEntityTooLarge},
+		{"oversized body", http.MethodPost, "application/json", `{"ips": ["` + strings.Repeat("1", 4*maxBatchLineBytes) + `"]}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v1/batch", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			handler.Batch(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Batch() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestIPHandler_Batch_NDJSON(t *testing.T) {
+	handler := newBatchTestHandler()
+
+	body := "{\"ip\": \"8.8.8.8\"}\n\n{\"ip\": \"9.9.9.9\"}\nnot json\n{\"ip\": \"1.1.1.1\"}\n"
+	req := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", ContentTypeNDJSON+"; charset=utf-8")
+	w := httptest.NewRecorder()
+	handler.Batch(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Batch() status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != ContentTypeNDJSON {
+		t.Errorf("Content-Type = %q, want %q", got, ContentTypeNDJSON)
+	}
+
+	// Results may arrive in any order; blank lines are skipped
+	lines := readNDJSON(t, w.Body)
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 result lines, got %d: %v", len(lines), lines)
+	}
+	byIndex := make(map[int]map[string]any)
+	for _, line := range lines {
+		byIndex[int(line["index"].(float64))] = line
+	}
+	if location, ok := byIndex[0]["location"].(map[string]any); !ok || location["city"] != "Mountain View" {
+		t.Errorf("Result 0 = %v, want Mountain View", byIndex[0])
+	}
+	if byIndex[1]["status"] != float64(http.StatusNotFound) {
+		t.Errorf("Result 1 = %v, want status 404", byIndex[1])
+	}
+	if byIndex[2]["code"] != "invalid_batch_line" {
+		t.Errorf("Result 2 = %v, want invalid_batch_line", byIndex[2])
+	}
+	if byIndex[3]["ip"] != "1.1.1.1" {
+		t.Errorf("Result 3 = %v, want 1.1.1.1", byIndex[3])
+	}
+}
+
+func TestIPHandler_Batch_NDJSONTooLarge(t *testing.T) {
+	handler := newBatchTestHandler()
+	handler.batch = BatchOptions{MaxStreamIPs: 2}.withDefaults()
+
+	body := strings.Repeat("{\"ip\": \"8.8.8.8\"}\n", 3)
+	req := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", ContentTypeNDJSON)
+	w := httptest.NewRecorder()
+	handler.Batch(w, req)
+
+	// The accepted addresses are answered, then a trailer ends the stream
+	lines := readNDJSON(t, w.Body)
+	if len(lines) != 3 {
+		t.Fatalf("Expected 2 results and a trailer, got %v", lines)
+	}
+	if trailer := lines[2]; trailer["code"] != "batch_too_large" {
+		t.Errorf("Trailer = %v, want batch_too_large", trailer)
+	}
+}
+
+func TestIPHandler_Batch_StreamsThroughMiddleware(t *testing.T) {
+	service := NewMockIPService()
+	for i := 1; i <= 3; i++ {
+		service.SetLocation(fmt.Sprintf("10.0.0.%d", i), &models.Location{Country: "Israel", City: fmt.Sprintf("City %d", i)})
+	}
+	router := NewRouterWithOptions(service, slog.Default(), RouterOptions{
+		Timeouts: middleware.TimeoutConfig{Default: 10 * time.Second},
+	})
+	server := httptest.NewServer(router.SetupRoutesWithMiddleware(middleware.NewRateLimiter(100, 200, 1, time.Minute, 5*time.Minute)))
+	defer server.Close()
+
+	// Each result must arrive before the next address is sent
+	bodyReader, bodyWriter := io.Pipe()
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/batch", bodyReader)
+	req.Header.Set("Content-Type", ContentTypeNDJSON)
+
+	type response struct {
+		resp *http.Response
+		err  error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		responses <- response{resp, err}
+	}()
+
+	fmt.Fprintln(bodyWriter, `{"ip": "10.0.0.1"}`)
+	r := <-responses
+	if r.err != nil {
+		t.Fatalf("Request failed: %v", r.err)
+	}
+	defer r.resp.Body.Close()
+	lines := bufio.NewScanner(r.resp.Body)
+
+	for i := 1; i <= 3; i++ {
+		if i > 1 {
+			fmt.Fprintf(bodyWriter, "{\"ip\": \"10.0.0.%d\"}\n", i)
+		}
+		if !lines.Scan() {
+			t.Fatalf("Stream ended before result %d: %v", i, lines.Err())
+		}
+		if !strings.Contains(lines.Text(), fmt.Sprintf("City %d", i)) {
+			t.Errorf("Result %d = %s", i, lines.Text())
+		}
+	}
+	bodyWriter.Close()
+	if lines.Scan() {
+		t.Errorf("Unexpected line after the last result: %s", lines.Text())
+	}
+}
+
+func BenchmarkBatchHandler(b *testing.B) {
+	service := NewMockIPService()
+	ips := make([]string, 1000)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+		service.SetLocation(ips[i], &models.Location{Country: "Israel", City: "Tel Aviv"})
+	}
+	handler := NewIPHandler(service, slog.Default())
+
+	jsonBody, _ := json.Marshal(batchRequest{IPs: ips})
+	var ndjsonBody strings.Builder
+	for _, ip := range ips {
+		fmt.Fprintf(&ndjsonBody, "{\"ip\": %q}\n", ip)
+	}
+
+	for _, bc := range []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"json", "application/json", string(jsonBody)},
+		{"ndjson", ContentTypeNDJSON, ndjsonBody.String()},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				req := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(bc.body))
+				req.Header.Set("Content-Type", bc.contentType)
+				w := httptest.NewRecorder()
+				handler.Batch(w, req)
+				if w.Code != http.StatusOK {
+					b.Fatalf("Batch() status = %d", w.Code)
+				}
+			}
+		})
+	}
+}
+
+func FuzzBatchNDJSON(f *testing.F) {
+	f.Add("{\"ip\": \"8.8.8.8\"}\n{\"ip\": \"bad\"}\n")
+	f.Add("{\"ip\": 1}\n\n[]\n")
+	f.Add(strings.Repeat("x", 2*maxBatchLineBytes))
+
+	handler := newBatchTestHandler()
+	handler.batch = BatchOptions{MaxStreamIPs: 16}.withDefaults()
+	f.Fuzz(func(t *testing.T, body string) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", ContentTypeNDJSON)
+		w := httptest.NewRecorder()
+		handler.Batch(w, req)
+
+		// Every line of the response is a JSON object, whatever the request held
+		for _, line := range readNDJSON(t, w.Body) {
+			if _, ok := line["index"]; !ok && line["code"] == nil {
+				t.Fatalf("Line %v is neither a result nor a trailer", line)
+			}
+		}
+	})
+}
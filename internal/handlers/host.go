@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/resolver"
+)
+
+// HostResolver resolves the hostnames looked up by /v1/find-host
+type HostResolver interface {
+	Resolve(ctx context.Context, name string) ([]netip.Addr, error)
+}
+
+// hostResponse is the body of /v1/find-host
+type hostResponse struct {
+	Name    string       `json:"name"`
+	Results []hostResult `json:"results"`
+}
+
+// hostResult is the answer for one resolved address. Failed lookups carry the
+// status, error and code a lookup of the address itself would have returned.
+type hostResult struct {
+	IP       string           `json:"ip"`
+	Location *models.Location `json:"location,omitempty"`
+	Status   int              `json:"status,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Code     string           `json:"code,omitempty"`
+}
+
+// FindHost handles GET /v1/find-host requests, resolving a hostname and looking up
+// the location of every address it resolves to
+func (h *IPHandler) FindHost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		h.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.resolver == nil {
+		h.sendErrorWithCode(w, "Hostname lookups are not enabled", "host_lookup_disabled", http.StatusNotImplemented)
+		return
+	}
+
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+	name := query.Get("name")
+	if name == "" {
+		h.sendError(w, "Missing required parameter: name", http.StatusBadRequest)
+		return
+	}
+
+	ctx, ok := h.datasetContext(r)
+	if !ok {
+		h.sendDatasetForbidden(w)
+		return
+	}
+
+	addrs, err := h.resolver.Resolve(ctx, name)
+	if err != nil {
+		h.logger.Debug("Failed to resolve hostname", "name", name, "error", err)
+		status, message, code := resolveError(err)
+		h.sendErrorWithCode(w, message, code, status)
+		return
+	}
+
+	response := hostResponse{Name: name, Results: make([]hostResult, len(addrs))}
+	for i, addr := range addrs {
+		result := hostResult{IP: addr.String()}
+		location, err := h.findLocation(ctx, addr)
+		if err != nil {
+			result.Status, result.Error, result.Code = lookupError(err)
+		} else {
+			result.Location = location
+		}
+		response.Results[i] = result
+	}
+	h.sendJSON(w, response)
+}
+
+// resolveError maps a hostname resolution error to the status, message and code sent
+// to clients
+func resolveError(err error) (status int, message, code string) {
+	switch {
+	case errors.Is(err, resolver.ErrInvalidHostname):
+		return http.StatusBadRequest, "Invalid hostname", "invalid_hostname"
+	case errors.Is(err, resolver.ErrNotFound):
+		return http.StatusNotFound, "Hostname not found", "host_not_found"
+	case errors.Is(err, resolver.ErrTimeout):
+		return http.StatusGatewayTimeout, "DNS resolution timed out", "dns_timeout"
+	default:
+		return http.StatusBadGateway, "DNS resolution failed", "dns_failed"
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/resolver"
+)
+
+// fakeResolver answers from a fixed table of hostnames
+type fakeResolver map[string][]netip.Addr
+
+func (f fakeResolver) Resolve(ctx context.Context, name string) ([]netip.Addr, error) {
+	if !resolver.ValidHostname(name) {
+		return nil, fmt.Errorf("%w: %q", resolver.ErrInvalidHostname, name)
+	}
+	if name == "slow.example" {
+		return nil, fmt.Errorf("%w: %s", resolver.ErrTimeout, name)
+	}
+	addrs, ok := f[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", resolver.ErrNotFound, name)
+	}
+	return addrs, nil
+}
+
+func TestIPHandler_FindHost(t *testing.T) {
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	handler := NewIPHandler(service, slog.Default())
+	handler.resolver = fakeResolver{
+		"dns.example": {netip.MustParseAddr("8.8.8.8"), netip.MustParseAddr("2001:db8::1")},
+	}
+
+	req := httptest.NewRequest("GET", "/v1/find-host?name=dns.example", nil)
+	w := httptest.NewRecorder()
+	handler.FindHost(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response hostResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Name != "dns.example" || len(response.Results) != 2 {
+		t.Fatalf("Unexpected response: %+v", response)
+	}
+	if got := response.Results[0]; got.IP != "8.8.8.8" || got.Location == nil || got.Location.City != "Mountain View" {
+		t.Errorf("Expected 8.8.8.8 in Mountain View, got %+v", got)
+	}
+	if got := response.Results[1]; got.IP != "2001:db8::1" || got.Location != nil || got.Status != http.StatusNotFound {
+		t.Errorf("Expected 2001:db8::1 to be not found, got %+v", got)
+	}
+}
+
+func TestIPHandler_FindHost_Errors(t *testing.T) {
+	handler := NewIPHandler(NewMockIPService(), slog.Default())
+	handler.resolver = fakeResolver{}
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{"", http.StatusBadRequest, "Missing required parameter: name"},
+		{"name=8.8.8.8", http.StatusBadRequest, `"code":"invalid_hostname"`},
+		{"name=missing.example", http.StatusNotFound, `"code":"host_not_found"`},
+		{"name=slow.example", http.StatusGatewayTimeout, `"code":"dns_timeout"`},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/find-host?"+tt.query, nil)
+		w := httptest.NewRecorder()
+		handler.FindHost(w, req)
+
+		if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("%s: got %d %s, want %d containing %s", tt.query, w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+		}
+	}
+}
+
+func TestIPHandler_FindHost_Disabled(t *testing.T) {
+	handler := NewIPHandler(NewMockIPService(), slog.Default())
+
+	req := httptest.NewRequest("GET", "/v1/find-host?name=dns.example", nil)
+	w := httptest.NewRecorder()
+	handler.FindHost(w, req)
+
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501, got %d", w.Code)
+	}
+}
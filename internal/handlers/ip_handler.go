@@ -2,21 +2,72 @@ package handlers
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
+	"errors"
 	"log/slog"
+	"math"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"ip-geolocation-service/internal/accesspolicy"
+	"ip-geolocation-service/internal/experiments"
+	"ip-geolocation-service/internal/flags"
+	"ip-geolocation-service/internal/geo"
+	"ip-geolocation-service/internal/health"
+	"ip-geolocation-service/internal/ipclass"
+	"ip-geolocation-service/internal/jws"
 	"ip-geolocation-service/internal/middleware"
 	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/quota"
+	"ip-geolocation-service/internal/report"
+	"ip-geolocation-service/internal/requestcontext"
 	"ip-geolocation-service/internal/services"
+	"ip-geolocation-service/internal/shard"
+	"ip-geolocation-service/internal/threatintel"
+	"ip-geolocation-service/internal/watchdog"
 )
 
+// DatasetHeader lets clients select a dataset per request
+const DatasetHeader = "X-Dataset"
+
+// languageTag matches the BCP 47 tags accepted by ?lang (e.g. "fr", "pt-BR", "zh-Hant-TW")
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{1,8})*$`)
+
 // IPHandler handles IP location requests
 type IPHandler struct {
-	service services.IPService
-	logger  *slog.Logger
+	service              services.IPService
+	logger               *slog.Logger
+	datasetHeaderEnabled bool
+	threatIntel          *threatintel.Checker  // Optional anonymizer detection
+	drain                *middleware.DrainMode // Optional readiness toggle reported by /health
+	healthHistory        *health.History       // Optional record of recent /health results
+	watchdog             *watchdog.Watchdog    // Optional synthetic lookups whose degraded flag /health reports
+	warmUp               *middleware.WarmUp    // Optional warm-up holding back readiness after startup
+	quota                *quota.Tracker        // Optional usage quotas reported by /v1/usage
+	reports              *report.Collector     // Optional lookup counts for scheduled reports
+	misses               *services.MissTracker // Optional dataset coverage reported by /admin/misses
+	flags                *flags.Set            // Feature flags (nil keeps every feature at its default)
+	parseMode            models.ParseMode      // Treatment of non-canonical addresses ("" normalizes them)
+	resolver             HostResolver          // Optional hostname resolution for /v1/find-host
+	accessPolicy         *accesspolicy.Policy  // Optional country access policy for /v1/check-access
+	signer               *jws.Signer           // Optional detached signing of lookup responses
+	batch                BatchOptions
+
+	// Optional datasets whose staleness /health reports
+	datasets *services.DatasetService
+
+	// Regions reported in the metadata envelope ("" and missing datasets leave them out)
+	serviceRegion  string
+	datasetRegions map[string]string // Dataset name -> regional variant it holds
+
+	// Optional hash ring of a sharded deployment, naming the shard of looked up addresses
+	shards *shard.Ring
 }
 
 // NewIPHandler creates a new IP handler
@@ -24,6 +75,7 @@ func NewIPHandler(service services.IPService, logger *slog.Logger) *IPHandler {
 	return &IPHandler{
 		service: service,
 		logger:  logger,
+		batch:   BatchOptions{}.withDefaults(),
 	}
 }
 
@@ -38,102 +90,626 @@ func (h *IPHandler) FindCountry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+
 	// Get IP from query parameter
-	ip := r.URL.Query().Get("ip")
+	ip := query.Get("ip")
 	if ip == "" {
 		h.sendError(w, "Missing required parameter: ip", http.StatusBadRequest)
 		return
 	}
+	addr, err := h.parseIP(ip)
+	if err != nil {
+		h.sendLookupError(w, err)
+		return
+	}
+	h.setShardHeaders(w, addr)
 
-	// Add request context with timeout
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
+	// Optional metadata envelope
+	includeMeta := false
+	if value := query.Get("include_meta"); value != "" {
+		var err error
+		if includeMeta, err = strconv.ParseBool(value); err != nil {
+			h.sendError(w, "Invalid include_meta parameter", http.StatusBadRequest)
+			return
+		}
+	}
 
-	// Add client ID to context if available
-	var clientID interface{}
-	if clientID = r.Context().Value(middleware.ClientIDKey); clientID != nil {
-		ctx = context.WithValue(ctx, middleware.ClientIDKey, clientID)
+	// Optional response language for country and city names
+	lang := query.Get("lang")
+	if lang != "" && !languageTag.MatchString(lang) {
+		h.sendError(w, "Invalid lang parameter", http.StatusBadRequest)
+		return
 	}
 
-	// Log the request
-	h.logger.Info("🔍 Processing IP lookup request",
+	// Request deadlines are enforced by TimeoutMiddleware and the service
+	ctx := r.Context()
+	if lang != "" {
+		ctx = services.WithLanguage(ctx, lang)
+	}
+
+	// Select the dataset to query
+	dataset, ok := h.selectDataset(r)
+	if !ok {
+		h.sendDatasetForbidden(w)
+		return
+	}
+	if dataset != "" {
+		ctx = services.WithDataset(ctx, dataset)
+	}
+	ctx, info := services.WithLookupInfo(ctx)
+
+	// Log the request at debug level; LoggingMiddleware already records (sampled) request completions
+	clientID, _ := requestcontext.ClientID(ctx)
+	requestID, _ := requestcontext.RequestID(ctx)
+	h.logger.Debug("🔍 Processing IP lookup request",
 		"ip", ip,
 		"client_id", clientID,
+		"request_id", requestID,
+		"dataset", dataset,
 	)
 
 	// Find location
-	location, err := h.service.FindLocation(ctx, ip)
+	start := time.Now()
+	location, err := h.findLocation(ctx, addr)
+	latency := time.Since(start)
 	if err != nil {
 		h.logger.Error("❌ Failed to find location",
 			"ip", ip,
 			"error", err,
 		)
 
-		// Determine appropriate error response based on error type
-		switch {
-		case strings.Contains(err.Error(), "location not found"):
-			h.sendError(w, "Location not found for the provided IP address", http.StatusNotFound)
-		case strings.Contains(err.Error(), "invalid IP address"):
-			h.sendError(w, "Invalid IP address format", http.StatusBadRequest)
-		case strings.Contains(err.Error(), "invalid location data"):
-			h.sendError(w, "Invalid location data", http.StatusInternalServerError)
-		default:
-			h.sendError(w, "Internal server error", http.StatusInternalServerError)
-		}
+		h.sendLookupError(w, err)
 		return
 	}
 
+	// Flag anonymizing services; the location may be shared with the cache, so copy it
+	var anonymizerSources []string
+	if h.threatIntel != nil && h.flags.Enabled(flags.AnonymizerDetection) {
+		result := h.threatIntel.Check(addr)
+		flagged := *location
+		flagged.IsAnonymizer = &result.IsAnonymizer
+		location, anonymizerSources = &flagged, result.Sources
+	}
+
+	// Mark locations the country access policy blocks
+	if h.accessPolicy != nil {
+		location = h.markBlocked(location)
+	}
+
+	// Report where the answer came from
+	w.Header().Set("X-Location-Source", info.Source)
+	if info.Override != "" {
+		w.Header().Set("X-Location-Override", info.Override)
+	}
+	if info.Language != "" {
+		w.Header().Set("Content-Language", info.Language)
+	}
+
 	// Send successful response
-	h.sendSuccess(w, location)
+	if includeMeta {
+		h.sendEnvelope(w, addr, location, info, anonymizerSources, latency)
+		return
+	}
+	h.sendSuccess(w, location, info)
 }
 
-// sendSuccess sends a successful response
-func (h *IPHandler) sendSuccess(w http.ResponseWriter, location *models.Location) {
+// Classify handles GET /v1/classify requests, reporting which special-purpose range
+// (if any) an address belongs to. It needs no dataset.
+func (h *IPHandler) Classify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		h.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+	ip := query.Get("ip")
+	if ip == "" {
+		h.sendError(w, "Missing required parameter: ip", http.StatusBadRequest)
+		return
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		h.sendError(w, "Invalid IP address format", http.StatusBadRequest)
+		return
+	}
+
+	response, err := json.Marshal(ipclass.Classify(addr))
+	if err != nil {
+		h.logger.Error("Failed to marshal classification response", "error", err)
+		h.sendError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// Distance handles GET /v1/distance requests, reporting the great-circle distance
+// between the locations of two IP addresses
+func (h *IPHandler) Distance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	response, err := location.ToJSON()
+	if r.Method != http.MethodGet {
+		h.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+	ip1, ip2 := query.Get("ip1"), query.Get("ip2")
+	if ip1 == "" || ip2 == "" {
+		h.sendError(w, "Missing required parameters: ip1 and ip2", http.StatusBadRequest)
+		return
+	}
+
+	ctx, ok := h.datasetContext(r)
+	if !ok {
+		h.sendDatasetForbidden(w)
+		return
+	}
+
+	location1, lat1, lon1, ok := h.locate(ctx, w, ip1)
+	if !ok {
+		return
+	}
+	location2, lat2, lon2, ok := h.locate(ctx, w, ip2)
+	if !ok {
+		return
+	}
+
+	h.sendJSON(w, distanceResponse{
+		IP1:        ip1,
+		IP2:        ip2,
+		Location1:  location1,
+		Location2:  location2,
+		DistanceKm: roundKm(geo.DistanceKm(lat1, lon1, lat2, lon2)),
+	})
+}
+
+// Within handles GET /v1/within requests, reporting whether an IP address is located
+// within radius_km of a point
+func (h *IPHandler) Within(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		h.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, ok := strictQuery(w, r)
+	if !ok {
+		return
+	}
+	ip := query.Get("ip")
+	if ip == "" || query.Get("lat") == "" || query.Get("lon") == "" || query.Get("radius_km") == "" {
+		h.sendError(w, "Missing required parameters: ip, lat, lon and radius_km", http.StatusBadRequest)
+		return
+	}
+
+	lat, latErr := strconv.ParseFloat(query.Get("lat"), 64)
+	lon, lonErr := strconv.ParseFloat(query.Get("lon"), 64)
+	if latErr != nil || lonErr != nil || !geo.ValidCoordinates(lat, lon) {
+		h.sendError(w, "Invalid lat or lon parameter", http.StatusBadRequest)
+		return
+	}
+	radius, err := strconv.ParseFloat(query.Get("radius_km"), 64)
+	if err != nil || !(radius >= 0) || math.IsInf(radius, 1) {
+		h.sendError(w, "Invalid radius_km parameter", http.StatusBadRequest)
+		return
+	}
+
+	ctx, ok := h.datasetContext(r)
+	if !ok {
+		h.sendDatasetForbidden(w)
+		return
+	}
+
+	location, ipLat, ipLon, ok := h.locate(ctx, w, ip)
+	if !ok {
+		return
+	}
+
+	distance := geo.DistanceKm(ipLat, ipLon, lat, lon)
+	h.sendJSON(w, withinResponse{
+		IP:         ip,
+		Location:   location,
+		Latitude:   lat,
+		Longitude:  lon,
+		RadiusKm:   radius,
+		DistanceKm: roundKm(distance),
+		Within:     distance <= radius,
+	})
+}
+
+// distanceResponse is the body of /v1/distance
+type distanceResponse struct {
+	IP1        string           `json:"ip1"`
+	IP2        string           `json:"ip2"`
+	Location1  *models.Location `json:"location1"`
+	Location2  *models.Location `json:"location2"`
+	DistanceKm float64          `json:"distance_km"`
+}
+
+// withinResponse is the body of /v1/within
+type withinResponse struct {
+	IP         string           `json:"ip"`
+	Location   *models.Location `json:"location"`
+	Latitude   float64          `json:"latitude"`
+	Longitude  float64          `json:"longitude"`
+	RadiusKm   float64          `json:"radius_km"`
+	DistanceKm float64          `json:"distance_km"`
+	Within     bool             `json:"within"`
+}
+
+// locate looks up ip and returns its location and coordinates. On failure it writes
+// the error response and returns false.
+func (h *IPHandler) locate(ctx context.Context, w http.ResponseWriter, ip string) (*models.Location, float64, float64, bool) {
+	addr, err := h.parseIP(ip)
 	if err != nil {
-		h.logger.Error("Failed to marshal location response", "error", err)
+		h.sendLookupError(w, err)
+		return nil, 0, 0, false
+	}
+	location, err := h.findLocation(ctx, addr)
+	if err != nil {
+		h.logger.Debug("Failed to find location", "ip", ip, "error", err)
+		h.sendLookupError(w, err)
+		return nil, 0, 0, false
+	}
+
+	lat, lon, ok := location.Coordinates()
+	if !ok {
+		h.sendErrorWithCode(w, "No coordinates available for IP address "+ip, "coordinates_unavailable", http.StatusUnprocessableEntity)
+		return nil, 0, 0, false
+	}
+	return location, lat, lon, true
+}
+
+// parseIP parses a client-supplied address in the handler's parse mode
+func (h *IPHandler) parseIP(ip string) (netip.Addr, error) {
+	return models.ParseIPMode(ip, h.parseMode)
+}
+
+// findLocation looks up addr, counting the outcome for scheduled reports and miss
+// tracking. Lookups that fail for other reasons than a missing location say nothing
+// about coverage.
+func (h *IPHandler) findLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	location, err := h.service.FindLocation(ctx, addr)
+	found := err == nil
+	if !found && !errors.Is(err, services.ErrNotFound) {
+		return location, err
+	}
+	if h.reports != nil {
+		country := ""
+		if found {
+			if country = location.CountryCode; country == "" {
+				country = location.Country
+			}
+		}
+		h.reports.RecordLookup(country, found)
+	}
+	if h.misses != nil {
+		h.misses.Record(addr, found)
+	}
+	return location, err
+}
+
+// roundKm rounds a distance to 0.1 km
+func roundKm(km float64) float64 {
+	return math.Round(km*10) / 10
+}
+
+// Usage handles GET /v1/usage, reporting the caller's quota usage
+func (h *IPHandler) Usage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		h.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.quota == nil {
+		h.sendError(w, "Usage quotas are not enabled", http.StatusNotFound)
+		return
+	}
+
+	apiKey, ok := middleware.APIKeyFromContext(r.Context())
+	if !ok || apiKey.QuotaID == "" {
+		h.sendError(w, "Usage is only tracked for authenticated clients", http.StatusUnauthorized)
+		return
+	}
+
+	usage, err := h.quota.Usage(apiKey.QuotaID)
+	if err != nil {
+		h.logger.Error("Failed to read quota usage", "error", err)
+		h.sendError(w, "Usage temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	// Report the masked key ID rather than the quota identity
+	usage.Client = apiKey.ID
+	middleware.SetQuotaHeaders(w.Header(), usage)
+
+	response, err := json.Marshal(usage)
+	if err != nil {
+		h.logger.Error("Failed to marshal usage response", "error", err)
 		h.sendError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	w.WriteHeader(http.StatusOK)
 	w.Write(response)
 }
 
-// sendError sends an error response
-func (h *IPHandler) sendError(w http.ResponseWriter, message string, statusCode int) {
-	w.WriteHeader(statusCode)
+// locationEnvelope wraps a location with metadata describing how it was found
+type locationEnvelope struct {
+	Location *models.Location `json:"location"`
+	Meta     lookupMeta       `json:"meta"`
+}
+
+// lookupMeta is the metadata reported with ?include_meta=true
+type lookupMeta struct {
+	services.LookupInfo
+	IPClass           string   `json:"ip_class,omitempty"`           // ipclass classification of the queried address
+	AnonymizerSources []string `json:"anonymizer_sources,omitempty"` // Threat-intel providers that flagged the address
+	ServiceRegion     string   `json:"service_region,omitempty"`     // Region of the instance that answered
+	DatasetRegion     string   `json:"dataset_region,omitempty"`     // Regional variant of the dataset that answered
+	LatencyMS         float64  `json:"latency_ms"`
+}
+
+// sendEnvelope sends a location wrapped with lookup metadata
+func (h *IPHandler) sendEnvelope(w http.ResponseWriter, addr netip.Addr, location *models.Location, info *services.LookupInfo, anonymizerSources []string, latency time.Duration) {
+	meta := lookupMeta{
+		LookupInfo:        *info,
+		AnonymizerSources: anonymizerSources,
+		LatencyMS:         float64(latency.Microseconds()) / 1000,
+		IPClass:           ipclass.Classify(addr).Class,
+		ServiceRegion:     h.serviceRegion,
+		DatasetRegion:     h.datasetRegions[info.Dataset],
+	}
+
+	response, err := json.Marshal(locationEnvelope{
+		Location: location,
+		Meta:     meta,
+	})
+	if err != nil {
+		h.logger.Error("Failed to marshal location response", "error", err)
+		h.sendError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeSigned(w, response, info)
+}
+
+// datasetContext returns the request context bound to the dataset selected for the
+// request, or false when the API key isn't permitted to use it
+func (h *IPHandler) datasetContext(r *http.Request) (context.Context, bool) {
+	dataset, ok := h.selectDataset(r)
+	if !ok {
+		return nil, false
+	}
+	ctx := r.Context()
+	if dataset != "" {
+		ctx = services.WithDataset(ctx, dataset)
+	}
+	return ctx, true
+}
+
+// selectDataset picks the dataset for the request. A dataset pinned by the API key wins;
+// otherwise the X-Dataset header is honored when enabled, and then the dataset of the
+// request's experiment. An empty name means the service default. It returns false when
+// the header conflicts with the key's dataset.
+func (h *IPHandler) selectDataset(r *http.Request) (string, bool) {
+	requested := ""
+	if h.datasetHeaderEnabled {
+		requested = r.Header.Get(DatasetHeader)
+	}
+
+	if apiKey, ok := middleware.APIKeyFromContext(r.Context()); ok && apiKey.Dataset != "" {
+		if requested != "" && requested != apiKey.Dataset {
+			return "", false
+		}
+		return apiKey.Dataset, true
+	}
+
+	if e, ok := experiments.FromContext(r.Context()); ok && requested == "" {
+		requested = e.Dataset
+	}
+	return requested, true
+}
+
+// maxPooledBuffer is the largest response buffer returned to the pool; the rare
+// bigger one is left to the garbage collector rather than pinned
+const maxPooledBuffer = 4 << 10
 
-	errorResp := models.NewErrorResponse(message)
-	response, err := errorResp.ToJSON()
+// responseBuffers recycles the buffers lookup and error responses are encoded into,
+// so a response costs no allocation once the pool is warm
+var responseBuffers = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+// getResponseBuffer returns an empty buffer from the pool
+func getResponseBuffer() *[]byte {
+	return responseBuffers.Get().(*[]byte)
+}
+
+// putResponseBuffer returns b to the pool once its contents have been written
+func putResponseBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBuffer {
+		return
+	}
+	*b = (*b)[:0]
+	responseBuffers.Put(b)
+}
+
+// sendSuccess sends a successful response
+func (h *IPHandler) sendSuccess(w http.ResponseWriter, location *models.Location, info *services.LookupInfo) {
+	buf := getResponseBuffer()
+	defer putResponseBuffer(buf)
+
+	response, err := location.AppendJSON(*buf)
 	if err != nil {
-		h.logger.Error("Failed to marshal error response", "error", err)
-		// Fallback to plain text
-		w.Write([]byte(fmt.Sprintf(`{"error": "%s"}`, message)))
+		h.logger.Error("Failed to marshal location response", "error", err)
+		h.sendError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	*buf = response
 
+	h.writeSigned(w, response, info)
+}
+
+// sendJSON sends v as a 200 response
+func (h *IPHandler) sendJSON(w http.ResponseWriter, v any) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Error("Failed to marshal response", "error", err)
+		h.sendError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
 	w.Write(response)
 }
 
+// sendLookupError maps a location lookup error to an error response
+func (h *IPHandler) sendLookupError(w http.ResponseWriter, err error) {
+	status, message, code := lookupError(err)
+	h.sendErrorWithCode(w, message, code, status)
+}
+
+// lookupError maps a location lookup error to the status, message and code sent to clients
+func lookupError(err error) (status int, message, code string) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "Lookup timed out", "lookup_timeout"
+	case errors.Is(err, services.ErrDatasetLoading):
+		return http.StatusServiceUnavailable, "Dataset is still loading", "dataset_loading"
+	case errors.Is(err, services.ErrDatasetStale):
+		return http.StatusServiceUnavailable, "Dataset is older than the maximum dataset age", "dataset_stale"
+	case errors.Is(err, services.ErrUnknownDataset):
+		return http.StatusBadRequest, "Unknown dataset", ""
+	case errors.Is(err, services.ErrNotFound):
+		return http.StatusNotFound, "Location not found for the provided IP address", ""
+	case errors.Is(err, services.ErrNonCanonicalIPv4):
+		return http.StatusBadRequest, "Invalid IP address format: IPv4 octets must be decimal without leading zeros", "non_canonical_ipv4"
+	case errors.Is(err, services.ErrNonCanonicalIP):
+		return http.StatusBadRequest, "Invalid IP address format: IP address must be written in canonical form", "non_canonical_ip"
+	case errors.Is(err, services.ErrInvalidIP):
+		return http.StatusBadRequest, "Invalid IP address format", ""
+	case errors.Is(err, services.ErrInvalidLocation):
+		return http.StatusInternalServerError, "Invalid location data", ""
+	default:
+		return http.StatusInternalServerError, "Internal server error", ""
+	}
+}
+
+// sendDatasetForbidden rejects a dataset the API key may not use
+func (h *IPHandler) sendDatasetForbidden(w http.ResponseWriter) {
+	h.sendError(w, "API key is not permitted to use the requested dataset", http.StatusForbidden)
+}
+
+// sendError sends an error response
+// strictQuery decodes the request's query with middleware.ParseQuery, answering 400
+// when it is refused, so a duplicate or malformed parameter is rejected even where
+// the strict_query middleware doesn't run
+func strictQuery(w http.ResponseWriter, r *http.Request) (url.Values, bool) {
+	query, err := middleware.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		middleware.WriteQueryError(w, err)
+		return nil, false
+	}
+	return query, true
+}
+
+func (h *IPHandler) sendError(w http.ResponseWriter, message string, statusCode int) {
+	h.sendErrorWithCode(w, message, "", statusCode)
+}
+
+// sendErrorWithCode sends an error response with a machine-readable code
+func (h *IPHandler) sendErrorWithCode(w http.ResponseWriter, message, code string, statusCode int) {
+	w.WriteHeader(statusCode)
+
+	buf := getResponseBuffer()
+	defer putResponseBuffer(buf)
+
+	errorResp := models.ErrorResponse{Error: message, Code: code}
+	*buf = errorResp.AppendJSON(*buf)
+	w.Write(*buf)
+}
+
 // HealthCheck handles health check requests
 func (h *IPHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
-	defer cancel()
+	start := time.Now()
+	status, err := h.checkHealth(r.Context())
+	if h.healthHistory != nil {
+		check := health.Check{Time: start, DurationMS: float64(time.Since(start).Microseconds()) / 1000, Status: status}
+		if err != nil {
+			check.Error = err.Error()
+		}
+		h.healthHistory.Record(check)
+	}
 
-	// Check service health
-	if err := h.service.HealthCheck(ctx); err != nil {
+	switch status {
+	case health.StatusHealthy:
+		w.WriteHeader(http.StatusOK)
+		// Degraded lookups and stale data are reported, but don't take the instance
+		// out of rotation
+		if h.degraded() {
+			w.Write([]byte(`{"status": "healthy", "degraded": true}`))
+			return
+		}
+		w.Write([]byte(`{"status": "healthy"}`))
+	case health.StatusUnhealthy:
 		h.logger.Error("Health check failed", "error", err)
 		w.WriteHeader(http.StatusServiceUnavailable)
 		w.Write([]byte(`{"status": "unhealthy", "error": "` + err.Error() + `"}`))
-		return
+	default:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status": "` + status + `"}`))
 	}
+}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status": "healthy"}`))
+// degraded reports whether a healthy instance is serving poorly: its synthetic
+// lookups keep failing or running slow, or a dataset is older than the maximum age
+func (h *IPHandler) degraded() bool {
+	return h.watchdog.Degraded() || (h.datasets != nil && len(h.datasets.Stale()) > 0)
+}
+
+// checkHealth returns the health status to report and, for an unhealthy service, why
+func (h *IPHandler) checkHealth(ctx context.Context) (string, error) {
+	// A draining instance is healthy but not ready for new traffic
+	if h.drain != nil && h.drain.Draining() {
+		return health.StatusDraining, nil
+	}
+
+	// Neither is an instance still warming up its datasets
+	if h.warmUp.WarmingUp() {
+		return health.StatusWarmingUp, nil
+	}
+
+	// Check service health (the service applies its own health deadline)
+	if err := h.service.HealthCheck(ctx); err != nil {
+		// Nor is one still retrying a dataset that failed to load at startup
+		if errors.Is(err, services.ErrDatasetLoading) {
+			return health.StatusLoading, err
+		}
+		return health.StatusUnhealthy, err
+	}
+	return health.StatusHealthy, nil
 }
 
 // NotFound handles 404 requests
@@ -1,14 +1,26 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"ip-geolocation-service/internal/experiments"
+	"ip-geolocation-service/internal/flags"
+	"ip-geolocation-service/internal/middleware"
 	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/report"
+	"ip-geolocation-service/internal/services"
+	"ip-geolocation-service/internal/threatintel"
 )
 
 func TestNewIPHandler(t *testing.T) {
@@ -92,6 +104,26 @@ func TestIPHandler_FindCountry_MissingIP(t *testing.T) {
 	}
 }
 
+// The handler parses its query strictly even without the strict_query middleware
+func TestIPHandler_FindCountry_StrictQuery(t *testing.T) {
+	handler := NewIPHandler(NewMockIPService(), slog.Default())
+
+	tests := []struct {
+		query string
+		code  string
+	}{
+		{"ip=8.8.8.8&ip=1.1.1.1", "duplicate_parameter"},
+		{"ip=8.8.8.8%zz", "malformed_query"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.FindCountry(w, httptest.NewRequest("GET", "/v1/find-country?"+tt.query, nil))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"code":"`+tt.code+`"`) {
+			t.Errorf("FindCountry(%s) = %d %s, want 400 %s", tt.query, w.Code, w.Body.String(), tt.code)
+		}
+	}
+}
+
 func TestIPHandler_FindCountry_InvalidMethod(t *testing.T) {
 	service := NewMockIPService()
 	logger := slog.Default()
@@ -115,10 +147,7 @@ func TestIPHandler_FindCountry_InvalidIP(t *testing.T) {
 	logger := slog.Default()
 	handler := NewIPHandler(service, logger)
 
-	// Set up service to return invalid IP error
-	service.SetError("invalid-ip", errors.New("invalid IP address: invalid IP address format: invalid-ip"))
-
-	// Create request with invalid IP
+	// Create request with invalid IP; the handler rejects it without a lookup
 	req := httptest.NewRequest("GET", "/v1/find-country?ip=invalid-ip", nil)
 	w := httptest.NewRecorder()
 
@@ -137,13 +166,55 @@ func TestIPHandler_FindCountry_InvalidIP(t *testing.T) {
 	}
 }
 
+func TestIPHandler_FindCountry_Canonicalization(t *testing.T) {
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	handler := NewIPHandler(service, slog.Default())
+
+	tests := []struct {
+		ip         string
+		wantStatus int
+		wantBody   string
+	}{
+		{"::ffff:8.8.8.8", http.StatusOK, "Mountain View"},
+		{"8.8.8.008", http.StatusBadRequest, `"code":"non_canonical_ipv4"`},
+		{"0x8.8.8.8", http.StatusBadRequest, `"code":"non_canonical_ipv4"`},
+		{"::ffff:8.8.8.08", http.StatusBadRequest, `"code":"non_canonical_ipv4"`},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/find-country?ip="+url.QueryEscape(tt.ip), nil)
+		w := httptest.NewRecorder()
+		handler.FindCountry(w, req)
+
+		if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("%s: got %d %s, want %d containing %s", tt.ip, w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+		}
+	}
+}
+
+func TestIPHandler_FindCountry_StrictParseMode(t *testing.T) {
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	handler := NewIPHandler(service, slog.Default())
+	handler.parseMode = models.ParseStrict
+
+	req := httptest.NewRequest("GET", "/v1/find-country?ip="+url.QueryEscape("::ffff:8.8.8.8"), nil)
+	w := httptest.NewRecorder()
+	handler.FindCountry(w, req)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"code":"non_canonical_ip"`) {
+		t.Errorf("got %d %s, want 400 with non_canonical_ip", w.Code, w.Body.String())
+	}
+}
+
 func TestIPHandler_FindCountry_LocationNotFound(t *testing.T) {
 	service := NewMockIPService()
 	logger := slog.Default()
 	handler := NewIPHandler(service, logger)
 
 	// Set up service to return location not found error
-	service.SetError("1.1.1.1", errors.New("location not found for IP: 1.1.1.1"))
+	service.SetError("1.1.1.1", fmt.Errorf("%w for IP: 1.1.1.1", services.ErrNotFound))
 
 	// Create request
 	req := httptest.NewRequest("GET", "/v1/find-country?ip=1.1.1.1", nil)
@@ -191,6 +262,438 @@ func TestIPHandler_FindCountry_InternalError(t *testing.T) {
 	}
 }
 
+func TestLookupError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("failed to find location: %w for IP: 1.1.1.1", services.ErrNotFound), http.StatusNotFound, ""},
+		{fmt.Errorf("lookup: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "lookup_timeout"},
+		{fmt.Errorf("%w: premium", services.ErrDatasetLoading), http.StatusServiceUnavailable, "dataset_loading"},
+		{fmt.Errorf("%w: premium was last modified 2026-01-01T00:00:00Z", services.ErrDatasetStale), http.StatusServiceUnavailable, "dataset_stale"},
+		{fmt.Errorf("%w: premium", services.ErrUnknownDataset), http.StatusBadRequest, ""},
+		{fmt.Errorf("%w format: 8.8.8.010: %w", services.ErrInvalidIP, services.ErrNonCanonicalIPv4), http.StatusBadRequest, "non_canonical_ipv4"},
+		{fmt.Errorf("%w format: bogus", services.ErrInvalidIP), http.StatusBadRequest, ""},
+		{fmt.Errorf("%w: country cannot be empty", services.ErrInvalidLocation), http.StatusInternalServerError, ""},
+		// Classification goes by the wrapped error, never the message
+		{errors.New("location not found for IP: 1.1.1.1"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		if status, _, code := lookupError(tt.err); status != tt.status || code != tt.code {
+			t.Errorf("lookupError(%v) = %d %q, want %d %q", tt.err, status, code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestIPHandler_FindCountry_Timeout(t *testing.T) {
+	service := NewMockIPService()
+	logger := slog.Default()
+	handler := NewIPHandler(service, logger)
+
+	service.SetError("8.8.8.8", fmt.Errorf("failed to find location: %w", context.DeadlineExceeded))
+
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	w := httptest.NewRecorder()
+
+	handler.FindCountry(w, req)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("FindCountry() status = %v, want %v", w.Code, http.StatusGatewayTimeout)
+	}
+	if !strings.Contains(w.Body.String(), `"code":"lookup_timeout"`) {
+		t.Errorf("FindCountry() body = %v, want lookup_timeout code", w.Body.String())
+	}
+}
+
+func TestIPHandler_FindCountry_DatasetSelection(t *testing.T) {
+	commercial := NewMockIPService()
+	commercial.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	free := NewMockIPService()
+	free.SetLocation("8.8.8.8", &models.Location{Country: "Free Country", City: "Free City"})
+
+	datasets := services.NewDatasetService("commercial", nil)
+	datasets.Add("commercial", "commercial.csv", commercial, nil)
+	datasets.Add("free", "free.csv", free, nil)
+
+	handler := NewIPHandler(datasets, slog.Default())
+	handler.datasetHeaderEnabled = true
+	store := middleware.NewAPIKeyStore(map[string]string{"free-key": "free", "any-key": ""})
+	wrapped := middleware.APIKeyMiddleware(store)(http.HandlerFunc(handler.FindCountry))
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		dataset    string
+		wantStatus int
+		wantBody   string
+	}{
+		{"default", "", "", http.StatusOK, "United States"},
+		{"header", "", "free", http.StatusOK, "Free Country"},
+		{"unknown header", "", "missing", http.StatusBadRequest, "Unknown dataset"},
+		{"pinned by key", "free-key", "", http.StatusOK, "Free Country"},
+		{"key and matching header", "free-key", "free", http.StatusOK, "Free Country"},
+		{"key and conflicting header", "free-key", "commercial", http.StatusForbidden, "not permitted"},
+		{"unpinned key and header", "any-key", "free", http.StatusOK, "Free Country"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+		if tt.apiKey != "" {
+			req.Header.Set(middleware.APIKeyHeader, tt.apiKey)
+		}
+		if tt.dataset != "" {
+			req.Header.Set(DatasetHeader, tt.dataset)
+		}
+		w := httptest.NewRecorder()
+		wrapped.ServeHTTP(w, req)
+
+		if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("%s: got %d %s, want %d containing %q", tt.name, w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+		}
+	}
+
+	// An experiment's dataset applies when neither the header nor the key picks one
+	canary, _ := experiments.Parse(map[string]string{"canary": "dataset:free"})
+	withExperiments := canary.Middleware(slog.Default())(wrapped)
+	for _, dataset := range []string{"", "commercial"} {
+		req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+		req.Header.Set(experiments.Header, "canary")
+		want := "Free Country"
+		if dataset != "" {
+			req.Header.Set(DatasetHeader, dataset)
+			want = "United States"
+		}
+		w := httptest.NewRecorder()
+		withExperiments.ServeHTTP(w, req)
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Experiment with X-Dataset %q: got %s, want %q", dataset, w.Body.String(), want)
+		}
+	}
+
+	// The header is ignored unless enabled
+	handler.datasetHeaderEnabled = false
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	req.Header.Set(DatasetHeader, "free")
+	w := httptest.NewRecorder()
+	handler.FindCountry(w, req)
+	if !strings.Contains(w.Body.String(), "United States") {
+		t.Errorf("Expected header to be ignored when disabled, got %s", w.Body.String())
+	}
+}
+
+func TestIPHandler_FindCountry_ReportsOverrideSource(t *testing.T) {
+	base := NewMockIPService()
+	base.SetLocation("1.1.1.1", &models.Location{Country: "Australia", City: "Sydney"})
+	store := services.NewOverrideStore("")
+	store.Set(services.Override{Target: "8.8.8.8", Country: "Corrected", City: "Fixed"})
+
+	handler := NewIPHandler(services.NewOverrideService(base, store), slog.Default())
+
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	w := httptest.NewRecorder()
+	handler.FindCountry(w, req)
+
+	if !strings.Contains(w.Body.String(), "Corrected") {
+		t.Errorf("FindCountry() body = %v, want override answer", w.Body.String())
+	}
+	if w.Header().Get("X-Location-Source") != services.SourceOverride || w.Header().Get("X-Location-Override") != "8.8.8.8" {
+		t.Errorf("FindCountry() source headers = %v", w.Header())
+	}
+
+	req = httptest.NewRequest("GET", "/v1/find-country?ip=1.1.1.1", nil)
+	w = httptest.NewRecorder()
+	handler.FindCountry(w, req)
+
+	if w.Header().Get("X-Location-Source") != services.SourceDataset || w.Header().Get("X-Location-Override") != "" {
+		t.Errorf("FindCountry() source headers = %v", w.Header())
+	}
+}
+
+func TestIPHandler_FindCountry_RecordsLookupsForReports(t *testing.T) {
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States", CountryCode: "US"})
+	service.SetLocation("1.1.1.1", &models.Location{Country: "Australia"})
+	service.SetError("9.9.9.9", errors.New("database error"))
+	handler := NewIPHandler(service, slog.Default())
+	handler.reports = report.NewCollector(0)
+
+	for _, ip := range []string{"8.8.8.8", "8.8.8.8", "1.1.1.1", "2.2.2.2", "9.9.9.9", "invalid-ip"} {
+		handler.FindCountry(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/find-country?ip="+ip, nil))
+	}
+
+	// Failures other than a missing location and invalid input say nothing about coverage
+	got := handler.reports.Cut()
+	if got.Lookups.Found != 3 || got.Lookups.NotFound != 1 {
+		t.Errorf("Lookups = %+v, want 3 found and 1 not found", got.Lookups)
+	}
+	want := []report.Count{{Name: "US", Count: 2}, {Name: "Australia", Count: 1}}
+	if len(got.TopCountries) != 2 || got.TopCountries[0] != want[0] || got.TopCountries[1] != want[1] {
+		t.Errorf("TopCountries = %+v, want %+v", got.TopCountries, want)
+	}
+}
+
+func TestIPHandler_FindCountry_IncludeMeta(t *testing.T) {
+	repo := services.NewMockRepository()
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	service := services.NewIPServiceWithOptions(repo, services.ServiceOptions{
+		Cache: services.NewLocationCache(10, 0),
+	})
+	datasets := services.NewDatasetService("commercial", nil)
+	datasets.Add("commercial", "commercial.csv", service, nil)
+	handler := NewIPHandler(datasets, slog.Default())
+
+	lookup := func() map[string]interface{} {
+		req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8&include_meta=true", nil)
+		w := httptest.NewRecorder()
+		handler.FindCountry(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("FindCountry() status = %v, want %v", w.Code, http.StatusOK)
+		}
+		var envelope struct {
+			Location models.Location        `json:"location"`
+			Meta     map[string]interface{} `json:"meta"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("FindCountry() returned invalid JSON: %v", err)
+		}
+		if envelope.Location.Country != "United States" {
+			t.Errorf("FindCountry() location = %+v", envelope.Location)
+		}
+		return envelope.Meta
+	}
+
+	meta := lookup()
+	if meta["dataset"] != "commercial" || meta["match_type"] != services.MatchExact || meta["source"] != services.SourceDataset {
+		t.Errorf("FindCountry() meta = %v", meta)
+	}
+	if meta["cache_hit"] != false {
+		t.Errorf("First lookup cache_hit = %v, want false", meta["cache_hit"])
+	}
+	if meta["ip_class"] != "public" {
+		t.Errorf("FindCountry() meta ip_class = %v, want public", meta["ip_class"])
+	}
+	if _, ok := meta["latency_ms"].(float64); !ok {
+		t.Errorf("FindCountry() meta missing latency_ms: %v", meta)
+	}
+
+	if meta = lookup(); meta["cache_hit"] != true {
+		t.Errorf("Second lookup cache_hit = %v, want true", meta["cache_hit"])
+	}
+	if _, ok := meta["service_region"]; ok {
+		t.Errorf("FindCountry() meta has a service_region without one configured: %v", meta)
+	}
+
+	// Configured regions tell apart the instance and the dataset variant that answered
+	handler.serviceRegion = "eu-west-1"
+	handler.datasetRegions = map[string]string{"commercial": "eu"}
+	if meta = lookup(); meta["service_region"] != "eu-west-1" || meta["dataset_region"] != "eu" {
+		t.Errorf("FindCountry() meta regions = %v, %v, want eu-west-1, eu", meta["service_region"], meta["dataset_region"])
+	}
+
+	// Invalid values are rejected
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8&include_meta=maybe", nil)
+	w := httptest.NewRecorder()
+	handler.FindCountry(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("FindCountry() status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestIPHandler_FindCountry_Language(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "translations.csv")
+	if err := os.WriteFile(path, []byte("name,lang,translation\nUnited States,fr,États-Unis\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	translations, err := services.LoadTranslations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := services.NewMockRepository()
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	handler := NewIPHandler(services.NewIPServiceWithOptions(repo, services.ServiceOptions{Translations: translations}), slog.Default())
+
+	tests := []struct {
+		lang         string
+		wantStatus   int
+		wantBody     string
+		wantLanguage string
+	}{
+		{"", http.StatusOK, "United States", ""},
+		{"fr", http.StatusOK, "États-Unis", "fr"},
+		{"fr-CA", http.StatusOK, "États-Unis", "fr"},
+		{"he", http.StatusOK, "United States", "en"},
+		{"not a language", http.StatusBadRequest, "Invalid lang parameter", ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8&lang="+url.QueryEscape(tt.lang), nil)
+		w := httptest.NewRecorder()
+		handler.FindCountry(w, req)
+
+		if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("lang=%q: got %d %s, want %d containing %q", tt.lang, w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+		}
+		if got := w.Header().Get("Content-Language"); got != tt.wantLanguage {
+			t.Errorf("lang=%q: Content-Language = %q, want %q", tt.lang, got, tt.wantLanguage)
+		}
+	}
+}
+
+func TestIPHandler_Classify(t *testing.T) {
+	handler := NewIPHandler(NewMockIPService(), slog.Default())
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{"ip=8.8.8.8", http.StatusOK, `"class":"public"`},
+		{"ip=100.64.1.1", http.StatusOK, `"class":"cgnat"`},
+		{"ip=fe80::1", http.StatusOK, `"class":"link_local"`},
+		{"ip=192.0.2.1", http.StatusOK, `"bogon":true`},
+		{"", http.StatusBadRequest, "Missing required parameter"},
+		{"ip=not-an-ip", http.StatusBadRequest, "Invalid IP address format"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/classify?"+tt.query, nil)
+		w := httptest.NewRecorder()
+		handler.Classify(w, req)
+
+		if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("%s: got %d %s, want %d containing %s", tt.query, w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+		}
+	}
+}
+
+func TestIPHandler_Distance(t *testing.T) {
+	service := NewMockIPService()
+	handler := NewIPHandler(service, slog.Default())
+
+	lat1, lon1, lat2, lon2 := 51.5074, -0.1278, 48.8566, 2.3522
+	service.SetLocation("1.1.1.1", &models.Location{Country: "United Kingdom", City: "London", Latitude: &lat1, Longitude: &lon1})
+	service.SetLocation("2.2.2.2", &models.Location{Country: "France", City: "Paris", Latitude: &lat2, Longitude: &lon2})
+	service.SetLocation("10.0.0.1", &models.Location{Country: "Private", City: "Local Network"})
+
+	req := httptest.NewRequest("GET", "/v1/distance?ip1=1.1.1.1&ip2=2.2.2.2", nil)
+	w := httptest.NewRecorder()
+	handler.Distance(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response distanceResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.DistanceKm != 343.6 || response.Location2.City != "Paris" {
+		t.Errorf("Unexpected response %+v", response)
+	}
+
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"ip1=1.1.1.1", http.StatusBadRequest},
+		{"ip1=1.1.1.1&ip2=3.3.3.3", http.StatusNotFound},
+		{"ip1=1.1.1.1&ip2=10.0.0.1", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.Distance(w, httptest.NewRequest("GET", "/v1/distance?"+tt.query, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.query, tt.status, w.Code)
+		}
+	}
+}
+
+func TestIPHandler_Within(t *testing.T) {
+	service := NewMockIPService()
+	handler := NewIPHandler(service, slog.Default())
+
+	lat, lon := 51.5074, -0.1278
+	service.SetLocation("1.1.1.1", &models.Location{Country: "United Kingdom", City: "London", Latitude: &lat, Longitude: &lon})
+
+	tests := []struct {
+		query  string
+		status int
+		within bool
+	}{
+		{"ip=1.1.1.1&lat=48.8566&lon=2.3522&radius_km=500", http.StatusOK, true},
+		{"ip=1.1.1.1&lat=48.8566&lon=2.3522&radius_km=300", http.StatusOK, false},
+		{"ip=1.1.1.1&lat=48.8566&lon=2.3522", http.StatusBadRequest, false},
+		{"ip=1.1.1.1&lat=91&lon=2.3522&radius_km=500", http.StatusBadRequest, false},
+		{"ip=1.1.1.1&lat=48.8566&lon=2.3522&radius_km=-1", http.StatusBadRequest, false},
+		{"ip=1.1.1.1&lat=48.8566&lon=2.3522&radius_km=NaN", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.Within(w, httptest.NewRequest("GET", "/v1/within?"+tt.query, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.query, tt.status, w.Code)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var response withinResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response.Within != tt.within || response.DistanceKm != 343.6 {
+			t.Errorf("%s: unexpected response %+v", tt.query, response)
+		}
+	}
+}
+
+func TestIPHandler_FindCountry_Anonymizer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vpn.txt")
+	if err := os.WriteFile(path, []byte("185.220.101.0/24\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	vpn, err := threatintel.LoadStaticList("vpn", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewMockIPService()
+	service.SetLocation("185.220.101.5", &models.Location{Country: "Germany", City: "Frankfurt"})
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	handler := NewIPHandler(service, slog.Default())
+
+	lookup := func(query string) string {
+		req := httptest.NewRequest("GET", "/v1/find-country?"+query, nil)
+		w := httptest.NewRecorder()
+		handler.FindCountry(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d", query, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	// Without a checker the flag is omitted entirely
+	if body := lookup("ip=185.220.101.5"); strings.Contains(body, "is_anonymizer") {
+		t.Errorf("Expected no is_anonymizer field when disabled, got %s", body)
+	}
+
+	handler.threatIntel = threatintel.NewChecker(vpn)
+	if body := lookup("ip=185.220.101.5&include_meta=true"); !strings.Contains(body, `"is_anonymizer":true`) || !strings.Contains(body, `"anonymizer_sources":["vpn"]`) {
+		t.Errorf("Expected flagged response, got %s", body)
+	}
+	if body := lookup("ip=8.8.8.8"); !strings.Contains(body, `"is_anonymizer":false`) {
+		t.Errorf("Expected explicit false for clean addresses, got %s", body)
+	}
+
+	// The feature flag turns detection off without a restart
+	featureFlags, _ := flags.New(nil, "", 0)
+	handler.flags = featureFlags
+	featureFlags.Override(flags.AnonymizerDetection, false)
+	if body := lookup("ip=185.220.101.5"); strings.Contains(body, "is_anonymizer") {
+		t.Errorf("Expected no is_anonymizer field with the flag off, got %s", body)
+	}
+}
+
 func TestIPHandler_HealthCheck_Success(t *testing.T) {
 	service := NewMockIPService()
 	logger := slog.Default()
@@ -248,6 +751,23 @@ func TestIPHandler_HealthCheck_Unhealthy(t *testing.T) {
 	}
 }
 
+func TestIPHandler_HealthCheck_DatasetLoading(t *testing.T) {
+	service := NewMockIPService()
+	handler := NewIPHandler(service, slog.Default())
+	service.SetHealthError(fmt.Errorf("%w: default", services.ErrDatasetLoading))
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+	handler.HealthCheck(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("HealthCheck() status = %v, want %v", w.Code, http.StatusServiceUnavailable)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"loading"`) {
+		t.Errorf("HealthCheck() body = %v, want status loading", body)
+	}
+}
+
 func TestIPHandler_NotFound(t *testing.T) {
 	service := NewMockIPService()
 	logger := slog.Default()
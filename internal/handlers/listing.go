@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// List endpoints share these query parameters:
+//   - limit: page size (default 100, at most 1000)
+//   - sort: field to order by, prefixed with - for descending order
+//   - cursor: the next_cursor of the previous page
+//   - <field>=value: keeps items whose field equals value, ignoring case
+//
+// Cursors name the last item returned rather than an offset, so items added or
+// removed between requests don't shift later pages.
+
+// listField is a field items can be filtered and sorted by. value returns a string,
+// int, int64, uint64, float64, bool, time.Time or netip.Addr, the same type for
+// every item.
+type listField[T any] struct {
+	name  string
+	value func(T) any
+}
+
+// listSpec describes the items of a list endpoint
+type listSpec[T any] struct {
+	fields      []listField[T]
+	key         func(T) string // Unique per item; orders ties and anchors cursors
+	defaultSort string
+}
+
+// listPage is the pagination block of list responses
+type listPage struct {
+	Total      int    `json:"total"` // Items matching the filters
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Next       string `json:"next,omitempty"` // Absolute URL of the next page
+}
+
+// listCursor is the position encoded in a cursor: the sort order it was issued for
+// and the sort value and key of the last item returned
+type listCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Key   string `json:"k"`
+}
+
+// list filters, sorts and pages items as the query asks. Errors describe the
+// invalid parameter and are meant for a 400 response.
+func (spec listSpec[T]) list(items []T, query url.Values) ([]T, listPage, error) {
+	page := listPage{Limit: defaultDebugPageSize, Sort: spec.defaultSort}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return nil, page, errors.New("Invalid limit parameter")
+		}
+		page.Limit = min(limit, maxDebugPageSize)
+	}
+	if value := query.Get("sort"); value != "" {
+		page.Sort = value
+	}
+	name, descending := strings.CutPrefix(page.Sort, "-")
+	sortField, ok := spec.field(name)
+	if !ok {
+		return nil, page, fmt.Errorf("Invalid sort parameter, expected one of: %s", strings.Join(spec.fieldNames(), ", "))
+	}
+
+	matched := make([]T, 0, len(items))
+	for _, item := range items {
+		if spec.matches(item, query) {
+			matched = append(matched, item)
+		}
+	}
+	order := func(value any, key string, item T) int {
+		c := compareListValues(value, sortField.value(item))
+		if c == 0 {
+			c = strings.Compare(key, spec.key(item))
+		}
+		if descending {
+			c = -c
+		}
+		return c
+	}
+	slices.SortFunc(matched, func(a, b T) int { return order(sortField.value(a), spec.key(a), b) })
+	page.Total = len(matched)
+
+	start := 0
+	if value := query.Get("cursor"); value != "" && len(matched) > 0 {
+		cursor, err := decodeListCursor(value)
+		if err != nil {
+			return nil, page, errors.New("Invalid cursor parameter")
+		}
+		if cursor.Sort != page.Sort {
+			return nil, page, errors.New("Invalid cursor parameter, it was issued for a different sort order")
+		}
+		after, err := parseListValue(sortField.value(matched[0]), cursor.Value)
+		if err != nil {
+			return nil, page, errors.New("Invalid cursor parameter")
+		}
+		start = sort.Search(len(matched), func(i int) bool { return order(after, cursor.Key, matched[i]) < 0 })
+	}
+
+	end := min(start+page.Limit, len(matched))
+	if end < len(matched) {
+		last := matched[end-1]
+		page.NextCursor = encodeListCursor(listCursor{
+			Sort:  page.Sort,
+			Value: formatListValue(sortField.value(last)),
+			Key:   spec.key(last),
+		})
+	}
+	return matched[start:end], page, nil
+}
+
+// field returns the field called name
+func (spec listSpec[T]) field(name string) (listField[T], bool) {
+	for _, field := range spec.fields {
+		if field.name == name {
+			return field, true
+		}
+	}
+	return listField[T]{}, false
+}
+
+// fieldNames returns the names of the fields, for error messages
+func (spec listSpec[T]) fieldNames() []string {
+	names := make([]string, len(spec.fields))
+	for i, field := range spec.fields {
+		names[i] = field.name
+	}
+	return names
+}
+
+// matches reports whether item passes the field filters in query
+func (spec listSpec[T]) matches(item T, query url.Values) bool {
+	for _, field := range spec.fields {
+		if want := query.Get(field.name); want != "" && !strings.EqualFold(formatListValue(field.value(item)), want) {
+			return false
+		}
+	}
+	return true
+}
+
+// link sets the URL of the next page, if there is one, built by absoluteURL
+func (page *listPage) link(r *http.Request, absoluteURL func(*http.Request, string, url.Values) string) {
+	if page.NextCursor == "" {
+		return
+	}
+	query := r.URL.Query()
+	query.Set("cursor", page.NextCursor)
+	query.Set("limit", strconv.Itoa(page.Limit))
+	page.Next = absoluteURL(r, r.URL.Path, query)
+}
+
+func encodeListCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListCursor(value string) (listCursor, error) {
+	var cursor listCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+// compareListValues orders two values of the same field
+func compareListValues(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case int:
+		return cmp.Compare(a, b.(int))
+	case int64:
+		return cmp.Compare(a, b.(int64))
+	case uint64:
+		return cmp.Compare(a, b.(uint64))
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	case bool:
+		switch b := b.(bool); {
+		case a == b:
+			return 0
+		case b:
+			return -1
+		default:
+			return 1
+		}
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case netip.Addr:
+		return a.Compare(b.(netip.Addr))
+	}
+	return 0
+}
+
+// formatListValue renders a field value for filters and cursors
+func formatListValue(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case int:
+		return strconv.Itoa(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case uint64:
+		return strconv.FormatUint(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case netip.Addr:
+		return value.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// parseListValue parses s, written by formatListValue, as a value of sample's type
+func parseListValue(sample any, s string) (any, error) {
+	switch sample.(type) {
+	case string:
+		return s, nil
+	case int:
+		return strconv.Atoi(s)
+	case int64:
+		return strconv.ParseInt(s, 10, 64)
+	case uint64:
+		return strconv.ParseUint(s, 10, 64)
+	case float64:
+		return strconv.ParseFloat(s, 64)
+	case bool:
+		return strconv.ParseBool(s)
+	case time.Time:
+		return time.Parse(time.RFC3339Nano, s)
+	case netip.Addr:
+		return netip.ParseAddr(s)
+	}
+	return nil, fmt.Errorf("unsupported field type %T", sample)
+}
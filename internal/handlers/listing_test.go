@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type listItem struct {
+	name  string
+	team  string
+	score int
+}
+
+var testListing = listSpec[listItem]{
+	fields: []listField[listItem]{
+		{"name", func(i listItem) any { return i.name }},
+		{"team", func(i listItem) any { return i.team }},
+		{"score", func(i listItem) any { return i.score }},
+	},
+	key:         func(i listItem) string { return i.name },
+	defaultSort: "name",
+}
+
+func names(items []listItem) []string {
+	result := make([]string, len(items))
+	for i, item := range items {
+		result[i] = item.name
+	}
+	return result
+}
+
+func TestListSpec_FiltersAndSorts(t *testing.T) {
+	items := []listItem{{"carol", "red", 7}, {"alice", "blue", 10}, {"bob", "Red", 10}, {"dave", "blue", 2}}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"alice", "bob", "carol", "dave"}},
+		{"sort=-name", []string{"dave", "carol", "bob", "alice"}},
+		// Ties are broken by key, reversed along with the order
+		{"sort=score", []string{"dave", "carol", "alice", "bob"}},
+		{"sort=-score", []string{"bob", "alice", "carol", "dave"}},
+		// Filters ignore case and combine
+		{"team=red", []string{"bob", "carol"}},
+		{"team=red&score=10", []string{"bob"}},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, page, err := testListing.list(items, query)
+		if err != nil {
+			t.Fatalf("list(%q) error = %v", tt.query, err)
+		}
+		if !reflect.DeepEqual(names(got), tt.want) || page.Total != len(tt.want) {
+			t.Errorf("list(%q) = %v (total %d), want %v", tt.query, names(got), page.Total, tt.want)
+		}
+	}
+
+	for _, query := range []string{"limit=0", "limit=x", "sort=age", "cursor=not-a-cursor"} {
+		values, _ := url.ParseQuery(query)
+		if _, _, err := testListing.list(items, values); err == nil {
+			t.Errorf("list(%q) error = nil, want an error", query)
+		}
+	}
+}
+
+func TestListSpec_CursorPages(t *testing.T) {
+	items := []listItem{{"a", "", 5}, {"b", "", 3}, {"c", "", 5}, {"d", "", 1}, {"e", "", 4}}
+	query := url.Values{"sort": {"-score"}, "limit": {"2"}}
+
+	var got []string
+	for pages := 0; ; pages++ {
+		page, pagination, err := testListing.list(items, query)
+		if err != nil {
+			t.Fatalf("list() error = %v", err)
+		}
+		got = append(got, names(page)...)
+		if pagination.NextCursor == "" {
+			break
+		}
+		if pages == 0 {
+			// Items inserted before the cursor don't shift later pages
+			items = append(items, listItem{"f", "", 9})
+		}
+		query.Set("cursor", pagination.NextCursor)
+	}
+	if want := []string{"c", "a", "e", "b", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pages = %v, want %v", got, want)
+	}
+
+	// A cursor only continues the order it was issued for
+	query.Set("sort", "name")
+	query.Set("cursor", encodeListCursor(listCursor{Sort: "-score", Value: "5", Key: "a"}))
+	if _, _, err := testListing.list(items, query); err == nil {
+		t.Error("list() with a cursor for another sort order error = nil")
+	}
+}
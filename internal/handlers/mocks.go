@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"net/netip"
 
 	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/services"
 )
 
 // MockIPService implements services.IPService for testing
@@ -21,14 +23,15 @@ func NewMockIPService() *MockIPService {
 	}
 }
 
-func (m *MockIPService) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
+func (m *MockIPService) FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	ip := addr.String()
 	if err, exists := m.errors[ip]; exists {
 		return nil, err
 	}
 	if location, exists := m.locations[ip]; exists {
 		return location, nil
 	}
-	return nil, errors.New("location not found for IP: " + ip)
+	return nil, fmt.Errorf("%w for IP: %s", services.ErrNotFound, ip)
 }
 
 func (m *MockIPService) HealthCheck(ctx context.Context) error {
@@ -4,34 +4,253 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"runtime"
+	"slices"
+	"strconv"
 
+	"ip-geolocation-service/internal/accesspolicy"
+	"ip-geolocation-service/internal/audit"
+	"ip-geolocation-service/internal/buildinfo"
+	"ip-geolocation-service/internal/errreport"
+	"ip-geolocation-service/internal/experiments"
+	"ip-geolocation-service/internal/flags"
+	"ip-geolocation-service/internal/health"
+	"ip-geolocation-service/internal/idempotency"
+	"ip-geolocation-service/internal/jws"
+	"ip-geolocation-service/internal/metrics"
 	"ip-geolocation-service/internal/middleware"
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/quota"
+	"ip-geolocation-service/internal/report"
+	"ip-geolocation-service/internal/requestcontext"
+	"ip-geolocation-service/internal/runtimelimits"
 	"ip-geolocation-service/internal/services"
+	"ip-geolocation-service/internal/shard"
+	"ip-geolocation-service/internal/threatintel"
+	"ip-geolocation-service/internal/usage"
+	"ip-geolocation-service/internal/watchdog"
 )
 
+// Debug endpoint pagination limits
+const (
+	defaultDebugPageSize = 100
+	maxDebugPageSize     = 1000
+)
+
+// metricRoutes are the paths reported by name in request metrics; requests for any
+// other path are counted together so scanners can't grow the series
+var metricRoutes = []string{
+	"/", "/health", "/health/history", "/version", "/metrics",
+	"/v1/find-country", "/v1/find-host", "/v1/classify", "/v1/distance", "/v1/within", "/v1/batch", "/v1/usage", "/v1/shard-map",
+	"/debug/rate-limiter", "/debug/lookup-stats", "/debug/runtime",
+	"/admin/maintenance", "/admin/drain", "/admin/undrain", "/admin/datasets", "/admin/compare", "/admin/import",
+	"/admin/overrides", "/admin/locations", "/admin/audit", "/admin/audit/verify", "/admin/log-level", "/admin/misses", "/admin/flags",
+}
+
+// RateLimiterInspector exposes rate limiter state to the debug endpoint
+type RateLimiterInspector interface {
+	GetDebugState(opts middleware.DebugStateOptions) map[string]interface{}
+}
+
+// RouterOptions holds optional router dependencies
+type RouterOptions struct {
+	RateLimiter     RateLimiterInspector
+	RateLimitExempt *middleware.RateLimitExemptions // Requests that bypass per-client rate limiting
+	GlobalLimiter   *middleware.GlobalLimiter       // Optional service-wide RPS/concurrency cap
+	LoadShedder     *middleware.LoadShedder         // Optional in-flight limit that sheds excess load
+	Shadower        *middleware.Shadower            // Optional mirroring of /v1 traffic to a secondary backend
+	Chaos           *middleware.Chaos               // Optional latency and error injection for resilience testing
+	TrustedProxies  *middleware.TrustedProxies      // Proxies whose X-Forwarded-Proto/Host shape generated links
+	LatencyBudgets  *middleware.LatencyBudgets      // Optional p99 budgets alerting on sustained violations
+	Metrics         *metrics.Registry
+	Build           buildinfo.Info // Served by /version
+	Flags           *flags.Set     // Feature flags managed through /admin/flags
+	// SeparateAdmin serves /admin, /metrics, /debug and /version only through the
+	// admin routes, leaving them off the public mux
+	SeparateAdmin     bool
+	DebugClientIDMode string                   // How client IDs are rendered by /debug/rate-limiter
+	BasePath          string                   // Path prefix the public routes are served under, e.g. /geo ("" serves from the root)
+	Timeouts          middleware.TimeoutConfig // Request deadlines; zero value disables the timeout middleware
+	Maintenance       *middleware.MaintenanceMode
+	Drain             *middleware.DrainMode // Readiness toggle flipped through /admin/drain and /admin/undrain
+	WarmUp            *middleware.WarmUp    // Holds /health at 503 until startup warm-up finishes
+	HealthHistory     *health.History       // Optional record of recent /health results served at /health/history
+	Watchdog          *watchdog.Watchdog    // Optional synthetic lookups; /health reports when they're degraded
+	AdminToken        string                // Bearer token required by /admin endpoints
+	AdminInsecure     bool                  // Serve /admin without any admin credential configured instead of disabling it
+	ReadOnly          bool                  // Reject every /admin mutation, whatever the credentials
+	Datasets          *services.DatasetService
+	Overrides         *services.OverrideStore
+	Audit             *audit.Log
+	APIKeys           *middleware.APIKeyStore
+	JWT               *middleware.JWTValidator   // Optional bearer token validation against an identity provider
+	HMAC              *middleware.HMACVerifier   // Optional request signature verification
+	PrivacyMode       bool                       // Truncate client IPs recorded in the audit log
+	LogLevel          *slog.LevelVar             // Runtime log level, changed through /admin/log-level
+	LogSampler        *middleware.LogSampler     // Request log sampling; nil logs every request
+	Recoverer         *middleware.PanicRecoverer // Panic handling; nil logs panics without reporting them
+	ErrorReporter     errreport.Reporter         // Optional sink for 5xx responses
+	AuthRequired      bool                       // Reject requests without an API key on /v1, /metrics and /debug
+	DatasetHeader     bool                       // Allow clients to select a dataset with the X-Dataset header
+	LocalizeErrors    bool                       // Translate public error messages into the Accept-Language of the request
+	ServiceRegion     string                     // Region of this instance, reported as meta.service_region ("" leaves it out)
+	DatasetRegions    map[string]string          // Dataset name -> regional variant, reported as meta.dataset_region
+	Shards            *shard.Ring                // Hash ring of a sharded deployment, published by /v1/shard-map; nil disables it
+	ThreatIntel       *threatintel.Checker       // Optional anonymizer flagging for lookups
+	Quota             *quota.Tracker             // Optional daily/monthly quotas for authenticated clients
+	Usage             *usage.Recorder            // Optional per-client request counts for billing export
+	Reports           *report.Collector          // Optional traffic summary for scheduled reports
+	Misses            *services.MissTracker      // Optional dataset coverage listed by /admin/misses
+	Batch             BatchOptions               // Limits for POST /v1/batch; zero values use the defaults
+	IPParseMode       models.ParseMode           // Treatment of non-canonical client addresses ("" normalizes them)
+	HostResolver      HostResolver               // Resolves /v1/find-host names; nil disables the endpoint
+	AccessPolicy      *accesspolicy.Policy       // Country access policy for /v1/check-access and lookups; nil disables it
+	Signer            *jws.Signer                // Signs lookup responses; nil leaves them unsigned
+	Idempotency       *idempotency.Store         // Replays admin mutations retried with the same Idempotency-Key; nil disables it
+	Experiments       *experiments.Set           // Allowlist of X-Experiment canary paths; nil ignores the header
+	Runtime           *runtimelimits.Applied     // Container limits and runtime settings applied at startup, shown by /debug/runtime
+	// DisabledMiddleware leaves middleware stages, or single middleware by name, out
+	// of both listeners' chains
+	DisabledMiddleware []string
+}
+
 // Router handles HTTP routing
 type Router struct {
-	ipHandler   *IPHandler
-	rateLimiter interface {
-		GetMapState() map[string]interface{}
-	}
-	logger *slog.Logger
+	ipHandler          *IPHandler
+	adminHandler       *AdminHandler
+	rateLimiter        RateLimiterInspector
+	rateLimitExempt    *middleware.RateLimitExemptions
+	globalLimiter      *middleware.GlobalLimiter
+	loadShedder        *middleware.LoadShedder
+	shadower           *middleware.Shadower
+	chaos              *middleware.Chaos
+	trustedProxies     *middleware.TrustedProxies
+	build              buildinfo.Info
+	flags              *flags.Set
+	separateAdmin      bool
+	datasets           *services.DatasetService
+	usage              *usage.Recorder
+	reports            *report.Collector
+	metrics            *metrics.Registry
+	requestMetrics     *middleware.RequestMetrics
+	latencyBudgets     *middleware.LatencyBudgets
+	debugClientIDMode  string
+	basePath           string
+	timeouts           middleware.TimeoutConfig
+	maintenance        *middleware.MaintenanceMode
+	adminToken         string
+	adminInsecure      bool
+	readOnly           bool
+	idempotency        *idempotency.Store
+	apiKeys            *middleware.APIKeyStore
+	jwt                *middleware.JWTValidator
+	hmac               *middleware.HMACVerifier
+	authRequired       bool
+	localizeErrors     bool
+	logSampler         *middleware.LogSampler
+	recoverer          *middleware.PanicRecoverer
+	disabledMiddleware []string
+	experiments        *experiments.Set
+	runtime            *runtimelimits.Applied
+	errorReporter      errreport.Reporter
+	logger             *slog.Logger
 }
 
 // NewRouter creates a new router
 func NewRouter(ipService services.IPService, logger *slog.Logger) *Router {
-	return &Router{
-		ipHandler: NewIPHandler(ipService, logger),
-		logger:    logger,
-	}
+	return NewRouterWithOptions(ipService, logger, RouterOptions{})
 }
 
 // NewRouterWithRateLimiter creates a new router with rate limiter
-func NewRouterWithRateLimiter(ipService services.IPService, rateLimiter interface{ GetMapState() map[string]interface{} }, logger *slog.Logger) *Router {
+func NewRouterWithRateLimiter(ipService services.IPService, rateLimiter RateLimiterInspector, logger *slog.Logger) *Router {
+	return NewRouterWithOptions(ipService, logger, RouterOptions{RateLimiter: rateLimiter})
+}
+
+// NewRouterWithOptions creates a new router with optional dependencies
+func NewRouterWithOptions(ipService services.IPService, logger *slog.Logger, opts RouterOptions) *Router {
+	debugClientIDMode := opts.DebugClientIDMode
+	if debugClientIDMode == "" {
+		debugClientIDMode = middleware.ClientIDModeHash
+	}
+
+	ipHandler := NewIPHandler(ipService, logger)
+	ipHandler.datasetHeaderEnabled = opts.DatasetHeader
+	ipHandler.threatIntel = opts.ThreatIntel
+	ipHandler.drain = opts.Drain
+	ipHandler.warmUp = opts.WarmUp
+	ipHandler.healthHistory = opts.HealthHistory
+	ipHandler.watchdog = opts.Watchdog
+	ipHandler.datasets = opts.Datasets
+	ipHandler.serviceRegion = opts.ServiceRegion
+	ipHandler.datasetRegions = opts.DatasetRegions
+	ipHandler.shards = opts.Shards
+	ipHandler.quota = opts.Quota
+	ipHandler.reports = opts.Reports
+	ipHandler.misses = opts.Misses
+	ipHandler.flags = opts.Flags
+	ipHandler.batch = opts.Batch.withDefaults()
+	ipHandler.parseMode = opts.IPParseMode
+	ipHandler.resolver = opts.HostResolver
+	ipHandler.accessPolicy = opts.AccessPolicy
+	ipHandler.signer = opts.Signer
+
+	var requestMetrics *middleware.RequestMetrics
+	if opts.Metrics != nil {
+		requestMetrics = middleware.NewRequestMetrics(opts.Metrics, metricRoutes)
+	}
+
 	return &Router{
-		ipHandler:   NewIPHandler(ipService, logger),
-		rateLimiter: rateLimiter,
-		logger:      logger,
+		ipHandler: ipHandler,
+		adminHandler: NewAdminHandler(AdminOptions{
+			Maintenance:    opts.Maintenance,
+			Drain:          opts.Drain,
+			Datasets:       opts.Datasets,
+			Overrides:      opts.Overrides,
+			Audit:          opts.Audit,
+			PrivacyMode:    opts.PrivacyMode,
+			LogLevel:       opts.LogLevel,
+			LogSampler:     opts.LogSampler,
+			Misses:         opts.Misses,
+			Flags:          opts.Flags,
+			TrustedProxies: opts.TrustedProxies,
+		}, logger),
+		rateLimiter:        opts.RateLimiter,
+		rateLimitExempt:    opts.RateLimitExempt,
+		globalLimiter:      opts.GlobalLimiter,
+		loadShedder:        opts.LoadShedder,
+		shadower:           opts.Shadower,
+		chaos:              opts.Chaos,
+		trustedProxies:     opts.TrustedProxies,
+		build:              opts.Build,
+		flags:              opts.Flags,
+		separateAdmin:      opts.SeparateAdmin,
+		datasets:           opts.Datasets,
+		usage:              opts.Usage,
+		reports:            opts.Reports,
+		metrics:            opts.Metrics,
+		requestMetrics:     requestMetrics,
+		latencyBudgets:     opts.LatencyBudgets,
+		debugClientIDMode:  debugClientIDMode,
+		basePath:           opts.BasePath,
+		timeouts:           opts.Timeouts,
+		maintenance:        opts.Maintenance,
+		adminToken:         opts.AdminToken,
+		adminInsecure:      opts.AdminInsecure,
+		readOnly:           opts.ReadOnly,
+		idempotency:        opts.Idempotency,
+		apiKeys:            opts.APIKeys,
+		jwt:                opts.JWT,
+		hmac:               opts.HMAC,
+		authRequired:       opts.AuthRequired,
+		localizeErrors:     opts.LocalizeErrors,
+		logSampler:         opts.LogSampler,
+		recoverer:          opts.Recoverer,
+		disabledMiddleware: opts.DisabledMiddleware,
+		experiments:        opts.Experiments,
+		runtime:            opts.Runtime,
+		errorReporter:      opts.ErrorReporter,
+		logger:             logger,
 	}
 }
 
@@ -42,26 +261,227 @@ func (r *Router) SetupRoutes() *http.ServeMux {
 	// API v1 routes
 	v1 := http.NewServeMux()
 	v1.HandleFunc("/find-country", r.ipHandler.FindCountry)
+	v1.HandleFunc("/find-host", r.ipHandler.FindHost)
+	v1.HandleFunc("/classify", r.ipHandler.Classify)
+	v1.HandleFunc("/distance", r.ipHandler.Distance)
+	v1.HandleFunc("/within", r.ipHandler.Within)
+	v1.HandleFunc("/check-access", r.ipHandler.CheckAccess)
+	v1.HandleFunc("/batch", r.ipHandler.Batch)
+	v1.HandleFunc("/usage", r.ipHandler.Usage)
+	v1.HandleFunc("/shard-map", r.ipHandler.ShardMap)
 
 	// Wrap v1 routes with middleware
-	mux.Handle("/v1/", http.StripPrefix("/v1", v1))
+	mux.Handle("/v1/", r.requireRole(middleware.RoleReader)(http.StripPrefix("/v1", v1)))
 
 	// Health endpoint
 	mux.HandleFunc("/health", r.ipHandler.HealthCheck)
 
-	// Debug endpoint for rate limiter state
-	mux.HandleFunc("/debug/rate-limiter", r.debugRateLimiter)
+	// Key that verifies signed responses
+	mux.HandleFunc("/.well-known/jwks.json", r.ipHandler.SigningKeys)
+
+	if !r.separateAdmin {
+		r.registerOperationalRoutes(mux)
+	}
 
 	// Root endpoint
-	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
-		if req.URL.Path == "/" {
-			r.ipHandler.NotFound(w, req)
-		} else {
-			http.NotFound(w, req)
+	mux.HandleFunc("/", r.root)
+
+	return mux
+}
+
+// SetupAdminRoutes configures the operational endpoints for a separate internal
+// listener, with /health so probes can use either port
+func (r *Router) SetupAdminRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", r.ipHandler.HealthCheck)
+	r.registerOperationalRoutes(mux)
+	mux.HandleFunc("/", r.root)
+	return mux
+}
+
+// root answers requests no route matched
+func (r *Router) root(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/" {
+		r.ipHandler.NotFound(w, req)
+	} else {
+		http.NotFound(w, req)
+	}
+}
+
+// registerOperationalRoutes adds the version, debug, admin and metrics endpoints
+func (r *Router) registerOperationalRoutes(mux *http.ServeMux) {
+	// Build metadata of the running binary
+	mux.Handle("/version", r.requireRole(middleware.RoleMetrics)(http.HandlerFunc(r.version)))
+
+	// Recent health check results, for looking into a flapping readiness probe
+	mux.Handle("/health/history", r.requireRole(middleware.RoleMetrics)(http.HandlerFunc(r.healthHistory)))
+
+	// Debug endpoint for rate limiter state
+	mux.Handle("/debug/rate-limiter", r.requireRole(middleware.RoleMetrics)(r.requireFlag(flags.DebugEndpoints)(http.HandlerFunc(r.debugRateLimiter))))
+
+	// Debug endpoint for cache, prefetch and coalescing counters
+	mux.Handle("/debug/lookup-stats", r.requireRole(middleware.RoleMetrics)(r.requireFlag(flags.DebugEndpoints)(http.HandlerFunc(r.debugLookupStats))))
+
+	// Debug endpoint for the container limits and the runtime settings fitted to them
+	mux.Handle("/debug/runtime", r.requireRole(middleware.RoleMetrics)(r.requireFlag(flags.DebugEndpoints)(http.HandlerFunc(r.debugRuntime))))
+
+	// Admin endpoints
+	admin := http.NewServeMux()
+	admin.HandleFunc("/admin/maintenance", r.adminHandler.Maintenance)
+	admin.HandleFunc("/admin/drain", r.adminHandler.Drain)
+	admin.HandleFunc("/admin/undrain", r.adminHandler.Undrain)
+	admin.HandleFunc("/admin/datasets", r.adminHandler.Datasets)
+	admin.HandleFunc("/admin/compare", r.adminHandler.Compare)
+	admin.HandleFunc("/admin/import", r.adminHandler.Import)
+	admin.HandleFunc("/admin/overrides", r.adminHandler.Overrides)
+	admin.HandleFunc("/admin/locations", r.adminHandler.Locations)
+	admin.HandleFunc("/admin/audit", r.adminHandler.Audit)
+	admin.HandleFunc("/admin/audit/verify", r.adminHandler.Audit)
+	admin.HandleFunc("/admin/log-level", r.adminHandler.LogLevel)
+	admin.HandleFunc("/admin/misses", r.adminHandler.Misses)
+	admin.HandleFunc("/admin/flags", r.adminHandler.Flags)
+	// With any client authentication configured, admin endpoints require an admin
+	// credential even when no key carries the admin role yet, so a reader key is
+	// never enough
+	adminKeys := r.jwt != nil ||
+		(r.apiKeys != nil && r.apiKeys.Len() > 0) ||
+		r.hmac != nil
+	var adminRoutes http.Handler = admin
+	if r.idempotency != nil {
+		// Inside authentication, so stored responses are only replayed to operators
+		adminRoutes = r.idempotency.Middleware(func(err error) {
+			r.logger.Error("Failed to persist idempotency key", "error", err)
+		})(admin)
+	}
+	if r.adminToken == "" && !adminKeys && !r.adminInsecure {
+		// Fail closed: with no admin credential configured, anyone could reach them
+		mux.HandleFunc("/admin/", adminDisabled)
+	} else {
+		mux.Handle("/admin/", r.rejectMutations(middleware.AdminAuthMiddleware(r.adminToken, adminKeys)(adminRoutes)))
+	}
+
+	// Prometheus metrics
+	if r.metrics != nil {
+		mux.Handle("/metrics", r.requireRole(middleware.RoleMetrics)(r.metrics.Handler()))
+	}
+}
+
+// requireRole enforces an API key role on a route group. Anonymous requests are
+// allowed unless authentication is required.
+func (r *Router) requireRole(role string) func(http.Handler) http.Handler {
+	return middleware.RequireRoleMiddleware(role, !r.authRequired)
+}
+
+// versionResponse is the build metadata and active dataset of the running service
+type versionResponse struct {
+	buildinfo.Info
+	Dataset        string `json:"dataset,omitempty"`
+	DatasetVersion string `json:"dataset_version,omitempty"`
+}
+
+// version shows the build metadata and the version of the default dataset
+func (r *Router) version(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		r.ipHandler.MethodNotAllowed(w, req)
+		return
+	}
+
+	response := versionResponse{Info: r.build}
+	if response.Version == "" {
+		response.Info = buildinfo.Get()
+	}
+	if r.datasets != nil {
+		response.Dataset = r.datasets.Default()
+		if info, ok := r.datasets.Info(response.Dataset); ok {
+			response.DatasetVersion = info.Version
+		}
+	} else if versioner, ok := r.ipHandler.service.(services.DatasetVersioner); ok {
+		response.DatasetVersion = versioner.DatasetVersion()
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// healthHistory serves the recent /health results, most recent first; ?failed=true
+// leaves out the checks that passed
+func (r *Router) healthHistory(w http.ResponseWriter, req *http.Request) {
+	history := r.ipHandler.healthHistory
+	if history == nil {
+		http.Error(w, "Health history not available", http.StatusServiceUnavailable)
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		r.ipHandler.MethodNotAllowed(w, req)
+		return
+	}
+	query, ok := strictQuery(w, req)
+	if !ok {
+		return
+	}
+	failedOnly := false
+	if value := query.Get("failed"); value != "" {
+		var err error
+		if failedOnly, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "Invalid failed parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	snapshot := history.Snapshot()
+	if failedOnly {
+		snapshot.Checks = slices.DeleteFunc(snapshot.Checks, health.Check.Healthy)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	jsonData, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		http.Error(w, "Failed to marshal health history", http.StatusInternalServerError)
+		return
+	}
+	w.Write(jsonData)
+}
+
+// requireFlag hides a route, answering 404, while the named feature flag is off
+func (r *Router) requireFlag(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if !r.flags.Enabled(name) {
+				http.NotFound(w, req)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// rejectMutations answers 403 to any request that could change state on a read-only
+// instance. It runs before authentication, so no credentials get past it.
+func (r *Router) rejectMutations(next http.Handler) http.Handler {
+	if !r.readOnly {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, req)
+		default:
+			r.logger.Warn("Rejected admin mutation on a read-only instance", "method", req.Method, "path", req.URL.Path)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": "Instance is read-only", "code": "read_only"}`))
 		}
 	})
+}
 
-	return mux
+// adminDisabled answers admin requests when no admin credential is configured and
+// ADMIN_INSECURE isn't set
+func adminDisabled(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(`{"error": "Admin endpoints are disabled: no admin credential is configured", "code": "admin_disabled"}`))
 }
 
 // debugRateLimiter shows the current state of the rate limiter
@@ -71,9 +491,22 @@ func (r *Router) debugRateLimiter(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	query, ok := strictQuery(w, req)
+	if !ok {
+		return
+	}
+	state := r.rateLimiter.GetDebugState(middleware.DebugStateOptions{ClientIDMode: r.debugClientIDMode})
+	clients, _ := state["clients"].([]middleware.ClientState)
+	page, pagination, err := rateLimiterClients.list(clients, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pagination.link(req, r.absoluteURL)
+	state["clients"] = page
+	state["pagination"] = pagination
 
-	state := r.rateLimiter.GetMapState()
+	w.Header().Set("Content-Type", "application/json")
 
 	// Pretty print JSON
 	jsonData, err := json.MarshalIndent(state, "", "  ")
@@ -85,31 +518,245 @@ func (r *Router) debugRateLimiter(w http.ResponseWriter, req *http.Request) {
 	w.Write(jsonData)
 }
 
+// rateLimiterClients lists the clients shown by /debug/rate-limiter
+var rateLimiterClients = listSpec[middleware.ClientState]{
+	fields: []listField[middleware.ClientState]{
+		{"client_id", func(c middleware.ClientState) any { return c.ClientID }},
+		{"tokens", func(c middleware.ClientState) any { return c.Tokens }},
+		{"last_update", func(c middleware.ClientState) any { return c.LastUpdate }},
+		{"is_active", func(c middleware.ClientState) any { return c.IsActive }},
+	},
+	key:         func(c middleware.ClientState) string { return c.ClientID },
+	defaultSort: "client_id",
+}
+
+// absoluteURL returns the URL clients use to reach path on this service, honoring
+// the base path the request came in under and forwarding headers from trusted
+// proxies. Every generated link goes through it.
+func (r *Router) absoluteURL(req *http.Request, path string, query url.Values) string {
+	return r.trustedProxies.AbsoluteURL(req, requestcontext.BasePath(req.Context())+path, query)
+}
+
+// mountAt serves handler under basePath with the prefix stripped and recorded for
+// generated links; requests outside it are not found
+func mountAt(basePath string, handler http.Handler) http.Handler {
+	stripped := http.StripPrefix(basePath, handler)
+	mux := http.NewServeMux()
+	mux.Handle(basePath+"/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		stripped.ServeHTTP(w, req.WithContext(requestcontext.WithBasePath(req.Context(), basePath)))
+	}))
+	return mux
+}
+
+// debugLookupStats shows cache, prefetch and request coalescing counters
+func (r *Router) debugLookupStats(w http.ResponseWriter, req *http.Request) {
+	provider, ok := r.ipHandler.service.(services.LookupStatsProvider)
+	if !ok {
+		http.Error(w, "Lookup stats not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	jsonData, err := json.MarshalIndent(provider.LookupStats(), "", "  ")
+	if err != nil {
+		http.Error(w, "Failed to marshal stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(jsonData)
+}
+
+// debugRuntime shows the container limits detected at startup, the GOMAXPROCS and
+// GOMEMLIMIT applied from them and the values the runtime runs with now
+func (r *Router) debugRuntime(w http.ResponseWriter, req *http.Request) {
+	if r.runtime == nil {
+		http.Error(w, "Runtime settings not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	maxProcs, memoryLimit := runtimelimits.Current()
+	jsonData, err := json.MarshalIndent(map[string]any{
+		"startup": r.runtime,
+		"current": map[string]any{
+			"gomaxprocs":    maxProcs,
+			"gomemlimit":    memoryLimit,
+			"num_goroutine": runtime.NumGoroutine(),
+		},
+	}, "", "  ")
+	if err != nil {
+		http.Error(w, "Failed to marshal runtime settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(jsonData)
+}
+
 // SetupRoutesWithMiddleware configures routes with all middleware
 func (r *Router) SetupRoutesWithMiddleware(rateLimiter *middleware.RateLimiter) http.Handler {
-	// Create the base router
-	mux := r.SetupRoutes()
+	return r.publicChain(rateLimiter).Then(r.SetupRoutes())
+}
+
+// publicChain assembles the middleware of the public listener
+func (r *Router) publicChain(rateLimiter *middleware.RateLimiter) *middleware.Chain {
+	chain := middleware.NewChain().Disable(r.disabledMiddleware...)
+
+	// Recovery (should be first to catch panics)
+	chain.Use(middleware.StageRecovery, "recovery", middleware.RecoveryMiddlewareWithRecoverer(r.panicRecoverer()))
+
+	// Error message translation, outside every middleware that writes errors and outside
+	// error reporting, so reports keep the English message
+	if r.localizeErrors {
+		chain.Use(middleware.StageLogging, "localize_errors", middleware.LocalizeErrorsMiddleware())
+	}
+
+	// Canary experiments, outside logging so completed requests are logged with theirs
+	if r.experiments != nil && r.experiments.Len() > 0 {
+		chain.Use(middleware.StageLogging, "experiments", r.experiments.Middleware(r.logger))
+	}
+
+	chain.Use(middleware.StageLogging, "logging", middleware.LoggingMiddlewareWithSampler(r.logger, r.logSampler))
+
+	// Base path, stripped inside logging so logs show the path clients sent while
+	// every other middleware matches routes as if served from the root. Required,
+	// like the admission checks below: disabling a stage never changes which
+	// requests are routed or admitted.
+	if r.basePath != "" {
+		chain.Require(middleware.StageLogging, "base_path", func(next http.Handler) http.Handler { return mountAt(r.basePath, next) })
+	}
+
+	// Latency budgets, timed like request metrics so alerts match the latency histogram
+	if r.latencyBudgets != nil {
+		chain.Use(middleware.StageLogging, "latency_budgets", middleware.LatencyBudgetMiddleware(r.latencyBudgets))
+	}
+
+	// Request metrics, around fault injection so injected errors show up as they are served
+	if r.requestMetrics != nil {
+		chain.Use(middleware.StageLogging, "request_metrics", middleware.RequestMetricsMiddleware(r.requestMetrics))
+	}
+
+	// Fault injection, just inside logging so injected delays and errors are logged
+	if r.chaos != nil {
+		chain.Use(middleware.StageLogging, "chaos", middleware.ChaosMiddleware(r.chaos))
+	}
+
+	// Server error reporting, inside fault injection so injected errors aren't reported
+	if r.errorReporter != nil {
+		chain.Use(middleware.StageLogging, "error_reporting", middleware.ErrorReportingMiddleware(r.errorReporter))
+	}
+
+	// Malformed or ambiguous query strings are rejected before anything else reads them
+	chain.Require(middleware.StageAuth, "strict_query", middleware.StrictQueryMiddleware())
+
+	// Maintenance mode, checked before rate limiting so rejected requests don't consume tokens
+	if r.maintenance != nil {
+		chain.Require(middleware.StageAuth, "maintenance", middleware.MaintenanceMiddleware(r.maintenance))
+	}
+
+	// Load shedding, ahead of authentication so overload is rejected as cheaply as possible
+	if r.loadShedder != nil {
+		chain.Require(middleware.StageAuth, "load_shedding", middleware.LoadSheddingMiddleware(r.loadShedder))
+	}
+
+	// API key resolution, before rate limiting so unknown keys are rejected cheaply
+	if r.apiKeys != nil && r.apiKeys.Len() > 0 {
+		chain.Use(middleware.StageAuth, "api_keys", middleware.APIKeyMiddleware(r.apiKeys))
+	}
+
+	// JWT bearer tokens, resolved after API keys and before rate limiting so
+	// limits apply per token identity
+	if r.jwt != nil {
+		chain.Use(middleware.StageAuth, "jwt", middleware.JWTMiddleware(r.jwt))
+	}
+
+	// Signed requests, verified after API keys and JWTs
+	if r.hmac != nil {
+		chain.Use(middleware.StageAuth, "hmac", middleware.HMACMiddleware(r.hmac))
+	}
+
+	// Scheduled reports, recorded around rate limiting so throttled requests count as client errors
+	if r.reports != nil {
+		chain.Use(middleware.StageRateLimit, "reports", middleware.ReportMiddleware(r.reports))
+	}
 
-	// Apply middleware in order (last applied is first executed)
-	var handler http.Handler = mux
+	// Regular rate limiting; exempted probes never consume tokens
+	chain.Use(middleware.StageRateLimit, "rate_limit", middleware.RateLimitMiddlewareWithExemptions(rateLimiter, r.rateLimitExempt))
 
-	// Security headers
-	handler = middleware.SecurityHeadersMiddleware()(handler)
+	// Global (service-wide) limit, checked after per-client limiting so
+	// requests rejected per client don't consume the shared budget
+	if r.globalLimiter != nil {
+		chain.Use(middleware.StageRateLimit, "global_rate_limit", middleware.GlobalRateLimitMiddleware(r.globalLimiter))
+	}
+
+	// Billing usage, recorded around quotas so quota rejections are counted too
+	if r.usage != nil {
+		chain.Use(middleware.StageRateLimit, "usage", middleware.UsageMiddleware(r.usage))
+	}
 
-	// CORS
-	handler = middleware.CORSMiddleware()(handler)
+	// Long-horizon quotas, charged only for requests that passed per-client and global limits
+	if r.ipHandler.quota != nil {
+		chain.Use(middleware.StageRateLimit, "quota", middleware.QuotaMiddleware(r.ipHandler.quota))
+	}
 
 	// Debug rate limiting (higher limits for debug endpoints)
-	handler = middleware.DebugRateLimitMiddleware(rateLimiter)(handler)
+	chain.Use(middleware.StageRateLimit, "debug_rate_limit", middleware.DebugRateLimitMiddleware(rateLimiter))
 
-	// Regular rate limiting
-	handler = middleware.RateLimitMiddleware(rateLimiter)(handler)
+	chain.Use(middleware.StageCORS, "cors", middleware.CORSMiddleware())
 
-	// Logging
-	handler = middleware.LoggingMiddleware(r.logger)(handler)
+	chain.Use(middleware.StageSecurity, "security_headers", middleware.SecurityHeadersMiddleware())
 
-	// Recovery (should be first to catch panics)
-	handler = middleware.RecoveryMiddleware(r.logger)(handler)
+	// Shadow traffic, mirrored once the production response has been written
+	if r.shadower != nil {
+		chain.Use(middleware.StageCustom, "shadow", middleware.ShadowMiddleware(r.shadower))
+	}
+
+	// Request deadlines, innermost so rate-limited requests never start a timer
+	if r.timeouts.Default > 0 || len(r.timeouts.Routes) > 0 || r.timeouts.ClientHeader {
+		chain.Use(middleware.StageCustom, "timeout", middleware.TimeoutMiddleware(r.timeouts))
+	}
+
+	return chain
+}
+
+// panicRecoverer returns the configured recoverer, or one that only logs
+func (r *Router) panicRecoverer() *middleware.PanicRecoverer {
+	if r.recoverer != nil {
+		return r.recoverer
+	}
+	return middleware.NewPanicRecoverer(r.logger, nil)
+}
+
+// SetupAdminRoutesWithMiddleware returns the handler of the internal admin listener.
+// Its chain only resolves credentials, logs and recovers: operational requests are
+// never rate limited, metered, shadowed or rejected by maintenance mode.
+func (r *Router) SetupAdminRoutesWithMiddleware() http.Handler {
+	return r.adminChain().Then(r.SetupAdminRoutes())
+}
+
+// adminChain assembles the middleware of the admin listener
+func (r *Router) adminChain() *middleware.Chain {
+	chain := middleware.NewChain().Disable(r.disabledMiddleware...)
+	chain.Use(middleware.StageRecovery, "recovery", middleware.RecoveryMiddlewareWithRecoverer(r.panicRecoverer()))
+	chain.Use(middleware.StageLogging, "logging", middleware.LoggingMiddlewareWithSampler(r.logger, r.logSampler))
+	if r.requestMetrics != nil {
+		chain.Use(middleware.StageLogging, "request_metrics", middleware.RequestMetricsMiddleware(r.requestMetrics))
+	}
+
+	chain.Require(middleware.StageAuth, "strict_query", middleware.StrictQueryMiddleware())
+
+	// Credentials are resolved as on the public listener so roles apply the same way
+	if r.apiKeys != nil && r.apiKeys.Len() > 0 {
+		chain.Use(middleware.StageAuth, "api_keys", middleware.APIKeyMiddleware(r.apiKeys))
+	}
+	if r.jwt != nil {
+		chain.Use(middleware.StageAuth, "jwt", middleware.JWTMiddleware(r.jwt))
+	}
+	if r.hmac != nil {
+		chain.Use(middleware.StageAuth, "hmac", middleware.HMACMiddleware(r.hmac))
+	}
 
-	return handler
+	chain.Use(middleware.StageSecurity, "security_headers", middleware.SecurityHeadersMiddleware())
+	return chain
 }
@@ -1,13 +1,31 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"ip-geolocation-service/internal/buildinfo"
+	"ip-geolocation-service/internal/health"
+	"ip-geolocation-service/internal/metrics"
 	"ip-geolocation-service/internal/middleware"
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/privacy"
+	"ip-geolocation-service/internal/quota"
+	"ip-geolocation-service/internal/runtimelimits"
+	"ip-geolocation-service/internal/services"
+	"ip-geolocation-service/internal/watchdog"
 )
 
 func TestNewRouter(t *testing.T) {
@@ -118,3 +136,916 @@ func TestRouter_SetupRoutesWithMiddleware_NilRateLimiter(t *testing.T) {
 		t.Error("Handler not properly configured with nil rate limiter")
 	}
 }
+
+func TestRouter_MiddlewareOrder(t *testing.T) {
+	rateLimiter := middleware.NewRateLimiter(100, 200, 1, time.Minute, 5*time.Minute)
+	router := NewRouterWithOptions(&MockIPService{}, slog.Default(), RouterOptions{
+		BasePath:    "/geo",
+		Maintenance: middleware.NewMaintenanceMode(false, "down"),
+		Timeouts:    middleware.TimeoutConfig{Default: time.Second},
+	})
+
+	want := []string{"recovery", "logging", "base_path", "strict_query", "maintenance", "rate_limit", "debug_rate_limit",
+		"cors", "security_headers", "timeout"}
+	if got := router.publicChain(rateLimiter).Names(); !slices.Equal(got, want) {
+		t.Errorf("Public chain = %v, want %v", got, want)
+	}
+
+	router.disabledMiddleware = []string{"cors", "ratelimit"}
+	want = []string{"recovery", "logging", "base_path", "strict_query", "maintenance", "security_headers", "timeout"}
+	if got := router.publicChain(rateLimiter).Names(); !slices.Equal(got, want) {
+		t.Errorf("Public chain with cors and ratelimit disabled = %v, want %v", got, want)
+	}
+	want = []string{"recovery", "logging", "strict_query", "security_headers"}
+	if got := router.adminChain().Names(); !slices.Equal(got, want) {
+		t.Errorf("Admin chain = %v, want %v", got, want)
+	}
+
+	// Routing and admission stay when their stages are disabled
+	router.disabledMiddleware = []string{"logging", "auth"}
+	want = []string{"recovery", "base_path", "strict_query", "maintenance", "rate_limit", "debug_rate_limit",
+		"cors", "security_headers", "timeout"}
+	if got := router.publicChain(rateLimiter).Names(); !slices.Equal(got, want) {
+		t.Errorf("Public chain with logging and auth disabled = %v, want %v", got, want)
+	}
+	handler := router.SetupRoutesWithMiddleware(rateLimiter)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/geo/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /geo/health with logging disabled: expected status 200, got %d", w.Code)
+	}
+}
+
+func TestRouter_RejectsAmbiguousQueries(t *testing.T) {
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	handler := NewRouter(service, slog.Default()).SetupRoutesWithMiddleware(middleware.NewRateLimiter(100, 200, 1, time.Minute, 5*time.Minute))
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantCode   string
+	}{
+		{"ip=8.8.8.8", http.StatusOK, ""},
+		{"ip=8.8.8.8&ip=1.1.1.1", http.StatusBadRequest, "duplicate_parameter"},
+		{"ip=8.8.8.8&ip=8.8.8.8", http.StatusBadRequest, "duplicate_parameter"},
+		{"ip=8.8.8.8&lang=%zz", http.StatusBadRequest, "malformed_query"},
+		{"ip=8.8.8.8;lang=en", http.StatusBadRequest, "malformed_query"},
+		{"ip=8.8.8.8%00", http.StatusBadRequest, "malformed_query"},
+		{"ip=8.8.8.8&lang=%ff", http.StatusBadRequest, "malformed_query"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1/find-country?"+tt.query, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("GET ?%s status = %d, want %d: %s", tt.query, w.Code, tt.wantStatus, w.Body.String())
+			continue
+		}
+		var body models.ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if body.Code != tt.wantCode {
+			t.Errorf("GET ?%s code = %q, want %q", tt.query, body.Code, tt.wantCode)
+		}
+	}
+}
+
+func TestRouter_DebugLookupStats(t *testing.T) {
+	logger := slog.Default()
+
+	// Mock service does not expose lookup stats
+	router := NewRouter(NewMockIPService(), logger)
+	mux := router.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/debug/lookup-stats", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestRouter_DebugRuntime(t *testing.T) {
+	applied := &runtimelimits.Applied{
+		Limits:         runtimelimits.Limits{Cgroup: "v2", CPUQuota: 2, MemoryLimit: 1 << 30},
+		GOMAXPROCS:     2,
+		GOMAXPROCSFrom: runtimelimits.SourceCgroup,
+	}
+	router := NewRouterWithOptions(NewMockIPService(), slog.Default(), RouterOptions{Runtime: applied})
+	mux := router.SetupRoutes()
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/debug/runtime", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var body struct {
+		Startup runtimelimits.Applied `json:"startup"`
+		Current struct {
+			GOMAXPROCS int `json:"gomaxprocs"`
+		} `json:"current"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Startup != *applied {
+		t.Errorf("Expected the startup settings %+v, got %+v", *applied, body.Startup)
+	}
+	if body.Current.GOMAXPROCS < 1 {
+		t.Errorf("Expected the current GOMAXPROCS, got %d", body.Current.GOMAXPROCS)
+	}
+
+	// Without startup settings the endpoint is unavailable
+	w = httptest.NewRecorder()
+	NewRouter(NewMockIPService(), slog.Default()).SetupRoutes().ServeHTTP(w, httptest.NewRequest("GET", "/debug/runtime", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d without runtime settings, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestRouter_HealthHistory(t *testing.T) {
+	service := NewMockIPService()
+	history := health.NewHistory(10)
+	mux := NewRouterWithOptions(service, slog.Default(), RouterOptions{HealthHistory: history}).SetupRoutes()
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	get("/health")
+	service.SetHealthError(errors.New("repository health check failed"))
+	get("/health")
+	service.SetHealthError(nil)
+	get("/health")
+
+	w := get("/health/history")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var snapshot health.Snapshot
+	if err := json.Unmarshal(w.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if snapshot.Recorded != 3 || snapshot.Failed != 1 || len(snapshot.Checks) != 3 {
+		t.Fatalf("Expected 3 checks with 1 failure, got %+v", snapshot)
+	}
+	if snapshot.Checks[0].Status != health.StatusHealthy || snapshot.Checks[1].Status != health.StatusUnhealthy {
+		t.Errorf("Expected the most recent check first, got %+v", snapshot.Checks)
+	}
+	if snapshot.LastFailure == nil || snapshot.LastFailure.Error != "repository health check failed" {
+		t.Errorf("Expected the last failure with its error, got %+v", snapshot.LastFailure)
+	}
+
+	// Only the failures
+	w = get("/health/history?failed=true")
+	json.Unmarshal(w.Body.Bytes(), &snapshot)
+	if len(snapshot.Checks) != 1 || snapshot.Checks[0].Status != health.StatusUnhealthy {
+		t.Errorf("Expected only the failed check, got %+v", snapshot.Checks)
+	}
+	if w := get("/health/history?failed=maybe"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid failed parameter, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Without a history the endpoint is unavailable
+	w = httptest.NewRecorder()
+	NewRouter(NewMockIPService(), slog.Default()).SetupRoutes().ServeHTTP(w, httptest.NewRequest("GET", "/health/history", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d without a history, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestRouter_HealthReportsWatchdog(t *testing.T) {
+	dog := watchdog.New(watchdog.Config{
+		Interval:  time.Millisecond,
+		Timeout:   time.Second,
+		Threshold: time.Second,
+		Failures:  1,
+		Path:      watchdog.ProbePath("", "8.8.8.8"),
+	})
+	mux := NewRouterWithOptions(NewMockIPService(), slog.Default(), RouterOptions{Watchdog: dog}).SetupRoutes()
+	getHealth := func() string {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	if body := getHealth(); strings.Contains(body, "degraded") {
+		t.Errorf("Expected no degraded flag before any probe, got %s", body)
+	}
+
+	// Probes answered with 500s degrade the instance, which stays in rotation
+	ctx, cancel := context.WithCancel(context.Background())
+	degraded := make(chan struct{})
+	failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) })
+	go dog.Run(ctx, failing, func(watchdog.State) {
+		cancel()
+		close(degraded)
+	})
+	select {
+	case <-degraded:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("Expected the watchdog to report degradation")
+	}
+
+	if body := getHealth(); !strings.Contains(body, `"degraded": true`) {
+		t.Errorf("Expected the degraded flag in /health, got %s", body)
+	}
+}
+
+// datedService is a service whose data was last modified at a fixed time
+type datedService struct {
+	services.IPService
+	modified time.Time
+}
+
+func (s datedService) DatasetModTime() time.Time { return s.modified }
+
+func TestRouter_StaleDatasets(t *testing.T) {
+	datasets := services.NewDatasetService("default", nil)
+	datasets.Add("default", "default.csv", datedService{NewMockIPService(), time.Now().Add(-72 * time.Hour)}, nil)
+	datasets.SetMaxAge(24*time.Hour, true)
+	mux := NewRouterWithOptions(datasets, slog.Default(), RouterOptions{Datasets: datasets}).SetupRoutes()
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	// Stale data leaves the instance in rotation, but flagged
+	if w := get("/health"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"degraded": true`) {
+		t.Errorf("Expected a degraded but healthy instance, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Under the reject policy its lookups fail
+	w := get("/v1/find-country?ip=8.8.8.8")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"code":"dataset_stale"`) {
+		t.Errorf("Expected 503 with code dataset_stale, got %d %s", w.Code, w.Body.String())
+	}
+
+	datasets.SetMaxAge(0, false)
+	if w := get("/health"); strings.Contains(w.Body.String(), "degraded") {
+		t.Errorf("Expected no degraded flag without a maximum age, got %s", w.Body.String())
+	}
+}
+
+func TestRouter_DebugRateLimiter_Pagination(t *testing.T) {
+	rateLimiter := middleware.NewRateLimiter(100, 200, 1, 1*time.Minute, 5*time.Minute)
+	for _, clientID := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		rateLimiter.Allow(clientID)
+	}
+
+	router := NewRouterWithOptions(NewMockIPService(), slog.Default(), RouterOptions{
+		RateLimiter:       rateLimiter,
+		DebugClientIDMode: middleware.ClientIDModeTruncate,
+	})
+	mux := router.SetupRoutes()
+
+	testCases := []struct {
+		query  string
+		status int
+	}{
+		{"", http.StatusOK},
+		{"?limit=2&sort=-tokens", http.StatusOK},
+		{"?is_active=true", http.StatusOK},
+		{"?limit=0", http.StatusBadRequest},
+		{"?limit=abc", http.StatusBadRequest},
+		{"?sort=bogus", http.StatusBadRequest},
+		{"?limit=1&cursor=not-a-cursor", http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/debug/rate-limiter"+tc.query, nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, w.Code)
+			}
+			if tc.status == http.StatusOK && strings.Contains(w.Body.String(), "10.0.0.1\"") {
+				t.Errorf("Expected truncated client IDs, got raw ID in %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_DebugRateLimiter_NextLink(t *testing.T) {
+	rateLimiter := middleware.NewRateLimiter(100, 200, 1, 1*time.Minute, 5*time.Minute)
+	for _, clientID := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		rateLimiter.Allow(clientID)
+	}
+	proxies, err := middleware.NewTrustedProxies([]string{"192.0.2.0/24"})
+	if err != nil {
+		t.Fatalf("NewTrustedProxies() error = %v", err)
+	}
+
+	router := NewRouterWithOptions(NewMockIPService(), slog.Default(), RouterOptions{
+		RateLimiter:    rateLimiter,
+		TrustedProxies: proxies,
+	})
+	mux := router.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "http://backend:8080/debug/rate-limiter?limit=2", nil)
+	req.RemoteAddr = "192.0.2.10:4321"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "geo.example.com")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	var body struct {
+		Clients []struct {
+			ClientID string `json:"client_id"`
+		} `json:"clients"`
+		Pagination struct {
+			NextCursor string `json:"next_cursor"`
+			Next       string `json:"next"`
+		} `json:"pagination"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := "https://geo.example.com/debug/rate-limiter?cursor=" + body.Pagination.NextCursor + "&limit=2"
+	if body.Pagination.NextCursor == "" || body.Pagination.Next != want {
+		t.Errorf("Expected next link %s, got %s", want, body.Pagination.Next)
+	}
+	seen := len(body.Clients)
+
+	// The last page has no next link
+	next, err := url.Parse(body.Pagination.Next)
+	if err != nil {
+		t.Fatalf("Invalid next link: %v", err)
+	}
+	req = httptest.NewRequest("GET", "/debug/rate-limiter?"+next.RawQuery, nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	body.Pagination.Next = ""
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if seen += len(body.Clients); seen != 3 {
+		t.Errorf("Expected 3 clients across both pages, got %d", seen)
+	}
+	if body.Pagination.Next != "" {
+		t.Errorf("Expected no next link on the last page, got %s", body.Pagination.Next)
+	}
+}
+
+func TestRouter_BasePath(t *testing.T) {
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States"})
+	rateLimiter := middleware.NewRateLimiter(100, 200, 1, 1*time.Minute, 5*time.Minute)
+	for _, clientID := range []string{"10.0.0.1", "10.0.0.2"} {
+		rateLimiter.Allow(clientID)
+	}
+	router := NewRouterWithOptions(service, slog.Default(), RouterOptions{
+		RateLimiter: rateLimiter,
+		BasePath:    "/geo",
+	})
+	handler := router.SetupRoutesWithMiddleware(rateLimiter)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/geo/v1/find-country?ip=8.8.8.8", http.StatusOK},
+		{"/geo/health", http.StatusOK},
+		{"/geo", http.StatusTemporaryRedirect},
+		{"/v1/find-country?ip=8.8.8.8", http.StatusNotFound},
+		{"/health", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("GET %s: expected status %d, got %d", tt.path, tt.want, w.Code)
+		}
+	}
+
+	// Generated links keep the prefix
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "http://backend:8080/geo/debug/rate-limiter?limit=1", nil))
+	var body struct {
+		Pagination struct {
+			Next string `json:"next"`
+		} `json:"pagination"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := "http://backend:8080/geo/debug/rate-limiter?cursor="
+	if !strings.HasPrefix(body.Pagination.Next, want) {
+		t.Errorf("Expected next link %s, got %s", want, body.Pagination.Next)
+	}
+}
+
+// Clients sign the path they send, prefix included
+func TestRouter_BasePathSignedRequest(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	verifier, err := middleware.NewHMACVerifier(map[string]string{"partner": secret}, nil, time.Minute)
+	if err != nil {
+		t.Fatalf("NewHMACVerifier() error = %v", err)
+	}
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States"})
+	rateLimiter := middleware.NewRateLimiter(100, 200, 1, time.Minute, 5*time.Minute)
+	handler := NewRouterWithOptions(service, slog.Default(), RouterOptions{
+		RateLimiter: rateLimiter,
+		BasePath:    "/geo",
+		HMAC:        verifier,
+	}).SetupRoutesWithMiddleware(rateLimiter)
+
+	now := time.Now().Unix()
+	for _, tt := range []struct {
+		signed string
+		want   int
+	}{
+		{"/geo/v1/find-country?ip=8.8.8.8", http.StatusOK},
+		{"/v1/find-country?ip=8.8.8.8", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/geo/v1/find-country?ip=8.8.8.8", nil)
+		req.Header.Set(middleware.SignatureKeyHeader, "partner")
+		req.Header.Set(middleware.SignatureTimestampHeader, strconv.FormatInt(now, 10))
+		req.Header.Set(middleware.SignatureHeader, middleware.Sign([]byte(secret), now, "GET", tt.signed, nil))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("Request signed over %s: expected status %d, got %d: %s", tt.signed, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRouter_SeparateAdmin(t *testing.T) {
+	registry := metrics.NewRegistry()
+	rateLimiter := middleware.NewRateLimiter(1, 1, 1, time.Minute, 5*time.Minute)
+	router := NewRouterWithOptions(NewMockIPService(), slog.Default(), RouterOptions{
+		RateLimiter:   rateLimiter,
+		Metrics:       registry,
+		Maintenance:   middleware.NewMaintenanceMode(true, "Down for maintenance"),
+		SeparateAdmin: true,
+		AdminInsecure: true,
+	})
+	public := router.SetupRoutes()
+	admin := router.SetupAdminRoutesWithMiddleware()
+
+	serve := func(handler http.Handler, path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The public listener never serves operational endpoints, whatever the auth setup
+	for _, path := range []string{"/metrics", "/admin/maintenance", "/debug/rate-limiter", "/version"} {
+		if code := serve(public, path); code != http.StatusNotFound {
+			t.Errorf("public %s: status = %d, want 404", path, code)
+		}
+	}
+
+	// The admin listener skips rate limiting and maintenance mode, and serves no API
+	for i := 0; i < 3; i++ {
+		for _, path := range []string{"/metrics", "/admin/maintenance", "/debug/rate-limiter", "/version", "/health"} {
+			if code := serve(admin, path); code != http.StatusOK {
+				t.Errorf("admin %s: status = %d, want 200", path, code)
+			}
+		}
+	}
+	if code := serve(admin, "/v1/find-country?ip=8.8.8.8"); code != http.StatusNotFound {
+		t.Errorf("admin /v1/find-country: status = %d, want 404", code)
+	}
+}
+
+// versionedService is a mock service reporting a dataset version
+type versionedService struct {
+	*MockIPService
+	version string
+}
+
+func (s versionedService) DatasetVersion() string { return s.version }
+
+func TestRouter_Version(t *testing.T) {
+	datasets := services.NewDatasetService("default", nil)
+	datasets.Add("default", "default.csv", versionedService{NewMockIPService(), "3f9a1c0b7d2e"}, nil)
+
+	build := buildinfo.Info{Version: "1.2.0", Commit: "abc123", BuildDate: "2026-03-10T12:00:00Z", GoVersion: "go1.24.0"}
+	router := NewRouterWithOptions(datasets, slog.Default(), RouterOptions{Datasets: datasets, Build: build})
+	mux := router.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/version", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := map[string]string{
+		"version":         "1.2.0",
+		"commit":          "abc123",
+		"build_date":      "2026-03-10T12:00:00Z",
+		"go_version":      "go1.24.0",
+		"dataset":         "default",
+		"dataset_version": "3f9a1c0b7d2e",
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("Expected %s %q, got %q", key, value, body[key])
+		}
+	}
+
+	req = httptest.NewRequest("POST", "/version", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d for POST, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestRouter_Metrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.NewCounter("test_router_total", "Router test").Inc()
+
+	router := NewRouterWithOptions(NewMockIPService(), slog.Default(), RouterOptions{Metrics: registry})
+	mux := router.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "test_router_total 1") {
+		t.Errorf("Expected metrics output, got %s", w.Body.String())
+	}
+}
+
+func TestRouter_APIKeyRoles(t *testing.T) {
+	apiKeys, err := middleware.NewAPIKeyStoreWithRoles(
+		map[string]string{"reader-key": "", "ops-key": "", "admin-key": ""},
+		map[string]string{"ops-key": "metrics", "admin-key": "admin"},
+	)
+	if err != nil {
+		t.Fatalf("NewAPIKeyStoreWithRoles() error = %v", err)
+	}
+	ipService := NewMockIPService()
+	ipService.SetLocation("8.8.8.8", &models.Location{Country: "US", City: "Mountain View"})
+	router := NewRouterWithOptions(ipService, slog.Default(), RouterOptions{
+		Metrics:      metrics.NewRegistry(),
+		Maintenance:  middleware.NewMaintenanceMode(false, ""),
+		APIKeys:      apiKeys,
+		AuthRequired: true,
+	})
+	handler := router.SetupRoutesWithMiddleware(middleware.NewRateLimiter(100, 200, 1, time.Minute, 5*time.Minute))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		want   int
+	}{
+		{"anonymous lookup", "GET", "/v1/find-country?ip=8.8.8.8", "", http.StatusUnauthorized},
+		{"reader lookup", "GET", "/v1/find-country?ip=8.8.8.8", "reader-key", http.StatusOK},
+		{"metrics key lookup", "GET", "/v1/find-country?ip=8.8.8.8", "ops-key", http.StatusForbidden},
+		{"reader metrics", "GET", "/metrics", "reader-key", http.StatusForbidden},
+		{"metrics key metrics", "GET", "/metrics", "ops-key", http.StatusOK},
+		{"reader debug", "GET", "/debug/rate-limiter", "reader-key", http.StatusForbidden},
+		{"anonymous health", "GET", "/health", "", http.StatusOK},
+		{"anonymous admin", "GET", "/admin/maintenance", "", http.StatusUnauthorized},
+		{"reader admin", "PUT", "/admin/maintenance", "reader-key", http.StatusForbidden},
+		{"metrics key admin", "PUT", "/admin/maintenance", "ops-key", http.StatusForbidden},
+		{"admin key admin", "GET", "/admin/maintenance", "admin-key", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"enabled": true}`))
+		if tt.key != "" {
+			req.Header.Set(middleware.APIKeyHeader, tt.key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
+
+// Without an admin credential the admin endpoints are disabled unless opted into
+func TestRouter_AdminFailsClosed(t *testing.T) {
+	tests := []struct {
+		name string
+		opts RouterOptions
+		want int
+	}{
+		{"no credential", RouterOptions{}, http.StatusNotFound},
+		{"insecure opt-in", RouterOptions{AdminInsecure: true}, http.StatusOK},
+		{"admin token", RouterOptions{AdminToken: "secret"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		tt.opts.Maintenance = middleware.NewMaintenanceMode(false, "")
+		mux := NewRouterWithOptions(NewMockIPService(), slog.Default(), tt.opts).SetupRoutes()
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/admin/maintenance", nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+		if tt.want == http.StatusNotFound && !strings.Contains(w.Body.String(), `"code": "admin_disabled"`) {
+			t.Errorf("%s: expected the admin_disabled code, got %s", tt.name, w.Body.String())
+		}
+	}
+}
+
+// Reader keys alone don't leave the admin endpoints open
+func TestRouter_AdminRequiresAdminRole(t *testing.T) {
+	router := NewRouterWithOptions(NewMockIPService(), slog.Default(), RouterOptions{
+		Maintenance: middleware.NewMaintenanceMode(false, ""),
+		APIKeys:     middleware.NewAPIKeyStore(map[string]string{"reader-key": ""}),
+	})
+	handler := router.SetupRoutesWithMiddleware(middleware.NewRateLimiter(100, 200, 1, time.Minute, 5*time.Minute))
+
+	tests := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"reader key", "reader-key", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("PUT", "/admin/maintenance", strings.NewReader(`{"enabled": true}`))
+		if tt.key != "" {
+			req.Header.Set(middleware.APIKeyHeader, tt.key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
+
+func TestRouter_DoNotStore(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(privacy.NewRedactingLogHandler(slog.NewJSONHandler(&logs, nil)))
+
+	repo := services.NewMockRepository()
+	repo.SetLocation("198.51.100.7", &models.Location{Country: "US", City: "Mountain View"})
+	cache := services.NewLocationCache(10, 0)
+	service := services.NewIPServiceWithOptions(repo, services.ServiceOptions{Cache: cache, DoNotStore: true, Backend: "csv"})
+
+	registry := metrics.NewRegistry()
+	rateLimiter := middleware.NewRateLimiter(100, 200, 1, time.Minute, 5*time.Minute)
+	rateLimiter.RegisterMetrics(registry)
+	router := NewRouterWithOptions(service, logger, RouterOptions{Metrics: registry, RateLimiter: rateLimiter})
+	handler := router.SetupRoutesWithMiddleware(rateLimiter)
+
+	for _, ip := range []string{"198.51.100.7", "198.51.100.7", "203.0.113.9"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1/find-country?ip="+ip, nil))
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, ip := range []string{"198.51.100.7", "203.0.113.9"} {
+		if strings.Contains(logs.String(), ip) {
+			t.Errorf("Queried IP %s appears in logs: %s", ip, logs.String())
+		}
+		if strings.Contains(w.Body.String(), ip) {
+			t.Errorf("Queried IP %s appears in metrics", ip)
+		}
+	}
+	if !strings.Contains(logs.String(), privacy.Redacted) {
+		t.Errorf("Expected redacted log fields, got %s", logs.String())
+	}
+
+	// Request metrics label lookups by backend and cache status, never by address
+	for _, line := range []string{
+		`ipgeo_http_requests_total{route="/v1/find-country",method="GET",status_class="2xx",backend="csv",cache="hit"} 1`,
+		`ipgeo_http_requests_total{route="/v1/find-country",method="GET",status_class="4xx",backend="csv",cache="miss"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, w.Body.String())
+		}
+	}
+}
+
+func TestRouter_Drain(t *testing.T) {
+	repo := services.NewMockRepository()
+	repo.SetLocation("198.51.100.7", &models.Location{Country: "US", City: "Mountain View"})
+	service := services.NewIPService(repo)
+
+	drain := middleware.NewDrainMode()
+	router := NewRouterWithOptions(service, slog.Default(), RouterOptions{Drain: drain, AdminInsecure: true})
+	mux := router.SetupRoutes()
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := serve("POST", "/admin/drain"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"draining": true`) {
+		t.Fatalf("POST /admin/drain = %d %s, want draining state", w.Code, w.Body.String())
+	}
+	if w := serve("GET", "/health"); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "draining") {
+		t.Errorf("GET /health while draining = %d %s, want 503 draining", w.Code, w.Body.String())
+	}
+	if w := serve("GET", "/v1/find-country?ip=198.51.100.7"); w.Code != http.StatusOK {
+		t.Errorf("GET /v1/find-country while draining = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if w := serve("POST", "/admin/undrain"); w.Code != http.StatusOK || drain.Draining() {
+		t.Fatalf("POST /admin/undrain = %d %s, want ready state", w.Code, w.Body.String())
+	}
+	if w := serve("GET", "/health"); w.Code != http.StatusOK {
+		t.Errorf("GET /health after undrain = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := serve("DELETE", "/admin/drain"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /admin/drain = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestRouter_WarmUp(t *testing.T) {
+	warmUp := middleware.NewWarmUp()
+	router := NewRouterWithOptions(NewMockIPService(), slog.Default(), RouterOptions{WarmUp: warmUp})
+	mux := router.SetupRoutes()
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "warming_up") {
+		t.Errorf("GET /health while warming up = %d %s, want 503 warming_up", w.Code, w.Body.String())
+	}
+
+	warmUp.Finish()
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /health after warm-up = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRouter_Usage(t *testing.T) {
+	apiKeys, err := middleware.NewAPIKeyStoreWithRoles(map[string]string{"client-key": ""}, nil)
+	if err != nil {
+		t.Fatalf("NewAPIKeyStoreWithRoles() error = %v", err)
+	}
+	ipService := NewMockIPService()
+	ipService.SetLocation("8.8.8.8", &models.Location{Country: "US", City: "Mountain View"})
+	router := NewRouterWithOptions(ipService, slog.Default(), RouterOptions{
+		APIKeys: apiKeys,
+		Quota:   quota.NewTracker(quota.NewMemoryStore(""), quota.Limits{Daily: 10, Monthly: 100}),
+	})
+	handler := router.SetupRoutesWithMiddleware(middleware.NewRateLimiter(100, 200, 1, time.Minute, 5*time.Minute))
+
+	serve := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if key != "" {
+			req.Header.Set(middleware.APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		serve("/v1/find-country?ip=8.8.8.8", "client-key")
+	}
+
+	w := serve("/v1/usage", "client-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /v1/usage status = %d, want %d (%s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	var usage quota.Usage
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+		t.Fatalf("Failed to decode usage: %v", err)
+	}
+	if usage.Daily == nil || usage.Daily.Used != 3 || usage.Daily.Remaining != 7 || usage.Monthly == nil || usage.Monthly.Used != 3 {
+		t.Errorf("Usage = %+v, want 3 used of each quota", usage)
+	}
+	if strings.Contains(usage.Client, "key:") {
+		t.Errorf("Usage client = %s, want the masked key ID", usage.Client)
+	}
+	if w.Header().Get("X-Quota-Monthly-Remaining") != "97" {
+		t.Errorf("X-Quota-Monthly-Remaining = %q, want 97", w.Header().Get("X-Quota-Monthly-Remaining"))
+	}
+
+	if w := serve("/v1/usage", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous GET /v1/usage status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+// BenchmarkRouter_FindCountry measures a lookup through the full middleware chain
+func BenchmarkRouter_FindCountry(b *testing.B) {
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rateLimiter := middleware.NewRateLimiter(1e9, 1e9, time.Second, time.Minute, 5*time.Minute)
+	handler := NewRouter(service, logger).SetupRoutesWithMiddleware(rateLimiter)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				b.Fatalf("Expected status 200, got %d", w.Code)
+			}
+		}
+	})
+}
+
+func TestRouter_ReadOnly(t *testing.T) {
+	maintenance := middleware.NewMaintenanceMode(false, "")
+	router := NewRouterWithOptions(NewMockIPService(), slog.Default(), RouterOptions{
+		Maintenance: maintenance,
+		Drain:       middleware.NewDrainMode(),
+		AdminToken:  "secret",
+		ReadOnly:    true,
+	})
+	mux := router.SetupRoutes()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"admin read", "GET", "/admin/maintenance", "secret", http.StatusOK},
+		{"anonymous read", "GET", "/admin/maintenance", "", http.StatusUnauthorized},
+		{"admin mutation", "PUT", "/admin/maintenance", "secret", http.StatusForbidden},
+		{"anonymous mutation", "POST", "/admin/drain", "", http.StatusForbidden},
+		{"unknown admin mutation", "DELETE", "/admin/nothing", "secret", http.StatusForbidden},
+		{"lookup", "GET", "/v1/find-country?ip=8.8.8.8", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"enabled": true}`))
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+		if tt.want == http.StatusForbidden && !strings.Contains(w.Body.String(), "read_only") {
+			t.Errorf("%s: expected a read_only error, got %s", tt.name, w.Body.String())
+		}
+	}
+	if maintenance.State().Enabled {
+		t.Error("Expected maintenance mode to stay off")
+	}
+}
+
+func TestRouter_LocalizeErrors(t *testing.T) {
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	router := NewRouterWithOptions(service, slog.Default(), RouterOptions{
+		Maintenance:    middleware.NewMaintenanceMode(false, ""),
+		LocalizeErrors: true,
+	})
+	handler := router.SetupRoutesWithMiddleware(middleware.NewRateLimiter(100, 200, 1, time.Minute, 5*time.Minute))
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptLanguage string
+		want           string
+	}{
+		{"handler error", "/v1/find-country?ip=192.0.2.1", "he-IL,he;q=0.9", `{"error":"לא נמצא מיקום עבור כתובת ה-IP שסופקה"}`},
+		{"middleware error", "/v1/find-country?ip=8.8.8.8&ip=1.1.1.1", "fr", `{"error":"paramètre de requête en double: ip","code":"duplicate_parameter"}`},
+		{"english", "/v1/find-country?ip=nope", "en", `{"error":"Invalid IP address format"}`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Language", tt.acceptLanguage)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Body.String() != tt.want {
+			t.Errorf("%s: body = %s, want %s", tt.name, w.Body.String(), tt.want)
+		}
+	}
+
+	// Successful lookups are untouched
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	req.Header.Set("Accept-Language", "fr")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "United States") || w.Header().Get("Content-Language") != "" {
+		t.Errorf("Expected an untranslated lookup, got %d %s", w.Code, w.Body.String())
+	}
+}
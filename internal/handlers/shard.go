@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"ip-geolocation-service/internal/shard"
+)
+
+// setShardHeaders names the ring position of addr and the instance holding it, so
+// clients can send follow-up queries for the address straight there
+func (h *IPHandler) setShardHeaders(w http.ResponseWriter, addr netip.Addr) {
+	if h.shards == nil {
+		return
+	}
+	key, owner := h.shards.Locate(addr)
+	w.Header().Set(shard.KeyHeader, strconv.FormatUint(uint64(key), 10))
+	w.Header().Set(shard.OwnerHeader, owner.Name)
+}
+
+// ShardMap handles GET /v1/shard-map, publishing the instances of a sharded
+// deployment and their points on the hash ring
+func (h *IPHandler) ShardMap(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		h.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.shards == nil {
+		h.sendErrorWithCode(w, "Sharding is not configured", "sharding_disabled", http.StatusNotFound)
+		return
+	}
+	h.sendJSON(w, h.shards.Map())
+}
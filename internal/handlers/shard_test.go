@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/shard"
+)
+
+func TestIPHandler_ShardHints(t *testing.T) {
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	handler := NewIPHandler(service, slog.Default())
+
+	// No headers and no map without sharding
+	w := httptest.NewRecorder()
+	handler.FindCountry(w, httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil))
+	if w.Header().Get(shard.KeyHeader) != "" || w.Header().Get(shard.OwnerHeader) != "" {
+		t.Error("Expected no shard headers without sharding")
+	}
+	w = httptest.NewRecorder()
+	handler.ShardMap(w, httptest.NewRequest("GET", "/v1/shard-map", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the shard map without sharding, got %d", w.Code)
+	}
+
+	ring, err := shard.New(map[string]string{"geo-a": "http://geo-a:8080", "geo-b": "http://geo-b:8080"}, "geo-a", 8)
+	if err != nil {
+		t.Fatalf("shard.New() error = %v", err)
+	}
+	handler.shards = ring
+	key, owner := ring.Locate(netip.MustParseAddr("8.8.8.8"))
+
+	// Found or not, the address's shard is named
+	for _, target := range []string{"/v1/find-country?ip=8.8.8.8", "/v1/find-country?ip=::ffff:8.8.8.8"} {
+		w := httptest.NewRecorder()
+		handler.FindCountry(w, httptest.NewRequest("GET", target, nil))
+		if got := w.Header().Get(shard.KeyHeader); got != strconv.FormatUint(uint64(key), 10) {
+			t.Errorf("%s: %s = %q, want %d", target, shard.KeyHeader, got, key)
+		}
+		if got := w.Header().Get(shard.OwnerHeader); got != owner.Name {
+			t.Errorf("%s: %s = %q, want %s", target, shard.OwnerHeader, got, owner.Name)
+		}
+	}
+	w = httptest.NewRecorder()
+	handler.FindCountry(w, httptest.NewRequest("GET", "/v1/find-country?ip=192.0.2.1", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get(shard.OwnerHeader) == "" {
+		t.Errorf("Expected a 404 naming the shard, got %d with %s %q", w.Code, shard.OwnerHeader, w.Header().Get(shard.OwnerHeader))
+	}
+
+	w = httptest.NewRecorder()
+	handler.ShardMap(w, httptest.NewRequest("GET", "/v1/shard-map", nil))
+	var m shard.Map
+	if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+		t.Fatalf("Invalid shard map %s: %v", w.Body.String(), err)
+	}
+	if m.Self != "geo-a" || len(m.Nodes) != 2 || len(m.Ring) != 16 {
+		t.Errorf("Unexpected shard map %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ShardMap(w, httptest.NewRequest("POST", "/v1/shard-map", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", w.Code)
+	}
+}
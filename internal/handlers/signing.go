@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"ip-geolocation-service/internal/jws"
+	"ip-geolocation-service/internal/services"
+)
+
+// jwksResponse is the body of /.well-known/jwks.json
+type jwksResponse struct {
+	Keys []jws.JWK `json:"keys"`
+}
+
+// writeSigned sends body as a 200 response. With response signing configured, the
+// body's detached JWS goes in the X-JWS-Signature header, naming the dataset and
+// version that answered when info has them.
+func (h *IPHandler) writeSigned(w http.ResponseWriter, body []byte, info *services.LookupInfo) {
+	if h.signer != nil {
+		var dataset, version string
+		if info != nil {
+			dataset, version = info.Dataset, info.DatasetVersion
+		}
+		signature, err := h.signer.Sign(body, dataset, version)
+		if err != nil {
+			h.logger.Error("Failed to sign response", "error", err)
+			h.sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(jws.Header, signature)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// SigningKeys handles GET /.well-known/jwks.json, publishing the key that verifies
+// signed responses
+func (h *IPHandler) SigningKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		h.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.signer == nil {
+		h.sendErrorWithCode(w, "Response signing is not configured", "signing_disabled", http.StatusNotFound)
+		return
+	}
+	h.sendJSON(w, jwksResponse{Keys: []jws.JWK{h.signer.PublicJWK()}})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ip-geolocation-service/internal/jws"
+	"ip-geolocation-service/internal/models"
+)
+
+func TestIPHandler_SignedResponses(t *testing.T) {
+	service := NewMockIPService()
+	service.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	handler := NewIPHandler(service, slog.Default())
+
+	// Unsigned by default, and no key is published
+	w := httptest.NewRecorder()
+	handler.FindCountry(w, httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil))
+	if w.Header().Get(jws.Header) != "" {
+		t.Error("Expected no signature without a signing key")
+	}
+	w = httptest.NewRecorder()
+	handler.SigningKeys(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the JWKS without a signing key, got %d", w.Code)
+	}
+
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	handler.signer = jws.NewSigner(key, "test")
+
+	for _, target := range []string{"/v1/find-country?ip=8.8.8.8", "/v1/find-country?ip=8.8.8.8&include_meta=true"} {
+		w := httptest.NewRecorder()
+		handler.FindCountry(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", target, w.Code)
+		}
+		protected, err := jws.Verify(w.Header().Get(jws.Header), w.Body.Bytes(), key.Public().(ed25519.PublicKey))
+		if err != nil || protected.KeyID != "test" {
+			t.Errorf("%s: Verify() = %+v, %v", target, protected, err)
+		}
+	}
+
+	// Errors aren't signed
+	w = httptest.NewRecorder()
+	handler.FindCountry(w, httptest.NewRequest("GET", "/v1/find-country?ip=192.0.2.1", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get(jws.Header) != "" {
+		t.Errorf("Expected an unsigned 404, got %d with signature %q", w.Code, w.Header().Get(jws.Header))
+	}
+
+	w = httptest.NewRecorder()
+	handler.SigningKeys(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	var keys jwksResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &keys); err != nil || len(keys.Keys) != 1 || keys.Keys[0].Kid != "test" || keys.Keys[0].Crv != "Ed25519" {
+		t.Errorf("Unexpected JWKS %s", w.Body.String())
+	}
+}
@@ -0,0 +1,121 @@
+// Package health keeps the results of recent health checks, so an operator looking
+// into a flapping readiness probe can see when checks failed, how long they took and
+// why, after the probe itself has moved on.
+package health
+
+import (
+	"sync"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// Health check outcomes, as reported in the status field of /health
+const (
+	StatusHealthy   = "healthy"
+	StatusUnhealthy = "unhealthy"
+	StatusDraining  = "draining"
+	StatusWarmingUp = "warming_up"
+	StatusLoading   = "loading"
+)
+
+// Check is the result of one health check
+type Check struct {
+	Time       time.Time `json:"time"`
+	DurationMS float64   `json:"duration_ms"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Healthy reports whether the check passed
+func (c Check) Healthy() bool {
+	return c.Status == StatusHealthy
+}
+
+// Snapshot is the state of a History
+type Snapshot struct {
+	Capacity    int     `json:"capacity"`
+	Recorded    uint64  `json:"recorded"` // Checks since startup, including those no longer kept
+	Failed      uint64  `json:"failed"`   // Checks since startup that didn't pass
+	LastFailure *Check  `json:"last_failure,omitempty"`
+	Checks      []Check `json:"checks"` // Most recent first
+}
+
+// History is a fixed-size ring of the most recent health checks
+type History struct {
+	mu          sync.Mutex
+	checks      []Check
+	next        int // Slot the next check is written to
+	full        bool
+	recorded    uint64
+	failed      uint64
+	lastFailure *Check
+}
+
+// NewHistory creates a history keeping the last size checks; size must be positive
+func NewHistory(size int) *History {
+	return &History{checks: make([]Check, size)}
+}
+
+// Record adds a check, replacing the oldest once the history is full
+func (h *History) Record(check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks[h.next] = check
+	h.next = (h.next + 1) % len(h.checks)
+	if h.next == 0 {
+		h.full = true
+	}
+	h.recorded++
+	if !check.Healthy() {
+		h.failed++
+		h.lastFailure = &check
+	}
+}
+
+// Snapshot returns the kept checks, most recent first, with the running totals
+func (h *History) Snapshot() Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := h.next
+	if h.full {
+		n = len(h.checks)
+	}
+	checks := make([]Check, 0, n)
+	for i := 1; i <= n; i++ {
+		checks = append(checks, h.checks[(h.next-i+len(h.checks))%len(h.checks)])
+	}
+
+	snapshot := Snapshot{
+		Capacity: len(h.checks),
+		Recorded: h.recorded,
+		Failed:   h.failed,
+		Checks:   checks,
+	}
+	if h.lastFailure != nil {
+		failure := *h.lastFailure
+		snapshot.LastFailure = &failure
+	}
+	return snapshot
+}
+
+// counts returns the running totals
+func (h *History) counts() (recorded, failed uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.recorded, h.failed
+}
+
+// RegisterMetrics exposes the check counters on the registry
+func (h *History) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewCounterFunc("ipgeo_health_checks_total", "Health checks answered by /health", func() float64 {
+		recorded, _ := h.counts()
+		return float64(recorded)
+	})
+	registry.NewCounterFunc("ipgeo_health_check_failures_total", "Health checks that didn't report healthy", func() float64 {
+		_, failed := h.counts()
+		return float64(failed)
+	})
+}
@@ -0,0 +1,59 @@
+package health
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+func TestHistory_KeepsMostRecentChecks(t *testing.T) {
+	history := NewHistory(3)
+	if snapshot := history.Snapshot(); len(snapshot.Checks) != 0 || snapshot.LastFailure != nil {
+		t.Fatalf("Expected an empty history, got %+v", snapshot)
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	statuses := []string{StatusHealthy, StatusUnhealthy, StatusHealthy, StatusDraining, StatusHealthy}
+	for i, status := range statuses {
+		history.Record(Check{Time: start.Add(time.Duration(i) * time.Second), Status: status})
+	}
+
+	snapshot := history.Snapshot()
+	if snapshot.Capacity != 3 || snapshot.Recorded != 5 || snapshot.Failed != 2 {
+		t.Errorf("Snapshot() = capacity %d, recorded %d, failed %d, want 3, 5, 2", snapshot.Capacity, snapshot.Recorded, snapshot.Failed)
+	}
+	var got []string
+	for _, check := range snapshot.Checks {
+		got = append(got, check.Status)
+	}
+	if want := []string{StatusHealthy, StatusDraining, StatusHealthy}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Checks = %v, want the last three, most recent first: %v", got, want)
+	}
+	if !snapshot.Checks[0].Time.Equal(start.Add(4 * time.Second)) {
+		t.Errorf("Expected the most recent check first, got %v", snapshot.Checks[0].Time)
+	}
+	if snapshot.LastFailure == nil || snapshot.LastFailure.Status != StatusDraining {
+		t.Errorf("LastFailure = %+v, want the draining check", snapshot.LastFailure)
+	}
+}
+
+func TestHistory_RegisterMetrics(t *testing.T) {
+	history := NewHistory(2)
+	registry := metrics.NewRegistry()
+	history.RegisterMetrics(registry)
+
+	history.Record(Check{Status: StatusHealthy})
+	history.Record(Check{Status: StatusUnhealthy, Error: "repository health check failed"})
+	history.Record(Check{Status: StatusHealthy})
+
+	var buf bytes.Buffer
+	registry.Write(&buf)
+	for _, want := range []string{"ipgeo_health_checks_total 3", "ipgeo_health_check_failures_total 1"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
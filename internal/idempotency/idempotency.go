@@ -0,0 +1,354 @@
+// Package idempotency lets clients retry mutating requests safely. A request sent
+// with an Idempotency-Key header runs once; retries with the same key get the stored
+// response back instead of applying the mutation again.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// Header names the client-chosen key of a request
+const Header = "Idempotency-Key"
+
+// ReplayedHeader marks responses served from the store
+const ReplayedHeader = "Idempotent-Replayed"
+
+// DefaultTTL is how long a stored response is replayed
+const DefaultTTL = 24 * time.Hour
+
+// MaxKeyLength bounds client-chosen keys
+const MaxKeyLength = 255
+
+// maxFingerprintBytes bounds the request body hashed into a fingerprint
+const maxFingerprintBytes = 512 << 20
+
+// Record is the stored outcome of a request
+type Record struct {
+	Fingerprint string    `json:"fingerprint"` // SHA-256 of the method, path, query and body
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	Expires     time.Time `json:"expires"`
+}
+
+// Store keeps request outcomes by key, in memory and optionally in a JSON file
+// rewritten after every stored outcome, so a retry after a restart is still caught
+type Store struct {
+	path string
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu       sync.Mutex
+	records  map[string]Record
+	inFlight map[string]bool
+
+	replays   *metrics.Counter
+	conflicts *metrics.Counter
+}
+
+// NewStore creates a store persisted to path ("" keeps it in memory); a zero ttl
+// uses DefaultTTL
+func NewStore(path string, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Store{
+		path:     path,
+		ttl:      ttl,
+		now:      time.Now,
+		records:  make(map[string]Record),
+		inFlight: make(map[string]bool),
+	}
+}
+
+// RegisterMetrics exposes replay and conflict counts on the registry
+func (s *Store) RegisterMetrics(registry *metrics.Registry) {
+	s.replays = registry.NewCounter("ipgeo_idempotent_replays_total",
+		"Requests answered with the stored response of an earlier request with the same Idempotency-Key")
+	s.conflicts = registry.NewCounter("ipgeo_idempotency_conflicts_total",
+		"Requests rejected for reusing an Idempotency-Key that is in flight or belongs to a different request")
+	registry.NewGaugeFunc("ipgeo_idempotency_keys", "Idempotency keys with a stored response",
+		func() float64 { return float64(s.Len()) })
+}
+
+// Load reads the stored outcomes from the file, if there is one
+func (s *Store) Load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read idempotency file %s: %w", s.path, err)
+	}
+	records := make(map[string]Record)
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("failed to parse idempotency file %s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = records
+	s.pruneLocked()
+	return nil
+}
+
+// Len returns the number of stored outcomes that haven't expired
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked()
+	return len(s.records)
+}
+
+// pruneLocked drops expired outcomes; s.mu must be held
+func (s *Store) pruneLocked() {
+	now := s.now()
+	for key, record := range s.records {
+		if !now.Before(record.Expires) {
+			delete(s.records, key)
+		}
+	}
+}
+
+// saveLocked rewrites the file with the stored outcomes; s.mu must be held
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.records)
+	if err != nil {
+		return fmt.Errorf("failed to save idempotency keys: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".idempotency-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to save idempotency keys: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save idempotency keys: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save idempotency keys: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save idempotency keys: %w", err)
+	}
+	return nil
+}
+
+// begin claims key for a request. It returns the stored outcome when the key has one,
+// or false when the key is already claimed by a request still in flight.
+func (s *Store) begin(key string) (Record, bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[key]; ok && s.now().Before(record.Expires) {
+		return record, true, true
+	}
+	if s.inFlight[key] {
+		return Record{}, false, false
+	}
+	s.inFlight[key] = true
+	return Record{}, false, true
+}
+
+// finish releases key, storing the request's outcome unless record is nil
+func (s *Store) finish(key string, record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inFlight, key)
+	if record == nil {
+		return nil
+	}
+	record.Expires = s.now().Add(s.ttl)
+	s.records[key] = *record
+	s.pruneLocked()
+	return s.saveLocked()
+}
+
+// Middleware makes mutating requests that carry an Idempotency-Key run at most once.
+// Retries with the same key and the same method, path, query and body get the stored
+// status and body with Idempotent-Replayed: true. A key reused for a different request
+// gets 422, and one whose first request is still running gets 409. Server errors aren't
+// stored, so requests failing with one can be retried. Failures to persist an outcome
+// are reported to onError.
+func (s *Store) Middleware(onError func(error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > MaxKeyLength {
+				writeError(w, http.StatusBadRequest, "idempotency_key_invalid",
+					fmt.Sprintf("%s must be at most %d characters", Header, MaxKeyLength))
+				return
+			}
+
+			stored, found, ok := s.begin(key)
+			if !ok {
+				s.conflict()
+				writeError(w, http.StatusConflict, "idempotency_key_in_progress",
+					"A request with this "+Header+" is still being processed")
+				return
+			}
+			if found {
+				sum, err := fingerprint(r, r.Body)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, "", "Failed to read request body")
+					return
+				}
+				if sum != stored.Fingerprint {
+					s.conflict()
+					writeError(w, http.StatusUnprocessableEntity, "idempotency_key_reused",
+						Header+" was already used for a different request")
+					return
+				}
+				if s.replays != nil {
+					s.replays.Inc()
+				}
+				if stored.ContentType != "" {
+					w.Header().Set("Content-Type", stored.ContentType)
+				}
+				w.Header().Set(ReplayedHeader, "true")
+				w.WriteHeader(stored.Status)
+				w.Write(stored.Body)
+				return
+			}
+
+			// Hash the body as the handler reads it, then whatever it left unread
+			hasher := newBodyHasher(r)
+			r.Body = hasher
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			defer func() {
+				// A handler that panicked or failed with a server error may be retried
+				var record *Record
+				if completed && recorder.status < http.StatusInternalServerError {
+					record = &Record{
+						Fingerprint: hasher.sum(),
+						Status:      recorder.status,
+						ContentType: recorder.Header().Get("Content-Type"),
+						Body:        recorder.body.Bytes(),
+					}
+				}
+				if err := s.finish(key, record); err != nil && onError != nil {
+					onError(err)
+				}
+			}()
+			next.ServeHTTP(recorder, r)
+			completed = true
+		})
+	}
+}
+
+// conflict counts a rejected request
+func (s *Store) conflict() {
+	if s.conflicts != nil {
+		s.conflicts.Inc()
+	}
+}
+
+// fingerprint hashes what identifies a request: its method, path, query and body
+func fingerprint(r *http.Request, body io.Reader) (string, error) {
+	h := newFingerprintHash(r)
+	if body != nil {
+		if _, err := io.Copy(h, io.LimitReader(body, maxFingerprintBytes)); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// newFingerprintHash starts a fingerprint with the request line
+func newFingerprintHash(r *http.Request) hash.Hash {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", r.Method, r.URL.Path, r.URL.RawQuery)
+	return h
+}
+
+// bodyHasher passes a request body through to the handler while fingerprinting it
+type bodyHasher struct {
+	body io.ReadCloser
+	hash hash.Hash
+	read int64
+}
+
+func newBodyHasher(r *http.Request) *bodyHasher {
+	body := r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	return &bodyHasher{body: body, hash: newFingerprintHash(r)}
+}
+
+func (b *bodyHasher) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.hash.Write(p[:n])
+	b.read += int64(n)
+	return n, err
+}
+
+func (b *bodyHasher) Close() error {
+	return b.body.Close()
+}
+
+// sum returns the request's fingerprint, hashing any body the handler left unread
+func (b *bodyHasher) sum() string {
+	if remaining := maxFingerprintBytes - b.read; remaining > 0 {
+		io.Copy(b.hash, io.LimitReader(b.body, remaining))
+	}
+	return hex.EncodeToString(b.hash.Sum(nil))
+}
+
+// responseRecorder passes a response through while keeping its status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// writeError sends a JSON error in the shape the admin endpoints use
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	body := map[string]string{"error": message}
+	if code != "" {
+		body["code"] = code
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
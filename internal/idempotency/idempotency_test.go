@@ -0,0 +1,156 @@
+package idempotency
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingHandler applies a "mutation" per request and echoes the body back
+func countingHandler(calls *atomic.Int32, status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"call":%d,"body":%q}`, n, body)
+	})
+}
+
+func send(handler http.Handler, method, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/admin/overrides", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware_ReplaysRetries(t *testing.T) {
+	var calls atomic.Int32
+	handler := NewStore("", 0).Middleware(nil)(countingHandler(&calls, http.StatusCreated))
+
+	first := send(handler, http.MethodPost, "key-1", "a")
+	retry := send(handler, http.MethodPost, "key-1", "a")
+
+	if calls.Load() != 1 {
+		t.Fatalf("Handler ran %d times, want 1", calls.Load())
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("Retry = %d %q, want %d %q", retry.Code, retry.Body.String(), first.Code, first.Body.String())
+	}
+	if retry.Header().Get(ReplayedHeader) != "true" || first.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("%s = %q on the retry, %q on the first request", ReplayedHeader,
+			retry.Header().Get(ReplayedHeader), first.Header().Get(ReplayedHeader))
+	}
+	if retry.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Retry Content-Type = %q", retry.Header().Get("Content-Type"))
+	}
+
+	// Requests without a key, and reads, always run
+	send(handler, http.MethodPost, "", "a")
+	send(handler, http.MethodGet, "key-1", "")
+	if calls.Load() != 3 {
+		t.Errorf("Handler ran %d times, want 3", calls.Load())
+	}
+}
+
+func TestMiddleware_RejectsReusedKey(t *testing.T) {
+	var calls atomic.Int32
+	handler := NewStore("", 0).Middleware(nil)(countingHandler(&calls, http.StatusOK))
+
+	send(handler, http.MethodPost, "key-1", "a")
+	if rec := send(handler, http.MethodPost, "key-1", "b"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Different body = %d, want 422", rec.Code)
+	}
+	if rec := send(handler, http.MethodDelete, "key-1", "a"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Different method = %d, want 422", rec.Code)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Handler ran %d times, want 1", calls.Load())
+	}
+}
+
+func TestMiddleware_RejectsKeyInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := NewStore("", 0).Middleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		send(handler, http.MethodPost, "key-1", "a")
+		close(done)
+	}()
+	<-started
+	if rec := send(handler, http.MethodPost, "key-1", "a"); rec.Code != http.StatusConflict {
+		t.Errorf("Concurrent retry = %d, want 409", rec.Code)
+	}
+	close(release)
+	<-done
+}
+
+func TestMiddleware_ServerErrorsAreNotStored(t *testing.T) {
+	var calls atomic.Int32
+	handler := NewStore("", 0).Middleware(nil)(countingHandler(&calls, http.StatusServiceUnavailable))
+
+	send(handler, http.MethodPost, "key-1", "a")
+	if rec := send(handler, http.MethodPost, "key-1", "a"); rec.Header().Get(ReplayedHeader) != "" {
+		t.Error("Server error was replayed")
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Handler ran %d times, want 2", calls.Load())
+	}
+}
+
+func TestMiddleware_RejectsLongKey(t *testing.T) {
+	var calls atomic.Int32
+	handler := NewStore("", 0).Middleware(nil)(countingHandler(&calls, http.StatusOK))
+
+	if rec := send(handler, http.MethodPost, strings.Repeat("k", MaxKeyLength+1), "a"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Long key = %d, want 400", rec.Code)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("Handler ran %d times, want 0", calls.Load())
+	}
+}
+
+func TestStore_PersistsAndExpires(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotency.json")
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	store := NewStore(path, time.Hour)
+	store.now = func() time.Time { return now }
+	var calls atomic.Int32
+	send(store.Middleware(nil)(countingHandler(&calls, http.StatusOK)), http.MethodPost, "key-1", "a")
+
+	// A restarted service still recognizes the retry
+	restarted := NewStore(path, time.Hour)
+	restarted.now = func() time.Time { return now.Add(30 * time.Minute) }
+	if err := restarted.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	handler := restarted.Middleware(nil)(countingHandler(&calls, http.StatusOK))
+	if rec := send(handler, http.MethodPost, "key-1", "a"); rec.Header().Get(ReplayedHeader) != "true" {
+		t.Error("Retry after a restart wasn't replayed")
+	}
+
+	// Past the TTL the key is forgotten
+	restarted.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if restarted.Len() != 0 {
+		t.Errorf("Len() after expiry = %d, want 0", restarted.Len())
+	}
+	send(handler, http.MethodPost, "key-1", "a")
+	if calls.Load() != 2 {
+		t.Errorf("Handler ran %d times, want 2", calls.Load())
+	}
+}
@@ -0,0 +1,91 @@
+// Package ipclass classifies IP addresses into special-purpose ranges (private,
+// loopback, CGNAT, documentation, ...) as listed in the IANA special-purpose registries.
+package ipclass
+
+import "net/netip"
+
+// Address classes
+const (
+	Public        = "public"
+	Private       = "private"
+	Loopback      = "loopback"
+	LinkLocal     = "link_local"
+	CGNAT         = "cgnat"
+	Multicast     = "multicast"
+	Documentation = "documentation"
+	Bogon         = "bogon" // Any other reserved or unallocated range
+)
+
+// Classification describes the range an address belongs to
+type Classification struct {
+	IP    string `json:"ip"`
+	Class string `json:"class"`
+	Range string `json:"range,omitempty"` // Matching special-purpose range; empty for public addresses
+	// Public is true only for globally routable addresses; every other class is a
+	// bogon in the routing sense and should never appear as a real client address
+	Public bool `json:"public"`
+	Bogon  bool `json:"bogon"`
+}
+
+// specialRange is a special-purpose prefix and its class
+type specialRange struct {
+	prefix netip.Prefix
+	class  string
+}
+
+// specialRanges are checked in order; prefixes don't overlap within a family
+var specialRanges = []specialRange{
+	// IPv4
+	{netip.MustParsePrefix("0.0.0.0/8"), Bogon},
+	{netip.MustParsePrefix("10.0.0.0/8"), Private},
+	{netip.MustParsePrefix("100.64.0.0/10"), CGNAT},
+	{netip.MustParsePrefix("127.0.0.0/8"), Loopback},
+	{netip.MustParsePrefix("169.254.0.0/16"), LinkLocal},
+	{netip.MustParsePrefix("172.16.0.0/12"), Private},
+	{netip.MustParsePrefix("192.0.0.0/24"), Bogon},
+	{netip.MustParsePrefix("192.0.2.0/24"), Documentation},
+	{netip.MustParsePrefix("192.88.99.0/24"), Bogon},
+	{netip.MustParsePrefix("192.168.0.0/16"), Private},
+	{netip.MustParsePrefix("198.18.0.0/15"), Bogon},
+	{netip.MustParsePrefix("198.51.100.0/24"), Documentation},
+	{netip.MustParsePrefix("203.0.113.0/24"), Documentation},
+	{netip.MustParsePrefix("224.0.0.0/4"), Multicast},
+	{netip.MustParsePrefix("240.0.0.0/4"), Bogon},
+
+	// IPv6
+	{netip.MustParsePrefix("::/128"), Bogon},
+	{netip.MustParsePrefix("::1/128"), Loopback},
+	{netip.MustParsePrefix("100::/64"), Bogon},
+	{netip.MustParsePrefix("2001:db8::/32"), Documentation},
+	{netip.MustParsePrefix("3fff::/20"), Documentation},
+	{netip.MustParsePrefix("fc00::/7"), Private},
+	{netip.MustParsePrefix("fe80::/10"), LinkLocal},
+	{netip.MustParsePrefix("ff00::/8"), Multicast},
+}
+
+// globalUnicast is the only IPv6 block allocated for public unicast addresses
+var globalUnicast = netip.MustParsePrefix("2000::/3")
+
+// Classify returns the classification of addr. IPv4-mapped IPv6 addresses are
+// classified as the IPv4 address they carry.
+func Classify(addr netip.Addr) Classification {
+	addr = addr.Unmap()
+	result := Classification{IP: addr.String(), Class: Public, Public: true}
+
+	for _, special := range specialRanges {
+		if special.prefix.Contains(addr) {
+			result.Class = special.class
+			result.Range = special.prefix.String()
+			result.Public = false
+			break
+		}
+	}
+	if result.Public && addr.Is6() && !globalUnicast.Contains(addr) {
+		result.Class = Bogon
+		result.Range = ""
+		result.Public = false
+	}
+
+	result.Bogon = !result.Public
+	return result
+}
@@ -0,0 +1,54 @@
+package ipclass
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		ip    string
+		class string
+		rng   string
+	}{
+		{"8.8.8.8", Public, ""},
+		{"10.1.2.3", Private, "10.0.0.0/8"},
+		{"172.31.255.255", Private, "172.16.0.0/12"},
+		{"172.32.0.1", Public, ""},
+		{"192.168.1.1", Private, "192.168.0.0/16"},
+		{"127.0.0.1", Loopback, "127.0.0.0/8"},
+		{"169.254.169.254", LinkLocal, "169.254.0.0/16"},
+		{"100.64.0.1", CGNAT, "100.64.0.0/10"},
+		{"100.128.0.1", Public, ""},
+		{"224.0.0.251", Multicast, "224.0.0.0/4"},
+		{"192.0.2.10", Documentation, "192.0.2.0/24"},
+		{"198.51.100.7", Documentation, "198.51.100.0/24"},
+		{"203.0.113.200", Documentation, "203.0.113.0/24"},
+		{"0.0.0.0", Bogon, "0.0.0.0/8"},
+		{"198.18.0.1", Bogon, "198.18.0.0/15"},
+		{"255.255.255.255", Bogon, "240.0.0.0/4"},
+		{"::ffff:10.0.0.1", Private, "10.0.0.0/8"},
+		{"2606:4700:4700::1111", Public, ""},
+		{"::1", Loopback, "::1/128"},
+		{"::", Bogon, "::/128"},
+		{"fd12:3456::1", Private, "fc00::/7"},
+		{"fe80::1", LinkLocal, "fe80::/10"},
+		{"ff02::1", Multicast, "ff00::/8"},
+		{"2001:db8::1", Documentation, "2001:db8::/32"},
+		{"4000::1", Bogon, ""},
+	}
+
+	for _, tt := range tests {
+		got := Classify(netip.MustParseAddr(tt.ip))
+		if got.Class != tt.class || got.Range != tt.rng {
+			t.Errorf("Classify(%s) = %s %s, want %s %s", tt.ip, got.Class, got.Range, tt.class, tt.rng)
+		}
+		if got.Public != (tt.class == Public) || got.Bogon == got.Public {
+			t.Errorf("Classify(%s): public=%v bogon=%v inconsistent with class %s", tt.ip, got.Public, got.Bogon, got.Class)
+		}
+	}
+
+	if got := Classify(netip.MustParseAddr("::ffff:8.8.8.8")); got.IP != "8.8.8.8" {
+		t.Errorf("Expected mapped address to be reported as IPv4, got %s", got.IP)
+	}
+}
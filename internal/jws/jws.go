@@ -0,0 +1,154 @@
+// Package jws signs response bodies with detached JSON Web Signatures (RFC 7515,
+// appendix F), so clients reading responses through untrusted intermediaries can
+// verify that a body is unaltered and which dataset produced it.
+package jws
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Header carries the detached signature of a response body
+const Header = "X-JWS-Signature"
+
+// Algorithm is the JWS algorithm of Ed25519 signatures
+const Algorithm = "EdDSA"
+
+// ErrInvalidSignature is returned by Verify for signatures that don't match
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Protected is the signed JWS header. Dataset and DatasetVersion identify the data
+// that answered, so verifying the signature verifies them too.
+type Protected struct {
+	Algorithm      string `json:"alg"`
+	KeyID          string `json:"kid"`
+	IssuedAt       int64  `json:"iat"`
+	Dataset        string `json:"dataset,omitempty"`
+	DatasetVersion string `json:"dataset_version,omitempty"`
+}
+
+// JWK is the public half of the signing key as a JSON Web Key
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// Signer signs payloads with an Ed25519 key
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+	now   func() time.Time
+}
+
+// NewSigner creates a signer; an empty keyID uses the key's RFC 7638 thumbprint
+func NewSigner(key ed25519.PrivateKey, keyID string) *Signer {
+	s := &Signer{key: key, keyID: keyID, now: time.Now}
+	if s.keyID == "" {
+		s.keyID = Thumbprint(key.Public().(ed25519.PublicKey))
+	}
+	return s
+}
+
+// ParsePrivateKey decodes an Ed25519 private key given as hex or standard base64,
+// either the 32-byte seed or the 64-byte key
+func ParsePrivateKey(value string) (ed25519.PrivateKey, error) {
+	value = strings.TrimSpace(value)
+	var b []byte
+	var err error
+	if len(value) == hex.EncodedLen(ed25519.SeedSize) || len(value) == hex.EncodedLen(ed25519.PrivateKeySize) {
+		b, err = hex.DecodeString(value)
+	}
+	if b == nil {
+		b, err = base64.StdEncoding.DecodeString(value)
+	}
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("invalid Ed25519 private key: want hex or base64")
+	case len(b) == ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case len(b) == ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(b), nil
+	default:
+		return nil, fmt.Errorf("invalid Ed25519 private key: want a %d-byte seed or %d-byte key, got %d bytes",
+			ed25519.SeedSize, ed25519.PrivateKeySize, len(b))
+	}
+}
+
+// KeyID returns the key ID set in every signature
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// PublicJWK returns the verification key
+func (s *Signer) PublicJWK() JWK {
+	return JWK{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey)),
+		Kid: s.keyID,
+		Alg: Algorithm,
+		Use: "sig",
+	}
+}
+
+// Sign returns the detached compact serialization "header..signature" of payload
+func (s *Signer) Sign(payload []byte, dataset, datasetVersion string) (string, error) {
+	header, err := json.Marshal(Protected{
+		Algorithm:      Algorithm,
+		KeyID:          s.keyID,
+		IssuedAt:       s.now().Unix(),
+		Dataset:        dataset,
+		DatasetVersion: datasetVersion,
+	})
+	if err != nil {
+		return "", err
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(header)
+	signature := ed25519.Sign(s.key, signingInput(encodedHeader, payload))
+	return encodedHeader + ".." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks a detached signature over payload and returns its protected header
+func Verify(detached string, payload []byte, key ed25519.PublicKey) (Protected, error) {
+	var protected Protected
+	encodedHeader, encodedSignature, ok := strings.Cut(detached, "..")
+	if !ok {
+		return protected, fmt.Errorf("%w: not a detached JWS", ErrInvalidSignature)
+	}
+	header, err := base64.RawURLEncoding.DecodeString(encodedHeader)
+	if err != nil {
+		return protected, fmt.Errorf("%w: malformed header", ErrInvalidSignature)
+	}
+	if err := json.Unmarshal(header, &protected); err != nil || protected.Algorithm != Algorithm {
+		return protected, fmt.Errorf("%w: unsupported header", ErrInvalidSignature)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !ed25519.Verify(key, signingInput(encodedHeader, payload), signature) {
+		return protected, ErrInvalidSignature
+	}
+	return protected, nil
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of an Ed25519 public key
+func Thumbprint(key ed25519.PublicKey) string {
+	// Members in lexicographic order, without whitespace
+	canonical := `{"crv":"Ed25519","kty":"OKP","x":"` + base64.RawURLEncoding.EncodeToString(key) + `"}`
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// signingInput is the JWS signing input for a header and a payload
+func signingInput(encodedHeader string, payload []byte) []byte {
+	return []byte(encodedHeader + "." + base64.RawURLEncoding.EncodeToString(payload))
+}
@@ -0,0 +1,66 @@
+package jws
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSigner_SignVerify(t *testing.T) {
+	key, err := ParsePrivateKey("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := NewSigner(key, "")
+	signer.now = func() time.Time { return time.Unix(1700000000, 0) }
+	public := key.Public().(ed25519.PublicKey)
+
+	payload := []byte(`{"country":"United States","city":"Mountain View"}`)
+	signature, err := signer.Sign(payload, "default", "7e957357bd5f")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	protected, err := Verify(signature, payload, public)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if protected.KeyID != signer.KeyID() || protected.DatasetVersion != "7e957357bd5f" || protected.IssuedAt != 1700000000 {
+		t.Errorf("Unexpected protected header %+v", protected)
+	}
+
+	// A modified body fails
+	if _, err := Verify(signature, []byte(`{"country":"France"}`), public); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected a modified payload to fail, got %v", err)
+	}
+	// So does a header claiming another dataset version
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","kid":"x","iat":0,"dataset_version":"other"}`))
+	if _, err := Verify(forged+signature[len(signature)-88:], payload, public); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected a forged header to fail, got %v", err)
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 8037 appendix A.3
+	x, _ := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	if got := Thumbprint(ed25519.PublicKey(x)); got != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Errorf("Thumbprint() = %s", got)
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	for _, value := range []string{
+		base64.StdEncoding.EncodeToString(seed),
+		base64.StdEncoding.EncodeToString(ed25519.NewKeyFromSeed(seed)),
+	} {
+		if _, err := ParsePrivateKey(value); err != nil {
+			t.Errorf("ParsePrivateKey(%q) error = %v", value, err)
+		}
+	}
+	if _, err := ParsePrivateKey("not-a-key"); err == nil {
+		t.Error("Expected an invalid key to fail")
+	}
+}
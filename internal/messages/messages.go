@@ -0,0 +1,112 @@
+// Package messages translates the error messages sent to clients using an embedded
+// catalog, so consumer-facing apps can show them as they are. Messages are written in
+// English, which every message falls back to when the catalog lacks a translation.
+package messages
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Default is the language messages are written in
+const Default = "en"
+
+//go:embed messages.csv
+var catalogCSV string
+
+// catalog holds the translations of each message, keyed by language then message
+var catalog = mustParse(catalogCSV)
+
+// aliases are deprecated language codes still sent by some clients
+var aliases = map[string]string{
+	"iw": "he",
+}
+
+// Languages returns the supported languages, sorted
+func Languages() []string {
+	languages := []string{Default}
+	for lang := range catalog {
+		languages = append(languages, lang)
+	}
+	slices.Sort(languages)
+	return languages
+}
+
+// Negotiate picks the supported language the client prefers in an Accept-Language
+// header, matching region subtags such as fr-CA to their language, and Default when
+// it names none of them
+func Negotiate(acceptLanguage string) string {
+	best, bestQ := Default, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				continue
+			}
+			q = parsed
+		}
+		// Ties go to the language listed first
+		if lang, ok := supported(strings.TrimSpace(tag)); ok && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// supported returns the supported language of a language tag; "*" is Default
+func supported(tag string) (string, bool) {
+	if tag == "*" {
+		return Default, true
+	}
+	lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+	if alias, ok := aliases[lang]; ok {
+		lang = alias
+	}
+	if _, ok := catalog[lang]; ok || lang == Default {
+		return lang, true
+	}
+	return "", false
+}
+
+// Translate returns message in lang. Messages with a detail after ": ", such as
+// "duplicate query parameter: ip", have the part before it translated when the whole
+// message isn't in the catalog. It reports false when message is left in English.
+func Translate(lang, message string) (string, bool) {
+	translations := catalog[lang]
+	if translated, ok := translations[message]; ok {
+		return translated, true
+	}
+	if head, detail, ok := strings.Cut(message, ": "); ok {
+		if translated, ok := translations[head]; ok {
+			return translated + ": " + detail, true
+		}
+	}
+	return message, false
+}
+
+// mustParse builds the catalog from the embedded table
+func mustParse(data string) map[string]map[string]string {
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("messages: invalid embedded catalog: %v", err))
+	}
+
+	catalog := make(map[string]map[string]string)
+	for _, record := range records[1:] { // Skip header
+		message, lang, translation := record[0], record[1], record[2]
+		if catalog[lang] == nil {
+			catalog[lang] = make(map[string]string)
+		}
+		if _, exists := catalog[lang][message]; exists {
+			panic(fmt.Sprintf("messages: %q is translated to %s twice", message, lang))
+		}
+		catalog[lang][message] = translation
+	}
+	return catalog
+}
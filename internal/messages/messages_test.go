@@ -0,0 +1,74 @@
+package messages
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLanguages(t *testing.T) {
+	if got, want := Languages(), []string{"en", "fr", "he"}; !slices.Equal(got, want) {
+		t.Errorf("Languages() = %v, want %v", got, want)
+	}
+}
+
+// Every language translates every message in the catalog
+func TestCatalogIsComplete(t *testing.T) {
+	for lang, translations := range catalog {
+		for other, otherTranslations := range catalog {
+			for message := range otherTranslations {
+				if _, ok := translations[message]; !ok {
+					t.Errorf("%q is translated to %s but not to %s", message, other, lang)
+				}
+			}
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"he", "he"},
+		{"fr-CA", "fr"},
+		{"FR", "fr"},
+		{"iw-IL", "he"},
+		{"de-DE,fr;q=0.8,en;q=0.5", "fr"},
+		{"en-US,en;q=0.9,he;q=0.8", "en"},
+		{"de, he;q=0.3", "he"},
+		{"he;q=0.5, fr;q=0.9", "fr"},
+		{"fr, he", "fr"},
+		{"he;q=0, fr;q=0.1", "fr"},
+		{"he;q=2", "en"},
+		{"*", "en"},
+		{"de, ja", "en"},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.header); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		lang    string
+		message string
+		want    string
+		ok      bool
+	}{
+		{"fr", "Lookup timed out", "La recherche a expiré", true},
+		{"he", "Unknown dataset", "מאגר נתונים לא מוכר", true},
+		{"fr", "duplicate query parameter: ip", "paramètre de requête en double: ip", true},
+		{"fr", "Batch exceeds 100 addresses", "Batch exceeds 100 addresses", false},
+		{"en", "Lookup timed out", "Lookup timed out", false},
+		{"de", "Lookup timed out", "Lookup timed out", false},
+	}
+	for _, tt := range tests {
+		got, ok := Translate(tt.lang, tt.message)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Translate(%s, %q) = %q, %v, want %q, %v", tt.lang, tt.message, got, ok, tt.want, tt.ok)
+		}
+	}
+}
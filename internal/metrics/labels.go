@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Cardinality guards. Every series lives until the process exits, so a label fed
+// from request data (addresses, client IDs, raw paths) would grow without bound.
+const (
+	// MaxSeries caps the series of one labeled metric. Label combinations beyond it
+	// are folded into a single series whose values are all OverflowValue.
+	MaxSeries = 1000
+
+	// OverflowValue replaces the label values of series past MaxSeries
+	OverflowValue = "other"
+
+	// RedactedValue replaces label values that are IP addresses or prefixes
+	RedactedValue = "redacted"
+)
+
+// unboundedLabels are label names that name per-client or per-request values. Metrics
+// declaring them panic at registration, like duplicate names do.
+var unboundedLabels = map[string]bool{
+	"ip":          true,
+	"ip_address":  true,
+	"addr":        true,
+	"address":     true,
+	"client_ip":   true,
+	"remote_addr": true,
+	"client":      true,
+	"client_id":   true,
+	"api_key":     true,
+	"token":       true,
+	"user":        true,
+	"user_id":     true,
+	"request_id":  true,
+	"path":        true,
+	"url":         true,
+}
+
+// checkLabelNames panics when a metric declares a label that can't be bounded
+func checkLabelNames(name string, labelNames []string) {
+	for _, labelName := range labelNames {
+		if unboundedLabels[strings.ToLower(labelName)] {
+			panic(fmt.Sprintf("metrics: %s label %q is unbounded; use a bounded label such as a route or class", name, labelName))
+		}
+	}
+}
+
+// guardValues returns labelValues with addresses redacted, copying only when one is
+func guardValues(labelValues []string) []string {
+	var guarded []string
+	for i, value := range labelValues {
+		if !isAddress(value) {
+			continue
+		}
+		if guarded == nil {
+			guarded = append([]string(nil), labelValues...)
+		}
+		guarded[i] = RedactedValue
+	}
+	if guarded == nil {
+		return labelValues
+	}
+	return guarded
+}
+
+// isAddress reports whether value is an IP address or prefix
+func isAddress(value string) bool {
+	if !strings.ContainsAny(value, ".:") {
+		return false
+	}
+	if _, err := netip.ParseAddr(value); err == nil {
+		return true
+	}
+	_, err := netip.ParsePrefix(value)
+	return err == nil
+}
+
+// overflowValues is the label values of the series absorbing combinations past MaxSeries
+func overflowValues(n int) []string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = OverflowValue
+	}
+	return values
+}
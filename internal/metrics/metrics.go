@@ -0,0 +1,474 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Metric types as reported in the exposition format
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefaultBuckets are latency buckets in seconds suitable for in-memory lookups
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// collector is anything that can write itself in Prometheus text format
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds named metrics and renders them in Prometheus text format
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]collector
+}
+
+// NewRegistry creates an empty metrics registry
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]collector),
+	}
+}
+
+// register adds c to the registry, panicking on duplicate names like other metric libraries
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.collectors[c.name()]; exists {
+		panic(fmt.Sprintf("metrics: duplicate metric name %q", c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// Write renders all metrics sorted by name
+func (r *Registry) Write(w io.Writer) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mu.RUnlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler returns an http.Handler serving the registry in Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// desc holds the metadata common to every metric
+type desc struct {
+	metricName string
+	help       string
+	metricType string
+	labelNames []string
+}
+
+func (d *desc) name() string { return d.metricName }
+
+func (d *desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.metricName, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.metricName, d.metricType)
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	desc
+	bits atomic.Uint64
+}
+
+// NewCounter registers and returns a counter
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{desc: desc{metricName: name, help: help, metricType: TypeCounter}}
+	r.register(c)
+	return c
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add increments the counter by v; negative values are ignored
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	addFloat(&c.bits, v)
+}
+
+// Value returns the current counter value
+func (c *Counter) Value() float64 { return math.Float64frombits(c.bits.Load()) }
+
+func (c *Counter) write(w io.Writer) {
+	c.writeHeader(w)
+	writeSample(w, c.metricName, "", nil, nil, c.Value())
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	desc
+	bits atomic.Uint64
+}
+
+// NewGauge registers and returns a gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{desc: desc{metricName: name, help: help, metricType: TypeGauge}}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64) { g.bits.Store(math.Float64bits(v)) }
+
+// Inc increments the gauge by one
+func (g *Gauge) Inc() { addFloat(&g.bits, 1) }
+
+// Dec decrements the gauge by one
+func (g *Gauge) Dec() { addFloat(&g.bits, -1) }
+
+// Add adds v to the gauge
+func (g *Gauge) Add(v float64) { addFloat(&g.bits, v) }
+
+// Value returns the current gauge value
+func (g *Gauge) Value() float64 { return math.Float64frombits(g.bits.Load()) }
+
+func (g *Gauge) write(w io.Writer) {
+	g.writeHeader(w)
+	writeSample(w, g.metricName, "", nil, nil, g.Value())
+}
+
+// funcMetric reports a value computed at scrape time
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by fn at scrape time
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{desc: desc{metricName: name, help: help, metricType: TypeGauge}, fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is computed by fn at scrape time
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{desc: desc{metricName: name, help: help, metricType: TypeCounter}, fn: fn})
+}
+
+func (f *funcMetric) write(w io.Writer) {
+	f.writeHeader(w)
+	writeSample(w, f.metricName, "", nil, nil, f.fn())
+}
+
+// labeledValue is one series of a labeled counter or gauge
+type labeledValue struct {
+	values []string
+	bits   atomic.Uint64
+}
+
+// vec holds the series of a labeled counter or gauge
+type vec struct {
+	desc
+	mu       sync.RWMutex
+	children map[string]*labeledValue
+}
+
+func newVec(name, help, metricType string, labelNames []string) vec {
+	checkLabelNames(name, labelNames)
+	return vec{
+		desc:     desc{metricName: name, help: help, metricType: metricType, labelNames: labelNames},
+		children: make(map[string]*labeledValue),
+	}
+}
+
+// Value returns the value for the given label values
+func (v *vec) Value(labelValues ...string) float64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if c, exists := v.children[labelKey(guardValues(labelValues))]; exists {
+		return math.Float64frombits(c.bits.Load())
+	}
+	return 0
+}
+
+func (v *vec) child(labelValues []string) *labeledValue {
+	checkLabelCount(v.metricName, v.labelNames, labelValues)
+	labelValues = guardValues(labelValues)
+	key := labelKey(labelValues)
+
+	v.mu.RLock()
+	c, exists := v.children[key]
+	v.mu.RUnlock()
+	if exists {
+		return c
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, exists = v.children[key]; exists {
+		return c
+	}
+	if len(v.children) >= MaxSeries {
+		labelValues = overflowValues(len(labelValues))
+		key = labelKey(labelValues)
+		if c, exists = v.children[key]; exists {
+			return c
+		}
+	}
+	c = &labeledValue{values: append([]string(nil), labelValues...)}
+	v.children[key] = c
+	return c
+}
+
+func (v *vec) write(w io.Writer) {
+	v.writeHeader(w)
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	for _, key := range sortedKeys(v.children) {
+		c := v.children[key]
+		writeSample(w, v.metricName, "", v.labelNames, c.values, math.Float64frombits(c.bits.Load()))
+	}
+}
+
+// CounterVec is a set of counters partitioned by label values
+type CounterVec struct {
+	vec
+}
+
+// NewCounterVec registers and returns a labeled counter
+func (r *Registry) NewCounterVec(name, help string, labelNames []string) *CounterVec {
+	v := &CounterVec{vec: newVec(name, help, TypeCounter, labelNames)}
+	r.register(v)
+	return v
+}
+
+// Inc increments the counter for the given label values
+func (v *CounterVec) Inc(labelValues ...string) { v.Add(1, labelValues...) }
+
+// Add increments the counter for the given label values by delta
+func (v *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	addFloat(&v.child(labelValues).bits, delta)
+}
+
+// GaugeVec is a set of gauges partitioned by label values
+type GaugeVec struct {
+	vec
+}
+
+// NewGaugeVec registers and returns a labeled gauge
+func (r *Registry) NewGaugeVec(name, help string, labelNames []string) *GaugeVec {
+	v := &GaugeVec{vec: newVec(name, help, TypeGauge, labelNames)}
+	r.register(v)
+	return v
+}
+
+// Set sets the gauge for the given label values
+func (v *GaugeVec) Set(value float64, labelValues ...string) {
+	v.child(labelValues).bits.Store(math.Float64bits(value))
+}
+
+// Add adds delta to the gauge for the given label values
+func (v *GaugeVec) Add(delta float64, labelValues ...string) {
+	addFloat(&v.child(labelValues).bits, delta)
+}
+
+// Histogram samples observations into cumulative buckets
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers and returns an unlabeled histogram; nil buckets use DefaultBuckets
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	return r.NewHistogramVec(name, help, buckets, nil)
+}
+
+// NewHistogramVec registers and returns a labeled histogram; nil buckets use DefaultBuckets
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames []string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	checkLabelNames(name, labelNames)
+
+	h := &Histogram{
+		desc:    desc{metricName: name, help: help, metricType: TypeHistogram, labelNames: labelNames},
+		buckets: sorted,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records a single observation for the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	checkLabelCount(h.metricName, h.labelNames, labelValues)
+	labelValues = guardValues(labelValues)
+	key := labelKey(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, exists := h.series[key]
+	if !exists && len(h.series) >= MaxSeries {
+		labelValues = overflowValues(len(labelValues))
+		key = labelKey(labelValues)
+		s, exists = h.series[key]
+	}
+	if !exists {
+		s = &histogramSeries{
+			values: append([]string(nil), labelValues...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count returns the number of observations for the given label values
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s, exists := h.series[labelKey(guardValues(labelValues))]; exists {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.writeHeader(w)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		bucketLabels := append(append([]string(nil), h.labelNames...), "le")
+		for i, upper := range h.buckets {
+			values := append(append([]string(nil), s.values...), formatFloat(upper))
+			writeSample(w, h.metricName, "_bucket", bucketLabels, values, float64(s.counts[i]))
+		}
+		values := append(append([]string(nil), s.values...), "+Inf")
+		writeSample(w, h.metricName, "_bucket", bucketLabels, values, float64(s.count))
+		writeSample(w, h.metricName, "_sum", h.labelNames, s.values, s.sum)
+		writeSample(w, h.metricName, "_count", h.labelNames, s.values, float64(s.count))
+	}
+}
+
+// Helper functions
+
+func addFloat(bits *atomic.Uint64, delta float64) {
+	for {
+		old := bits.Load()
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if bits.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+func checkLabelCount(name string, labelNames, labelValues []string) {
+	if len(labelNames) != len(labelValues) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", name, len(labelNames), len(labelValues)))
+	}
+}
+
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeSample(w io.Writer, name, suffix string, labelNames, labelValues []string, value float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteString(suffix)
+	if len(labelNames) > 0 {
+		b.WriteByte('{')
+		for i, labelName := range labelNames {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labelName)
+			b.WriteString(`="`)
+			b.WriteString(escapeLabelValue(labelValues[i]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(value))
+	b.WriteByte('\n')
+	io.WriteString(w, b.String())
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
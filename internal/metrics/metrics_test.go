@@ -0,0 +1,231 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_CounterAndGauge(t *testing.T) {
+	registry := NewRegistry()
+
+	counter := registry.NewCounter("test_requests_total", "Total requests")
+	counter.Inc()
+	counter.Add(2)
+	counter.Add(-5) // ignored
+
+	gauge := registry.NewGauge("test_in_flight", "In-flight requests")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+
+	if counter.Value() != 3 {
+		t.Errorf("Expected counter value 3, got %v", counter.Value())
+	}
+	if gauge.Value() != 1 {
+		t.Errorf("Expected gauge value 1, got %v", gauge.Value())
+	}
+
+	var b strings.Builder
+	registry.Write(&b)
+	output := b.String()
+
+	expected := []string{
+		"# HELP test_requests_total Total requests",
+		"# TYPE test_requests_total counter",
+		"test_requests_total 3",
+		"# TYPE test_in_flight gauge",
+		"test_in_flight 1",
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+}
+
+func TestRegistry_Vectors(t *testing.T) {
+	registry := NewRegistry()
+
+	counterVec := registry.NewCounterVec("test_responses_total", "Responses", []string{"route", "status"})
+	counterVec.Inc("/v1/find-country", "2xx")
+	counterVec.Inc("/v1/find-country", "2xx")
+	counterVec.Inc("/health", "5xx")
+
+	gaugeVec := registry.NewGaugeVec("test_queue_depth", "Queue depth", []string{"queue"})
+	gaugeVec.Set(7, `a"b`)
+
+	if counterVec.Value("/v1/find-country", "2xx") != 2 {
+		t.Errorf("Expected 2, got %v", counterVec.Value("/v1/find-country", "2xx"))
+	}
+
+	var b strings.Builder
+	registry.Write(&b)
+	output := b.String()
+
+	expected := []string{
+		`test_responses_total{route="/v1/find-country",status="2xx"} 2`,
+		`test_responses_total{route="/health",status="5xx"} 1`,
+		`test_queue_depth{queue="a\"b"} 7`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+}
+
+func TestRegistry_Histogram(t *testing.T) {
+	registry := NewRegistry()
+
+	histogram := registry.NewHistogramVec("test_latency_seconds", "Latency", []float64{0.1, 1}, []string{"route"})
+	histogram.Observe(0.05, "/a")
+	histogram.Observe(0.5, "/a")
+	histogram.Observe(5, "/a")
+
+	if histogram.Count("/a") != 3 {
+		t.Errorf("Expected 3 observations, got %d", histogram.Count("/a"))
+	}
+
+	var b strings.Builder
+	registry.Write(&b)
+	output := b.String()
+
+	expected := []string{
+		`test_latency_seconds_bucket{route="/a",le="0.1"} 1`,
+		`test_latency_seconds_bucket{route="/a",le="1"} 2`,
+		`test_latency_seconds_bucket{route="/a",le="+Inf"} 3`,
+		`test_latency_seconds_sum{route="/a"} 5.55`,
+		`test_latency_seconds_count{route="/a"} 3`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+}
+
+func TestRegistry_FuncMetrics(t *testing.T) {
+	registry := NewRegistry()
+
+	value := 0.0
+	registry.NewGaugeFunc("test_func_gauge", "Func gauge", func() float64 { return value })
+	registry.NewCounterFunc("test_func_total", "Func counter", func() float64 { return value * 2 })
+
+	value = 21
+
+	var b strings.Builder
+	registry.Write(&b)
+	output := b.String()
+
+	if !strings.Contains(output, "test_func_gauge 21\n") {
+		t.Errorf("Expected gauge func value 21, got:\n%s", output)
+	}
+	if !strings.Contains(output, "# TYPE test_func_total counter\ntest_func_total 42\n") {
+		t.Errorf("Expected counter func value 42, got:\n%s", output)
+	}
+}
+
+func TestRegistry_DuplicateName(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("test_dup", "First")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic on duplicate metric name")
+		}
+	}()
+	registry.NewGauge("test_dup", "Second")
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("test_handler_total", "Handler test").Inc()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "test_handler_total 1") {
+		t.Errorf("Expected metric in body, got:\n%s", w.Body.String())
+	}
+}
+
+func TestRegistry_UnboundedLabel(t *testing.T) {
+	registry := NewRegistry()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic on a client_id label")
+		}
+	}()
+	registry.NewCounterVec("test_by_client_total", "By client", []string{"route", "client_id"})
+}
+
+func TestRegistry_RedactsAddresses(t *testing.T) {
+	registry := NewRegistry()
+
+	counterVec := registry.NewCounterVec("test_lookups_total", "Lookups", []string{"route"})
+	counterVec.Inc("8.8.8.8")
+	counterVec.Inc("2001:db8::/32")
+	counterVec.Inc("v1.2.3")
+
+	histogram := registry.NewHistogramVec("test_lookup_seconds", "Lookup latency", []float64{1}, []string{"route"})
+	histogram.Observe(0.5, "::1")
+
+	if got := counterVec.Value(RedactedValue); got != 2 {
+		t.Errorf("Expected 2 redacted lookups, got %v", got)
+	}
+	if got := histogram.Count(RedactedValue); got != 1 {
+		t.Errorf("Expected 1 redacted observation, got %d", got)
+	}
+
+	var b strings.Builder
+	registry.Write(&b)
+	output := b.String()
+	if strings.Contains(output, "8.8.8.8") || strings.Contains(output, "::1") {
+		t.Errorf("Expected addresses to be redacted, got:\n%s", output)
+	}
+	if !strings.Contains(output, `test_lookups_total{route="v1.2.3"} 1`+"\n") {
+		t.Errorf("Expected version label to be kept, got:\n%s", output)
+	}
+}
+
+func TestRegistry_MaxSeries(t *testing.T) {
+	registry := NewRegistry()
+
+	counterVec := registry.NewCounterVec("test_routes_total", "Routes", []string{"route", "status"})
+	histogram := registry.NewHistogramVec("test_route_seconds", "Route latency", []float64{1}, []string{"route"})
+	for i := 0; i < MaxSeries+10; i++ {
+		route := "/r" + strconv.Itoa(i)
+		counterVec.Inc(route, "2xx")
+		histogram.Observe(0.5, route)
+	}
+
+	if got := counterVec.Value(OverflowValue, OverflowValue); got != 10 {
+		t.Errorf("Expected 10 requests in the overflow series, got %v", got)
+	}
+	if got := histogram.Count(OverflowValue); got != 10 {
+		t.Errorf("Expected 10 observations in the overflow series, got %d", got)
+	}
+
+	// Existing series keep counting past the cap
+	counterVec.Inc("/r0", "2xx")
+	if got := counterVec.Value("/r0", "2xx"); got != 2 {
+		t.Errorf("Expected existing series to reach 2, got %v", got)
+	}
+
+	var b strings.Builder
+	registry.Write(&b)
+	if got := strings.Count(b.String(), "test_routes_total{"); got != MaxSeries+1 {
+		t.Errorf("Expected %d series, got %d", MaxSeries+1, got)
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+// Admin actors recorded in the audit log
+const (
+	AdminActorToken     = "admin-token"
+	AdminActorAnonymous = "anonymous"
+)
+
+// adminActorKey carries who is performing an admin request
+var adminActorKey = requestcontext.NewKey[string]("admin_actor")
+
+// AdminActorFromContext returns who is performing an admin request
+func AdminActorFromContext(ctx context.Context) string {
+	if actor, ok := adminActorKey.Value(ctx); ok {
+		return actor
+	}
+	return AdminActorAnonymous
+}
+
+// AdminAuthMiddleware protects admin endpoints. A request is allowed with
+// "Authorization: Bearer <token>" or an API key carrying the admin role; keys
+// without it get 403. When no token is set and requireKey is false the endpoints
+// stay open, matching the debug endpoints.
+func AdminAuthMiddleware(token string, requireKey bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if token == "" && !requireKey {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token != "" {
+				provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if ok && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+					ctx := adminActorKey.With(r.Context(), AdminActorToken)
+					next.ServeHTTP(w, r.WithContext(ctx))
+					return
+				}
+			}
+
+			if apiKey, ok := APIKeyFromContext(r.Context()); ok {
+				if !apiKey.HasRole(RoleAdmin) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusForbidden)
+					w.Write([]byte(`{"error": "API key does not have the admin role"}`))
+					return
+				}
+				actor := "key:" + apiKey.ID
+				if apiKey.Subject != "" {
+					actor = "jwt:" + apiKey.Subject
+				}
+				ctx := adminActorKey.With(r.Context(), actor)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "Unauthorized"}`))
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+// APIKeyHeader is the request header carrying a client API key
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is an authenticated client credential (a configured key or a validated JWT)
+// and what it is entitled to
+type APIKey struct {
+	ID       string   // Masked form of the key, safe to log
+	Dataset  string   // Dataset the key is pinned to ("" uses the default)
+	Roles    []string // Granted roles (RoleReader, RoleMetrics, RoleAdmin)
+	Subject  string   // Token subject for JWT-authenticated requests
+	ClientID string   // Rate-limit identity ("" limits by client IP)
+	QuotaID  string   // Identity for quotas and usage export, stable across restarts
+}
+
+// APIKeyStore resolves raw API keys
+type APIKeyStore struct {
+	keys map[string]APIKey
+}
+
+// NewAPIKeyStore creates a store from a map of raw key -> pinned dataset; every key gets the reader role
+func NewAPIKeyStore(keys map[string]string) *APIKeyStore {
+	store, _ := NewAPIKeyStoreWithRoles(keys, nil)
+	return store
+}
+
+// NewAPIKeyStoreWithRoles creates a store from raw key -> pinned dataset and raw key ->
+// "|"-separated roles. Keys without a roles entry get the reader role.
+func NewAPIKeyStoreWithRoles(keys, roles map[string]string) (*APIKeyStore, error) {
+	store := &APIKeyStore{keys: make(map[string]APIKey, len(keys))}
+	for key, dataset := range keys {
+		keyRoles := []string{RoleReader}
+		if value, exists := roles[key]; exists {
+			parsed, err := ParseRoles(value)
+			if err != nil {
+				return nil, fmt.Errorf("API key %s: %w", MaskClientID(key, ClientIDModeHash), err)
+			}
+			keyRoles = parsed
+		}
+
+		store.keys[key] = APIKey{
+			ID:      MaskClientID(key, ClientIDModeHash),
+			Dataset: dataset,
+			Roles:   keyRoles,
+			QuotaID: quotaKeyID(key),
+		}
+	}
+	return store, nil
+}
+
+// quotaKeyID derives a stable quota identity from a raw key. Unlike ID it is not
+// keyed per process, so usage persisted by one run is charged to the same key in
+// the next; API keys carry enough entropy that the hash can't be reversed.
+func quotaKeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:8])
+}
+
+// HasRole reports whether any configured key carries role
+func (s *APIKeyStore) HasRole(role string) bool {
+	for _, apiKey := range s.keys {
+		if apiKey.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the key entry for a raw API key
+func (s *APIKeyStore) Lookup(key string) (APIKey, bool) {
+	apiKey, exists := s.keys[key]
+	return apiKey, exists
+}
+
+// Len returns the number of configured keys
+func (s *APIKeyStore) Len() int {
+	return len(s.keys)
+}
+
+// apiKeyKey carries the authenticated APIKey through the request context
+var apiKeyKey = requestcontext.NewKey[APIKey]("api_key")
+
+// WithAPIKey returns a copy of ctx authenticated as apiKey
+func WithAPIKey(ctx context.Context, apiKey APIKey) context.Context {
+	return apiKeyKey.With(ctx, apiKey)
+}
+
+// APIKeyFromContext returns the API key authenticated for the request, if any
+func APIKeyFromContext(ctx context.Context) (APIKey, bool) {
+	return apiKeyKey.Value(ctx)
+}
+
+// APIKeyMiddleware resolves the X-API-Key header. Requests without a key pass through
+// anonymously; requests presenting an unknown key are rejected with 401.
+func APIKeyMiddleware(store *APIKeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(APIKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			apiKey, ok := store.Lookup(key)
+			if !ok {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error": "Invalid API key"}`))
+				return
+			}
+
+			ctx := WithAPIKey(r.Context(), apiKey)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	store := NewAPIKeyStore(map[string]string{"free-key": "free", "default-key": ""})
+
+	var seen APIKey
+	var authenticated bool
+	handler := APIKeyMiddleware(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, authenticated = APIKeyFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Anonymous requests pass through
+	req := httptest.NewRequest("GET", "/v1/find-country", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || authenticated {
+		t.Errorf("Expected anonymous pass-through, got status %d authenticated=%v", w.Code, authenticated)
+	}
+
+	// Known keys are attached to the context
+	req = httptest.NewRequest("GET", "/v1/find-country", nil)
+	req.Header.Set(APIKeyHeader, "free-key")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !authenticated || seen.Dataset != "free" {
+		t.Errorf("Expected free-key to resolve to dataset free, got %+v", seen)
+	}
+	if strings.Contains(seen.ID, "free-key") {
+		t.Errorf("Expected masked key ID, got %s", seen.ID)
+	}
+
+	// Unknown keys are rejected
+	req = httptest.NewRequest("GET", "/v1/find-country", nil)
+	req.Header.Set(APIKeyHeader, "bogus")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for unknown key, got %d", w.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// tracing records the middleware a request passes through
+func tracing(name string, trace *[]string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*trace = append(*trace, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestChain_OrdersByStage(t *testing.T) {
+	var trace []string
+	chain := NewChain().
+		Use(StageCustom, "custom", tracing("custom", &trace)).
+		Use(StageSecurity, "security", tracing("security", &trace)).
+		Use(StageAuth, "api_keys", tracing("api_keys", &trace)).
+		Use(StageAuth, "jwt", tracing("jwt", &trace)).
+		Use(StageRecovery, "recovery", tracing("recovery", &trace)).
+		Use(StageLogging, "logging", tracing("logging", &trace)).
+		Use(Stage("unknown"), "extra", tracing("extra", &trace))
+
+	chain.Then(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	want := []string{"recovery", "logging", "api_keys", "jwt", "security", "custom", "extra"}
+	if !slices.Equal(trace, want) {
+		t.Errorf("Requests passed through %v, want %v", trace, want)
+	}
+	if got := chain.Names(); !slices.Equal(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
+
+func TestChain_ReplacesDuplicatesAndDisables(t *testing.T) {
+	var trace []string
+	chain := NewChain().
+		Use(StageLogging, "logging", tracing("first logging", &trace)).
+		Use(StageAuth, "jwt", tracing("jwt", &trace)).
+		Use(StageCORS, "cors", tracing("cors", &trace)).
+		Use(StageLogging, "logging", tracing("second logging", &trace)).
+		Use(StageAuth, "jwt", nil)
+
+	chain.Then(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if want := []string{"second logging", "cors"}; !slices.Equal(trace, want) {
+		t.Errorf("Requests passed through %v, want %v", trace, want)
+	}
+
+	chain.Disable(string(StageCORS))
+	if got, want := chain.Names(), []string{"logging"}; !slices.Equal(got, want) {
+		t.Errorf("Names() with cors disabled = %v, want %v", got, want)
+	}
+	chain.Disable("logging")
+	if got := chain.Names(); len(got) != 0 {
+		t.Errorf("Names() with logging disabled by name = %v, want none", got)
+	}
+}
+
+func TestChain_Require(t *testing.T) {
+	var trace []string
+	chain := NewChain().
+		Use(StageLogging, "logging", tracing("logging", &trace)).
+		Require(StageLogging, "base_path", tracing("base_path", &trace)).
+		Require(StageAuth, "maintenance", tracing("maintenance", &trace)).
+		Use(StageAuth, "jwt", tracing("jwt", &trace)).
+		Disable(string(StageLogging), string(StageAuth), "maintenance")
+
+	chain.Then(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if want := []string{"base_path", "maintenance"}; !slices.Equal(trace, want) {
+		t.Errorf("Requests passed through %v, want %v", trace, want)
+	}
+}
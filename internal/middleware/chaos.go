@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/models"
+)
+
+// ChaosHeader is set on responses affected by fault injection: "latency", "error"
+// or both
+const ChaosHeader = "X-Chaos-Injected"
+
+// ChaosOptions configures fault injection
+type ChaosOptions struct {
+	LatencyPercent int           // Share of eligible requests delayed (0-100)
+	Latency        time.Duration // Delay added to those requests
+	Jitter         time.Duration // Random extra delay, up to this much
+	ErrorPercent   int           // Share of eligible requests failed (0-100)
+	ErrorStatus    int           // Status of failed requests (default 503)
+	Paths          []string      // Eligible path prefixes (default /v1/)
+}
+
+// Chaos injects latency and errors into a share of requests so clients can test
+// their timeouts and retries against a misbehaving service. Delay and failure are
+// decided independently, so a request may be delayed and then failed.
+type Chaos struct {
+	opts ChaosOptions
+
+	delayed atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// NewChaos creates a fault injector
+func NewChaos(opts ChaosOptions) *Chaos {
+	if opts.ErrorStatus == 0 {
+		opts.ErrorStatus = http.StatusServiceUnavailable
+	}
+	if len(opts.Paths) == 0 {
+		opts.Paths = []string{"/v1/"}
+	}
+	return &Chaos{opts: opts}
+}
+
+// eligible reports whether path may be affected; operational endpoints never are
+func (c *Chaos) eligible(path string) bool {
+	if isOperationalPath(path) {
+		return false
+	}
+	for _, prefix := range c.opts.Paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the latency to inject, or 0 for none
+func (c *Chaos) delay() time.Duration {
+	if !roll(c.opts.LatencyPercent) {
+		return 0
+	}
+	delay := c.opts.Latency
+	if c.opts.Jitter > 0 {
+		delay += rand.N(c.opts.Jitter + 1)
+	}
+	return delay
+}
+
+// roll returns true with the given percent probability
+func roll(percent int) bool {
+	return percent >= 100 || (percent > 0 && rand.IntN(100) < percent)
+}
+
+// RegisterMetrics exposes fault injection counters on the registry
+func (c *Chaos) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewCounterFunc("ipgeo_chaos_delayed_total",
+		"Total requests delayed by fault injection",
+		func() float64 { return float64(c.delayed.Load()) })
+	registry.NewCounterFunc("ipgeo_chaos_errors_total",
+		"Total requests failed by fault injection",
+		func() float64 { return float64(c.failed.Load()) })
+}
+
+// ChaosMiddleware delays and fails a share of eligible requests. Delays end early
+// if the client goes away.
+func ChaosMiddleware(chaos *Chaos) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !chaos.eligible(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var injected []string
+			if delay := chaos.delay(); delay > 0 {
+				chaos.delayed.Add(1)
+				injected = append(injected, "latency")
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-r.Context().Done():
+					timer.Stop()
+					return
+				}
+			}
+
+			if roll(chaos.opts.ErrorPercent) {
+				chaos.failed.Add(1)
+				injected = append(injected, "error")
+				w.Header().Set(ChaosHeader, strings.Join(injected, ","))
+				w.Header().Set("Content-Type", "application/json")
+				if chaos.opts.ErrorStatus == http.StatusServiceUnavailable || chaos.opts.ErrorStatus == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "1")
+				}
+				w.WriteHeader(chaos.opts.ErrorStatus)
+
+				response, err := models.NewErrorResponseWithCode("Injected fault", "chaos_injected").ToJSON()
+				if err != nil {
+					response = []byte(`{"error": "Injected fault", "code": "chaos_injected"}`)
+				}
+				w.Write(response)
+				return
+			}
+
+			if len(injected) > 0 {
+				w.Header().Set(ChaosHeader, strings.Join(injected, ","))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
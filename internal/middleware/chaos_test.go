@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+func TestChaosMiddleware_Errors(t *testing.T) {
+	chaos := NewChaos(ChaosOptions{ErrorPercent: 100, Paths: []string{"/v1/", "/health"}})
+	handler := ChaosMiddleware(chaos)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/v1/find-country", http.StatusServiceUnavailable},
+		{"/v2/find-country", http.StatusOK},
+		{"/health", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.want, w.Code)
+		}
+		if tt.want == http.StatusServiceUnavailable {
+			if !strings.Contains(w.Body.String(), "chaos_injected") {
+				t.Errorf("Expected chaos_injected code, got %s", w.Body.String())
+			}
+			if w.Header().Get(ChaosHeader) != "error" || w.Header().Get("Retry-After") != "1" {
+				t.Errorf("Unexpected headers %v", w.Header())
+			}
+		}
+	}
+
+	registry := metrics.NewRegistry()
+	chaos.RegisterMetrics(registry)
+	var out strings.Builder
+	registry.Write(&out)
+	if !strings.Contains(out.String(), "ipgeo_chaos_errors_total 1") {
+		t.Errorf("Expected one injected error in metrics, got:\n%s", out.String())
+	}
+}
+
+func TestChaosMiddleware_Latency(t *testing.T) {
+	chaos := NewChaos(ChaosOptions{LatencyPercent: 100, Latency: 20 * time.Millisecond, ErrorStatus: http.StatusInternalServerError})
+	handler := ChaosMiddleware(chaos)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1/find-country", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get(ChaosHeader) != "latency" {
+		t.Errorf("Expected delayed success, got %d %v", w.Code, w.Header())
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected at least 20ms delay, got %v", elapsed)
+	}
+
+	// A client that goes away ends the delay without reaching the handler
+	chaos = NewChaos(ChaosOptions{LatencyPercent: 100, Latency: time.Minute})
+	called := false
+	handler = ChaosMiddleware(chaos)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/find-country", nil).WithContext(ctx))
+	if called {
+		t.Error("Expected handler not to run after the client went away")
+	}
+}
+
+func TestChaosMiddleware_Disabled(t *testing.T) {
+	chaos := NewChaos(ChaosOptions{})
+	handler := ChaosMiddleware(chaos)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for range 100 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1/find-country", nil))
+		if w.Code != http.StatusOK || w.Header().Get(ChaosHeader) != "" {
+			t.Fatalf("Expected no injection at 0%%, got %d %v", w.Code, w.Header())
+		}
+	}
+}
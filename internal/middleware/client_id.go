@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+)
+
+// Client ID masking modes for debug output
+const (
+	ClientIDModeRaw      = "raw"
+	ClientIDModeHash     = "hash"
+	ClientIDModeTruncate = "truncate"
+)
+
+// clientIDHashKey is generated per process so hashed IDs are stable within a run
+// but cannot be reversed by hashing the (small) IPv4 space offline
+var clientIDHashKey = newClientIDHashKey()
+
+func newClientIDHashKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("failed to generate client ID hash key: " + err.Error())
+	}
+	return key
+}
+
+// MaskClientID returns clientID rendered according to mode
+func MaskClientID(clientID, mode string) string {
+	switch mode {
+	case ClientIDModeRaw:
+		return clientID
+	case ClientIDModeTruncate:
+		if truncated, ok := truncateIP(clientID); ok {
+			return truncated
+		}
+		// Non-IP identifiers can't be truncated meaningfully, so hash them
+		return hashClientID(clientID)
+	default:
+		return hashClientID(clientID)
+	}
+}
+
+// hashClientID returns a short keyed hash of clientID
+func hashClientID(clientID string) string {
+	mac := hmac.New(sha256.New, clientIDHashKey)
+	mac.Write([]byte(clientID))
+	return "h:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// truncateIP zeroes the host part of an IP (last octet for IPv4, last 80 bits for IPv6)
+func truncateIP(ip string) (string, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+
+	bits := 24
+	if addr.Is6() {
+		bits = 48
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return "", false
+	}
+	return prefix.String(), true
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMaskClientID(t *testing.T) {
+	tests := []struct {
+		name     string
+		clientID string
+		mode     string
+		expected string
+	}{
+		{"raw IPv4", "192.168.1.100", ClientIDModeRaw, "192.168.1.100"},
+		{"truncate IPv4", "192.168.1.100", ClientIDModeTruncate, "192.168.1.0/24"},
+		{"truncate IPv6", "2001:db8:1234:5678::1", ClientIDModeTruncate, "2001:db8:1234::/48"},
+		{"truncate IPv4-mapped", "::ffff:10.1.2.3", ClientIDModeTruncate, "10.1.2.0/24"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaskClientID(tt.clientID, tt.mode); got != tt.expected {
+				t.Errorf("MaskClientID(%q, %q) = %q, want %q", tt.clientID, tt.mode, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMaskClientID_Hash(t *testing.T) {
+	first := MaskClientID("192.168.1.100", ClientIDModeHash)
+	second := MaskClientID("192.168.1.100", ClientIDModeHash)
+	other := MaskClientID("192.168.1.101", ClientIDModeHash)
+
+	if first != second {
+		t.Error("Expected hashing to be stable within a process")
+	}
+	if first == other {
+		t.Error("Expected different client IDs to hash differently")
+	}
+	if strings.Contains(first, "192.168") || !strings.HasPrefix(first, "h:") {
+		t.Errorf("Unexpected hashed ID %q", first)
+	}
+
+	// Unknown modes and non-IP IDs in truncate mode fall back to hashing
+	if got := MaskClientID("unknown", ClientIDModeTruncate); got != MaskClientID("unknown", ClientIDModeHash) {
+		t.Errorf("Expected non-IP truncate to fall back to hash, got %q", got)
+	}
+	if got := MaskClientID("192.168.1.100", "bogus"); got != first {
+		t.Errorf("Expected unknown mode to hash, got %q", got)
+	}
+}
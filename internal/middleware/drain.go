@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// DrainState is a snapshot of the drain toggle
+type DrainState struct {
+	Draining bool       `json:"draining"`
+	Since    *time.Time `json:"since,omitempty"`
+}
+
+// DrainMode is a runtime toggle that reports the instance as not ready so load
+// balancers stop routing to it, while requests that still arrive are served
+type DrainMode struct {
+	mu       sync.RWMutex
+	draining bool
+	since    time.Time
+}
+
+// NewDrainMode creates a drain toggle in the ready (not draining) state
+func NewDrainMode() *DrainMode {
+	return &DrainMode{}
+}
+
+// Drain marks the instance as draining
+func (d *DrainMode) Drain() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.draining {
+		d.draining = true
+		d.since = time.Now()
+	}
+}
+
+// Undrain marks the instance as ready again
+func (d *DrainMode) Undrain() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.draining = false
+	d.since = time.Time{}
+}
+
+// Draining reports whether the instance is draining
+func (d *DrainMode) Draining() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.draining
+}
+
+// State returns the current drain state
+func (d *DrainMode) State() DrainState {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	state := DrainState{Draining: d.draining}
+	if d.draining {
+		since := d.since
+		state.Since = &since
+	}
+	return state
+}
+
+// RegisterMetrics exposes the drain toggle on the registry
+func (d *DrainMode) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("ipgeo_draining",
+		"Whether the instance is draining (1) or ready (0)",
+		func() float64 {
+			if d.Draining() {
+				return 1
+			}
+			return 0
+		})
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import "testing"
+
+func TestDrainMode(t *testing.T) {
+	d := NewDrainMode()
+	if state := d.State(); state.Draining || state.Since != nil {
+		t.Fatalf("NewDrainMode() state = %+v, want ready", state)
+	}
+
+	d.Drain()
+	first := d.State()
+	if !first.Draining || first.Since == nil {
+		t.Fatalf("State() after Drain() = %+v, want draining with since", first)
+	}
+
+	d.Drain()
+	if second := d.State(); !second.Since.Equal(*first.Since) {
+		t.Errorf("Drain() twice moved since from %v to %v", first.Since, second.Since)
+	}
+
+	d.Undrain()
+	if d.Draining() {
+		t.Error("Undrain() left the instance draining")
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ip-geolocation-service/internal/errreport"
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+// maxReportedBody bounds how much of an error response is kept for its report
+const maxReportedBody = 1024
+
+// errorCaptureWriter records the status and the start of the body of an error response
+type errorCaptureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *errorCaptureWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *errorCaptureWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if reportableStatus(w.status) && w.body.Len() < maxReportedBody {
+		w.body.Write(b[:min(len(b), maxReportedBody-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *errorCaptureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// reportableStatus reports whether a response with status is an error worth reporting.
+// 503 is left out: the service only sends it on purpose (maintenance, load shedding,
+// draining, fault injection).
+func reportableStatus(status int) bool {
+	return status >= http.StatusInternalServerError && status != http.StatusServiceUnavailable
+}
+
+// ErrorReportingMiddleware sends server errors (5xx other than 503) to reporter, with
+// the request sanitized by errreport.SanitizeRequest. Panics are reported by the
+// recovery middleware instead.
+func ErrorReportingMiddleware(reporter errreport.Reporter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &errorCaptureWriter{ResponseWriter: w}
+			next.ServeHTTP(cw, r)
+			if !reportableStatus(cw.status) {
+				return
+			}
+
+			// Error bodies are {"error": ..., "code": ...}; fall back to the status text
+			var body struct {
+				Error string `json:"error"`
+				Code  string `json:"code"`
+			}
+			json.Unmarshal(cw.body.Bytes(), &body)
+			if body.Error == "" {
+				body.Error = http.StatusText(cw.status)
+			}
+			errorType := body.Code
+			if errorType == "" {
+				errorType = fmt.Sprintf("http_%d", cw.status)
+			}
+
+			sum := sha256.Sum256([]byte(fmt.Sprintf("%d\n%s\n%s", cw.status, r.URL.Path, errorType)))
+			requestID, _ := requestcontext.RequestID(r.Context())
+			reporter.Capture(errreport.Event{
+				Level:       errreport.LevelError,
+				Type:        errorType,
+				Message:     body.Error,
+				Fingerprint: hex.EncodeToString(sum[:])[:16],
+				Status:      cw.status,
+				Request:     errreport.SanitizeRequest(r),
+				RequestID:   requestID,
+				Time:        time.Now(),
+			})
+		})
+	}
+}
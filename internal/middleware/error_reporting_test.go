@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"ip-geolocation-service/internal/errreport"
+)
+
+// captureReporter records reported events
+type captureReporter struct {
+	mu     sync.Mutex
+	events []errreport.Event
+}
+
+func (c *captureReporter) Capture(event errreport.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+}
+
+func TestErrorReportingMiddleware(t *testing.T) {
+	reporter := &captureReporter{}
+	handler := ErrorReportingMiddleware(reporter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error": "Lookup failed", "code": "lookup_failed"}`))
+		case "/v1/timeout":
+			w.WriteHeader(http.StatusGatewayTimeout)
+		case "/v1/maintenance":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+
+	for _, path := range []string{"/v1/broken?ip=8.8.8.8&token=secret", "/v1/broken", "/v1/timeout", "/v1/maintenance", "/v1/find-country"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if len(reporter.events) != 3 {
+		t.Fatalf("Expected 3 reported errors, got %d", len(reporter.events))
+	}
+
+	first := reporter.events[0]
+	if first.Type != "lookup_failed" || first.Message != "Lookup failed" || first.Status != http.StatusInternalServerError {
+		t.Errorf("Unexpected event %+v", first)
+	}
+	if first.Request.Query != "ip=8.8.8.0&token=%5BFiltered%5D" {
+		t.Errorf("Expected sanitized query, got %q", first.Request.Query)
+	}
+	if first.Fingerprint == "" || first.Fingerprint != reporter.events[1].Fingerprint {
+		t.Error("Expected the same error on the same path to share a fingerprint")
+	}
+
+	timeout := reporter.events[2]
+	if timeout.Type != "http_504" || timeout.Message != "Gateway Timeout" || timeout.Fingerprint == first.Fingerprint {
+		t.Errorf("Unexpected event %+v", timeout)
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// TrustedProxies decides which X-Forwarded-Proto and X-Forwarded-Host headers
+// describe the URL a client used. Like rate limit exemptions, proxies are matched
+// against the connection's peer address, so clients connecting directly can't
+// point generated links at another host. A nil *TrustedProxies trusts no proxy.
+type TrustedProxies struct {
+	networks []netip.Prefix
+}
+
+// NewTrustedProxies creates a trust list from CIDR ranges or bare addresses
+func NewTrustedProxies(cidrs []string) (*TrustedProxies, error) {
+	p := &TrustedProxies{}
+	for _, cidr := range cidrs {
+		prefix, err := parsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy range %q: %w", cidr, err)
+		}
+		p.networks = append(p.networks, prefix)
+	}
+	return p, nil
+}
+
+// Trusted reports whether r arrived from a trusted proxy
+func (p *TrustedProxies) Trusted(r *http.Request) bool {
+	if p == nil || len(p.networks) == 0 {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, network := range p.networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scheme returns the scheme the client used: X-Forwarded-Proto from a trusted
+// proxy, otherwise https for TLS connections and http for the rest
+func (p *TrustedProxies) Scheme(r *http.Request) string {
+	if p.Trusted(r) {
+		switch proto := strings.ToLower(firstForwarded(r.Header.Get("X-Forwarded-Proto"))); proto {
+		case "http", "https":
+			return proto
+		}
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Host returns the host the client used: X-Forwarded-Host from a trusted proxy,
+// otherwise the request's Host
+func (p *TrustedProxies) Host(r *http.Request) string {
+	if p.Trusted(r) {
+		if host := firstForwarded(r.Header.Get("X-Forwarded-Host")); validForwardedHost(host) {
+			return host
+		}
+	}
+	return r.Host
+}
+
+// AbsoluteURL returns the absolute URL of path on this service, with query, as the
+// client sees it
+func (p *TrustedProxies) AbsoluteURL(r *http.Request, path string, query url.Values) string {
+	u := url.URL{Scheme: p.Scheme(r), Host: p.Host(r), Path: path}
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// firstForwarded returns the first entry of a comma-separated forwarding header,
+// the one added by the proxy closest to the client
+func firstForwarded(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.TrimSpace(first)
+}
+
+// validForwardedHost accepts a host or host:port without a path, userinfo or spaces
+func validForwardedHost(host string) bool {
+	if host == "" || strings.ContainsAny(host, "/\\@?# \t") {
+		return false
+	}
+	u, err := url.Parse("http://" + host)
+	return err == nil && u.Host == host
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTrustedProxies_AbsoluteURL(t *testing.T) {
+	proxies, err := NewTrustedProxies([]string{"10.0.0.0/8", "192.0.2.7"})
+	if err != nil {
+		t.Fatalf("NewTrustedProxies() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		proto      string
+		host       string
+		tls        bool
+		want       string
+	}{
+		{"direct", "203.0.113.1:1234", "", "", false, "http://api.internal:8080/debug/rate-limiter?offset=2"},
+		{"direct TLS", "203.0.113.1:1234", "", "", true, "https://api.internal:8080/debug/rate-limiter?offset=2"},
+		{"untrusted forwarding headers", "203.0.113.1:1234", "https", "evil.example", false, "http://api.internal:8080/debug/rate-limiter?offset=2"},
+		{"trusted proxy", "10.1.2.3:1234", "https", "geo.example.com", false, "https://geo.example.com/debug/rate-limiter?offset=2"},
+		{"trusted address", "192.0.2.7:1234", "HTTPS", "", false, "https://api.internal:8080/debug/rate-limiter?offset=2"},
+		{"first of a proxy chain", "10.1.2.3:1234", "https, http", "geo.example.com, lb.internal", false, "https://geo.example.com/debug/rate-limiter?offset=2"},
+		{"invalid forwarded values", "10.1.2.3:1234", "ftp", "evil.example/path", false, "http://api.internal:8080/debug/rate-limiter?offset=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://api.internal:8080/debug/rate-limiter", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.host != "" {
+				req.Header.Set("X-Forwarded-Host", tt.host)
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			got := proxies.AbsoluteURL(req, "/debug/rate-limiter", url.Values{"offset": {"2"}})
+			if got != tt.want {
+				t.Errorf("AbsoluteURL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxies_Nil(t *testing.T) {
+	var proxies *TrustedProxies
+	req := httptest.NewRequest("GET", "http://api.internal/health", nil)
+	req.RemoteAddr = "10.1.2.3:1234"
+	req.Header.Set("X-Forwarded-Proto", "https")
+
+	if got := proxies.AbsoluteURL(req, "/health", nil); got != "http://api.internal/health" {
+		t.Errorf("AbsoluteURL() = %s, want forwarding headers ignored", got)
+	}
+}
+
+func TestNewTrustedProxies_InvalidRange(t *testing.T) {
+	if _, err := NewTrustedProxies([]string{"not-a-range"}); err == nil {
+		t.Error("Expected invalid range to be rejected")
+	}
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// Global limit rejection reasons
+const (
+	GlobalRejectRate        = "rate"
+	GlobalRejectConcurrency = "concurrency"
+)
+
+// GlobalLimiter caps service-wide throughput and concurrency regardless of client identity
+type GlobalLimiter struct {
+	requestsPerSecond float64
+	burstSize         float64
+	maxConcurrent     int64
+
+	// Service-wide token bucket with fractional refill
+	tokens     float64
+	lastRefill time.Time
+	mu         sync.Mutex
+
+	inFlight atomic.Int64
+
+	rejectedRate        atomic.Uint64
+	rejectedConcurrency atomic.Uint64
+}
+
+// NewGlobalLimiter creates a global limiter; a zero requestsPerSecond or maxConcurrent disables that cap
+func NewGlobalLimiter(requestsPerSecond, burstSize, maxConcurrent int) *GlobalLimiter {
+	if burstSize <= 0 {
+		burstSize = requestsPerSecond
+	}
+
+	return &GlobalLimiter{
+		requestsPerSecond: float64(requestsPerSecond),
+		burstSize:         float64(burstSize),
+		maxConcurrent:     int64(maxConcurrent),
+		tokens:            float64(burstSize),
+		lastRefill:        time.Now(),
+	}
+}
+
+// Acquire reserves capacity for one request. On success the caller must call Release
+// when the request finishes. On failure it returns the rejection reason and how long
+// the client should wait before retrying.
+func (g *GlobalLimiter) Acquire() (ok bool, reason string, retryAfter time.Duration) {
+	if g.maxConcurrent > 0 {
+		if g.inFlight.Add(1) > g.maxConcurrent {
+			g.inFlight.Add(-1)
+			g.rejectedConcurrency.Add(1)
+			return false, GlobalRejectConcurrency, time.Second
+		}
+	}
+
+	if g.requestsPerSecond > 0 {
+		if allowed, wait := g.takeToken(time.Now()); !allowed {
+			if g.maxConcurrent > 0 {
+				g.inFlight.Add(-1)
+			}
+			g.rejectedRate.Add(1)
+			return false, GlobalRejectRate, wait
+		}
+	}
+
+	return true, "", 0
+}
+
+// Release returns concurrency capacity taken by a successful Acquire
+func (g *GlobalLimiter) Release() {
+	if g.maxConcurrent > 0 {
+		g.inFlight.Add(-1)
+	}
+}
+
+// takeToken consumes a token from the global bucket, returning the wait until one is available otherwise
+func (g *GlobalLimiter) takeToken(now time.Time) (bool, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.tokens = math.Min(g.burstSize, g.tokens+now.Sub(g.lastRefill).Seconds()*g.requestsPerSecond)
+	g.lastRefill = now
+
+	if g.tokens >= 1 {
+		g.tokens--
+		return true, 0
+	}
+
+	deficit := 1 - g.tokens
+	return false, time.Duration(deficit / g.requestsPerSecond * float64(time.Second))
+}
+
+// InFlight returns the number of requests currently holding concurrency capacity
+func (g *GlobalLimiter) InFlight() int64 {
+	return g.inFlight.Load()
+}
+
+// RegisterMetrics exposes global limiter metrics on the registry
+func (g *GlobalLimiter) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("ipgeo_global_limiter_in_flight",
+		"Requests currently holding global concurrency capacity",
+		func() float64 { return float64(g.inFlight.Load()) })
+	registry.NewCounterFunc("ipgeo_global_limiter_rejected_rate_total",
+		"Requests rejected because the global RPS budget was exhausted",
+		func() float64 { return float64(g.rejectedRate.Load()) })
+	registry.NewCounterFunc("ipgeo_global_limiter_rejected_concurrency_total",
+		"Requests rejected because the global concurrency cap was reached",
+		func() float64 { return float64(g.rejectedConcurrency.Load()) })
+}
+
+// GlobalRateLimitMiddleware enforces the service-wide budget, returning 503 with Retry-After when exhausted.
+// Health and metrics endpoints are exempt so load balancers and scrapers keep working under load.
+func GlobalRateLimitMiddleware(limiter *GlobalLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" || strings.HasPrefix(r.URL.Path, "/health/") || r.URL.Path == "/metrics" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ok, _, retryAfter := limiter.Acquire()
+			if !ok {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				errorResponse := `{"error": "Service is over capacity. Try again later."}`
+				w.Write([]byte(errorResponse))
+				return
+			}
+			defer limiter.Release()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
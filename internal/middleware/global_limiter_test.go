@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGlobalLimiter_RateCap(t *testing.T) {
+	limiter := NewGlobalLimiter(10, 3, 0)
+
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := limiter.Acquire(); !ok {
+			t.Fatalf("Request %d should be allowed within burst", i+1)
+		}
+		limiter.Release()
+	}
+
+	ok, reason, retryAfter := limiter.Acquire()
+	if ok {
+		t.Fatal("Expected request over the global burst to be rejected")
+	}
+	if reason != GlobalRejectRate {
+		t.Errorf("Expected reason %s, got %s", GlobalRejectRate, reason)
+	}
+	if retryAfter <= 0 || retryAfter > 100*time.Millisecond {
+		t.Errorf("Expected retry after within one token interval, got %v", retryAfter)
+	}
+}
+
+func TestGlobalLimiter_ConcurrencyCap(t *testing.T) {
+	limiter := NewGlobalLimiter(0, 0, 2)
+
+	limiter.Acquire()
+	limiter.Acquire()
+
+	ok, reason, _ := limiter.Acquire()
+	if ok {
+		t.Fatal("Expected request over the concurrency cap to be rejected")
+	}
+	if reason != GlobalRejectConcurrency {
+		t.Errorf("Expected reason %s, got %s", GlobalRejectConcurrency, reason)
+	}
+	if limiter.InFlight() != 2 {
+		t.Errorf("Expected 2 in-flight requests, got %d", limiter.InFlight())
+	}
+
+	limiter.Release()
+	if ok, _, _ := limiter.Acquire(); !ok {
+		t.Error("Expected request to be allowed after a release")
+	}
+}
+
+func TestGlobalRateLimitMiddleware(t *testing.T) {
+	limiter := NewGlobalLimiter(1, 1, 0)
+
+	handler := GlobalRateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Distinct client IPs share the same global budget
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	req.Header.Set("X-Real-IP", "10.0.0.1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	req.Header.Set("X-Real-IP", "10.0.0.2")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 {
+		t.Errorf("Expected positive Retry-After header, got %q", w.Header().Get("Retry-After"))
+	}
+
+	// Health checks are exempt
+	req = httptest.NewRequest("GET", "/health", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected health check to bypass the global limit, got %d", w.Code)
+	}
+}
+
+func TestGlobalRateLimitMiddleware_ReleasesConcurrency(t *testing.T) {
+	limiter := NewGlobalLimiter(0, 0, 5)
+
+	handler := GlobalRateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/find-country", nil))
+		}()
+	}
+	wg.Wait()
+
+	if limiter.InFlight() != 0 {
+		t.Errorf("Expected all concurrency capacity to be released, got %d in flight", limiter.InFlight())
+	}
+}
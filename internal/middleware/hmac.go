@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+// Request signing headers
+const (
+	SignatureKeyHeader       = "X-Signature-Key"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureHeader          = "X-Signature"
+)
+
+// DefaultSignatureMaxSkew is how far a signature timestamp may be from the server clock
+const DefaultSignatureMaxSkew = 5 * time.Minute
+
+// maxSignedBodyBytes bounds how much of a signed request body is buffered for verification
+const maxSignedBodyBytes = 1 << 20
+
+// ErrInvalidSignature is returned for signed requests that fail verification
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// hmacKey is a signing client's shared secret and roles
+type hmacKey struct {
+	secret []byte
+	roles  []string
+}
+
+// HMACVerifier verifies HMAC-SHA256 signed requests from server-to-server clients.
+// The signature covers "<timestamp>\n<method>\n<path?query>\n<body>"; timestamps
+// outside the allowed skew are rejected and each signature is accepted only once.
+type HMACVerifier struct {
+	keys    map[string]hmacKey
+	maxSkew time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // Signature -> when it can be forgotten
+	lastPrune time.Time
+
+	now func() time.Time
+}
+
+// NewHMACVerifier creates a verifier from key ID -> secret and key ID -> "|"-separated
+// roles. Keys without a roles entry get the reader role.
+func NewHMACVerifier(secrets, roles map[string]string, maxSkew time.Duration) (*HMACVerifier, error) {
+	if maxSkew <= 0 {
+		maxSkew = DefaultSignatureMaxSkew
+	}
+
+	v := &HMACVerifier{
+		keys:    make(map[string]hmacKey, len(secrets)),
+		maxSkew: maxSkew,
+		seen:    make(map[string]time.Time),
+		now:     time.Now,
+	}
+	for id, secret := range secrets {
+		keyRoles := []string{RoleReader}
+		if value, exists := roles[id]; exists {
+			parsed, err := ParseRoles(value)
+			if err != nil {
+				return nil, fmt.Errorf("signing key %s: %w", id, err)
+			}
+			keyRoles = parsed
+		}
+		v.keys[id] = hmacKey{secret: []byte(secret), roles: keyRoles}
+	}
+	return v, nil
+}
+
+// HasRole reports whether any signing key carries role
+func (v *HMACVerifier) HasRole(role string) bool {
+	for id, key := range v.keys {
+		if (APIKey{ID: id, Roles: key.roles}).HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the signature for a request; clients and tests use it to build requests
+func Sign(secret []byte, timestamp int64, method, requestURI string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d\n%s\n%s\n", timestamp, method, requestURI)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of r, restoring its body for later handlers
+func (v *HMACVerifier) Verify(r *http.Request) (APIKey, error) {
+	id := r.Header.Get(SignatureKeyHeader)
+	key, exists := v.keys[id]
+	if !exists {
+		return APIKey{}, fmt.Errorf("%w: unknown signing key", ErrInvalidSignature)
+	}
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(SignatureTimestampHeader), 10, 64)
+	if err != nil {
+		return APIKey{}, fmt.Errorf("%w: bad timestamp", ErrInvalidSignature)
+	}
+	now := v.now()
+	if skew := now.Sub(time.Unix(timestamp, 0)); skew > v.maxSkew || skew < -v.maxSkew {
+		return APIKey{}, fmt.Errorf("%w: timestamp outside allowed skew", ErrInvalidSignature)
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxSignedBodyBytes+1))
+		if err != nil {
+			return APIKey{}, fmt.Errorf("%w: failed to read body", ErrInvalidSignature)
+		}
+		if len(body) > maxSignedBodyBytes {
+			return APIKey{}, fmt.Errorf("%w: body too large", ErrInvalidSignature)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	// Clients sign the path they send, including a BASE_PATH prefix stripped before routing
+	signature := r.Header.Get(SignatureHeader)
+	requestURI := requestcontext.BasePath(r.Context()) + r.URL.RequestURI()
+	expected := Sign(key.secret, timestamp, r.Method, requestURI, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return APIKey{}, fmt.Errorf("%w: signature mismatch", ErrInvalidSignature)
+	}
+
+	if !v.remember(id+":"+signature, now) {
+		return APIKey{}, fmt.Errorf("%w: replayed request", ErrInvalidSignature)
+	}
+
+	return APIKey{
+		ID:       "hmac:" + id,
+		Roles:    key.roles,
+		ClientID: "hmac:" + id,
+		QuotaID:  "hmac:" + id,
+	}, nil
+}
+
+// remember records a signature, returning false if it was already used. Entries are
+// kept for twice the skew, covering every timestamp that could still be accepted.
+func (v *HMACVerifier) remember(signature string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if now.Sub(v.lastPrune) > v.maxSkew {
+		for seen, expires := range v.seen {
+			if now.After(expires) {
+				delete(v.seen, seen)
+			}
+		}
+		v.lastPrune = now
+	}
+
+	if expires, exists := v.seen[signature]; exists && !now.After(expires) {
+		return false
+	}
+	v.seen[signature] = now.Add(2 * v.maxSkew)
+	return true
+}
+
+// HMACMiddleware authenticates requests carrying an X-Signature header. Unsigned
+// requests and requests already authenticated another way pass through; bad
+// signatures are rejected with 401.
+func HMACMiddleware(verifier *HMACVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, authenticated := APIKeyFromContext(r.Context()); authenticated || r.Header.Get(SignatureHeader) == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			apiKey, err := verifier.Verify(r)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error": "Invalid request signature"}`))
+				return
+			}
+
+			ctx := WithAPIKey(r.Context(), apiKey)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedRequest(secret, keyID string, timestamp time.Time, method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(SignatureKeyHeader, keyID)
+	req.Header.Set(SignatureTimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign([]byte(secret), timestamp.Unix(), method, req.URL.RequestURI(), []byte(body)))
+	return req
+}
+
+func TestHMACMiddleware(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	verifier, err := NewHMACVerifier(map[string]string{"partner": secret}, map[string]string{"partner": "reader|metrics"}, time.Minute)
+	if err != nil {
+		t.Fatalf("NewHMACVerifier() error = %v", err)
+	}
+
+	var seen APIKey
+	var body string
+	handler := HMACMiddleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = APIKeyFromContext(r.Context())
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	now := time.Now()
+	replayed := signedRequest(secret, "partner", now, "POST", "/admin/overrides?x=1", `{"target":"1.2.3.4"}`)
+
+	tamperedBody := signedRequest(secret, "partner", now, "POST", "/v1/find-country", `{"a":1}`)
+	tamperedBody.Body = io.NopCloser(strings.NewReader(`{"a":2}`))
+
+	tamperedPath := signedRequest(secret, "partner", now, "GET", "/v1/find-country?ip=1.1.1.1", "")
+	tamperedPath.URL.RawQuery = "ip=8.8.8.8"
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"unsigned", httptest.NewRequest("GET", "/v1/find-country", nil), http.StatusOK},
+		{"valid", replayed, http.StatusOK},
+		{"replayed", replayed.Clone(replayed.Context()), http.StatusUnauthorized},
+		{"stale timestamp", signedRequest(secret, "partner", now.Add(-2*time.Minute), "GET", "/v1/find-country", ""), http.StatusUnauthorized},
+		{"future timestamp", signedRequest(secret, "partner", now.Add(2*time.Minute), "GET", "/v1/find-country", ""), http.StatusUnauthorized},
+		{"wrong secret", signedRequest("wrong-secret-wrong-secret-wrong!!", "partner", now, "GET", "/v1/find-country", ""), http.StatusUnauthorized},
+		{"unknown key", signedRequest(secret, "other", now, "GET", "/v1/find-country", ""), http.StatusUnauthorized},
+		{"tampered body", tamperedBody, http.StatusUnauthorized},
+		{"tampered query", tamperedPath, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		if tt.name == "replayed" {
+			tt.req.Body = io.NopCloser(strings.NewReader(`{"target":"1.2.3.4"}`))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, tt.req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+		if tt.name == "valid" {
+			if seen.ClientID != "hmac:partner" || !seen.HasRole(RoleMetrics) || seen.HasRole(RoleAdmin) {
+				t.Errorf("Unexpected identity: %+v", seen)
+			}
+			if body != `{"target":"1.2.3.4"}` {
+				t.Errorf("Expected body to be readable after verification, got %q", body)
+			}
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWT validation defaults
+const (
+	DefaultJWTRolesClaim    = "roles"
+	DefaultJWTIdentityClaim = "sub"
+	DefaultJWKSRefresh      = time.Hour
+
+	// jwksMinRefreshInterval bounds how often an unknown key ID can trigger a JWKS fetch
+	jwksMinRefreshInterval = 30 * time.Second
+	// jwtClockSkew is the leeway applied to exp and nbf
+	jwtClockSkew = time.Minute
+)
+
+// ErrInvalidToken is returned for tokens that fail validation
+var ErrInvalidToken = errors.New("invalid token")
+
+// JWTConfig configures bearer token validation against an identity provider
+type JWTConfig struct {
+	JWKSURL       string            // Where the provider publishes its signing keys
+	Issuer        string            // Required "iss" claim
+	Audience      string            // Required "aud" claim entry
+	RolesClaim    string            // Claim holding roles; dots address nested claims (e.g. "realm_access.roles")
+	RoleMapping   map[string]string // Claim value -> "|"-separated roles; empty uses claim values as role names
+	IdentityClaim string            // Claim used as the rate-limit identity
+	JWKSRefresh   time.Duration     // How long fetched keys are trusted before refetching
+	Transport     http.RoundTripper // Fetches the JWKS (nil uses http.DefaultTransport)
+}
+
+// jwk is a single key from a JWKS document
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// signingKey is a parsed JWKS key
+type signingKey struct {
+	alg string // Algorithm pinned by the JWKS ("" allows any matching the key type)
+	key crypto.PublicKey
+}
+
+// JWTValidator validates RS* and ES* signed JWTs using keys fetched from a JWKS URL
+type JWTValidator struct {
+	config JWTConfig
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]signingKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	refreshMu   sync.Mutex
+
+	now func() time.Time
+}
+
+// NewJWTValidator creates a validator; keys are fetched lazily on first use
+func NewJWTValidator(config JWTConfig) *JWTValidator {
+	if config.RolesClaim == "" {
+		config.RolesClaim = DefaultJWTRolesClaim
+	}
+	if config.IdentityClaim == "" {
+		config.IdentityClaim = DefaultJWTIdentityClaim
+	}
+	if config.JWKSRefresh <= 0 {
+		config.JWKSRefresh = DefaultJWKSRefresh
+	}
+	return &JWTValidator{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second, Transport: config.Transport},
+		now:    time.Now,
+	}
+}
+
+// Refresh fetches the JWKS and replaces the cached keys
+func (v *JWTValidator) Refresh(ctx context.Context) error {
+	v.mu.Lock()
+	v.lastAttempt = v.now()
+	v.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.config.JWKSURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&document); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]signingKey, len(document.Keys))
+	for _, k := range document.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(k)
+		if err != nil {
+			// Skip keys of unsupported types rather than rejecting the whole set
+			continue
+		}
+		keys[k.Kid] = signingKey{alg: k.Alg, key: key}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("JWKS contains no usable signing keys")
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.fetchedAt = v.now()
+	v.mu.Unlock()
+	return nil
+}
+
+// Authenticate validates token and returns the identity it grants
+func (v *JWTValidator) Authenticate(ctx context.Context, token string) (APIKey, error) {
+	claims, err := v.verify(ctx, token)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return APIKey{}, fmt.Errorf("%w: missing sub claim", ErrInvalidToken)
+	}
+	identity := subject
+	if value, ok := lookupClaim(claims, v.config.IdentityClaim).(string); ok && value != "" {
+		identity = value
+	}
+
+	return APIKey{
+		ID:       "jwt:" + MaskClientID(subject, ClientIDModeHash),
+		Subject:  subject,
+		Roles:    v.roles(claims),
+		ClientID: "jwt:" + identity,
+		QuotaID:  "jwt:" + identity,
+	}, nil
+}
+
+// verify checks the signature and registered claims and returns all claims
+func (v *JWTValidator) verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidToken)
+	}
+	hash, ok := jwtHash(header.Alg)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.alg != "" && key.alg != header.Alg {
+		return nil, fmt.Errorf("%w: algorithm %s does not match key", ErrInvalidToken, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if !verifySignature(header.Alg, key.key, hash, h.Sum(nil), signature) {
+		return nil, fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: bad claims", ErrInvalidToken)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkClaims validates iss, aud, exp and nbf
+func (v *JWTValidator) checkClaims(claims map[string]interface{}) error {
+	now := v.now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtClockSkew)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtClockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+
+	if v.config.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.config.Issuer {
+			return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+		}
+	}
+	if v.config.Audience != "" && !audienceContains(claims["aud"], v.config.Audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+// roles maps the roles claim to service roles; tokens without any get the reader role
+func (v *JWTValidator) roles(claims map[string]interface{}) []string {
+	var values []string
+	switch claim := lookupClaim(claims, v.config.RolesClaim).(type) {
+	case string:
+		values = strings.Fields(claim)
+	case []interface{}:
+		for _, value := range claim {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	var roles []string
+	for _, value := range values {
+		if len(v.config.RoleMapping) > 0 {
+			value = v.config.RoleMapping[value]
+		}
+		// Unknown values are ignored so providers can carry unrelated roles
+		if mapped, err := ParseRoles(value); err == nil {
+			roles = append(roles, mapped...)
+		}
+	}
+	if len(roles) == 0 {
+		roles = []string{RoleReader}
+	}
+	return roles
+}
+
+// key returns the signing key for kid, refetching the JWKS when it is stale or the key is unknown
+func (v *JWTValidator) key(ctx context.Context, kid string) (signingKey, error) {
+	if key, ok, fresh := v.cachedKey(kid); ok && fresh {
+		return key, nil
+	}
+
+	v.refreshMu.Lock()
+	// Another request may have refreshed while we waited
+	key, ok, fresh := v.cachedKey(kid)
+	if !(ok && fresh) && v.canRefresh() {
+		if err := v.Refresh(ctx); err != nil && !ok {
+			v.refreshMu.Unlock()
+			return signingKey{}, err
+		}
+		key, ok, _ = v.cachedKey(kid)
+	}
+	v.refreshMu.Unlock()
+
+	if !ok {
+		return signingKey{}, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// cachedKey looks kid up in the cached keys; an empty kid matches a lone key
+func (v *JWTValidator) cachedKey(kid string) (signingKey, bool, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	fresh := !v.fetchedAt.IsZero() && v.now().Sub(v.fetchedAt) < v.config.JWKSRefresh
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true, fresh
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok, fresh
+}
+
+func (v *JWTValidator) canRefresh() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.lastAttempt.IsZero() || v.now().Sub(v.lastAttempt) >= jwksMinRefreshInterval
+}
+
+// JWTMiddleware authenticates "Authorization: Bearer <jwt>" requests. Bearer values
+// that aren't JWTs (such as the admin token) and requests already authenticated with
+// an API key pass through; invalid JWTs are rejected with 401. A valid token is
+// attached to the context like an API key, carrying the roles mapped from its claims.
+func JWTMiddleware(validator *JWTValidator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if _, authenticated := APIKeyFromContext(r.Context()); authenticated || !ok || strings.Count(token, ".") != 2 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			apiKey, err := validator.Authenticate(r.Context(), token)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error": "Invalid bearer token"}`))
+				return
+			}
+
+			ctx := WithAPIKey(r.Context(), apiKey)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// parseJWK converts a JWKS entry to a public key
+func parseJWK(k jwk) (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("EC point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// jwtHash returns the digest used by a supported algorithm
+func jwtHash(alg string) (crypto.Hash, bool) {
+	switch alg {
+	case "RS256", "ES256":
+		return crypto.SHA256, true
+	case "RS384", "ES384":
+		return crypto.SHA384, true
+	case "RS512", "ES512":
+		return crypto.SHA512, true
+	default:
+		return 0, false
+	}
+}
+
+// verifySignature checks an RS* (PKCS#1 v1.5) or ES* (raw r||s) signature
+func verifySignature(alg string, key crypto.PublicKey, hash crypto.Hash, digest, signature []byte) bool {
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(pub, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	default:
+		return false
+	}
+}
+
+// lookupClaim resolves a dotted claim path such as "realm_access.roles"
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	var value interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// audienceContains reports whether aud (a string or list of strings) includes audience
+func audienceContains(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, value := range aud {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testIdP serves a JWKS with one RSA and one EC key and signs tokens with them
+type testIdP struct {
+	server  *httptest.Server
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	fetches atomic.Int32
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &testIdP{rsaKey: rsaKey, ecKey: ecKey}
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "alg": "RS256", "use": "sig",
+				"n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256",
+				"x": encode(ecKey.X.FillBytes(make([]byte, 32))), "y": encode(ecKey.Y.FillBytes(make([]byte, 32)))},
+		},
+	}
+	idp.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp.fetches.Add(1)
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIdP) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, idp.ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   "https://idp.example.com",
+		"aud":   []string{"other", "ipgeo"},
+		"sub":   "alice",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"geo-admin", "unrelated"},
+	}
+}
+
+func TestJWTValidator_Authenticate(t *testing.T) {
+	idp := newTestIdP(t)
+	validator := NewJWTValidator(JWTConfig{
+		JWKSURL:     idp.server.URL,
+		Issuer:      "https://idp.example.com",
+		Audience:    "ipgeo",
+		RoleMapping: map[string]string{"geo-admin": "admin", "geo-reader": "reader"},
+	})
+
+	apiKey, err := validator.Authenticate(context.Background(), idp.sign(t, "RS256", "rsa-1", validClaims()))
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if apiKey.Subject != "alice" || apiKey.ClientID != "jwt:alice" || !apiKey.HasRole(RoleAdmin) {
+		t.Errorf("Unexpected identity: %+v", apiKey)
+	}
+
+	claims := validClaims()
+	delete(claims, "roles")
+	apiKey, err = validator.Authenticate(context.Background(), idp.sign(t, "ES256", "ec-1", claims))
+	if err != nil {
+		t.Fatalf("Authenticate(ES256) error = %v", err)
+	}
+	if !apiKey.HasRole(RoleReader) || apiKey.HasRole(RoleMetrics) {
+		t.Errorf("Expected reader-only roles without a roles claim, got %v", apiKey.Roles)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(map[string]interface{})
+		alg    string
+		kid    string
+	}{
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "RS256", "rsa-1"},
+		{"not yet valid", func(c map[string]interface{}) { c["nbf"] = time.Now().Add(time.Hour).Unix() }, "RS256", "rsa-1"},
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }, "RS256", "rsa-1"},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "other" }, "RS256", "rsa-1"},
+		{"missing exp", func(c map[string]interface{}) { delete(c, "exp") }, "RS256", "rsa-1"},
+		{"algorithm mismatch", func(c map[string]interface{}) {}, "ES256", "rsa-1"},
+		{"unknown key", func(c map[string]interface{}) {}, "RS256", "rsa-2"},
+	}
+	for _, tt := range tests {
+		claims := validClaims()
+		tt.modify(claims)
+		if _, err := validator.Authenticate(context.Background(), idp.sign(t, tt.alg, tt.kid, claims)); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", tt.name, err)
+		}
+	}
+
+	// Tampered payloads fail signature verification
+	parts := strings.Split(idp.sign(t, "RS256", "rsa-1", validClaims()), ".")
+	forged := validClaims()
+	forged["sub"] = "mallory"
+	payload, _ := json.Marshal(forged)
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	if _, err := validator.Authenticate(context.Background(), strings.Join(parts, ".")); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected tampered token to be rejected, got %v", err)
+	}
+
+	// Unsigned tokens are never accepted
+	parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"rsa-1"}`))
+	parts[2] = ""
+	if _, err := validator.Authenticate(context.Background(), strings.Join(parts, ".")); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected alg none to be rejected, got %v", err)
+	}
+}
+
+func TestJWTValidator_RefreshOnUnknownKey(t *testing.T) {
+	idp := newTestIdP(t)
+	validator := NewJWTValidator(JWTConfig{JWKSURL: idp.server.URL})
+	now := time.Now()
+	validator.now = func() time.Time { return now }
+
+	token := idp.sign(t, "RS256", "rsa-1", validClaims())
+	for i := 0; i < 3; i++ {
+		if _, err := validator.Authenticate(context.Background(), token); err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+	}
+	if got := idp.fetches.Load(); got != 1 {
+		t.Errorf("Expected cached keys to be reused, got %d fetches", got)
+	}
+
+	// Unknown key IDs trigger at most one refetch per interval
+	unknown := idp.sign(t, "RS256", "rotated", validClaims())
+	validator.Authenticate(context.Background(), unknown)
+	validator.Authenticate(context.Background(), unknown)
+	if got := idp.fetches.Load(); got != 1 {
+		t.Errorf("Expected refetch to be throttled, got %d fetches", got)
+	}
+	now = now.Add(jwksMinRefreshInterval)
+	validator.Authenticate(context.Background(), unknown)
+	if got := idp.fetches.Load(); got != 2 {
+		t.Errorf("Expected a refetch after the interval, got %d fetches", got)
+	}
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	idp := newTestIdP(t)
+	validator := NewJWTValidator(JWTConfig{JWKSURL: idp.server.URL, Audience: "ipgeo"})
+
+	var seen APIKey
+	var authenticated bool
+	handler := JWTMiddleware(validator)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, authenticated = APIKeyFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+		authenticated bool
+	}{
+		{"no header", "", http.StatusOK, false},
+		{"opaque bearer", "Bearer admin-secret", http.StatusOK, false},
+		{"valid token", "Bearer " + idp.sign(t, "RS256", "rsa-1", validClaims()), http.StatusOK, true},
+		{"invalid token", "Bearer a.b.c", http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		authenticated = false
+		req := httptest.NewRequest("GET", "/v1/find-country", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.want || authenticated != tt.authenticated {
+			t.Errorf("%s: got status %d authenticated=%v, want %d/%v", tt.name, w.Code, authenticated, tt.want, tt.authenticated)
+		}
+	}
+	if seen.Subject != "alice" {
+		t.Errorf("Expected subject alice, got %q", seen.Subject)
+	}
+
+	// Rate limiting follows the token identity rather than the client IP
+	rateLimiter := NewRateLimiter(10, 10, time.Second, time.Minute, 5*time.Minute)
+	req := httptest.NewRequest("GET", "/v1/find-country", nil)
+	req = req.WithContext(WithAPIKey(req.Context(), seen))
+	if got := rateLimiter.GetClientID(req); got != "jwt:alice" {
+		t.Errorf("GetClientID() = %q, want jwt:alice", got)
+	}
+}
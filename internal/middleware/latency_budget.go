@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// Latency budget defaults
+const (
+	DefaultLatencyBudgetWindow      = time.Minute
+	DefaultLatencyBudgetWindows     = 3
+	DefaultLatencyBudgetMinRequests = 50
+)
+
+// maxLatencySamples bounds the latencies kept per route and window; beyond it a
+// uniform sample is kept, which still estimates the p99 well
+const maxLatencySamples = 4096
+
+// LatencyBudgetOptions configures LatencyBudgets
+type LatencyBudgetOptions struct {
+	Budgets     map[string]time.Duration // Path prefix -> p99 budget; longest prefix wins
+	Window      time.Duration            // Length of each evaluation window
+	Windows     int                      // Consecutive violating windows before an alert
+	MinRequests int                      // Requests a window needs before its p99 counts
+}
+
+// latencyWindow collects the latencies of one budgeted route in the current window
+type latencyWindow struct {
+	start     time.Time
+	requests  int
+	samples   []time.Duration
+	streak    int  // Consecutive violating windows
+	violating bool // An alert is active
+}
+
+// LatencyBudgets watches the p99 latency of budgeted routes over fixed windows. When
+// Windows consecutive windows exceed a route's budget it logs a WARN event and raises
+// its violation metrics; the first window back within budget clears the alert.
+// Windows with fewer than MinRequests requests are skipped: a handful of slow
+// requests says little about the p99.
+type LatencyBudgets struct {
+	opts   LatencyBudgetOptions
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu     sync.Mutex
+	routes map[string]*latencyWindow // Keyed by budget prefix
+
+	p99       *metrics.GaugeVec
+	violating *metrics.GaugeVec
+	alerts    *metrics.CounterVec
+}
+
+// NewLatencyBudgets creates a watcher for the given budgets; zero options use the defaults
+func NewLatencyBudgets(opts LatencyBudgetOptions, logger *slog.Logger) *LatencyBudgets {
+	if opts.Window <= 0 {
+		opts.Window = DefaultLatencyBudgetWindow
+	}
+	if opts.Windows <= 0 {
+		opts.Windows = DefaultLatencyBudgetWindows
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = DefaultLatencyBudgetMinRequests
+	}
+	return &LatencyBudgets{
+		opts:   opts,
+		logger: logger,
+		now:    time.Now,
+		routes: make(map[string]*latencyWindow),
+	}
+}
+
+// RegisterMetrics exposes budgets, measured p99s and alert state on the registry
+func (b *LatencyBudgets) RegisterMetrics(registry *metrics.Registry) {
+	budgets := registry.NewGaugeVec("ipgeo_latency_budget_seconds",
+		"p99 latency budget per route",
+		[]string{"route"})
+	for route, budget := range b.opts.Budgets {
+		budgets.Set(budget.Seconds(), route)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.p99 = registry.NewGaugeVec("ipgeo_latency_budget_p99_seconds",
+		"p99 latency of the last complete window per budgeted route",
+		[]string{"route"})
+	b.violating = registry.NewGaugeVec("ipgeo_latency_budget_violating",
+		"Whether a route is in a sustained latency budget violation (1) or not (0)",
+		[]string{"route"})
+	b.alerts = registry.NewCounterVec("ipgeo_latency_budget_alerts_total",
+		"Sustained latency budget violations detected per route",
+		[]string{"route"})
+	for route := range b.opts.Budgets {
+		b.violating.Set(0, route)
+	}
+}
+
+// budgetFor returns the budgeted prefix matching path, longest prefix first
+func (b *LatencyBudgets) budgetFor(path string) (string, bool) {
+	match, longest := "", -1
+	for prefix := range b.opts.Budgets {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			match, longest = prefix, len(prefix)
+		}
+	}
+	return match, longest >= 0
+}
+
+// Observe records a request to path that took latency
+func (b *LatencyBudgets) Observe(path string, latency time.Duration) {
+	route, ok := b.budgetFor(path)
+	if !ok {
+		return
+	}
+	now := b.now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w, exists := b.routes[route]
+	if !exists {
+		w = &latencyWindow{start: now}
+		b.routes[route] = w
+	}
+	if now.Sub(w.start) >= b.opts.Window {
+		b.evaluate(route, w)
+		w.start, w.requests, w.samples = now, 0, w.samples[:0]
+	}
+
+	w.requests++
+	if len(w.samples) < maxLatencySamples {
+		w.samples = append(w.samples, latency)
+	} else if i := rand.IntN(w.requests); i < maxLatencySamples {
+		w.samples[i] = latency
+	}
+}
+
+// evaluate closes a route's window, updating its streak and alert state
+func (b *LatencyBudgets) evaluate(route string, w *latencyWindow) {
+	if w.requests < b.opts.MinRequests {
+		return
+	}
+	p99 := percentile(w.samples, 0.99)
+	budget := b.opts.Budgets[route]
+	if b.p99 != nil {
+		b.p99.Set(p99.Seconds(), route)
+	}
+
+	if p99 <= budget {
+		w.streak = 0
+		if w.violating {
+			w.violating = false
+			if b.violating != nil {
+				b.violating.Set(0, route)
+			}
+			b.logger.Info("⏱️ Latency budget recovered", "route", route, "p99", p99, "budget", budget)
+		}
+		return
+	}
+
+	w.streak++
+	if w.streak < b.opts.Windows || w.violating {
+		return
+	}
+	w.violating = true
+	if b.violating != nil {
+		b.violating.Set(1, route)
+		b.alerts.Inc(route)
+	}
+	b.logger.Warn("⏱️ Latency budget exceeded",
+		"event", "latency_budget_violation",
+		"route", route,
+		"p99", p99,
+		"budget", budget,
+		"windows", w.streak,
+		"window", b.opts.Window,
+		"requests", w.requests,
+	)
+}
+
+// percentile returns the q quantile (0-1) of samples using the nearest-rank method
+func percentile(samples []time.Duration, q float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+// LatencyBudgetMiddleware times each request and reports it to budgets
+func LatencyBudgetMiddleware(budgets *LatencyBudgets) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			next.ServeHTTP(w, r)
+			budgets.Observe(r.URL.Path, time.Since(start))
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+func TestLatencyBudgets_SustainedViolation(t *testing.T) {
+	var logs bytes.Buffer
+	budgets := NewLatencyBudgets(LatencyBudgetOptions{
+		Budgets:     map[string]time.Duration{"/v1/": 100 * time.Millisecond, "/v1/batch": time.Second},
+		Window:      time.Minute,
+		Windows:     2,
+		MinRequests: 10,
+	}, slog.New(slog.NewJSONHandler(&logs, nil)))
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	budgets.now = func() time.Time { return now }
+	registry := metrics.NewRegistry()
+	budgets.RegisterMetrics(registry)
+
+	// fill sends one window of 100 requests, slow of them taking 500ms
+	fill := func(path string, slow int) {
+		for i := 0; i < 100; i++ {
+			latency := 10 * time.Millisecond
+			if i < slow {
+				latency = 500 * time.Millisecond
+			}
+			budgets.Observe(path, latency)
+		}
+		now = now.Add(time.Minute)
+	}
+
+	fill("/v1/find-country", 5) // p99 500ms: first violating window
+	fill("/v1/find-country", 5) // closes the first window
+	if strings.Contains(logs.String(), "latency_budget_violation") {
+		t.Fatalf("Expected no alert after one violating window, got %s", logs.String())
+	}
+	fill("/v1/find-country", 0) // closes the second violating window
+	if got := strings.Count(logs.String(), "latency_budget_violation"); got != 1 {
+		t.Fatalf("Expected one alert after two violating windows, got %d: %s", got, logs.String())
+	}
+
+	var out strings.Builder
+	registry.Write(&out)
+	for _, line := range []string{
+		`ipgeo_latency_budget_violating{route="/v1/"} 1`,
+		`ipgeo_latency_budget_alerts_total{route="/v1/"} 1`,
+		`ipgeo_latency_budget_p99_seconds{route="/v1/"} 0.5`,
+		`ipgeo_latency_budget_seconds{route="/v1/batch"} 1`,
+		`ipgeo_latency_budget_violating{route="/v1/batch"} 0`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, out.String())
+		}
+	}
+
+	// The fast window recovers the route
+	fill("/v1/find-country", 0)
+	if !strings.Contains(logs.String(), "Latency budget recovered") {
+		t.Errorf("Expected a recovery event, got %s", logs.String())
+	}
+	out.Reset()
+	registry.Write(&out)
+	if !strings.Contains(out.String(), `ipgeo_latency_budget_violating{route="/v1/"} 0`+"\n") {
+		t.Errorf("Expected the alert to clear, got:\n%s", out.String())
+	}
+
+	// Slow batches stay within their own, longer budget
+	fill("/v1/batch", 50)
+	fill("/v1/batch", 50)
+	fill("/v1/batch", 50)
+	if got := strings.Count(logs.String(), "latency_budget_violation"); got != 1 {
+		t.Errorf("Expected batches within budget, got %d alerts", got)
+	}
+}
+
+func TestLatencyBudgets_MinRequests(t *testing.T) {
+	var logs bytes.Buffer
+	budgets := NewLatencyBudgets(LatencyBudgetOptions{
+		Budgets: map[string]time.Duration{"/v1/": time.Millisecond},
+		Windows: 1,
+	}, slog.New(slog.NewJSONHandler(&logs, nil)))
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	budgets.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		budgets.Observe("/v1/find-country", time.Second)
+		budgets.Observe("/health", time.Second)
+		now = now.Add(DefaultLatencyBudgetWindow)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("Expected sparse windows to be skipped, got %s", logs.String())
+	}
+	if len(budgets.routes) != 1 {
+		t.Errorf("Expected only budgeted routes to be tracked, got %d", len(budgets.routes))
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	samples := make([]time.Duration, 0, 200)
+	for i := 200; i > 0; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	if got := percentile(samples, 0.99); got != 198*time.Millisecond {
+		t.Errorf("p99 = %v, want 198ms", got)
+	}
+	if got := percentile(nil, 0.99); got != 0 {
+		t.Errorf("p99 of no samples = %v, want 0", got)
+	}
+}
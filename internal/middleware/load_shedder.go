@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// Load shedding reasons
+const (
+	ShedQueueFull = "queue_full"
+	ShedTimeout   = "timeout"
+)
+
+// DefaultShedQueueTimeout is how long a queued request waits for a slot by default
+const DefaultShedQueueTimeout = 100 * time.Millisecond
+
+// LoadShedder bounds the number of requests being processed. Requests over the limit
+// wait in a bounded queue for a free slot; when the queue is full or the wait times
+// out they are shed immediately, so overload shows up as fast 503s rather than
+// ever-growing latency.
+type LoadShedder struct {
+	slots        chan struct{}
+	maxQueue     int64
+	queueTimeout time.Duration
+
+	queued atomic.Int64
+
+	shedQueueFull atomic.Uint64
+	shedTimeout   atomic.Uint64
+}
+
+// NewLoadShedder creates a shedder allowing maxInFlight concurrent requests and up to
+// maxQueue waiting ones, each for at most queueTimeout
+func NewLoadShedder(maxInFlight, maxQueue int, queueTimeout time.Duration) *LoadShedder {
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+	if queueTimeout <= 0 {
+		queueTimeout = DefaultShedQueueTimeout
+	}
+
+	return &LoadShedder{
+		slots:        make(chan struct{}, maxInFlight),
+		maxQueue:     int64(maxQueue),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Acquire takes a processing slot, queueing if none is free. On success the caller
+// must call Release when the request finishes; on failure it returns the shed reason.
+func (s *LoadShedder) Acquire(ctx context.Context) (ok bool, reason string) {
+	select {
+	case s.slots <- struct{}{}:
+		return true, ""
+	default:
+	}
+
+	if s.queued.Add(1) > s.maxQueue {
+		s.queued.Add(-1)
+		s.shedQueueFull.Add(1)
+		return false, ShedQueueFull
+	}
+	defer s.queued.Add(-1)
+
+	timer := time.NewTimer(s.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.slots <- struct{}{}:
+		return true, ""
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	s.shedTimeout.Add(1)
+	return false, ShedTimeout
+}
+
+// Release frees a slot taken by a successful Acquire
+func (s *LoadShedder) Release() {
+	<-s.slots
+}
+
+// Active returns the number of requests currently holding a slot
+func (s *LoadShedder) Active() int {
+	return len(s.slots)
+}
+
+// Queued returns the number of requests waiting for a slot
+func (s *LoadShedder) Queued() int64 {
+	return s.queued.Load()
+}
+
+// RegisterMetrics exposes load shedder metrics on the registry
+func (s *LoadShedder) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("ipgeo_load_shedder_active",
+		"Requests currently being processed under the load shedder",
+		func() float64 { return float64(s.Active()) })
+	registry.NewGaugeFunc("ipgeo_load_shedder_queued",
+		"Requests waiting for a processing slot",
+		func() float64 { return float64(s.queued.Load()) })
+	registry.NewCounterFunc("ipgeo_load_shedder_shed_queue_full_total",
+		"Requests shed because the wait queue was full",
+		func() float64 { return float64(s.shedQueueFull.Load()) })
+	registry.NewCounterFunc("ipgeo_load_shedder_shed_timeout_total",
+		"Requests shed because no slot freed up within the queue timeout",
+		func() float64 { return float64(s.shedTimeout.Load()) })
+}
+
+// LoadSheddingMiddleware admits requests through the shedder, returning 503 with
+// Retry-After when a request is shed. Health and metrics endpoints are exempt.
+func LoadSheddingMiddleware(shedder *LoadShedder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" || strings.HasPrefix(r.URL.Path, "/health/") || r.URL.Path == "/metrics" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if ok, _ := shedder.Acquire(r.Context()); !ok {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"error": "Service is overloaded. Try again later."}`))
+				return
+			}
+			defer shedder.Release()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoadShedder_Acquire(t *testing.T) {
+	shedder := NewLoadShedder(1, 1, 20*time.Millisecond)
+
+	if ok, _ := shedder.Acquire(context.Background()); !ok {
+		t.Fatal("Expected first request to get a slot")
+	}
+
+	// A queued request is admitted once the slot frees up
+	admitted := make(chan bool)
+	go func() {
+		ok, _ := shedder.Acquire(context.Background())
+		admitted <- ok
+	}()
+	for shedder.Queued() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if ok, reason := shedder.Acquire(context.Background()); ok || reason != ShedQueueFull {
+		t.Errorf("Expected request beyond the queue to be shed with %s, got ok=%v reason=%s", ShedQueueFull, ok, reason)
+	}
+
+	shedder.Release()
+	if !<-admitted {
+		t.Fatal("Expected queued request to be admitted after a release")
+	}
+
+	// Waiting longer than the queue timeout sheds the request
+	if ok, reason := shedder.Acquire(context.Background()); ok || reason != ShedTimeout {
+		t.Errorf("Expected queued request to time out, got ok=%v reason=%s", ok, reason)
+	}
+	if shedder.Active() != 1 || shedder.Queued() != 0 {
+		t.Errorf("Expected 1 active and 0 queued, got %d and %d", shedder.Active(), shedder.Queued())
+	}
+}
+
+func TestLoadSheddingMiddleware(t *testing.T) {
+	shedder := NewLoadShedder(1, 0, 10*time.Millisecond)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := LoadSheddingMiddleware(shedder)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+		close(done)
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header on shed requests")
+	}
+
+	// Health checks bypass the shedder
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected health check to bypass shedding, got %d", w.Code)
+	}
+
+	close(release)
+	<-done
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected request to succeed once capacity frees up, got %d", w.Code)
+	}
+}
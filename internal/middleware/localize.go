@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"ip-geolocation-service/internal/messages"
+)
+
+// localizeWriter holds back JSON error responses so their message can be translated
+type localizeWriter struct {
+	http.ResponseWriter
+	lang      string
+	status    int
+	buffering bool
+	body      bytes.Buffer
+}
+
+func (w *localizeWriter) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = code
+	if code >= http.StatusBadRequest && strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.Header().Add("Vary", "Accept-Language")
+		if w.lang != messages.Default {
+			w.buffering = true
+			return
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *localizeWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buffering {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *localizeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish sends a held back error response, translated when the catalog has its message
+func (w *localizeWriter) finish() {
+	if !w.buffering {
+		return
+	}
+	body, translated := localizeError(w.body.Bytes(), w.lang)
+	if translated {
+		w.Header().Set("Content-Language", w.lang)
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+}
+
+// localizeError translates the "error" field of an error body to lang, leaving the
+// rest of the body as it was written
+func localizeError(body []byte, lang string) ([]byte, bool) {
+	var response struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &response) != nil || response.Error == "" {
+		return body, false
+	}
+	translated, ok := messages.Translate(lang, response.Error)
+	if !ok {
+		return body, false
+	}
+	from, _ := json.Marshal(response.Error)
+	to, _ := json.Marshal(translated)
+	if !bytes.Contains(body, from) {
+		return body, false
+	}
+	return bytes.Replace(body, from, to, 1), true
+}
+
+// LocalizeErrorsMiddleware translates the message of JSON error responses into the
+// language the client prefers in Accept-Language, falling back to English for
+// languages and messages the catalog lacks. Codes and every other field are left as
+// they are, so clients can keep matching on them.
+func LocalizeErrorsMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lw := &localizeWriter{ResponseWriter: w, lang: messages.Negotiate(r.Header.Get("Accept-Language"))}
+			next.ServeHTTP(lw, r)
+			lw.finish()
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalizeErrorsMiddleware(t *testing.T) {
+	handler := LocalizeErrorsMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/timeout":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			w.Write([]byte(`{"error":"Lookup timed out",`))
+			w.Write([]byte(`"code":"lookup_timeout"}`))
+		case "/v1/duplicate":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"duplicate query parameter: ip","code":"duplicate_parameter"}`))
+		case "/v1/batch":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte(`{"error":"Batch exceeds 100 addresses","code":"batch_too_large"}`))
+		case "/v1/text":
+			http.Error(w, "Lookup timed out", http.StatusGatewayTimeout)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"error":"Lookup timed out"}`))
+		}
+	}))
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptLanguage string
+		wantBody       string
+		wantLanguage   string
+		wantVary       bool
+	}{
+		{"french", "/v1/timeout", "fr-CA,fr;q=0.9,en;q=0.5", `{"error":"La recherche a expiré","code":"lookup_timeout"}`, "fr", true},
+		{"hebrew", "/v1/timeout", "he", `{"error":"זמן החיפוש הסתיים","code":"lookup_timeout"}`, "he", true},
+		{"english", "/v1/timeout", "en-US", `{"error":"Lookup timed out","code":"lookup_timeout"}`, "", true},
+		{"no header", "/v1/timeout", "", `{"error":"Lookup timed out","code":"lookup_timeout"}`, "", true},
+		{"unsupported language", "/v1/timeout", "de", `{"error":"Lookup timed out","code":"lookup_timeout"}`, "", true},
+		{"message with a detail", "/v1/duplicate", "fr", `{"error":"paramètre de requête en double: ip","code":"duplicate_parameter"}`, "fr", true},
+		{"message missing from the catalog", "/v1/batch", "he", `{"error":"Batch exceeds 100 addresses","code":"batch_too_large"}`, "", true},
+		{"plain text error", "/v1/text", "fr", "Lookup timed out\n", "", false},
+		{"success", "/v1/find-country", "fr", `{"error":"Lookup timed out"}`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("Body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+			if got := w.Header().Get("Content-Language"); got != tt.wantLanguage {
+				t.Errorf("Content-Language = %q, want %q", got, tt.wantLanguage)
+			}
+			if got := w.Header().Get("Vary") == "Accept-Language"; got != tt.wantVary {
+				t.Errorf("Vary = %q, want Accept-Language: %v", w.Header().Get("Vary"), tt.wantVary)
+			}
+		})
+	}
+}
+
+func TestLocalizeErrorsMiddleware_KeepsStatus(t *testing.T) {
+	handler := LocalizeErrorsMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error": "Rate limit exceeded. Try again later."}`))
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/find-country", nil)
+	req.Header.Set("Accept-Language", "fr")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the first status 429, got %d", w.Code)
+	}
+	if want := `{"error": "Limite de débit dépassée. Réessayez plus tard."}`; w.Body.String() != want {
+		t.Errorf("Body = %s, want %s", w.Body.String(), want)
+	}
+}
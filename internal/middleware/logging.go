@@ -1,43 +1,155 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log/slog"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"ip-geolocation-service/internal/experiments"
+	"ip-geolocation-service/internal/requestcontext"
 )
 
+// RequestIDHeader carries the request's correlation ID. A well-formed ID sent by the
+// client is kept; otherwise one is generated. Either way it is echoed on the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 128
+
+// requestID returns the client's request ID if it is usable, or a new random one
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); id != "" && len(id) <= maxRequestIDLength && isPrintableASCII(id) {
+		return id
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// isPrintableASCII reports whether s contains only visible ASCII characters
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] <= ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// LogSampler decides which completed requests are logged: every failed request
+// (status >= 400) and one in N successful ones
+type LogSampler struct {
+	rate    atomic.Int64
+	counter atomic.Uint64
+}
+
+// NewLogSampler creates a sampler logging one in rate successful requests (rate <= 1 logs all)
+func NewLogSampler(rate int) *LogSampler {
+	s := &LogSampler{}
+	s.SetRate(rate)
+	return s
+}
+
+// SetRate changes the sampling rate at runtime
+func (s *LogSampler) SetRate(rate int) {
+	if rate < 1 {
+		rate = 1
+	}
+	s.rate.Store(int64(rate))
+}
+
+// Rate returns the current sampling rate
+func (s *LogSampler) Rate() int {
+	return int(s.rate.Load())
+}
+
+// Sample reports whether a request that completed with statusCode should be logged
+func (s *LogSampler) Sample(statusCode int) bool {
+	if statusCode >= http.StatusBadRequest {
+		return true
+	}
+	rate := uint64(s.rate.Load())
+	return rate <= 1 || s.counter.Add(1)%rate == 1
+}
+
 // LoggingMiddleware creates a middleware for request logging
 func LoggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return LoggingMiddlewareWithSampler(logger, nil)
+}
+
+// LoggingMiddlewareWithSampler logs requests chosen by sampler; a nil sampler logs every request
+func LoggingMiddlewareWithSampler(logger *slog.Logger, sampler *LogSampler) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 
+			id := requestID(r)
+			w.Header().Set(RequestIDHeader, id)
+			r = r.WithContext(requestcontext.WithRequestID(r.Context(), id))
+
 			// Wrap the ResponseWriter to capture status code
-			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			wrapped := newResponseWriter(w)
 
 			// Process the request
 			next.ServeHTTP(wrapped, r)
+			status := wrapped.statusCode
+			wrapped.release()
 
 			// Log the request
 			duration := time.Since(start)
-
-			// Extract client IP more cleanly
-			clientIP := getClientIP(r)
+			if sampler != nil && !sampler.Sample(status) {
+				return
+			}
 
 			// Create a more readable log message
-			logger.Info("Request completed",
-				"method", r.Method,
-				"path", r.URL.Path,
-				"status", wrapped.statusCode,
-				"duration", duration.String(),
-				"client_ip", clientIP,
-				"user_agent", r.UserAgent(),
+			attrs := getLogAttrs()
+			*attrs = append(*attrs,
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.String("duration", duration.String()),
+				slog.String("client_ip", getClientIP(r)),
+				slog.String("user_agent", r.UserAgent()),
+				slog.String("request_id", id),
 			)
+			if e, ok := experiments.FromContext(r.Context()); ok {
+				*attrs = append(*attrs, slog.String("experiment", e.Name))
+			}
+
+			// Sampled successes carry the rate so volumes can be extrapolated
+			if sampler != nil && status < http.StatusBadRequest && sampler.Rate() > 1 {
+				*attrs = append(*attrs, slog.Int("sample_rate", sampler.Rate()))
+			}
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "Request completed", *attrs...)
+			putLogAttrs(attrs)
 		})
 	}
 }
 
+// logAttrs recycles the attribute slices of request log lines; handlers copy the
+// attributes they keep, so a slice is free again once the line is logged
+var logAttrs = sync.Pool{
+	New: func() any {
+		attrs := make([]slog.Attr, 0, 10)
+		return &attrs
+	},
+}
+
+func getLogAttrs() *[]slog.Attr {
+	return logAttrs.Get().(*[]slog.Attr)
+}
+
+func putLogAttrs(attrs *[]slog.Attr) {
+	clear(*attrs) // Don't pin the request's strings
+	*attrs = (*attrs)[:0]
+	logAttrs.Put(attrs)
+}
+
 // getClientIP extracts the real client IP from request
 func getClientIP(r *http.Request) string {
 	// Check for real IP header (from reverse proxy)
@@ -72,7 +184,33 @@ type responseWriter struct {
 	statusCode int
 }
 
+// responseWriters recycles the status-capturing wrappers several middleware put
+// around every request
+var responseWriters = sync.Pool{
+	New: func() any { return new(responseWriter) },
+}
+
+// newResponseWriter wraps w, reporting 200 until the handler sets a status. Call
+// release once the handler has returned and the status has been read.
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	rw := responseWriters.Get().(*responseWriter)
+	rw.ResponseWriter = w
+	rw.statusCode = http.StatusOK
+	return rw
+}
+
+// release returns rw to the pool; it must not be used afterwards
+func (rw *responseWriter) release() {
+	rw.ResponseWriter = nil
+	responseWriters.Put(rw)
+}
+
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap lets http.ResponseController reach the underlying writer (e.g. to flush)
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -1,12 +1,15 @@
 package middleware
 
 import (
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
+
+	"ip-geolocation-service/internal/requestcontext"
 )
 
 func TestLoggingMiddleware(t *testing.T) {
@@ -215,6 +218,33 @@ func TestResponseWriter_WriteHeader(t *testing.T) {
 	}
 }
 
+func TestResponseWriter_PooledWrapperStartsFresh(t *testing.T) {
+	var logOutput strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logOutput, nil))
+
+	// Wrappers are recycled across requests: a status set by one request must not
+	// leak into the next, which never calls WriteHeader
+	status := http.StatusTeapot
+	handler := LoggingMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+		status = http.StatusOK
+	}
+
+	if got := strings.Count(logOutput.String(), "status=418"); got != 1 {
+		t.Errorf("Expected one request logged with status 418, got %d:\n%s", got, logOutput.String())
+	}
+	if got := strings.Count(logOutput.String(), "status=200"); got != 2 {
+		t.Errorf("Expected two requests logged with status 200, got %d:\n%s", got, logOutput.String())
+	}
+}
+
 func TestLoggingMiddleware_Duration(t *testing.T) {
 	var logOutput strings.Builder
 	logger := slog.New(slog.NewTextHandler(&logOutput, &slog.HandlerOptions{
@@ -270,3 +300,96 @@ func TestLoggingMiddleware_ErrorStatus(t *testing.T) {
 		t.Error("Expected error status to be logged")
 	}
 }
+
+func TestLoggingMiddleware_Sampling(t *testing.T) {
+	var logOutput strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logOutput, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+
+	sampler := NewLogSampler(10)
+	status := http.StatusOK
+	wrappedHandler := LoggingMiddlewareWithSampler(logger, sampler)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	for i := 0; i < 25; i++ {
+		wrappedHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+	}
+	if got := strings.Count(logOutput.String(), "status=200"); got != 3 {
+		t.Errorf("Expected 3 of 25 successful requests logged at 1/10, got %d", got)
+	}
+	if !strings.Contains(logOutput.String(), "sample_rate=10") {
+		t.Error("Expected sampled records to carry the sample rate")
+	}
+
+	// Errors are always logged
+	status = http.StatusInternalServerError
+	for i := 0; i < 5; i++ {
+		wrappedHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+	}
+	if got := strings.Count(logOutput.String(), "status=500"); got != 5 {
+		t.Errorf("Expected every error logged, got %d", got)
+	}
+
+	// Rate 1 logs everything
+	logOutput.Reset()
+	sampler.SetRate(1)
+	status = http.StatusOK
+	for i := 0; i < 4; i++ {
+		wrappedHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+	}
+	if got := strings.Count(logOutput.String(), "status=200"); got != 4 {
+		t.Errorf("Expected all requests logged at rate 1, got %d", got)
+	}
+}
+
+func TestLoggingMiddleware_RequestID(t *testing.T) {
+	var logOutput strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logOutput, nil))
+
+	var seen string
+	handler := LoggingMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = requestcontext.RequestID(r.Context())
+	}))
+
+	// A well-formed client ID is kept
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if seen != "abc-123" || w.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("Expected client request ID to be kept, got context %q header %q", seen, w.Header().Get(RequestIDHeader))
+	}
+	if !strings.Contains(logOutput.String(), "request_id=abc-123") {
+		t.Error("Expected log to contain request ID")
+	}
+
+	// Missing or malformed IDs are replaced
+	for _, header := range []string{"", "has space", strings.Repeat("x", maxRequestIDLength+1)} {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set(RequestIDHeader, header)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if len(seen) != 16 || seen == header || w.Header().Get(RequestIDHeader) != seen {
+			t.Errorf("%q: expected a generated request ID, got %q", header, seen)
+		}
+	}
+}
+
+func BenchmarkLoggingMiddleware(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := LoggingMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	req.Header.Set(RequestIDHeader, "bench")
+	w := httptest.NewRecorder()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, req)
+	}
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/models"
+)
+
+// DefaultMaintenanceMessage is returned to clients when no message is configured
+const DefaultMaintenanceMessage = "Service is under maintenance. Please try again later."
+
+// MaintenanceState is a snapshot of the maintenance toggle
+type MaintenanceState struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// MaintenanceMode is a runtime toggle that takes public endpoints out of service
+type MaintenanceMode struct {
+	mu      sync.RWMutex
+	enabled bool
+	message string
+	since   time.Time
+}
+
+// NewMaintenanceMode creates a maintenance toggle in the given initial state
+func NewMaintenanceMode(enabled bool, message string) *MaintenanceMode {
+	m := &MaintenanceMode{}
+	if enabled {
+		m.Enable(message)
+	} else {
+		m.message = message
+	}
+	return m
+}
+
+// Enable turns maintenance mode on; an empty message keeps the current one
+func (m *MaintenanceMode) Enable(message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if message != "" {
+		m.message = message
+	}
+	if !m.enabled {
+		m.enabled = true
+		m.since = time.Now()
+	}
+}
+
+// Disable turns maintenance mode off
+func (m *MaintenanceMode) Disable() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.enabled = false
+	m.since = time.Time{}
+}
+
+// State returns the current maintenance state
+func (m *MaintenanceMode) State() MaintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state := MaintenanceState{Enabled: m.enabled, Message: m.message}
+	if state.Message == "" {
+		state.Message = DefaultMaintenanceMessage
+	}
+	if m.enabled {
+		since := m.since
+		state.Since = &since
+	}
+	return state
+}
+
+// RegisterMetrics exposes the maintenance toggle on the registry
+func (m *MaintenanceMode) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("ipgeo_maintenance_mode",
+		"Whether maintenance mode is enabled (1) or not (0)",
+		func() float64 {
+			if m.State().Enabled {
+				return 1
+			}
+			return 0
+		})
+}
+
+// isOperationalPath reports whether path serves operators rather than API clients
+func isOperationalPath(path string) bool {
+	for _, prefix := range []string{"/health", "/admin", "/debug", "/metrics"} {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// MaintenanceMiddleware returns 503 for public endpoints while maintenance mode is enabled.
+// Health, admin, debug and metrics endpoints stay responsive so operators can turn it off.
+func MaintenanceMiddleware(mode *MaintenanceMode) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state := mode.State()
+			if !state.Enabled || isOperationalPath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			response, err := models.NewErrorResponseWithCode(state.Message, "maintenance").ToJSON()
+			if err != nil {
+				response = []byte(`{"error": "` + DefaultMaintenanceMessage + `", "code": "maintenance"}`)
+			}
+			w.Write(response)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaintenanceMode_Toggle(t *testing.T) {
+	mode := NewMaintenanceMode(false, "")
+
+	if state := mode.State(); state.Enabled || state.Since != nil {
+		t.Fatalf("Expected maintenance disabled, got %+v", state)
+	}
+	if mode.State().Message != DefaultMaintenanceMessage {
+		t.Errorf("Expected default message, got %q", mode.State().Message)
+	}
+
+	mode.Enable("Swapping datasets")
+	state := mode.State()
+	if !state.Enabled || state.Message != "Swapping datasets" || state.Since == nil {
+		t.Errorf("Expected maintenance enabled with message, got %+v", state)
+	}
+
+	mode.Disable()
+	if mode.State().Enabled {
+		t.Error("Expected maintenance disabled")
+	}
+}
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	mode := NewMaintenanceMode(true, "Back soon")
+	handler := MaintenanceMiddleware(mode)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/v1/find-country", http.StatusServiceUnavailable},
+		{"/", http.StatusServiceUnavailable},
+		{"/healthz", http.StatusServiceUnavailable},
+		{"/health", http.StatusOK},
+		{"/admin/maintenance", http.StatusOK},
+		{"/debug/rate-limiter", http.StatusOK},
+		{"/metrics", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.want, w.Code)
+		}
+		if tt.want == http.StatusServiceUnavailable {
+			if !strings.Contains(w.Body.String(), "Back soon") || w.Header().Get("Retry-After") == "" {
+				t.Errorf("%s: expected maintenance message and Retry-After, got %s", tt.path, w.Body.String())
+			}
+		}
+	}
+
+	mode.Disable()
+	req := httptest.NewRequest("GET", "/v1/find-country", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 after disabling maintenance, got %d", w.Code)
+	}
+}
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	handler := AdminAuthMiddleware("secret", false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer nope", http.StatusUnauthorized},
+		{"wrong scheme", "Basic secret", http.StatusUnauthorized},
+		{"valid", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/admin/maintenance", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+
+	open := AdminAuthMiddleware("", false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	open.ServeHTTP(w, httptest.NewRequest("GET", "/admin/maintenance", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected open admin endpoints without a token, got %d", w.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"ip-geolocation-service/internal/models"
+)
+
+var (
+	// ErrMalformedQuery is returned (wrapped) for a query string that doesn't decode
+	// cleanly: a bad %-escape, a ';' separator, or a name or value that isn't valid
+	// UTF-8 or holds control characters
+	ErrMalformedQuery = errors.New("malformed query string")
+	// ErrDuplicateParam is returned (wrapped) for a parameter given more than once
+	ErrDuplicateParam = errors.New("duplicate query parameter")
+)
+
+// ParseQuery decodes a raw query string strictly. Where url.ParseQuery skips what it
+// can't decode and keeps every repeat of a parameter, leaving handlers to guess which
+// one the client meant, ParseQuery rejects the whole query instead.
+func ParseQuery(rawQuery string) (url.Values, error) {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedQuery, err)
+	}
+	// Sorted so the same query always reports the same parameter
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if !cleanQueryText(name) {
+			return nil, fmt.Errorf("%w: parameter name %q", ErrMalformedQuery, name)
+		}
+		if len(values[name]) > 1 {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateParam, name)
+		}
+		if !cleanQueryText(values[name][0]) {
+			return nil, fmt.Errorf("%w: parameter %s has an invalid value", ErrMalformedQuery, name)
+		}
+	}
+	return values, nil
+}
+
+// cleanQueryText reports whether a decoded name or value is valid UTF-8 without
+// control characters
+func cleanQueryText(s string) bool {
+	return utf8.ValidString(s) && !strings.ContainsFunc(s, unicode.IsControl)
+}
+
+// StrictQueryMiddleware rejects requests whose query string ParseQuery refuses with a
+// 400, so every endpoint sees at most one cleanly decoded value per parameter
+func StrictQueryMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.RawQuery == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if _, err := ParseQuery(r.URL.RawQuery); err != nil {
+				WriteQueryError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WriteQueryError answers a query ParseQuery refused with a 400, coded
+// duplicate_parameter or malformed_query
+func WriteQueryError(w http.ResponseWriter, err error) {
+	code := "malformed_query"
+	if errors.Is(err, ErrDuplicateParam) {
+		code = "duplicate_parameter"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	response := models.ErrorResponse{Error: err.Error(), Code: code}
+	w.Write(response.AppendJSON(nil))
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		raw     string
+		wantErr error
+	}{
+		{"", nil},
+		{"ip=8.8.8.8&lang=de", nil},
+		{"ip=2001%3Adb8%3A%3A1", nil},
+		{"name=M%C3%BCnchen", nil},
+		{"flag", nil},
+		{"ip=8.8.8.8&ip=1.1.1.1", ErrDuplicateParam},
+		{"ip=&ip=8.8.8.8", ErrDuplicateParam},
+		{"ip=8.8.8.8&ip=8.8.8.8", ErrDuplicateParam},
+		{"ip=%zz", ErrMalformedQuery},
+		{"ip=8.8.8.8%", ErrMalformedQuery},
+		{"ip=8.8.8.8;lang=de", ErrMalformedQuery},
+		{"ip=%ff", ErrMalformedQuery},
+		{"ip=8.8.8.8%0A", ErrMalformedQuery},
+		{"%00=1", ErrMalformedQuery},
+	}
+	for _, tt := range tests {
+		values, err := ParseQuery(tt.raw)
+		if tt.wantErr == nil {
+			if err != nil {
+				t.Errorf("ParseQuery(%q) error = %v", tt.raw, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.wantErr) || values != nil {
+			t.Errorf("ParseQuery(%q) = %v, %v, want %v", tt.raw, values, err, tt.wantErr)
+		}
+	}
+}
+
+func TestStrictQueryMiddleware(t *testing.T) {
+	called := false
+	handler := StrictQueryMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8&ip=1.1.1.1", nil))
+	if called || w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected a duplicate parameter to be rejected with 400, got %d (handler called: %v)", w.Code, called)
+	}
+	if want := `{"error":"duplicate query parameter: ip","code":"duplicate_parameter"}`; w.Body.String() != want {
+		t.Errorf("Body = %s, want %s", w.Body.String(), want)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil))
+	if !called {
+		t.Error("Expected a clean query to reach the handler")
+	}
+}
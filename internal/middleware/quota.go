@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ip-geolocation-service/internal/quota"
+)
+
+// UsagePath is the endpoint reporting quota usage; checking it never consumes quota
+const UsagePath = "/v1/usage"
+
+// SetQuotaHeaders reports usage in X-Quota-{Daily,Monthly}-{Limit,Remaining,Reset}
+// headers; Reset is a Unix timestamp
+func SetQuotaHeaders(h http.Header, usage quota.Usage) {
+	for name, period := range map[string]*quota.Period{"Daily": usage.Daily, "Monthly": usage.Monthly} {
+		if period == nil {
+			continue
+		}
+		h.Set("X-Quota-"+name+"-Limit", strconv.FormatInt(period.Limit, 10))
+		h.Set("X-Quota-"+name+"-Remaining", strconv.FormatInt(period.Remaining, 10))
+		h.Set("X-Quota-"+name+"-Reset", strconv.FormatInt(period.ResetsAt.Unix(), 10))
+	}
+}
+
+// QuotaMiddleware charges each authenticated /v1 request to the client's daily and
+// monthly quotas, rejecting it with 429 once a quota is used up. Anonymous requests
+// are governed by rate limits only. A failing quota store lets requests through.
+func QuotaMiddleware(tracker *quota.Tracker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, ok := APIKeyFromContext(r.Context())
+			if !ok || apiKey.QuotaID == "" || !strings.HasPrefix(r.URL.Path, "/v1/") || r.URL.Path == UsagePath {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			usage, allowed, err := tracker.Consume(apiKey.QuotaID)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			SetQuotaHeaders(w.Header(), usage)
+
+			if !allowed {
+				retryAfter := time.Duration(0)
+				for _, period := range []*quota.Period{usage.Daily, usage.Monthly} {
+					if period.Exhausted() {
+						retryAfter = max(retryAfter, time.Until(period.ResetsAt))
+					}
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", max(int(math.Ceil(retryAfter.Seconds())), 1)))
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"error": "Quota exceeded. Try again after it resets.", "code": "quota_exceeded"}`))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ip-geolocation-service/internal/quota"
+)
+
+func TestQuotaMiddleware(t *testing.T) {
+	store, err := NewAPIKeyStoreWithRoles(map[string]string{"client-key": ""}, nil)
+	if err != nil {
+		t.Fatalf("NewAPIKeyStoreWithRoles() error = %v", err)
+	}
+	tracker := quota.NewTracker(quota.NewMemoryStore(""), quota.Limits{Daily: 2})
+	handler := APIKeyMiddleware(store)(QuotaMiddleware(tracker)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	serve := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("/v1/find-country?ip=8.8.8.8", "client-key")
+	if w.Code != http.StatusOK || w.Header().Get("X-Quota-Daily-Limit") != "2" || w.Header().Get("X-Quota-Daily-Remaining") != "1" {
+		t.Fatalf("First request = %d, headers %v", w.Code, w.Header())
+	}
+	if w.Header().Get("X-Quota-Daily-Reset") == "" || w.Header().Get("X-Quota-Monthly-Limit") != "" {
+		t.Errorf("Unexpected quota headers %v", w.Header())
+	}
+
+	// Usage checks, anonymous requests and non-API paths don't consume quota
+	serve(UsagePath, "client-key")
+	serve("/v1/find-country?ip=8.8.8.8", "")
+	serve("/health", "client-key")
+
+	if w := serve("/v1/find-country?ip=8.8.8.8", "client-key"); w.Code != http.StatusOK {
+		t.Fatalf("Second request status = %d, want %d", w.Code, http.StatusOK)
+	}
+	w = serve("/v1/find-country?ip=8.8.8.8", "client-key")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" || w.Header().Get("X-Quota-Daily-Remaining") != "0" {
+		t.Errorf("Request over quota = %d, headers %v", w.Code, w.Header())
+	}
+	if w := serve("/v1/find-country?ip=8.8.8.8", ""); w.Code != http.StatusOK {
+		t.Errorf("Anonymous request status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// RateLimitExemptions lists requests that bypass per-client rate limiting, such
+// as Kubernetes probes and uptime checkers. Source ranges are matched against
+// the connection's peer address, never against forwarding headers, so clients
+// can't exempt themselves by spoofing X-Forwarded-For.
+type RateLimitExemptions struct {
+	paths    []string
+	networks []netip.Prefix
+
+	exempted atomic.Uint64
+}
+
+// NewRateLimitExemptions creates exemptions for requests whose path starts with
+// one of paths or whose peer address falls in one of cidrs. Bare addresses are
+// accepted as single-host ranges.
+func NewRateLimitExemptions(paths, cidrs []string) (*RateLimitExemptions, error) {
+	e := &RateLimitExemptions{}
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("rate limit exempt path must start with '/': %s", path)
+		}
+		e.paths = append(e.paths, path)
+	}
+	for _, cidr := range cidrs {
+		prefix, err := parsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit exempt range %q: %w", cidr, err)
+		}
+		e.networks = append(e.networks, prefix)
+	}
+	return e, nil
+}
+
+// parsePrefix parses a CIDR range or a bare address
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// Len returns the number of configured exemptions
+func (e *RateLimitExemptions) Len() int {
+	return len(e.paths) + len(e.networks)
+}
+
+// Exempt reports whether r bypasses rate limiting
+func (e *RateLimitExemptions) Exempt(r *http.Request) bool {
+	for _, path := range e.paths {
+		if strings.HasPrefix(r.URL.Path, path) {
+			return true
+		}
+	}
+	if len(e.networks) == 0 {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, network := range e.networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterMetrics exposes the exemption counter on the registry
+func (e *RateLimitExemptions) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewCounterFunc("ipgeo_rate_limit_exempt_total",
+		"Total requests that bypassed per-client rate limiting",
+		func() float64 { return float64(e.exempted.Load()) })
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitExemptions_Exempt(t *testing.T) {
+	exemptions, err := NewRateLimitExemptions([]string{"/health"}, []string{"10.0.0.0/8", "192.0.2.7"})
+	if err != nil {
+		t.Fatalf("NewRateLimitExemptions() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		forwarded  string
+		want       bool
+	}{
+		{"exempt path", "/health", "203.0.113.1:1234", "", true},
+		{"exempt path prefix", "/health/ready", "203.0.113.1:1234", "", true},
+		{"exempt range", "/v1/find-country", "10.1.2.3:1234", "", true},
+		{"exempt address", "/v1/find-country", "192.0.2.7:1234", "", true},
+		{"IPv4-mapped peer", "/v1/find-country", "[::ffff:10.1.2.3]:1234", "", true},
+		{"other client", "/v1/find-country", "203.0.113.1:1234", "", false},
+		{"spoofed forwarding header", "/v1/find-country", "203.0.113.1:1234", "10.1.2.3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := exemptions.Exempt(req); got != tt.want {
+				t.Errorf("Exempt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRateLimitExemptions_Invalid(t *testing.T) {
+	if _, err := NewRateLimitExemptions([]string{"health"}, nil); err == nil {
+		t.Error("Expected error for path without leading slash")
+	}
+	if _, err := NewRateLimitExemptions(nil, []string{"10.0.0.0/33"}); err == nil {
+		t.Error("Expected error for invalid range")
+	}
+}
+
+func TestRateLimitMiddlewareWithExemptions(t *testing.T) {
+	rateLimiter := NewRateLimiter(1, 1, time.Second, time.Minute, 5*time.Minute)
+	exemptions, err := NewRateLimitExemptions([]string{"/health"}, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatalf("NewRateLimitExemptions() error = %v", err)
+	}
+	handler := RateLimitMiddlewareWithExemptions(rateLimiter, exemptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(path, remoteAddr string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Exempt requests never consume the single token
+	for i := 0; i < 5; i++ {
+		if code := serve("/health", "203.0.113.1:1234"); code != http.StatusOK {
+			t.Fatalf("Exempt path request %d status = %d, want %d", i, code, http.StatusOK)
+		}
+		if code := serve("/v1/find-country", "127.0.0.1:1234"); code != http.StatusOK {
+			t.Fatalf("Exempt peer request %d status = %d, want %d", i, code, http.StatusOK)
+		}
+	}
+	if code := serve("/v1/find-country", "203.0.113.1:1234"); code != http.StatusOK {
+		t.Errorf("First limited request status = %d, want %d", code, http.StatusOK)
+	}
+	if code := serve("/v1/find-country", "203.0.113.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("Second limited request status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	if got := exemptions.exempted.Load(); got != 10 {
+		t.Errorf("Exempted %d requests, want 10", got)
+	}
+}
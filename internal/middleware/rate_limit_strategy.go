@@ -0,0 +1,351 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rate limiting algorithms
+const (
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmSlidingWindow = "sliding_window"
+	AlgorithmLeakyBucket   = "leaky_bucket"
+)
+
+// RateLimiterStrategy implements a rate limiting algorithm over per-client state.
+// RateLimiter serializes all calls, so implementations need not be thread-safe.
+type RateLimiterStrategy interface {
+	// Name returns the algorithm name
+	Name() string
+
+	// Allow consumes capacity for the client and reports whether the request may proceed
+	Allow(clientID string, now time.Time) bool
+
+	// Remaining returns the number of requests the client could make right now
+	Remaining(clientID string, now time.Time) int
+
+	// LastSeen returns when the client was last seen
+	LastSeen(clientID string) (time.Time, bool)
+
+	// Clients returns the IDs of all tracked clients
+	Clients() []string
+
+	// Cleanup drops state for clients not seen since cutoff
+	Cleanup(cutoff time.Time)
+}
+
+// NewRateLimiterStrategy creates the strategy for the named algorithm
+func NewRateLimiterStrategy(algorithm string, requestsPerSecond, burstSize int, windowSize, inactiveThreshold time.Duration) (RateLimiterStrategy, error) {
+	switch algorithm {
+	case AlgorithmTokenBucket, "":
+		return newTokenBucketStrategy(requestsPerSecond, burstSize, inactiveThreshold), nil
+	case AlgorithmSlidingWindow:
+		return newSlidingWindowStrategy(requestsPerSecond, windowSize), nil
+	case AlgorithmLeakyBucket:
+		return newLeakyBucketStrategy(requestsPerSecond, burstSize), nil
+	default:
+		return nil, fmt.Errorf("unsupported rate limit algorithm: %s", algorithm)
+	}
+}
+
+// tokenBucketStrategy refills burstSize tokens at requestsPerSecond
+type tokenBucketStrategy struct {
+	requestsPerSecond int
+	burstSize         int
+	inactiveThreshold time.Duration
+
+	tokens     map[string]int
+	lastUpdate map[string]time.Time
+}
+
+func newTokenBucketStrategy(requestsPerSecond, burstSize int, inactiveThreshold time.Duration) *tokenBucketStrategy {
+	return &tokenBucketStrategy{
+		requestsPerSecond: requestsPerSecond,
+		burstSize:         burstSize,
+		inactiveThreshold: inactiveThreshold,
+		tokens:            make(map[string]int),
+		lastUpdate:        make(map[string]time.Time),
+	}
+}
+
+func (s *tokenBucketStrategy) Name() string { return AlgorithmTokenBucket }
+
+// calculateCurrentTokens calculates the current number of tokens for a client
+func (s *tokenBucketStrategy) calculateCurrentTokens(clientID string, now time.Time) int {
+	lastUpdate, exists := s.lastUpdate[clientID]
+	if !exists {
+		return 0
+	}
+
+	timeElapsed := now.Sub(lastUpdate)
+	timeElapsedSeconds := timeElapsed.Seconds()
+	tokensToAdd := int(timeElapsedSeconds * float64(s.requestsPerSecond))
+
+	currentTokens := s.tokens[clientID] + tokensToAdd
+	if currentTokens > s.burstSize {
+		currentTokens = s.burstSize
+	}
+	if currentTokens < 0 {
+		currentTokens = 0
+	}
+
+	return currentTokens
+}
+
+func (s *tokenBucketStrategy) Allow(clientID string, now time.Time) bool {
+	// Initialize or reset client if needed
+	if _, exists := s.tokens[clientID]; !exists {
+		if s.requestsPerSecond == 0 {
+			return false
+		}
+		s.tokens[clientID] = s.burstSize
+		s.lastUpdate[clientID] = now
+	} else if now.Sub(s.lastUpdate[clientID]) > s.inactiveThreshold {
+		// Reset inactive client
+		s.tokens[clientID] = s.burstSize
+		s.lastUpdate[clientID] = now
+	}
+
+	// Calculate current tokens and update
+	s.tokens[clientID] = s.calculateCurrentTokens(clientID, now)
+	s.lastUpdate[clientID] = now
+
+	// Check if request is allowed and consume token
+	if s.tokens[clientID] > 0 {
+		s.tokens[clientID]--
+		return true
+	}
+
+	return false
+}
+
+func (s *tokenBucketStrategy) Remaining(clientID string, now time.Time) int {
+	return s.calculateCurrentTokens(clientID, now)
+}
+
+func (s *tokenBucketStrategy) LastSeen(clientID string) (time.Time, bool) {
+	lastUpdate, exists := s.lastUpdate[clientID]
+	return lastUpdate, exists
+}
+
+func (s *tokenBucketStrategy) Clients() []string {
+	clients := make([]string, 0, len(s.tokens))
+	for clientID := range s.tokens {
+		if _, exists := s.lastUpdate[clientID]; exists {
+			clients = append(clients, clientID)
+		}
+	}
+	return clients
+}
+
+func (s *tokenBucketStrategy) Cleanup(cutoff time.Time) {
+	for clientID, lastUpdate := range s.lastUpdate {
+		if lastUpdate.Before(cutoff) {
+			delete(s.tokens, clientID)
+			delete(s.lastUpdate, clientID)
+		}
+	}
+}
+
+// slidingWindowStrategy allows at most limit requests in any window-long interval.
+// It uses the sliding window counter approximation: the previous fixed window's count
+// is weighted by how much of it still overlaps the sliding window.
+type slidingWindowStrategy struct {
+	limit  int
+	window time.Duration
+
+	windows map[string]*slidingWindowState
+}
+
+type slidingWindowState struct {
+	start    time.Time // Start of the current fixed window
+	current  int
+	previous int
+	lastSeen time.Time
+}
+
+func newSlidingWindowStrategy(requestsPerSecond int, window time.Duration) *slidingWindowStrategy {
+	if window <= 0 {
+		window = time.Second
+	}
+	// A window too short for a whole request would reject every request; a zero
+	// rate still does, like the other algorithms
+	limit := int(float64(requestsPerSecond) * window.Seconds())
+	if requestsPerSecond > 0 {
+		limit = max(limit, 1)
+	}
+	return &slidingWindowStrategy{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]*slidingWindowState),
+	}
+}
+
+func (s *slidingWindowStrategy) Name() string { return AlgorithmSlidingWindow }
+
+// advance rolls the client's fixed windows forward to now
+func (s *slidingWindowStrategy) advance(state *slidingWindowState, now time.Time) {
+	elapsed := now.Sub(state.start)
+	if elapsed < s.window {
+		return
+	}
+	if elapsed < 2*s.window {
+		state.previous = state.current
+	} else {
+		state.previous = 0
+	}
+	state.current = 0
+	state.start = state.start.Add(elapsed.Truncate(s.window))
+}
+
+// estimate returns the weighted request count in the sliding window ending at now
+func (s *slidingWindowStrategy) estimate(state *slidingWindowState, now time.Time) float64 {
+	overlap := 1 - float64(now.Sub(state.start))/float64(s.window)
+	return float64(state.previous)*overlap + float64(state.current)
+}
+
+func (s *slidingWindowStrategy) Allow(clientID string, now time.Time) bool {
+	state, exists := s.windows[clientID]
+	if !exists {
+		state = &slidingWindowState{start: now}
+		s.windows[clientID] = state
+	}
+	state.lastSeen = now
+	s.advance(state, now)
+
+	if s.estimate(state, now)+1 > float64(s.limit) {
+		return false
+	}
+
+	state.current++
+	return true
+}
+
+func (s *slidingWindowStrategy) Remaining(clientID string, now time.Time) int {
+	state, exists := s.windows[clientID]
+	if !exists {
+		return s.limit
+	}
+
+	// Work on a copy so inspecting state doesn't roll the windows
+	snapshot := *state
+	s.advance(&snapshot, now)
+	remaining := s.limit - int(s.estimate(&snapshot, now)+0.999999)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+func (s *slidingWindowStrategy) LastSeen(clientID string) (time.Time, bool) {
+	state, exists := s.windows[clientID]
+	if !exists {
+		return time.Time{}, false
+	}
+	return state.lastSeen, true
+}
+
+func (s *slidingWindowStrategy) Clients() []string {
+	clients := make([]string, 0, len(s.windows))
+	for clientID := range s.windows {
+		clients = append(clients, clientID)
+	}
+	return clients
+}
+
+func (s *slidingWindowStrategy) Cleanup(cutoff time.Time) {
+	for clientID, state := range s.windows {
+		if state.lastSeen.Before(cutoff) {
+			delete(s.windows, clientID)
+		}
+	}
+}
+
+// leakyBucketStrategy treats each request as a unit of water poured into a bucket of
+// capacity burstSize that drains continuously at requestsPerSecond. Unlike the token
+// bucket it keeps fractional progress, so steady traffic at the configured rate is never
+// starved by rounding.
+type leakyBucketStrategy struct {
+	rate     float64
+	capacity float64
+
+	buckets map[string]*leakyBucketState
+}
+
+type leakyBucketState struct {
+	level    float64
+	lastLeak time.Time
+}
+
+func newLeakyBucketStrategy(requestsPerSecond, burstSize int) *leakyBucketStrategy {
+	return &leakyBucketStrategy{
+		rate:     float64(requestsPerSecond),
+		capacity: float64(burstSize),
+		buckets:  make(map[string]*leakyBucketState),
+	}
+}
+
+func (s *leakyBucketStrategy) Name() string { return AlgorithmLeakyBucket }
+
+// leak drains the bucket for the time elapsed since the last leak
+func (s *leakyBucketStrategy) leak(state *leakyBucketState, now time.Time) float64 {
+	level := state.level - now.Sub(state.lastLeak).Seconds()*s.rate
+	if level < 0 {
+		level = 0
+	}
+	return level
+}
+
+func (s *leakyBucketStrategy) Allow(clientID string, now time.Time) bool {
+	if s.rate <= 0 {
+		return false
+	}
+
+	state, exists := s.buckets[clientID]
+	if !exists {
+		state = &leakyBucketState{lastLeak: now}
+		s.buckets[clientID] = state
+	}
+
+	state.level = s.leak(state, now)
+	state.lastLeak = now
+
+	if state.level+1 > s.capacity {
+		return false
+	}
+
+	state.level++
+	return true
+}
+
+func (s *leakyBucketStrategy) Remaining(clientID string, now time.Time) int {
+	state, exists := s.buckets[clientID]
+	if !exists {
+		return int(s.capacity)
+	}
+	return int(s.capacity - s.leak(state, now))
+}
+
+func (s *leakyBucketStrategy) LastSeen(clientID string) (time.Time, bool) {
+	state, exists := s.buckets[clientID]
+	if !exists {
+		return time.Time{}, false
+	}
+	return state.lastLeak, true
+}
+
+func (s *leakyBucketStrategy) Clients() []string {
+	clients := make([]string, 0, len(s.buckets))
+	for clientID := range s.buckets {
+		clients = append(clients, clientID)
+	}
+	return clients
+}
+
+func (s *leakyBucketStrategy) Cleanup(cutoff time.Time) {
+	for clientID, state := range s.buckets {
+		if state.lastLeak.Before(cutoff) {
+			delete(s.buckets, clientID)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewRateLimiterStrategy(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		expected  string
+		wantErr   bool
+	}{
+		{AlgorithmTokenBucket, AlgorithmTokenBucket, false},
+		{"", AlgorithmTokenBucket, false},
+		{AlgorithmSlidingWindow, AlgorithmSlidingWindow, false},
+		{AlgorithmLeakyBucket, AlgorithmLeakyBucket, false},
+		{"fixed_window", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			strategy, err := NewRateLimiterStrategy(tt.algorithm, 10, 10, time.Second, time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRateLimiterStrategy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && strategy.Name() != tt.expected {
+				t.Errorf("Expected strategy %s, got %s", tt.expected, strategy.Name())
+			}
+		})
+	}
+}
+
+func TestSlidingWindowStrategy(t *testing.T) {
+	strategy := newSlidingWindowStrategy(5, time.Second)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Five requests fit in the first window, the sixth doesn't
+	for i := 0; i < 5; i++ {
+		if !strategy.Allow("client", start.Add(time.Duration(i)*time.Millisecond)) {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	if strategy.Allow("client", start.Add(10*time.Millisecond)) {
+		t.Error("Request over the window limit should be denied")
+	}
+
+	// Halfway through the next window, half of the previous window's count still applies
+	mid := start.Add(1500 * time.Millisecond)
+	if remaining := strategy.Remaining("client", mid); remaining != 2 {
+		t.Errorf("Expected 2 remaining halfway through the next window, got %d", remaining)
+	}
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if strategy.Allow("client", mid) {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("Expected 2 requests allowed halfway through the next window, got %d", allowed)
+	}
+
+	// After two full idle windows the client starts fresh
+	if remaining := strategy.Remaining("client", start.Add(5*time.Second)); remaining != 5 {
+		t.Errorf("Expected full capacity after idle windows, got %d", remaining)
+	}
+}
+
+func TestSlidingWindowStrategy_ShortWindow(t *testing.T) {
+	// 2 rps over 100ms rounds down to no requests; at least one is allowed
+	strategy := newSlidingWindowStrategy(2, 100*time.Millisecond)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if !strategy.Allow("client", start) {
+		t.Fatal("First request in a short window should be allowed")
+	}
+	if strategy.Allow("client", start.Add(time.Millisecond)) {
+		t.Error("Second request in a short window should be denied")
+	}
+}
+
+func TestRateLimiterStrategy_ZeroRate(t *testing.T) {
+	// RATE_LIMIT_RPS=0 rejects every request whatever the algorithm
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, algorithm := range []string{AlgorithmTokenBucket, AlgorithmSlidingWindow, AlgorithmLeakyBucket} {
+		strategy, err := NewRateLimiterStrategy(algorithm, 0, 0, time.Second, time.Minute)
+		if err != nil {
+			t.Fatalf("NewRateLimiterStrategy(%s) error = %v", algorithm, err)
+		}
+		for i := range 3 {
+			if strategy.Allow("client", start.Add(time.Duration(i)*time.Second)) {
+				t.Errorf("%s allowed request %d at 0 rps", algorithm, i+1)
+			}
+		}
+	}
+}
+
+func TestLeakyBucketStrategy(t *testing.T) {
+	strategy := newLeakyBucketStrategy(10, 3)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		if !strategy.Allow("client", start) {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	if strategy.Allow("client", start) {
+		t.Error("Request over capacity should be denied")
+	}
+
+	// Requests paced exactly at the drain rate are always allowed,
+	// even though each interval is shorter than one whole token
+	now := start
+	for i := 0; i < 20; i++ {
+		now = now.Add(100 * time.Millisecond)
+		if !strategy.Allow("client", now) {
+			t.Fatalf("Paced request %d should be allowed", i+1)
+		}
+	}
+
+	if remaining := strategy.Remaining("client", now.Add(time.Second)); remaining != 3 {
+		t.Errorf("Expected full capacity after draining, got %d", remaining)
+	}
+}
+
+func TestStrategies_LastSeenAndCleanup(t *testing.T) {
+	now := time.Now()
+	for _, algorithm := range []string{AlgorithmTokenBucket, AlgorithmSlidingWindow, AlgorithmLeakyBucket} {
+		t.Run(algorithm, func(t *testing.T) {
+			strategy, err := NewRateLimiterStrategy(algorithm, 10, 10, time.Second, time.Minute)
+			if err != nil {
+				t.Fatalf("NewRateLimiterStrategy() error = %v", err)
+			}
+
+			strategy.Allow("old", now.Add(-10*time.Minute))
+			strategy.Allow("new", now)
+
+			if lastSeen, exists := strategy.LastSeen("new"); !exists || !lastSeen.Equal(now) {
+				t.Errorf("Expected last seen %v, got %v (exists=%v)", now, lastSeen, exists)
+			}
+			if len(strategy.Clients()) != 2 {
+				t.Errorf("Expected 2 clients, got %d", len(strategy.Clients()))
+			}
+
+			strategy.Cleanup(now.Add(-time.Minute))
+
+			clients := strategy.Clients()
+			if len(clients) != 1 || clients[0] != "new" {
+				t.Errorf("Expected only the recent client after cleanup, got %v", clients)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_WithAlgorithm(t *testing.T) {
+	rl, err := NewRateLimiterWithAlgorithm(AlgorithmLeakyBucket, 1, 2, time.Second, time.Minute, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("NewRateLimiterWithAlgorithm() error = %v", err)
+	}
+	if rl.Algorithm() != AlgorithmLeakyBucket {
+		t.Errorf("Expected algorithm %s, got %s", AlgorithmLeakyBucket, rl.Algorithm())
+	}
+
+	if !rl.Allow("client") || !rl.Allow("client") {
+		t.Error("Expected burst requests to be allowed")
+	}
+	if rl.Allow("client") {
+		t.Error("Expected request over capacity to be denied")
+	}
+
+	state := rl.GetDebugState(DebugStateOptions{ClientIDMode: ClientIDModeRaw})
+	config := state["config"].(map[string]interface{})
+	if config["algorithm"] != AlgorithmLeakyBucket {
+		t.Errorf("Expected debug state to report algorithm, got %v", config["algorithm"])
+	}
+
+	if _, err := NewRateLimiterWithAlgorithm("bogus", 1, 2, time.Second, time.Minute, 5*time.Minute); err == nil {
+		t.Error("Expected error for unknown algorithm")
+	}
+}
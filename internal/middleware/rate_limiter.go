@@ -1,12 +1,16 @@
 package middleware
 
 import (
-	"context"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/requestcontext"
 )
 
 // RateLimiter implements a custom rate limiting mechanism
@@ -14,19 +18,60 @@ type RateLimiter struct {
 	requestsPerSecond int
 	burstSize         int
 
-	// Token bucket implementation
-	tokens     map[string]int
-	lastUpdate map[string]time.Time
-	mu         sync.RWMutex
+	// Pluggable algorithm (token bucket by default)
+	strategy RateLimiterStrategy
+	mu       sync.RWMutex
 
 	// Cleanup
 	cleanupInterval   time.Duration
 	inactiveThreshold time.Duration
 	lastCleanup       time.Time
+
+	// Aggregate counters
+	allowed  atomic.Uint64
+	rejected atomic.Uint64
+}
+
+// DebugStateOptions controls how much of the limiter state is exposed for debugging
+type DebugStateOptions struct {
+	ClientIDMode string // raw, hash or truncate
 }
 
-// NewRateLimiter creates a new rate limiter with optional cleanup configuration
+// ClientState is one client's limiter state as exposed for debugging
+type ClientState struct {
+	ClientID            string    `json:"client_id"` // Masked according to the client ID mode
+	Tokens              int       `json:"tokens"`    // Remaining request capacity, for every algorithm
+	LastUpdate          time.Time `json:"last_update"`
+	TimeSinceLastUpdate int64     `json:"time_since_last_update_ms"`
+	IsActive            bool      `json:"is_active"`
+}
+
+// NewRateLimiter creates a new token bucket rate limiter with optional cleanup configuration
 func NewRateLimiter(requestsPerSecond, burstSize int, windowSize time.Duration, cleanupInterval, inactiveThreshold time.Duration) *RateLimiter {
+	if inactiveThreshold == 0 {
+		inactiveThreshold = 5 * time.Minute
+	}
+
+	strategy := newTokenBucketStrategy(requestsPerSecond, burstSize, inactiveThreshold)
+	return NewRateLimiterWithStrategy(strategy, requestsPerSecond, burstSize, cleanupInterval, inactiveThreshold)
+}
+
+// NewRateLimiterWithAlgorithm creates a rate limiter using the named algorithm
+// (token_bucket, sliding_window or leaky_bucket). windowSize is used by sliding_window.
+func NewRateLimiterWithAlgorithm(algorithm string, requestsPerSecond, burstSize int, windowSize time.Duration, cleanupInterval, inactiveThreshold time.Duration) (*RateLimiter, error) {
+	if inactiveThreshold == 0 {
+		inactiveThreshold = 5 * time.Minute
+	}
+
+	strategy, err := NewRateLimiterStrategy(algorithm, requestsPerSecond, burstSize, windowSize, inactiveThreshold)
+	if err != nil {
+		return nil, err
+	}
+	return NewRateLimiterWithStrategy(strategy, requestsPerSecond, burstSize, cleanupInterval, inactiveThreshold), nil
+}
+
+// NewRateLimiterWithStrategy creates a rate limiter around a custom strategy
+func NewRateLimiterWithStrategy(strategy RateLimiterStrategy, requestsPerSecond, burstSize int, cleanupInterval, inactiveThreshold time.Duration) *RateLimiter {
 	// Set defaults if not provided
 	if cleanupInterval == 0 {
 		cleanupInterval = 1 * time.Minute
@@ -38,33 +83,15 @@ func NewRateLimiter(requestsPerSecond, burstSize int, windowSize time.Duration,
 	return &RateLimiter{
 		requestsPerSecond: requestsPerSecond,
 		burstSize:         burstSize,
-		tokens:            make(map[string]int),
-		lastUpdate:        make(map[string]time.Time),
+		strategy:          strategy,
 		cleanupInterval:   cleanupInterval,
 		inactiveThreshold: inactiveThreshold,
 	}
 }
 
-// calculateCurrentTokens calculates the current number of tokens for a client
-func (rl *RateLimiter) calculateCurrentTokens(clientID string, now time.Time) int {
-	lastUpdate, exists := rl.lastUpdate[clientID]
-	if !exists {
-		return 0
-	}
-
-	timeElapsed := now.Sub(lastUpdate)
-	timeElapsedSeconds := timeElapsed.Seconds()
-	tokensToAdd := int(timeElapsedSeconds * float64(rl.requestsPerSecond))
-
-	currentTokens := rl.tokens[clientID] + tokensToAdd
-	if currentTokens > rl.burstSize {
-		currentTokens = rl.burstSize
-	}
-	if currentTokens < 0 {
-		currentTokens = 0
-	}
-
-	return currentTokens
+// Algorithm returns the name of the active rate limiting algorithm
+func (rl *RateLimiter) Algorithm() string {
+	return rl.strategy.Name()
 }
 
 // Allow checks if a request is allowed for the given client
@@ -80,34 +107,22 @@ func (rl *RateLimiter) Allow(clientID string) bool {
 		rl.lastCleanup = now
 	}
 
-	// Initialize or reset client if needed
-	if _, exists := rl.tokens[clientID]; !exists {
-		if rl.requestsPerSecond == 0 {
-			return false
-		}
-		rl.tokens[clientID] = rl.burstSize
-		rl.lastUpdate[clientID] = now
-	} else if now.Sub(rl.lastUpdate[clientID]) > rl.inactiveThreshold {
-		// Reset inactive client
-		rl.tokens[clientID] = rl.burstSize
-		rl.lastUpdate[clientID] = now
-	}
-
-	// Calculate current tokens and update
-	rl.tokens[clientID] = rl.calculateCurrentTokens(clientID, now)
-	rl.lastUpdate[clientID] = now
-
-	// Check if request is allowed and consume token
-	if rl.tokens[clientID] > 0 {
-		rl.tokens[clientID]--
+	if rl.strategy.Allow(clientID, now) {
+		rl.allowed.Add(1)
 		return true
 	}
 
+	rl.rejected.Add(1)
 	return false
 }
 
 // GetClientID extracts client identifier from request
 func (rl *RateLimiter) GetClientID(r *http.Request) string {
+	// Authenticated identities (e.g. JWT subjects) are limited independently of their IP
+	if apiKey, ok := APIKeyFromContext(r.Context()); ok && apiKey.ClientID != "" {
+		return apiKey.ClientID
+	}
+
 	// Try to get real IP from headers (for reverse proxy scenarios)
 	realIP := r.Header.Get("X-Real-IP")
 	if realIP != "" {
@@ -139,47 +154,46 @@ func (rl *RateLimiter) GetClientID(r *http.Request) string {
 
 // cleanup removes old entries to prevent memory leaks
 func (rl *RateLimiter) cleanup() {
-	now := time.Now()
-	cutoff := now.Add(-rl.inactiveThreshold)
-
-	for clientID, lastUpdate := range rl.lastUpdate {
-		if lastUpdate.Before(cutoff) {
-			delete(rl.tokens, clientID)
-			delete(rl.lastUpdate, clientID)
-		}
-	}
+	rl.strategy.Cleanup(time.Now().Add(-rl.inactiveThreshold))
 }
 
-// GetMapState returns the current state of the rate limiter maps for debugging
+// GetMapState returns the current state of the rate limiter maps for debugging.
+// Client IDs are returned unmasked; prefer GetDebugState for anything user-facing.
 func (rl *RateLimiter) GetMapState() map[string]interface{} {
+	return rl.GetDebugState(DebugStateOptions{ClientIDMode: ClientIDModeRaw})
+}
+
+// GetDebugState returns a masked view of the rate limiter state, with clients
+// sorted by masked ID
+func (rl *RateLimiter) GetDebugState(opts DebugStateOptions) map[string]interface{} {
 	rl.mu.RLock()
 	defer rl.mu.RUnlock()
 
 	now := time.Now()
-	clients := make(map[string]interface{})
-
-	for clientID := range rl.tokens {
-		lastUpdate, exists := rl.lastUpdate[clientID]
-		if !exists {
-			continue
-		}
 
+	clientIDs := rl.strategy.Clients()
+	clients := make([]ClientState, 0, len(clientIDs))
+	for _, clientID := range clientIDs {
+		lastUpdate, _ := rl.strategy.LastSeen(clientID)
 		timeSinceLastUpdate := now.Sub(lastUpdate)
-		currentTokens := rl.calculateCurrentTokens(clientID, now)
-
-		clients[clientID] = map[string]interface{}{
-			"tokens":                    currentTokens,
-			"last_update":               lastUpdate.Format("15:04:05.000"),
-			"time_since_last_update_ms": timeSinceLastUpdate.Milliseconds(),
-			"is_active":                 timeSinceLastUpdate < rl.inactiveThreshold,
-		}
+		clients = append(clients, ClientState{
+			ClientID:            MaskClientID(clientID, opts.ClientIDMode),
+			Tokens:              rl.strategy.Remaining(clientID, now),
+			LastUpdate:          lastUpdate,
+			TimeSinceLastUpdate: timeSinceLastUpdate.Milliseconds(),
+			IsActive:            timeSinceLastUpdate < rl.inactiveThreshold,
+		})
 	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ClientID < clients[j].ClientID })
 
 	return map[string]interface{}{
-		"total_clients": len(rl.tokens),
-		"current_time":  now.Format("15:04:05.000"),
-		"clients":       clients,
+		"total_clients":  len(clients),
+		"active_clients": rl.activeClientsLocked(now),
+		"current_time":   now.Format("15:04:05.000"),
+		"clients":        clients,
+		"client_id_mode": opts.ClientIDMode,
 		"config": map[string]interface{}{
+			"algorithm":                  rl.strategy.Name(),
 			"requests_per_second":        rl.requestsPerSecond,
 			"burst_size":                 rl.burstSize,
 			"inactive_threshold_minutes": rl.inactiveThreshold.Minutes(),
@@ -187,21 +201,70 @@ func (rl *RateLimiter) GetMapState() map[string]interface{} {
 	}
 }
 
-// RateLimitContextKey is used to store rate limit info in context
-type RateLimitContextKey string
+// ActiveClients returns the number of clients seen within the inactive threshold
+func (rl *RateLimiter) ActiveClients() int {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
 
-const (
-	ClientIDKey RateLimitContextKey = "client_id"
-)
+	return rl.activeClientsLocked(time.Now())
+}
+
+// activeClientsLocked counts active clients; caller must hold the lock
+func (rl *RateLimiter) activeClientsLocked(now time.Time) int {
+	active := 0
+	for _, clientID := range rl.strategy.Clients() {
+		if lastSeen, exists := rl.strategy.LastSeen(clientID); exists && now.Sub(lastSeen) < rl.inactiveThreshold {
+			active++
+		}
+	}
+	return active
+}
+
+// Stats returns the total number of allowed and rejected requests
+func (rl *RateLimiter) Stats() (allowed, rejected uint64) {
+	return rl.allowed.Load(), rl.rejected.Load()
+}
+
+// RegisterMetrics exposes aggregate limiter metrics on the registry
+func (rl *RateLimiter) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("ipgeo_rate_limiter_active_clients",
+		"Clients seen within the inactive threshold",
+		func() float64 { return float64(rl.ActiveClients()) })
+	registry.NewGaugeFunc("ipgeo_rate_limiter_tracked_clients",
+		"Clients currently held in limiter state",
+		func() float64 {
+			rl.mu.RLock()
+			defer rl.mu.RUnlock()
+			return float64(len(rl.strategy.Clients()))
+		})
+	registry.NewCounterFunc("ipgeo_rate_limiter_allowed_total",
+		"Requests allowed by the rate limiter",
+		func() float64 { return float64(rl.allowed.Load()) })
+	registry.NewCounterFunc("ipgeo_rate_limiter_rejected_total",
+		"Requests rejected by the rate limiter",
+		func() float64 { return float64(rl.rejected.Load()) })
+}
 
 // RateLimitMiddleware creates a middleware for rate limiting
 func RateLimitMiddleware(rateLimiter *RateLimiter) func(http.Handler) http.Handler {
+	return RateLimitMiddlewareWithExemptions(rateLimiter, nil)
+}
+
+// RateLimitMiddlewareWithExemptions creates a rate limiting middleware that lets
+// exempted requests through without touching the limiter; exemptions may be nil
+func RateLimitMiddlewareWithExemptions(rateLimiter *RateLimiter, exemptions *RateLimitExemptions) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exemptions != nil && exemptions.Exempt(r) {
+				exemptions.exempted.Add(1)
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			clientID := rateLimiter.GetClientID(r)
 
 			// Add client ID to context
-			ctx := context.WithValue(r.Context(), ClientIDKey, clientID)
+			ctx := requestcontext.WithClientID(r.Context(), clientID)
 			r = r.WithContext(ctx)
 
 			if !rateLimiter.Allow(clientID) {
@@ -239,7 +302,7 @@ func DebugRateLimitMiddleware(rateLimiter *RateLimiter) func(http.Handler) http.
 			clientID := rateLimiter.GetClientID(r)
 
 			// Add client ID to context
-			ctx := context.WithValue(r.Context(), ClientIDKey, clientID)
+			ctx := requestcontext.WithClientID(r.Context(), clientID)
 			r = r.WithContext(ctx)
 
 			if !debugRateLimiter.Allow(clientID) {
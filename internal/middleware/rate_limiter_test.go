@@ -3,9 +3,13 @@ package middleware
 import (
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/requestcontext"
 )
 
 func TestRateLimiter_Allow(t *testing.T) {
@@ -289,26 +293,6 @@ func TestRateLimiter_DifferentClients(t *testing.T) {
 	}
 }
 
-// TestRateLimiter_Benchmark tests performance of rate limiter
-func TestRateLimiter_Benchmark(t *testing.T) {
-	rateLimiter := NewRateLimiter(1000, 1000, time.Second, 1*time.Minute, 5*time.Minute)
-	clientID := "benchmark-client"
-
-	// Benchmark rate limiter performance
-	start := time.Now()
-	for i := 0; i < 1000; i++ {
-		rateLimiter.Allow(clientID)
-	}
-	duration := time.Since(start)
-
-	// Should complete within reasonable time
-	if duration > 100*time.Millisecond {
-		t.Errorf("Rate limiter took too long: %v", duration)
-	}
-
-	t.Logf("Processed %d requests in %v", 1000, duration)
-}
-
 // TestRateLimiter_Stress tests rate limiter under stress
 func TestRateLimiter_Stress(t *testing.T) {
 	rateLimiter := NewRateLimiter(100, 200, time.Second, 1*time.Minute, 5*time.Minute)
@@ -383,8 +367,7 @@ func TestRateLimitMiddlewareWithContext(t *testing.T) {
 
 	// Create a handler that checks context
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		clientID := r.Context().Value(ClientIDKey)
-		if clientID == nil {
+		if _, ok := requestcontext.ClientID(r.Context()); !ok {
 			t.Error("Expected client ID in context")
 			return
 		}
@@ -419,29 +402,30 @@ func TestRateLimitMiddlewareWithContext(t *testing.T) {
 
 func TestRateLimiter_Cleanup(t *testing.T) {
 	rateLimiter := NewRateLimiter(10, 5, 100*time.Millisecond, 1*time.Minute, 1*time.Minute)
+	bucket := rateLimiter.strategy.(*tokenBucketStrategy)
 
 	// Add some test clients
-	rateLimiter.tokens["client1"] = 3
-	rateLimiter.tokens["client2"] = 2
-	rateLimiter.lastUpdate["client1"] = time.Now().Add(-2 * time.Minute)  // Old (2 minutes ago)
-	rateLimiter.lastUpdate["client2"] = time.Now().Add(-30 * time.Second) // Recent (30 seconds ago)
+	bucket.tokens["client1"] = 3
+	bucket.tokens["client2"] = 2
+	bucket.lastUpdate["client1"] = time.Now().Add(-2 * time.Minute)  // Old (2 minutes ago)
+	bucket.lastUpdate["client2"] = time.Now().Add(-30 * time.Second) // Recent (30 seconds ago)
 
 	// Force cleanup
 	rateLimiter.cleanup()
 
 	// Check that old client was removed
-	if _, exists := rateLimiter.tokens["client1"]; exists {
+	if _, exists := bucket.tokens["client1"]; exists {
 		t.Error("Expected old client to be cleaned up")
 	}
-	if _, exists := rateLimiter.lastUpdate["client1"]; exists {
+	if _, exists := bucket.lastUpdate["client1"]; exists {
 		t.Error("Expected old client lastUpdate to be cleaned up")
 	}
 
 	// Check that recent client still exists
-	if _, exists := rateLimiter.tokens["client2"]; !exists {
+	if _, exists := bucket.tokens["client2"]; !exists {
 		t.Error("Expected recent client to remain")
 	}
-	if _, exists := rateLimiter.lastUpdate["client2"]; !exists {
+	if _, exists := bucket.lastUpdate["client2"]; !exists {
 		t.Error("Expected recent client lastUpdate to remain")
 	}
 }
@@ -557,3 +541,89 @@ func TestRateLimiter_BurstSize(t *testing.T) {
 		t.Error("Expected to be rate limited after burst")
 	}
 }
+
+func TestRateLimiter_GetDebugState(t *testing.T) {
+	rl := NewRateLimiter(10, 10, time.Second, time.Minute, 5*time.Minute)
+
+	for _, clientID := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"} {
+		rl.Allow(clientID)
+	}
+
+	state := rl.GetDebugState(DebugStateOptions{ClientIDMode: ClientIDModeHash})
+
+	clients := state["clients"].([]ClientState)
+	if len(clients) != 5 || state["total_clients"] != 5 {
+		t.Fatalf("Expected 5 clients, got %d (total %v)", len(clients), state["total_clients"])
+	}
+	for i, client := range clients {
+		if strings.HasPrefix(client.ClientID, "10.0.0.") {
+			t.Errorf("Expected hashed client ID, got raw %q", client.ClientID)
+		}
+		if !client.IsActive || client.Tokens != 9 {
+			t.Errorf("Unexpected client state %+v", client)
+		}
+		// Sorted by masked ID so listings are stable between requests
+		if i > 0 && clients[i-1].ClientID >= client.ClientID {
+			t.Errorf("Clients not sorted by masked ID: %q before %q", clients[i-1].ClientID, client.ClientID)
+		}
+	}
+}
+
+func TestRateLimiter_Stats(t *testing.T) {
+	rl := NewRateLimiter(1, 2, time.Second, time.Minute, 5*time.Minute)
+
+	rl.Allow("client")
+	rl.Allow("client")
+	rl.Allow("client")
+
+	allowed, rejected := rl.Stats()
+	if allowed != 2 || rejected != 1 {
+		t.Errorf("Expected 2 allowed and 1 rejected, got %d and %d", allowed, rejected)
+	}
+	if rl.ActiveClients() != 1 {
+		t.Errorf("Expected 1 active client, got %d", rl.ActiveClients())
+	}
+
+	registry := metrics.NewRegistry()
+	rl.RegisterMetrics(registry)
+
+	var b strings.Builder
+	registry.Write(&b)
+	for _, line := range []string{
+		"ipgeo_rate_limiter_active_clients 1",
+		"ipgeo_rate_limiter_allowed_total 2",
+		"ipgeo_rate_limiter_rejected_total 1",
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("Expected metrics output to contain %q, got:\n%s", line, b.String())
+		}
+	}
+}
+
+func BenchmarkRateLimiter(b *testing.B) {
+	rateLimiter := NewRateLimiter(1000, 1000, time.Second, time.Minute, 5*time.Minute)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		rateLimiter.Allow("benchmark-client")
+	}
+}
+
+// BenchmarkRateLimiterParallel measures contention with many clients on all CPUs
+func BenchmarkRateLimiterParallel(b *testing.B) {
+	rateLimiter := NewRateLimiter(1000, 1000, time.Second, time.Minute, 5*time.Minute)
+	clients := make([]string, 10_000)
+	for i := range clients {
+		clients[i] = "client-" + strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			rateLimiter.Allow(clients[i%len(clients)])
+			i++
+		}
+	})
+}
@@ -1,22 +1,159 @@
 package middleware
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/errreport"
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/requestcontext"
 )
 
+// fingerprintFrames is how many of the innermost frames identify a panic
+const fingerprintFrames = 5
+
+// PanicRecoverer turns handler panics into 500 responses, logging each one with
+// its stack and a fingerprint that stays the same across repeats of the same bug.
+// Panics are also forwarded to reporter when one is set.
+type PanicRecoverer struct {
+	logger   *slog.Logger
+	reporter errreport.Reporter
+
+	panics atomic.Uint64
+}
+
+// NewPanicRecoverer creates a recoverer; reporter may be nil
+func NewPanicRecoverer(logger *slog.Logger, reporter errreport.Reporter) *PanicRecoverer {
+	return &PanicRecoverer{logger: logger, reporter: reporter}
+}
+
+// RegisterMetrics exposes the panic counter on the registry
+func (p *PanicRecoverer) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewCounterFunc("ipgeo_panics_total",
+		"Total handler panics recovered",
+		func() float64 { return float64(p.panics.Load()) })
+}
+
+// panicStack is filled in by a goroutine that recovered a panic on the request's
+// behalf and re-raised it elsewhere, so the original stack isn't lost
+type panicStack struct {
+	frames []errreport.Frame
+}
+
+// panicStackKey carries the request's panicStack
+var panicStackKey = requestcontext.NewKey[*panicStack]("panic_stack")
+
+// recordPanicStack saves the stack of a panic being recovered, for a recoverer
+// further up the chain. Call it from the deferred function that called recover.
+func recordPanicStack(ctx context.Context) {
+	if stack, ok := panicStackKey.Value(ctx); ok && stack.frames == nil {
+		stack.frames = panicFrames()
+	}
+}
+
+// panicFrames returns the stack of the panic being recovered, innermost first,
+// without runtime frames. Only meaningful inside a deferred function.
+func panicFrames() []errreport.Frame {
+	pcs := make([]uintptr, 64)
+	pcs = pcs[:runtime.Callers(2, pcs)]
+
+	var frames []errreport.Frame
+	panicking := false
+	iter := runtime.CallersFrames(pcs)
+	for {
+		frame, more := iter.Next()
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+		} else if panicking && !strings.HasPrefix(frame.Function, "runtime.") {
+			frames = append(frames, errreport.Frame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		}
+		if !more {
+			return frames
+		}
+	}
+}
+
+// panicFingerprint identifies a panic by its value type and the functions it went
+// through; messages and line numbers are left out since they vary between repeats
+func panicFingerprint(value any, frames []errreport.Frame) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%T", value)
+	for i, frame := range frames {
+		if i == fingerprintFrames {
+			break
+		}
+		fmt.Fprintf(h, "\n%s", frame.Function)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// formatStack renders frames like a Go traceback
+func formatStack(frames []errreport.Frame) string {
+	var b strings.Builder
+	for _, frame := range frames {
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+	}
+	return b.String()
+}
+
+// recovered handles a panic value recovered while serving r
+func (p *PanicRecoverer) recovered(r *http.Request, value any, frames []errreport.Frame) {
+	p.panics.Add(1)
+
+	fingerprint := panicFingerprint(value, frames)
+	requestID, _ := requestcontext.RequestID(r.Context())
+	p.logger.Error("Panic recovered",
+		"error", value,
+		"fingerprint", fingerprint,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"remote_addr", r.RemoteAddr,
+		"request_id", requestID,
+		"stack", formatStack(frames),
+	)
+
+	if p.reporter != nil {
+		p.reporter.Capture(errreport.Event{
+			Level:       errreport.LevelFatal,
+			Type:        fmt.Sprintf("%T", value),
+			Message:     fmt.Sprint(value),
+			Fingerprint: fingerprint,
+			Frames:      frames,
+			Status:      http.StatusInternalServerError,
+			Request:     errreport.SanitizeRequest(r),
+			RequestID:   requestID,
+			Time:        time.Now(),
+		})
+	}
+}
+
 // RecoveryMiddleware creates a middleware for panic recovery
 func RecoveryMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return RecoveryMiddlewareWithRecoverer(NewPanicRecoverer(logger, nil))
+}
+
+// RecoveryMiddlewareWithRecoverer recovers panics with recoverer
+func RecoveryMiddlewareWithRecoverer(recoverer *PanicRecoverer) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			stack := &panicStack{}
+			r = r.WithContext(panicStackKey.With(r.Context(), stack))
+
 			defer func() {
 				if err := recover(); err != nil {
-					logger.Error("Panic recovered",
-						"error", err,
-						"method", r.Method,
-						"path", r.URL.Path,
-						"remote_addr", r.RemoteAddr,
-					)
+					frames := stack.frames
+					if frames == nil {
+						frames = panicFrames()
+					}
+					recoverer.recovered(r, err, frames)
 
 					w.Header().Set("Content-Type", "application/json")
 					w.WriteHeader(http.StatusInternalServerError)
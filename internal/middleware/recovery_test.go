@@ -1,11 +1,19 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/errreport"
+	"ip-geolocation-service/internal/metrics"
 )
 
 func TestRecoveryMiddleware(t *testing.T) {
@@ -73,3 +81,100 @@ func TestRecoveryMiddleware_NoPanic(t *testing.T) {
 		t.Error("Expected no panic to be logged")
 	}
 }
+
+// explode panics with a message that varies between calls
+func explode(n int) {
+	panic(fmt.Sprintf("bad value %d", n))
+}
+
+func TestPanicRecoverer_Fingerprint(t *testing.T) {
+	var logOutput strings.Builder
+	logger := slog.New(slog.NewJSONHandler(&logOutput, nil))
+	recoverer := NewPanicRecoverer(logger, nil)
+
+	calls := 0
+	handler := RecoveryMiddlewareWithRecoverer(recoverer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		explode(calls)
+	}))
+
+	var fingerprints []string
+	for range 2 {
+		logOutput.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/find-country", nil))
+
+		var record struct {
+			Fingerprint string `json:"fingerprint"`
+			Stack       string `json:"stack"`
+		}
+		if err := json.Unmarshal([]byte(logOutput.String()), &record); err != nil {
+			t.Fatalf("Failed to parse log record: %v", err)
+		}
+		if !strings.HasPrefix(record.Stack, "ip-geolocation-service/internal/middleware.explode\n") {
+			t.Errorf("Expected stack to start at the panicking function, got %q", record.Stack)
+		}
+		fingerprints = append(fingerprints, record.Fingerprint)
+	}
+
+	if fingerprints[0] == "" || fingerprints[0] != fingerprints[1] {
+		t.Errorf("Expected a stable fingerprint across messages, got %v", fingerprints)
+	}
+
+	registry := metrics.NewRegistry()
+	recoverer.RegisterMetrics(registry)
+	var out strings.Builder
+	registry.Write(&out)
+	if !strings.Contains(out.String(), "ipgeo_panics_total 2") {
+		t.Errorf("Expected two panics in metrics, got:\n%s", out.String())
+	}
+}
+
+func TestPanicRecoverer_ThroughTimeout(t *testing.T) {
+	var logOutput strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logOutput, nil))
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		explode(1)
+	}))
+	handler = TimeoutMiddleware(TimeoutConfig{Default: time.Second})(handler)
+	handler = RecoveryMiddlewareWithRecoverer(NewPanicRecoverer(logger, nil))(handler)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1/find-country", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+	if !strings.Contains(logOutput.String(), "middleware.explode") {
+		t.Errorf("Expected the handler goroutine's stack to be logged, got %s", logOutput.String())
+	}
+}
+
+func TestPanicRecoverer_Reporter(t *testing.T) {
+	received := make(chan map[string]any, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]any
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &event)
+		received <- event
+	}))
+	defer server.Close()
+
+	reporter, err := errreport.NewSentry("http://key@"+strings.TrimPrefix(server.URL, "http://")+"/1", "test", time.Second, nil)
+	if err != nil {
+		t.Fatalf("NewSentry() error = %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := RecoveryMiddlewareWithRecoverer(NewPanicRecoverer(logger, reporter))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		explode(1)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/find-country", nil))
+
+	if err := reporter.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	event := <-received
+	if event["level"] != errreport.LevelFatal || len(event["fingerprint"].([]any)) != 1 {
+		t.Errorf("Unexpected event %v", event)
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"ip-geolocation-service/internal/report"
+)
+
+// ReportMiddleware counts each /v1 request by client identity and status for
+// scheduled reports. Anonymous requests are counted under report.AnonymousClient.
+func ReportMiddleware(collector *report.Collector) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/v1/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			wrapped := newResponseWriter(w)
+			next.ServeHTTP(wrapped, r)
+			status := wrapped.statusCode
+			wrapped.release()
+
+			client := report.AnonymousClient
+			if apiKey, ok := APIKeyFromContext(r.Context()); ok && apiKey.QuotaID != "" {
+				client = apiKey.QuotaID
+			}
+			collector.RecordRequest(client, status)
+		})
+	}
+}
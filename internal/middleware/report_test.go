@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ip-geolocation-service/internal/report"
+)
+
+func TestReportMiddleware(t *testing.T) {
+	store, err := NewAPIKeyStoreWithRoles(map[string]string{"client-key": ""}, nil)
+	if err != nil {
+		t.Fatalf("NewAPIKeyStoreWithRoles() error = %v", err)
+	}
+	collector := report.NewCollector(0)
+	handler := APIKeyMiddleware(store)(ReportMiddleware(collector)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ip") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})))
+
+	for _, tc := range []struct{ path, key string }{
+		{"/v1/find-country?ip=8.8.8.8", "client-key"},
+		{"/v1/find-country", "client-key"},
+		{"/v1/find-country?ip=8.8.8.8", ""},
+		{"/health", "client-key"},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		if tc.key != "" {
+			req.Header.Set(APIKeyHeader, tc.key)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	got := collector.Cut()
+	if got.Requests != 3 || got.ClientErrors != 1 {
+		t.Errorf("Requests = %d, client errors = %d, want 3 and 1", got.Requests, got.ClientErrors)
+	}
+	want := []report.Count{{Name: quotaKeyID("client-key"), Count: 2}, {Name: report.AnonymousClient, Count: 1}}
+	if len(got.TopClients) != 2 || got.TopClients[0] != want[0] || got.TopClients[1] != want[1] {
+		t.Errorf("TopClients = %+v, want %+v", got.TopClients, want)
+	}
+}
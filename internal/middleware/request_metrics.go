@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+// Label values for routes, methods and statuses outside the known sets, and for
+// requests that never looked anything up
+const (
+	otherLabel = "other"
+	notServed  = "none"
+)
+
+// metricMethods are the methods reported by name; anything else is "other"
+var metricMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// requestLabels are the labels of the request counter and latency histogram. None
+// of them comes from client-controlled text, so their cardinality stays fixed.
+var requestLabels = []string{"route", "method", "status_class", "backend", "cache"}
+
+// RequestMetrics counts and times requests by route, method, status class, the
+// backend that answered them and whether the cache did
+type RequestMetrics struct {
+	routes   map[string]bool
+	requests *metrics.CounterVec
+	duration *metrics.Histogram
+}
+
+// NewRequestMetrics registers request metrics on the registry. Only paths listed in
+// routes are reported by name; every other path is counted as "other".
+func NewRequestMetrics(registry *metrics.Registry, routes []string) *RequestMetrics {
+	known := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		known[route] = true
+	}
+	return &RequestMetrics{
+		routes: known,
+		requests: registry.NewCounterVec("ipgeo_http_requests_total",
+			"HTTP requests by route, method, status class, backend and cache status",
+			requestLabels),
+		duration: registry.NewHistogramVec("ipgeo_http_request_duration_seconds",
+			"HTTP request latency by route, method, status class, backend and cache status",
+			nil, requestLabels),
+	}
+}
+
+// Observe records a request that completed with statusCode after duration
+func (m *RequestMetrics) Observe(r *http.Request, statusCode int, backend, cache string, duration time.Duration) {
+	route := r.URL.Path
+	if !m.routes[route] {
+		route = otherLabel
+	}
+	method := r.Method
+	if !metricMethods[method] {
+		method = otherLabel
+	}
+	if backend == "" {
+		backend = notServed
+	}
+	if cache == "" {
+		cache = notServed
+	}
+
+	labels := []string{route, method, statusClass(statusCode), backend, cache}
+	m.requests.Inc(labels...)
+	m.duration.Observe(duration.Seconds(), labels...)
+}
+
+// RequestMetricsMiddleware records every request in m. Lookups made while serving
+// the request report their backend and cache status through the request context.
+func RequestMetricsMiddleware(m *RequestMetrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ctx, served := requestcontext.WithServed(r.Context())
+
+			wrapped := newResponseWriter(w)
+			next.ServeHTTP(wrapped, r.WithContext(ctx))
+			status := wrapped.statusCode
+			wrapped.release()
+
+			backend, cache := served.Labels()
+			m.Observe(r, status, backend, cache, time.Since(start))
+		})
+	}
+}
+
+// statusClass returns the class of an HTTP status code, such as "2xx"
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return otherLabel
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+func TestRequestMetricsMiddleware(t *testing.T) {
+	registry := metrics.NewRegistry()
+	requestMetrics := NewRequestMetrics(registry, []string{"/v1/find-country", "/health"})
+	handler := RequestMetricsMiddleware(requestMetrics)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/find-country":
+			served := requestcontext.ServedFrom(r.Context())
+			if served == nil {
+				t.Fatal("Expected a Served record in the request context")
+			}
+			served.Record("csv", r.URL.Query().Get("cache"))
+		case "/health":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	requests := []struct{ method, target string }{
+		{"GET", "/v1/find-country?ip=8.8.8.8&cache=hit"},
+		{"GET", "/v1/find-country?ip=1.1.1.1&cache=miss"},
+		{"GET", "/health"},
+		{"GET", "/wp-login.php"},
+		{"GET", "/198.51.100.7"},
+		{"BREW", "/health"},
+	}
+	for _, req := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.target, nil))
+	}
+
+	var out strings.Builder
+	registry.Write(&out)
+	output := out.String()
+
+	expected := []string{
+		`ipgeo_http_requests_total{route="/v1/find-country",method="GET",status_class="2xx",backend="csv",cache="hit"} 1`,
+		`ipgeo_http_requests_total{route="/v1/find-country",method="GET",status_class="2xx",backend="csv",cache="miss"} 1`,
+		`ipgeo_http_requests_total{route="/health",method="GET",status_class="2xx",backend="none",cache="none"} 1`,
+		`ipgeo_http_requests_total{route="other",method="GET",status_class="4xx",backend="none",cache="none"} 2`,
+		`ipgeo_http_requests_total{route="/health",method="other",status_class="2xx",backend="none",cache="none"} 1`,
+		`ipgeo_http_request_duration_seconds_count{route="/health",method="GET",status_class="2xx",backend="none",cache="none"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+	for _, leaked := range []string{"8.8.8.8", "198.51.100.7", "wp-login", "BREW"} {
+		if strings.Contains(output, leaked) {
+			t.Errorf("Request data %q leaked into metrics:\n%s", leaked, output)
+		}
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := map[int]string{200: "2xx", 304: "3xx", 429: "4xx", 503: "5xx", 0: "other", 999: "other"}
+	for code, want := range tests {
+		if got := statusClass(code); got != want {
+			t.Errorf("statusClass(%d) = %q, want %q", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// API key roles. Admin implies every other role.
+const (
+	RoleReader  = "reader"  // Lookup endpoints under /v1
+	RoleMetrics = "metrics" // /metrics and /debug endpoints
+	RoleAdmin   = "admin"   // /admin endpoints: imports, overrides, reloads, config changes
+)
+
+// ParseRoles parses a "|"-separated role list such as "reader|metrics"
+func ParseRoles(value string) ([]string, error) {
+	var roles []string
+	for _, role := range strings.Split(value, "|") {
+		role = strings.TrimSpace(role)
+		switch role {
+		case "":
+			continue
+		case RoleReader, RoleMetrics, RoleAdmin:
+			roles = append(roles, role)
+		default:
+			return nil, fmt.Errorf("unknown role: %s", role)
+		}
+	}
+	return roles, nil
+}
+
+// HasRole reports whether the key carries role (admin keys carry every role)
+func (k APIKey) HasRole(role string) bool {
+	for _, r := range k.Roles {
+		if r == role || r == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRoleMiddleware enforces role on a route group. Requests authenticated with an
+// API key lacking the role get 403; requests without a key get 401 unless
+// allowAnonymous is set.
+func RequireRoleMiddleware(role string, allowAnonymous bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, ok := APIKeyFromContext(r.Context())
+			switch {
+			case !ok && allowAnonymous:
+			case !ok:
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error": "API key required"}`))
+				return
+			case !apiKey.HasRole(role):
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error": "API key does not have the ` + role + ` role"}`))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
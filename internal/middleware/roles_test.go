@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewAPIKeyStoreWithRoles(t *testing.T) {
+	store, err := NewAPIKeyStoreWithRoles(
+		map[string]string{"reader-key": "", "ops-key": "", "admin-key": ""},
+		map[string]string{"ops-key": "metrics|reader", "admin-key": "admin"},
+	)
+	if err != nil {
+		t.Fatalf("NewAPIKeyStoreWithRoles() error = %v", err)
+	}
+
+	tests := []struct {
+		key  string
+		role string
+		want bool
+	}{
+		{"reader-key", RoleReader, true},
+		{"reader-key", RoleMetrics, false},
+		{"reader-key", RoleAdmin, false},
+		{"ops-key", RoleMetrics, true},
+		{"ops-key", RoleAdmin, false},
+		{"admin-key", RoleReader, true},
+		{"admin-key", RoleMetrics, true},
+		{"admin-key", RoleAdmin, true},
+	}
+	for _, tt := range tests {
+		apiKey, _ := store.Lookup(tt.key)
+		if got := apiKey.HasRole(tt.role); got != tt.want {
+			t.Errorf("%s.HasRole(%s) = %v, want %v", tt.key, tt.role, got, tt.want)
+		}
+	}
+	if !store.HasRole(RoleAdmin) {
+		t.Error("Expected store to report an admin key")
+	}
+
+	if _, err := NewAPIKeyStoreWithRoles(map[string]string{"key": ""}, map[string]string{"key": "root"}); err == nil {
+		t.Error("Expected error for unknown role")
+	}
+}
+
+func TestRequireRoleMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	reader := APIKey{ID: "reader", Roles: []string{RoleReader}}
+	admin := APIKey{ID: "admin", Roles: []string{RoleAdmin}}
+
+	tests := []struct {
+		name           string
+		apiKey         *APIKey
+		allowAnonymous bool
+		want           int
+	}{
+		{"anonymous allowed", nil, true, http.StatusOK},
+		{"anonymous rejected", nil, false, http.StatusUnauthorized},
+		{"missing role", &reader, true, http.StatusForbidden},
+		{"admin implies role", &admin, false, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if tt.apiKey != nil {
+			req = req.WithContext(WithAPIKey(req.Context(), *tt.apiKey))
+		}
+		w := httptest.NewRecorder()
+		RequireRoleMiddleware(RoleMetrics, tt.allowAnonymous)(ok).ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
+
+func TestAdminAuthMiddleware_APIKeyRoles(t *testing.T) {
+	var actor string
+	handler := AdminAuthMiddleware("secret", true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor = AdminActorFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		apiKey *APIKey
+		want   int
+	}{
+		{"no credentials", nil, http.StatusUnauthorized},
+		{"reader key", &APIKey{ID: "reader", Roles: []string{RoleReader}}, http.StatusForbidden},
+		{"admin key", &APIKey{ID: "ops", Roles: []string{RoleAdmin}}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/admin/datasets", nil)
+		if tt.apiKey != nil {
+			req = req.WithContext(WithAPIKey(req.Context(), *tt.apiKey))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+	if actor != "key:ops" {
+		t.Errorf("Expected admin key actor, got %q", actor)
+	}
+}
@@ -0,0 +1,285 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// ShadowHeader marks mirrored requests so the secondary backend can tell them
+// apart from production traffic
+const ShadowHeader = "X-Shadow-Request"
+
+// shadowDroppedHeaders carry client credentials, which the secondary backend must
+// not receive
+var shadowDroppedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	APIKeyHeader,
+	SignatureKeyHeader,
+	SignatureTimestampHeader,
+	SignatureHeader,
+}
+
+// Shadow defaults
+const (
+	DefaultShadowTimeout     = 2 * time.Second
+	DefaultShadowMaxInFlight = 50
+)
+
+// maxShadowBodyBytes bounds the primary and shadow bodies kept for comparison
+const maxShadowBodyBytes = 64 << 10
+
+// maxShadowLogBytes bounds the bodies included in divergence logs
+const maxShadowLogBytes = 512
+
+// Shadower mirrors a sample of GET /v1 requests to a secondary backend and
+// compares its responses with production ones in the background. Production
+// responses are never delayed or altered: when too many comparisons are pending
+// new ones are dropped.
+type Shadower struct {
+	target  *url.URL
+	percent int
+	client  *http.Client
+	slots   chan struct{}
+	logger  *slog.Logger
+
+	mirrored atomic.Uint64
+	matched  atomic.Uint64
+	diverged atomic.Uint64
+	failed   atomic.Uint64
+	dropped  atomic.Uint64
+	skipped  atomic.Uint64
+	inFlight atomic.Int64
+}
+
+// NewShadower creates a shadower mirroring percent (0-100) of eligible requests to
+// the backend at target through transport (nil uses http.DefaultTransport), waiting
+// at most timeout for each mirrored response and running at most maxInFlight
+// comparisons at once
+func NewShadower(target string, percent int, timeout time.Duration, maxInFlight int, transport http.RoundTripper, logger *slog.Logger) (*Shadower, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid shadow URL %q", target)
+	}
+	if timeout <= 0 {
+		timeout = DefaultShadowTimeout
+	}
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultShadowMaxInFlight
+	}
+
+	return &Shadower{
+		target:  u,
+		percent: percent,
+		client:  &http.Client{Timeout: timeout, Transport: transport},
+		slots:   make(chan struct{}, maxInFlight),
+		logger:  logger,
+	}, nil
+}
+
+// sample reports whether a request should be mirrored
+func (s *Shadower) sample() bool {
+	return s.percent >= 100 || rand.IntN(100) < s.percent
+}
+
+// mirror sends the request to the secondary backend and compares the result with
+// the production status and body
+func (s *Shadower) mirror(method, path, rawQuery string, header http.Header, status int, body []byte) {
+	defer func() { <-s.slots; s.inFlight.Add(-1) }()
+
+	u := *s.target
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = rawQuery
+
+	req, err := http.NewRequestWithContext(context.Background(), method, u.String(), nil)
+	if err != nil {
+		s.failed.Add(1)
+		return
+	}
+	req.Header = header
+	req.Header.Set(ShadowHeader, "1")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.failed.Add(1)
+		s.logger.Warn("Shadow request failed", "path", path, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	shadowBody, err := io.ReadAll(io.LimitReader(resp.Body, maxShadowBodyBytes+1))
+	if err != nil {
+		s.failed.Add(1)
+		s.logger.Warn("Shadow response read failed", "path", path, "error", err)
+		return
+	}
+	if len(shadowBody) > maxShadowBodyBytes {
+		s.skipped.Add(1)
+		return
+	}
+
+	if resp.StatusCode == status && equivalentBodies(body, shadowBody) {
+		s.matched.Add(1)
+		return
+	}
+
+	s.diverged.Add(1)
+	s.logger.Warn("🔀 Shadow response diverged",
+		"path", path,
+		"query", decodeQuery(rawQuery),
+		"status", status,
+		"shadow_status", resp.StatusCode,
+		"body", truncateForLog(body),
+		"shadow_body", truncateForLog(shadowBody),
+	)
+}
+
+// equivalentBodies compares two response bodies, ignoring the per-request "meta"
+// object of JSON responses (latency, cache state). Non-JSON bodies are compared
+// byte for byte.
+func equivalentBodies(a, b []byte) bool {
+	var av, bv any
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return bytes.Equal(a, b)
+	}
+	if m, ok := av.(map[string]any); ok {
+		delete(m, "meta")
+	}
+	if m, ok := bv.(map[string]any); ok {
+		delete(m, "meta")
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+// decodeQuery decodes a query string for logging, so the log handler's IP
+// redaction sees percent-encoded addresses (ip=2001%3Adb8%3A%3A1) as addresses.
+// A query that doesn't decode is left out rather than logged raw.
+func decodeQuery(rawQuery string) string {
+	query, err := url.QueryUnescape(rawQuery)
+	if err != nil {
+		return "[undecodable]"
+	}
+	return query
+}
+
+func truncateForLog(body []byte) string {
+	if len(body) > maxShadowLogBytes {
+		return string(body[:maxShadowLogBytes]) + "..."
+	}
+	return string(body)
+}
+
+// RegisterMetrics exposes shadow traffic counters on the registry
+func (s *Shadower) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewCounterFunc("ipgeo_shadow_requests_total",
+		"Total requests mirrored to the shadow backend",
+		func() float64 { return float64(s.mirrored.Load()) })
+	registry.NewCounterFunc("ipgeo_shadow_matches_total",
+		"Total shadow responses matching production",
+		func() float64 { return float64(s.matched.Load()) })
+	registry.NewCounterFunc("ipgeo_shadow_divergences_total",
+		"Total shadow responses differing from production",
+		func() float64 { return float64(s.diverged.Load()) })
+	registry.NewCounterFunc("ipgeo_shadow_errors_total",
+		"Total shadow requests that failed",
+		func() float64 { return float64(s.failed.Load()) })
+	registry.NewCounterFunc("ipgeo_shadow_dropped_total",
+		"Total sampled requests not mirrored because too many were in flight",
+		func() float64 { return float64(s.dropped.Load()) })
+	registry.NewCounterFunc("ipgeo_shadow_skipped_total",
+		"Total shadow comparisons skipped because a body was too large",
+		func() float64 { return float64(s.skipped.Load()) })
+	registry.NewGaugeFunc("ipgeo_shadow_in_flight",
+		"Shadow requests currently being compared",
+		func() float64 { return float64(s.inFlight.Load()) })
+}
+
+// shadowCaptureWriter records the status and (bounded) body written by the handler
+type shadowCaptureWriter struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (cw *shadowCaptureWriter) WriteHeader(code int) {
+	if cw.status == 0 {
+		cw.status = code
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *shadowCaptureWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.overflow {
+		if cw.body.Len()+len(b) > maxShadowBodyBytes {
+			cw.overflow = true
+			cw.body.Reset()
+		} else {
+			cw.body.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (cw *shadowCaptureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// ShadowMiddleware mirrors a sample of GET /v1 requests to the shadow backend once
+// the production response has been written, without the client's credentials.
+// Requests that are themselves mirrored are never mirrored again.
+func ShadowMiddleware(shadower *Shadower) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, "/v1/") ||
+				r.Header.Get(ShadowHeader) != "" || !shadower.sample() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &shadowCaptureWriter{ResponseWriter: w}
+			next.ServeHTTP(cw, r)
+
+			if cw.overflow {
+				shadower.skipped.Add(1)
+				return
+			}
+			select {
+			case shadower.slots <- struct{}{}:
+			default:
+				shadower.dropped.Add(1)
+				return
+			}
+			shadower.mirrored.Add(1)
+			shadower.inFlight.Add(1)
+
+			status := cw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			header := r.Header.Clone()
+			for _, name := range shadowDroppedHeaders {
+				header.Del(name)
+			}
+			go shadower.mirror(r.Method, r.URL.Path, r.URL.RawQuery, header, status, cw.body.Bytes())
+		})
+	}
+}
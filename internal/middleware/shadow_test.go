@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/privacy"
+)
+
+func TestEquivalentBodies(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"identical", `{"country": "US"}`, `{"country": "US"}`, true},
+		{"formatting and key order", `{"country":"US","city":"NYC"}`, `{"city": "NYC", "country": "US"}`, true},
+		{"meta ignored", `{"location": {"country": "US"}, "meta": {"latency_ms": 0.1}}`, `{"location": {"country": "US"}, "meta": {"latency_ms": 3}}`, true},
+		{"different country", `{"country": "US"}`, `{"country": "CA"}`, false},
+		{"non-JSON", "not found", "not found", true},
+		{"non-JSON differs", "not found", "gone", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := equivalentBodies([]byte(tt.a), []byte(tt.b)); got != tt.want {
+				t.Errorf("equivalentBodies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShadowMiddleware(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(ShadowHeader) != "1" {
+			t.Errorf("Shadow request missing %s header", ShadowHeader)
+		}
+		if r.URL.Query().Get("ip") == "8.8.8.8" {
+			io.WriteString(w, `{"country": "US"}`)
+			return
+		}
+		io.WriteString(w, `{"country": "CA"}`)
+	}))
+	defer backend.Close()
+
+	shadower, err := NewShadower(backend.URL, 100, time.Second, 10, nil, slog.Default())
+	if err != nil {
+		t.Fatalf("NewShadower() error = %v", err)
+	}
+	handler := ShadowMiddleware(shadower)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"country": "US"}`)
+	}))
+
+	for _, path := range []string{"/v1/find-country?ip=8.8.8.8", "/v1/find-country?ip=1.1.1.1", "/health"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "US") {
+			t.Errorf("GET %s = %d %s, want production response", path, w.Code, w.Body.String())
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for shadower.matched.Load()+shadower.diverged.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if got := shadower.mirrored.Load(); got != 2 {
+		t.Errorf("Mirrored %d requests, want 2 (/health is not mirrored)", got)
+	}
+	if shadower.matched.Load() != 1 || shadower.diverged.Load() != 1 {
+		t.Errorf("Got %d matches and %d divergences, want 1 and 1", shadower.matched.Load(), shadower.diverged.Load())
+	}
+}
+
+func TestShadowMiddleware_RedactsEncodedQuery(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"country": "CA"}`)
+	}))
+	defer backend.Close()
+
+	var logs bytes.Buffer
+	logger := slog.New(privacy.NewRedactingLogHandler(slog.NewTextHandler(&logs, nil)))
+	shadower, err := NewShadower(backend.URL, 100, time.Second, 10, nil, logger)
+	if err != nil {
+		t.Fatalf("NewShadower() error = %v", err)
+	}
+	handler := ShadowMiddleware(shadower)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"country": "US"}`)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/find-country?ip=2001%3Adb8%3A%3A1", nil))
+
+	// The comparison leaves the in-flight count once it has logged
+	deadline := time.Now().Add(2 * time.Second)
+	for (shadower.diverged.Load() < 1 || shadower.inFlight.Load() > 0) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := logs.String(); !strings.Contains(got, "ip="+privacy.Redacted) || strings.Contains(got, "2001") {
+		t.Errorf("Expected the queried address to be redacted, got %s", got)
+	}
+}
+
+func TestShadowMiddleware_DropsCredentials(t *testing.T) {
+	received := make(chan http.Header, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		io.WriteString(w, `{"country": "US"}`)
+	}))
+	defer backend.Close()
+
+	shadower, err := NewShadower(backend.URL, 100, time.Second, 10, nil, slog.Default())
+	if err != nil {
+		t.Fatalf("NewShadower() error = %v", err)
+	}
+	handler := ShadowMiddleware(shadower)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"country": "US"}`)
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set(APIKeyHeader, "key")
+	req.Header.Set(SignatureKeyHeader, "client")
+	req.Header.Set(SignatureTimestampHeader, "1700000000")
+	req.Header.Set(SignatureHeader, "signature")
+	req.Header.Set("Accept-Language", "de")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case header := <-received:
+		for _, name := range shadowDroppedHeaders {
+			if header.Get(name) != "" {
+				t.Errorf("Shadow request carried %s", name)
+			}
+		}
+		if header.Get("Accept-Language") != "de" {
+			t.Errorf("Expected Accept-Language to be mirrored, got %q", header.Get("Accept-Language"))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shadow request not received")
+	}
+}
+
+func TestShadowMiddleware_SkipsShadowRequests(t *testing.T) {
+	shadower, err := NewShadower("http://127.0.0.1:1", 100, time.Second, 10, nil, slog.Default())
+	if err != nil {
+		t.Fatalf("NewShadower() error = %v", err)
+	}
+	handler := ShadowMiddleware(shadower)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	req.Header.Set(ShadowHeader, "1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := shadower.mirrored.Load(); got != 0 {
+		t.Errorf("Mirrored %d requests, want 0 for a request that is already shadowed", got)
+	}
+}
+
+func TestNewShadower_InvalidURL(t *testing.T) {
+	for _, target := range []string{"", "ftp://example.com", "http://"} {
+		if _, err := NewShadower(target, 10, time.Second, 1, nil, slog.Default()); err == nil {
+			t.Errorf("NewShadower(%q) expected error", target)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+// Client deadline headers
+const (
+	RequestTimeoutHeader = "X-Request-Timeout"
+	GRPCTimeoutHeader    = "Grpc-Timeout"
+)
+
+// TimeoutConfig holds the default request timeout and per-route overrides
+type TimeoutConfig struct {
+	Default time.Duration            // Applied when no route matches (0 disables)
+	Routes  map[string]time.Duration // Path prefix -> timeout; longest prefix wins, 0 disables
+	// ClientHeader lets clients shorten (never extend) the deadline with
+	// X-Request-Timeout or Grpc-Timeout
+	ClientHeader bool
+}
+
+// timeoutFor returns the timeout for path using longest-prefix matching
+func (c TimeoutConfig) timeoutFor(path string) time.Duration {
+	timeout := c.Default
+	longest := -1
+	for prefix, routeTimeout := range c.Routes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			timeout = routeTimeout
+			longest = len(prefix)
+		}
+	}
+	return timeout
+}
+
+// clientTimeout returns the deadline requested by the client, or 0 when none was sent
+func clientTimeout(r *http.Request) (time.Duration, error) {
+	if value := r.Header.Get(RequestTimeoutHeader); value != "" {
+		return ParseRequestTimeout(value)
+	}
+	if value := r.Header.Get(GRPCTimeoutHeader); value != "" {
+		return ParseGRPCTimeout(value)
+	}
+	return 0, nil
+}
+
+// ParseRequestTimeout parses an X-Request-Timeout value: a Go duration ("250ms", "2s")
+// or a bare number of milliseconds
+func ParseRequestTimeout(value string) (time.Duration, error) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if ms <= 0 || ms > math.MaxInt64/int64(time.Millisecond) {
+			return 0, errors.New("timeout must be positive")
+		}
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if timeout <= 0 {
+		return 0, errors.New("timeout must be positive")
+	}
+	return timeout, nil
+}
+
+// grpcTimeoutUnits maps gRPC timeout unit suffixes to durations
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// ParseGRPCTimeout parses a gRPC-style timeout: up to 8 digits followed by a unit
+// (H, M, S, m, u or n), e.g. "500m" for 500 milliseconds
+func ParseGRPCTimeout(value string) (time.Duration, error) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, fmt.Errorf("invalid grpc timeout: %q", value)
+	}
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid grpc timeout unit: %q", value)
+	}
+	amount, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+	if err != nil || amount == 0 {
+		return 0, fmt.Errorf("invalid grpc timeout: %q", value)
+	}
+	if unit == time.Hour && amount > uint64(math.MaxInt64/int64(time.Hour)) {
+		return 0, fmt.Errorf("grpc timeout out of range: %q", value)
+	}
+	return time.Duration(amount) * unit, nil
+}
+
+// TimeoutMiddleware bounds request handling time. The deadline is attached to the
+// request context so downstream layers stop work; if the handler hasn't finished when
+// it fires, the client receives a 504 with a structured JSON error. A handler that
+// flushes (e.g. to stream results) commits its response instead: it is written through
+// from then on, and when the deadline fires the handler is left to end the stream.
+// With ClientHeader set, a shorter deadline sent by the client replaces the configured one.
+func TimeoutMiddleware(cfg TimeoutConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := cfg.timeoutFor(r.URL.Path)
+			source := requestcontext.DeadlineServer
+			if cfg.ClientHeader {
+				requested, err := clientTimeout(r)
+				if err != nil {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"error": "Invalid request timeout header", "code": "invalid_request_timeout"}`))
+					return
+				}
+				// The client's budget can only tighten the server deadline
+				if requested > 0 && (timeout <= 0 || requested < timeout) {
+					timeout = requested
+					source = requestcontext.DeadlineClient
+				}
+			}
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			ctx = requestcontext.WithDeadline(ctx, requestcontext.Deadline{Timeout: timeout, Source: source})
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{w: w, h: make(http.Header)}
+			done := make(chan struct{})
+			panicChan := make(chan interface{}, 1)
+
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						recordPanicStack(r.Context())
+						panicChan <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				// Re-panic on the serving goroutine so RecoveryMiddleware handles it
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				tw.commitLocked()
+			case <-ctx.Done():
+				tw.mu.Lock()
+				if tw.committed {
+					// The response is already on its way; wait for the handler to finish it
+					tw.mu.Unlock()
+					select {
+					case p := <-panicChan:
+						panic(p)
+					case <-done:
+					}
+					return
+				}
+				defer tw.mu.Unlock()
+
+				tw.timedOut = true
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusGatewayTimeout)
+
+				errorResponse := fmt.Sprintf(`{"error": "Request timed out", "code": "request_timeout", "timeout_ms": %d}`,
+					timeout.Milliseconds())
+				w.Write([]byte(errorResponse))
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the handler's response until it completes, flushes or the
+// deadline fires
+type timeoutWriter struct {
+	w    http.ResponseWriter
+	h    http.Header
+	wbuf bytes.Buffer
+
+	mu          sync.Mutex
+	timedOut    bool
+	committed   bool // The buffered response was written to w; later writes go straight through
+	wroteHeader bool
+	code        int
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.h }
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	if tw.committed {
+		return tw.w.Write(p)
+	}
+	return tw.wbuf.Write(p)
+}
+
+// Flush commits the response and flushes it to the client
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return
+	}
+	tw.commitLocked()
+	http.NewResponseController(tw.w).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for everything but
+// Flush, which must go through the buffer
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// commitLocked writes the buffered headers and body to the underlying writer
+func (tw *timeoutWriter) commitLocked() {
+	if tw.committed {
+		return
+	}
+	tw.committed = true
+
+	dst := tw.w.Header()
+	for k, vv := range tw.h {
+		dst[k] = vv
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	tw.w.WriteHeader(tw.code)
+	tw.w.Write(tw.wbuf.Bytes())
+	tw.wbuf.Reset()
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	tw.wroteHeader = true
+	tw.code = code
+}
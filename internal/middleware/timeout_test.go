@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+func TestTimeoutMiddleware_PassThrough(t *testing.T) {
+	handler := TimeoutMiddleware(TimeoutConfig{Default: time.Second})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "ok")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("done"))
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/find-country", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", w.Code)
+	}
+	if w.Header().Get("X-Test") != "ok" {
+		t.Error("Expected handler headers to be copied")
+	}
+	if w.Body.String() != "done" {
+		t.Errorf("Expected body 'done', got %q", w.Body.String())
+	}
+}
+
+func TestTimeoutMiddleware_Timeout(t *testing.T) {
+	handler := TimeoutMiddleware(TimeoutConfig{Default: 20 * time.Millisecond})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.Write([]byte("too late"))
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/find-country", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status 504, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `"code": "request_timeout"`) || !strings.Contains(body, `"timeout_ms": 20`) {
+		t.Errorf("Expected structured timeout error, got %s", body)
+	}
+	if strings.Contains(body, "too late") {
+		t.Error("Expected late handler output to be discarded")
+	}
+}
+
+func TestTimeoutMiddleware_RouteOverride(t *testing.T) {
+	cfg := TimeoutConfig{
+		Default: 20 * time.Millisecond,
+		Routes: map[string]time.Duration{
+			"/v1/":      20 * time.Millisecond,
+			"/v1/batch": time.Second,
+			"/health":   0,
+		},
+	}
+	handler := TimeoutMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/v1/find-country", http.StatusGatewayTimeout},
+		{"/v1/batch", http.StatusOK},
+		{"/health", http.StatusOK},
+		{"/other", http.StatusGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+func TestTimeoutMiddleware_PropagatesPanic(t *testing.T) {
+	handler := TimeoutMiddleware(TimeoutConfig{Default: time.Second})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Errorf("Expected panic to propagate, got %v", p)
+		}
+	}()
+
+	req := httptest.NewRequest("GET", "/v1/find-country", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestTimeoutMiddleware_ClientHeader(t *testing.T) {
+	cfg := TimeoutConfig{
+		Default:      time.Second,
+		Routes:       map[string]time.Duration{"/health": 0},
+		ClientHeader: true,
+	}
+	handler := TimeoutMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	}))
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		value  string
+		want   int
+	}{
+		{"no header", "/v1/find-country", "", "", http.StatusOK},
+		{"shorter duration", "/v1/find-country", RequestTimeoutHeader, "10ms", http.StatusGatewayTimeout},
+		{"shorter milliseconds", "/v1/find-country", RequestTimeoutHeader, "10", http.StatusGatewayTimeout},
+		{"grpc style", "/v1/find-country", GRPCTimeoutHeader, "10m", http.StatusGatewayTimeout},
+		{"cannot extend", "/v1/find-country", RequestTimeoutHeader, "1h", http.StatusOK},
+		{"applies without server timeout", "/health", RequestTimeoutHeader, "10ms", http.StatusGatewayTimeout},
+		{"invalid", "/v1/find-country", RequestTimeoutHeader, "soon", http.StatusBadRequest},
+		{"negative", "/v1/find-country", RequestTimeoutHeader, "-5s", http.StatusBadRequest},
+		{"invalid grpc unit", "/v1/find-country", GRPCTimeoutHeader, "10x", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+
+	// Without ClientHeader the header is ignored
+	cfg.ClientHeader = false
+	req := httptest.NewRequest("GET", "/v1/find-country", nil)
+	req.Header.Set(RequestTimeoutHeader, "10ms")
+	w := httptest.NewRecorder()
+	TimeoutMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected header to be ignored when disabled, got %d", w.Code)
+	}
+}
+
+func TestTimeoutMiddleware_DeadlineMetadata(t *testing.T) {
+	var seen requestcontext.Deadline
+	handler := TimeoutMiddleware(TimeoutConfig{Default: time.Second, ClientHeader: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = requestcontext.DeadlineFrom(r.Context())
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/find-country", nil))
+	if seen.Timeout != time.Second || seen.Source != requestcontext.DeadlineServer {
+		t.Errorf("Expected 1s server deadline, got %+v", seen)
+	}
+
+	req := httptest.NewRequest("GET", "/v1/find-country", nil)
+	req.Header.Set(RequestTimeoutHeader, "250ms")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if seen.Timeout != 250*time.Millisecond || seen.Source != requestcontext.DeadlineClient {
+		t.Errorf("Expected 250ms client deadline, got %+v", seen)
+	}
+}
+
+func TestTimeoutMiddleware_FlushCommitsResponse(t *testing.T) {
+	handler := TimeoutMiddleware(TimeoutConfig{Default: 20 * time.Millisecond})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte("first\n"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush returned %v", err)
+		}
+		<-r.Context().Done()
+		w.Write([]byte("last\n"))
+	}))
+
+	req := httptest.NewRequest("POST", "/v1/batch", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected flushed status 200 to stand, got %d", w.Code)
+	}
+	if !w.Flushed {
+		t.Error("Expected flush to reach the underlying writer")
+	}
+	if got := w.Body.String(); got != "first\nlast\n" {
+		t.Errorf("Expected streamed body without timeout error, got %q", got)
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"ip-geolocation-service/internal/usage"
+)
+
+// UsageMiddleware records each authenticated /v1 request against the client's
+// stable identity for usage export. Anonymous requests aren't recorded.
+func UsageMiddleware(recorder *usage.Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, ok := APIKeyFromContext(r.Context())
+			if !ok || apiKey.QuotaID == "" || !strings.HasPrefix(r.URL.Path, "/v1/") || r.URL.Path == UsagePath {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			wrapped := newResponseWriter(w)
+			next.ServeHTTP(wrapped, r)
+			status := wrapped.statusCode
+			wrapped.release()
+			recorder.Record(apiKey.QuotaID, status)
+		})
+	}
+}
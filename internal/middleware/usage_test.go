@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ip-geolocation-service/internal/usage"
+)
+
+func TestUsageMiddleware(t *testing.T) {
+	store, err := NewAPIKeyStoreWithRoles(map[string]string{"client-key": ""}, nil)
+	if err != nil {
+		t.Fatalf("NewAPIKeyStoreWithRoles() error = %v", err)
+	}
+	recorder := usage.NewRecorder()
+	handler := APIKeyMiddleware(store)(UsageMiddleware(recorder)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ip") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})))
+
+	for _, tc := range []struct{ path, key string }{
+		{"/v1/find-country?ip=8.8.8.8", "client-key"},
+		{"/v1/find-country", "client-key"},
+		{"/v1/find-country?ip=8.8.8.8", ""},
+		{UsagePath, "client-key"},
+		{"/health", "client-key"},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		if tc.key != "" {
+			req.Header.Set(APIKeyHeader, tc.key)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	report := recorder.Cut()
+	if len(report.Clients) != 1 {
+		t.Fatalf("Recorded clients = %+v, want one", report.Clients)
+	}
+	got := report.Clients[0]
+	if got.Client != quotaKeyID("client-key") || got.Requests != 2 || got.Succeeded != 1 || got.Failed != 1 {
+		t.Errorf("Recorded usage = %+v", got)
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"sync/atomic"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// WarmUp holds readiness back while freshly loaded data is warmed up. Like a
+// draining instance, a warming one is healthy but reports itself not ready.
+type WarmUp struct {
+	warming atomic.Bool
+}
+
+// NewWarmUp creates a warm-up gate in the warming (not ready) state
+func NewWarmUp() *WarmUp {
+	w := &WarmUp{}
+	w.warming.Store(true)
+	return w
+}
+
+// Finish marks the warm-up as done, letting readiness through
+func (w *WarmUp) Finish() {
+	w.warming.Store(false)
+}
+
+// WarmingUp reports whether the warm-up is still running; a nil gate never is
+func (w *WarmUp) WarmingUp() bool {
+	return w != nil && w.warming.Load()
+}
+
+// RegisterMetrics exposes the warm-up state on the registry
+func (w *WarmUp) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("ipgeo_warming_up",
+		"Whether the instance is warming up its datasets (1) or done (0)",
+		func() float64 {
+			if w.WarmingUp() {
+				return 1
+			}
+			return 0
+		})
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Location and ErrorResponse are encoded on every lookup, so they are appended by
+// hand rather than through encoding/json's reflection. The output is byte for byte
+// what json.Marshal produces for the same value; only invalid UTF-8, which newer
+// encoders replace with a raw U+FFFD, is always written as the \ufffd escape.
+
+// AppendJSON appends the JSON encoding of l to dst. It fails only for coordinates
+// JSON can't represent (NaN and infinities).
+func (l *Location) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, `{"country":`...)
+	dst = appendJSONString(dst, l.Country)
+	dst = append(dst, `,"city":`...)
+	dst = appendJSONString(dst, l.City)
+	if l.CountryCode != "" {
+		dst = append(dst, `,"country_code":`...)
+		dst = appendJSONString(dst, l.CountryCode)
+	}
+	if l.CountryCode3 != "" {
+		dst = append(dst, `,"country_code3":`...)
+		dst = appendJSONString(dst, l.CountryCode3)
+	}
+	if l.Continent != "" {
+		dst = append(dst, `,"continent":`...)
+		dst = appendJSONString(dst, l.Continent)
+	}
+	var err error
+	if l.Latitude != nil {
+		dst = append(dst, `,"latitude":`...)
+		if dst, err = appendJSONFloat(dst, *l.Latitude); err != nil {
+			return dst, err
+		}
+	}
+	if l.Longitude != nil {
+		dst = append(dst, `,"longitude":`...)
+		if dst, err = appendJSONFloat(dst, *l.Longitude); err != nil {
+			return dst, err
+		}
+	}
+	if l.Accuracy != "" {
+		dst = append(dst, `,"accuracy":`...)
+		dst = appendJSONString(dst, l.Accuracy)
+	}
+	if l.Confidence != nil {
+		dst = append(dst, `,"confidence":`...)
+		dst = strconv.AppendInt(dst, int64(*l.Confidence), 10)
+	}
+	if l.IsAnonymizer != nil {
+		dst = append(dst, `,"is_anonymizer":`...)
+		dst = strconv.AppendBool(dst, *l.IsAnonymizer)
+	}
+	if l.Blocked != nil {
+		dst = append(dst, `,"blocked":`...)
+		dst = strconv.AppendBool(dst, *l.Blocked)
+	}
+	return append(dst, '}'), nil
+}
+
+// AppendJSON appends the JSON encoding of e to dst
+func (e *ErrorResponse) AppendJSON(dst []byte) []byte {
+	dst = append(dst, `{"error":`...)
+	dst = appendJSONString(dst, e.Error)
+	if e.Code != "" {
+		dst = append(dst, `,"code":`...)
+		dst = appendJSONString(dst, e.Code)
+	}
+	return append(dst, '}')
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s as a JSON string, escaped like encoding/json: control
+// characters, <, > and & (HTML-safe), U+2028 and U+2029, with invalid UTF-8 replaced
+// by U+FFFD
+func appendJSONString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case c == utf8.RuneError && size == 1:
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, `\ufffd`...)
+		case c == '\u2028' || c == '\u2029':
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[c&0xF])
+		default:
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// appendJSONFloat appends f as encoding/json does: like ES6 number formatting,
+// switching to an exponent below 1e-6 and from 1e21
+func appendJSONFloat(dst []byte, f float64) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return dst, fmt.Errorf("json: unsupported value: %s", strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, 64)
+	if format == 'e' {
+		// e-09 becomes e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst, nil
+}
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+// sameJSON reports whether got encodes what json.Marshal encoded as want. Encoders
+// differ in how they write replaced invalid UTF-8, so with invalid input only the
+// decoded values are compared.
+func sameJSON[T any](t *testing.T, got, want []byte, validUTF8 bool) bool {
+	t.Helper()
+	if validUTF8 {
+		return string(got) == string(want)
+	}
+	var gotValue, wantValue T
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("AppendJSON() = %s, not valid JSON: %v", got, err)
+	}
+	if err := json.Unmarshal(want, &wantValue); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	return reflect.DeepEqual(gotValue, wantValue)
+}
+
+func validLocationUTF8(l *Location) bool {
+	for _, s := range []string{l.Country, l.City, l.CountryCode, l.CountryCode3, l.Continent, l.Accuracy} {
+		if !utf8.ValidString(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// fullLocation sets every field, as an enriched lookup answer does
+func fullLocation() *Location {
+	return &Location{
+		Country:      "United States",
+		City:         "San Francisco",
+		CountryCode:  "US",
+		CountryCode3: "USA",
+		Continent:    "NA",
+		Latitude:     ptr(37.7749),
+		Longitude:    ptr(-122.4194),
+		Accuracy:     AccuracyCity,
+		Confidence:   ptr(87),
+		IsAnonymizer: ptr(false),
+		Blocked:      ptr(true),
+	}
+}
+
+func TestLocation_AppendJSON_MatchesEncodingJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		location *Location
+	}{
+		{"empty", &Location{}},
+		{"country and city", &Location{Country: "IL", City: "Tel Aviv"}},
+		{"every field", fullLocation()},
+		{"HTML characters", &Location{Country: "<script>", City: "Tom & Jerry's > \"Cats\""}},
+		{"control characters", &Location{Country: "a\tb\nc\rd\be\ff\x00g\x1f\x7f", City: `back\slash`}},
+		{"non-ASCII", &Location{Country: "Côte d'Ivoire", City: "東京 🗼"}},
+		{"line separators", &Location{Country: "a\u2028b\u2029c"}},
+		{"invalid UTF-8", &Location{Country: "a\xffb\xc3", City: "\xe2\x80"}},
+		{"zero coordinates", &Location{Latitude: ptr(0.0), Longitude: ptr(math.Copysign(0, -1))}},
+		{"tiny coordinates", &Location{Latitude: ptr(1e-7), Longitude: ptr(-0.000001)}},
+		{"huge coordinates", &Location{Latitude: ptr(1e21), Longitude: ptr(-123456789012345678901234.0)}},
+		{"negative confidence", &Location{Confidence: ptr(-1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := json.Marshal(tt.location)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			got, err := tt.location.AppendJSON(nil)
+			if err != nil {
+				t.Fatalf("AppendJSON() error = %v", err)
+			}
+			if !sameJSON[Location](t, got, want, validLocationUTF8(tt.location)) {
+				t.Errorf("AppendJSON() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestLocation_AppendJSON_RejectsNonFiniteCoordinates(t *testing.T) {
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := (&Location{Latitude: ptr(f)}).AppendJSON(nil); err == nil {
+			t.Errorf("AppendJSON() with latitude %v succeeded, want an error", f)
+		}
+		if _, err := (&Location{Longitude: ptr(f)}).ToJSON(); err == nil {
+			t.Errorf("ToJSON() with longitude %v succeeded, want an error", f)
+		}
+	}
+}
+
+func TestErrorResponse_AppendJSON_MatchesEncodingJSON(t *testing.T) {
+	for _, e := range []*ErrorResponse{
+		NewErrorResponse(""),
+		NewErrorResponse(`Invalid "ip" <parameter> & more`),
+		NewErrorResponseWithCode("Lookup timed out", "lookup_timeout"),
+		NewErrorResponseWithCode("bad\xffbyte\n", "a\u2028b"),
+	} {
+		want, err := json.Marshal(e)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		valid := utf8.ValidString(e.Error) && utf8.ValidString(e.Code)
+		if got := e.AppendJSON(nil); !sameJSON[ErrorResponse](t, got, want, valid) {
+			t.Errorf("AppendJSON() = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestLocation_AppendJSON_DoesNotAllocate(t *testing.T) {
+	location := fullLocation()
+	errorResp := NewErrorResponseWithCode("Dataset is still loading", "dataset_loading")
+	buf := make([]byte, 0, 512)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = location.AppendJSON(buf[:0])
+		buf = errorResp.AppendJSON(buf[:0])
+	})
+	if allocs != 0 {
+		t.Errorf("AppendJSON() into a large enough buffer made %v allocations, want 0", allocs)
+	}
+}
+
+func FuzzLocation_AppendJSON(f *testing.F) {
+	f.Add("US", "New York", "<&>", 40.7128, -74.006, 90)
+	f.Add("a\u2028\xff", "\x00\"\\", "", 1e-9, 1e22, -5)
+	f.Fuzz(func(t *testing.T, country, city, continent string, lat, lon float64, confidence int) {
+		location := &Location{Country: country, City: city, Continent: continent, Latitude: &lat, Longitude: &lon, Confidence: &confidence}
+		want, wantErr := json.Marshal(location)
+		got, err := location.AppendJSON(nil)
+		if (err != nil) != (wantErr != nil) {
+			t.Fatalf("AppendJSON() error = %v, json.Marshal() error = %v", err, wantErr)
+		}
+		if err == nil && !sameJSON[Location](t, got, want, validLocationUTF8(location)) {
+			t.Fatalf("AppendJSON() = %s, want %s", got, want)
+		}
+	})
+}
+
+// The benchmarks compare the hand-written encoder, appending into a reused buffer
+// as the handlers do, with encoding/json
+func BenchmarkLocation_AppendJSON(b *testing.B) {
+	location := fullLocation()
+	buf := make([]byte, 0, 512)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		buf, _ = location.AppendJSON(buf[:0])
+	}
+}
+
+func BenchmarkLocation_EncodingJSON(b *testing.B) {
+	location := fullLocation()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		json.Marshal(location)
+	}
+}
+
+func BenchmarkErrorResponse_AppendJSON(b *testing.B) {
+	errorResp := NewErrorResponseWithCode("Location not found for the provided IP address", "not_found")
+	buf := make([]byte, 0, 512)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		buf = errorResp.AppendJSON(buf[:0])
+	}
+}
+
+func BenchmarkErrorResponse_EncodingJSON(b *testing.B) {
+	errorResp := NewErrorResponseWithCode("Location not found for the provided IP address", "not_found")
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		json.Marshal(errorResp)
+	}
+}
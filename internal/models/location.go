@@ -1,24 +1,64 @@
 package models
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net"
+	"net/netip"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"ip-geolocation-service/internal/countries"
 )
 
 // Location represents the geographical location of an IP address
 type Location struct {
-	Country string `json:"country"`
-	City    string `json:"city"`
+	Country      string   `json:"country"`
+	City         string   `json:"city"`
+	CountryCode  string   `json:"country_code,omitempty"`  // ISO 3166-1 alpha-2
+	CountryCode3 string   `json:"country_code3,omitempty"` // ISO 3166-1 alpha-3
+	Continent    string   `json:"continent,omitempty"`
+	Latitude     *float64 `json:"latitude,omitempty"` // Set when the dataset provides coordinates
+	Longitude    *float64 `json:"longitude,omitempty"`
+	// Accuracy is the finest level the answer can be trusted to: AccuracyCity,
+	// AccuracyRegion or AccuracyCountry
+	Accuracy string `json:"accuracy,omitempty"`
+	// Confidence is the backend's certainty in the answer from 0 to 100, set only by
+	// backends that provide one
+	Confidence *int `json:"confidence,omitempty"`
+	// IsAnonymizer is set when threat-intel enrichment is enabled: true for Tor exits,
+	// VPNs and proxies, false otherwise
+	IsAnonymizer *bool `json:"is_anonymizer,omitempty"`
+	// Blocked is set when a country access policy is configured: true for locations
+	// the policy denies
+	Blocked *bool `json:"blocked,omitempty"`
 }
 
+// Accuracy levels, finest first
+const (
+	AccuracyCity    = "city"
+	AccuracyRegion  = "region"
+	AccuracyCountry = "country"
+)
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"` // Machine-readable error code
 }
 
+// ErrInvalidIP is returned (wrapped) for input that isn't an IP address the service
+// accepts. ErrNonCanonicalIPv4 and ErrNonCanonicalIP narrow it down.
+var ErrInvalidIP = errors.New("invalid IP address")
+
+// ErrInvalidLocation is returned (wrapped) for location data that fails validation
+var ErrInvalidLocation = errors.New("invalid location data")
+
+// ErrNonCanonicalIPv4 is returned for dotted IPv4 addresses with leading zeros or
+// hex octets. Other parsers read 8.8.8.010 as 8.8.8.8 (octal) and some as
+// 8.8.8.10, so such addresses are rejected rather than guessed.
+var ErrNonCanonicalIPv4 = errors.New("IPv4 octets must be decimal without leading zeros")
+
 // IPValidator provides IP address validation functionality
 type IPValidator struct {
 	ipv4Regex *regexp.Regexp
@@ -28,23 +68,104 @@ type IPValidator struct {
 // NewIPValidator creates a new IP validator
 func NewIPValidator() *IPValidator {
 	return &IPValidator{
-		ipv4Regex: regexp.MustCompile(`^((25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)$`),
+		// Octets without leading zeros, which net.ParseIP rejects as ambiguous (octal)
+		ipv4Regex: regexp.MustCompile(`^((25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\.){3}(25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])$`),
 		ipv6Regex: regexp.MustCompile(`^([0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}$`),
 	}
 }
 
 // ValidateIP validates if the given string is a valid IP address
 func (v *IPValidator) ValidateIP(ip string) error {
+	_, err := ParseIP(ip)
+	return err
+}
+
+// ParseMode controls how inputs that parse but aren't written canonically are treated
+type ParseMode string
+
+// IP parsing modes
+const (
+	// ParseStrict rejects anything but the canonical spelling: lowercase, fully
+	// compressed IPv6 and plain IPv4 instead of IPv4-mapped IPv6
+	ParseStrict ParseMode = "strict"
+	// ParseNormalize accepts any standard spelling and canonicalizes it, but rejects
+	// IPv4 octets with leading zeros or hex
+	ParseNormalize ParseMode = "normalize"
+	// ParseLenient also accepts IPv4 octets with leading zeros, read as decimal, and
+	// 0x-prefixed hex octets
+	ParseLenient ParseMode = "lenient"
+)
+
+// ErrNonCanonicalIP is returned in strict mode for addresses that parse but aren't
+// written in their canonical form
+var ErrNonCanonicalIP = errors.New("IP address must be written in canonical form")
+
+// ParseIP parses an address accepted by ValidateIP into its canonical typed form:
+// IPv4-mapped IPv6 addresses become plain IPv4, so both spellings of an address
+// share one key
+func ParseIP(ip string) (netip.Addr, error) {
+	return ParseIPMode(ip, ParseNormalize)
+}
+
+// ParseIPMode parses ip like ParseIP, with mode deciding whether non-canonical
+// spellings are rejected, normalized or, for ambiguous IPv4 octets, read leniently.
+// An unknown mode behaves as ParseNormalize.
+func ParseIPMode(ip string, mode ParseMode) (netip.Addr, error) {
 	if ip == "" {
-		return fmt.Errorf("IP address cannot be empty")
+		return netip.Addr{}, fmt.Errorf("%w: IP address cannot be empty", ErrInvalidIP)
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		if decimal, ok := decimalIPv4(ip); ok {
+			if mode != ParseLenient {
+				return netip.Addr{}, fmt.Errorf("%w format: %s: %w", ErrInvalidIP, ip, ErrNonCanonicalIPv4)
+			}
+			addr, err = netip.ParseAddr(decimal)
+		}
+	}
+	if err != nil || addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("%w format: %s", ErrInvalidIP, ip)
+	}
+	if mode == ParseStrict && (addr.Is4In6() || addr.String() != ip) {
+		return netip.Addr{}, fmt.Errorf("%w format: %s (canonical form is %s): %w", ErrInvalidIP, ip, addr.Unmap(), ErrNonCanonicalIP)
 	}
+	return addr.Unmap(), nil
+}
 
-	// Check if it's a valid IPv4 or IPv6 address
-	if net.ParseIP(ip) == nil {
-		return fmt.Errorf("invalid IP address format: %s", ip)
+// decimalIPv4 rewrites ip, or the embedded IPv4 tail of an IPv6 address, with plain
+// decimal octets. It reports false unless the address is four dotted octets of which
+// at least one is written with a leading zero (read as decimal) or in hex.
+func decimalIPv4(ip string) (string, bool) {
+	head, tail := "", ip
+	if i := strings.LastIndexByte(ip, ':'); i >= 0 {
+		head, tail = ip[:i+1], ip[i+1:]
+	}
+	octets := strings.Split(tail, ".")
+	if len(octets) != 4 {
+		return "", false
 	}
 
-	return nil
+	variant := false
+	for i, octet := range octets {
+		digits, base := octet, 10
+		if len(octet) > 2 && (octet[:2] == "0x" || octet[:2] == "0X") {
+			digits, base, variant = octet[2:], 16, true
+		} else if len(octet) > 1 && octet[0] == '0' {
+			variant = true
+		}
+		if digits == "" || digits[0] == '+' || digits[0] == '-' {
+			return "", false
+		}
+		value, err := strconv.ParseUint(digits, base, 32)
+		if err != nil {
+			return "", false
+		}
+		octets[i] = strconv.FormatUint(value, 10)
+	}
+	if !variant {
+		return "", false
+	}
+	return head + strings.Join(octets, "."), true
 }
 
 // IsIPv4 checks if the IP is IPv4
@@ -57,23 +178,24 @@ func (v *IPValidator) IsIPv6(ip string) bool {
 	return v.ipv6Regex.MatchString(ip)
 }
 
-// NormalizeIP normalizes the IP address for consistent storage/lookup
+// NormalizeIP normalizes the IP address for consistent storage/lookup, using the
+// canonical form from ParseIP
 func (v *IPValidator) NormalizeIP(ip string) string {
-	parsedIP := net.ParseIP(ip)
-	if parsedIP == nil {
+	addr, err := ParseIP(ip)
+	if err != nil {
 		return ip
 	}
-	return parsedIP.String()
+	return addr.String()
 }
 
 // ToJSON converts Location to JSON
 func (l *Location) ToJSON() ([]byte, error) {
-	return json.Marshal(l)
+	return l.AppendJSON(make([]byte, 0, 128))
 }
 
 // ToJSON converts ErrorResponse to JSON
 func (e *ErrorResponse) ToJSON() ([]byte, error) {
-	return json.Marshal(e)
+	return e.AppendJSON(make([]byte, 0, 64)), nil
 }
 
 // NewErrorResponse creates a new error response
@@ -81,6 +203,36 @@ func NewErrorResponse(message string) *ErrorResponse {
 	return &ErrorResponse{Error: message}
 }
 
+// NewErrorResponseWithCode creates a new error response with a machine-readable code
+func NewErrorResponseWithCode(message, code string) *ErrorResponse {
+	return &ErrorResponse{Error: message, Code: code}
+}
+
+// Enrich fills in ISO country codes and the continent from the country name.
+// Unknown countries are left without codes. Locations whose backend gave no accuracy
+// are as accurate as the finest field they have.
+func (l *Location) Enrich() {
+	if country, ok := countries.Lookup(l.Country); ok {
+		l.CountryCode = country.Alpha2
+		l.CountryCode3 = country.Alpha3
+		l.Continent = country.Continent
+	}
+	if l.Accuracy == "" {
+		l.Accuracy = AccuracyCountry
+		if l.City != "" {
+			l.Accuracy = AccuracyCity
+		}
+	}
+}
+
+// Coordinates returns the location's latitude and longitude, if known
+func (l *Location) Coordinates() (lat, lon float64, ok bool) {
+	if l.Latitude == nil || l.Longitude == nil {
+		return 0, 0, false
+	}
+	return *l.Latitude, *l.Longitude, true
+}
+
 // ValidateLocation validates location data
 func (l *Location) ValidateLocation() error {
 	if strings.TrimSpace(l.Country) == "" {
@@ -89,5 +241,13 @@ func (l *Location) ValidateLocation() error {
 	if strings.TrimSpace(l.City) == "" {
 		return fmt.Errorf("city cannot be empty")
 	}
+	switch l.Accuracy {
+	case "", AccuracyCity, AccuracyRegion, AccuracyCountry:
+	default:
+		return fmt.Errorf("unknown accuracy: %s", l.Accuracy)
+	}
+	if l.Confidence != nil && (*l.Confidence < 0 || *l.Confidence > 100) {
+		return fmt.Errorf("confidence must be between 0 and 100, got %d", *l.Confidence)
+	}
 	return nil
 }
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 )
@@ -164,6 +165,18 @@ func TestLocation_ValidateLocation(t *testing.T) {
 			wantErr:     true,
 			description: "Should reject location with both whitespace fields",
 		},
+		{
+			name:        "Unknown accuracy",
+			location:    Location{Country: "US", City: "New York", Accuracy: "street"},
+			wantErr:     true,
+			description: "Should reject an accuracy level that isn't defined",
+		},
+		{
+			name:        "Confidence out of range",
+			location:    Location{Country: "US", City: "New York", Accuracy: AccuracyCity, Confidence: intPtr(150)},
+			wantErr:     true,
+			description: "Should reject confidence above 100",
+		},
 	}
 
 	for _, tt := range tests {
@@ -294,38 +307,6 @@ func TestSlowOperation(t *testing.T) {
 	}
 }
 
-// TestIPValidator_Benchmark tests performance of IP validation
-func TestIPValidator_Benchmark(t *testing.T) {
-	validator := NewIPValidator()
-
-	// Test with various IP formats
-	ips := []string{
-		"192.168.1.1",
-		"8.8.8.8",
-		"127.0.0.1",
-		"255.255.255.255",
-		"0.0.0.0",
-		"10.0.0.1",
-		"172.16.0.1",
-	}
-
-	// Benchmark validation performance
-	start := time.Now()
-	for i := 0; i < 1000; i++ {
-		for _, ip := range ips {
-			validator.ValidateIP(ip)
-		}
-	}
-	duration := time.Since(start)
-
-	// Should complete within reasonable time
-	if duration > 100*time.Millisecond {
-		t.Errorf("IP validation took too long: %v", duration)
-	}
-
-	t.Logf("Validated %d IPs in %v", len(ips)*1000, duration)
-}
-
 // TestLocation_JSONRoundTrip tests JSON serialization and deserialization
 func TestLocation_JSONRoundTrip(t *testing.T) {
 	tests := []struct {
@@ -400,6 +381,8 @@ func TestIPValidator_IsIPv4(t *testing.T) {
 		{"Invalid IPv4", "192.168.1", false},
 		{"Invalid IPv4", "192.168.1.1.1", false},
 		{"Invalid IPv4", "256.1.1.1", false},
+		{"Invalid IPv4 - Leading zero", "0.0.0.00", false},
+		{"Invalid IPv4 - Leading zero", "192.168.01.1", false},
 		{"Invalid IPv4", "192.168.1.abc", false},
 		{"Empty string", "", false},
 		{"Not an IP", "not-an-ip", false},
@@ -456,6 +439,8 @@ func TestIPValidator_NormalizeIP(t *testing.T) {
 		{"Valid IPv4", "192.168.1.1", "192.168.1.1"},
 		{"Valid IPv4 with spaces", " 192.168.1.1 ", " 192.168.1.1 "}, // NormalizeIP doesn't trim spaces
 		{"Valid IPv6", "2001:0db8:85a3::8a2e:370:7334", "2001:db8:85a3::8a2e:370:7334"},
+		{"IPv4-mapped IPv6", "::ffff:8.8.8.8", "8.8.8.8"},
+		{"Non-canonical IPv4", "8.8.8.008", "8.8.8.008"},
 		{"Invalid IP", "invalid-ip", "invalid-ip"},
 		{"Empty string", "", ""},
 		{"Whitespace only", "   ", "   "},
@@ -521,3 +506,155 @@ func TestNewErrorResponse(t *testing.T) {
 		})
 	}
 }
+
+func BenchmarkIPValidator_ValidateIP(b *testing.B) {
+	validator := NewIPValidator()
+	ips := []string{"192.168.1.1", "8.8.8.8", "2001:4860:4860::8888", "255.255.255.255", "invalid-ip"}
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		validator.ValidateIP(ips[i%len(ips)])
+	}
+}
+
+func FuzzIPValidator(f *testing.F) {
+	for _, seed := range []string{"8.8.8.8", "2001:DB8::1", "::ffff:192.0.2.1", "256.1.1.1", " 1.1.1.1 ", "fe80::1%eth0", ""} {
+		f.Add(seed)
+	}
+	validator := NewIPValidator()
+
+	f.Fuzz(func(t *testing.T, ip string) {
+		valid := validator.ValidateIP(ip) == nil
+		normalized := validator.NormalizeIP(ip)
+
+		if validator.NormalizeIP(normalized) != normalized {
+			t.Fatalf("NormalizeIP(%q) = %q is not stable", ip, normalized)
+		}
+		if valid && validator.ValidateIP(normalized) != nil {
+			t.Fatalf("Valid IP %q normalized to invalid %q", ip, normalized)
+		}
+		if (validator.IsIPv4(ip) || validator.IsIPv6(ip)) && !valid {
+			t.Fatalf("%q matches an IP pattern but fails validation", ip)
+		}
+	})
+}
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		want    string
+		wantErr bool
+	}{
+		{"192.168.1.1", "192.168.1.1", false},
+		{"2001:0DB8::1", "2001:db8::1", false},
+		{"::ffff:10.0.0.1", "10.0.0.1", false},
+		{"", "", true},
+		{" 192.168.1.1", "", true},
+		{"fe80::1%eth0", "", true},
+		{"192.168.01.1", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			addr, err := ParseIP(tt.ip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIP(%q) error = %v, wantErr %v", tt.ip, err, tt.wantErr)
+			}
+			if !tt.wantErr && addr.String() != tt.want {
+				t.Errorf("ParseIP(%q) = %v, want %v", tt.ip, addr, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIP_NonCanonicalIPv4(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.008", true},
+		{"010.0.0.1", true},
+		{"0x8.8.8.8", true},
+		{"::ffff:8.8.8.08", true},
+		{"8.8.8.8", false},
+		{"8.8.8.0", false},
+		{"8.8.8", false},
+		{"8.8.8.x", false},
+		{"256.1.1.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			_, err := ParseIP(tt.ip)
+			if got := errors.Is(err, ErrNonCanonicalIPv4); got != tt.want {
+				t.Errorf("ParseIP(%q) error = %v, want ErrNonCanonicalIPv4 %v", tt.ip, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIPMode(t *testing.T) {
+	tests := []struct {
+		ip      string
+		mode    ParseMode
+		want    string
+		wantErr error
+	}{
+		{"8.8.8.8", ParseStrict, "8.8.8.8", nil},
+		{"2001:db8::1", ParseStrict, "2001:db8::1", nil},
+		{"::ffff:8.8.8.8", ParseStrict, "", ErrNonCanonicalIP},
+		{"2001:DB8::1", ParseStrict, "", ErrNonCanonicalIP},
+		{"2001:db8:0:0::1", ParseStrict, "", ErrNonCanonicalIP},
+		{"8.8.8.010", ParseStrict, "", ErrNonCanonicalIPv4},
+		{"::ffff:8.8.8.8", ParseNormalize, "8.8.8.8", nil},
+		{"2001:DB8::1", ParseNormalize, "2001:db8::1", nil},
+		{"8.8.8.010", ParseNormalize, "", ErrNonCanonicalIPv4},
+		{"8.8.8.010", ParseLenient, "8.8.8.10", nil},
+		{"0x8.8.8.0X0a", ParseLenient, "8.8.8.10", nil},
+		{"::ffff:8.8.8.08", ParseLenient, "8.8.8.8", nil},
+		{"8.8.8.0400", ParseLenient, "", ErrInvalidIP},
+		{"", ParseNormalize, "", ErrInvalidIP},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode)+"/"+tt.ip, func(t *testing.T) {
+			addr, err := ParseIPMode(tt.ip, tt.mode)
+			if tt.want == "" {
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("ParseIPMode(%q, %s) error = %v, want %v", tt.ip, tt.mode, err, tt.wantErr)
+				}
+				if !errors.Is(err, ErrInvalidIP) {
+					t.Errorf("ParseIPMode(%q, %s) error = %v, want an ErrInvalidIP", tt.ip, tt.mode, err)
+				}
+				return
+			}
+			if err != nil || addr.String() != tt.want {
+				t.Errorf("ParseIPMode(%q, %s) = %v, %v, want %s", tt.ip, tt.mode, addr, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocation_EnrichAccuracy(t *testing.T) {
+	location := Location{Country: "United States", City: "Mountain View"}
+	location.Enrich()
+	if location.Accuracy != AccuracyCity || location.Confidence != nil {
+		t.Errorf("Expected city accuracy without confidence, got %q, %v", location.Accuracy, location.Confidence)
+	}
+
+	location = Location{Country: "United States"}
+	location.Enrich()
+	if location.Accuracy != AccuracyCountry {
+		t.Errorf("Expected country accuracy without a city, got %q", location.Accuracy)
+	}
+
+	location = Location{Country: "United States", City: "Mountain View", Accuracy: AccuracyRegion}
+	location.Enrich()
+	if location.Accuracy != AccuracyRegion {
+		t.Errorf("Expected the backend's accuracy to be kept, got %q", location.Accuracy)
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
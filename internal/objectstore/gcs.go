@@ -0,0 +1,298 @@
+package objectstore
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Google endpoints
+const (
+	gcsEndpoint         = "https://storage.googleapis.com"
+	gcsReadOnlyScope    = "https://www.googleapis.com/auth/devstorage.read_only"
+	googleTokenURL      = "https://oauth2.googleapis.com/token"
+	gceMetadataHost     = "metadata.google.internal"
+	gceMetadataTokenURL = "/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// gcsBackend reads objects through the Cloud Storage JSON API. Access tokens come
+// from GOOGLE_OAUTH_ACCESS_TOKEN, the GOOGLE_APPLICATION_CREDENTIALS file (a service
+// account key or gcloud's application default credentials) or the GCE metadata
+// server; without any, requests are anonymous. STORAGE_EMULATOR_HOST points it at an
+// emulator, which needs no credentials.
+type gcsBackend struct {
+	client   *http.Client
+	metadata *http.Client // Short timeout, so probing off GCE fails fast
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	probed  bool // No credentials were found
+}
+
+func newGCSBackend(client *http.Client) *gcsBackend {
+	return &gcsBackend{client: client, metadata: &http.Client{Timeout: 2 * time.Second}}
+}
+
+func (b *gcsBackend) stat(ctx context.Context, bucket, key string) (objectInfo, error) {
+	resp, err := b.do(ctx, b.objectURL(bucket, key), nil)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return objectInfo{}, statusError(resp)
+	}
+
+	var object struct {
+		Size       string `json:"size"`
+		Generation string `json:"generation"`
+		MD5Hash    string `json:"md5Hash"`
+		CRC32C     string `json:"crc32c"`
+		Updated    string `json:"updated"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&object); err != nil {
+		return objectInfo{}, fmt.Errorf("invalid object metadata: %w", err)
+	}
+	info := objectInfo{version: object.Generation}
+	if info.size, err = strconv.ParseInt(object.Size, 10, 64); err != nil || info.size < 0 {
+		return objectInfo{}, fmt.Errorf("invalid object size %q", object.Size)
+	}
+	if info.version == "" {
+		return objectInfo{}, fmt.Errorf("object has no generation")
+	}
+	if modified, err := time.Parse(time.RFC3339, object.Updated); err == nil {
+		info.modified = modified
+	}
+	// Composite objects only have a CRC32C
+	if sum, err := base64.StdEncoding.DecodeString(object.MD5Hash); err == nil && len(sum) == 16 {
+		info.md5 = sum
+	}
+	if sum, err := base64.StdEncoding.DecodeString(object.CRC32C); err == nil && len(sum) == 4 {
+		info.crc32c = sum
+	}
+	return info, nil
+}
+
+func (b *gcsBackend) get(ctx context.Context, bucket, key string, info objectInfo, start, end int64) (*http.Response, error) {
+	target := b.objectURL(bucket, key) + "?alt=media&generation=" + url.QueryEscape(info.version)
+	resp, err := b.do(ctx, target, http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", start, end)}})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, statusError(resp)
+	}
+	return resp, nil
+}
+
+func (b *gcsBackend) do(ctx context.Context, target string, header http.Header) (*http.Response, error) {
+	token, err := b.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return b.client.Do(req)
+}
+
+func (b *gcsBackend) objectURL(bucket, key string) string {
+	return b.endpoint() + "/storage/v1/b/" + url.PathEscape(bucket) + "/o/" + url.PathEscape(key)
+}
+
+func (b *gcsBackend) endpoint() string {
+	host := os.Getenv("STORAGE_EMULATOR_HOST")
+	if host == "" {
+		return gcsEndpoint
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// accessToken returns the bearer token to send, or "" for anonymous requests
+func (b *gcsBackend) accessToken(ctx context.Context) (string, error) {
+	if os.Getenv("STORAGE_EMULATOR_HOST") != "" {
+		return "", nil
+	}
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.token != "" && time.Until(b.expires) > 5*time.Minute {
+		return b.token, nil
+	}
+	if b.probed && b.token == "" {
+		return "", nil
+	}
+	b.probed = true
+
+	var token string
+	var lifetime time.Duration
+	var err error
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		token, lifetime, err = b.fileToken(ctx, path)
+	} else {
+		token, lifetime, err = b.metadataToken(ctx)
+		if err != nil && b.token == "" {
+			// Not on GCE: fall back to anonymous requests
+			return "", nil
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get Google credentials: %w", err)
+	}
+	b.token, b.expires = token, time.Now().Add(lifetime)
+	return token, nil
+}
+
+// metadataToken asks the GCE metadata server for the default service account's token
+func (b *gcsBackend) metadataToken(ctx context.Context) (string, time.Duration, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = gceMetadataHost
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+gceMetadataTokenURL, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return tokenResponse(b.metadata, req)
+}
+
+// fileToken exchanges a credentials file for a token: a service account key signs a
+// JWT assertion, application default credentials use their refresh token
+func (b *gcsBackend) fileToken(ctx context.Context, path string) (string, time.Duration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", 0, err
+	}
+	var file struct {
+		Type         string `json:"type"`
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		TokenURI     string `json:"token_uri"`
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return "", 0, fmt.Errorf("invalid credentials file %s: %w", path, err)
+	}
+	tokenURI := file.TokenURI
+	if tokenURI == "" {
+		tokenURI = googleTokenURL
+	}
+
+	form := url.Values{}
+	switch file.Type {
+	case "service_account":
+		assertion, err := signAssertion(file.ClientEmail, file.PrivateKey, tokenURI, time.Now())
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid credentials file %s: %w", path, err)
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", file.ClientID)
+		form.Set("client_secret", file.ClientSecret)
+		form.Set("refresh_token", file.RefreshToken)
+	default:
+		return "", 0, fmt.Errorf("unsupported credentials type %q in %s", file.Type, path)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return tokenResponse(b.client, req)
+}
+
+// tokenResponse sends an OAuth token request and reads the token and its lifetime
+func tokenResponse(client *http.Client, req *http.Request) (string, time.Duration, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, statusError(resp)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&token); err != nil {
+		return "", 0, fmt.Errorf("invalid token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", 0, fmt.Errorf("token response has no access token")
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
+
+// signAssertion builds the RS256 JWT a service account exchanges for a token
+func signAssertion(email, privateKey, audience string, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return "", fmt.Errorf("private key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("invalid private key: %w", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("private key is not an RSA key")
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iss":   email,
+		"scope": gcsReadOnlyScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,269 @@
+// Package objectstore downloads datasets from S3 (s3://bucket/key) and Google Cloud
+// Storage (gs://bucket/object) into a local cache directory, using only the standard
+// library. Objects are fetched in ranged chunks pinned to one version of the object,
+// retried chunk by chunk, and checked against the checksum the store records.
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ip-geolocation-service/internal/retry"
+)
+
+// Download tuning
+const (
+	// DefaultChunkSize is the size of each ranged request
+	DefaultChunkSize = 16 << 20
+	// requestTimeout bounds one request, including reading a chunk
+	requestTimeout = 5 * time.Minute
+)
+
+// chunkRetry repeats metadata and chunk requests that fail transiently
+var chunkRetry = retry.Policy{
+	MaxAttempts:     3,
+	InitialInterval: 500 * time.Millisecond,
+	MaxInterval:     5 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+var (
+	// ErrNotFound is returned (wrapped) when the object doesn't exist
+	ErrNotFound = errors.New("object not found")
+	// ErrChecksum is returned (wrapped) when a download doesn't match the store's checksum
+	ErrChecksum = errors.New("object checksum mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// IsURL reports whether path names an object in a supported store
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "gs://")
+}
+
+// objectInfo describes one version of an object. Checksums the store doesn't
+// provide are nil.
+type objectInfo struct {
+	size     int64
+	version  string    // ETag or generation the ranged requests are pinned to
+	modified time.Time // When the object was last written, zero if unknown
+	md5      []byte
+	sha256   []byte
+	crc32c   []byte
+}
+
+// backend is an object store's API
+type backend interface {
+	// stat returns the current version of an object
+	stat(ctx context.Context, bucket, key string) (objectInfo, error)
+	// get requests bytes [start, end] of that version; the response must be 206
+	get(ctx context.Context, bucket, key string, info objectInfo, start, end int64) (*http.Response, error)
+}
+
+// Downloader fetches objects into a cache directory. A cached object is reused while
+// the store still holds the same version and the file still matches its checksum.
+type Downloader struct {
+	dir       string
+	chunkSize int64
+
+	s3  *s3Backend
+	gcs *gcsBackend
+}
+
+// NewDownloader creates a downloader caching objects under dir, fetching through
+// transport (nil uses http.DefaultTransport). Credentials are read from the
+// environment or the instance's metadata service when first needed.
+func NewDownloader(dir string, transport http.RoundTripper) *Downloader {
+	client := &http.Client{Timeout: requestTimeout, Transport: transport}
+	return &Downloader{
+		dir:       dir,
+		chunkSize: DefaultChunkSize,
+		s3:        newS3Backend(client),
+		gcs:       newGCSBackend(client),
+	}
+}
+
+// LocalPath returns where url is cached. Objects under the same prefix share a
+// directory, so companions such as data.csv.sig sit next to data.csv.
+func (d *Downloader) LocalPath(url string) (string, error) {
+	scheme, bucket, key, err := parseURL(url)
+	if err != nil {
+		return "", err
+	}
+	prefix := sha256.Sum256([]byte(scheme + "://" + bucket + "/" + path.Dir(key)))
+	return filepath.Join(d.dir, hex.EncodeToString(prefix[:8]), path.Base(key)), nil
+}
+
+// Download fetches url into the cache unless the cached copy is current, and returns
+// the local path
+func (d *Downloader) Download(ctx context.Context, url string) (string, error) {
+	scheme, bucket, key, err := parseURL(url)
+	if err != nil {
+		return "", err
+	}
+	local, err := d.LocalPath(url)
+	if err != nil {
+		return "", err
+	}
+	var store backend = d.s3
+	if scheme == "gs" {
+		store = d.gcs
+	}
+
+	var info objectInfo
+	err = retry.Do(ctx, chunkRetry, func(ctx context.Context) (err error) {
+		info, err = store.stat(ctx, bucket, key)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	versionFile := filepath.Join(filepath.Dir(local), "."+filepath.Base(local)+".version")
+	if cached, err := os.ReadFile(versionFile); err == nil && string(cached) == info.version {
+		if file, err := os.Open(local); err == nil {
+			err = verify(file, info)
+			file.Close()
+			if err == nil {
+				return local, nil
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create dataset cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(local), ".download-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	for start := int64(0); start < info.size; start += d.chunkSize {
+		end := min(start+d.chunkSize, info.size) - 1
+		if err := d.fetchChunk(ctx, store, bucket, key, info, tmp, start, end); err != nil {
+			tmp.Close()
+			return "", fmt.Errorf("failed to download %s: %w", url, err)
+		}
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if err := verify(tmp, info); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", url, err)
+	}
+
+	// Drop the old version marker first, so a crash between the two renames never
+	// pairs it with a different file
+	os.Remove(versionFile)
+	if err := os.Rename(tmp.Name(), local); err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if err := os.WriteFile(versionFile, []byte(info.version), 0o644); err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	// The copy is as old as the object, not the download, so the dataset's age holds
+	if !info.modified.IsZero() {
+		os.Chtimes(local, time.Time{}, info.modified)
+	}
+	return local, nil
+}
+
+// fetchChunk writes bytes [start, end] of the object to file at start, retrying
+// transient failures
+func (d *Downloader) fetchChunk(ctx context.Context, store backend, bucket, key string, info objectInfo, file *os.File, start, end int64) error {
+	return retry.Do(ctx, chunkRetry, func(ctx context.Context) error {
+		resp, err := store.get(ctx, bucket, key, info, start, end)
+		if err != nil {
+			return err
+		}
+		if want := fmt.Sprintf("bytes %d-%d/", start, end); !strings.HasPrefix(resp.Header.Get("Content-Range"), want) {
+			resp.Body.Close()
+			return fmt.Errorf("range %d-%d answered with %q", start, end, resp.Header.Get("Content-Range"))
+		}
+		n, err := io.Copy(io.NewOffsetWriter(file, start), io.LimitReader(resp.Body, end-start+1))
+		resp.Body.Close()
+		if err == nil && n != end-start+1 {
+			err = fmt.Errorf("range %d-%d cut short after %d bytes", start, end, n)
+		}
+		// A body that breaks off midway is worth another request, however it broke
+		if err != nil && ctx.Err() == nil {
+			return retry.Transient(err)
+		}
+		return err
+	})
+}
+
+// verify checks r, the whole object, against the size and strongest checksum the
+// store recorded
+func verify(r io.Reader, info objectInfo) error {
+	var h hash.Hash
+	var want []byte
+	switch {
+	case info.sha256 != nil:
+		h, want = sha256.New(), info.sha256
+	case info.md5 != nil:
+		h, want = md5.New(), info.md5
+	case info.crc32c != nil:
+		h, want = crc32.New(castagnoli), info.crc32c
+	default:
+		h = sha256.New()
+	}
+
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return err
+	}
+	if n != info.size {
+		return fmt.Errorf("%w: %d bytes, want %d", ErrChecksum, n, info.size)
+	}
+	if want != nil && !bytes.Equal(h.Sum(nil), want) {
+		return fmt.Errorf("%w: %x, want %x", ErrChecksum, h.Sum(nil), want)
+	}
+	return nil
+}
+
+// parseURL splits s3://bucket/key or gs://bucket/object
+func parseURL(url string) (scheme, bucket, key string, err error) {
+	scheme, rest, ok := strings.Cut(url, "://")
+	if !ok || (scheme != "s3" && scheme != "gs") {
+		return "", "", "", fmt.Errorf("unsupported object URL %s: must start with s3:// or gs://", url)
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", "", fmt.Errorf("invalid object URL %s: must name a bucket and an object", url)
+	}
+	return scheme, bucket, key, nil
+}
+
+// statusError describes an unexpected response, wrapping ErrNotFound for a 404
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w (status 404)", ErrNotFound)
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("object changed during the download (status 412)")
+	}
+	return &retry.StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+}
@@ -0,0 +1,386 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emptySHA256 is the payload hash of a request without a body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Default metadata endpoints for instance credentials
+const (
+	ec2MetadataEndpoint = "http://169.254.169.254"
+	ecsMetadataEndpoint = "http://169.254.170.2"
+)
+
+// awsCredentials sign S3 requests; expires is zero for credentials that don't expire
+type awsCredentials struct {
+	accessKey, secretKey, token string
+	expires                     time.Time
+}
+
+// s3Backend reads objects through the S3 REST API with Signature Version 4. Settings
+// follow the AWS SDKs: AWS_REGION or AWS_DEFAULT_REGION, AWS_ENDPOINT_URL_S3 or
+// AWS_ENDPOINT_URL for S3-compatible stores (addressed path-style), and credentials
+// from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, the ECS container endpoint or the
+// EC2 instance profile. Without credentials requests are unsigned, which public
+// objects allow.
+type s3Backend struct {
+	client   *http.Client
+	metadata *http.Client // Short timeout, so probing off EC2 fails fast
+
+	mu      sync.Mutex
+	creds   *awsCredentials   // Instance credentials, refreshed before they expire
+	probed  bool              // No instance credentials were found
+	regions map[string]string // Bucket regions learned from redirects
+}
+
+func newS3Backend(client *http.Client) *s3Backend {
+	return &s3Backend{
+		client:   client,
+		metadata: &http.Client{Timeout: 2 * time.Second},
+		regions:  make(map[string]string),
+	}
+}
+
+func (b *s3Backend) stat(ctx context.Context, bucket, key string) (objectInfo, error) {
+	header := http.Header{"X-Amz-Checksum-Mode": {"ENABLED"}}
+	resp, err := b.do(ctx, http.MethodHead, bucket, key, header)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return objectInfo{}, statusError(resp)
+	}
+
+	info := objectInfo{version: resp.Header.Get("ETag")}
+	if info.size, err = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err != nil || info.size < 0 {
+		return objectInfo{}, fmt.Errorf("invalid object size %q", resp.Header.Get("Content-Length"))
+	}
+	if info.version == "" {
+		return objectInfo{}, fmt.Errorf("object has no ETag")
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.modified = modified
+	}
+
+	// A full-object SHA-256 is only recorded when the uploader asked for one; composite
+	// checksums of multipart uploads end in -<parts> and can't be checked here
+	if sum := resp.Header.Get("X-Amz-Checksum-Sha256"); sum != "" && !strings.Contains(sum, "-") {
+		if decoded, err := base64.StdEncoding.DecodeString(sum); err == nil && len(decoded) == sha256.Size {
+			info.sha256 = decoded
+		}
+	}
+	// The ETag is the MD5 of the contents for single-part uploads that aren't
+	// encrypted with KMS or customer keys
+	etag := strings.Trim(info.version, `"`)
+	encryption := resp.Header.Get("X-Amz-Server-Side-Encryption")
+	if len(etag) == 32 && !strings.Contains(encryption, "kms") && resp.Header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") == "" {
+		if decoded, err := hex.DecodeString(etag); err == nil {
+			info.md5 = decoded
+		}
+	}
+	return info, nil
+}
+
+func (b *s3Backend) get(ctx context.Context, bucket, key string, info objectInfo, start, end int64) (*http.Response, error) {
+	header := http.Header{
+		"Range":    {fmt.Sprintf("bytes=%d-%d", start, end)},
+		"If-Match": {info.version},
+	}
+	resp, err := b.do(ctx, http.MethodGet, bucket, key, header)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, statusError(resp)
+	}
+	return resp, nil
+}
+
+// do sends a signed request, retrying once in the bucket's region if S3 names a
+// different one
+func (b *s3Backend) do(ctx context.Context, method, bucket, key string, header http.Header) (*http.Response, error) {
+	creds, err := b.credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		region := b.region(bucket)
+		req, err := http.NewRequestWithContext(ctx, method, b.objectURL(bucket, key, region), nil)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if creds != nil {
+			signV4(req, creds, region, time.Now())
+		}
+
+		resp, err := b.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		actual := resp.Header.Get("X-Amz-Bucket-Region")
+		if resp.StatusCode < 300 || actual == "" || actual == region || attempt > 0 {
+			return resp, nil
+		}
+		resp.Body.Close()
+		b.mu.Lock()
+		b.regions[bucket] = actual
+		b.mu.Unlock()
+	}
+}
+
+// region returns the region requests for bucket are signed for
+func (b *s3Backend) region(bucket string) string {
+	b.mu.Lock()
+	region, ok := b.regions[bucket]
+	b.mu.Unlock()
+	if ok {
+		return region
+	}
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(name); region != "" {
+			return region
+		}
+	}
+	return "us-east-1"
+}
+
+// objectURL addresses an object virtual-hosted style on AWS, or path-style on a
+// custom endpoint and for bucket names with dots, which don't match the wildcard
+// certificate
+func (b *s3Backend) objectURL(bucket, key, region string) string {
+	path := "/" + uriEncode(key, false)
+	for _, name := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint := os.Getenv(name); endpoint != "" {
+			return strings.TrimSuffix(endpoint, "/") + "/" + uriEncode(bucket, true) + path
+		}
+	}
+	if strings.Contains(bucket, ".") {
+		return "https://s3." + region + ".amazonaws.com/" + uriEncode(bucket, true) + path
+	}
+	return "https://" + bucket + ".s3." + region + ".amazonaws.com" + path
+}
+
+// credentials returns the credentials to sign with, or nil to send unsigned requests
+func (b *s3Backend) credentials(ctx context.Context) (*awsCredentials, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return &awsCredentials{accessKey: id, secretKey: secret, token: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.creds != nil && time.Until(b.creds.expires) > 5*time.Minute {
+		return b.creds, nil
+	}
+	if b.probed && b.creds == nil {
+		return nil, nil
+	}
+	b.probed = true
+
+	var creds *awsCredentials
+	var err error
+	switch {
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "":
+		creds, err = b.fetchCredentials(ctx, ecsMetadataEndpoint+os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"), http.Header{})
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "":
+		header := http.Header{}
+		if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+			header.Set("Authorization", token)
+		}
+		creds, err = b.fetchCredentials(ctx, os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"), header)
+	case os.Getenv("AWS_EC2_METADATA_DISABLED") != "true":
+		creds, err = b.instanceCredentials(ctx)
+		if err != nil && b.creds == nil {
+			// Not on EC2: fall back to unsigned requests
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AWS credentials: %w", err)
+	}
+	b.creds = creds
+	return creds, nil
+}
+
+// instanceCredentials reads the instance profile's credentials through IMDSv2
+func (b *s3Backend) instanceCredentials(ctx context.Context) (*awsCredentials, error) {
+	endpoint := strings.TrimSuffix(os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = ec2MetadataEndpoint
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+	token, err := b.metadataBody(req)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {token}}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/latest/meta-data/iam/security-credentials/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header.Clone()
+	roles, err := b.metadataBody(req)
+	if err != nil {
+		return nil, err
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(roles), "\n")
+	if role == "" {
+		return nil, fmt.Errorf("instance has no IAM role")
+	}
+	return b.fetchCredentials(ctx, endpoint+"/latest/meta-data/iam/security-credentials/"+url.PathEscape(role), header)
+}
+
+// fetchCredentials reads credentials in the JSON form the ECS and EC2 endpoints share
+func (b *s3Backend) fetchCredentials(ctx context.Context, endpoint string, header http.Header) (*awsCredentials, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	body, err := b.metadataBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err := json.Unmarshal([]byte(body), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid credentials response: %w", err)
+	}
+	if parsed.AccessKeyID == "" || parsed.SecretAccessKey == "" {
+		return nil, fmt.Errorf("credentials response has no access key")
+	}
+	return &awsCredentials{
+		accessKey: parsed.AccessKeyID,
+		secretKey: parsed.SecretAccessKey,
+		token:     parsed.Token,
+		expires:   parsed.Expiration,
+	}, nil
+}
+
+// metadataBody sends a metadata request and returns its body
+func (b *s3Backend) metadataBody(req *http.Request) (string, error) {
+	resp, err := b.metadata.Do(req)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(resp)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return string(body), err
+}
+
+// signV4 signs req with AWS Signature Version 4 for S3, covering the host and every
+// header already set. The payload is always empty.
+func signV4(req *http.Request, creds *awsCredentials, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	if creds.token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.token)
+	}
+
+	names := []string{"host"}
+	values := map[string]string{"host": req.URL.Host}
+	for name, value := range req.Header {
+		lower := strings.ToLower(name)
+		names = append(names, lower)
+		values[lower] = strings.TrimSpace(strings.Join(value, ","))
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + values[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			params = append(params, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.Join(params, "&"),
+		headers.String(),
+		signed,
+		emptySHA256,
+	}, "\n")
+	hashed := sha256.Sum256([]byte(canonical))
+	scope := date + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.accessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode percent-encodes s as SigV4 requires: everything but unreserved
+// characters, and slashes too when encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
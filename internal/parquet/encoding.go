@@ -0,0 +1,123 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// readHybrid decodes n values of bitWidth bits written with the RLE/bit-packed hybrid
+// encoding used for definition levels and dictionary indices
+func readHybrid(src []byte, bitWidth, n int) ([]uint32, error) {
+	if bitWidth < 0 || bitWidth > 32 {
+		return nil, fmt.Errorf("%w: invalid bit width %d", ErrInvalidFile, bitWidth)
+	}
+	values := make([]uint32, 0, min(n, 1<<16))
+	byteWidth := (bitWidth + 7) / 8
+	for len(values) < n {
+		header, read := binary.Uvarint(src)
+		if read <= 0 {
+			return nil, fmt.Errorf("%w: truncated run", ErrInvalidFile)
+		}
+		src = src[read:]
+
+		if header&1 == 0 {
+			// RLE run: one value repeated
+			count := header >> 1
+			if len(src) < byteWidth {
+				return nil, fmt.Errorf("%w: truncated run", ErrInvalidFile)
+			}
+			var v uint32
+			for i := 0; i < byteWidth; i++ {
+				v |= uint32(src[i]) << (8 * i)
+			}
+			src = src[byteWidth:]
+			for ; count > 0 && len(values) < n; count-- {
+				values = append(values, v)
+			}
+			continue
+		}
+
+		// Bit-packed run: groups of 8 values, least significant bit first
+		groups := header >> 1
+		if groups > uint64(len(src)) {
+			return nil, fmt.Errorf("%w: truncated run", ErrInvalidFile)
+		}
+		size := int(groups) * bitWidth
+		if len(src) < size {
+			return nil, fmt.Errorf("%w: truncated run", ErrInvalidFile)
+		}
+		packed := src[:size]
+		src = src[size:]
+		for i := 0; i < int(groups)*8 && len(values) < n; i++ {
+			var v uint32
+			bit := i * bitWidth
+			for b := 0; b < bitWidth; b++ {
+				if packed[(bit+b)/8]&(1<<((bit+b)%8)) != 0 {
+					v |= 1 << b
+				}
+			}
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// readPlain decodes n plain encoded values of a physical type as text
+func readPlain(src []byte, typ, typeLength int32, n int) ([]string, error) {
+	values := make([]string, 0, min(n, len(src)*8))
+	truncated := fmt.Errorf("%w: truncated values", ErrInvalidFile)
+	for i := 0; i < n; i++ {
+		switch typ {
+		case typeBoolean:
+			if i/8 >= len(src) {
+				return nil, truncated
+			}
+			values = append(values, strconv.FormatBool(src[i/8]&(1<<(i%8)) != 0))
+		case typeInt32:
+			if len(src) < 4 {
+				return nil, truncated
+			}
+			values = append(values, strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(src))), 10))
+			src = src[4:]
+		case typeInt64:
+			if len(src) < 8 {
+				return nil, truncated
+			}
+			values = append(values, strconv.FormatInt(int64(binary.LittleEndian.Uint64(src)), 10))
+			src = src[8:]
+		case typeFloat:
+			if len(src) < 4 {
+				return nil, truncated
+			}
+			values = append(values, strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(src))), 'f', -1, 32))
+			src = src[4:]
+		case typeDoubleValue:
+			if len(src) < 8 {
+				return nil, truncated
+			}
+			values = append(values, strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(src)), 'f', -1, 64))
+			src = src[8:]
+		case typeByteArray:
+			if len(src) < 4 {
+				return nil, truncated
+			}
+			length := binary.LittleEndian.Uint32(src)
+			if uint64(length) > uint64(len(src)-4) {
+				return nil, truncated
+			}
+			values = append(values, string(src[4:4+length]))
+			src = src[4+length:]
+		case typeFixedLenByteArray:
+			if typeLength < 0 || int(typeLength) > len(src) {
+				return nil, truncated
+			}
+			values = append(values, string(src[:typeLength]))
+			src = src[typeLength:]
+		default:
+			return nil, fmt.Errorf("%w: physical type %d", ErrUnsupported, typ)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,308 @@
+package parquet
+
+// Physical types
+const (
+	typeBoolean           = 0
+	typeInt32             = 1
+	typeInt64             = 2
+	typeInt96             = 3
+	typeFloat             = 4
+	typeDoubleValue       = 5
+	typeByteArray         = 6
+	typeFixedLenByteArray = 7
+)
+
+// Repetition types
+const (
+	repetitionRequired = 0
+	repetitionOptional = 1
+	repetitionRepeated = 2
+)
+
+// Compression codecs
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+	codecZstd         = 6
+)
+
+// Page types
+const (
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+// Value encodings
+const (
+	encodingPlain         = 0
+	encodingPlainDict     = 2
+	encodingRLE           = 3
+	encodingRLEDictionary = 8
+)
+
+// fileMetaData is the part of a file's footer the reader uses
+type fileMetaData struct {
+	schema    []schemaElement
+	numRows   int64
+	rowGroups []rowGroup
+}
+
+type schemaElement struct {
+	typ         int32
+	typeLength  int32
+	repetition  int32
+	name        string
+	numChildren int32
+}
+
+type rowGroup struct {
+	columns []columnChunk
+	numRows int64
+}
+
+type columnChunk struct {
+	filePath string // Set when the chunk lives in another file, which isn't supported
+	meta     columnMetaData
+}
+
+type columnMetaData struct {
+	typ                  int32
+	codec                int32
+	numValues            int64
+	totalCompressedSize  int64
+	dataPageOffset       int64
+	dictionaryPageOffset int64
+	stats                ColumnStats
+}
+
+type pageHeader struct {
+	typ              int32
+	uncompressedSize int32
+	compressedSize   int32
+	data             dataPageHeader
+	dictionary       dictionaryPageHeader
+	dataV2           dataPageHeaderV2
+}
+
+type dataPageHeader struct {
+	numValues int32
+	encoding  int32
+}
+
+type dictionaryPageHeader struct {
+	numValues int32
+	encoding  int32
+}
+
+type dataPageHeaderV2 struct {
+	numValues        int32
+	numNulls         int32
+	encoding         int32
+	defLevelsLength  int32
+	repLevelsLength  int32
+	valuesCompressed bool
+}
+
+func readFileMetaData(t *thriftReader) (*fileMetaData, error) {
+	meta := &fileMetaData{}
+	err := t.fields(func(id int16, typ byte) (err error) {
+		switch {
+		case id == 2 && typ == typeList:
+			return t.list(func(byte) error {
+				element, err := readSchemaElement(t)
+				meta.schema = append(meta.schema, element)
+				return err
+			})
+		case id == 3 && typ == typeI64:
+			meta.numRows, err = t.i64()
+		case id == 4 && typ == typeList:
+			return t.list(func(byte) error {
+				group, err := readRowGroup(t)
+				meta.rowGroups = append(meta.rowGroups, group)
+				return err
+			})
+		default:
+			return t.skip(typ)
+		}
+		return err
+	})
+	return meta, err
+}
+
+func readSchemaElement(t *thriftReader) (schemaElement, error) {
+	element := schemaElement{typ: -1, repetition: repetitionRequired}
+	err := t.fields(func(id int16, typ byte) (err error) {
+		switch {
+		case id == 1 && typ == typeI32:
+			element.typ, err = t.i32()
+		case id == 2 && typ == typeI32:
+			element.typeLength, err = t.i32()
+		case id == 3 && typ == typeI32:
+			element.repetition, err = t.i32()
+		case id == 4 && typ == typeBinary:
+			element.name, err = t.string()
+		case id == 5 && typ == typeI32:
+			element.numChildren, err = t.i32()
+		default:
+			return t.skip(typ)
+		}
+		return err
+	})
+	return element, err
+}
+
+func readRowGroup(t *thriftReader) (rowGroup, error) {
+	var group rowGroup
+	err := t.fields(func(id int16, typ byte) (err error) {
+		switch {
+		case id == 1 && typ == typeList:
+			return t.list(func(byte) error {
+				chunk, err := readColumnChunk(t)
+				group.columns = append(group.columns, chunk)
+				return err
+			})
+		case id == 3 && typ == typeI64:
+			group.numRows, err = t.i64()
+		default:
+			return t.skip(typ)
+		}
+		return err
+	})
+	return group, err
+}
+
+func readColumnChunk(t *thriftReader) (columnChunk, error) {
+	var chunk columnChunk
+	err := t.fields(func(id int16, typ byte) (err error) {
+		switch {
+		case id == 1 && typ == typeBinary:
+			chunk.filePath, err = t.string()
+		case id == 3 && typ == typeStruct:
+			chunk.meta, err = readColumnMetaData(t)
+		default:
+			return t.skip(typ)
+		}
+		return err
+	})
+	return chunk, err
+}
+
+func readColumnMetaData(t *thriftReader) (columnMetaData, error) {
+	var meta columnMetaData
+	err := t.fields(func(id int16, typ byte) (err error) {
+		switch {
+		case id == 1 && typ == typeI32:
+			meta.typ, err = t.i32()
+		case id == 4 && typ == typeI32:
+			meta.codec, err = t.i32()
+		case id == 5 && typ == typeI64:
+			meta.numValues, err = t.i64()
+		case id == 7 && typ == typeI64:
+			meta.totalCompressedSize, err = t.i64()
+		case id == 9 && typ == typeI64:
+			meta.dataPageOffset, err = t.i64()
+		case id == 11 && typ == typeI64:
+			meta.dictionaryPageOffset, err = t.i64()
+		case id == 12 && typ == typeStruct:
+			meta.stats, err = readStatistics(t)
+		default:
+			return t.skip(typ)
+		}
+		return err
+	})
+	return meta, err
+}
+
+// readStatistics reads column statistics, preferring min_value and max_value over
+// the deprecated min and max, whose ordering was unreliable
+func readStatistics(t *thriftReader) (ColumnStats, error) {
+	var stats ColumnStats
+	var oldMin, oldMax []byte
+	err := t.fields(func(id int16, typ byte) (err error) {
+		switch {
+		case id == 1 && typ == typeBinary:
+			oldMax, err = t.binary()
+		case id == 2 && typ == typeBinary:
+			oldMin, err = t.binary()
+		case id == 3 && typ == typeI64:
+			stats.Nulls, err = t.i64()
+			stats.HasNulls = true
+		case id == 5 && typ == typeBinary:
+			stats.Max, err = t.binary()
+		case id == 6 && typ == typeBinary:
+			stats.Min, err = t.binary()
+		default:
+			return t.skip(typ)
+		}
+		return err
+	})
+	if stats.Min == nil && stats.Max == nil {
+		stats.Min, stats.Max = oldMin, oldMax
+	}
+	return stats, err
+}
+
+func readPageHeader(t *thriftReader) (pageHeader, error) {
+	header := pageHeader{dataV2: dataPageHeaderV2{valuesCompressed: true}}
+	err := t.fields(func(id int16, typ byte) (err error) {
+		switch {
+		case id == 1 && typ == typeI32:
+			header.typ, err = t.i32()
+		case id == 2 && typ == typeI32:
+			header.uncompressedSize, err = t.i32()
+		case id == 3 && typ == typeI32:
+			header.compressedSize, err = t.i32()
+		case id == 5 && typ == typeStruct:
+			return t.fields(func(id int16, typ byte) (err error) {
+				switch {
+				case id == 1 && typ == typeI32:
+					header.data.numValues, err = t.i32()
+				case id == 2 && typ == typeI32:
+					header.data.encoding, err = t.i32()
+				default:
+					return t.skip(typ)
+				}
+				return err
+			})
+		case id == 7 && typ == typeStruct:
+			return t.fields(func(id int16, typ byte) (err error) {
+				switch {
+				case id == 1 && typ == typeI32:
+					header.dictionary.numValues, err = t.i32()
+				case id == 2 && typ == typeI32:
+					header.dictionary.encoding, err = t.i32()
+				default:
+					return t.skip(typ)
+				}
+				return err
+			})
+		case id == 8 && typ == typeStruct:
+			v2 := &header.dataV2
+			return t.fields(func(id int16, typ byte) (err error) {
+				switch {
+				case id == 1 && typ == typeI32:
+					v2.numValues, err = t.i32()
+				case id == 2 && typ == typeI32:
+					v2.numNulls, err = t.i32()
+				case id == 4 && typ == typeI32:
+					v2.encoding, err = t.i32()
+				case id == 5 && typ == typeI32:
+					v2.defLevelsLength, err = t.i32()
+				case id == 6 && typ == typeI32:
+					v2.repLevelsLength, err = t.i32()
+				case id == 7 && (typ == typeTrue || typ == typeFalse):
+					v2.valuesCompressed = typ == typeTrue
+				default:
+					return t.skip(typ)
+				}
+				return err
+			})
+		default:
+			return t.skip(typ)
+		}
+		return err
+	})
+	return header, err
+}
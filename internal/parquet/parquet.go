@@ -0,0 +1,384 @@
+// Package parquet reads Apache Parquet files with a flat schema, such as datasets
+// exported from Spark or Athena, using only the standard library. Pages may be
+// uncompressed or compressed with snappy, gzip or zstd, and plain or dictionary
+// encoded; nested and repeated columns aren't supported.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"ip-geolocation-service/internal/zstd"
+)
+
+// Reader bounds
+const (
+	// maxFooterBytes bounds the file metadata read from the footer
+	maxFooterBytes = 64 << 20
+	// maxPageBytes bounds a decompressed page
+	maxPageBytes = 256 << 20
+	// maxPageValues bounds the values a page may claim
+	maxPageValues = 1 << 26
+)
+
+var (
+	// ErrInvalidFile is returned (wrapped) for files that aren't valid parquet
+	ErrInvalidFile = errors.New("invalid parquet file")
+	// ErrUnsupported is returned (wrapped) for valid files using features this reader lacks
+	ErrUnsupported = errors.New("unsupported parquet feature")
+)
+
+var magic = []byte("PAR1")
+
+// ColumnStats are the statistics a row group records for a column. Min and Max are
+// in the column's plain encoding (the bytes themselves for strings) and may be nil.
+type ColumnStats struct {
+	Rows     int64
+	Nulls    int64
+	HasNulls bool // Nulls is known
+	Min, Max []byte
+}
+
+// File is an open parquet file
+type File struct {
+	r       io.ReaderAt
+	size    int64
+	meta    *fileMetaData
+	columns []schemaElement // Leaf columns, in row group order
+}
+
+// Open reads the footer of a parquet file of the given size
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	if size < int64(2*len(magic)+4) {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidFile)
+	}
+	tail := make([]byte, 4+len(magic))
+	if _, err := r.ReadAt(tail, size-int64(len(tail))); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	head := make([]byte, len(magic))
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	if !bytes.Equal(head, magic) || !bytes.Equal(tail[4:], magic) {
+		return nil, fmt.Errorf("%w: missing PAR1 magic", ErrInvalidFile)
+	}
+
+	footerLength := int64(binary.LittleEndian.Uint32(tail))
+	if footerLength > size-int64(len(head)+len(tail)) || footerLength > maxFooterBytes {
+		return nil, fmt.Errorf("%w: footer length %d", ErrInvalidFile, footerLength)
+	}
+	footer := make([]byte, footerLength)
+	if _, err := r.ReadAt(footer, size-int64(len(tail))-footerLength); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	meta, err := readFileMetaData(&thriftReader{buf: footer})
+	if err != nil {
+		return nil, err
+	}
+
+	// A flat schema is the root followed by its leaf columns
+	if len(meta.schema) == 0 || int(meta.schema[0].numChildren) != len(meta.schema)-1 {
+		return nil, fmt.Errorf("%w: nested schemas", ErrUnsupported)
+	}
+	columns := meta.schema[1:]
+	for _, column := range columns {
+		if column.numChildren > 0 {
+			return nil, fmt.Errorf("%w: nested column %s", ErrUnsupported, column.name)
+		}
+	}
+	for i, group := range meta.rowGroups {
+		if len(group.columns) != len(columns) {
+			return nil, fmt.Errorf("%w: row group %d has %d columns, the schema %d", ErrInvalidFile, i, len(group.columns), len(columns))
+		}
+	}
+
+	return &File{r: r, size: size, meta: meta, columns: columns}, nil
+}
+
+// NumRows returns the number of rows in the file
+func (f *File) NumRows() int64 {
+	return f.meta.numRows
+}
+
+// RowGroups returns the number of row groups in the file
+func (f *File) RowGroups() int {
+	return len(f.meta.rowGroups)
+}
+
+// Columns returns the names of the file's columns
+func (f *File) Columns() []string {
+	names := make([]string, len(f.columns))
+	for i, column := range f.columns {
+		names[i] = column.name
+	}
+	return names
+}
+
+// ReadRows calls fn with the values of the named columns (matched ignoring case) for
+// every row, one row group at a time, so only one row group of the selected columns
+// is in memory. Values are text: numbers in their shortest form, booleans as true
+// or false, nulls as empty strings. row is only valid during the call.
+//
+// If skip is set it is called with the statistics of the first named column in each
+// row group, and row groups it returns true for aren't read at all.
+func (f *File) ReadRows(names []string, skip func(ColumnStats) bool, fn func(row []string) error) error {
+	indices := make([]int, len(names))
+	for i, name := range names {
+		indices[i] = -1
+		for j, column := range f.columns {
+			if strings.EqualFold(column.name, name) {
+				indices[i] = j
+				break
+			}
+		}
+		if indices[i] < 0 {
+			return fmt.Errorf("%w: no column %q", ErrInvalidFile, name)
+		}
+		if f.columns[indices[i]].repetition == repetitionRepeated {
+			return fmt.Errorf("%w: repeated column %s", ErrUnsupported, name)
+		}
+	}
+
+	row := make([]string, len(names))
+	for g, group := range f.meta.rowGroups {
+		if len(indices) > 0 && skip != nil {
+			stats := group.columns[indices[0]].meta.stats
+			stats.Rows = group.numRows
+			if skip(stats) {
+				continue
+			}
+		}
+
+		values := make([][]string, len(indices))
+		for i, idx := range indices {
+			column, err := f.readColumn(f.columns[idx], group.columns[idx], group.numRows)
+			if err != nil {
+				return fmt.Errorf("row group %d, column %s: %w", g, f.columns[idx].name, err)
+			}
+			values[i] = column
+		}
+
+		for r := int64(0); r < group.numRows; r++ {
+			for i := range values {
+				row[i] = values[i][r]
+			}
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readColumn decodes a column chunk into one value per row
+func (f *File) readColumn(column schemaElement, chunk columnChunk, rows int64) ([]string, error) {
+	meta := chunk.meta
+	if chunk.filePath != "" {
+		return nil, fmt.Errorf("%w: column data in another file", ErrUnsupported)
+	}
+	if meta.numValues != rows {
+		return nil, fmt.Errorf("%w: %d values for %d rows", ErrInvalidFile, meta.numValues, rows)
+	}
+
+	start := meta.dataPageOffset
+	if meta.dictionaryPageOffset > 0 && meta.dictionaryPageOffset < start {
+		start = meta.dictionaryPageOffset
+	}
+	if start < int64(len(magic)) || meta.totalCompressedSize <= 0 || meta.totalCompressedSize > f.size-start {
+		return nil, fmt.Errorf("%w: column chunk out of bounds", ErrInvalidFile)
+	}
+	data := make([]byte, meta.totalCompressedSize)
+	if _, err := f.r.ReadAt(data, start); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+
+	optional := column.repetition == repetitionOptional
+	values := make([]string, 0, min(rows, 1<<16))
+	var dictionary []string
+	t := &thriftReader{buf: data}
+	for int64(len(values)) < rows {
+		header, err := readPageHeader(t)
+		if err != nil {
+			return nil, err
+		}
+		if header.compressedSize < 0 || int(header.compressedSize) > len(data)-t.pos {
+			return nil, fmt.Errorf("%w: page out of bounds", ErrInvalidFile)
+		}
+		page := data[t.pos : t.pos+int(header.compressedSize)]
+		t.pos += int(header.compressedSize)
+
+		switch header.typ {
+		case pageDictionary:
+			if header.dictionary.encoding != encodingPlain && header.dictionary.encoding != encodingPlainDict {
+				return nil, fmt.Errorf("%w: dictionary encoding %d", ErrUnsupported, header.dictionary.encoding)
+			}
+			if header.dictionary.numValues < 0 || header.dictionary.numValues > maxPageValues {
+				return nil, fmt.Errorf("%w: dictionary of %d values", ErrInvalidFile, header.dictionary.numValues)
+			}
+			plain, err := decompress(meta.codec, page, header.uncompressedSize)
+			if err != nil {
+				return nil, err
+			}
+			if dictionary, err = readPlain(plain, column.typ, column.typeLength, int(header.dictionary.numValues)); err != nil {
+				return nil, err
+			}
+		case pageData:
+			plain, err := decompress(meta.codec, page, header.uncompressedSize)
+			if err != nil {
+				return nil, err
+			}
+			n := int(header.data.numValues)
+			var defLevels []byte
+			if optional {
+				if len(plain) < 4 {
+					return nil, fmt.Errorf("%w: truncated definition levels", ErrInvalidFile)
+				}
+				length := binary.LittleEndian.Uint32(plain)
+				if uint64(length) > uint64(len(plain)-4) {
+					return nil, fmt.Errorf("%w: truncated definition levels", ErrInvalidFile)
+				}
+				defLevels, plain = plain[4:4+length], plain[4+length:]
+			}
+			if values, err = appendPage(values, column, dictionary, header.data.encoding, defLevels, plain, n, rows); err != nil {
+				return nil, err
+			}
+		case pageDataV2:
+			v2 := header.dataV2
+			if v2.repLevelsLength != 0 {
+				return nil, fmt.Errorf("%w: repetition levels", ErrUnsupported)
+			}
+			if v2.defLevelsLength < 0 || int(v2.defLevelsLength) > len(page) {
+				return nil, fmt.Errorf("%w: truncated definition levels", ErrInvalidFile)
+			}
+			defLevels, rest := page[:v2.defLevelsLength], page[v2.defLevelsLength:]
+			plain := rest
+			if v2.valuesCompressed {
+				if plain, err = decompress(meta.codec, rest, header.uncompressedSize-v2.defLevelsLength); err != nil {
+					return nil, err
+				}
+			}
+			if !optional {
+				defLevels = nil
+			}
+			if values, err = appendPage(values, column, dictionary, v2.encoding, defLevels, plain, int(v2.numValues), rows); err != nil {
+				return nil, err
+			}
+		default:
+			// Index pages and unknown page types carry no values
+		}
+	}
+	return values, nil
+}
+
+// appendPage decodes the n values of a data page onto values. defLevels is nil for
+// required columns; otherwise level 0 marks a null.
+func appendPage(values []string, column schemaElement, dictionary []string, encoding int32, defLevels, data []byte, n int, rows int64) ([]string, error) {
+	if n < 0 || n > maxPageValues || int64(len(values)+n) > rows {
+		return nil, fmt.Errorf("%w: page of %d values", ErrInvalidFile, n)
+	}
+
+	present := n
+	var levels []uint32
+	if defLevels != nil {
+		var err error
+		if levels, err = readHybrid(defLevels, 1, n); err != nil {
+			return nil, err
+		}
+		present = 0
+		for _, level := range levels {
+			present += int(level)
+		}
+	}
+
+	var decoded []string
+	switch encoding {
+	case encodingPlain:
+		var err error
+		if decoded, err = readPlain(data, column.typ, column.typeLength, present); err != nil {
+			return nil, err
+		}
+	case encodingPlainDict, encodingRLEDictionary:
+		if present == 0 {
+			break
+		}
+		if dictionary == nil {
+			return nil, fmt.Errorf("%w: dictionary page missing", ErrInvalidFile)
+		}
+		if len(data) < 1 {
+			return nil, fmt.Errorf("%w: truncated dictionary indices", ErrInvalidFile)
+		}
+		indices, err := readHybrid(data[1:], int(data[0]), present)
+		if err != nil {
+			return nil, err
+		}
+		decoded = make([]string, present)
+		for i, idx := range indices {
+			if int(idx) >= len(dictionary) {
+				return nil, fmt.Errorf("%w: dictionary index %d out of range", ErrInvalidFile, idx)
+			}
+			decoded[i] = dictionary[idx]
+		}
+	default:
+		return nil, fmt.Errorf("%w: encoding %d", ErrUnsupported, encoding)
+	}
+
+	if levels == nil {
+		return append(values, decoded...), nil
+	}
+	next := 0
+	for _, level := range levels {
+		if level == 0 {
+			values = append(values, "")
+			continue
+		}
+		values = append(values, decoded[next])
+		next++
+	}
+	return values, nil
+}
+
+// decompress returns the uncompressed contents of a page
+func decompress(codec int32, page []byte, size int32) ([]byte, error) {
+	if size < 0 || size > maxPageBytes {
+		return nil, fmt.Errorf("%w: page of %d bytes", ErrInvalidFile, size)
+	}
+
+	var out []byte
+	switch codec {
+	case codecUncompressed:
+		out = page
+	case codecSnappy:
+		var err error
+		if out, err = snappyDecode(page, int(size)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+	case codecGzip, codecZstd:
+		var r io.Reader
+		if codec == codecGzip {
+			gz, err := gzip.NewReader(bytes.NewReader(page))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+			}
+			r = gz
+		} else {
+			r = zstd.NewReader(bytes.NewReader(page))
+		}
+		out = make([]byte, size)
+		if _, err := io.ReadFull(r, out); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: compression codec %d", ErrUnsupported, codec)
+	}
+
+	if len(out) != int(size) {
+		return nil, fmt.Errorf("%w: page is %d bytes, expected %d", ErrInvalidFile, len(out), size)
+	}
+	return out, nil
+}
@@ -0,0 +1,597 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// thriftWriter writes the Thrift compact protocol, enough to build test files
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16
+}
+
+func (w *thriftWriter) uvarint(v uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (w *thriftWriter) zigzag(v int64) {
+	w.uvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (w *thriftWriter) begin() {
+	w.last = append(w.last, 0)
+}
+
+func (w *thriftWriter) end() {
+	w.buf.WriteByte(typeStop)
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, typeI32)
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, typeI64)
+	w.zigzag(v)
+}
+
+func (w *thriftWriter) binary(id int16, b []byte) {
+	w.field(id, typeBinary)
+	w.uvarint(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *thriftWriter) bool(id int16, v bool) {
+	if v {
+		w.field(id, typeTrue)
+	} else {
+		w.field(id, typeFalse)
+	}
+}
+
+func (w *thriftWriter) list(id int16, elem byte, size int) {
+	w.field(id, typeList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elem)
+		return
+	}
+	w.buf.WriteByte(0xf0 | elem)
+	w.uvarint(uint64(size))
+}
+
+func (w *thriftWriter) structField(id int16) {
+	w.field(id, typeStruct)
+	w.begin()
+}
+
+// testColumn is a column of a test file; with optional set, "" is null
+type testColumn struct {
+	name       string
+	typ        int32
+	optional   bool
+	dictionary bool
+	values     []string
+}
+
+type testOptions struct {
+	codec     int32
+	v2        bool
+	groupRows int // Rows per row group; all rows in one group when 0
+}
+
+func encodePlain(t *testing.T, typ int32, values []string) []byte {
+	t.Helper()
+	var out []byte
+	for i, v := range values {
+		switch typ {
+		case typeBoolean:
+			if i%8 == 0 {
+				out = append(out, 0)
+			}
+			if v == "true" {
+				out[len(out)-1] |= 1 << (i % 8)
+			}
+		case typeInt32:
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = binary.LittleEndian.AppendUint32(out, uint32(n))
+		case typeInt64:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = binary.LittleEndian.AppendUint64(out, uint64(n))
+		case typeDoubleValue:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = binary.LittleEndian.AppendUint64(out, math.Float64bits(f))
+		case typeByteArray:
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(v)))
+			out = append(out, v...)
+		default:
+			t.Fatalf("unsupported test type %d", typ)
+		}
+	}
+	return out
+}
+
+// encodeRuns writes values as RLE runs
+func encodeRuns(values []uint32, bitWidth int) []byte {
+	var out []byte
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		for b := 0; b < (bitWidth+7)/8; b++ {
+			out = append(out, byte(values[i]>>(8*b)))
+		}
+		i = j
+	}
+	return out
+}
+
+// encodePacked writes values as a single bit-packed run
+func encodePacked(values []uint32, bitWidth int) []byte {
+	groups := (len(values) + 7) / 8
+	out := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups*bitWidth)
+	for i, v := range values {
+		for b := 0; b < bitWidth; b++ {
+			if v&(1<<b) != 0 {
+				bit := i*bitWidth + b
+				packed[bit/8] |= 1 << (bit % 8)
+			}
+		}
+	}
+	return append(out, packed...)
+}
+
+// snappyLiterals encodes data as a snappy block of literals
+func snappyLiterals(data []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		n := min(len(data), 256)
+		if n <= 60 {
+			out = append(out, byte(n-1)<<2)
+		} else {
+			out = append(out, 60<<2, byte(n-1))
+		}
+		out = append(out, data[:n]...)
+		data = data[n:]
+	}
+	return out
+}
+
+func compressPage(t *testing.T, codec int32, data []byte) []byte {
+	t.Helper()
+	switch codec {
+	case codecUncompressed:
+		return data
+	case codecSnappy:
+		return snappyLiterals(data)
+	case codecGzip:
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	t.Fatalf("unsupported test codec %d", codec)
+	return nil
+}
+
+// writeTestFile builds a parquet file with the columns, in the layout Spark writes:
+// every column chunk is an optional dictionary page followed by one data page
+func writeTestFile(t *testing.T, columns []testColumn, opts testOptions) []byte {
+	t.Helper()
+	rows := len(columns[0].values)
+	groupRows := opts.groupRows
+	if groupRows == 0 {
+		groupRows = max(rows, 1)
+	}
+
+	file := bytes.NewBufferString("PAR1")
+	type chunkInfo struct {
+		offset, dictOffset, size int64
+		nulls                    int64
+		min, max                 string
+	}
+	var groups [][]chunkInfo
+	var groupSizes []int
+
+	for start := 0; start < rows || start == 0; start += groupRows {
+		end := min(start+groupRows, rows)
+		var chunks []chunkInfo
+		for _, column := range columns {
+			values := column.values[start:end]
+			info := chunkInfo{offset: int64(file.Len())}
+
+			var levels []uint32
+			var present []string
+			for _, v := range values {
+				if column.optional && v == "" {
+					levels = append(levels, 0)
+					info.nulls++
+					continue
+				}
+				levels = append(levels, 1)
+				present = append(present, v)
+				if info.min == "" || v < info.min {
+					info.min = v
+				}
+				if v > info.max {
+					info.max = v
+				}
+			}
+
+			var body []byte
+			encoding := int32(encodingPlain)
+			if column.dictionary {
+				var dictionary []string
+				index := map[string]uint32{}
+				var indices []uint32
+				for _, v := range present {
+					if _, ok := index[v]; !ok {
+						index[v] = uint32(len(dictionary))
+						dictionary = append(dictionary, v)
+					}
+					indices = append(indices, index[v])
+				}
+				plain := encodePlain(t, column.typ, dictionary)
+				compressed := compressPage(t, opts.codec, plain)
+
+				info.dictOffset = int64(file.Len())
+				w := &thriftWriter{}
+				w.begin()
+				w.i32(1, pageDictionary)
+				w.i32(2, int32(len(plain)))
+				w.i32(3, int32(len(compressed)))
+				w.structField(7)
+				w.i32(1, int32(len(dictionary)))
+				w.i32(2, encodingPlain)
+				w.end()
+				w.end()
+				file.Write(w.buf.Bytes())
+				file.Write(compressed)
+
+				bitWidth := 1
+				for 1<<bitWidth < len(dictionary) {
+					bitWidth++
+				}
+				body = append([]byte{byte(bitWidth)}, encodePacked(indices, bitWidth)...)
+				encoding = encodingRLEDictionary
+			} else {
+				body = encodePlain(t, column.typ, present)
+			}
+
+			var levelBytes []byte
+			if column.optional {
+				levelBytes = encodeRuns(levels, 1)
+			}
+			dataOffset := int64(file.Len())
+			w := &thriftWriter{}
+			w.begin()
+			if opts.v2 {
+				compressed := compressPage(t, opts.codec, body)
+				w.i32(1, pageDataV2)
+				w.i32(2, int32(len(levelBytes)+len(body)))
+				w.i32(3, int32(len(levelBytes)+len(compressed)))
+				w.structField(8)
+				w.i32(1, int32(len(values)))
+				w.i32(2, int32(info.nulls))
+				w.i32(3, int32(len(values)))
+				w.i32(4, encoding)
+				w.i32(5, int32(len(levelBytes)))
+				w.i32(6, 0)
+				w.bool(7, true)
+				w.end()
+				w.end()
+				file.Write(w.buf.Bytes())
+				file.Write(levelBytes)
+				file.Write(compressed)
+			} else {
+				page := body
+				if column.optional {
+					page = binary.LittleEndian.AppendUint32(nil, uint32(len(levelBytes)))
+					page = append(append(page, levelBytes...), body...)
+				}
+				compressed := compressPage(t, opts.codec, page)
+				w.i32(1, pageData)
+				w.i32(2, int32(len(page)))
+				w.i32(3, int32(len(compressed)))
+				w.structField(5)
+				w.i32(1, int32(len(values)))
+				w.i32(2, encoding)
+				w.i32(3, encodingRLE)
+				w.i32(4, encodingRLE)
+				w.end()
+				w.end()
+				file.Write(w.buf.Bytes())
+				file.Write(compressed)
+			}
+
+			info.size = int64(file.Len()) - info.offset
+			if info.dictOffset == 0 {
+				info.dictOffset = -1
+			}
+			info.offset = dataOffset
+			chunks = append(chunks, info)
+		}
+		groups = append(groups, chunks)
+		groupSizes = append(groupSizes, end-start)
+		if end >= rows {
+			break
+		}
+	}
+
+	w := &thriftWriter{}
+	w.begin()
+	w.i32(1, 1)
+	w.list(2, typeStruct, len(columns)+1)
+	w.begin()
+	w.binary(4, []byte("schema"))
+	w.i32(5, int32(len(columns)))
+	w.end()
+	for _, column := range columns {
+		w.begin()
+		w.i32(1, column.typ)
+		repetition := int32(repetitionRequired)
+		if column.optional {
+			repetition = repetitionOptional
+		}
+		w.i32(3, repetition)
+		w.binary(4, []byte(column.name))
+		w.end()
+	}
+	w.i64(3, int64(rows))
+	w.list(4, typeStruct, len(groups))
+	for g, chunks := range groups {
+		w.begin()
+		w.list(1, typeStruct, len(chunks))
+		for c, info := range chunks {
+			w.begin()
+			w.i64(2, info.offset)
+			w.structField(3)
+			w.i32(1, columns[c].typ)
+			w.list(2, typeI32, 2)
+			w.zigzag(encodingPlain)
+			w.zigzag(encodingRLE)
+			w.list(3, typeBinary, 1)
+			w.uvarint(uint64(len(columns[c].name)))
+			w.buf.WriteString(columns[c].name)
+			w.i32(4, opts.codec)
+			w.i64(5, int64(groupSizes[g]))
+			w.i64(6, info.size)
+			w.i64(7, info.size)
+			w.i64(9, info.offset)
+			if info.dictOffset >= 0 {
+				w.i64(11, info.dictOffset)
+			}
+			w.structField(12)
+			w.i64(3, info.nulls)
+			if info.max != "" {
+				w.binary(5, []byte(info.max))
+				w.binary(6, []byte(info.min))
+			}
+			w.end()
+			w.end()
+			w.end()
+		}
+		w.i64(2, 0)
+		w.i64(3, int64(groupSizes[g]))
+		w.end()
+	}
+	w.binary(6, []byte("parquet-test"))
+	w.end()
+
+	file.Write(w.buf.Bytes())
+	file.Write(binary.LittleEndian.AppendUint32(nil, uint32(w.buf.Len())))
+	file.WriteString("PAR1")
+	return file.Bytes()
+}
+
+func testColumns() []testColumn {
+	return []testColumn{
+		{name: "network", typ: typeByteArray, values: []string{"8.8.8.8/32", "1.1.1.1", "2001:db8::1", "9.9.9.9", "10.0.0.1"}},
+		{name: "country", typ: typeByteArray, dictionary: true, values: []string{"US", "AU", "US", "US", "ZZ"}},
+		{name: "city", typ: typeByteArray, optional: true, dictionary: true, values: []string{"Mountain View", "", "", "Berkeley", ""}},
+		{name: "latitude", typ: typeDoubleValue, optional: true, values: []string{"37.386", "-33.494", "", "37.8716", ""}},
+		{name: "population", typ: typeInt64, values: []string{"82376", "0", "-1", "124321", "9"}},
+		{name: "active", typ: typeBoolean, values: []string{"true", "false", "true", "true", "false"}},
+	}
+}
+
+func readAll(t *testing.T, data []byte, names []string, skip func(ColumnStats) bool) [][]string {
+	t.Helper()
+	f, err := Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	var rows [][]string
+	err = f.ReadRows(names, skip, func(row []string) error {
+		rows = append(rows, append([]string(nil), row...))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadRows: %v", err)
+	}
+	return rows
+}
+
+func TestReadRows(t *testing.T) {
+	want := [][]string{
+		{"8.8.8.8/32", "Mountain View", "US", "37.386", "82376", "true"},
+		{"1.1.1.1", "", "AU", "-33.494", "0", "false"},
+		{"2001:db8::1", "", "US", "", "-1", "true"},
+		{"9.9.9.9", "Berkeley", "US", "37.8716", "124321", "true"},
+		{"10.0.0.1", "", "ZZ", "", "9", "false"},
+	}
+	names := []string{"NETWORK", "City", "country", "latitude", "population", "active"}
+
+	tests := []struct {
+		name string
+		opts testOptions
+	}{
+		{"uncompressed", testOptions{}},
+		{"snappy", testOptions{codec: codecSnappy}},
+		{"gzip", testOptions{codec: codecGzip}},
+		{"data page v2", testOptions{codec: codecSnappy, v2: true}},
+		{"row groups", testOptions{codec: codecSnappy, groupRows: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := writeTestFile(t, testColumns(), tt.opts)
+			f, err := Open(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.NumRows() != 5 {
+				t.Errorf("NumRows() = %d, want 5", f.NumRows())
+			}
+			if got := f.Columns(); !reflect.DeepEqual(got, []string{"network", "country", "city", "latitude", "population", "active"}) {
+				t.Errorf("Columns() = %v", got)
+			}
+			if got := readAll(t, data, names, nil); !reflect.DeepEqual(got, want) {
+				t.Errorf("rows = %q\nwant %q", got, want)
+			}
+		})
+	}
+}
+
+func TestReadRows_Skip(t *testing.T) {
+	columns := []testColumn{
+		{name: "network", typ: typeByteArray, optional: true, values: []string{"", "", "1.1.1.1", "2.2.2.2", "", ""}},
+		{name: "country", typ: typeByteArray, values: []string{"US", "US", "AU", "DE", "FR", "FR"}},
+	}
+	data := writeTestFile(t, columns, testOptions{groupRows: 2})
+
+	var seen []ColumnStats
+	rows := readAll(t, data, []string{"network", "country"}, func(stats ColumnStats) bool {
+		seen = append(seen, stats)
+		return stats.HasNulls && stats.Nulls == stats.Rows
+	})
+	if want := [][]string{{"1.1.1.1", "AU"}, {"2.2.2.2", "DE"}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+	if len(seen) != 3 {
+		t.Fatalf("skip called %d times, want 3", len(seen))
+	}
+	if string(seen[1].Min) != "1.1.1.1" || string(seen[1].Max) != "2.2.2.2" || seen[1].Rows != 2 {
+		t.Errorf("stats = %+v", seen[1])
+	}
+}
+
+func TestReadRows_Errors(t *testing.T) {
+	data := writeTestFile(t, testColumns(), testOptions{codec: codecSnappy})
+	f, err := Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.ReadRows([]string{"ip"}, nil, func([]string) error { return nil }); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("missing column: got %v, want ErrInvalidFile", err)
+	}
+
+	stop := errors.New("stop")
+	if err := f.ReadRows([]string{"network"}, nil, func([]string) error { return stop }); err != stop {
+		t.Errorf("callback error: got %v, want %v", err, stop)
+	}
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	data := writeTestFile(t, testColumns(), testOptions{})
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"csv", []byte("ip_address,city,country\n8.8.8.8,Mountain View,US\n")},
+		{"missing trailer", data[:len(data)-4]},
+		{"footer length", append(append([]byte(nil), data[:len(data)-8]...), 0xff, 0xff, 0xff, 0x7f, 'P', 'A', 'R', '1')},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Open(bytes.NewReader(tt.data), int64(len(tt.data))); !errors.Is(err, ErrInvalidFile) {
+				t.Errorf("got %v, want ErrInvalidFile", err)
+			}
+		})
+	}
+}
+
+// TestReadRows_Corrupt flips every byte of a file in turn; the reader may fail but
+// must not panic or hang
+func TestReadRows_Corrupt(t *testing.T) {
+	for _, opts := range []testOptions{{codec: codecSnappy}, {v2: true}} {
+		data := writeTestFile(t, testColumns(), opts)
+		for i := range data {
+			corrupt := append([]byte(nil), data...)
+			corrupt[i] ^= 0xff
+			f, err := Open(bytes.NewReader(corrupt), int64(len(corrupt)))
+			if err != nil {
+				continue
+			}
+			err = f.ReadRows(f.Columns(), nil, func([]string) error { return nil })
+			if err != nil && !errors.Is(err, ErrInvalidFile) && !errors.Is(err, ErrUnsupported) {
+				t.Fatalf("byte %d: unexpected error %v", i, err)
+			}
+		}
+	}
+}
+
+func TestSnappyDecode(t *testing.T) {
+	// "abcd", a copy of length 8 with a 1-byte offset of 4, a copy of length 3 with a
+	// 2-byte offset of 3
+	block := []byte{15, 3 << 2, 'a', 'b', 'c', 'd', 0x01 | 4<<2, 4, 0x02 | 2<<2, 3, 0}
+	got, err := snappyDecode(block, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "abcdabcdabcdbcd"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name  string
+		block []byte
+		size  int
+	}{
+		{"empty", nil, 0},
+		{"size mismatch", []byte{4, 3 << 2, 'a', 'b', 'c', 'd'}, 3},
+		{"literal past input", []byte{4, 3 << 2, 'a'}, 4},
+		{"offset before start", []byte{8, 0, 'a', 0x01 | 3<<2, 2}, 8},
+		{"copy past size", []byte{4, 0, 'a', 0x01 | 4<<2, 1}, 4},
+		{"short output", []byte{4, 1 << 2, 'a', 'b'}, 4},
+	}
+	for _, tt := range tests {
+		if _, err := snappyDecode(tt.block, tt.size); err == nil {
+			t.Errorf("%s: snappyDecode succeeded", tt.name)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errSnappy = errors.New("corrupt snappy block")
+
+// snappyDecode decompresses a raw (unframed) snappy block, the form parquet pages use.
+// The decompressed length, which the block starts with, must equal size.
+func snappyDecode(src []byte, size int) ([]byte, error) {
+	n, read := binary.Uvarint(src)
+	if read <= 0 || n != uint64(size) {
+		return nil, errSnappy
+	}
+	src = src[read:]
+	dst := make([]byte, 0, size)
+
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 0x03 {
+		case 0x00: // Literal
+			length := int(tag>>2) + 1
+			src = src[1:]
+			if length > 60 {
+				// The length follows in 1-4 bytes
+				extra := length - 60
+				if len(src) < extra {
+					return nil, errSnappy
+				}
+				var v uint32
+				for i := 0; i < extra; i++ {
+					v |= uint32(src[i]) << (8 * i)
+				}
+				length = int(v) + 1
+				src = src[extra:]
+			}
+			if length <= 0 || length > len(src) || length > size-len(dst) {
+				return nil, errSnappy
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 0x01: // Copy with a 1-byte offset
+			if len(src) < 2 {
+				return nil, errSnappy
+			}
+			length := 4 + int(tag>>2)&0x07
+			offset := int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+			if err := snappyCopy(&dst, offset, length, size); err != nil {
+				return nil, err
+			}
+		case 0x02: // Copy with a 2-byte offset
+			if len(src) < 3 {
+				return nil, errSnappy
+			}
+			length := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+			if err := snappyCopy(&dst, offset, length, size); err != nil {
+				return nil, err
+			}
+		case 0x03: // Copy with a 4-byte offset
+			if len(src) < 5 {
+				return nil, errSnappy
+			}
+			length := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+			if err := snappyCopy(&dst, offset, length, size); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(dst) != size {
+		return nil, errSnappy
+	}
+	return dst, nil
+}
+
+// snappyCopy appends length bytes starting offset bytes back; the ranges may overlap
+func snappyCopy(dst *[]byte, offset, length, size int) error {
+	d := *dst
+	if offset <= 0 || offset > len(d) || length > size-len(d) {
+		return errSnappy
+	}
+	start := len(d) - offset
+	for i := 0; i < length; i++ {
+		d = append(d, d[start+i])
+	}
+	*dst = d
+	return nil
+}
@@ -0,0 +1,223 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Thrift compact protocol types
+const (
+	typeStop      = 0
+	typeTrue      = 1
+	typeFalse     = 2
+	typeByte      = 3
+	typeI16       = 4
+	typeI32       = 5
+	typeI64       = 6
+	typeDouble    = 7
+	typeBinary    = 8
+	typeList      = 9
+	typeSet       = 10
+	typeMap       = 11
+	typeStruct    = 12
+	maxThriftNest = 64 // Deepest nesting skipped before the input is rejected
+)
+
+// thriftReader decodes the Thrift compact protocol parquet metadata is written in.
+// Structs are read field by field; fields the reader doesn't ask for are skipped.
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (t *thriftReader) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: metadata at byte %d: %s", ErrInvalidFile, t.pos, fmt.Sprintf(format, args...))
+}
+
+func (t *thriftReader) byte() (byte, error) {
+	if t.pos >= len(t.buf) {
+		return 0, t.errorf("truncated")
+	}
+	b := t.buf[t.pos]
+	t.pos++
+	return b, nil
+}
+
+func (t *thriftReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(t.buf[t.pos:])
+	if n <= 0 {
+		return 0, t.errorf("invalid varint")
+	}
+	t.pos += n
+	return v, nil
+}
+
+// i64 reads a zigzag encoded integer (i16, i32 and i64 are all encoded this way)
+func (t *thriftReader) i64() (int64, error) {
+	v, err := t.varint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+func (t *thriftReader) i32() (int32, error) {
+	v, err := t.i64()
+	if err == nil && (v < math.MinInt32 || v > math.MaxInt32) {
+		return 0, t.errorf("i32 out of range")
+	}
+	return int32(v), err
+}
+
+func (t *thriftReader) binary() ([]byte, error) {
+	n, err := t.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(t.buf)-t.pos) {
+		return nil, t.errorf("binary longer than the metadata")
+	}
+	b := t.buf[t.pos : t.pos+int(n)]
+	t.pos += int(n)
+	return b, nil
+}
+
+func (t *thriftReader) string() (string, error) {
+	b, err := t.binary()
+	return string(b), err
+}
+
+// listHeader reads the size and element type of a list or set
+func (t *thriftReader) listHeader() (int, byte, error) {
+	b, err := t.byte()
+	if err != nil {
+		return 0, 0, err
+	}
+	size, elem := uint64(b>>4), b&0x0f
+	if size == 15 {
+		if size, err = t.varint(); err != nil {
+			return 0, 0, err
+		}
+	}
+	// Every element takes at least a byte, so a larger size is corrupt
+	if size > uint64(len(t.buf)-t.pos) {
+		return 0, 0, t.errorf("list longer than the metadata")
+	}
+	return int(size), elem, nil
+}
+
+// list reads a list, calling fn for each element
+func (t *thriftReader) list(fn func(elem byte) error) error {
+	size, elem, err := t.listHeader()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < size; i++ {
+		if err := fn(elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fields reads a struct, calling fn with the id and type of each field. fn must
+// consume the field's value, with skip if it isn't needed. Boolean fields carry their
+// value in the type (typeTrue or typeFalse) and have nothing to consume.
+func (t *thriftReader) fields(fn func(id int16, typ byte) error) error {
+	var last int16
+	for {
+		b, err := t.byte()
+		if err != nil {
+			return err
+		}
+		typ := b & 0x0f
+		if typ == typeStop {
+			return nil
+		}
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			v, err := t.i64()
+			if err != nil {
+				return err
+			}
+			id = int16(v)
+		}
+		last = id
+		if err := fn(id, typ); err != nil {
+			return err
+		}
+	}
+}
+
+// skip consumes a value of type typ
+func (t *thriftReader) skip(typ byte) error {
+	return t.skipNested(typ, 0)
+}
+
+func (t *thriftReader) skipNested(typ byte, depth int) error {
+	if depth > maxThriftNest {
+		return t.errorf("nested too deeply")
+	}
+	switch typ {
+	case typeTrue, typeFalse:
+		return nil
+	case typeByte:
+		_, err := t.byte()
+		return err
+	case typeI16, typeI32, typeI64:
+		_, err := t.varint()
+		return err
+	case typeDouble:
+		if len(t.buf)-t.pos < 8 {
+			return t.errorf("truncated")
+		}
+		t.pos += 8
+		return nil
+	case typeBinary:
+		_, err := t.binary()
+		return err
+	case typeList, typeSet:
+		size, elem, err := t.listHeader()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			// Booleans in lists take a byte each
+			if elem == typeTrue || elem == typeFalse {
+				elem = typeByte
+			}
+			if err := t.skipNested(elem, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case typeMap:
+		size, err := t.varint()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if size > uint64(len(t.buf)-t.pos) {
+			return t.errorf("map larger than the metadata")
+		}
+		types, err := t.byte()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < size; i++ {
+			if err := t.skipNested(types>>4, depth+1); err != nil {
+				return err
+			}
+			if err := t.skipNested(types&0x0f, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case typeStruct:
+		return t.fields(func(_ int16, typ byte) error {
+			return t.skipNested(typ, depth+1)
+		})
+	default:
+		return t.errorf("unknown type %d", typ)
+	}
+}
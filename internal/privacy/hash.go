@@ -0,0 +1,31 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// KeyHasher derives opaque keys from IP addresses so in-memory structures such as
+// caches never hold the raw address. The HMAC key is generated per process, so
+// hashes can't be reversed by enumerating the IPv4 space offline.
+type KeyHasher struct {
+	key []byte
+}
+
+// NewKeyHasher creates a hasher with a random key
+func NewKeyHasher() *KeyHasher {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("failed to generate privacy hash key: " + err.Error())
+	}
+	return &KeyHasher{key: key}
+}
+
+// Hash returns the opaque key for value
+func (h *KeyHasher) Hash(value string) string {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
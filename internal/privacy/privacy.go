@@ -0,0 +1,170 @@
+// Package privacy anonymizes IP addresses before they leave the service in logs
+// and operator-facing output.
+package privacy
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"strings"
+)
+
+// AnonymizeIP truncates an IP address: the last octet of IPv4 and the last 80 bits
+// of IPv6 are zeroed. "host:port" forms keep their port. Values that aren't IP
+// addresses are returned unchanged.
+func AnonymizeIP(value string) string {
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return truncate(addr).String()
+	}
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return netip.AddrPortFrom(truncate(addrPort.Addr()), addrPort.Port()).String()
+	}
+	return value
+}
+
+// Redacted replaces IP addresses in do-not-store mode
+const Redacted = "[redacted-ip]"
+
+// AnonymizeText anonymizes every IP address embedded in free-form text such as
+// error messages
+func AnonymizeText(text string) string {
+	return replaceIPs(text, AnonymizeIP)
+}
+
+// RedactText replaces every IP address embedded in text with Redacted
+func RedactText(text string) string {
+	return replaceIPs(text, func(token string) string {
+		if _, err := netip.ParseAddr(token); err == nil {
+			return Redacted
+		}
+		if _, err := netip.ParseAddrPort(token); err == nil {
+			return Redacted
+		}
+		return token
+	})
+}
+
+// replaceIPs applies replace to every address-like token in text; replace returns
+// the token unchanged when it isn't an IP address
+func replaceIPs(text string, replace func(string) string) string {
+	var b strings.Builder
+	changed := false
+	for i := 0; i < len(text); {
+		if !isAddrChar(text[i]) {
+			b.WriteByte(text[i])
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(text) && isAddrChar(text[j]) {
+			j++
+		}
+		token := strings.TrimRight(text[i:j], ".:")
+		if replaced := replace(token); replaced != token {
+			b.WriteString(replaced)
+			b.WriteString(text[i+len(token) : j])
+			changed = true
+		} else {
+			b.WriteString(text[i:j])
+		}
+		i = j
+	}
+	if !changed {
+		return text
+	}
+	return b.String()
+}
+
+func truncate(addr netip.Addr) netip.Addr {
+	addr = addr.Unmap()
+	bits := 24
+	if addr.Is6() {
+		bits = 48
+	}
+	prefix, err := addr.WithZone("").Prefix(bits)
+	if err != nil {
+		return addr
+	}
+	return prefix.Addr()
+}
+
+// isAddrChar reports whether c can appear in a textual IPv4/IPv6 address or port
+func isAddrChar(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' || c == '.' || c == ':'
+}
+
+// LogHandler rewrites IP addresses in every string and error attribute before
+// passing records to the wrapped handler, so no call site can log a raw address
+type LogHandler struct {
+	next    slog.Handler
+	replace func(string) string
+}
+
+// NewLogHandler wraps next with IP anonymization
+func NewLogHandler(next slog.Handler) *LogHandler {
+	return &LogHandler{next: next, replace: AnonymizeText}
+}
+
+// NewRedactingLogHandler wraps next so IP addresses are removed entirely
+func NewRedactingLogHandler(next slog.Handler) *LogHandler {
+	return &LogHandler{next: next, replace: RedactText}
+}
+
+// Enabled implements slog.Handler
+func (h *LogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *LogHandler) Handle(ctx context.Context, record slog.Record) error {
+	anonymized := slog.NewRecord(record.Time, record.Level, h.replace(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		anonymized.AddAttrs(h.rewriteAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, anonymized)
+}
+
+// WithAttrs implements slog.Handler
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	anonymized := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		anonymized[i] = h.rewriteAttr(attr)
+	}
+	return &LogHandler{next: h.next.WithAttrs(anonymized), replace: h.replace}
+}
+
+// WithGroup implements slog.Handler
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	return &LogHandler{next: h.next.WithGroup(name), replace: h.replace}
+}
+
+func (h *LogHandler) rewriteAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.replace(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		anonymized := make([]any, len(group))
+		for i, member := range group {
+			anonymized[i] = h.rewriteAttr(member)
+		}
+		return slog.Group(attr.Key, anonymized...)
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case error:
+			return slog.String(attr.Key, h.replace(v.Error()))
+		case interface{ String() string }:
+			return slog.String(attr.Key, h.replace(v.String()))
+		case []string:
+			anonymized := make([]string, len(v))
+			for i, s := range v {
+				anonymized[i] = h.replace(s)
+			}
+			return slog.Any(attr.Key, anonymized)
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
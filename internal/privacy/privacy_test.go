@@ -0,0 +1,101 @@
+package privacy
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"192.168.1.42", "192.168.1.0"},
+		{"192.168.1.42:5432", "192.168.1.0:5432"},
+		{"2001:db8:1234:5678:9abc:def0:1234:5678", "2001:db8:1234::"},
+		{"[2001:db8:1234:5678::1]:443", "[2001:db8:1234::]:443"},
+		{"::ffff:10.1.2.3", "10.1.2.0"},
+		{"not-an-ip", "not-an-ip"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := AnonymizeIP(tt.input); got != tt.want {
+			t.Errorf("AnonymizeIP(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestAnonymizeText(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"location not found for IP: 8.8.4.4", "location not found for IP: 8.8.4.0"},
+		{"dial 10.0.0.7:80 failed.", "dial 10.0.0.0:80 failed."},
+		{"from 2001:db8:aa:bb::1, then 1.2.3.4.", "from 2001:db8:aa::, then 1.2.3.0."},
+		{"took 5.061ms at 00:45:05", "took 5.061ms at 00:45:05"},
+		{"h:deadbeefcafe1234", "h:deadbeefcafe1234"},
+	}
+
+	for _, tt := range tests {
+		if got := AnonymizeText(tt.input); got != tt.want {
+			t.Errorf("AnonymizeText(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(&buf, nil))).With("client_ip", "203.0.113.77")
+
+	var clientID interface{} = "198.51.100.23"
+	logger.Info("lookup for 192.0.2.55",
+		"ip", "192.0.2.55",
+		"client_id", clientID,
+		"error", errors.New("location not found for IP: 192.0.2.55"),
+		slog.Group("request", "remote_addr", "192.0.2.200:5555"),
+		"status", 404,
+	)
+
+	output := buf.String()
+	for _, raw := range []string{"203.0.113.77", "192.0.2.55", "198.51.100.23", "192.0.2.200"} {
+		if strings.Contains(output, raw) {
+			t.Errorf("Expected %s to be anonymized, got %s", raw, output)
+		}
+	}
+	for _, truncated := range []string{"203.0.113.0", "192.0.2.0", "198.51.100.0", "192.0.2.0:5555", `"status":404`} {
+		if !strings.Contains(output, truncated) {
+			t.Errorf("Expected %s in output, got %s", truncated, output)
+		}
+	}
+}
+
+func TestRedactingLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewRedactingLogHandler(slog.NewTextHandler(&buf, nil)))
+
+	logger.Error("lookup failed", "ip", "2001:db8::1", "error", errors.New("location not found for IP: 192.0.2.55"))
+
+	output := buf.String()
+	if strings.Contains(output, "2001:db8") || strings.Contains(output, "192.0.2") {
+		t.Errorf("Expected addresses to be removed, got %s", output)
+	}
+	if strings.Count(output, Redacted) != 2 {
+		t.Errorf("Expected two redactions, got %s", output)
+	}
+}
+
+func TestKeyHasher(t *testing.T) {
+	hasher := NewKeyHasher()
+	key := hasher.Hash("192.0.2.55")
+	if key != hasher.Hash("192.0.2.55") {
+		t.Error("Expected stable hashes within a hasher")
+	}
+	if strings.Contains(key, "192.0.2") || key == NewKeyHasher().Hash("192.0.2.55") {
+		t.Errorf("Expected an opaque per-process key, got %s", key)
+	}
+}
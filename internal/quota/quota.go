@@ -0,0 +1,176 @@
+// Package quota tracks long-horizon (daily and monthly) request quotas per client.
+package quota
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// Store keeps quota counters. Keys expire on their own, so a store never needs to
+// know about periods; the shape matches Redis INCRBY/EXPIREAT so a shared store
+// can back several instances.
+type Store interface {
+	// IncrBy adds delta to key, creating it to expire at expires, and returns the new value
+	IncrBy(key string, delta int64, expires time.Time) (int64, error)
+	// Get returns the value of key, or 0 if it is missing or expired
+	Get(key string) (int64, error)
+}
+
+// Limits holds the quota per client for each period; 0 leaves a period unlimited
+type Limits struct {
+	Daily   int64
+	Monthly int64
+}
+
+// Period is a client's usage within one quota period
+type Period struct {
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// Exhausted reports whether the period's quota has been used up
+func (p *Period) Exhausted() bool {
+	return p != nil && p.Remaining == 0
+}
+
+// Usage is a client's usage across all limited periods
+type Usage struct {
+	Client  string  `json:"client"`
+	Daily   *Period `json:"daily,omitempty"`
+	Monthly *Period `json:"monthly,omitempty"`
+}
+
+// Tracker enforces quotas against a store. Periods are calendar days and months in UTC.
+type Tracker struct {
+	store  Store
+	limits Limits
+	now    func() time.Time
+
+	consumed atomic.Uint64
+	rejected atomic.Uint64
+	failures atomic.Uint64
+}
+
+// NewTracker creates a tracker enforcing limits with counters kept in store
+func NewTracker(store Store, limits Limits) *Tracker {
+	return &Tracker{store: store, limits: limits, now: time.Now}
+}
+
+// period describes one limited period at a point in time
+type period struct {
+	key    string
+	limit  int64
+	resets time.Time
+	target **Period
+}
+
+// periods returns the limited periods for client at the current time, wired to
+// the matching fields of usage
+func (t *Tracker) periods(client string, usage *Usage) []period {
+	now := t.now().UTC()
+	var periods []period
+	if t.limits.Daily > 0 {
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		periods = append(periods, period{
+			key:    fmt.Sprintf("quota:%s:day:%s", client, day.Format("2006-01-02")),
+			limit:  t.limits.Daily,
+			resets: day.AddDate(0, 0, 1),
+			target: &usage.Daily,
+		})
+	}
+	if t.limits.Monthly > 0 {
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		periods = append(periods, period{
+			key:    fmt.Sprintf("quota:%s:month:%s", client, month.Format("2006-01")),
+			limit:  t.limits.Monthly,
+			resets: month.AddDate(0, 1, 0),
+			target: &usage.Monthly,
+		})
+	}
+	return periods
+}
+
+func (p period) usage(used int64) *Period {
+	return &Period{
+		Limit:     p.limit,
+		Used:      used,
+		Remaining: max(p.limit-used, 0),
+		ResetsAt:  p.resets,
+	}
+}
+
+// Consume counts one request for client. When any period is exhausted the request
+// is not counted and allowed is false. Store errors are returned with allowed
+// true, so an unavailable store never blocks traffic.
+func (t *Tracker) Consume(client string) (usage Usage, allowed bool, err error) {
+	usage.Client = client
+	periods := t.periods(client, &usage)
+
+	used := make([]int64, len(periods))
+	allowed = true
+	for i, p := range periods {
+		if used[i], err = t.store.IncrBy(p.key, 1, p.resets); err != nil {
+			t.failures.Add(1)
+			t.rollback(periods[:i])
+			return usage, true, fmt.Errorf("failed to update quota: %w", err)
+		}
+		if used[i] > p.limit {
+			allowed = false
+		}
+	}
+
+	if !allowed {
+		t.rollback(periods)
+		t.rejected.Add(1)
+	} else {
+		t.consumed.Add(1)
+	}
+	for i, p := range periods {
+		if !allowed {
+			used[i]-- // Report usage without the rejected request
+		}
+		*p.target = p.usage(used[i])
+	}
+	return usage, allowed, nil
+}
+
+// rollback undoes the increments of a rejected or failed request
+func (t *Tracker) rollback(periods []period) {
+	for _, p := range periods {
+		if _, err := t.store.IncrBy(p.key, -1, p.resets); err != nil {
+			t.failures.Add(1)
+		}
+	}
+}
+
+// Usage returns client's current usage without counting a request
+func (t *Tracker) Usage(client string) (Usage, error) {
+	usage := Usage{Client: client}
+	for _, p := range t.periods(client, &usage) {
+		used, err := t.store.Get(p.key)
+		if err != nil {
+			t.failures.Add(1)
+			return Usage{}, fmt.Errorf("failed to read quota: %w", err)
+		}
+		*p.target = p.usage(used)
+	}
+	return usage, nil
+}
+
+// RegisterMetrics exposes quota counters on the registry
+func (t *Tracker) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewCounterFunc("ipgeo_quota_consumed_total",
+		"Total requests counted against client quotas",
+		func() float64 { return float64(t.consumed.Load()) })
+	registry.NewCounterFunc("ipgeo_quota_rejected_total",
+		"Total requests rejected because a client quota was exhausted",
+		func() float64 { return float64(t.rejected.Load()) })
+	registry.NewCounterFunc("ipgeo_quota_store_errors_total",
+		"Total quota store operations that failed",
+		func() float64 { return float64(t.failures.Load()) })
+}
@@ -0,0 +1,97 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestTracker(limits Limits, now time.Time) (*Tracker, *MemoryStore) {
+	store := NewMemoryStore("")
+	store.now = func() time.Time { return now }
+	tracker := NewTracker(store, limits)
+	tracker.now = func() time.Time { return now }
+	return tracker, store
+}
+
+func TestTracker_Consume(t *testing.T) {
+	now := time.Date(2026, 3, 31, 18, 30, 0, 0, time.UTC)
+	tracker, _ := newTestTracker(Limits{Daily: 2, Monthly: 3}, now)
+
+	for i := 1; i <= 2; i++ {
+		usage, allowed, err := tracker.Consume("key:a")
+		if err != nil || !allowed {
+			t.Fatalf("Consume() #%d = %v, %v, want allowed", i, allowed, err)
+		}
+		if usage.Daily.Used != int64(i) || usage.Daily.Remaining != int64(2-i) {
+			t.Errorf("Consume() #%d daily = %+v", i, usage.Daily)
+		}
+	}
+
+	usage, allowed, err := tracker.Consume("key:a")
+	if err != nil || allowed {
+		t.Fatalf("Consume() over the daily limit = %v, %v, want rejected", allowed, err)
+	}
+	if !usage.Daily.Exhausted() || usage.Monthly.Exhausted() {
+		t.Errorf("Consume() over the daily limit usage = %+v / %+v", usage.Daily, usage.Monthly)
+	}
+	if want := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC); !usage.Daily.ResetsAt.Equal(want) || !usage.Monthly.ResetsAt.Equal(want) {
+		t.Errorf("Resets at %v / %v, want %v", usage.Daily.ResetsAt, usage.Monthly.ResetsAt, want)
+	}
+
+	// Rejected requests are not counted
+	if usage, _ := tracker.Usage("key:a"); usage.Daily.Used != 2 || usage.Monthly.Used != 2 {
+		t.Errorf("Usage() after rejection = %+v / %+v, want 2 used", usage.Daily, usage.Monthly)
+	}
+
+	// Other clients have their own quota
+	if _, allowed, _ := tracker.Consume("key:b"); !allowed {
+		t.Error("Consume() for another client was rejected")
+	}
+}
+
+func TestTracker_NewDayResetsDailyQuota(t *testing.T) {
+	now := time.Date(2026, 3, 10, 23, 59, 0, 0, time.UTC)
+	tracker, store := newTestTracker(Limits{Daily: 1, Monthly: 10}, now)
+
+	tracker.Consume("key:a")
+	if _, allowed, _ := tracker.Consume("key:a"); allowed {
+		t.Fatal("Second request of the day was allowed")
+	}
+
+	now = now.Add(2 * time.Minute)
+	tracker.now = func() time.Time { return now }
+	store.now = tracker.now
+
+	usage, allowed, _ := tracker.Consume("key:a")
+	if !allowed || usage.Daily.Used != 1 || usage.Monthly.Used != 2 {
+		t.Errorf("Consume() on a new day = %v, %+v / %+v", allowed, usage.Daily, usage.Monthly)
+	}
+}
+
+func TestTracker_UnlimitedPeriods(t *testing.T) {
+	tracker, _ := newTestTracker(Limits{Monthly: 5}, time.Now())
+
+	usage, allowed, _ := tracker.Consume("key:a")
+	if !allowed || usage.Daily != nil || usage.Monthly == nil {
+		t.Errorf("Consume() with only a monthly limit = %v, %+v", allowed, usage)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) IncrBy(string, int64, time.Time) (int64, error) {
+	return 0, errors.New("store unavailable")
+}
+func (failingStore) Get(string) (int64, error) { return 0, errors.New("store unavailable") }
+
+func TestTracker_StoreFailureAllows(t *testing.T) {
+	tracker := NewTracker(failingStore{}, Limits{Daily: 1})
+
+	if _, allowed, err := tracker.Consume("key:a"); err == nil || !allowed {
+		t.Errorf("Consume() with failing store = %v, %v, want allowed with error", allowed, err)
+	}
+	if _, err := tracker.Usage("key:a"); err == nil {
+		t.Error("Usage() with failing store expected error")
+	}
+}
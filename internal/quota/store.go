@@ -0,0 +1,168 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// entry is a counter with its expiry
+type entry struct {
+	Value   int64     `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// MemoryStore keeps counters in memory. When a file path is configured the
+// counters are loaded from it at startup and written back by Flush, so usage
+// survives restarts. The counters belong to one process: instances sharing a file
+// overwrite each other's usage, and each instance enforces quotas on its own.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	path    string
+	dirty   bool
+	now     func() time.Time
+}
+
+// NewMemoryStore creates a store persisted to path ("" keeps it in memory only)
+func NewMemoryStore(path string) *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]entry),
+		path:    path,
+		now:     time.Now,
+	}
+}
+
+// Load reads counters from the store's file; a missing file is treated as empty
+func (s *MemoryStore) Load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read quota file %s: %w", s.path, err)
+	}
+
+	entries := make(map[string]entry)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse quota file %s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = entries
+	s.pruneLocked()
+	return nil
+}
+
+// IncrBy adds delta to key, creating it to expire at expires, and returns the new value
+func (s *MemoryStore) IncrBy(key string, delta int64, expires time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, exists := s.entries[key]
+	if !exists || !s.now().Before(e.Expires) {
+		e = entry{Expires: expires}
+	}
+	e.Value += delta
+	s.entries[key] = e
+	s.dirty = true
+	return e.Value, nil
+}
+
+// Get returns the value of key, or 0 if it is missing or expired
+func (s *MemoryStore) Get(key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, exists := s.entries[key]
+	if !exists || !s.now().Before(e.Expires) {
+		return 0, nil
+	}
+	return e.Value, nil
+}
+
+// Len returns the number of live counters
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked()
+	return len(s.entries)
+}
+
+// pruneLocked drops expired counters
+func (s *MemoryStore) pruneLocked() {
+	now := s.now()
+	for key, e := range s.entries {
+		if !now.Before(e.Expires) {
+			delete(s.entries, key)
+			s.dirty = true
+		}
+	}
+}
+
+// Flush writes the counters to the store's file if they changed since the last flush
+func (s *MemoryStore) Flush() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	s.pruneLocked()
+
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return fmt.Errorf("failed to save quotas: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".quotas-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to save quotas: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save quotas: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save quotas: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save quotas: %w", err)
+	}
+	s.dirty = false
+	return nil
+}
+
+// Run flushes the counters every interval until ctx is cancelled, reporting
+// failures to onError. Callers should Flush once more after Run returns.
+func (s *MemoryStore) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package quota
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore("")
+	store.now = func() time.Time { return now }
+
+	store.IncrBy("a", 3, now.Add(time.Minute))
+	if got, _ := store.Get("a"); got != 3 {
+		t.Errorf("Get() = %d, want 3", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got, _ := store.Get("a"); got != 0 {
+		t.Errorf("Get() after expiry = %d, want 0", got)
+	}
+	if got, _ := store.IncrBy("a", 1, now.Add(time.Minute)); got != 1 {
+		t.Errorf("IncrBy() after expiry = %d, want a fresh counter", got)
+	}
+}
+
+func TestMemoryStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	expires := time.Now().Add(time.Hour)
+
+	store := NewMemoryStore(path)
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load() of missing file error = %v", err)
+	}
+	store.IncrBy("quota:key:a:day:2026-03-10", 42, expires)
+	store.IncrBy("stale", 1, time.Now().Add(-time.Minute))
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	reloaded := NewMemoryStore(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got, _ := reloaded.Get("quota:key:a:day:2026-03-10"); got != 42 {
+		t.Errorf("Reloaded counter = %d, want 42", got)
+	}
+	if reloaded.Len() != 1 {
+		t.Errorf("Reloaded %d counters, want 1 (expired counters are dropped)", reloaded.Len())
+	}
+}
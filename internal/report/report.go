@@ -0,0 +1,151 @@
+// Package report summarizes traffic into periodic reports (top countries, top
+// clients, error rates and dataset coverage) delivered on a cron-like schedule.
+package report
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTopN is how many countries and clients a report lists when unset
+const DefaultTopN = 10
+
+// AnonymousClient is the client name of requests without an API key
+const AnonymousClient = "anonymous"
+
+// Count is one entry of a ranking
+type Count struct {
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+// Lookups summarizes how much of the queried address space the dataset covers
+type Lookups struct {
+	Found    uint64  `json:"found"`
+	NotFound uint64  `json:"not_found"`
+	Coverage float64 `json:"coverage"` // Fraction of lookups that found a location (1 when there were none)
+}
+
+// Report summarizes the /v1 traffic of one window
+type Report struct {
+	WindowStart  time.Time `json:"window_start"`
+	WindowEnd    time.Time `json:"window_end"`
+	Requests     uint64    `json:"requests"`
+	ClientErrors uint64    `json:"client_errors"` // Responses with a 4xx status
+	ServerErrors uint64    `json:"server_errors"` // Responses with a 5xx status
+	ErrorRate    float64   `json:"error_rate"`    // Fraction of requests answered with 5xx
+	Lookups      Lookups   `json:"lookups"`
+	TopCountries []Count   `json:"top_countries"`
+	TopClients   []Count   `json:"top_clients"`
+}
+
+// Collector counts requests and lookups for the current window
+type Collector struct {
+	topN int
+
+	mu           sync.Mutex
+	started      time.Time
+	requests     uint64
+	clientErrors uint64
+	serverErrors uint64
+	found        uint64
+	notFound     uint64
+	countries    map[string]uint64
+	clients      map[string]uint64
+	now          func() time.Time
+}
+
+// NewCollector creates a collector whose reports list the topN countries and
+// clients (0 uses DefaultTopN)
+func NewCollector(topN int) *Collector {
+	if topN <= 0 {
+		topN = DefaultTopN
+	}
+	return &Collector{
+		topN:      topN,
+		started:   time.Now().UTC(),
+		countries: make(map[string]uint64),
+		clients:   make(map[string]uint64),
+		now:       time.Now,
+	}
+}
+
+// RecordRequest counts one request by client that completed with status. Clients are
+// API key identities, never addresses; use AnonymousClient for unauthenticated requests.
+func (c *Collector) RecordRequest(client string, status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests++
+	c.clients[client]++
+	switch {
+	case status >= 500:
+		c.serverErrors++
+	case status >= 400:
+		c.clientErrors++
+	}
+}
+
+// RecordLookup counts one lookup of a valid address, with the country found or
+// found false when the dataset has no location for it
+func (c *Collector) RecordLookup(country string, found bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !found {
+		c.notFound++
+		return
+	}
+	c.found++
+	if country != "" {
+		c.countries[country]++
+	}
+}
+
+// Cut closes the current window and returns its report
+func (c *Collector) Cut() Report {
+	c.mu.Lock()
+	report := Report{
+		WindowStart:  c.started,
+		WindowEnd:    c.now().UTC(),
+		Requests:     c.requests,
+		ClientErrors: c.clientErrors,
+		ServerErrors: c.serverErrors,
+		Lookups:      Lookups{Found: c.found, NotFound: c.notFound, Coverage: 1},
+	}
+	countries, clients := c.countries, c.clients
+	c.started = report.WindowEnd
+	c.requests, c.clientErrors, c.serverErrors, c.found, c.notFound = 0, 0, 0, 0, 0
+	c.countries = make(map[string]uint64)
+	c.clients = make(map[string]uint64)
+	c.mu.Unlock()
+
+	if report.Requests > 0 {
+		report.ErrorRate = float64(report.ServerErrors) / float64(report.Requests)
+	}
+	if total := report.Lookups.Found + report.Lookups.NotFound; total > 0 {
+		report.Lookups.Coverage = float64(report.Lookups.Found) / float64(total)
+	}
+	report.TopCountries = top(countries, c.topN)
+	report.TopClients = top(clients, c.topN)
+	return report
+}
+
+// top returns the n largest counts, ties broken by name
+func top(counts map[string]uint64, n int) []Count {
+	ranking := make([]Count, 0, len(counts))
+	for name, count := range counts {
+		ranking = append(ranking, Count{Name: name, Count: count})
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].Count != ranking[j].Count {
+			return ranking[i].Count > ranking[j].Count
+		}
+		return ranking[i].Name < ranking[j].Name
+	})
+	if len(ranking) > n {
+		ranking = ranking[:n]
+	}
+	return ranking
+}
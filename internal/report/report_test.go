@@ -0,0 +1,53 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollector_Cut(t *testing.T) {
+	c := NewCollector(2)
+	end := time.Date(2026, 3, 10, 13, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return end }
+
+	for _, status := range []int{200, 200, 404, 429, 500} {
+		c.RecordRequest("key:0a1b", status)
+	}
+	c.RecordRequest(AnonymousClient, 200)
+	c.RecordRequest("key:ffff", 200)
+	c.RecordRequest("key:ffff", 200)
+	for _, country := range []string{"US", "US", "GB", "DE", "DE"} {
+		c.RecordLookup(country, true)
+	}
+	c.RecordLookup("", false)
+
+	report := c.Cut()
+	if report.Requests != 8 || report.ClientErrors != 2 || report.ServerErrors != 1 {
+		t.Errorf("Requests = %d/%d/%d, want 8/2/1", report.Requests, report.ClientErrors, report.ServerErrors)
+	}
+	if report.ErrorRate != 0.125 {
+		t.Errorf("ErrorRate = %v, want 0.125", report.ErrorRate)
+	}
+	if report.Lookups.Found != 5 || report.Lookups.NotFound != 1 || report.Lookups.Coverage != 5.0/6 {
+		t.Errorf("Lookups = %+v", report.Lookups)
+	}
+	wantCountries := []Count{{"DE", 2}, {"US", 2}}
+	if len(report.TopCountries) != 2 || report.TopCountries[0] != wantCountries[0] || report.TopCountries[1] != wantCountries[1] {
+		t.Errorf("TopCountries = %+v, want %+v", report.TopCountries, wantCountries)
+	}
+	if len(report.TopClients) != 2 || report.TopClients[0] != (Count{"key:0a1b", 5}) || report.TopClients[1] != (Count{"key:ffff", 2}) {
+		t.Errorf("TopClients = %+v", report.TopClients)
+	}
+	if !report.WindowEnd.Equal(end) {
+		t.Errorf("WindowEnd = %v, want %v", report.WindowEnd, end)
+	}
+
+	// The next window starts where this one ended, empty
+	next := c.Cut()
+	if !next.WindowStart.Equal(end) || next.Requests != 0 || len(next.TopCountries) != 0 {
+		t.Errorf("Next window = %+v", next)
+	}
+	if next.ErrorRate != 0 || next.Lookups.Coverage != 1 {
+		t.Errorf("Empty window rates = %v, %v", next.ErrorRate, next.Lookups.Coverage)
+	}
+}
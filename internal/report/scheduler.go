@@ -0,0 +1,171 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// Sink receives reports
+type Sink interface {
+	Send(ctx context.Context, report Report) error
+}
+
+// FileSink writes each report as JSON to its own file in a directory, named after
+// the window end (report-20260310T120000Z.json)
+type FileSink struct {
+	dir string
+}
+
+// NewFileSink creates a sink writing reports to dir
+func NewFileSink(dir string) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create report directory: %w", err)
+	}
+	return &FileSink{dir: dir}, nil
+}
+
+// Send writes report to a new file, replacing it atomically if it exists
+func (s *FileSink) Send(ctx context.Context, report Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	name := filepath.Join(s.dir, "report-"+report.WindowEnd.UTC().Format("20060102T150405Z")+".json")
+	tmp, err := os.CreateTemp(s.dir, ".report-*")
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// WebhookSink POSTs each report as JSON to an endpoint
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink creates a sink posting reports to url through transport (nil uses
+// http.DefaultTransport)
+func NewWebhookSink(url string, timeout time.Duration, transport http.RoundTripper) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: timeout, Transport: transport}}
+}
+
+// Send posts report; any non-2xx response is a failure
+func (s *WebhookSink) Send(ctx context.Context, report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push report: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to push report: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Scheduler cuts the collector's window whenever the schedule is due and sends the
+// report to every sink. Unlike usage exports, reports are summaries: one a sink
+// rejects is not retried.
+type Scheduler struct {
+	collector *Collector
+	schedule  *Schedule
+	sinks     []Sink
+
+	generated atomic.Uint64
+	failures  atomic.Uint64
+	lastOK    atomic.Int64
+}
+
+// NewScheduler creates a scheduler sending collector's reports to sinks on schedule
+func NewScheduler(collector *Collector, schedule *Schedule, sinks ...Sink) *Scheduler {
+	return &Scheduler{collector: collector, schedule: schedule, sinks: sinks}
+}
+
+// Generate cuts the current window and sends its report to every sink
+func (s *Scheduler) Generate(ctx context.Context) error {
+	report := s.collector.Cut()
+
+	var errs []error
+	for _, sink := range s.sinks {
+		if err := sink.Send(ctx, report); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		s.failures.Add(1)
+		return err
+	}
+
+	s.generated.Add(1)
+	s.lastOK.Store(time.Now().Unix())
+	return nil
+}
+
+// Run generates a report each time the schedule is due until ctx is cancelled,
+// reporting failures to onError
+func (s *Scheduler) Run(ctx context.Context, onError func(error)) {
+	for {
+		next := s.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if err := s.Generate(ctx); err != nil && onError != nil && ctx.Err() == nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// RegisterMetrics exposes report generation health on the registry
+func (s *Scheduler) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewCounterFunc("ipgeo_reports_generated_total",
+		"Total scheduled reports delivered to every sink",
+		func() float64 { return float64(s.generated.Load()) })
+	registry.NewCounterFunc("ipgeo_report_failures_total",
+		"Total scheduled reports that a sink failed to receive",
+		func() float64 { return float64(s.failures.Load()) })
+	registry.NewGaugeFunc("ipgeo_report_last_success_timestamp_seconds",
+		"Unix time of the last report delivered to every sink",
+		func() float64 { return float64(s.lastOK.Load()) })
+}
@@ -0,0 +1,89 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReport() Report {
+	start := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	return Report{
+		WindowStart:  start,
+		WindowEnd:    start.Add(time.Hour),
+		Requests:     10,
+		TopCountries: []Count{{"US", 4}},
+		TopClients:   []Count{{"key:0a1b", 10}},
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewFileSink(dir)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	if err := sink.Send(context.Background(), testReport()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "report-20260310T130000Z.json"))
+	if err != nil {
+		t.Fatalf("Report file not written: %v", err)
+	}
+	if !strings.Contains(string(data), `"top_countries": [`) || !strings.Contains(string(data), `"name": "US"`) {
+		t.Errorf("Report file = %s", data)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received Report
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	if err := NewWebhookSink(server.URL, time.Second, nil).Send(context.Background(), testReport()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if received.Requests != 10 || len(received.TopClients) != 1 {
+		t.Errorf("Received report = %+v", received)
+	}
+}
+
+func TestScheduler_Generate(t *testing.T) {
+	status := http.StatusBadGateway
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	schedule, _ := ParseSchedule("@hourly")
+	collector := NewCollector(0)
+	scheduler := NewScheduler(collector, schedule, NewWebhookSink(server.URL, time.Second, nil))
+
+	collector.RecordRequest(AnonymousClient, 200)
+	if err := scheduler.Generate(context.Background()); err == nil {
+		t.Fatal("Expected failing webhook to be reported")
+	}
+	status = http.StatusOK
+	if err := scheduler.Generate(context.Background()); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if scheduler.generated.Load() != 1 || scheduler.failures.Load() != 1 {
+		t.Errorf("generated = %d, failures = %d", scheduler.generated.Load(), scheduler.failures.Load())
+	}
+	// A failed report is not retried: its counts are gone from the collector
+	if collector.Cut().Requests != 0 {
+		t.Error("Expected the failed window not to be restored")
+	}
+}
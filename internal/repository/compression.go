@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"ip-geolocation-service/internal/zstd"
+)
+
+// Data file compressions, detected from the file's magic bytes
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// errZstdReadOnly rejects writing a zstd dataset; only a decompressor is available
+var errZstdReadOnly = errors.New("zstd data files are read-only; decompress or recompress with gzip to write")
+
+// compressionFromExtension returns the compression implied by a file name
+func compressionFromExtension(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return CompressionGzip
+	case strings.HasSuffix(path, ".zst"):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// decompress detects the compression of r from its magic bytes and returns a reader
+// of the decompressed contents. A file named .gz or .zst must actually be compressed
+// that way, so a mislabeled file fails instead of being parsed as garbage.
+func decompress(r io.Reader, path string) (io.Reader, string, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(len(zstdMagic))
+
+	compression := CompressionNone
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		compression = CompressionGzip
+	case bytes.HasPrefix(magic, zstdMagic):
+		compression = CompressionZstd
+	}
+	if want := compressionFromExtension(path); want != CompressionNone && want != compression {
+		return nil, "", fmt.Errorf("data file %s is not %s compressed", path, want)
+	}
+
+	switch compression {
+	case CompressionGzip:
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read gzip data file %s: %w", path, err)
+		}
+		return gz, compression, nil
+	case CompressionZstd:
+		return zstd.NewReader(buffered), compression, nil
+	default:
+		return buffered, compression, nil
+	}
+}
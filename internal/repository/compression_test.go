@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/models"
+)
+
+// gzipData compresses data
+func gzipData(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(data))
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Failed to compress test data: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestFileRepository_Compressed(t *testing.T) {
+	zstdData, err := os.ReadFile("testdata/test_data.csv.zst")
+	if err != nil {
+		t.Fatalf("Failed to read zstd fixture: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		data    []byte
+		wantErr bool
+	}{
+		{"gzip", "data.csv.gz", gzipData(t, testCSVData), false},
+		{"gzip detected by magic bytes", "data.csv", gzipData(t, testCSVData), false},
+		{"zstd", "data.csv.zst", zstdData, false},
+		{"zstd detected by magic bytes", "data.csv", zstdData, false},
+		{"plain file named .gz", "data.csv.gz", []byte(testCSVData), true},
+		{"gzip file named .zst", "data.csv.zst", gzipData(t, testCSVData), true},
+		{"truncated gzip", "data.csv.gz", gzipData(t, testCSVData)[:20], true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testFile := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(testFile, tt.data, 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile}, slog.Default())
+			err := repo.Initialize(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Initialize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			location, err := repo.FindLocation(context.Background(), netip.MustParseAddr(testIP2))
+			if err != nil || location.City != "Mountain View" {
+				t.Errorf("FindLocation() = %v, %v", location, err)
+			}
+			if stats := repo.MemoryStats(); stats.Records != 3 {
+				t.Errorf("Expected 3 records, got %d", stats.Records)
+			}
+		})
+	}
+}
+
+func TestFileRepository_FlushCompressed(t *testing.T) {
+	ctx := context.Background()
+	location := models.Location{Country: "Switzerland", City: "Zurich"}
+
+	// A gzip dataset stays gzip compressed when written back
+	testFile := filepath.Join(t.TempDir(), "data.csv.gz")
+	if err := os.WriteFile(testFile, gzipData(t, testCSVData), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile}, slog.Default())
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if err := repo.Upsert(ctx, netip.MustParseAddr("9.9.9.9"), location); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if err := repo.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	reloaded := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile}, slog.Default())
+	if err := reloaded.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() after Flush error = %v", err)
+	}
+	if got, err := reloaded.FindLocation(ctx, netip.MustParseAddr("9.9.9.9")); err != nil || got.City != "Zurich" {
+		t.Errorf("FindLocation() after Flush = %v, %v", got, err)
+	}
+	if reloaded.Version() != repo.Version() {
+		t.Errorf("Version() = %s after reload, want %s", reloaded.Version(), repo.Version())
+	}
+
+	// zstd datasets can only be read
+	zstdFile := filepath.Join(t.TempDir(), "data.csv.zst")
+	zstdData, err := os.ReadFile("testdata/test_data.csv.zst")
+	if err != nil {
+		t.Fatalf("Failed to read zstd fixture: %v", err)
+	}
+	if err := os.WriteFile(zstdFile, zstdData, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	repo = NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: zstdFile}, slog.Default())
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	repo.Upsert(ctx, netip.MustParseAddr("9.9.9.9"), location)
+	if err := repo.Flush(ctx); !errors.Is(err, errZstdReadOnly) {
+		t.Errorf("Flush() error = %v, want errZstdReadOnly", err)
+	}
+	if written, _ := os.ReadFile(zstdFile); !bytes.Equal(written, zstdData) || strings.Contains(string(written), "Zurich") {
+		t.Error("Expected the zstd file to be left untouched")
+	}
+}
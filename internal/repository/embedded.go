@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"errors"
+	"log/slog"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/demodata"
+)
+
+// errEmbeddedReadOnly rejects writing the embedded demo dataset, which is compiled in
+var errEmbeddedReadOnly = errors.New("the embedded demo dataset is read-only")
+
+// NewEmbeddedRepository creates a file repository serving the demo dataset compiled
+// into the binary. DatabaseConfig's file path and integrity settings don't apply to
+// it; writes are kept in memory only.
+func NewEmbeddedRepository(cfg *config.DatabaseConfig, logger *slog.Logger) *FileRepository {
+	embedded := *cfg
+	embedded.Type = config.DatabaseTypeCSV
+	embedded.FilePath = demodata.Dataset
+	embedded.Checksum = ""
+	embedded.PublicKey = ""
+
+	repo := NewFileRepository(&embedded, logger)
+	repo.fsys = demodata.FS
+	return repo
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"testing"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/models"
+)
+
+func TestEmbeddedRepository(t *testing.T) {
+	ctx := context.Background()
+	// The configured path and checksum belong to the file the demo replaces
+	repo := NewEmbeddedRepository(&config.DatabaseConfig{
+		Type:     config.DatabaseTypeCSV,
+		FilePath: "/nonexistent/ip_locations.csv",
+		Checksum: "0000000000000000000000000000000000000000000000000000000000000000",
+	}, slog.Default())
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if repo.RecordCount() == 0 {
+		t.Error("Expected the embedded dataset to have records")
+	}
+	location, err := repo.FindLocation(ctx, netip.MustParseAddr("8.8.8.8"))
+	if err != nil || location.City != "Mountain View" {
+		t.Errorf("FindLocation(8.8.8.8) = %v, %v", location, err)
+	}
+	if err := repo.HealthCheck(ctx); err != nil {
+		t.Errorf("HealthCheck() error = %v", err)
+	}
+
+	repo.Upsert(ctx, netip.MustParseAddr("9.9.9.9"), models.Location{Country: "Switzerland", City: "Zurich"})
+	if err := repo.Flush(ctx); !errors.Is(err, errEmbeddedReadOnly) {
+		t.Errorf("Flush() error = %v, want errEmbeddedReadOnly", err)
+	}
+}
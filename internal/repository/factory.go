@@ -1,19 +1,27 @@
 package repository
 
 import (
+	"database/sql"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+
 	"ip-geolocation-service/internal/config"
 )
 
 // RepositoryFactoryImpl implements RepositoryFactory
 type RepositoryFactoryImpl struct {
 	config *config.DatabaseConfig
+	logger *slog.Logger
 }
 
-// NewRepositoryFactory creates a new repository factory
-func NewRepositoryFactory(cfg *config.DatabaseConfig) *RepositoryFactoryImpl {
+// NewRepositoryFactory creates a new repository factory whose repositories log to logger
+func NewRepositoryFactory(cfg *config.DatabaseConfig, logger *slog.Logger) *RepositoryFactoryImpl {
 	return &RepositoryFactoryImpl{
 		config: cfg,
+		logger: logger,
 	}
 }
 
@@ -21,28 +29,102 @@ func NewRepositoryFactory(cfg *config.DatabaseConfig) *RepositoryFactoryImpl {
 func (f *RepositoryFactoryImpl) CreateRepository(dbType string) (IPRepository, error) {
 	switch dbType {
 	case config.DatabaseTypeCSV:
-		return NewFileRepository(f.config), nil
+		if f.config.Embedded {
+			return NewEmbeddedRepository(f.config, f.logger), nil
+		}
+		return NewFileRepository(f.config, f.logger), nil
+	case config.DatabaseTypeParquet:
+		return NewFileRepository(f.config, f.logger), nil
 	case config.DatabaseTypeJSON:
 		// TODO: Implement JSON file repository
 		return nil, fmt.Errorf("json repository not implemented yet")
 	case config.DatabaseTypeXML:
 		// TODO: Implement XML file repository
 		return nil, fmt.Errorf("xml repository not implemented yet")
+	// Network backends size their connection pool from f.config.Pool (ConfigureDB for
+	// database/sql) and implement PoolStatsProvider so the pool shows up in the
+	// metrics. The SQL drivers are registered by programs embedding the service;
+	// config validation rejects these types when none is.
 	case config.DatabaseTypePostgres:
-		// TODO: Implement PostgreSQL repository
-		return nil, fmt.Errorf("postgres repository not implemented yet")
+		db, err := f.openSQL("postgres", postgresDSN(f.config))
+		if err != nil {
+			return nil, err
+		}
+		return f.tiered(NewPostgresRepository(db, SQLOptions{Table: f.config.Table, MaxRecords: f.config.MaxRecords})), nil
 	case config.DatabaseTypeMySQL:
-		// TODO: Implement MySQL repository
-		return nil, fmt.Errorf("mysql repository not implemented yet")
+		db, err := f.openSQL("mysql", mysqlDSN(f.config))
+		if err != nil {
+			return nil, err
+		}
+		return f.tiered(NewMySQLRepository(db, SQLOptions{Table: f.config.Table, MaxRecords: f.config.MaxRecords, Readers: MySQLReaders})), nil
 	case config.DatabaseTypeRedis:
-		// TODO: Implement Redis repository
+		// TODO: Implement Redis repository, wrapped in NewRetryingRepository(backend,
+		// retry.DefaultPolicy) so a failover or dropped connection is retried rather
+		// than answered with a 500, then in f.tiered like the SQL backends
 		return nil, fmt.Errorf("redis repository not implemented yet")
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", dbType)
 	}
 }
 
+// Capabilities reports what repositories of the given database type support.
+// Types without an implementation support nothing.
+func (f *RepositoryFactoryImpl) Capabilities(dbType string) Capabilities {
+	switch dbType {
+	case config.DatabaseTypeCSV:
+		return Capabilities{Writable: !f.config.Embedded}
+	case config.DatabaseTypePostgres, config.DatabaseTypeMySQL:
+		// Writes to a tiered backend would bypass the local store
+		return Capabilities{Writable: f.config.Tier.LocalFile == ""}
+	default:
+		return Capabilities{}
+	}
+}
+
 // CreateRepositoryFromConfig creates a repository using the factory's configuration
 func (f *RepositoryFactoryImpl) CreateRepositoryFromConfig() (IPRepository, error) {
 	return f.CreateRepository(f.config.Type)
 }
+
+// tiered fronts remote with the local CSV store of DATABASE_TIER_FILE, when one is set
+func (f *RepositoryFactoryImpl) tiered(remote IPRepository) IPRepository {
+	tier := f.config.Tier
+	if tier.LocalFile == "" {
+		return remote
+	}
+	local := config.DatabaseConfig{
+		Type:       config.DatabaseTypeCSV,
+		FilePath:   tier.LocalFile,
+		Duplicates: config.DuplicatePolicyLast,
+	}
+	return NewTieredRepository(NewFileRepository(&local, f.logger.With("tier", "local")), remote, tier.Window, tier.QueueSize, tier.MaxTracked)
+}
+
+// openSQL opens a database/sql pool with the configured pool settings. Connections
+// are only made once the repository is initialized.
+func (f *RepositoryFactoryImpl) openSQL(driver, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s repository needs a database/sql driver registered as %q: %w", f.config.Type, driver, err)
+	}
+	ConfigureDB(db, f.config.Pool)
+	return db, nil
+}
+
+// postgresDSN returns the lib/pq connection URL of cfg
+func postgresDSN(cfg *config.DatabaseConfig) string {
+	dsn := url.URL{
+		Scheme: "postgres",
+		Host:   net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:   "/" + cfg.Name,
+	}
+	if cfg.Username != "" {
+		dsn.User = url.UserPassword(cfg.Username, cfg.Password)
+	}
+	return dsn.String()
+}
+
+// mysqlDSN returns the go-sql-driver/mysql data source name of cfg
+func mysqlDSN(cfg *config.DatabaseConfig) string {
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s", cfg.Username, cfg.Password, net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), cfg.Name)
+}
@@ -1,9 +1,15 @@
 package repository
 
 import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/models"
 )
 
 func TestNewRepositoryFactory(t *testing.T) {
@@ -12,7 +18,7 @@ func TestNewRepositoryFactory(t *testing.T) {
 		FilePath: "/test/path.csv",
 	}
 
-	factory := NewRepositoryFactory(cfg)
+	factory := NewRepositoryFactory(cfg, slog.Default())
 
 	if factory == nil {
 		t.Fatal("NewRepositoryFactory() returned nil")
@@ -29,7 +35,7 @@ func TestRepositoryFactory_CreateRepository(t *testing.T) {
 		FilePath: "/test/path.csv",
 	}
 
-	factory := NewRepositoryFactory(cfg)
+	factory := NewRepositoryFactory(cfg, slog.Default())
 
 	tests := []struct {
 		name        string
@@ -56,16 +62,16 @@ func TestRepositoryFactory_CreateRepository(t *testing.T) {
 			description: "Should return error for empty database type",
 		},
 		{
-			name:        "PostgreSQL type (not implemented)",
+			name:        "PostgreSQL type without a driver",
 			dbType:      "postgres",
 			expectError: true,
-			description: "Should return error for unimplemented database type",
+			description: "Should return error when no postgres driver is linked",
 		},
 		{
-			name:        "MySQL type (not implemented)",
+			name:        "MySQL type without a driver",
 			dbType:      "mysql",
 			expectError: true,
-			description: "Should return error for unimplemented database type",
+			description: "Should return error when no mysql driver is linked",
 		},
 		{
 			name:        "Redis type (not implemented)",
@@ -142,7 +148,7 @@ func TestRepositoryFactory_CreateRepositoryFromConfig(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			factory := NewRepositoryFactory(tt.config)
+			factory := NewRepositoryFactory(tt.config, slog.Default())
 
 			// Handle nil config case specially
 			if tt.config == nil {
@@ -176,3 +182,59 @@ func TestRepositoryFactory_CreateRepositoryFromConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestRepositoryFactory_Capabilities(t *testing.T) {
+	factory := NewRepositoryFactory(&config.DatabaseConfig{}, slog.Default())
+
+	if !factory.Capabilities(config.DatabaseTypeCSV).Writable {
+		t.Error("Expected CSV repositories to be writable")
+	}
+	if NewRepositoryFactory(&config.DatabaseConfig{Embedded: true}, slog.Default()).Capabilities(config.DatabaseTypeCSV).Writable {
+		t.Error("Expected the embedded dataset to be read-only")
+	}
+	if factory.Capabilities(config.DatabaseTypeParquet).Writable {
+		t.Error("Expected Parquet repositories to be read-only")
+	}
+	if !factory.Capabilities(config.DatabaseTypePostgres).Writable || !factory.Capabilities(config.DatabaseTypeMySQL).Writable {
+		t.Error("Expected SQL repositories to be writable")
+	}
+	if NewRepositoryFactory(&config.DatabaseConfig{Tier: config.TierConfig{LocalFile: "local.csv"}}, slog.Default()).Capabilities(config.DatabaseTypePostgres).Writable {
+		t.Error("Expected a tiered SQL repository to be read-only")
+	}
+	if factory.Capabilities(config.DatabaseTypeRedis).Writable {
+		t.Error("Expected unimplemented backends to advertise no capabilities")
+	}
+
+	// Advertised capabilities match the repositories created
+	repo, err := factory.CreateRepository(config.DatabaseTypeCSV)
+	if err != nil {
+		t.Fatalf("CreateRepository() error = %v", err)
+	}
+	if _, ok := repo.(WritableRepository); !ok {
+		t.Error("Expected CSV repository to implement WritableRepository")
+	}
+}
+
+func TestRepositoryFactory_Tiered(t *testing.T) {
+	remote := &stubRemote{locations: map[string]models.Location{}}
+	if repo := NewRepositoryFactory(&config.DatabaseConfig{}, slog.Default()).tiered(remote); repo != remote {
+		t.Errorf("Expected the backend itself without DATABASE_TIER_FILE, got %T", repo)
+	}
+
+	path := filepath.Join(t.TempDir(), "local.csv")
+	if err := os.WriteFile(path, []byte("ip,city,country\n"), 0644); err != nil {
+		t.Fatalf("Failed to create local store file: %v", err)
+	}
+	cfg := &config.DatabaseConfig{Tier: config.TierConfig{LocalFile: path, Window: time.Minute, MaxTracked: 10}}
+	tiered, ok := NewRepositoryFactory(cfg, slog.Default()).tiered(remote).(*TieredRepository)
+	if !ok {
+		t.Fatal("Expected a TieredRepository with DATABASE_TIER_FILE")
+	}
+	defer tiered.Close()
+	if tiered.remote != remote || tiered.window != time.Minute || tiered.maxTracked != 10 {
+		t.Errorf("Unexpected tiered repository %+v", tiered)
+	}
+	if err := tiered.Initialize(context.Background()); err != nil {
+		t.Errorf("Initialize() error = %v", err)
+	}
+}
@@ -1,62 +1,214 @@
 package repository
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"net"
+	"io/fs"
+	"log/slog"
+	"math/rand/v2"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"ip-geolocation-service/internal/config"
 	"ip-geolocation-service/internal/models"
 )
 
-// FileRepository implements IPRepository using a file-based storage (CSV format)
+// Parser bounds
+const (
+	// MaxFieldLength is the longest field accepted in a dataset record, in bytes
+	MaxFieldLength = 256
+	// DefaultMaxRecords is the most addresses a dataset may hold when
+	// DatabaseConfig.MaxRecords is unset
+	DefaultMaxRecords = 50_000_000
+)
+
+// errTooManyRecords rejects a dataset that exceeds its record limit
+var errTooManyRecords = errors.New("dataset has too many records")
+
+// errConflictingRecord rejects a dataset listing an address with different locations
+// under the error duplicate policy
+var errConflictingRecord = errors.New("address listed again with a different location")
+
+// FileRepository implements IPRepository using a file-based storage (CSV format).
+// Lookups read an immutable snapshot without locking; loads and writes publish a
+// new snapshot.
 type FileRepository struct {
-	config   *config.DatabaseConfig
-	data     map[string]*models.Location
-	mu       sync.RWMutex
-	loaded   bool
-	loadTime time.Time
+	config *config.DatabaseConfig
+	snap   atomic.Pointer[snapshot] // nil until loaded
+	// Locations referenced by the current snapshot; writes append to it
+	locations *locationTable
+	mu        sync.RWMutex // Serializes writes and guards the fields below
+	loadTime  time.Time
+	version   string    // Content hash of the loaded file
+	modTime   time.Time // Modification time of the loaded file, zero if unknown
+	// Compression of the loaded file (CompressionNone, CompressionGzip or CompressionZstd),
+	// kept by Flush
+	compression string
+
+	// Writes: changes counts writes since loading, flushed the writes persisted so far
+	changes uint64
+	flushed uint64
+	flushMu sync.Mutex // Serializes Flush so an older snapshot never overwrites a newer one
+
+	memStats MemoryStats
+
+	fsys fs.FS // Filesystem the data file is read from; nil for the OS's
+
+	logger *slog.Logger // Reports records skipped while loading
+}
+
+// dataFile is an open data file, from the OS or an fs.FS that supports random access
+// such as the embedded demo dataset
+type dataFile interface {
+	fs.File
+	io.ReaderAt
+	io.Seeker
 }
 
 // NewFileRepository creates a new file-based repository (CSV format)
-func NewFileRepository(cfg *config.DatabaseConfig) *FileRepository {
+func NewFileRepository(cfg *config.DatabaseConfig, logger *slog.Logger) *FileRepository {
 	return &FileRepository{
-		config: cfg,
-		data:   make(map[string]*models.Location),
+		config:      cfg,
+		locations:   newLocationTable(),
+		compression: compressionFromExtension(cfg.FilePath),
+		logger:      logger,
 	}
 }
 
-// Initialize loads the CSV data into memory
+// Initialize loads the data file (CSV, or Parquet for DatabaseTypeParquet) into memory
 func (r *FileRepository) Initialize(ctx context.Context) error {
+	start := time.Now()
+	heapBefore := currentHeapInUse()
 
-	file, err := os.Open(r.config.FilePath)
+	file, err := r.open()
 	if err != nil {
 		return fmt.Errorf("failed to open data file %s: %w", r.config.FilePath, err)
 	}
 	defer file.Close()
+	// Embedded files have no modification time, which leaves the age of their data unknown
+	var modTime time.Time
+	if info, err := file.Stat(); err == nil {
+		modTime = info.ModTime()
+	}
+
+	// Reject a tampered or truncated file before any of it is loaded
+	var verified []byte
+	if r.config.Checksum != "" || r.config.PublicKey != "" {
+		if verified, err = r.verifyIntegrity(file); err != nil {
+			return err
+		}
+	}
+
+	// Build the dataset off to the side; readers keep the current snapshot until it's done
+	builder := newDatasetBuilder(r.maxRecords())
+	builder.policy = r.config.Duplicates
+
+	var digest []byte
+	compression := CompressionNone
+	if r.config.Type == config.DatabaseTypeParquet {
+		digest, err = readParquet(file, r.config.FilePath, builder, r.logger)
+	} else {
+		digest, compression, err = r.readCSV(file, builder)
+	}
+	if err != nil {
+		return err
+	}
+	// Check the file hasn't changed since it was verified
+	if verified != nil && !bytes.Equal(digest, verified) {
+		return fmt.Errorf("%w: %s changed while loading", ErrIntegrity, r.config.FilePath)
+	}
 
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = 3 // ip, city, country
+	heapAfter := currentHeapInUse()
+
+	r.mu.Lock()
+	naive, compact := estimateMemory(builder.locations, len(builder.data), builder.rawStringBytes)
+	r.memStats = MemoryStats{
+		Records:         len(builder.data),
+		UniqueLocations: builder.locations.Len(),
+		UniqueStrings:   builder.locations.strings.Len(),
+		NaiveBytes:      naive,
+		CompactBytes:    compact,
+		HeapBefore:      heapBefore,
+		HeapAfter:       heapAfter,
+		LoadDurationMS:  time.Since(start).Milliseconds(),
+		Duplicates:      builder.duplicates,
+		Conflicts:       builder.conflicts,
+	}
+	r.locations = builder.locations
+	r.snap.Store(builder.snapshot())
+	r.loadTime = time.Now()
+	r.version = hex.EncodeToString(digest)[:12]
+	r.modTime = modTime
+	r.compression = compression
+	r.flushed = r.changes // The file now matches memory
+	r.mu.Unlock()
+
+	return nil
+}
+
+// open opens the data file
+func (r *FileRepository) open() (dataFile, error) {
+	if r.fsys == nil {
+		file, err := os.Open(r.config.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		return file, nil
+	}
+	file, err := r.fsys.Open(r.config.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	if seekable, ok := file.(dataFile); ok {
+		return seekable, nil
+	}
+	file.Close()
+	return nil, fmt.Errorf("file does not support random access")
+}
+
+// readCSV adds the records of a CSV data file, which may be compressed, to builder
+// and returns the hash of the file as stored and its compression
+func (r *FileRepository) readCSV(file io.Reader, builder *datasetBuilder) ([]byte, string, error) {
+	// Hash the file as stored, before decompression, as it is parsed so the dataset
+	// version identifies its exact contents
+	hasher := sha256.New()
+	raw := io.TeeReader(file, hasher)
+	contents, compression, err := decompress(raw, r.config.FilePath)
+	if err != nil {
+		return nil, "", err
+	}
+	// ip, city, country[, latitude, longitude]; every row has as many fields as the first
+	reader := newRowReader(contents)
 
 	// Skip header if it exists
 	firstRecord, err := reader.Read()
 	if err != nil {
-		return fmt.Errorf("failed to read first record: %w", err)
+		return nil, "", fmt.Errorf("failed to read first record: %w", err)
 	}
+	fields := len(firstRecord)
 
 	// Check if first record is a header (contains non-IP values)
-	if !isValidIP(firstRecord[0]) {
+	if _, ok := parseAddr(firstRecord[0]); !ok {
 		// This is a header, continue reading
 	} else {
 		// This is data, process it
-		if err := r.processRecord(firstRecord); err != nil {
-			return fmt.Errorf("failed to process first record: %w", err)
+		if err := builder.processRecord(firstRecord); err != nil {
+			return nil, "", fmt.Errorf("failed to process first record: %w", err)
 		}
 	}
 
@@ -66,29 +218,110 @@ func (r *FileRepository) Initialize(ctx context.Context) error {
 		if err == io.EOF {
 			break
 		}
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			// An overlong or malformed row is skipped like an invalid one
+			r.logger.Warn("Skipped unreadable record", "line", rowErr.Line, "error", rowErr.Err)
+			continue
+		}
 		if err != nil {
-			return fmt.Errorf("failed to read record: %w", err)
+			return nil, "", fmt.Errorf("failed to read record: %w", err)
+		}
+		line := reader.Line()
+		if len(record) != fields {
+			return nil, "", fmt.Errorf("failed to read record on line %d: expected %d fields, got %d", line, fields, len(record))
 		}
 
-		if err := r.processRecord(record); err != nil {
+		conflicts := builder.conflicts
+		if err := builder.processRecord(record); err != nil {
+			if errors.Is(err, errTooManyRecords) {
+				return nil, "", err
+			}
+			if errors.Is(err, errConflictingRecord) {
+				return nil, "", fmt.Errorf("line %d: %w", line, err)
+			}
 			// Log error but continue processing
-			fmt.Printf("Warning: failed to process record %v: %v\n", record, err)
+			r.logger.Warn("Skipped invalid record", "line", line, "error", err)
 			continue
 		}
+		if builder.conflicts > conflicts {
+			r.logger.Warn("Record lists an address again with a different location", "line", line, "ip", strings.TrimSpace(record[0]))
+		}
 	}
 
-	r.mu.Lock()
-	r.loaded = true
-	r.loadTime = time.Now()
-	r.mu.Unlock()
+	// Hash anything the decompressor left unread
+	if _, err := io.Copy(io.Discard, raw); err != nil {
+		return nil, "", fmt.Errorf("failed to read data file %s: %w", r.config.FilePath, err)
+	}
+	return hasher.Sum(nil), compression, nil
+}
+
+// processRecord processes a single CSV record
+func (b *datasetBuilder) processRecord(record []string) error {
+	row, err := parseRecord(record)
+	if err != nil {
+		return err
+	}
+
+	if idx, exists := b.data[row.addr]; exists {
+		if replace, err := b.duplicate(idx, row); err != nil || !replace {
+			return err
+		}
+	} else if err := b.reserve(row.addr, len(row.country)+len(row.city)); err != nil {
+		return err
+	}
+	if row.hasCoords {
+		b.data[row.addr] = b.locations.AddWithCoordinates(row.country, row.city, row.lat, row.lon)
+	} else {
+		b.data[row.addr] = b.locations.Add(row.country, row.city)
+	}
 
 	return nil
 }
 
-// processRecord processes a single CSV record
-func (r *FileRepository) processRecord(record []string) error {
-	if len(record) != 3 {
-		return fmt.Errorf("invalid record format, expected 3 fields, got %d", len(record))
+// duplicate counts a row for an address that was already loaded and reports whether
+// it replaces the stored location under the builder's policy. Rows are single
+// addresses, so the most specific row is the one with coordinates; between equally
+// specific rows the later one wins, as it does by default.
+func (b *datasetBuilder) duplicate(idx uint32, row parsedRecord) (bool, error) {
+	existing := b.locations.Get(idx)
+	lat, lon, hasCoords := existing.Coordinates()
+	if existing.Country == row.country && existing.City == row.city &&
+		hasCoords == row.hasCoords && lat == row.lat && lon == row.lon {
+		b.duplicates++
+		return false, nil
+	}
+
+	b.conflicts++
+	switch b.policy {
+	case config.DuplicatePolicyFirst:
+		return false, nil
+	case config.DuplicatePolicyMostSpecific:
+		return row.hasCoords || !hasCoords, nil
+	case config.DuplicatePolicyError:
+		return false, fmt.Errorf("%w: %s", errConflictingRecord, row.addr)
+	default:
+		return true, nil
+	}
+}
+
+// parsedRecord is a CSV record that passed validation
+type parsedRecord struct {
+	addr          netip.Addr
+	country, city string
+	lat, lon      float64
+	hasCoords     bool
+}
+
+// parseRecord validates a CSV record: ip, city, country[, latitude, longitude]
+func parseRecord(record []string) (parsedRecord, error) {
+	if len(record) != 3 && len(record) != 5 {
+		return parsedRecord{}, fmt.Errorf("invalid record format, expected 3 or 5 fields, got %d", len(record))
+	}
+	for i, field := range record {
+		if len(field) > MaxFieldLength {
+			return parsedRecord{}, fmt.Errorf("field %d is %d bytes long, the limit is %d", i+1, len(field), MaxFieldLength)
+		}
 	}
 
 	ip := strings.TrimSpace(record[0])
@@ -96,12 +329,13 @@ func (r *FileRepository) processRecord(record []string) error {
 	country := strings.TrimSpace(record[2])
 
 	if ip == "" || city == "" || country == "" {
-		return fmt.Errorf("empty fields in record: %v", record)
+		return parsedRecord{}, fmt.Errorf("empty fields in record: %v", record)
 	}
 
 	// Validate IP format
-	if !isValidIP(ip) {
-		return fmt.Errorf("invalid IP address: %s", ip)
+	addr, ok := parseAddr(ip)
+	if !ok {
+		return parsedRecord{}, fmt.Errorf("%w: %s", models.ErrInvalidIP, ip)
 	}
 
 	location := &models.Location{
@@ -110,61 +344,391 @@ func (r *FileRepository) processRecord(record []string) error {
 	}
 
 	if err := location.ValidateLocation(); err != nil {
-		return fmt.Errorf("invalid location data: %w", err)
+		return parsedRecord{}, fmt.Errorf("%w: %w", models.ErrInvalidLocation, err)
+	}
+	if !utf8.ValidString(city) || !utf8.ValidString(country) {
+		return parsedRecord{}, fmt.Errorf("%w: names must be valid UTF-8", models.ErrInvalidLocation)
+	}
+
+	lat, lon, hasCoords, err := parseCoordinates(record)
+	if err != nil {
+		return parsedRecord{}, fmt.Errorf("%w: %w", models.ErrInvalidLocation, err)
+	}
+
+	return parsedRecord{addr: addr, country: country, city: city, lat: lat, lon: lon, hasCoords: hasCoords}, nil
+}
+
+// maxRecords returns the configured record limit
+func (r *FileRepository) maxRecords() int {
+	if r.config.MaxRecords > 0 {
+		return r.config.MaxRecords
+	}
+	return DefaultMaxRecords
+}
+
+// parseCoordinates reads the optional latitude and longitude columns. Both may be
+// left empty for locations without coordinates.
+func parseCoordinates(record []string) (lat, lon float64, ok bool, err error) {
+	if len(record) < 5 {
+		return 0, 0, false, nil
+	}
+	latField, lonField := strings.TrimSpace(record[3]), strings.TrimSpace(record[4])
+	if latField == "" && lonField == "" {
+		return 0, 0, false, nil
+	}
+
+	lat, err = strconv.ParseFloat(latField, 64)
+	if err != nil || !(lat >= -90 && lat <= 90) {
+		return 0, 0, false, fmt.Errorf("invalid latitude %q", latField)
+	}
+	lon, err = strconv.ParseFloat(lonField, 64)
+	if err != nil || !(lon >= -180 && lon <= 180) {
+		return 0, 0, false, fmt.Errorf("invalid longitude %q", lonField)
+	}
+	return lat, lon, true, nil
+}
+
+// FindLocation finds the location for a given IP address
+func (r *FileRepository) FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("lookup aborted: %w", err)
+	}
+
+	snap := r.snap.Load()
+	if snap == nil {
+		return nil, fmt.Errorf("repository not initialized")
+	}
+
+	location, exists := snap.get(addr.Unmap())
+	if !exists {
+		return nil, fmt.Errorf("%w for IP: %s", ErrNotFound, addr)
+	}
+
+	return location, nil
+}
+
+// Upsert stores the location for ip in memory; Flush writes it to the data file
+func (r *FileRepository) Upsert(ctx context.Context, addr netip.Addr, location models.Location) error {
+	if !addr.IsValid() {
+		return fmt.Errorf("%w: IP address cannot be empty", models.ErrInvalidIP)
+	}
+	addr = addr.Unmap()
+	location, err := validateLocation(location)
+	if err != nil {
+		return err
 	}
 
 	r.mu.Lock()
-	r.data[ip] = location
-	r.mu.Unlock()
+	defer r.mu.Unlock()
 
+	snap := r.snap.Load()
+	if snap == nil {
+		return fmt.Errorf("repository not initialized")
+	}
+	if _, exists := snap.lookup(addr); !exists && snap.records >= r.maxRecords() {
+		return fmt.Errorf("%w: the limit is %d", errTooManyRecords, r.maxRecords())
+	}
+	idx := r.addLocation(location)
+	r.snap.Store(snap.with(addr, idx, r.locations.locations))
+	r.changes++
 	return nil
 }
 
-// FindLocation finds the location for a given IP address
-func (r *FileRepository) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
+// Delete removes ip from memory; Flush removes it from the data file
+func (r *FileRepository) Delete(ctx context.Context, addr netip.Addr) error {
+	addr = addr.Unmap()
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snap := r.snap.Load()
+	if snap == nil {
+		return fmt.Errorf("repository not initialized")
+	}
+	if _, exists := snap.lookup(addr); !addr.IsValid() || !exists {
+		return fmt.Errorf("%w for IP: %s", ErrNotFound, addr)
+	}
+	// The location stays in the table; it is reclaimed by the next BulkLoad or Initialize
+	r.snap.Store(snap.with(addr, deleted, snap.locations))
+	r.changes++
+	return nil
+}
+
+// BulkLoad replaces the in-memory dataset with records; Flush rewrites the data file
+func (r *FileRepository) BulkLoad(ctx context.Context, records []Record) error {
+	builder := newDatasetBuilder(r.maxRecords())
+	for i, record := range records {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("bulk load aborted: %w", err)
+		}
+		record, err := validateRecord(record)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
+		}
+		if err := builder.add(record); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.locations = builder.locations
+	r.snap.Store(builder.snapshot())
+	r.loadTime = time.Now()
+	r.modTime = r.loadTime // The records replaced the file's
+	r.changes++
+	return nil
+}
+
+// Flush writes the in-memory dataset to the data file if it changed since it was
+// loaded or last flushed. The file is replaced atomically and the dataset version
+// becomes the hash of the new contents.
+func (r *FileRepository) Flush(ctx context.Context) error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	// The snapshot is immutable, so it can be copied out after the lock is released
 	r.mu.RLock()
-	loaded := r.loaded
+	changes, flushed := r.changes, r.flushed
+	snap := r.snap.Load()
 	r.mu.RUnlock()
+	if changes == flushed || snap == nil {
+		return nil
+	}
 
-	if !loaded {
-		return nil, fmt.Errorf("repository not initialized")
+	records := snap.sortedRecords()
+	withCoordinates := false
+	for _, record := range records {
+		if _, _, ok := record.Location.Coordinates(); ok {
+			withCoordinates = true
+			break
+		}
 	}
 
-	// Normalize IP for lookup
-	normalizedIP := normalizeIP(ip)
+	version, err := r.writeFile(records, withCoordinates)
+	if err != nil {
+		return err
+	}
 
+	r.mu.Lock()
+	r.flushed = changes
+	r.version = version
+	r.mu.Unlock()
+	return nil
+}
+
+// writeFile atomically replaces the data file with records and returns the content hash
+func (r *FileRepository) writeFile(records []Record, withCoordinates bool) (string, error) {
 	r.mu.RLock()
-	location, exists := r.data[normalizedIP]
+	compression := r.compression
 	r.mu.RUnlock()
+	if compression == CompressionZstd {
+		return "", errZstdReadOnly
+	}
+	if r.config.Type == config.DatabaseTypeParquet {
+		return "", errParquetReadOnly
+	}
+	if r.fsys != nil {
+		return "", errEmbeddedReadOnly
+	}
 
-	if !exists {
-		return nil, fmt.Errorf("location not found for IP: %s", ip)
+	tmp, err := os.CreateTemp(filepath.Dir(r.config.FilePath), ".dataset-*.csv")
+	if err != nil {
+		return "", fmt.Errorf("failed to write data file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// The version hashes the file as stored, so hash after compression
+	hasher := sha256.New()
+	var out io.Writer = io.MultiWriter(tmp, hasher)
+	var gz *gzip.Writer
+	if compression == CompressionGzip {
+		gz = gzip.NewWriter(out)
+		out = gz
 	}
+	writer := csv.NewWriter(out)
+	if withCoordinates {
+		writer.Write([]string{"ip", "city", "country", "latitude", "longitude"})
+	} else {
+		writer.Write([]string{"ip", "city", "country"})
+	}
+	for _, record := range records {
+		row := []string{record.IP, record.Location.City, record.Location.Country}
+		if withCoordinates {
+			lat, lon, ok := record.Location.Coordinates()
+			if ok {
+				row = append(row, strconv.FormatFloat(lat, 'f', -1, 64), strconv.FormatFloat(lon, 'f', -1, 64))
+			} else {
+				row = append(row, "", "")
+			}
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+
+	err = writer.Error()
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write data file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write data file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.config.FilePath); err != nil {
+		return "", fmt.Errorf("failed to write data file: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))[:12], nil
+}
+
+// addLocation stores location in the table; caller must hold the write lock
+func (r *FileRepository) addLocation(location models.Location) uint32 {
+	return addLocation(r.locations, location)
+}
 
+func addLocation(table *locationTable, location models.Location) uint32 {
+	if lat, lon, ok := location.Coordinates(); ok {
+		return table.AddWithCoordinates(location.Country, location.City, lat, lon)
+	}
+	return table.Add(location.Country, location.City)
+}
+
+// validateRecord checks a record passed to BulkLoad and normalizes its IP address
+func validateRecord(record Record) (Record, error) {
+	addr, ok := parseAddr(record.IP)
+	if !ok {
+		return Record{}, fmt.Errorf("%w: %s", models.ErrInvalidIP, record.IP)
+	}
+	record.IP = addr.String()
+
+	location, err := validateLocation(record.Location)
+	if err != nil {
+		return Record{}, err
+	}
+	record.Location = location
+	return record, nil
+}
+
+// validateLocation trims a written location to the fields the data file keeps and
+// checks them
+func validateLocation(written models.Location) (models.Location, error) {
+	location := models.Location{
+		Country:   strings.TrimSpace(written.Country),
+		City:      strings.TrimSpace(written.City),
+		Latitude:  written.Latitude,
+		Longitude: written.Longitude,
+	}
+	if err := location.ValidateLocation(); err != nil {
+		return models.Location{}, fmt.Errorf("%w: %w", models.ErrInvalidLocation, err)
+	}
+	if len(location.Country) > MaxFieldLength || len(location.City) > MaxFieldLength {
+		return models.Location{}, fmt.Errorf("%w: names are limited to %d bytes", models.ErrInvalidLocation, MaxFieldLength)
+	}
+	if !utf8.ValidString(location.City) || !utf8.ValidString(location.Country) {
+		return models.Location{}, fmt.Errorf("%w: names must be valid UTF-8", models.ErrInvalidLocation)
+	}
+	if (location.Latitude == nil) != (location.Longitude == nil) {
+		return models.Location{}, fmt.Errorf("%w: latitude and longitude must be set together", models.ErrInvalidLocation)
+	}
+	if lat, lon, ok := location.Coordinates(); ok && !(lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180) {
+		return models.Location{}, fmt.Errorf("%w: coordinates out of range", models.ErrInvalidLocation)
+	}
 	return location, nil
 }
 
-// Close cleans up resources
+// MemoryStats returns the memory footprint recorded during the last Initialize
+func (r *FileRepository) MemoryStats() MemoryStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.memStats
+}
+
+// SampleIPs returns up to n addresses from the loaded data, chosen by reservoir sampling
+func (r *FileRepository) SampleIPs(n int) []string {
+	if n <= 0 {
+		return nil
+	}
+
+	snap := r.snap.Load()
+	if snap == nil {
+		return []string{}
+	}
+
+	sample := make([]string, 0, min(n, snap.records))
+	seen := 0
+	snap.each(func(addr netip.Addr, _ uint32) bool {
+		seen++
+		if len(sample) < n {
+			sample = append(sample, addr.String())
+		} else if j := rand.IntN(seen); j < n {
+			sample[j] = addr.String()
+		}
+		return true
+	})
+	return sample
+}
+
+// Records returns every address and its location, sorted by address
+func (r *FileRepository) Records() []Record {
+	snap := r.snap.Load()
+	if snap == nil {
+		return nil
+	}
+	return snap.sortedRecords()
+}
+
+// RecordCount returns the number of addresses loaded
+func (r *FileRepository) RecordCount() int {
+	snap := r.snap.Load()
+	if snap == nil {
+		return 0
+	}
+	return snap.records
+}
+
+// Version returns a short content hash of the loaded data file
+func (r *FileRepository) Version() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.version
+}
+
+// ModTime returns the modification time of the loaded data file, or when records
+// were last bulk loaded
+func (r *FileRepository) ModTime() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.modTime
+}
+
+// Close flushes pending writes and cleans up resources
 func (r *FileRepository) Close() error {
+	flushErr := r.Flush(context.Background())
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.data = nil
-	r.loaded = false
-	return nil
+	r.snap.Store(nil)
+	r.locations = newLocationTable()
+	return flushErr
 }
 
 // HealthCheck checks if the repository is healthy
 func (r *FileRepository) HealthCheck(ctx context.Context) error {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	if !r.loaded {
+	if r.snap.Load() == nil {
 		return fmt.Errorf("repository not loaded")
 	}
 
-	// Check if data file still exists and is readable
+	// Check if data file still exists and is readable; embedded files always do
+	if r.fsys != nil {
+		return nil
+	}
 	if _, err := os.Stat(r.config.FilePath); os.IsNotExist(err) {
 		return fmt.Errorf("data file does not exist: %s", r.config.FilePath)
 	}
@@ -174,14 +738,17 @@ func (r *FileRepository) HealthCheck(ctx context.Context) error {
 
 // Helper functions
 
-func isValidIP(ip string) bool {
-	// Use Go's built-in IP parsing for proper validation
-	parsedIP := net.ParseIP(ip)
-	return parsedIP != nil
+// parseAddr parses a dataset or write address, ignoring surrounding whitespace, into
+// the key it is stored under
+func parseAddr(ip string) (netip.Addr, bool) {
+	addr, err := models.ParseIP(strings.TrimSpace(ip))
+	return addr, err == nil
 }
 
-func normalizeIP(ip string) string {
-	// Simple normalization - just trim whitespace
-	// In a real implementation, you might want to handle IPv6 normalization
-	return strings.TrimSpace(ip)
+// currentHeapInUse returns the live heap size after forcing a collection
+func currentHeapInUse() uint64 {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapInuse
 }
@@ -1,13 +1,21 @@
 package repository
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/models"
 )
 
 // Test data constants
@@ -47,7 +55,7 @@ func TestFileRepository_Initialize(t *testing.T) {
 		FilePath: testFile,
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 
 	// Initialize repository
 	ctx := context.Background()
@@ -57,7 +65,7 @@ func TestFileRepository_Initialize(t *testing.T) {
 	}
 
 	// Test finding location
-	location, err := repo.FindLocation(ctx, testIP1)
+	location, err := repo.FindLocation(ctx, netip.MustParseAddr(testIP1))
 	if err != nil {
 		t.Fatalf("Failed to find location: %v", err)
 	}
@@ -71,7 +79,7 @@ func TestFileRepository_Initialize(t *testing.T) {
 	}
 
 	// Test non-existent IP
-	_, err = repo.FindLocation(ctx, nonExistentIP)
+	_, err = findLocation(ctx, repo, nonExistentIP)
 	if err == nil {
 		t.Error("Expected error for non-existent IP")
 	}
@@ -101,7 +109,7 @@ func TestFileRepository_InvalidData(t *testing.T) {
 		FilePath: testFile,
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 
 	// Initialize repository (should handle invalid data gracefully)
 	ctx := context.Background()
@@ -111,7 +119,7 @@ func TestFileRepository_InvalidData(t *testing.T) {
 	}
 
 	// Should still be able to find valid IPs
-	location, err := repo.FindLocation(ctx, testIP1)
+	location, err := repo.FindLocation(ctx, netip.MustParseAddr(testIP1))
 	if err != nil {
 		t.Fatalf("Failed to find location: %v", err)
 	}
@@ -128,7 +136,7 @@ func TestFileRepository_FileNotFound(t *testing.T) {
 		FilePath: "/non/existent/file.csv",
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 
 	// Initialize repository should fail
 	ctx := context.Background()
@@ -145,11 +153,11 @@ func TestFileRepository_NotInitialized(t *testing.T) {
 		FilePath: "/some/file.csv",
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 
 	// FindLocation should fail
 	ctx := context.Background()
-	_, err := repo.FindLocation(ctx, "1.1.1.1")
+	_, err := repo.FindLocation(ctx, netip.MustParseAddr("1.1.1.1"))
 	if err == nil {
 		t.Error("Expected error for uninitialized repository")
 	}
@@ -172,7 +180,7 @@ func TestFileRepository_ConcurrentAccess(t *testing.T) {
 		FilePath: testFile,
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 
 	// Initialize repository
 	ctx := context.Background()
@@ -186,7 +194,7 @@ func TestFileRepository_ConcurrentAccess(t *testing.T) {
 
 	for i := 0; i < 10; i++ {
 		go func() {
-			_, err := repo.FindLocation(ctx, testIP1)
+			_, err := repo.FindLocation(ctx, netip.MustParseAddr(testIP1))
 			if err != nil {
 				t.Errorf("Concurrent access failed: %v", err)
 			}
@@ -200,54 +208,6 @@ func TestFileRepository_ConcurrentAccess(t *testing.T) {
 	}
 }
 
-func TestFileRepository_Performance(t *testing.T) {
-	// This test intentionally takes time to verify tests are actually running
-	time.Sleep(200 * time.Millisecond)
-
-	// Create temporary test file
-	tempDir := t.TempDir()
-	testFile := filepath.Join(tempDir, "performance_test.csv")
-
-	// Write test data
-	err := os.WriteFile(testFile, []byte(testCSVData), 0644)
-	if err != nil {
-		t.Fatalf("Failed to create test file: %v", err)
-	}
-
-	// Create repository
-	cfg := &config.DatabaseConfig{
-		Type:     "csv",
-		FilePath: testFile,
-	}
-
-	repo := NewFileRepository(cfg)
-
-	// Initialize repository
-	ctx := context.Background()
-	err = repo.Initialize(ctx)
-	if err != nil {
-		t.Fatalf("Failed to initialize repository: %v", err)
-	}
-
-	// Test performance
-	start := time.Now()
-	for i := 0; i < 100; i++ {
-		_, err := repo.FindLocation(ctx, testIP1)
-		if err != nil {
-			t.Errorf("Performance test failed: %v", err)
-		}
-	}
-	duration := time.Since(start)
-
-	// Verify it took some time (but not too much)
-	if duration < 1*time.Microsecond {
-		t.Errorf("Expected performance test to take at least 1µs, got %v", duration)
-	}
-
-	// Log the actual duration for verification
-	t.Logf("Performance test completed in %v", duration)
-}
-
 // TestEdgeCases tests various edge cases
 func TestFileRepository_EdgeCases(t *testing.T) {
 	// Create temporary test file
@@ -274,7 +234,7 @@ func TestFileRepository_EdgeCases(t *testing.T) {
 		FilePath: testFile,
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 
 	// Initialize repository
 	ctx := context.Background()
@@ -299,7 +259,7 @@ func TestFileRepository_EdgeCases(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			location, err := repo.FindLocation(ctx, tc.ip)
+			location, err := findLocation(ctx, repo, tc.ip)
 			if err != nil {
 				t.Errorf("Expected to find location for %s, got error: %v", tc.ip, err)
 				return
@@ -311,19 +271,19 @@ func TestFileRepository_EdgeCases(t *testing.T) {
 	}
 
 	// Test non-existent IP
-	_, err = repo.FindLocation(ctx, "999.999.999.999")
+	_, err = findLocation(ctx, repo, "999.999.999.999")
 	if err == nil {
 		t.Error("Expected error for non-existent IP")
 	}
 
 	// Test empty IP
-	_, err = repo.FindLocation(ctx, "")
+	_, err = findLocation(ctx, repo, "")
 	if err == nil {
 		t.Error("Expected error for empty IP")
 	}
 
 	// Test invalid IP format
-	_, err = repo.FindLocation(ctx, "not-an-ip")
+	_, err = findLocation(ctx, repo, "not-an-ip")
 	if err == nil {
 		t.Error("Expected error for invalid IP format")
 	}
@@ -346,7 +306,7 @@ func TestFileRepository_Close(t *testing.T) {
 		FilePath: testFile,
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 	ctx := context.Background()
 	err = repo.Initialize(ctx)
 	if err != nil {
@@ -383,7 +343,7 @@ func TestFileRepository_HealthCheck(t *testing.T) {
 		FilePath: testFile,
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 	ctx := context.Background()
 
 	// Test HealthCheck before initialization
@@ -418,7 +378,7 @@ func TestFileRepository_HealthCheck_NotInitialized(t *testing.T) {
 		FilePath: "/nonexistent/path.csv",
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 	ctx := context.Background()
 
 	// Test HealthCheck on uninitialized repository
@@ -434,7 +394,7 @@ func TestFileRepository_Initialize_FileNotFound(t *testing.T) {
 		FilePath: "/nonexistent/path.csv",
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 	ctx := context.Background()
 
 	// Test Initialize with non-existent file
@@ -465,7 +425,7 @@ func TestFileRepository_Initialize_InvalidCSV(t *testing.T) {
 		FilePath: testFile,
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 	ctx := context.Background()
 
 	// Test Initialize with invalid CSV
@@ -492,7 +452,7 @@ func TestFileRepository_Initialize_EmptyFile(t *testing.T) {
 		FilePath: testFile,
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 	ctx := context.Background()
 
 	// Test Initialize with empty file
@@ -521,7 +481,7 @@ func TestFileRepository_Initialize_HeaderOnly(t *testing.T) {
 		FilePath: testFile,
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 	ctx := context.Background()
 
 	// Test Initialize with header only
@@ -531,7 +491,7 @@ func TestFileRepository_Initialize_HeaderOnly(t *testing.T) {
 	}
 
 	// Test FindLocation with no data
-	_, err = repo.FindLocation(ctx, "1.1.1.1")
+	_, err = repo.FindLocation(ctx, netip.MustParseAddr("1.1.1.1"))
 	if err == nil {
 		t.Error("Expected error for FindLocation with no data")
 	}
@@ -567,7 +527,7 @@ invalid-ip,Invalid City,Invalid Country
 		FilePath: testFile,
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 	ctx := context.Background()
 	err = repo.Initialize(ctx)
 	if err != nil {
@@ -595,7 +555,7 @@ invalid-ip,Invalid City,Invalid Country
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			_, err := repo.FindLocation(ctx, tc.ip)
+			_, err := findLocation(ctx, repo, tc.ip)
 			if tc.expectError {
 				if err == nil {
 					t.Errorf("Expected error for %s, got nil. %s", tc.ip, tc.description)
@@ -626,7 +586,7 @@ func TestFileRepository_IsValidIP(t *testing.T) {
 		FilePath: testFile,
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 	ctx := context.Background()
 	err = repo.Initialize(ctx)
 	if err != nil {
@@ -654,7 +614,7 @@ func TestFileRepository_IsValidIP(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.ip, func(t *testing.T) {
-			_, err := repo.FindLocation(ctx, tc.ip)
+			_, err := findLocation(ctx, repo, tc.ip)
 			// If the IP is valid, we should either find it or get a "not found" error
 			// If the IP is invalid, we should get a validation error
 			if tc.expected {
@@ -689,7 +649,7 @@ func TestFileRepository_ConcurrentAccess_Extended(t *testing.T) {
 		FilePath: testFile,
 	}
 
-	repo := NewFileRepository(cfg)
+	repo := NewFileRepository(cfg, slog.Default())
 	ctx := context.Background()
 	err = repo.Initialize(ctx)
 	if err != nil {
@@ -705,7 +665,7 @@ func TestFileRepository_ConcurrentAccess_Extended(t *testing.T) {
 
 			// Make multiple concurrent requests
 			for j := 0; j < 5; j++ {
-				_, err := repo.FindLocation(ctx, "1.1.1.1")
+				_, err := repo.FindLocation(ctx, netip.MustParseAddr("1.1.1.1"))
 				if err != nil {
 					t.Errorf("Concurrent FindLocation failed: %v", err)
 				}
@@ -718,3 +678,552 @@ func TestFileRepository_ConcurrentAccess_Extended(t *testing.T) {
 		<-done
 	}
 }
+
+func TestFileRepository_MemoryStats(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "test_data.csv")
+
+	data := `ip,city,country
+1.1.1.1,New York,United States
+1.1.1.2,New York,United States
+1.1.1.3,New York,United States
+8.8.8.8,Mountain View,United States`
+
+	err := os.WriteFile(testFile, []byte(data), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	cfg := &config.DatabaseConfig{
+		Type:     "csv",
+		FilePath: testFile,
+	}
+
+	repo := NewFileRepository(cfg, slog.Default())
+	ctx := context.Background()
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Failed to initialize repository: %v", err)
+	}
+
+	stats := repo.MemoryStats()
+	if stats.Records != 4 {
+		t.Errorf("Expected 4 records, got %d", stats.Records)
+	}
+	if stats.UniqueLocations != 2 {
+		t.Errorf("Expected 2 unique locations, got %d", stats.UniqueLocations)
+	}
+	if stats.UniqueStrings != 3 {
+		t.Errorf("Expected 3 unique strings, got %d", stats.UniqueStrings)
+	}
+	if stats.CompactBytes >= stats.NaiveBytes {
+		t.Errorf("Expected compact bytes (%d) < naive bytes (%d)", stats.CompactBytes, stats.NaiveBytes)
+	}
+
+	// Rows with the same location should share a single Location value
+	loc1, _ := repo.FindLocation(ctx, netip.MustParseAddr("1.1.1.1"))
+	loc2, _ := repo.FindLocation(ctx, netip.MustParseAddr("1.1.1.2"))
+	if loc1 != loc2 {
+		t.Error("Expected rows with identical locations to share the same Location")
+	}
+
+	var _ MemoryStatsProvider = repo
+}
+
+func TestFileRepository_Version(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "test_data.csv")
+	if err := os.WriteFile(testFile, []byte(testCSVData), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	load := func() string {
+		repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile}, slog.Default())
+		if err := repo.Initialize(context.Background()); err != nil {
+			t.Fatalf("Failed to initialize repository: %v", err)
+		}
+		return repo.Version()
+	}
+
+	first := load()
+	if len(first) != 12 {
+		t.Fatalf("Version() = %q, want 12 hex characters", first)
+	}
+	if again := load(); again != first {
+		t.Errorf("Version() changed for identical data: %s != %s", again, first)
+	}
+
+	if err := os.WriteFile(testFile, []byte(testCSVData+"\n9.9.9.9,Berkeley,United States"), 0644); err != nil {
+		t.Fatalf("Failed to update test file: %v", err)
+	}
+	if changed := load(); changed == first {
+		t.Error("Version() did not change when the data changed")
+	}
+}
+
+func TestFileRepository_ModTime(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test_data.csv")
+	if err := os.WriteFile(testFile, []byte(testCSVData), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	modified := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(testFile, time.Time{}, modified); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile}, slog.Default())
+	if err := repo.Initialize(context.Background()); err != nil {
+		t.Fatalf("Failed to initialize repository: %v", err)
+	}
+	if !repo.ModTime().Equal(modified) {
+		t.Errorf("ModTime() = %v, want the file's %v", repo.ModTime(), modified)
+	}
+
+	// Bulk loaded records are as new as the load
+	before := time.Now()
+	if err := repo.BulkLoad(context.Background(), []Record{{IP: "9.9.9.9", Location: models.Location{City: "Berkeley", Country: "United States"}}}); err != nil {
+		t.Fatalf("BulkLoad() error = %v", err)
+	}
+	if repo.ModTime().Before(before) {
+		t.Errorf("ModTime() = %v after a bulk load, want at least %v", repo.ModTime(), before)
+	}
+
+	var _ ModTimeProvider = repo
+}
+
+func TestFileRepository_SampleIPs(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test_data.csv")
+	if err := os.WriteFile(testFile, []byte(testCSVData), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile}, slog.Default())
+	if err := repo.Initialize(context.Background()); err != nil {
+		t.Fatalf("Failed to initialize repository: %v", err)
+	}
+
+	if got := repo.SampleIPs(2); len(got) != 2 {
+		t.Errorf("SampleIPs(2) returned %d addresses, want 2", len(got))
+	}
+
+	all := repo.SampleIPs(10)
+	if len(all) != 3 {
+		t.Fatalf("SampleIPs(10) returned %d addresses, want all 3", len(all))
+	}
+	for _, ip := range all {
+		if _, err := repo.FindLocation(context.Background(), netip.MustParseAddr(ip)); err != nil {
+			t.Errorf("Sampled address %s not found: %v", ip, err)
+		}
+	}
+
+	if got := repo.SampleIPs(0); len(got) != 0 {
+		t.Errorf("SampleIPs(0) returned %d addresses, want none", len(got))
+	}
+}
+
+func TestFileRepository_Records(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test_data.csv")
+	if err := os.WriteFile(testFile, []byte("ip,city,country\n8.8.8.8,Mountain View,United States\n1.1.1.1,Sydney,Australia\n::1,Local,Private\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile}, slog.Default())
+	if repo.Records() != nil {
+		t.Error("Expected no records before loading")
+	}
+	if err := repo.Initialize(context.Background()); err != nil {
+		t.Fatalf("Failed to initialize repository: %v", err)
+	}
+
+	records := repo.Records()
+	var ips []string
+	for _, record := range records {
+		ips = append(ips, record.IP)
+	}
+	if strings.Join(ips, ",") != "1.1.1.1,8.8.8.8,::1" {
+		t.Errorf("Records() = %v, want sorted by address", ips)
+	}
+	if records[0].Location.City != "Sydney" {
+		t.Errorf("Expected 1.1.1.1 in Sydney, got %+v", records[0].Location)
+	}
+}
+
+func TestFileRepository_DuplicatePolicy(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "duplicates.csv")
+	data := `ip,city,country,latitude,longitude
+8.8.8.8,Mountain View,United States,37.38,-122.08
+1.1.1.1,Sydney,Australia,,
+8.8.8.8,Mountain View,United States,37.38,-122.08
+8.8.8.8,Reston,United States,,
+::ffff:1.1.1.1,Brisbane,Australia,-27.47,153.03`
+
+	if err := os.WriteFile(testFile, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		policy     string
+		want8888   string
+		want1111   string
+		wantFailed bool
+	}{
+		{"", "Reston", "Brisbane", false},
+		{config.DuplicatePolicyLast, "Reston", "Brisbane", false},
+		{config.DuplicatePolicyFirst, "Mountain View", "Sydney", false},
+		{config.DuplicatePolicyMostSpecific, "Mountain View", "Brisbane", false},
+		{config.DuplicatePolicyError, "", "", true},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		var logs bytes.Buffer
+		repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile, Duplicates: tt.policy}, slog.New(slog.NewTextHandler(&logs, nil)))
+		err := repo.Initialize(ctx)
+		if tt.wantFailed {
+			if !errors.Is(err, errConflictingRecord) || !strings.Contains(err.Error(), "line 5") {
+				t.Errorf("%q: expected a conflict on line 5, got %v", tt.policy, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: Initialize() error = %v", tt.policy, err)
+		}
+
+		for ip, want := range map[string]string{"8.8.8.8": tt.want8888, "1.1.1.1": tt.want1111} {
+			location, err := repo.FindLocation(ctx, netip.MustParseAddr(ip))
+			if err != nil || location.City != want {
+				t.Errorf("%q: %s = %v, %v, want %s", tt.policy, ip, location, err, want)
+			}
+		}
+		if stats := repo.MemoryStats(); stats.Records != 2 || stats.Duplicates != 1 || stats.Conflicts != 2 {
+			t.Errorf("%q: unexpected load summary %+v", tt.policy, stats)
+		}
+		if got := strings.Count(logs.String(), "different location"); got != 2 {
+			t.Errorf("%q: expected 2 conflicts logged, got %d:\n%s", tt.policy, got, logs.String())
+		}
+	}
+}
+
+func TestFileRepository_Coordinates(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "coordinates.csv")
+	data := `ip,city,country,latitude,longitude
+1.1.1.1,London,United Kingdom,51.5074,-0.1278
+10.0.0.1,Local Network,Private,,
+2.2.2.2,Nowhere,Atlantis,95,0`
+
+	if err := os.WriteFile(testFile, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile}, slog.Default())
+	ctx := context.Background()
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Failed to initialize repository: %v", err)
+	}
+
+	location, err := repo.FindLocation(ctx, netip.MustParseAddr("1.1.1.1"))
+	if err != nil {
+		t.Fatalf("FindLocation() error = %v", err)
+	}
+	if lat, lon, ok := location.Coordinates(); !ok || lat != 51.5074 || lon != -0.1278 {
+		t.Errorf("Coordinates() = %v, %v, %v", lat, lon, ok)
+	}
+
+	location, err = repo.FindLocation(ctx, netip.MustParseAddr("10.0.0.1"))
+	if err != nil {
+		t.Fatalf("FindLocation() error = %v", err)
+	}
+	if _, _, ok := location.Coordinates(); ok {
+		t.Error("Expected no coordinates when the columns are empty")
+	}
+
+	// Rows with out-of-range coordinates are skipped
+	if _, err := repo.FindLocation(ctx, netip.MustParseAddr("2.2.2.2")); err == nil {
+		t.Error("Expected row with invalid latitude to be skipped")
+	}
+}
+
+func TestFileRepository_Writes(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "writable.csv")
+	data := `ip,city,country
+1.1.1.1,New York,United States
+8.8.8.8,Mountain View,United States`
+	if err := os.WriteFile(testFile, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	cfg := &config.DatabaseConfig{Type: "csv", FilePath: testFile}
+	repo := NewFileRepository(cfg, slog.Default())
+	ctx := context.Background()
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Failed to initialize repository: %v", err)
+	}
+	version := repo.Version()
+
+	lat, lon := 51.5074, -0.1278
+	if err := repo.Upsert(ctx, netip.MustParseAddr("9.9.9.9"), models.Location{Country: "United Kingdom", City: "London", Latitude: &lat, Longitude: &lon}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if err := repo.Delete(ctx, netip.MustParseAddr("1.1.1.1")); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := repo.Delete(ctx, netip.MustParseAddr("1.1.1.1")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete() of a missing IP error = %v, want ErrNotFound", err)
+	}
+	if err := repo.Upsert(ctx, netip.Addr{}, models.Location{Country: "X", City: "Y"}); !errors.Is(err, models.ErrInvalidIP) {
+		t.Errorf("Upsert() without an address error = %v, want ErrInvalidIP", err)
+	}
+
+	// Writes are visible before they are flushed
+	if location, err := repo.FindLocation(ctx, netip.MustParseAddr("9.9.9.9")); err != nil || location.City != "London" {
+		t.Fatalf("FindLocation() after Upsert = %v, %v", location, err)
+	}
+	if _, err := repo.FindLocation(ctx, netip.MustParseAddr("1.1.1.1")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindLocation() after Delete error = %v, want ErrNotFound", err)
+	}
+
+	if err := repo.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if repo.Version() == version {
+		t.Error("Expected the dataset version to change after Flush")
+	}
+
+	reloaded := NewFileRepository(cfg, slog.Default())
+	if err := reloaded.Initialize(ctx); err != nil {
+		t.Fatalf("Failed to reload flushed file: %v", err)
+	}
+	if reloaded.Version() != repo.Version() {
+		t.Errorf("Reloaded version = %s, want %s", reloaded.Version(), repo.Version())
+	}
+	location, err := reloaded.FindLocation(ctx, netip.MustParseAddr("9.9.9.9"))
+	if err != nil {
+		t.Fatalf("FindLocation() after reload error = %v", err)
+	}
+	if gotLat, gotLon, ok := location.Coordinates(); !ok || gotLat != lat || gotLon != lon {
+		t.Errorf("Reloaded coordinates = %v, %v, %v", gotLat, gotLon, ok)
+	}
+	if _, err := reloaded.FindLocation(ctx, netip.MustParseAddr("8.8.8.8")); err != nil {
+		t.Errorf("Expected untouched record to survive Flush: %v", err)
+	}
+	if _, err := reloaded.FindLocation(ctx, netip.MustParseAddr("1.1.1.1")); err == nil {
+		t.Error("Expected deleted record to be gone after Flush")
+	}
+}
+
+func TestFileRepository_BulkLoad(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "bulk.csv")
+	repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile}, slog.Default())
+	ctx := context.Background()
+
+	records := []Record{
+		{IP: "1.1.1.1", Location: models.Location{Country: "United States", City: "New York"}},
+		{IP: "8.8.8.8", Location: models.Location{Country: "United States", City: "Mountain View"}},
+	}
+	if err := repo.BulkLoad(ctx, records); err != nil {
+		t.Fatalf("BulkLoad() error = %v", err)
+	}
+
+	// An invalid record rejects the whole load
+	invalid := []Record{records[1], {IP: "9.9.9.9", Location: models.Location{Country: "Nowhere"}}}
+	if err := repo.BulkLoad(ctx, invalid); err == nil {
+		t.Fatal("BulkLoad() with invalid record expected error")
+	}
+	if _, err := repo.FindLocation(ctx, netip.MustParseAddr("1.1.1.1")); err != nil {
+		t.Errorf("Expected failed BulkLoad to leave data unchanged: %v", err)
+	}
+
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	written, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("Expected Close to flush the data file: %v", err)
+	}
+	want := "ip,city,country\n1.1.1.1,New York,United States\n8.8.8.8,Mountain View,United States\n"
+	if string(written) != want {
+		t.Errorf("Data file = %q, want %q", written, want)
+	}
+}
+
+// findLocation parses ip the way the service does and looks it up in repo
+func findLocation(ctx context.Context, repo IPRepository, ip string) (*models.Location, error) {
+	addr, err := models.ParseIP(ip)
+	if err != nil {
+		return nil, err
+	}
+	return repo.FindLocation(ctx, addr)
+}
+
+// newBenchmarkRepository builds a loaded repository with n addresses spread over
+// 1,000 locations, bypassing CSV parsing so large datasets build quickly
+func newBenchmarkRepository(n int) (*FileRepository, []netip.Addr) {
+	repo := NewFileRepository(&config.DatabaseConfig{Type: "csv"}, slog.Default())
+	builder := newDatasetBuilder(n)
+
+	sample := make([]netip.Addr, 0, 1024)
+	for i := 0; i < n; i++ {
+		ip := netip.AddrFrom4([4]byte{byte(i>>24) + 1, byte(i >> 16), byte(i >> 8), byte(i)})
+		builder.data[ip] = builder.locations.Add(fmt.Sprintf("Country %d", i%200), fmt.Sprintf("City %d", i%1000))
+		if i%(n/cap(sample)+1) == 0 && len(sample) < cap(sample) {
+			sample = append(sample, ip)
+		}
+	}
+	repo.locations = builder.locations
+	repo.snap.Store(builder.snapshot())
+	return repo, sample
+}
+
+func BenchmarkFindLocation(b *testing.B) {
+	for _, size := range []int{1_000_000, 10_000_000} {
+		b.Run(fmt.Sprintf("entries=%dM", size/1_000_000), func(b *testing.B) {
+			if size > 1_000_000 && testing.Short() {
+				b.Skip("skipping 10M entry dataset in short mode")
+			}
+			repo, sample := newBenchmarkRepository(size)
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, err := repo.FindLocation(ctx, sample[i%len(sample)]); err != nil {
+						b.Fatal(err)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestFileRepository_Bounds(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "bounds.csv")
+	data := "ip,city,country\n" +
+		"1.1.1.1," + strings.Repeat("x", MaxFieldLength+1) + ",United States\n" +
+		"2001:DB8::1,Mountain View,United States\n" +
+		"8.8.8.8,New York,United States\n" +
+		"::ffff:9.9.9.9,Zurich,Switzerland\n"
+	if err := os.WriteFile(testFile, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	ctx := context.Background()
+
+	// Oversized fields are skipped, and addresses are stored in their lookup form
+	repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile}, slog.Default())
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if _, err := repo.FindLocation(ctx, netip.MustParseAddr("1.1.1.1")); err == nil {
+		t.Error("Expected record with an oversized field to be skipped")
+	}
+	if _, err := repo.FindLocation(ctx, netip.MustParseAddr("2001:db8::1")); err != nil {
+		t.Errorf("Expected upper-case IPv6 address to be found: %v", err)
+	}
+	// IPv4-mapped addresses share the key of the plain IPv4 address
+	for _, ip := range []string{"9.9.9.9", "::ffff:9.9.9.9"} {
+		if _, err := repo.FindLocation(ctx, netip.MustParseAddr(ip)); err != nil {
+			t.Errorf("Expected %s to be found: %v", ip, err)
+		}
+	}
+
+	// Exceeding the record limit fails the load
+	limited := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile, MaxRecords: 1}, slog.Default())
+	if err := limited.Initialize(ctx); !errors.Is(err, errTooManyRecords) {
+		t.Errorf("Initialize() over the record limit error = %v, want errTooManyRecords", err)
+	}
+	if err := limited.BulkLoad(ctx, []Record{
+		{IP: "1.1.1.1", Location: models.Location{Country: "France", City: "Paris"}},
+		{IP: "8.8.8.8", Location: models.Location{Country: "France", City: "Lyon"}},
+	}); !errors.Is(err, errTooManyRecords) {
+		t.Errorf("BulkLoad() over the record limit error = %v, want errTooManyRecords", err)
+	}
+}
+
+func TestFileRepository_PathologicalRows(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "pathological.csv")
+	data := "\ufeff1.1.1.1,New York,United States\n" + // BOM before a data row
+		"2.2.2.2,\"" + strings.Repeat("x", 8<<20) + "\n" + // Multi-MB field that never closes
+		"3.3.3.3,\"Paris\nFrance\",France\n" +
+		"8.8.8.8,Mountain View,United States\n"
+	if err := os.WriteFile(testFile, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var logs bytes.Buffer
+	repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile}, slog.New(slog.NewTextHandler(&logs, nil)))
+	ctx := context.Background()
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if !strings.Contains(logs.String(), "Skipped unreadable record") {
+		t.Errorf("Expected the unreadable row to be logged, got:\n%s", logs.String())
+	}
+
+	for _, ip := range []string{"1.1.1.1", "8.8.8.8"} {
+		if _, err := repo.FindLocation(ctx, netip.MustParseAddr(ip)); err != nil {
+			t.Errorf("Expected %s to load around the bad rows: %v", ip, err)
+		}
+	}
+	for _, ip := range []string{"2.2.2.2", "3.3.3.3"} {
+		if _, err := repo.FindLocation(ctx, netip.MustParseAddr(ip)); err == nil {
+			t.Errorf("Expected the malformed row for %s to be skipped", ip)
+		}
+	}
+}
+
+func FuzzProcessRecord(f *testing.F) {
+	f.Add("1.1.1.1", "New York", "United States", "", "")
+	f.Add("2001:DB8::1", " London ", "United Kingdom", "51.5074", "-0.1278")
+	f.Add("::ffff:10.0.0.1", "City", "Country", "NaN", "1e400")
+
+	f.Fuzz(func(t *testing.T, ip, city, country, lat, lon string) {
+		for _, record := range [][]string{{ip, city, country}, {ip, city, country, lat, lon}} {
+			repo := NewFileRepository(&config.DatabaseConfig{}, slog.Default())
+			builder := newDatasetBuilder(DefaultMaxRecords)
+			if err := builder.processRecord(record); err != nil {
+				continue
+			}
+			repo.snap.Store(builder.snapshot())
+
+			// Every accepted record is found under its own address with bounded,
+			// valid fields
+			addr, _ := parseAddr(ip)
+			location, err := repo.FindLocation(context.Background(), addr)
+			if err != nil {
+				t.Fatalf("Accepted record %q not found: %v", record, err)
+			}
+			if location.City != strings.TrimSpace(city) || location.Country != strings.TrimSpace(country) {
+				t.Fatalf("Record %q stored as %+v", record, location)
+			}
+			if len(location.City) > MaxFieldLength || !utf8.ValidString(location.City) {
+				t.Fatalf("Accepted invalid city %q", location.City)
+			}
+			if lat, lon, ok := location.Coordinates(); ok && !(lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180) {
+				t.Fatalf("Accepted out-of-range coordinates %v, %v", lat, lon)
+			}
+		}
+	})
+}
+
+func FuzzFileRepository_Initialize(f *testing.F) {
+	f.Add([]byte(testCSVData))
+	f.Add([]byte("ip,city,country,latitude,longitude\n1.1.1.1,London,United Kingdom,51.5,-0.1\n10.0.0.1,Local,Private,,\n"))
+	f.Add([]byte("\"1.1.1.1\",\"New\nYork\",\"United States\"\n\"unterminated"))
+
+	const maxRecords = 50
+	f.Fuzz(func(t *testing.T, data []byte) {
+		testFile := filepath.Join(t.TempDir(), "fuzz.csv")
+		if err := os.WriteFile(testFile, data, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile, MaxRecords: maxRecords}, slog.Default())
+		if err := repo.Initialize(context.Background()); err != nil {
+			return
+		}
+		if stats := repo.MemoryStats(); stats.Records > maxRecords {
+			t.Fatalf("Loaded %d records, limit is %d", stats.Records, maxRecords)
+		}
+	})
+}
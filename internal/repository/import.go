@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+
+	"ip-geolocation-service/internal/models"
+)
+
+// maxImportIssues bounds the problems listed in an ImportReport; all are counted
+const maxImportIssues = 50
+
+// ImportIssue is a problem with one row of a dataset being imported
+type ImportIssue struct {
+	Line    int    `json:"line"`
+	IP      string `json:"ip,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportReport describes a dataset file checked by ValidateDataset. The file can be
+// imported when Valid is true.
+type ImportReport struct {
+	Valid   bool `json:"valid"`
+	Header  bool `json:"header"`  // The first row was a header
+	Columns int  `json:"columns"` // 3, or 5 with coordinates
+	Rows    int  `json:"rows"`    // Data rows read
+	Records int  `json:"records"` // Distinct addresses that would be loaded
+	Invalid int  `json:"invalid"` // Rows that would be skipped on load
+	// Duplicates repeat an earlier row's address with the same location; Conflicts
+	// give it a different one, and the later row would win
+	Duplicates int `json:"duplicates"`
+	Conflicts  int `json:"conflicts"`
+	// Fatal is set when the file can't be loaded at all (no records, too many records)
+	Fatal  string        `json:"fatal,omitempty"`
+	Errors []ImportIssue `json:"errors,omitempty"` // Invalid and conflicting rows, the first maxImportIssues
+}
+
+// ValidateDataset reads a CSV dataset the way FileRepository loads one, without
+// loading it, and reports every problem found. The records of a valid dataset are
+// returned in file order, ready for BulkLoad. maxRecords of 0 uses DefaultMaxRecords.
+func ValidateDataset(ctx context.Context, r io.Reader, maxRecords int) (*ImportReport, []Record, error) {
+	if maxRecords <= 0 {
+		maxRecords = DefaultMaxRecords
+	}
+
+	reader := newRowReader(r)
+
+	report := &ImportReport{}
+	seen := make(map[netip.Addr]int) // Address -> index in records
+	var records []Record
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, fmt.Errorf("validation aborted: %w", err)
+		}
+
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line := reader.Line()
+		var rowErr *RowError
+		if err != nil && !errors.As(err, &rowErr) {
+			return nil, nil, fmt.Errorf("failed to read dataset: %w", err)
+		}
+		if report.Columns == 0 && rowErr == nil {
+			report.Columns = len(row)
+			if _, ok := parseAddr(row[0]); !ok {
+				report.Header = true
+				continue
+			}
+		}
+
+		report.Rows++
+		if rowErr != nil {
+			report.invalid(line, "", rowErr.Err.Error())
+			continue
+		}
+		if len(row) != report.Columns {
+			report.invalid(line, "", fmt.Sprintf("expected %d fields, got %d", report.Columns, len(row)))
+			continue
+		}
+		parsed, err := parseRecord(row)
+		if err != nil {
+			report.invalid(line, row[0], err.Error())
+			continue
+		}
+
+		record := Record{IP: parsed.addr.String()}
+		record.Location.Country, record.Location.City = parsed.country, parsed.city
+		if parsed.hasCoords {
+			lat, lon := parsed.lat, parsed.lon
+			record.Location.Latitude, record.Location.Longitude = &lat, &lon
+		}
+
+		if idx, dup := seen[parsed.addr]; dup {
+			previous := records[idx].Location
+			if previous.Country == record.Location.Country && previous.City == record.Location.City && sameCoordinates(&previous, &record.Location) {
+				report.Duplicates++
+			} else {
+				report.Conflicts++
+				report.issue(line, record.IP, fmt.Sprintf("conflicts with an earlier row (%s, %s)", previous.City, previous.Country))
+			}
+			records[idx] = record
+			continue
+		}
+		if len(records) >= maxRecords {
+			report.Fatal = fmt.Sprintf("line %d: %v: the limit is %d", line, errTooManyRecords, maxRecords)
+			break
+		}
+		seen[parsed.addr] = len(records)
+		records = append(records, record)
+	}
+
+	report.Records = len(records)
+	report.Valid = report.Fatal == "" && report.Invalid == 0 && report.Conflicts == 0 && report.Records > 0
+	if report.Records == 0 && report.Fatal == "" {
+		report.Fatal = "dataset has no records"
+	}
+	if !report.Valid {
+		return report, nil, nil
+	}
+	return report, records, nil
+}
+
+// invalid counts a row that would be skipped on load
+func (r *ImportReport) invalid(line int, ip, message string) {
+	r.Invalid++
+	r.issue(line, ip, message)
+}
+
+// issue lists a problem if the list isn't full
+func (r *ImportReport) issue(line int, ip, message string) {
+	if len(r.Errors) < maxImportIssues {
+		r.Errors = append(r.Errors, ImportIssue{Line: line, IP: ip, Message: message})
+	}
+}
+
+// sameCoordinates reports whether two locations have equal (or equally missing)
+// coordinates
+func sameCoordinates(a, b *models.Location) bool {
+	latA, lonA, okA := a.Coordinates()
+	latB, lonB, okB := b.Coordinates()
+	return okA == okB && latA == latB && lonA == lonB
+}
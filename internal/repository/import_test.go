@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValidateDataset(t *testing.T) {
+	data := strings.Join([]string{
+		"ip,city,country",
+		"8.8.8.8,Mountain View,United States",
+		"9.9.9.9,Zurich,Switzerland",
+		"not-an-ip,Paris,France",
+		"8.8.8.8,Mountain View,United States", // Duplicate
+		"::ffff:9.9.9.9,Berlin,Germany",       // Conflicts with 9.9.9.9
+		"1.1.1.1,Sydney",                      // Wrong field count
+		"1.0.0.1,\"Syd\"ney\",Australia",      // Malformed quoting
+	}, "\n")
+
+	report, records, err := ValidateDataset(context.Background(), strings.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid || records != nil {
+		t.Errorf("Expected an invalid dataset, got %+v", report)
+	}
+	if !report.Header || report.Columns != 3 || report.Rows != 7 || report.Records != 2 {
+		t.Errorf("Unexpected counts: %+v", report)
+	}
+	if report.Invalid != 3 || report.Duplicates != 1 || report.Conflicts != 1 {
+		t.Errorf("Unexpected problem counts: %+v", report)
+	}
+	if len(report.Errors) != 4 || report.Errors[0].Line != 4 || report.Errors[1].IP != "9.9.9.9" || report.Errors[3].Line != 8 {
+		t.Errorf("Unexpected issues: %+v", report.Errors)
+	}
+}
+
+func TestValidateDataset_Valid(t *testing.T) {
+	data := "8.8.8.8,Mountain View,United States,37.38,-122.08\n1.1.1.1,Sydney,Australia,,\n"
+
+	report, records, err := ValidateDataset(context.Background(), strings.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.Header || report.Records != 2 || len(records) != 2 {
+		t.Fatalf("Expected a valid dataset, got %+v", report)
+	}
+	if _, _, ok := records[0].Location.Coordinates(); !ok {
+		t.Error("Expected coordinates on the first record")
+	}
+	if _, _, ok := records[1].Location.Coordinates(); ok {
+		t.Error("Expected no coordinates on the second record")
+	}
+}
+
+func TestValidateDataset_Fatal(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		maxRecords int
+	}{
+		{"only malformed rows", "8.8.8.8,\"Mountain View,United States\n", 0},
+		{"too many records", "8.8.8.8,Mountain View,United States\n1.1.1.1,Sydney,Australia\n", 1},
+		{"empty", "ip,city,country\n", 0},
+	}
+
+	for _, tt := range tests {
+		report, _, err := ValidateDataset(context.Background(), strings.NewReader(tt.data), tt.maxRecords)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Valid || report.Fatal == "" {
+			t.Errorf("%s: expected a fatal problem, got %+v", tt.name, report)
+		}
+	}
+}
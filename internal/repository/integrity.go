@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrIntegrity is returned when a data file fails checksum or signature verification
+var ErrIntegrity = errors.New("dataset integrity check failed")
+
+// SignatureSuffix names the detached signature next to a data file (data.csv.sig)
+const SignatureSuffix = ".sig"
+
+// ParsePublicKey decodes an Ed25519 public key given as hex or standard base64
+func ParsePublicKey(value string) (ed25519.PublicKey, error) {
+	key, err := decodeFixed(strings.TrimSpace(value), ed25519.PublicKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Ed25519 public key: %w", err)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// decodeFixed decodes a hex or base64 value that must be exactly size bytes long
+func decodeFixed(value string, size int) ([]byte, error) {
+	if len(value) == hex.EncodedLen(size) {
+		if b, err := hex.DecodeString(value); err == nil {
+			return b, nil
+		}
+	}
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(b) != size {
+		return nil, fmt.Errorf("want %d bytes as hex or base64", size)
+	}
+	return b, nil
+}
+
+// verifyIntegrity hashes file and checks it against the configured checksum and
+// signature, returning the SHA-256 digest. The signature is Ed25519 over the raw
+// 32-byte digest, read from the file named after the data file plus SignatureSuffix.
+// file is left positioned at the start.
+func (r *FileRepository) verifyIntegrity(file dataFile) ([]byte, error) {
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return nil, fmt.Errorf("failed to read data file %s: %w", r.config.FilePath, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read data file %s: %w", r.config.FilePath, err)
+	}
+	digest := hasher.Sum(nil)
+
+	if want := r.config.Checksum; want != "" {
+		expected, err := hex.DecodeString(strings.TrimSpace(want))
+		if err != nil || !bytes.Equal(expected, digest) {
+			return nil, fmt.Errorf("%w: %s has SHA-256 %s, want %s", ErrIntegrity, r.config.FilePath, hex.EncodeToString(digest), want)
+		}
+	}
+
+	if r.config.PublicKey != "" {
+		key, err := ParsePublicKey(r.config.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		sigPath := r.config.FilePath + SignatureSuffix
+		raw, err := os.ReadFile(sigPath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read signature: %w", ErrIntegrity, err)
+		}
+		// Accept the raw 64 bytes or their hex/base64 encoding
+		signature := raw
+		if len(raw) != ed25519.SignatureSize {
+			if signature, err = decodeFixed(strings.TrimSpace(string(raw)), ed25519.SignatureSize); err != nil {
+				return nil, fmt.Errorf("%w: invalid signature in %s: %w", ErrIntegrity, sigPath, err)
+			}
+		}
+		if !ed25519.Verify(key, digest, signature) {
+			return nil, fmt.Errorf("%w: signature %s does not match %s", ErrIntegrity, sigPath, r.config.FilePath)
+		}
+	}
+
+	return digest, nil
+}
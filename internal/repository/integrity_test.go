@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ip-geolocation-service/internal/config"
+)
+
+func TestFileRepository_Checksum(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test_data.csv")
+	if err := os.WriteFile(testFile, []byte(testCSVData), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	sum := sha256.Sum256([]byte(testCSVData))
+	good := hex.EncodeToString(sum[:])
+
+	repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile, Checksum: good}, slog.Default())
+	if err := repo.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize() with matching checksum error = %v", err)
+	}
+	if repo.Version() != good[:12] {
+		t.Errorf("Version() = %s, want %s", repo.Version(), good[:12])
+	}
+
+	// A truncated file no longer matches and nothing is loaded
+	if err := os.WriteFile(testFile, []byte(testCSVData[:len(testCSVData)-10]), 0644); err != nil {
+		t.Fatalf("Failed to truncate test file: %v", err)
+	}
+	repo = NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile, Checksum: good}, slog.Default())
+	if err := repo.Initialize(context.Background()); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("Initialize() error = %v, want ErrIntegrity", err)
+	}
+	if _, err := repo.FindLocation(context.Background(), netip.MustParseAddr(testIP1)); err == nil {
+		t.Error("Expected no data to be loaded from a rejected file")
+	}
+}
+
+func TestFileRepository_Signature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	sum := sha256.Sum256([]byte(testCSVData))
+	signature := ed25519.Sign(private, sum[:])
+
+	tests := []struct {
+		name      string
+		signature []byte // nil writes no signature file
+		key       string
+		wantErr   bool
+	}{
+		{"raw signature, hex key", signature, hex.EncodeToString(public), false},
+		{"base64 signature, base64 key", []byte(base64.StdEncoding.EncodeToString(signature) + "\n"), base64.StdEncoding.EncodeToString(public), false},
+		{"hex signature", []byte(hex.EncodeToString(signature)), hex.EncodeToString(public), false},
+		{"wrong key", signature, hex.EncodeToString(make([]byte, ed25519.PublicKeySize)), true},
+		{"corrupt signature", append([]byte{signature[0] ^ 1}, signature[1:]...), hex.EncodeToString(public), true},
+		{"missing signature", nil, hex.EncodeToString(public), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testFile := filepath.Join(t.TempDir(), "test_data.csv")
+			if err := os.WriteFile(testFile, []byte(testCSVData), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if tt.signature != nil {
+				if err := os.WriteFile(testFile+SignatureSuffix, tt.signature, 0644); err != nil {
+					t.Fatalf("Failed to write signature: %v", err)
+				}
+			}
+
+			repo := NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: testFile, PublicKey: tt.key}, slog.Default())
+			err := repo.Initialize(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Initialize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrIntegrity) {
+				t.Errorf("Expected ErrIntegrity, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	if _, err := ParsePublicKey("not-a-key"); err == nil {
+		t.Error("Expected an error for a malformed key")
+	}
+	if _, err := ParsePublicKey(hex.EncodeToString(make([]byte, 16))); err == nil {
+		t.Error("Expected an error for a short key")
+	}
+}
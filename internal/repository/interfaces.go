@@ -2,13 +2,21 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"net/netip"
+	"time"
+
 	"ip-geolocation-service/internal/models"
 )
 
+// ErrNotFound is returned (wrapped) when an address has no location
+var ErrNotFound = errors.New("location not found")
+
 // IPRepository defines the interface for IP location data access
 type IPRepository interface {
-	// FindLocation finds the location for a given IP address
-	FindLocation(ctx context.Context, ip string) (*models.Location, error)
+	// FindLocation finds the location for a given IP address, as parsed by
+	// models.ParseIP
+	FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error)
 
 	// Initialize initializes the repository (loads data, connects to DB, etc.)
 	Initialize(ctx context.Context) error
@@ -20,7 +28,74 @@ type IPRepository interface {
 	HealthCheck(ctx context.Context) error
 }
 
+// MemoryStatsProvider is implemented by repositories that keep their dataset in memory
+type MemoryStatsProvider interface {
+	MemoryStats() MemoryStats
+}
+
+// VersionProvider is implemented by repositories that can identify the data they loaded
+type VersionProvider interface {
+	Version() string
+}
+
+// ModTimeProvider is implemented by repositories that know when the data they loaded
+// was last modified
+type ModTimeProvider interface {
+	// ModTime returns the modification time of the data, zero if unknown
+	ModTime() time.Time
+}
+
+// IPSampler is implemented by repositories that can enumerate the addresses they hold
+type IPSampler interface {
+	// SampleIPs returns up to n addresses chosen uniformly at random from the data
+	SampleIPs(n int) []string
+}
+
+// RecordLister is implemented by repositories that can list their whole dataset
+type RecordLister interface {
+	// Records returns every address and its location, sorted by address
+	Records() []Record
+}
+
+// RecordCounter is implemented by repositories that know how many addresses they hold
+type RecordCounter interface {
+	// RecordCount returns the number of addresses in the data
+	RecordCount() int
+}
+
+// Record is an IP address and its location, the unit written to a WritableRepository
+type Record struct {
+	IP       string
+	Location models.Location
+}
+
+// WritableRepository is implemented by repositories that can persist changes to
+// their data. Writes are visible to lookups immediately; Flush makes them durable.
+type WritableRepository interface {
+	IPRepository
+
+	// Upsert stores the location for an IP address, as parsed by models.ParseIP,
+	// replacing any existing one
+	Upsert(ctx context.Context, addr netip.Addr, location models.Location) error
+
+	// Delete removes an IP address, returning ErrNotFound if it isn't present
+	Delete(ctx context.Context, addr netip.Addr) error
+
+	// BulkLoad replaces the whole dataset with records. Nothing changes if any
+	// record is invalid.
+	BulkLoad(ctx context.Context, records []Record) error
+
+	// Flush persists pending changes to the backing store
+	Flush(ctx context.Context) error
+}
+
+// Capabilities describes what a repository backend supports
+type Capabilities struct {
+	Writable bool `json:"writable"` // Repositories implement WritableRepository
+}
+
 // RepositoryFactory creates repository instances based on configuration
 type RepositoryFactory interface {
 	CreateRepository(dbType string) (IPRepository, error)
+	Capabilities(dbType string) Capabilities
 }
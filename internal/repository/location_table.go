@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"strings"
+	"unsafe"
+
+	"ip-geolocation-service/internal/models"
+)
+
+// stringInterner deduplicates strings so repeated values share one backing array
+type stringInterner struct {
+	values map[string]string
+	bytes  int
+}
+
+// newStringInterner creates an empty string interner
+func newStringInterner() *stringInterner {
+	return &stringInterner{
+		values: make(map[string]string),
+	}
+}
+
+// Intern returns the canonical copy of s
+func (si *stringInterner) Intern(s string) string {
+	if interned, exists := si.values[s]; exists {
+		return interned
+	}
+	// Clone so the interned value doesn't pin the larger buffer it was sliced from
+	interned := strings.Clone(s)
+	si.values[interned] = interned
+	si.bytes += len(interned)
+	return interned
+}
+
+// Len returns the number of unique strings
+func (si *stringInterner) Len() int {
+	return len(si.values)
+}
+
+// locationTable stores each unique location once and hands out compact indices
+type locationTable struct {
+	locations []models.Location
+	index     map[locationKey]uint32
+	strings   *stringInterner
+}
+
+// locationKey identifies a unique location; Location itself holds coordinate
+// pointers, which don't compare by value
+type locationKey struct {
+	country, city string
+	lat, lon      float64
+	hasCoords     bool
+}
+
+// newLocationTable creates an empty location table
+func newLocationTable() *locationTable {
+	return &locationTable{
+		index:   make(map[locationKey]uint32),
+		strings: newStringInterner(),
+	}
+}
+
+// Add stores the location if it is new and returns its index. Country codes and the
+// continent are derived here, once per unique location.
+func (t *locationTable) Add(country, city string) uint32 {
+	return t.add(locationKey{country: country, city: city})
+}
+
+// AddWithCoordinates is Add for a location with a known latitude and longitude
+func (t *locationTable) AddWithCoordinates(country, city string, lat, lon float64) uint32 {
+	return t.add(locationKey{country: country, city: city, lat: lat, lon: lon, hasCoords: true})
+}
+
+func (t *locationTable) add(key locationKey) uint32 {
+	key.country = t.strings.Intern(key.country)
+	key.city = t.strings.Intern(key.city)
+
+	if idx, exists := t.index[key]; exists {
+		return idx
+	}
+
+	idx := uint32(len(t.locations))
+	t.index[key] = idx
+	location := models.Location{
+		Country: key.country,
+		City:    key.city,
+	}
+	if key.hasCoords {
+		location.Latitude, location.Longitude = &key.lat, &key.lon
+	}
+	location.Enrich()
+	t.locations = append(t.locations, location)
+	return idx
+}
+
+// Get returns the location stored at idx
+func (t *locationTable) Get(idx uint32) *models.Location {
+	return &t.locations[idx]
+}
+
+// Len returns the number of unique locations
+func (t *locationTable) Len() int {
+	return len(t.locations)
+}
+
+// MemoryStats describes the memory footprint of the in-memory dataset
+type MemoryStats struct {
+	Records         int    `json:"records"`
+	UniqueLocations int    `json:"unique_locations"`
+	UniqueStrings   int    `json:"unique_strings"`
+	NaiveBytes      int    `json:"naive_bytes"`   // Estimated size with one Location allocation per row
+	CompactBytes    int    `json:"compact_bytes"` // Estimated size with the interned location table
+	HeapBefore      uint64 `json:"heap_before"`   // Heap in use before loading the dataset
+	HeapAfter       uint64 `json:"heap_after"`    // Heap in use after loading the dataset
+	LoadDurationMS  int64  `json:"load_duration_ms"`
+	Duplicates      int    `json:"duplicates"` // Rows repeating an address with the same location
+	Conflicts       int    `json:"conflicts"`  // Rows repeating an address with a different location
+}
+
+// SavedBytes returns the estimated number of bytes saved by interning
+func (s MemoryStats) SavedBytes() int {
+	return s.NaiveBytes - s.CompactBytes
+}
+
+var (
+	locationSize  = int(unsafe.Sizeof(models.Location{}))
+	pointerSize   = int(unsafe.Sizeof(uintptr(0)))
+	indexSize     = int(unsafe.Sizeof(uint32(0)))
+	stringHdrSize = int(unsafe.Sizeof(""))
+)
+
+// estimateMemory computes naive vs compact footprints for the given table and record count.
+// Map key storage is identical in both layouts and therefore excluded.
+func estimateMemory(table *locationTable, records int, rawStringBytes int) (naive, compact int) {
+	naive = records*(pointerSize+locationSize) + rawStringBytes
+	compact = records*indexSize + table.Len()*locationSize + table.strings.Len()*stringHdrSize + table.strings.bytes
+	return naive, compact
+}
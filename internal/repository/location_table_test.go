@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestStringInterner_Intern(t *testing.T) {
+	interner := newStringInterner()
+
+	first := interner.Intern(string([]byte("United States")))
+	second := interner.Intern(string([]byte("United States")))
+
+	if first != second {
+		t.Fatalf("Expected equal strings, got %q and %q", first, second)
+	}
+
+	if unsafe.StringData(first) != unsafe.StringData(second) {
+		t.Error("Expected interned strings to share the same backing array")
+	}
+
+	interner.Intern("Israel")
+	if interner.Len() != 2 {
+		t.Errorf("Expected 2 unique strings, got %d", interner.Len())
+	}
+	if interner.bytes != len("United States")+len("Israel") {
+		t.Errorf("Expected %d interned bytes, got %d", len("United States")+len("Israel"), interner.bytes)
+	}
+}
+
+func TestLocationTable_Add(t *testing.T) {
+	table := newLocationTable()
+
+	idx1 := table.Add("United States", "New York")
+	idx2 := table.Add("United States", "Mountain View")
+	idx3 := table.Add("United States", "New York")
+
+	if idx1 != idx3 {
+		t.Errorf("Expected duplicate location to reuse index %d, got %d", idx1, idx3)
+	}
+	if idx1 == idx2 {
+		t.Error("Expected distinct locations to get distinct indices")
+	}
+	if table.Len() != 2 {
+		t.Errorf("Expected 2 unique locations, got %d", table.Len())
+	}
+	if table.strings.Len() != 3 {
+		t.Errorf("Expected 3 unique strings, got %d", table.strings.Len())
+	}
+
+	location := table.Get(idx2)
+	if location.Country != "United States" || location.City != "Mountain View" {
+		t.Errorf("Unexpected location at index %d: %+v", idx2, location)
+	}
+}
+
+func TestLocationTable_Enrichment(t *testing.T) {
+	table := newLocationTable()
+
+	location := table.Get(table.Add("Germany", "Frankfurt"))
+	if location.CountryCode != "DE" || location.CountryCode3 != "DEU" || location.Continent != "Europe" {
+		t.Errorf("Expected Germany to be enriched, got %+v", location)
+	}
+	if location.Accuracy != "city" || location.Confidence != nil {
+		t.Errorf("Expected CSV rows to be city-accurate without a confidence, got %+v", location)
+	}
+
+	location = table.Get(table.Add("Private", "Local Network"))
+	if location.CountryCode != "" || location.Continent != "" {
+		t.Errorf("Expected unknown country to have no codes, got %+v", location)
+	}
+
+	// Enrichment doesn't affect deduplication
+	if table.Add("Germany", "Frankfurt") != 0 || table.Len() != 2 {
+		t.Errorf("Expected enriched location to be deduplicated, got %d locations", table.Len())
+	}
+}
+
+func TestEstimateMemory(t *testing.T) {
+	table := newLocationTable()
+	rawBytes := 0
+	for i := 0; i < 1000; i++ {
+		table.Add("United States", "New York")
+		rawBytes += len("United States") + len("New York")
+	}
+
+	naive, compact := estimateMemory(table, 1000, rawBytes)
+	if compact >= naive {
+		t.Errorf("Expected compact footprint (%d) to be smaller than naive (%d)", compact, naive)
+	}
+
+	stats := MemoryStats{NaiveBytes: naive, CompactBytes: compact}
+	if stats.SavedBytes() != naive-compact {
+		t.Errorf("Expected saved bytes %d, got %d", naive-compact, stats.SavedBytes())
+	}
+}
+
+func TestLocationTable_AddWithCoordinates(t *testing.T) {
+	table := newLocationTable()
+
+	plain := table.Add("United Kingdom", "London")
+	first := table.AddWithCoordinates("United Kingdom", "London", 51.5074, -0.1278)
+	second := table.AddWithCoordinates("United Kingdom", "London", 51.5074, -0.1278)
+
+	if first != second {
+		t.Errorf("Expected duplicate location to reuse index %d, got %d", first, second)
+	}
+	if plain == first {
+		t.Error("Expected a location with coordinates to be distinct from one without")
+	}
+	if _, _, ok := table.Get(plain).Coordinates(); ok {
+		t.Error("Expected no coordinates for a plain location")
+	}
+	if lat, lon, ok := table.Get(first).Coordinates(); !ok || lat != 51.5074 || lon != -0.1278 {
+		t.Errorf("Coordinates() = %v, %v, %v", lat, lon, ok)
+	}
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"strings"
+
+	"ip-geolocation-service/internal/parquet"
+)
+
+// errParquetReadOnly rejects writing a Parquet dataset; only a reader is available
+var errParquetReadOnly = errors.New("parquet data files are read-only; export to CSV to write")
+
+// parquetAddressColumns are the names accepted for the address column, in order of
+// preference
+var parquetAddressColumns = []string{"ip", "ip_address", "network"}
+
+// parquetColumns picks the columns of a Parquet dataset, in the order parseRecord
+// expects: address, city, country and, when the file has both, latitude and longitude
+func parquetColumns(file *parquet.File) ([]string, error) {
+	available := make(map[string]bool)
+	for _, name := range file.Columns() {
+		available[strings.ToLower(name)] = true
+	}
+
+	var columns []string
+	for _, name := range parquetAddressColumns {
+		if available[name] {
+			columns = append(columns, name)
+			break
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("parquet data file has no address column (%s)", strings.Join(parquetAddressColumns, ", "))
+	}
+	for _, name := range []string{"city", "country"} {
+		if !available[name] {
+			return nil, fmt.Errorf("parquet data file has no %s column", name)
+		}
+		columns = append(columns, name)
+	}
+	if available["latitude"] && available["longitude"] {
+		columns = append(columns, "latitude", "longitude")
+	}
+	return columns, nil
+}
+
+// readParquet adds the records of a Parquet data file to builder and returns the hash
+// of the file. Only the columns the dataset uses are decoded, one row group at a time,
+// and row groups whose statistics show no addresses at all are skipped unread. Rows
+// that can't be loaded are skipped and logged to logger.
+func readParquet(file dataFile, path string, builder *datasetBuilder, logger *slog.Logger) ([]byte, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data file %s: %w", path, err)
+	}
+	pq, err := parquet.Open(file, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parquet data file %s: %w", path, err)
+	}
+	columns, err := parquetColumns(pq)
+	if err != nil {
+		return nil, err
+	}
+
+	noAddresses := func(stats parquet.ColumnStats) bool {
+		return stats.HasNulls && stats.Nulls >= stats.Rows
+	}
+	row := 0
+	err = pq.ReadRows(columns, noAddresses, func(record []string) error {
+		row++
+		// Exports of network tables hold prefixes; only single addresses can be loaded
+		if ip := strings.TrimSpace(record[0]); strings.Contains(ip, "/") {
+			prefix, err := netip.ParsePrefix(ip)
+			if err != nil || !prefix.IsSingleIP() {
+				logger.Warn("Skipped invalid record", "row", row, "error", "not a single address", "ip", ip)
+				return nil
+			}
+			record[0] = prefix.Addr().String()
+		}
+
+		conflicts := builder.conflicts
+		if err := builder.processRecord(record); err != nil {
+			if errors.Is(err, errTooManyRecords) {
+				return err
+			}
+			if errors.Is(err, errConflictingRecord) {
+				return fmt.Errorf("row %d: %w", row, err)
+			}
+			logger.Warn("Skipped invalid record", "row", row, "error", err)
+			return nil
+		}
+		if builder.conflicts > conflicts {
+			logger.Warn("Record lists an address again with a different location", "row", row, "ip", strings.TrimSpace(record[0]))
+		}
+		return nil
+	})
+	if errors.Is(err, parquet.ErrInvalidFile) || errors.Is(err, parquet.ErrUnsupported) {
+		return nil, fmt.Errorf("failed to read parquet data file %s: %w", path, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Parquet is read out of order, so the version hashes the whole file afterwards
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, io.NewSectionReader(file, 0, info.Size())); err != nil {
+		return nil, fmt.Errorf("failed to read data file %s: %w", path, err)
+	}
+	return hasher.Sum(nil), nil
+}
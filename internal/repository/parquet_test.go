@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/models"
+)
+
+// testdata/test_data.parquet has snappy compressed row groups of two rows with columns
+// network, asn, city, country, latitude and longitude. Its rows are 8.8.8.8/32,
+// 1.1.1.1/32, 2001:4860:4860::8888/128, 192.0.2.0/24, two null networks, then
+// 208.67.222.222/32 and 8.8.8.8/32 again with the same location.
+func TestFileRepository_Parquet(t *testing.T) {
+	ctx := context.Background()
+	data, err := os.ReadFile("testdata/test_data.parquet")
+	if err != nil {
+		t.Fatalf("Failed to read parquet fixture: %v", err)
+	}
+	dataFile := filepath.Join(t.TempDir(), "data.parquet")
+	if err := os.WriteFile(dataFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	sum := sha256.Sum256(data)
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	repo := NewFileRepository(&config.DatabaseConfig{Type: config.DatabaseTypeParquet, FilePath: dataFile, Checksum: hex.EncodeToString(sum[:])}, logger)
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	stats := repo.MemoryStats()
+	if stats.Records != 4 || stats.Duplicates != 1 {
+		t.Errorf("MemoryStats() records = %d, duplicates = %d, want 4 and 1", stats.Records, stats.Duplicates)
+	}
+	if want := hex.EncodeToString(sum[:])[:12]; repo.Version() != want {
+		t.Errorf("Version() = %s, want %s", repo.Version(), want)
+	}
+
+	tests := []struct {
+		ip        string
+		city      string
+		hasCoords bool
+	}{
+		{"8.8.8.8", "Mountain View", true},
+		{"1.1.1.1", "Sydney", true},
+		{"2001:4860:4860::8888", "Mountain View", false},
+		{"208.67.222.222", "San Francisco", true},
+	}
+	for _, tt := range tests {
+		location, err := repo.FindLocation(ctx, netip.MustParseAddr(tt.ip))
+		if err != nil {
+			t.Errorf("FindLocation(%s) error = %v", tt.ip, err)
+			continue
+		}
+		if _, _, ok := location.Coordinates(); location.City != tt.city || ok != tt.hasCoords {
+			t.Errorf("FindLocation(%s) = %+v, want %s with coordinates %v", tt.ip, location, tt.city, tt.hasCoords)
+		}
+	}
+	// Prefixes wider than one address aren't loaded
+	if _, err := repo.FindLocation(ctx, netip.MustParseAddr("192.0.2.0")); err == nil {
+		t.Error("Expected 192.0.2.0/24 to be skipped")
+	}
+	if !strings.Contains(logs.String(), "row=4") || !strings.Contains(logs.String(), "ip=192.0.2.0/24") {
+		t.Errorf("Expected the skipped prefix to be logged, got:\n%s", logs.String())
+	}
+
+	// Parquet datasets can only be read
+	repo.Upsert(ctx, netip.MustParseAddr("9.9.9.9"), models.Location{Country: "CH", City: "Zurich"})
+	if err := repo.Flush(ctx); !errors.Is(err, errParquetReadOnly) {
+		t.Errorf("Flush() error = %v, want errParquetReadOnly", err)
+	}
+
+	// A CSV file isn't mistaken for Parquet
+	csvFile := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(csvFile, []byte(testCSVData), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	repo = NewFileRepository(&config.DatabaseConfig{Type: config.DatabaseTypeParquet, FilePath: csvFile}, slog.Default())
+	if err := repo.Initialize(ctx); err == nil {
+		t.Error("Expected loading a CSV file as Parquet to fail")
+	}
+}
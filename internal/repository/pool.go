@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"database/sql"
+	"sync"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/metrics"
+)
+
+// PoolStats describes the connection pool of a network backend
+type PoolStats struct {
+	MaxOpen           int     `json:"max_open"`            // Pool size (0 for unlimited)
+	Open              int     `json:"open"`                // Connections established, in use or idle
+	InUse             int     `json:"in_use"`              // Connections serving a query
+	Idle              int     `json:"idle"`                // Connections waiting for reuse
+	WaitCount         int64   `json:"wait_count"`          // Queries that waited for a free connection
+	WaitSeconds       float64 `json:"wait_seconds"`        // Total time spent waiting for one
+	MaxIdleClosed     int64   `json:"max_idle_closed"`     // Connections closed because the idle pool was full
+	IdleTimeoutClosed int64   `json:"idle_timeout_closed"` // Connections closed after the idle timeout
+	MaxLifetimeClosed int64   `json:"max_lifetime_closed"` // Connections closed after their max lifetime
+}
+
+// Utilization returns the share of the pool serving queries (0-1), or 0 for an
+// unlimited pool
+func (s PoolStats) Utilization() float64 {
+	if s.MaxOpen <= 0 {
+		return 0
+	}
+	return float64(s.InUse) / float64(s.MaxOpen)
+}
+
+// PoolStatsProvider is implemented by repositories that hold a connection pool
+type PoolStatsProvider interface {
+	PoolStats() PoolStats
+}
+
+// ConfigureDB applies the pool settings to a database/sql pool. Zero settings keep
+// database/sql's defaults.
+func ConfigureDB(db *sql.DB, pool config.PoolConfig) {
+	if pool.Size > 0 {
+		db.SetMaxOpenConns(pool.Size)
+	}
+	if pool.MaxIdle > 0 {
+		db.SetMaxIdleConns(pool.MaxIdle)
+	}
+	if pool.IdleTimeout > 0 {
+		db.SetConnMaxIdleTime(pool.IdleTimeout)
+	}
+	if pool.MaxLifetime > 0 {
+		db.SetConnMaxLifetime(pool.MaxLifetime)
+	}
+}
+
+// DBPoolStats converts the statistics of a database/sql pool
+func DBPoolStats(s sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpen:           s.MaxOpenConnections,
+		Open:              s.OpenConnections,
+		InUse:             s.InUse,
+		Idle:              s.Idle,
+		WaitCount:         s.WaitCount,
+		WaitSeconds:       s.WaitDuration.Seconds(),
+		MaxIdleClosed:     s.MaxIdleClosed,
+		IdleTimeoutClosed: s.MaxIdleTimeClosed,
+		MaxLifetimeClosed: s.MaxLifetimeClosed,
+	}
+}
+
+// PoolMonitor collects the pool statistics of every loaded dataset whose repository
+// is a PoolStatsProvider, for the metrics endpoint
+type PoolMonitor struct {
+	mu    sync.RWMutex
+	pools map[string]PoolStatsProvider
+}
+
+// NewPoolMonitor creates a monitor watching no pools
+func NewPoolMonitor() *PoolMonitor {
+	return &PoolMonitor{pools: make(map[string]PoolStatsProvider)}
+}
+
+// Track watches the pool of the named dataset's repository, replacing the pool of a
+// previous load. A repository without a pool leaves the dataset unwatched.
+func (m *PoolMonitor) Track(name string, repo IPRepository) {
+	if retrying, ok := repo.(*RetryingRepository); ok {
+		repo = retrying.IPRepository
+	}
+	provider, ok := repo.(PoolStatsProvider)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ok {
+		m.pools[name] = provider
+	} else {
+		delete(m.pools, name)
+	}
+}
+
+// Stats returns the statistics of each watched pool by dataset name
+func (m *PoolMonitor) Stats() map[string]PoolStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := make(map[string]PoolStats, len(m.pools))
+	for name, provider := range m.pools {
+		stats[name] = provider.PoolStats()
+	}
+	return stats
+}
+
+// total sums the statistics of every watched pool
+func (m *PoolMonitor) total() PoolStats {
+	var total PoolStats
+	for _, s := range m.Stats() {
+		total.MaxOpen += s.MaxOpen
+		total.Open += s.Open
+		total.InUse += s.InUse
+		total.Idle += s.Idle
+		total.WaitCount += s.WaitCount
+		total.WaitSeconds += s.WaitSeconds
+		total.MaxIdleClosed += s.MaxIdleClosed
+		total.IdleTimeoutClosed += s.IdleTimeoutClosed
+		total.MaxLifetimeClosed += s.MaxLifetimeClosed
+	}
+	return total
+}
+
+// RegisterMetrics exposes the pools, summed across datasets, on the registry
+func (m *PoolMonitor) RegisterMetrics(registry *metrics.Registry) {
+	gauge := func(name, help string, fn func(PoolStats) float64) {
+		registry.NewGaugeFunc(name, help, func() float64 { return fn(m.total()) })
+	}
+	counter := func(name, help string, fn func(PoolStats) float64) {
+		registry.NewCounterFunc(name, help, func() float64 { return fn(m.total()) })
+	}
+	gauge("ipgeo_repository_pool_max_open_connections", "Connection pool size of network backends (0 for unlimited)",
+		func(s PoolStats) float64 { return float64(s.MaxOpen) })
+	gauge("ipgeo_repository_pool_open_connections", "Backend connections established, in use or idle",
+		func(s PoolStats) float64 { return float64(s.Open) })
+	gauge("ipgeo_repository_pool_in_use_connections", "Backend connections serving a query",
+		func(s PoolStats) float64 { return float64(s.InUse) })
+	gauge("ipgeo_repository_pool_idle_connections", "Backend connections waiting for reuse",
+		func(s PoolStats) float64 { return float64(s.Idle) })
+	gauge("ipgeo_repository_pool_utilization", "Share of the backend connection pool serving queries (0-1)",
+		func(s PoolStats) float64 { return s.Utilization() })
+	counter("ipgeo_repository_pool_wait_total", "Queries that waited for a free backend connection",
+		func(s PoolStats) float64 { return float64(s.WaitCount) })
+	counter("ipgeo_repository_pool_wait_seconds_total", "Time spent waiting for a free backend connection",
+		func(s PoolStats) float64 { return s.WaitSeconds })
+	counter("ipgeo_repository_pool_closed_max_idle_total", "Backend connections closed because the idle pool was full",
+		func(s PoolStats) float64 { return float64(s.MaxIdleClosed) })
+	counter("ipgeo_repository_pool_closed_idle_timeout_total", "Backend connections closed after the idle timeout",
+		func(s PoolStats) float64 { return float64(s.IdleTimeoutClosed) })
+	counter("ipgeo_repository_pool_closed_max_lifetime_total", "Backend connections closed after their max lifetime",
+		func(s PoolStats) float64 { return float64(s.MaxLifetimeClosed) })
+}
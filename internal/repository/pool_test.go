@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/retry"
+)
+
+// noConnector is a database/sql connector whose connections always fail
+type noConnector struct{}
+
+func (noConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("no database")
+}
+func (noConnector) Driver() driver.Driver { return nil }
+
+func TestConfigureDB(t *testing.T) {
+	db := sql.OpenDB(noConnector{})
+	defer db.Close()
+
+	ConfigureDB(db, config.PoolConfig{Size: 8, MaxIdle: 2, IdleTimeout: time.Minute, MaxLifetime: time.Hour})
+	if stats := DBPoolStats(db.Stats()); stats.MaxOpen != 8 {
+		t.Errorf("Expected a pool of 8 connections, got %+v", stats)
+	}
+
+	// Zero settings keep database/sql's unlimited default
+	unlimited := sql.OpenDB(noConnector{})
+	defer unlimited.Close()
+	ConfigureDB(unlimited, config.PoolConfig{})
+	if stats := DBPoolStats(unlimited.Stats()); stats.MaxOpen != 0 {
+		t.Errorf("Expected an unlimited pool, got %+v", stats)
+	}
+}
+
+// pooledRemote is a stub backend reporting fixed pool statistics
+type pooledRemote struct {
+	*stubRemote
+	stats PoolStats
+}
+
+func (p *pooledRemote) PoolStats() PoolStats { return p.stats }
+
+func TestPoolMonitor(t *testing.T) {
+	monitor := NewPoolMonitor()
+	registry := metrics.NewRegistry()
+	monitor.RegisterMetrics(registry)
+
+	monitor.Track("default", &pooledRemote{stubRemote: &stubRemote{}, stats: PoolStats{MaxOpen: 10, InUse: 4, Idle: 2, Open: 6, WaitCount: 3}})
+	monitor.Track("premium", NewRetryingRepository(&pooledRemote{stubRemote: &stubRemote{}, stats: PoolStats{MaxOpen: 10, InUse: 1, Open: 1}}, retry.DefaultPolicy))
+	monitor.Track("local", &stubRemote{})
+	if stats := monitor.Stats(); len(stats) != 2 {
+		t.Fatalf("Expected the two pooled datasets to be watched, got %+v", stats)
+	}
+
+	var buf bytes.Buffer
+	registry.Write(&buf)
+	for _, want := range []string{
+		"ipgeo_repository_pool_max_open_connections 20",
+		"ipgeo_repository_pool_in_use_connections 5",
+		"ipgeo_repository_pool_utilization 0.25",
+		"ipgeo_repository_pool_wait_total 3",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	// A reload without a pool stops the watch
+	monitor.Track("premium", &stubRemote{})
+	if stats := monitor.Stats(); len(stats) != 1 {
+		t.Errorf("Expected one watched pool after the reload, got %+v", stats)
+	}
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/retry"
+)
+
+// RetryingStats holds RetryingRepository counters
+type RetryingStats struct {
+	Retries   uint64 `json:"retries"`   // Attempts repeated after a transient failure
+	Recovered uint64 `json:"recovered"` // Lookups that succeeded after a retry
+}
+
+// RetryingRepository retries lookups and initialization of a remote backend, such
+// as a SQL or Redis store, that fail transiently, so a failover or dropped connection
+// doesn't reach clients as a 500. What counts as transient is up to retry.Retryable;
+// ErrNotFound is never retried.
+type RetryingRepository struct {
+	IPRepository
+	policy retry.Policy
+
+	retries   atomic.Uint64
+	recovered atomic.Uint64
+}
+
+// NewRetryingRepository wraps backend with policy
+func NewRetryingRepository(backend IPRepository, policy retry.Policy) *RetryingRepository {
+	r := &RetryingRepository{IPRepository: backend}
+	notify := policy.Notify
+	policy.Notify = func(err error, wait time.Duration) {
+		r.retries.Add(1)
+		if notify != nil {
+			notify(err, wait)
+		}
+	}
+	r.policy = policy
+	return r
+}
+
+// Initialize connects to the backend, retrying transient failures
+func (r *RetryingRepository) Initialize(ctx context.Context) error {
+	return retry.Do(ctx, r.policy, r.IPRepository.Initialize)
+}
+
+// FindLocation looks addr up, retrying transient failures
+func (r *RetryingRepository) FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	var location *models.Location
+	attempts := 0
+	err := retry.Do(ctx, r.policy, func(ctx context.Context) error {
+		attempts++
+		var err error
+		location, err = r.IPRepository.FindLocation(ctx, addr)
+		return err
+	})
+	if err == nil && attempts > 1 {
+		r.recovered.Add(1)
+	}
+	return location, err
+}
+
+// Stats returns the retry counters
+func (r *RetryingRepository) Stats() RetryingStats {
+	return RetryingStats{Retries: r.retries.Load(), Recovered: r.recovered.Load()}
+}
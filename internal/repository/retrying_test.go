@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"syscall"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/retry"
+)
+
+// flakyRemote fails its first lookups with err before answering from the stub
+type flakyRemote struct {
+	*stubRemote
+	failures int
+	err      error
+}
+
+func (f *flakyRemote) FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	if f.failures > 0 {
+		f.failures--
+		f.stubRemote.lookups++
+		return nil, f.err
+	}
+	return f.stubRemote.FindLocation(ctx, addr)
+}
+
+func testRetryPolicy() retry.Policy {
+	return retry.Policy{MaxAttempts: 3, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond}
+}
+
+func TestRetryingRepository_RecoversTransientFailures(t *testing.T) {
+	remote := &flakyRemote{
+		stubRemote: &stubRemote{locations: map[string]models.Location{"8.8.8.8": {Country: "US", City: "Mountain View"}}},
+		failures:   2,
+		err:        syscall.ECONNRESET,
+	}
+	repo := NewRetryingRepository(remote, testRetryPolicy())
+
+	location, err := repo.FindLocation(context.Background(), netip.MustParseAddr("8.8.8.8"))
+	if err != nil {
+		t.Fatalf("FindLocation() error = %v", err)
+	}
+	if location.City != "Mountain View" {
+		t.Errorf("FindLocation() = %+v, want Mountain View", location)
+	}
+	if stats := repo.Stats(); stats.Retries != 2 || stats.Recovered != 1 {
+		t.Errorf("Stats() = %+v, want 2 retries and 1 recovered lookup", stats)
+	}
+}
+
+func TestRetryingRepository_GivesUp(t *testing.T) {
+	remote := &flakyRemote{stubRemote: &stubRemote{}, failures: 10, err: syscall.ECONNREFUSED}
+	repo := NewRetryingRepository(remote, testRetryPolicy())
+
+	if _, err := repo.FindLocation(context.Background(), netip.MustParseAddr("8.8.8.8")); !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("FindLocation() error = %v, want the backend's error", err)
+	}
+	if remote.lookups != 3 {
+		t.Errorf("Expected 3 attempts, got %d", remote.lookups)
+	}
+}
+
+func TestRetryingRepository_DoesNotRetryNotFound(t *testing.T) {
+	remote := &stubRemote{locations: map[string]models.Location{}}
+	repo := NewRetryingRepository(remote, testRetryPolicy())
+
+	if _, err := repo.FindLocation(context.Background(), netip.MustParseAddr("8.8.8.8")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindLocation() error = %v, want ErrNotFound", err)
+	}
+	if remote.lookups != 1 {
+		t.Errorf("Expected a missing address to be looked up once, got %d", remote.lookups)
+	}
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxRowBytes is the longest dataset row accepted, quotes and separators included.
+// Longer rows are skipped without being held in memory.
+const MaxRowBytes = 4096
+
+// Row problems; loading skips the row and continues
+var (
+	errRowTooLong = fmt.Errorf("row is longer than %d bytes", MaxRowBytes)
+	errQuote      = errors.New("malformed quoted field")
+	errLineBreak  = errors.New("quoted field is not closed on its line; fields can't contain line breaks")
+)
+
+// utf8BOM is the byte order mark some editors put at the start of a CSV file
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// RowError is a problem confined to one row of a dataset file
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// rowReader reads dataset CSV one line at a time with a bounded buffer, so a
+// pathological row costs at most MaxRowBytes of memory and never swallows the rows
+// after it. Fields are comma separated and may be quoted, with "" for a quote, but
+// can't span lines. A leading byte order mark and empty lines are skipped.
+type rowReader struct {
+	r      *bufio.Reader
+	line   int // Line of the row last read
+	fields []string
+	buf    []byte
+	ends   []int
+}
+
+// newRowReader creates a row reader over r
+func newRowReader(r io.Reader) *rowReader {
+	return &rowReader{r: bufio.NewReaderSize(r, MaxRowBytes+2)} // Room for the line ending
+}
+
+// Read returns the next row's fields, which are only valid until the next call. A
+// problem with the row itself is returned as a *RowError after the whole row was
+// consumed, and reading can continue; any other error ends the file.
+func (rr *rowReader) Read() ([]string, error) {
+	for {
+		line, err := rr.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if rr.line == 1 {
+			line = bytes.TrimPrefix(line, utf8BOM)
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if err := rr.parse(line); err != nil {
+			return nil, &RowError{Line: rr.line, Err: err}
+		}
+		return rr.fields, nil
+	}
+}
+
+// Line returns the line number of the row last read
+func (rr *rowReader) Line() int {
+	return rr.line
+}
+
+// readLine returns the next line without its line ending. An overlong line is
+// discarded and reported as a *RowError.
+func (rr *rowReader) readLine() ([]byte, error) {
+	rr.line++
+	line, err := rr.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = rr.r.ReadSlice('\n')
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return nil, &RowError{Line: rr.line, Err: errRowTooLong}
+	}
+	if err == io.EOF && len(line) > 0 {
+		err = nil // Last line without a line ending
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	return line, nil
+}
+
+// parse splits a line into fields, unquoting quoted ones
+func (rr *rowReader) parse(line []byte) error {
+	rr.buf, rr.ends = rr.buf[:0], rr.ends[:0]
+	for {
+		if len(line) > 0 && line[0] == '"' {
+			// Quoted field: "" is a quote and the closing quote ends the field
+			line = line[1:]
+			for {
+				i := bytes.IndexByte(line, '"')
+				if i < 0 {
+					return errLineBreak
+				}
+				rr.buf = append(rr.buf, line[:i]...)
+				line = line[i+1:]
+				if len(line) > 0 && line[0] == '"' {
+					rr.buf = append(rr.buf, '"')
+					line = line[1:]
+					continue
+				}
+				break
+			}
+			if len(line) > 0 && line[0] != ',' {
+				return fmt.Errorf("%w: unexpected text after the closing quote", errQuote)
+			}
+		} else {
+			i := bytes.IndexByte(line, ',')
+			if i < 0 {
+				i = len(line)
+			}
+			if bytes.IndexByte(line[:i], '"') >= 0 {
+				return fmt.Errorf("%w: quote in an unquoted field", errQuote)
+			}
+			rr.buf = append(rr.buf, line[:i]...)
+			line = line[i:]
+		}
+		rr.ends = append(rr.ends, len(rr.buf))
+
+		if len(line) == 0 {
+			break
+		}
+		line = line[1:] // The comma
+	}
+
+	// One string per row, sliced into fields, like encoding/csv
+	row := string(rr.buf)
+	rr.fields = rr.fields[:0]
+	start := 0
+	for _, end := range rr.ends {
+		rr.fields = append(rr.fields, row[start:end])
+		start = end
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRowReader(t *testing.T) {
+	data := "\ufeffip,city,country\r\n" +
+		"1.1.1.1,\"New York, NY\",\"The \"\"Big\"\" Apple\"\n" +
+		"\n" +
+		"2.2.2.2,\"Paris\nFrance\",France\n" +
+		"3.3.3.3,Lon\"don,United Kingdom\n" +
+		"4.4.4.4,\"Berlin\"x,Germany\n" +
+		"5.5.5.5," + strings.Repeat("x", 5*MaxRowBytes) + ",Nowhere\n" +
+		"6.6.6.6,,\n" +
+		"7.7.7.7,Sydney,Australia"
+
+	type row struct {
+		line   int
+		fields string
+		err    error
+	}
+	want := []row{
+		{1, "ip|city|country", nil},
+		{2, `1.1.1.1|New York, NY|The "Big" Apple`, nil},
+		{4, "", errLineBreak},
+		{5, "", errQuote}, // The rest of the field above is read as a row of its own
+		{6, "", errQuote},
+		{7, "", errQuote},
+		{8, "", errRowTooLong},
+		{9, "6.6.6.6||", nil},
+		{10, "7.7.7.7|Sydney|Australia", nil},
+	}
+
+	reader := newRowReader(strings.NewReader(data))
+	for _, w := range want {
+		fields, err := reader.Read()
+		var rowErr *RowError
+		switch {
+		case w.err != nil:
+			if !errors.As(err, &rowErr) || !errors.Is(err, w.err) || rowErr.Line != w.line {
+				t.Errorf("Line %d: expected %v, got %v", w.line, w.err, err)
+			}
+			continue
+		case err != nil:
+			t.Fatalf("Line %d: unexpected error %v", w.line, err)
+		}
+		if got := strings.Join(fields, "|"); got != w.fields || reader.Line() != w.line {
+			t.Errorf("Line %d: got %q on line %d, want %q", w.line, got, reader.Line(), w.fields)
+		}
+	}
+	if _, err := reader.Read(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"net/netip"
+	"slices"
+
+	"ip-geolocation-service/internal/models"
+)
+
+// maxOverlay is how many written addresses a snapshot carries on top of its base
+// map before the two are merged into a new base. Each write copies the overlay, and
+// each merge copies the base, so this trades write cost against merge frequency.
+const maxOverlay = 4096
+
+// deleted marks an address removed by a write that is still present in the base map
+const deleted = math.MaxUint32
+
+// snapshot is an immutable view of the dataset. Readers load the current snapshot
+// without locking; loads and writes build a new one and swap it in.
+type snapshot struct {
+	base    map[netip.Addr]uint32 // Address -> index into locations; never modified once published
+	overlay map[netip.Addr]uint32 // Writes since base was built (deleted for removals); never modified
+	// The location table's slice when the snapshot was published. Later writes only
+	// append past its length, so the indices it holds stay valid.
+	locations []models.Location
+	records   int // Addresses present
+}
+
+// lookup returns the location index stored for addr
+func (s *snapshot) lookup(addr netip.Addr) (uint32, bool) {
+	if idx, ok := s.overlay[addr]; ok {
+		return idx, idx != deleted
+	}
+	idx, ok := s.base[addr]
+	return idx, ok
+}
+
+// get returns the location for addr
+func (s *snapshot) get(addr netip.Addr) (*models.Location, bool) {
+	idx, ok := s.lookup(addr)
+	if !ok {
+		return nil, false
+	}
+	return &s.locations[idx], true
+}
+
+// each calls fn for every address and its location index until fn returns false
+func (s *snapshot) each(fn func(addr netip.Addr, idx uint32) bool) {
+	for addr, idx := range s.base {
+		if _, written := s.overlay[addr]; written {
+			continue
+		}
+		if !fn(addr, idx) {
+			return
+		}
+	}
+	for addr, idx := range s.overlay {
+		if idx != deleted && !fn(addr, idx) {
+			return
+		}
+	}
+}
+
+// sortedRecords returns every address in the snapshot and its location, sorted by
+// address
+func (s *snapshot) sortedRecords() []Record {
+	type entry struct {
+		addr netip.Addr
+		idx  uint32
+	}
+	entries := make([]entry, 0, s.records)
+	s.each(func(addr netip.Addr, idx uint32) bool {
+		entries = append(entries, entry{addr, idx})
+		return true
+	})
+	slices.SortFunc(entries, func(a, b entry) int { return a.addr.Compare(b.addr) })
+
+	records := make([]Record, len(entries))
+	for i, e := range entries {
+		records[i] = Record{IP: e.addr.String(), Location: s.locations[e.idx]}
+	}
+	return records
+}
+
+// with returns a copy of s in which addr maps to idx (or is removed when idx is
+// deleted), indexing into locations
+func (s *snapshot) with(addr netip.Addr, idx uint32, locations []models.Location) *snapshot {
+	_, existed := s.lookup(addr)
+	next := &snapshot{base: s.base, locations: locations, records: s.records}
+	switch {
+	case idx == deleted && existed:
+		next.records--
+	case idx != deleted && !existed:
+		next.records++
+	}
+
+	next.overlay = make(map[netip.Addr]uint32, len(s.overlay)+1)
+	maps.Copy(next.overlay, s.overlay)
+	if _, inBase := s.base[addr]; idx == deleted && !inBase {
+		delete(next.overlay, addr) // Nothing to hide
+	} else {
+		next.overlay[addr] = idx
+	}
+
+	if len(next.overlay) > maxOverlay {
+		next.merge()
+	}
+	return next
+}
+
+// merge folds the overlay into a new base map; only used before publishing
+func (s *snapshot) merge() {
+	base := make(map[netip.Addr]uint32, s.records)
+	s.each(func(addr netip.Addr, idx uint32) bool {
+		base[addr] = idx
+		return true
+	})
+	s.base, s.overlay = base, nil
+}
+
+// datasetBuilder accumulates records for a dataset that isn't visible to readers
+// until it is published
+type datasetBuilder struct {
+	data           map[netip.Addr]uint32
+	locations      *locationTable
+	maxRecords     int
+	rawStringBytes int
+	// policy decides which row keeps an address listed again with a different
+	// location; duplicates and conflicts count the repeated rows
+	policy     string
+	duplicates int
+	conflicts  int
+}
+
+// newDatasetBuilder creates an empty builder holding at most maxRecords addresses
+func newDatasetBuilder(maxRecords int) *datasetBuilder {
+	return &datasetBuilder{
+		data:       make(map[netip.Addr]uint32),
+		locations:  newLocationTable(),
+		maxRecords: maxRecords,
+	}
+}
+
+// reserve checks that addr fits within the record limit and accounts for the name
+// bytes of a new address
+func (b *datasetBuilder) reserve(addr netip.Addr, nameBytes int) error {
+	if _, exists := b.data[addr]; exists {
+		return nil
+	}
+	if len(b.data) >= b.maxRecords {
+		return fmt.Errorf("%w: the limit is %d", errTooManyRecords, b.maxRecords)
+	}
+	b.rawStringBytes += nameBytes
+	return nil
+}
+
+// add stores a record that passed validateRecord
+func (b *datasetBuilder) add(record Record) error {
+	addr := netip.MustParseAddr(record.IP)
+	if err := b.reserve(addr, len(record.Location.Country)+len(record.Location.City)); err != nil {
+		return err
+	}
+	b.data[addr] = addLocation(b.locations, record.Location)
+	return nil
+}
+
+// snapshot returns the built dataset as a snapshot
+func (b *datasetBuilder) snapshot() *snapshot {
+	return &snapshot{base: b.data, locations: b.locations.locations, records: len(b.data)}
+}
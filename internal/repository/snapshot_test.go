@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/models"
+)
+
+func TestSnapshot_With(t *testing.T) {
+	builder := newDatasetBuilder(DefaultMaxRecords)
+	builder.add(Record{IP: "1.1.1.1", Location: models.Location{Country: "Australia", City: "Sydney"}})
+	builder.add(Record{IP: "8.8.8.8", Location: models.Location{Country: "United States", City: "Mountain View"}})
+	base := builder.snapshot()
+
+	idx := addLocation(builder.locations, models.Location{Country: "Israel", City: "Tel Aviv"})
+	added := base.with(netip.MustParseAddr("9.9.9.9"), idx, builder.locations.locations)
+	removed := added.with(netip.MustParseAddr("1.1.1.1"), deleted, added.locations)
+
+	// Earlier snapshots are unaffected by later writes
+	if _, ok := base.get(netip.MustParseAddr("9.9.9.9")); ok {
+		t.Error("Expected the base snapshot not to see a later write")
+	}
+	if location, ok := added.get(netip.MustParseAddr("1.1.1.1")); !ok || location.City != "Sydney" {
+		t.Errorf("Expected 1.1.1.1 in Sydney before the delete, got %+v", location)
+	}
+
+	if location, ok := removed.get(netip.MustParseAddr("9.9.9.9")); !ok || location.City != "Tel Aviv" {
+		t.Errorf("Expected 9.9.9.9 in Tel Aviv, got %+v", location)
+	}
+	if _, ok := removed.get(netip.MustParseAddr("1.1.1.1")); ok {
+		t.Error("Expected 1.1.1.1 to be deleted")
+	}
+	if base.records != 2 || added.records != 3 || removed.records != 2 {
+		t.Errorf("Expected 2, 3 and 2 records, got %d, %d and %d", base.records, added.records, removed.records)
+	}
+
+	var addrs []netip.Addr
+	removed.each(func(addr netip.Addr, _ uint32) bool {
+		addrs = append(addrs, addr)
+		return true
+	})
+	if len(addrs) != 2 {
+		t.Errorf("Expected each to visit 2 addresses, got %v", addrs)
+	}
+}
+
+func TestSnapshot_WithMergesLargeOverlay(t *testing.T) {
+	builder := newDatasetBuilder(DefaultMaxRecords)
+	snap := builder.snapshot()
+	idx := addLocation(builder.locations, models.Location{Country: "Israel", City: "Tel Aviv"})
+
+	for i := 0; i <= maxOverlay; i++ {
+		snap = snap.with(netip.MustParseAddr(fmt.Sprintf("10.0.%d.%d", i>>8, i&0xff)), idx, builder.locations.locations)
+	}
+
+	if len(snap.overlay) != 0 || len(snap.base) != maxOverlay+1 {
+		t.Errorf("Expected the overlay merged into a base of %d, got base %d and overlay %d",
+			maxOverlay+1, len(snap.base), len(snap.overlay))
+	}
+	if _, ok := snap.get(netip.MustParseAddr("10.0.0.0")); !ok {
+		t.Error("Expected 10.0.0.0 after merging")
+	}
+}
+
+func TestDatasetBuilder_RecordLimit(t *testing.T) {
+	builder := newDatasetBuilder(1)
+	location := models.Location{Country: "Israel", City: "Tel Aviv"}
+
+	if err := builder.add(Record{IP: "1.1.1.1", Location: location}); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+	if err := builder.add(Record{IP: "1.1.1.1", Location: location}); err != nil {
+		t.Errorf("Expected replacing an address within the limit, got %v", err)
+	}
+	if err := builder.add(Record{IP: "2.2.2.2", Location: location}); !errors.Is(err, errTooManyRecords) {
+		t.Errorf("add() over the limit error = %v, want errTooManyRecords", err)
+	}
+}
+
+// Run with -race: lookups read published snapshots while writes publish new ones
+func TestFileRepository_ConcurrentReadsAndWrites(t *testing.T) {
+	repo := NewFileRepository(&config.DatabaseConfig{Type: "csv"}, slog.Default())
+	if err := repo.BulkLoad(context.Background(), []Record{
+		{IP: "1.1.1.1", Location: models.Location{Country: "Australia", City: "Sydney"}},
+	}); err != nil {
+		t.Fatalf("BulkLoad() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				location, err := repo.FindLocation(context.Background(), netip.MustParseAddr("1.1.1.1"))
+				if err != nil || location.Country != "Australia" {
+					t.Errorf("FindLocation() = %+v, %v", location, err)
+					return
+				}
+				repo.FindLocation(context.Background(), netip.MustParseAddr(fmt.Sprintf("10.0.%d.%d", i>>8, i&0xff)))
+			}
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		addr := netip.AddrFrom4([4]byte{10, 0, byte(i >> 8), byte(i)})
+		location := models.Location{Country: "Country", City: fmt.Sprintf("City %d", i)}
+		if err := repo.Upsert(context.Background(), addr, location); err != nil {
+			t.Fatalf("Upsert() error = %v", err)
+		}
+		if i%3 == 0 {
+			repo.Delete(context.Background(), addr)
+		}
+	}
+	wg.Wait()
+
+	if got := len(repo.SampleIPs(2000)); got != 1+666 {
+		t.Errorf("Expected %d addresses, got %d", 1+666, got)
+	}
+}
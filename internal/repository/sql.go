@@ -0,0 +1,377 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/models"
+)
+
+// sqlColumns are the columns of a dataset table, in the order rows are loaded. ip
+// is its primary key; latitude and longitude are nullable.
+const sqlColumns = "ip, city, country, latitude, longitude"
+
+// mysqlInsertBatch is the number of rows per INSERT when a MySQL BulkLoad can't
+// stream them with LOAD DATA
+const mysqlInsertBatch = 500
+
+// Suffixes of the tables BulkLoad swaps the live table with
+const (
+	stagingSuffix = "_staging"
+	retiredSuffix = "_old"
+)
+
+// ReaderHandlers registers the in-memory readers that MySQL's
+// LOAD DATA LOCAL INFILE 'Reader::<name>' streams from. Binaries linking
+// github.com/go-sql-driver/mysql set them to its RegisterReaderHandler and
+// DeregisterReaderHandler.
+type ReaderHandlers struct {
+	Register   func(name string, handler func() io.Reader)
+	Deregister func(name string)
+}
+
+// MySQLReaders is used by the MySQL repositories the factory creates. Left unset,
+// their BulkLoad inserts rows in batches instead of using LOAD DATA.
+var MySQLReaders ReaderHandlers
+
+// SQLOptions configures a SQLRepository
+type SQLOptions struct {
+	Table      string         // Dataset table (config.DefaultDatabaseTable when empty)
+	MaxRecords int            // Most addresses BulkLoad accepts (0 uses DefaultMaxRecords)
+	Readers    ReaderHandlers // MySQL only: readers for LOAD DATA; unset inserts in batches
+}
+
+// SQLRepository implements WritableRepository on a PostgreSQL or MySQL table
+// through database/sql. The driver, lib/pq or go-sql-driver/mysql, is linked by the
+// binary. Writes are committed as they are made, so Flush has nothing to do.
+type SQLRepository struct {
+	db      *sql.DB
+	dialect string // config.DatabaseTypePostgres or config.DatabaseTypeMySQL
+	opts    SQLOptions
+
+	loads atomic.Uint64 // Numbers the readers of MySQL bulk loads
+}
+
+// NewPostgresRepository creates a repository on a PostgreSQL table
+func NewPostgresRepository(db *sql.DB, opts SQLOptions) *SQLRepository {
+	return newSQLRepository(db, config.DatabaseTypePostgres, opts)
+}
+
+// NewMySQLRepository creates a repository on a MySQL table
+func NewMySQLRepository(db *sql.DB, opts SQLOptions) *SQLRepository {
+	return newSQLRepository(db, config.DatabaseTypeMySQL, opts)
+}
+
+func newSQLRepository(db *sql.DB, dialect string, opts SQLOptions) *SQLRepository {
+	if opts.Table == "" {
+		opts.Table = config.DefaultDatabaseTable
+	}
+	if opts.MaxRecords <= 0 {
+		opts.MaxRecords = DefaultMaxRecords
+	}
+	return &SQLRepository{db: db, dialect: dialect, opts: opts}
+}
+
+// Initialize checks the database can be reached
+func (r *SQLRepository) Initialize(ctx context.Context) error {
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", r.dialect, err)
+	}
+	return nil
+}
+
+// FindLocation looks addr up in the table
+func (r *SQLRepository) FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	query := fmt.Sprintf("SELECT city, country, latitude, longitude FROM %s WHERE ip = %s", r.opts.Table, r.placeholder(1))
+	var location models.Location
+	var latitude, longitude sql.NullFloat64
+	err := r.db.QueryRowContext(ctx, query, addr.Unmap().String()).Scan(&location.City, &location.Country, &latitude, &longitude)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w for IP: %s", ErrNotFound, addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", r.dialect, err)
+	}
+	if latitude.Valid && longitude.Valid {
+		location.Latitude, location.Longitude = &latitude.Float64, &longitude.Float64
+	}
+	return &location, nil
+}
+
+// Upsert stores the location for addr, replacing any existing one
+func (r *SQLRepository) Upsert(ctx context.Context, addr netip.Addr, location models.Location) error {
+	if !addr.IsValid() {
+		return fmt.Errorf("%w: %s", models.ErrInvalidIP, addr)
+	}
+	location, err := validateLocation(location)
+	if err != nil {
+		return err
+	}
+
+	var query string
+	switch r.dialect {
+	case config.DatabaseTypePostgres:
+		query = fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (ip) DO UPDATE SET "+
+			"city = EXCLUDED.city, country = EXCLUDED.country, latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude",
+			r.opts.Table, sqlColumns)
+	default:
+		query = fmt.Sprintf("INSERT INTO %s (%s) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE "+
+			"city = VALUES(city), country = VALUES(country), latitude = VALUES(latitude), longitude = VALUES(longitude)",
+			r.opts.Table, sqlColumns)
+	}
+	record := Record{IP: addr.Unmap().String(), Location: location}
+	if _, err := r.db.ExecContext(ctx, query, sqlArgs(record)...); err != nil {
+		return fmt.Errorf("failed to write %s: %w", record.IP, err)
+	}
+	return nil
+}
+
+// Delete removes addr, returning ErrNotFound if it isn't present
+func (r *SQLRepository) Delete(ctx context.Context, addr netip.Addr) error {
+	ip := addr.Unmap().String()
+	result, err := r.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE ip = %s", r.opts.Table, r.placeholder(1)), ip)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", ip, err)
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return fmt.Errorf("%w for IP: %s", ErrNotFound, ip)
+	}
+	return nil
+}
+
+// BulkLoad replaces the table's contents with records. The records are loaded into a
+// staging table which is then swapped with the live one, so lookups see either the
+// old dataset or the whole new one and nothing changes if the load fails. An address
+// listed twice keeps its last location.
+func (r *SQLRepository) BulkLoad(ctx context.Context, records []Record) error {
+	rows := make([]Record, 0, len(records))
+	index := make(map[string]int, len(records))
+	for i, record := range records {
+		record, err := validateRecord(record)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
+		}
+		if at, ok := index[record.IP]; ok {
+			rows[at] = record
+			continue
+		}
+		if len(rows) >= r.opts.MaxRecords {
+			return fmt.Errorf("%w: more than %d", errTooManyRecords, r.opts.MaxRecords)
+		}
+		index[record.IP] = len(rows)
+		rows = append(rows, record)
+	}
+
+	if r.dialect == config.DatabaseTypePostgres {
+		return r.bulkLoadPostgres(ctx, rows)
+	}
+	return r.bulkLoadMySQL(ctx, rows)
+}
+
+// bulkLoadPostgres copies rows into a staging table and swaps it with the live table,
+// all in one transaction: PostgreSQL DDL is transactional, so the swap becomes
+// visible atomically on commit and a failure rolls everything back.
+func (r *SQLRepository) bulkLoadPostgres(ctx context.Context, rows []Record) (err error) {
+	staging, retired := r.opts.Table+stagingSuffix, r.opts.Table+retiredSuffix
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin bulk load: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING ALL)", staging, r.opts.Table)); err != nil {
+		return fmt.Errorf("failed to create staging table: %w", err)
+	}
+
+	// COPY FROM STDIN as lib/pq runs it: one Exec per row, then one without
+	// arguments to flush the copy
+	copyStmt, err := tx.PrepareContext(ctx, fmt.Sprintf("COPY %s (%s) FROM STDIN", staging, sqlColumns))
+	if err != nil {
+		return fmt.Errorf("failed to start copy: %w", err)
+	}
+	defer copyStmt.Close()
+	for _, row := range rows {
+		if _, err = copyStmt.ExecContext(ctx, sqlArgs(row)...); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", row.IP, err)
+		}
+	}
+	if _, err = copyStmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to copy records: %w", err)
+	}
+	if err = copyStmt.Close(); err != nil {
+		return fmt.Errorf("failed to copy records: %w", err)
+	}
+
+	for _, query := range []string{
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", r.opts.Table, retired),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", staging, r.opts.Table),
+		fmt.Sprintf("DROP TABLE %s", retired),
+	} {
+		if _, err = tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to swap in the loaded table: %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit bulk load: %w", err)
+	}
+	return nil
+}
+
+// bulkLoadMySQL loads rows into a staging table in a transaction, then swaps it with
+// the live table in a single RENAME TABLE, which MySQL applies atomically. MySQL
+// commits DDL implicitly, so the staging table is created and swapped outside the
+// transaction, and dropped if anything fails before the swap.
+func (r *SQLRepository) bulkLoadMySQL(ctx context.Context, rows []Record) (err error) {
+	staging, retired := r.opts.Table+stagingSuffix, r.opts.Table+retiredSuffix
+
+	// A staging table left by a crashed load is discarded
+	if _, err := r.db.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", staging)); err != nil {
+		return fmt.Errorf("failed to drop stale staging table: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s LIKE %s", staging, r.opts.Table)); err != nil {
+		return fmt.Errorf("failed to create staging table: %w", err)
+	}
+	swapped := false
+	defer func() {
+		if !swapped {
+			r.db.ExecContext(context.WithoutCancel(ctx), fmt.Sprintf("DROP TABLE IF EXISTS %s", staging))
+		}
+	}()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin bulk load: %w", err)
+	}
+	if r.opts.Readers.Register != nil {
+		err = r.loadData(ctx, tx, staging, rows)
+	} else {
+		err = insertBatches(ctx, tx, staging, rows)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit bulk load: %w", err)
+	}
+
+	rename := fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s", r.opts.Table, retired, staging, r.opts.Table)
+	if _, err := r.db.ExecContext(ctx, rename); err != nil {
+		return fmt.Errorf("failed to swap in the loaded table: %w", err)
+	}
+	swapped = true
+	if _, err := r.db.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", retired)); err != nil {
+		return fmt.Errorf("loaded, but failed to drop the replaced table %s: %w", retired, err)
+	}
+	return nil
+}
+
+// loadData streams rows into table with LOAD DATA LOCAL INFILE from a registered reader
+func (r *SQLRepository) loadData(ctx context.Context, tx *sql.Tx, table string, rows []Record) error {
+	data := mysqlLoadData(rows)
+	name := fmt.Sprintf("ipgeo-bulk-load-%d", r.loads.Add(1))
+	r.opts.Readers.Register(name, func() io.Reader { return bytes.NewReader(data) })
+	if r.opts.Readers.Deregister != nil {
+		defer r.opts.Readers.Deregister(name)
+	}
+
+	query := fmt.Sprintf(`LOAD DATA LOCAL INFILE 'Reader::%s' INTO TABLE %s `+
+		`FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n' (%s)`, name, table, sqlColumns)
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to load records: %w", err)
+	}
+	return nil
+}
+
+// insertBatches inserts rows into table with multi-row INSERTs
+func insertBatches(ctx context.Context, tx *sql.Tx, table string, rows []Record) error {
+	for start := 0; start < len(rows); start += mysqlInsertBatch {
+		batch := rows[start:min(start+mysqlInsertBatch, len(rows))]
+		values := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?), ", len(batch)), ", ")
+		args := make([]any, 0, len(batch)*5)
+		for _, row := range batch {
+			args = append(args, sqlArgs(row)...)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, sqlColumns, values), args...); err != nil {
+			return fmt.Errorf("failed to insert records: %w", err)
+		}
+	}
+	return nil
+}
+
+// mysqlLoadData encodes rows in LOAD DATA's default format: tab separated, one row
+// per line, backslash escapes and \N for NULL
+func mysqlLoadData(rows []Record) []byte {
+	escaper := strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`)
+	var b bytes.Buffer
+	for _, row := range rows {
+		b.WriteString(row.IP)
+		for _, field := range []string{row.Location.City, row.Location.Country} {
+			b.WriteByte('\t')
+			b.WriteString(escaper.Replace(field))
+		}
+		for _, coordinate := range []*float64{row.Location.Latitude, row.Location.Longitude} {
+			b.WriteByte('\t')
+			if coordinate == nil {
+				b.WriteString(`\N`)
+			} else {
+				b.WriteString(strconv.FormatFloat(*coordinate, 'g', -1, 64))
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// sqlArgs returns the column values of a record, in sqlColumns order
+func sqlArgs(record Record) []any {
+	nullable := func(f *float64) any {
+		if f == nil {
+			return nil
+		}
+		return *f
+	}
+	return []any{record.IP, record.Location.City, record.Location.Country, nullable(record.Location.Latitude), nullable(record.Location.Longitude)}
+}
+
+// placeholder returns the dialect's placeholder for the nth query argument
+func (r *SQLRepository) placeholder(n int) string {
+	if r.dialect == config.DatabaseTypePostgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// Flush does nothing: writes are committed as they are made
+func (r *SQLRepository) Flush(ctx context.Context) error {
+	return nil
+}
+
+// Close closes the connection pool
+func (r *SQLRepository) Close() error {
+	return r.db.Close()
+}
+
+// HealthCheck checks the database can be reached
+func (r *SQLRepository) HealthCheck(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// PoolStats returns the statistics of the connection pool
+func (r *SQLRepository) PoolStats() PoolStats {
+	return DBPoolStats(r.db.Stats())
+}
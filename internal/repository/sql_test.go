@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"ip-geolocation-service/internal/models"
+)
+
+// fakeSQL is a database/sql connector that records the statements it runs instead of
+// talking to a server
+type fakeSQL struct {
+	mu       sync.Mutex
+	log      []string                  // Statements with their arguments, BEGIN, COMMIT and ROLLBACK
+	failOn   string                    // Statements containing it fail
+	rows     map[string][]driver.Value // Query results by first argument
+	affected int64                     // Rows affected by every statement
+}
+
+func (f *fakeSQL) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeSQL) Driver() driver.Driver                        { return nil }
+
+func (f *fakeSQL) record(entry string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.log = append(f.log, entry)
+}
+
+func (f *fakeSQL) statements() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.log)
+}
+
+type fakeConn struct{ db *fakeSQL }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) {
+	c.db.record("BEGIN")
+	return fakeTx{c.db}, nil
+}
+
+type fakeTx struct{ db *fakeSQL }
+
+func (t fakeTx) Commit() error   { t.db.record("COMMIT"); return nil }
+func (t fakeTx) Rollback() error { t.db.record("ROLLBACK"); return nil }
+
+type fakeStmt struct {
+	db    *fakeSQL
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	entry := s.query
+	if len(args) > 0 {
+		entry = fmt.Sprintf("%s %v", s.query, args)
+	}
+	if s.db.failOn != "" && strings.Contains(entry, s.db.failOn) {
+		return nil, errors.New("statement failed")
+	}
+	s.db.record(entry)
+	return driver.RowsAffected(s.db.affected), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.record(fmt.Sprintf("%s %v", s.query, args))
+	row, ok := s.db.rows[args[0].(string)]
+	return &fakeRows{row: row, done: !ok}, nil
+}
+
+type fakeRows struct {
+	row  []driver.Value
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"city", "country", "latitude", "longitude"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.row)
+	return nil
+}
+
+func newFakeSQL(t *testing.T) (*fakeSQL, *sql.DB) {
+	t.Helper()
+	fake := &fakeSQL{affected: 1}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+	return fake, db
+}
+
+func bulkLoadRecords() []Record {
+	latitude, longitude := -33.86, 151.2
+	return []Record{
+		{IP: "1.1.1.1", Location: models.Location{Country: "Australia", City: "Brisbane"}},
+		{IP: "8.8.8.8", Location: models.Location{Country: "United States", City: "Mountain View"}},
+		{IP: "::ffff:1.1.1.1", Location: models.Location{Country: "Australia", City: "Sydney", Latitude: &latitude, Longitude: &longitude}},
+	}
+}
+
+func TestSQLRepository_PostgresBulkLoad(t *testing.T) {
+	fake, db := newFakeSQL(t)
+	repo := NewPostgresRepository(db, SQLOptions{})
+
+	if err := repo.BulkLoad(context.Background(), bulkLoadRecords()); err != nil {
+		t.Fatalf("BulkLoad() error = %v", err)
+	}
+	copyRows := "COPY ip_locations_staging (ip, city, country, latitude, longitude) FROM STDIN"
+	want := []string{
+		"BEGIN",
+		"CREATE TABLE ip_locations_staging (LIKE ip_locations INCLUDING ALL)",
+		copyRows + " [1.1.1.1 Sydney Australia -33.86 151.2]",
+		copyRows + " [8.8.8.8 Mountain View United States <nil> <nil>]",
+		copyRows,
+		"ALTER TABLE ip_locations RENAME TO ip_locations_old",
+		"ALTER TABLE ip_locations_staging RENAME TO ip_locations",
+		"DROP TABLE ip_locations_old",
+		"COMMIT",
+	}
+	if got := fake.statements(); !slices.Equal(got, want) {
+		t.Errorf("Statements =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSQLRepository_PostgresBulkLoadFailure(t *testing.T) {
+	for _, failOn := range []string{"CREATE TABLE", "8.8.8.8", "RENAME TO ip_locations_old", "DROP TABLE"} {
+		fake, db := newFakeSQL(t)
+		fake.failOn = failOn
+		repo := NewPostgresRepository(db, SQLOptions{})
+
+		if err := repo.BulkLoad(context.Background(), bulkLoadRecords()); err == nil {
+			t.Errorf("%s: expected BulkLoad() to fail", failOn)
+			continue
+		}
+		got := fake.statements()
+		if got[len(got)-1] != "ROLLBACK" || slices.Contains(got, "COMMIT") {
+			t.Errorf("%s: expected the load to be rolled back, got\n%s", failOn, strings.Join(got, "\n"))
+		}
+	}
+
+	// Invalid records are rejected before anything is sent
+	fake, db := newFakeSQL(t)
+	repo := NewPostgresRepository(db, SQLOptions{})
+	records := append(bulkLoadRecords(), Record{IP: "not-an-ip", Location: models.Location{Country: "X"}})
+	if err := repo.BulkLoad(context.Background(), records); !errors.Is(err, models.ErrInvalidIP) {
+		t.Errorf("BulkLoad() error = %v, want ErrInvalidIP", err)
+	}
+	if got := fake.statements(); len(got) != 0 {
+		t.Errorf("Expected no statements, got %v", got)
+	}
+}
+
+func TestSQLRepository_MySQLBulkLoad(t *testing.T) {
+	fake, db := newFakeSQL(t)
+	registered := map[string]func() io.Reader{}
+	var loaded []byte
+	repo := NewMySQLRepository(db, SQLOptions{Table: "geo", Readers: ReaderHandlers{
+		Register: func(name string, handler func() io.Reader) {
+			registered[name] = handler
+			loaded, _ = io.ReadAll(handler())
+		},
+		Deregister: func(name string) { delete(registered, name) },
+	}})
+
+	records := append(bulkLoadRecords(), Record{IP: "9.9.9.9", Location: models.Location{Country: "Switzerland", City: "Zurich\tOerlikon"}})
+	if err := repo.BulkLoad(context.Background(), records); err != nil {
+		t.Fatalf("BulkLoad() error = %v", err)
+	}
+	want := []string{
+		"DROP TABLE IF EXISTS geo_staging",
+		"CREATE TABLE geo_staging LIKE geo",
+		"BEGIN",
+		`LOAD DATA LOCAL INFILE 'Reader::ipgeo-bulk-load-1' INTO TABLE geo_staging FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n' (ip, city, country, latitude, longitude)`,
+		"COMMIT",
+		"RENAME TABLE geo TO geo_old, geo_staging TO geo",
+		"DROP TABLE geo_old",
+	}
+	if got := fake.statements(); !slices.Equal(got, want) {
+		t.Errorf("Statements =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	wantData := "1.1.1.1\tSydney\tAustralia\t-33.86\t151.2\n" +
+		"8.8.8.8\tMountain View\tUnited States\t\\N\t\\N\n" +
+		"9.9.9.9\tZurich\\tOerlikon\tSwitzerland\t\\N\t\\N\n"
+	if string(loaded) != wantData {
+		t.Errorf("Loaded data = %q, want %q", loaded, wantData)
+	}
+	if len(registered) != 0 {
+		t.Errorf("Expected the reader to be deregistered, got %v", registered)
+	}
+}
+
+func TestSQLRepository_MySQLBulkLoadFailure(t *testing.T) {
+	for _, failOn := range []string{"INSERT INTO", "RENAME TABLE"} {
+		fake, db := newFakeSQL(t)
+		fake.failOn = failOn
+		repo := NewMySQLRepository(db, SQLOptions{})
+
+		if err := repo.BulkLoad(context.Background(), bulkLoadRecords()); err == nil {
+			t.Errorf("%s: expected BulkLoad() to fail", failOn)
+			continue
+		}
+		got := fake.statements()
+		if got[len(got)-1] != "DROP TABLE IF EXISTS ip_locations_staging" || slices.ContainsFunc(got, func(s string) bool {
+			return strings.HasPrefix(s, "RENAME TABLE")
+		}) {
+			t.Errorf("%s: expected the staging table to be dropped without a swap, got\n%s", failOn, strings.Join(got, "\n"))
+		}
+	}
+
+	// Without LOAD DATA readers the rows are inserted in batches
+	fake, db := newFakeSQL(t)
+	repo := NewMySQLRepository(db, SQLOptions{})
+	if err := repo.BulkLoad(context.Background(), bulkLoadRecords()); err != nil {
+		t.Fatalf("BulkLoad() error = %v", err)
+	}
+	insert := "INSERT INTO ip_locations_staging (ip, city, country, latitude, longitude) VALUES (?, ?, ?, ?, ?), (?, ?, ?, ?, ?) " +
+		"[1.1.1.1 Sydney Australia -33.86 151.2 8.8.8.8 Mountain View United States <nil> <nil>]"
+	if got := fake.statements(); !slices.Contains(got, insert) {
+		t.Errorf("Expected a batched insert, got\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestSQLRepository_Lookups(t *testing.T) {
+	fake, db := newFakeSQL(t)
+	fake.rows = map[string][]driver.Value{"8.8.8.8": {"Mountain View", "United States", 37.386, -122.0838}}
+	repo := NewPostgresRepository(db, SQLOptions{})
+	ctx := context.Background()
+
+	location, err := repo.FindLocation(ctx, netip.MustParseAddr("::ffff:8.8.8.8"))
+	if err != nil || location.City != "Mountain View" || location.Latitude == nil || *location.Latitude != 37.386 {
+		t.Errorf("FindLocation() = %+v, %v", location, err)
+	}
+	if _, err := repo.FindLocation(ctx, netip.MustParseAddr("1.1.1.1")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindLocation() of an unknown IP error = %v, want ErrNotFound", err)
+	}
+
+	if err := repo.Upsert(ctx, netip.MustParseAddr("9.9.9.9"), models.Location{Country: " Switzerland ", City: "Zurich"}); err != nil {
+		t.Errorf("Upsert() error = %v", err)
+	}
+	if got := fake.statements(); !strings.Contains(got[len(got)-1], "ON CONFLICT (ip) DO UPDATE") || !strings.HasSuffix(got[len(got)-1], "[9.9.9.9 Zurich Switzerland <nil> <nil>]") {
+		t.Errorf("Unexpected upsert %q", got[len(got)-1])
+	}
+	if err := repo.Upsert(ctx, netip.MustParseAddr("9.9.9.9"), models.Location{}); !errors.Is(err, models.ErrInvalidLocation) {
+		t.Errorf("Upsert() of an empty location error = %v, want ErrInvalidLocation", err)
+	}
+
+	if err := repo.Delete(ctx, netip.MustParseAddr("9.9.9.9")); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	fake.affected = 0
+	if err := repo.Delete(ctx, netip.MustParseAddr("9.9.9.9")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete() of a missing IP error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/models"
+)
+
+// DefaultWriteBehindQueue is the number of pending local writes a TieredRepository
+// buffers before dropping new ones
+const DefaultWriteBehindQueue = 1024
+
+// DefaultTieredTracked is the number of local answers whose sync time a
+// TieredRepository remembers. Beyond it the sync time of an arbitrary answer is
+// forgotten, and its next lookup reads through to the remote store again.
+const DefaultTieredTracked = 1_000_000
+
+// TieredStats holds TieredRepository counters
+type TieredStats struct {
+	LocalHits     uint64 `json:"local_hits"`
+	ReadThroughs  uint64 `json:"read_throughs"`  // Lookups answered by the remote store
+	StaleServed   uint64 `json:"stale_served"`   // Expired local answers served because the remote failed
+	WritesBehind  uint64 `json:"writes_behind"`  // Remote answers written to the local store
+	WritesDropped uint64 `json:"writes_dropped"` // Remote answers not written because the queue was full
+	WriteErrors   uint64 `json:"write_errors"`
+}
+
+// tieredWrite is a pending write to the local store; a nil location deletes
+type tieredWrite struct {
+	addr     netip.Addr
+	location *models.Location
+}
+
+// TieredRepository composes a fast local store with an authoritative remote one,
+// e.g. Redis in front of Postgres. Lookups are answered locally while the local
+// answer is younger than the consistency window; otherwise they read through to the
+// remote store, and its answer is written to the local store in the background so
+// lookups never wait on the local write. If the remote store fails, an expired local
+// answer is served rather than an error.
+type TieredRepository struct {
+	local  WritableRepository
+	remote IPRepository
+	window time.Duration
+
+	mu         sync.Mutex
+	syncedAt   map[netip.Addr]time.Time // When each local answer was last confirmed by the remote
+	maxTracked int                      // Most entries in syncedAt
+	closed     bool
+
+	writes chan tieredWrite
+	done   chan struct{}
+
+	localHits     atomic.Uint64
+	readThroughs  atomic.Uint64
+	staleServed   atomic.Uint64
+	writesBehind  atomic.Uint64
+	writesDropped atomic.Uint64
+	writeErrors   atomic.Uint64
+}
+
+// NewTieredRepository creates a tiered repository. Local answers are trusted for
+// window (zero trusts them until they are replaced); answers already in the local
+// store when it is initialized are read through once. At most queueSize local
+// writes are buffered, and the sync times of at most maxTracked answers are kept
+// (zero uses the defaults).
+func NewTieredRepository(local WritableRepository, remote IPRepository, window time.Duration, queueSize, maxTracked int) *TieredRepository {
+	if queueSize <= 0 {
+		queueSize = DefaultWriteBehindQueue
+	}
+	if maxTracked <= 0 {
+		maxTracked = DefaultTieredTracked
+	}
+	t := &TieredRepository{
+		local:      local,
+		remote:     remote,
+		window:     window,
+		syncedAt:   make(map[netip.Addr]time.Time),
+		maxTracked: maxTracked,
+		writes:     make(chan tieredWrite, queueSize),
+		done:       make(chan struct{}),
+	}
+	go t.writeBehind()
+	return t
+}
+
+// Initialize initializes both stores
+func (t *TieredRepository) Initialize(ctx context.Context) error {
+	if err := t.remote.Initialize(ctx); err != nil {
+		return fmt.Errorf("failed to initialize remote store: %w", err)
+	}
+	if err := t.local.Initialize(ctx); err != nil {
+		return fmt.Errorf("failed to initialize local store: %w", err)
+	}
+	return nil
+}
+
+// FindLocation answers from the local store when its answer is fresh and reads
+// through to the remote store otherwise
+func (t *TieredRepository) FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	local, localErr := t.local.FindLocation(ctx, addr)
+	if localErr == nil && t.fresh(addr) {
+		t.localHits.Add(1)
+		return local, nil
+	}
+
+	t.readThroughs.Add(1)
+	remote, err := t.remote.FindLocation(ctx, addr)
+	switch {
+	case err == nil:
+		t.enqueue(tieredWrite{addr: addr, location: remote})
+		return remote, nil
+	case errors.Is(err, ErrNotFound):
+		if localErr == nil {
+			t.enqueue(tieredWrite{addr: addr})
+		}
+		return nil, err
+	case localErr == nil:
+		t.staleServed.Add(1)
+		return local, nil
+	default:
+		return nil, err
+	}
+}
+
+// fresh reports whether the local answer for addr is within the consistency window
+func (t *TieredRepository) fresh(addr netip.Addr) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	syncedAt, ok := t.syncedAt[addr]
+	return ok && (t.window <= 0 || time.Since(syncedAt) < t.window)
+}
+
+// enqueue queues a local write, dropping it when the queue is full or closed
+func (t *TieredRepository) enqueue(write tieredWrite) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return
+	}
+	select {
+	case t.writes <- write:
+	default:
+		t.writesDropped.Add(1)
+	}
+}
+
+// writeBehind applies queued writes to the local store until the queue is closed
+func (t *TieredRepository) writeBehind() {
+	defer close(t.done)
+
+	for write := range t.writes {
+		ctx := context.Background()
+		var err error
+		if write.location != nil {
+			err = t.local.Upsert(ctx, write.addr, *write.location)
+		} else if err = t.local.Delete(ctx, write.addr); errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+		if err != nil {
+			t.writeErrors.Add(1)
+			continue
+		}
+
+		t.mu.Lock()
+		if write.location != nil {
+			if _, tracked := t.syncedAt[write.addr]; !tracked && len(t.syncedAt) >= t.maxTracked {
+				t.forgetOne()
+			}
+			t.syncedAt[write.addr] = time.Now()
+		} else {
+			delete(t.syncedAt, write.addr)
+		}
+		t.mu.Unlock()
+		t.writesBehind.Add(1)
+	}
+}
+
+// forgetOne drops the sync time of an arbitrary local answer, which map iteration
+// picks at random, to make room for another; t.mu must be held
+func (t *TieredRepository) forgetOne() {
+	for addr := range t.syncedAt {
+		delete(t.syncedAt, addr)
+		return
+	}
+}
+
+// Stats returns a snapshot of the tiered repository counters
+func (t *TieredRepository) Stats() TieredStats {
+	return TieredStats{
+		LocalHits:     t.localHits.Load(),
+		ReadThroughs:  t.readThroughs.Load(),
+		StaleServed:   t.staleServed.Load(),
+		WritesBehind:  t.writesBehind.Load(),
+		WritesDropped: t.writesDropped.Load(),
+		WriteErrors:   t.writeErrors.Load(),
+	}
+}
+
+// Close applies the queued writes, then closes both stores
+func (t *TieredRepository) Close() error {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.writes)
+	}
+	t.mu.Unlock()
+	<-t.done
+
+	return errors.Join(t.local.Close(), t.remote.Close())
+}
+
+// PoolStats returns the statistics of the remote store's connection pool, zero when
+// it has none
+func (t *TieredRepository) PoolStats() PoolStats {
+	if pooled, ok := t.remote.(PoolStatsProvider); ok {
+		return pooled.PoolStats()
+	}
+	return PoolStats{}
+}
+
+// HealthCheck reports the health of the authoritative remote store. The local store
+// is only a cache, so its failures don't make the repository unhealthy.
+func (t *TieredRepository) HealthCheck(ctx context.Context) error {
+	return t.remote.HealthCheck(ctx)
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/models"
+)
+
+// stubRemote is an in-memory remote store that counts lookups
+type stubRemote struct {
+	mu        sync.Mutex
+	locations map[string]models.Location
+	err       error
+	lookups   int
+}
+
+func (s *stubRemote) FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lookups++
+	if s.err != nil {
+		return nil, s.err
+	}
+	location, ok := s.locations[addr.String()]
+	if !ok {
+		return nil, fmt.Errorf("%w for IP: %s", ErrNotFound, addr)
+	}
+	return &location, nil
+}
+
+func (s *stubRemote) set(ip string, location *models.Location, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if location != nil {
+		s.locations[ip] = *location
+	} else {
+		delete(s.locations, ip)
+	}
+	s.err = err
+}
+
+func (s *stubRemote) Initialize(ctx context.Context) error { return nil }
+func (s *stubRemote) Close() error                         { return nil }
+func (s *stubRemote) HealthCheck(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func newTieredForTest(t *testing.T, window time.Duration, maxTracked int) (*TieredRepository, *stubRemote) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "local.csv")
+	if err := os.WriteFile(path, []byte("ip,city,country\n"), 0644); err != nil {
+		t.Fatalf("Failed to create local store file: %v", err)
+	}
+	remote := &stubRemote{locations: map[string]models.Location{
+		"8.8.8.8": {Country: "United States", City: "Mountain View"},
+	}}
+	tiered := NewTieredRepository(NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: path}, slog.Default()), remote, window, 0, maxTracked)
+	if err := tiered.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	t.Cleanup(func() { tiered.Close() })
+	return tiered, remote
+}
+
+// waitForWrites waits until n writes have been applied to the local store
+func waitForWrites(t *testing.T, tiered *TieredRepository, n uint64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for tiered.Stats().WritesBehind < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d local writes, stats %+v", n, tiered.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTieredRepository_ReadThroughWriteBehind(t *testing.T) {
+	tiered, remote := newTieredForTest(t, 0, 0)
+	ctx := context.Background()
+
+	location, err := tiered.FindLocation(ctx, netip.MustParseAddr("8.8.8.8"))
+	if err != nil || location.City != "Mountain View" {
+		t.Fatalf("FindLocation() = %v, %v", location, err)
+	}
+	waitForWrites(t, tiered, 1)
+
+	// Answered locally from now on, even if the remote changes
+	remote.set("8.8.8.8", &models.Location{Country: "United States", City: "San Jose"}, nil)
+	location, err = tiered.FindLocation(ctx, netip.MustParseAddr("8.8.8.8"))
+	if err != nil || location.City != "Mountain View" {
+		t.Errorf("FindLocation() after write-behind = %v, %v", location, err)
+	}
+	if remote.lookups != 1 {
+		t.Errorf("Expected 1 remote lookup, got %d", remote.lookups)
+	}
+
+	if _, err := tiered.FindLocation(ctx, netip.MustParseAddr("1.1.1.1")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindLocation() of an unknown IP error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestTieredRepository_ConsistencyWindow(t *testing.T) {
+	tiered, remote := newTieredForTest(t, 20*time.Millisecond, 0)
+	ctx := context.Background()
+
+	tiered.FindLocation(ctx, netip.MustParseAddr("8.8.8.8"))
+	waitForWrites(t, tiered, 1)
+	remote.set("8.8.8.8", &models.Location{Country: "United States", City: "San Jose"}, nil)
+	time.Sleep(30 * time.Millisecond)
+
+	// The expired answer is refreshed from the remote
+	location, err := tiered.FindLocation(ctx, netip.MustParseAddr("8.8.8.8"))
+	if err != nil || location.City != "San Jose" {
+		t.Fatalf("FindLocation() after the window = %v, %v", location, err)
+	}
+	waitForWrites(t, tiered, 2)
+	time.Sleep(30 * time.Millisecond)
+
+	// A failing remote serves the expired local answer
+	remote.set("8.8.8.8", nil, errors.New("connection refused"))
+	location, err = tiered.FindLocation(ctx, netip.MustParseAddr("8.8.8.8"))
+	if err != nil || location.City != "San Jose" {
+		t.Errorf("FindLocation() with failing remote = %v, %v", location, err)
+	}
+	if tiered.Stats().StaleServed != 1 {
+		t.Errorf("Expected 1 stale answer, stats %+v", tiered.Stats())
+	}
+
+	// An address removed from the remote is removed locally
+	remote.set("8.8.8.8", nil, nil)
+	if _, err := tiered.FindLocation(ctx, netip.MustParseAddr("8.8.8.8")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("FindLocation() of a removed IP error = %v, want ErrNotFound", err)
+	}
+	waitForWrites(t, tiered, 3)
+	if _, err := tiered.local.FindLocation(ctx, netip.MustParseAddr("8.8.8.8")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the removed IP to be deleted locally, got %v", err)
+	}
+}
+
+func TestTieredRepository_TrackedBound(t *testing.T) {
+	tiered, remote := newTieredForTest(t, 0, 2)
+	ctx := context.Background()
+	ips := []string{"8.8.8.8", "1.1.1.1", "9.9.9.9"}
+	for _, ip := range ips[1:] {
+		remote.set(ip, &models.Location{Country: "Australia", City: "Sydney"}, nil)
+	}
+
+	for _, ip := range ips {
+		if _, err := tiered.FindLocation(ctx, netip.MustParseAddr(ip)); err != nil {
+			t.Fatalf("FindLocation(%s) error = %v", ip, err)
+		}
+	}
+	waitForWrites(t, tiered, 3)
+	tiered.mu.Lock()
+	tracked := len(tiered.syncedAt)
+	tiered.mu.Unlock()
+	if tracked != 2 {
+		t.Fatalf("Expected 2 tracked answers, got %d", tracked)
+	}
+
+	// The forgotten answer reads through again; the others are answered locally
+	for _, ip := range ips {
+		if _, err := tiered.FindLocation(ctx, netip.MustParseAddr(ip)); err != nil {
+			t.Fatalf("FindLocation(%s) error = %v", ip, err)
+		}
+	}
+	if remote.lookups != 4 {
+		t.Errorf("Expected 4 remote lookups, got %d", remote.lookups)
+	}
+}
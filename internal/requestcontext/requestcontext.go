@@ -0,0 +1,156 @@
+// Package requestcontext provides typed accessors for values carried through a
+// request context, so middleware, handlers and services share keys instead of
+// each declaring their own.
+package requestcontext
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Key is a typed context key. Keys are compared by identity, so two keys created
+// with the same name never collide.
+type Key[T any] struct {
+	k *key
+}
+
+// key is the value actually stored in the context
+type key struct {
+	name string
+}
+
+func (k *key) String() string {
+	return "requestcontext." + k.name
+}
+
+// NewKey creates a key for values of type T; name only appears in debug output
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{k: &key{name: name}}
+}
+
+// With returns a copy of ctx carrying value
+func (k Key[T]) With(ctx context.Context, value T) context.Context {
+	return context.WithValue(ctx, k.k, value)
+}
+
+// Value returns the value stored under k, if any
+func (k Key[T]) Value(ctx context.Context) (T, bool) {
+	value, ok := ctx.Value(k.k).(T)
+	return value, ok
+}
+
+// Deadline sources
+const (
+	DeadlineServer = "server" // Configured default or per-route timeout
+	DeadlineClient = "client" // Shortened by X-Request-Timeout or Grpc-Timeout
+)
+
+// Deadline describes the timeout applied to a request
+type Deadline struct {
+	Timeout time.Duration
+	Source  string // DeadlineServer or DeadlineClient
+}
+
+// Cache statuses recorded in Served
+const (
+	CacheHit      = "hit"
+	CacheMiss     = "miss"
+	CacheDisabled = "disabled" // The dataset has no cache
+	CacheBypass   = "bypass"   // Answered without consulting a cache, as overrides are
+)
+
+// ServedMixed is reported by Served when lookups of one request disagree, as in a batch
+const ServedMixed = "mixed"
+
+// Served records which backend answered a request's lookups and whether the cache
+// did, for request metrics. It is safe for concurrent lookups of one request.
+type Served struct {
+	mu      sync.Mutex
+	backend string
+	cache   string
+}
+
+// Record adds one lookup answered by backend with the given cache status
+func (s *Served) Record(backend, cache string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backend = merge(s.backend, backend)
+	s.cache = merge(s.cache, cache)
+}
+
+// Labels returns the backend and cache status, both empty if no lookup was recorded
+func (s *Served) Labels() (backend, cache string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.backend, s.cache
+}
+
+func merge(current, value string) string {
+	if current == "" || current == value {
+		return value
+	}
+	return ServedMixed
+}
+
+var (
+	clientIDKey  = NewKey[string]("client_id")
+	requestIDKey = NewKey[string]("request_id")
+	deadlineKey  = NewKey[Deadline]("deadline")
+	servedKey    = NewKey[*Served]("served")
+	basePathKey  = NewKey[string]("base_path")
+)
+
+// WithClientID records the rate-limit identity of the caller
+func WithClientID(ctx context.Context, clientID string) context.Context {
+	return clientIDKey.With(ctx, clientID)
+}
+
+// ClientID returns the rate-limit identity of the caller, if known
+func ClientID(ctx context.Context) (string, bool) {
+	return clientIDKey.Value(ctx)
+}
+
+// WithRequestID records the request's correlation ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return requestIDKey.With(ctx, requestID)
+}
+
+// RequestID returns the request's correlation ID, if one was assigned
+func RequestID(ctx context.Context) (string, bool) {
+	return requestIDKey.Value(ctx)
+}
+
+// WithDeadline records the timeout applied to the request
+func WithDeadline(ctx context.Context, deadline Deadline) context.Context {
+	return deadlineKey.With(ctx, deadline)
+}
+
+// DeadlineFrom returns the timeout applied to the request, if any
+func DeadlineFrom(ctx context.Context) (Deadline, bool) {
+	return deadlineKey.Value(ctx)
+}
+
+// WithServed returns a context whose lookups are recorded into the returned Served
+func WithServed(ctx context.Context) (context.Context, *Served) {
+	served := &Served{}
+	return servedKey.With(ctx, served), served
+}
+
+// ServedFrom returns the request's Served record, or nil if nobody asked for one
+func ServedFrom(ctx context.Context) *Served {
+	served, _ := servedKey.Value(ctx)
+	return served
+}
+
+// WithBasePath records the path prefix stripped from the request before routing
+func WithBasePath(ctx context.Context, basePath string) context.Context {
+	return basePathKey.With(ctx, basePath)
+}
+
+// BasePath returns the path prefix stripped from the request, or "" if it was
+// routed from the root
+func BasePath(ctx context.Context) string {
+	basePath, _ := basePathKey.Value(ctx)
+	return basePath
+}
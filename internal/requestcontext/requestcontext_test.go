@@ -0,0 +1,63 @@
+package requestcontext
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKey_Isolation(t *testing.T) {
+	a := NewKey[string]("same")
+	b := NewKey[string]("same")
+
+	ctx := a.With(context.Background(), "a")
+	if value, ok := a.Value(ctx); !ok || value != "a" {
+		t.Errorf("Expected a, got %q (%v)", value, ok)
+	}
+	if _, ok := b.Value(ctx); ok {
+		t.Error("Expected keys with the same name not to collide")
+	}
+}
+
+func TestHelpers(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := ClientID(ctx); ok {
+		t.Error("Expected no client ID on an empty context")
+	}
+
+	ctx = WithClientID(ctx, "client-1")
+	ctx = WithRequestID(ctx, "req-1")
+	ctx = WithDeadline(ctx, Deadline{Timeout: time.Second, Source: DeadlineClient})
+
+	if clientID, _ := ClientID(ctx); clientID != "client-1" {
+		t.Errorf("Expected client-1, got %q", clientID)
+	}
+	if requestID, _ := RequestID(ctx); requestID != "req-1" {
+		t.Errorf("Expected req-1, got %q", requestID)
+	}
+	if deadline, ok := DeadlineFrom(ctx); !ok || deadline.Timeout != time.Second || deadline.Source != DeadlineClient {
+		t.Errorf("Unexpected deadline %+v", deadline)
+	}
+}
+
+func TestServed(t *testing.T) {
+	if ServedFrom(context.Background()) != nil {
+		t.Error("Expected no Served record on an empty context")
+	}
+
+	ctx, served := WithServed(context.Background())
+	if backend, cache := ServedFrom(ctx).Labels(); backend != "" || cache != "" {
+		t.Errorf("Expected empty labels before any lookup, got %q, %q", backend, cache)
+	}
+
+	served.Record("csv", CacheHit)
+	served.Record("csv", CacheHit)
+	if backend, cache := served.Labels(); backend != "csv" || cache != CacheHit {
+		t.Errorf("Expected csv, hit, got %q, %q", backend, cache)
+	}
+
+	served.Record("csv", CacheMiss)
+	if backend, cache := served.Labels(); backend != "csv" || cache != ServedMixed {
+		t.Errorf("Expected csv, mixed, got %q, %q", backend, cache)
+	}
+}
@@ -0,0 +1,178 @@
+// Package resolver resolves hostnames to the addresses they are geolocated by.
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Address families a lookup asks for
+const (
+	FamilyAny  = "any"  // A and AAAA records
+	FamilyIPv4 = "ipv4" // A records only
+	FamilyIPv6 = "ipv6" // AAAA records only
+)
+
+// Defaults for unset Config fields
+const (
+	DefaultTimeout      = 2 * time.Second
+	DefaultMaxAddresses = 16
+)
+
+// Lookup errors, wrapped with the hostname
+var (
+	ErrInvalidHostname = errors.New("invalid hostname")
+	ErrNotFound        = errors.New("hostname not found")
+	ErrTimeout         = errors.New("DNS resolution timed out")
+)
+
+// Config selects the DNS server and the records used; zero values use the defaults
+type Config struct {
+	Server       string        // DNS server as host:port or a DNS-over-HTTPS URL ("" uses the system resolver)
+	Family       string        // FamilyAny, FamilyIPv4 or FamilyIPv6 ("" is FamilyAny)
+	Timeout      time.Duration // Limit for one resolution
+	MaxAddresses int           // Addresses returned per hostname
+	HTTPClient   *http.Client  // Client for DNS-over-HTTPS queries (nil uses http.DefaultClient)
+}
+
+// IsDoH reports whether server names a DNS-over-HTTPS endpoint rather than a host:port
+func IsDoH(server string) bool {
+	return strings.HasPrefix(strings.ToLower(server), "https://")
+}
+
+// Resolver looks up the addresses of hostnames
+type Resolver struct {
+	resolver *net.Resolver
+	network  string
+	timeout  time.Duration
+	max      int
+}
+
+// New creates a resolver from cfg
+func New(cfg Config) (*Resolver, error) {
+	r := &Resolver{resolver: net.DefaultResolver, timeout: cfg.Timeout, max: cfg.MaxAddresses}
+	if r.timeout <= 0 {
+		r.timeout = DefaultTimeout
+	}
+	if r.max <= 0 {
+		r.max = DefaultMaxAddresses
+	}
+
+	switch cfg.Family {
+	case "", FamilyAny:
+		r.network = "ip"
+	case FamilyIPv4:
+		r.network = "ip4"
+	case FamilyIPv6:
+		r.network = "ip6"
+	default:
+		return nil, fmt.Errorf("invalid address family: %s", cfg.Family)
+	}
+
+	switch {
+	case IsDoH(cfg.Server):
+		// The endpoint's own name goes through the system resolver
+		u, err := url.Parse(cfg.Server)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid DNS-over-HTTPS URL %q", cfg.Server)
+		}
+		client := cfg.HTTPClient
+		if client == nil {
+			client = http.DefaultClient
+		}
+		endpoint := u.String()
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return &dohConn{ctx: ctx, client: client, endpoint: endpoint}, nil
+			},
+		}
+	case cfg.Server != "":
+		if _, _, err := net.SplitHostPort(cfg.Server); err != nil {
+			return nil, fmt.Errorf("invalid DNS server %q: %w", cfg.Server, err)
+		}
+		server := cfg.Server
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return r, nil
+}
+
+// Resolve returns the distinct addresses of name in the order the DNS server gave
+// them, IPv4-mapped addresses unmapped, up to the configured maximum
+func (r *Resolver) Resolve(ctx context.Context, name string) ([]netip.Addr, error) {
+	name = strings.TrimSuffix(name, ".")
+	if !ValidHostname(name) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidHostname, name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	found, err := r.resolver.LookupNetIP(ctx, r.network, name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		switch {
+		case errors.Is(ctx.Err(), context.Canceled):
+			return nil, fmt.Errorf("resolving %s: %w", name, ctx.Err())
+		case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &dnsErr) && dnsErr.IsTimeout):
+			return nil, fmt.Errorf("%w: %s", ErrTimeout, name)
+		}
+		return nil, fmt.Errorf("resolving %s: %w", name, err)
+	}
+
+	seen := make(map[netip.Addr]struct{}, len(found))
+	addrs := make([]netip.Addr, 0, min(len(found), r.max))
+	for _, addr := range found {
+		addr = addr.Unmap().WithZone("")
+		if _, dup := seen[addr]; dup {
+			continue
+		}
+		seen[addr] = struct{}{}
+		addrs = append(addrs, addr)
+		if len(addrs) == r.max {
+			break
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return addrs, nil
+}
+
+// ValidHostname reports whether name is a DNS hostname of letters, digits, hyphens
+// and underscores in dot-separated labels, without a trailing dot. Address literals
+// are rejected so they go through the IP lookup endpoints instead.
+func ValidHostname(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	if _, err := netip.ParseAddr(name); err == nil {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestValidHostname(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"example.com", true},
+		{"_dmarc.mail-1.example.co.uk", true},
+		{"localhost", true},
+		{"", false},
+		{"8.8.8.8", false},
+		{"2001:db8::1", false},
+		{"-bad.example.com", false},
+		{"bad-.example.com", false},
+		{"a..b", false},
+		{"exa mple.com", false},
+		{"example.com/path", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidHostname(tt.name); got != tt.want {
+			t.Errorf("ValidHostname(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNew_RejectsInvalidConfig(t *testing.T) {
+	if _, err := New(Config{Family: "ipv5"}); err == nil {
+		t.Error("Expected an unknown family to be rejected")
+	}
+	if _, err := New(Config{Server: "10.0.0.53"}); err == nil {
+		t.Error("Expected a server without a port to be rejected")
+	}
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	r, err := New(Config{Family: FamilyIPv4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := r.Resolve(context.Background(), "localhost.")
+	if err != nil {
+		t.Fatalf("Resolve(localhost) error = %v", err)
+	}
+	if len(addrs) != 1 || addrs[0] != netip.MustParseAddr("127.0.0.1") {
+		t.Errorf("Resolve(localhost) = %v, want [127.0.0.1]", addrs)
+	}
+
+	if _, err := r.Resolve(context.Background(), "not a host"); !errors.Is(err, ErrInvalidHostname) {
+		t.Errorf("Expected ErrInvalidHostname, got %v", err)
+	}
+}
+
+func TestResolver_Timeout(t *testing.T) {
+	// A DNS server that never answers
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	r, err := New(Config{Server: conn.LocalAddr().String(), Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Resolve(context.Background(), "example.com"); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout, got %v", err)
+	}
+}
+
+// dohHandler answers A and AAAA queries for "doh.example.test" and reports every
+// other name as nonexistent
+func dohHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			t.Errorf("Query sent as %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		query, _ := io.ReadAll(r.Body)
+
+		// The question is the name's labels followed by the type and class
+		end := 12
+		var name string
+		for query[end] != 0 {
+			label := int(query[end])
+			name += string(query[end+1:end+1+label]) + "."
+			end += 1 + label
+		}
+		end += 5
+		qtype := binary.BigEndian.Uint16(query[end-4:])
+
+		var rdata []byte
+		switch {
+		case name == "doh.example.test." && qtype == 1:
+			rdata = netip.MustParseAddr("192.0.2.10").AsSlice()
+		case name == "doh.example.test." && qtype == 28:
+			rdata = netip.MustParseAddr("2001:db8::10").AsSlice()
+		}
+
+		answer := append([]byte{}, query[:end]...)
+		binary.BigEndian.PutUint16(answer[2:], 0x8180) // Response, recursion available
+		binary.BigEndian.PutUint16(answer[8:], 0)
+		binary.BigEndian.PutUint16(answer[10:], 0)
+		if name != "doh.example.test." {
+			answer[3] |= 3 // NXDOMAIN
+		}
+		if rdata != nil {
+			binary.BigEndian.PutUint16(answer[6:], 1)
+			answer = append(answer, 0xc0, 12) // Pointer to the question's name
+			answer = binary.BigEndian.AppendUint16(answer, qtype)
+			answer = binary.BigEndian.AppendUint16(answer, 1)
+			answer = binary.BigEndian.AppendUint32(answer, 60)
+			answer = binary.BigEndian.AppendUint16(answer, uint16(len(rdata)))
+			answer = append(answer, rdata...)
+		} else {
+			binary.BigEndian.PutUint16(answer[6:], 0)
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(answer)
+	}
+}
+
+func TestResolver_DNSOverHTTPS(t *testing.T) {
+	server := httptest.NewTLSServer(dohHandler(t))
+	defer server.Close()
+
+	r, err := New(Config{Server: server.URL + "/dns-query", HTTPClient: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := r.Resolve(context.Background(), "doh.example.test")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	want := map[netip.Addr]bool{netip.MustParseAddr("192.0.2.10"): true, netip.MustParseAddr("2001:db8::10"): true}
+	if len(addrs) != 2 || !want[addrs[0]] || !want[addrs[1]] {
+		t.Errorf("Resolve() = %v, want 192.0.2.10 and 2001:db8::10", addrs)
+	}
+
+	if _, err := r.Resolve(context.Background(), "missing.example.test"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := New(Config{Server: "https://"}); err == nil {
+		t.Error("Expected a DNS-over-HTTPS URL without a host to be rejected")
+	}
+}
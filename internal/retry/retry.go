@@ -0,0 +1,171 @@
+// Package retry repeats operations against backends that fail transiently, such as
+// a database failing over, a dropped connection or an object store answering 503,
+// with exponential backoff and jitter. Only errors classified as transient are
+// retried, so a missing record or a rejected credential fails at once.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Policy bounds how an operation is retried
+type Policy struct {
+	MaxAttempts     int           // Attempts in all, including the first (0 or 1 never retries)
+	InitialInterval time.Duration // Wait before the first retry
+	MaxInterval     time.Duration // Longest wait between attempts (0 leaves it unbounded)
+	Multiplier      float64       // Growth of the wait per attempt (below 1 uses 2)
+	// Jitter randomizes each wait by up to this fraction either way (0-1), so clients
+	// that failed together don't retry together
+	Jitter float64
+	// Notify, when set, is called before each retry with the error and the wait
+	Notify func(err error, wait time.Duration)
+}
+
+// DefaultPolicy suits a lookup waiting on a remote backend: three attempts within
+// roughly a quarter of a second
+var DefaultPolicy = Policy{
+	MaxAttempts:     3,
+	InitialInterval: 50 * time.Millisecond,
+	MaxInterval:     200 * time.Millisecond,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+// Do calls fn until it succeeds, fails with an error that isn't Retryable, the
+// attempts run out or ctx ends, and returns fn's last error. A wait that would end
+// after ctx's deadline isn't started.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !Retryable(err) {
+			return unwrapMarks(err)
+		}
+		wait := p.Backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return unwrapMarks(err)
+		}
+		if p.Notify != nil {
+			p.Notify(unwrapMarks(err), wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return unwrapMarks(err)
+		case <-timer.C:
+		}
+	}
+}
+
+// Backoff returns the wait after the given failed attempt, counting from 1
+func (p Policy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	wait := float64(p.InitialInterval) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 {
+		wait = min(wait, float64(p.MaxInterval))
+	}
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 {
+		wait *= 1 + jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(wait)
+}
+
+// marked records an explicit classification of err
+type marked struct {
+	err       error
+	retryable bool
+}
+
+func (m *marked) Error() string { return m.err.Error() }
+func (m *marked) Unwrap() error { return m.err }
+
+// Permanent marks err as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &marked{err: err}
+}
+
+// Transient marks err as worth retrying, for failures the backend knows to be
+// temporary but that Retryable wouldn't recognize
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &marked{err: err, retryable: true}
+}
+
+// unwrapMarks returns err without a classification mark, so callers see the error
+// the operation returned
+func unwrapMarks(err error) error {
+	var m *marked
+	if errors.As(err, &m) && m == err {
+		return m.err
+	}
+	return err
+}
+
+// StatusError is an HTTP response that failed with a status code
+type StatusError struct {
+	StatusCode int
+	Message    string // Start of the response body, if any
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("status %d", e.StatusCode)
+}
+
+// RetryableStatus reports whether a request failing with status may succeed if
+// repeated: timeouts, rate limiting and server errors other than 501
+func RetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented:
+		return false
+	}
+	return status >= 500 && status <= 599
+}
+
+// Retryable reports whether err is transient: marked with Transient, a network
+// timeout, a refused or reset connection, a response cut short or a StatusError
+// with a RetryableStatus. Errors marked with Permanent and the context's own errors
+// never are, and neither is anything unrecognized.
+func Retryable(err error) bool {
+	var m *marked
+	if errors.As(err, &m) {
+		return m.retryable
+	}
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return RetryableStatus(status.StatusCode)
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,138 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func fastPolicy(attempts int) Policy {
+	return Policy{MaxAttempts: attempts, InitialInterval: time.Millisecond, MaxInterval: 2 * time.Millisecond}
+}
+
+func TestDo(t *testing.T) {
+	transient := &StatusError{StatusCode: http.StatusServiceUnavailable}
+	invalid := errors.New("invalid credentials")
+	tests := []struct {
+		name         string
+		errs         []error // Returned by successive attempts; nil afterwards
+		attempts     int
+		wantErr      error
+		wantAttempts int
+	}{
+		{"success", nil, 3, nil, 1},
+		{"recovers", []error{transient, transient}, 3, nil, 3},
+		{"gives up", []error{transient, transient, transient, transient}, 3, transient, 3},
+		{"never retries without attempts", []error{transient}, 0, transient, 1},
+		{"permanent error", []error{invalid}, 3, invalid, 1},
+		{"marked transient", []error{Transient(errors.New("failover")), nil}, 3, nil, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := Do(context.Background(), fastPolicy(tt.attempts), func(context.Context) error {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+			if attempts != tt.wantAttempts {
+				t.Errorf("Do() made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDo_ReturnsUnmarkedError(t *testing.T) {
+	cause := errors.New("failover")
+	err := Do(context.Background(), fastPolicy(2), func(context.Context) error { return Transient(cause) })
+	if err != cause {
+		t.Errorf("Do() error = %#v, want the operation's own error", err)
+	}
+}
+
+func TestDo_StopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{MaxAttempts: 5, InitialInterval: time.Hour}
+	attempts := 0
+	p.Notify = func(error, time.Duration) { cancel() }
+
+	err := Do(ctx, p, func(context.Context) error {
+		attempts++
+		return syscall.ECONNRESET
+	})
+	if attempts != 1 || !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Do() made %d attempts with error %v, want 1 ending in the backend's error", attempts, err)
+	}
+
+	// A wait past the deadline isn't started
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	Do(ctx, Policy{MaxAttempts: 5, InitialInterval: time.Second}, func(context.Context) error { return syscall.ECONNRESET })
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Do() waited %v past the context's deadline", elapsed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		if got := p.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(2); got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("Backoff(2) with 50%% jitter = %v, want within 100ms-300ms", got)
+		}
+	}
+}
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("location not found"), false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+		{&StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{&StatusError{StatusCode: http.StatusNotImplemented}, false},
+		{&StatusError{StatusCode: http.StatusForbidden}, false},
+		{fmt.Errorf("reading row: %w", io.ErrUnexpectedEOF), true},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{fmt.Errorf("query: %w", syscall.ECONNRESET), true},
+		{&net.OpError{Op: "read", Err: timeoutError{}}, true},
+		{Permanent(syscall.ECONNRESET), false},
+		{Transient(errors.New("replica lagging")), true},
+		{fmt.Errorf("wrapped: %w", Transient(errors.New("replica lagging"))), true},
+	}
+	for _, tt := range tests {
+		if got := Retryable(tt.err); got != tt.want {
+			t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
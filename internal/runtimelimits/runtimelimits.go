@@ -0,0 +1,278 @@
+// Package runtimelimits fits the Go runtime to the container it runs in. Without it,
+// GOMAXPROCS follows the host's CPUs rather than the container's CPU quota, so a pod
+// limited to two CPUs on a 64-core node runs 64 threads and is throttled by the
+// kernel, and the garbage collector knows nothing of the memory limit until the
+// container is OOM-killed. Limits are read from cgroup v2, or v1 when that's all the
+// host mounts.
+package runtimelimits
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// DefaultMemoryLimitRatio is the share of the container memory limit GOMEMLIMIT is
+// set to, leaving headroom for memory the Go runtime doesn't manage
+const DefaultMemoryLimitRatio = 0.9
+
+// Sources of an applied value
+const (
+	SourceDefault = "default" // Left as the runtime chose it
+	SourceEnv     = "env"     // Set by the GOMAXPROCS or GOMEMLIMIT variable
+	SourceCgroup  = "cgroup"  // Derived from the container's cgroup limits
+)
+
+// Limits are the container's resource limits; zero values mean unlimited
+type Limits struct {
+	Cgroup      string  `json:"cgroup,omitempty"`       // "v2", "v1", or "" outside a cgroup with limits
+	CPUQuota    float64 `json:"cpu_quota,omitempty"`    // CPUs the container may use, such as 1.5
+	MemoryLimit int64   `json:"memory_limit,omitempty"` // Bytes the container may use
+}
+
+// Config selects what Apply adjusts
+type Config struct {
+	AutoMaxProcs     bool    // Set GOMAXPROCS from the CPU quota
+	AutoMemoryLimit  bool    // Set GOMEMLIMIT from the memory limit
+	MemoryLimitRatio float64 // Share of the memory limit to use (0 uses DefaultMemoryLimitRatio)
+}
+
+// Applied records the runtime settings chosen at startup
+type Applied struct {
+	Limits          Limits `json:"limits"`
+	NumCPU          int    `json:"num_cpu"`
+	GOMAXPROCS      int    `json:"gomaxprocs"`
+	GOMAXPROCSFrom  string `json:"gomaxprocs_source"`
+	GOMEMLIMIT      int64  `json:"gomemlimit"` // math.MaxInt64 when unlimited
+	GOMEMLIMITFrom  string `json:"gomemlimit_source"`
+	DetectionFailed string `json:"detection_error,omitempty"`
+}
+
+// Apply detects the container's limits and sets GOMAXPROCS and GOMEMLIMIT from them
+// as cfg allows. Values set through the GOMAXPROCS and GOMEMLIMIT variables are
+// always kept.
+func Apply(cfg Config) Applied {
+	limits, err := Detect(os.DirFS("/"))
+	applied := apply(cfg, limits, os.LookupEnv)
+	if err != nil {
+		applied.DetectionFailed = err.Error()
+	}
+	return applied
+}
+
+// apply sets the runtime from limits; lookupEnv reports the variables set
+func apply(cfg Config, limits Limits, lookupEnv func(string) (string, bool)) Applied {
+	applied := Applied{
+		Limits:         limits,
+		NumCPU:         runtime.NumCPU(),
+		GOMAXPROCSFrom: SourceDefault,
+		GOMEMLIMITFrom: SourceDefault,
+	}
+
+	if _, ok := lookupEnv("GOMAXPROCS"); ok {
+		applied.GOMAXPROCSFrom = SourceEnv
+	} else if cfg.AutoMaxProcs && limits.CPUQuota > 0 {
+		runtime.GOMAXPROCS(MaxProcs(limits.CPUQuota, applied.NumCPU))
+		applied.GOMAXPROCSFrom = SourceCgroup
+	}
+	applied.GOMAXPROCS = runtime.GOMAXPROCS(0)
+
+	if _, ok := lookupEnv("GOMEMLIMIT"); ok {
+		applied.GOMEMLIMITFrom = SourceEnv
+	} else if cfg.AutoMemoryLimit && limits.MemoryLimit > 0 {
+		debug.SetMemoryLimit(MemoryLimit(limits.MemoryLimit, cfg.MemoryLimitRatio))
+		applied.GOMEMLIMITFrom = SourceCgroup
+	}
+	applied.GOMEMLIMIT = debug.SetMemoryLimit(-1)
+	return applied
+}
+
+// MaxProcs returns the GOMAXPROCS for a CPU quota: the quota rounded down, since a
+// partial CPU can't run another thread without being throttled, but at least one
+// and at most numCPU
+func MaxProcs(quota float64, numCPU int) int {
+	return max(1, min(int(math.Floor(quota)), numCPU))
+}
+
+// MemoryLimit returns the GOMEMLIMIT for a container memory limit
+func MemoryLimit(limit int64, ratio float64) int64 {
+	if ratio <= 0 || ratio > 1 {
+		ratio = DefaultMemoryLimitRatio
+	}
+	return int64(float64(limit) * ratio)
+}
+
+// Current reports the runtime's GOMAXPROCS and GOMEMLIMIT now, which may have been
+// changed since startup
+func Current() (maxProcs int, memoryLimit int64) {
+	return runtime.GOMAXPROCS(0), debug.SetMemoryLimit(-1)
+}
+
+// Detect reads the limits of the cgroup the process runs in from fsys, the root of
+// the file system. A process outside any cgroup, or in one without limits, gets zero
+// Limits and no error.
+func Detect(fsys fs.FS) (Limits, error) {
+	membership, err := fs.ReadFile(fsys, "proc/self/cgroup")
+	if errors.Is(err, fs.ErrNotExist) {
+		return Limits{}, nil // Not Linux
+	}
+	if err != nil {
+		return Limits{}, err
+	}
+	groups := parseMembership(membership)
+
+	if group, ok := groups[""]; ok {
+		if limits, found, err := detectV2(fsys, group); found || err != nil {
+			return limits, err
+		}
+	}
+	return detectV1(fsys, groups)
+}
+
+// parseMembership maps each controller in /proc/self/cgroup to the process's group;
+// the cgroup v2 hierarchy has the empty controller name
+func parseMembership(data []byte) map[string]string {
+	groups := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			groups[controller] = parts[2]
+		}
+	}
+	return groups
+}
+
+// candidates lists where a group's files may be: under its own path, or at the mount
+// root when the container has its own cgroup namespace and sees its group as "/"
+func candidates(mount, group string) []string {
+	dirs := []string{path.Join(mount, strings.TrimPrefix(group, "/"))}
+	if group != "/" {
+		dirs = append(dirs, mount)
+	}
+	return dirs
+}
+
+// detectV2 reads cpu.max and memory.max; found is false when no v2 hierarchy is mounted
+func detectV2(fsys fs.FS, group string) (limits Limits, found bool, err error) {
+	for _, dir := range candidates("sys/fs/cgroup", group) {
+		cpu, cpuErr := fs.ReadFile(fsys, path.Join(dir, "cpu.max"))
+		memory, memErr := fs.ReadFile(fsys, path.Join(dir, "memory.max"))
+		if errors.Is(cpuErr, fs.ErrNotExist) && errors.Is(memErr, fs.ErrNotExist) {
+			continue
+		}
+		limits.Cgroup = "v2"
+		if cpuErr == nil {
+			// "$MAX $PERIOD", where $MAX is "max" without a quota
+			fields := strings.Fields(string(cpu))
+			if len(fields) == 2 && fields[0] != "max" {
+				if limits.CPUQuota, err = quota(fields[0], fields[1]); err != nil {
+					return limits, true, err
+				}
+			}
+		}
+		if memErr == nil {
+			if value := strings.TrimSpace(string(memory)); value != "max" {
+				if limits.MemoryLimit, err = strconv.ParseInt(value, 10, 64); err != nil {
+					return limits, true, err
+				}
+			}
+		}
+		return limits, true, nil
+	}
+	return Limits{}, false, nil
+}
+
+// unlimitedV1Memory is above any memory limit cgroup v1 reports for an unlimited group
+const unlimitedV1Memory = 1 << 62
+
+// detectV1 reads the CFS quota and memory limit of the v1 cpu and memory controllers
+func detectV1(fsys fs.FS, groups map[string]string) (Limits, error) {
+	var limits Limits
+	if group, ok := groups["cpu"]; ok {
+		found, err := detectV1CPU(fsys, group, &limits)
+		if err != nil {
+			return limits, err
+		}
+		if found {
+			limits.Cgroup = "v1"
+		}
+	}
+	if group, ok := groups["memory"]; ok {
+		found, err := detectV1Memory(fsys, group, &limits)
+		if err != nil {
+			return limits, err
+		}
+		if found {
+			limits.Cgroup = "v1"
+		}
+	}
+	return limits, nil
+}
+
+// detectV1CPU reads cpu.cfs_quota_us and cpu.cfs_period_us into limits
+func detectV1CPU(fsys fs.FS, group string, limits *Limits) (bool, error) {
+	for _, mount := range []string{"sys/fs/cgroup/cpu", "sys/fs/cgroup/cpu,cpuacct"} {
+		for _, dir := range candidates(mount, group) {
+			quotaUS, err := fs.ReadFile(fsys, path.Join(dir, "cpu.cfs_quota_us"))
+			if err != nil {
+				continue
+			}
+			periodUS, err := fs.ReadFile(fsys, path.Join(dir, "cpu.cfs_period_us"))
+			if err != nil {
+				continue
+			}
+			// A quota of -1 is unlimited
+			if q := strings.TrimSpace(string(quotaUS)); q != "-1" {
+				limits.CPUQuota, err = quota(q, strings.TrimSpace(string(periodUS)))
+				return true, err
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// detectV1Memory reads memory.limit_in_bytes into limits
+func detectV1Memory(fsys fs.FS, group string, limits *Limits) (bool, error) {
+	for _, dir := range candidates("sys/fs/cgroup/memory", group) {
+		data, err := fs.ReadFile(fsys, path.Join(dir, "memory.limit_in_bytes"))
+		if err != nil {
+			continue
+		}
+		limit, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return true, err
+		}
+		if limit < unlimitedV1Memory {
+			limits.MemoryLimit = limit
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// quota divides a CFS quota by its period
+func quota(quotaValue, periodValue string) (float64, error) {
+	q, err := strconv.ParseFloat(quotaValue, 64)
+	if err != nil {
+		return 0, err
+	}
+	period, err := strconv.ParseFloat(periodValue, 64)
+	if err != nil || period <= 0 {
+		return 0, errors.New("invalid CPU quota period " + strconv.Quote(periodValue))
+	}
+	return q / period, nil
+}
@@ -0,0 +1,163 @@
+package runtimelimits
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"testing/fstest"
+)
+
+func file(data string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(data)}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want Limits
+	}{
+		{
+			name: "not Linux",
+			fsys: fstest.MapFS{},
+			want: Limits{},
+		},
+		{
+			name: "cgroup v2 with its own namespace",
+			fsys: fstest.MapFS{
+				"proc/self/cgroup":          file("0::/\n"),
+				"sys/fs/cgroup/cpu.max":     file("150000 100000\n"),
+				"sys/fs/cgroup/memory.max":  file("536870912\n"),
+				"sys/fs/cgroup/cgroup.type": file("domain\n"),
+			},
+			want: Limits{Cgroup: "v2", CPUQuota: 1.5, MemoryLimit: 512 << 20},
+		},
+		{
+			name: "cgroup v2 in a nested group",
+			fsys: fstest.MapFS{
+				"proc/self/cgroup":                           file("0::/kubepods/pod1/app\n"),
+				"sys/fs/cgroup/kubepods/pod1/app/cpu.max":    file("200000 100000\n"),
+				"sys/fs/cgroup/kubepods/pod1/app/memory.max": file("max\n"),
+			},
+			want: Limits{Cgroup: "v2", CPUQuota: 2},
+		},
+		{
+			name: "cgroup v2 without limits",
+			fsys: fstest.MapFS{
+				"proc/self/cgroup":         file("0::/\n"),
+				"sys/fs/cgroup/cpu.max":    file("max 100000\n"),
+				"sys/fs/cgroup/memory.max": file("max\n"),
+			},
+			want: Limits{Cgroup: "v2"},
+		},
+		{
+			name: "cgroup v1",
+			fsys: fstest.MapFS{
+				"proc/self/cgroup":                            file("12:memory:/docker/abc\n4:cpu,cpuacct:/docker/abc\n0::/\n"),
+				"sys/fs/cgroup/cpu,cpuacct/cpu.cfs_quota_us":  file("50000\n"),
+				"sys/fs/cgroup/cpu,cpuacct/cpu.cfs_period_us": file("100000\n"),
+				"sys/fs/cgroup/memory/memory.limit_in_bytes":  file("1073741824\n"),
+			},
+			want: Limits{Cgroup: "v1", CPUQuota: 0.5, MemoryLimit: 1 << 30},
+		},
+		{
+			name: "cgroup v1 without limits",
+			fsys: fstest.MapFS{
+				"proc/self/cgroup":                            file("12:memory:/\n4:cpu,cpuacct:/\n"),
+				"sys/fs/cgroup/cpu,cpuacct/cpu.cfs_quota_us":  file("-1\n"),
+				"sys/fs/cgroup/cpu,cpuacct/cpu.cfs_period_us": file("100000\n"),
+				"sys/fs/cgroup/memory/memory.limit_in_bytes":  file("9223372036854771712\n"),
+			},
+			want: Limits{Cgroup: "v1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Detect(tt.fsys)
+			if err != nil {
+				t.Fatalf("Detect() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Detect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetect_InvalidLimits(t *testing.T) {
+	_, err := Detect(fstest.MapFS{
+		"proc/self/cgroup":      file("0::/\n"),
+		"sys/fs/cgroup/cpu.max": file("150000 0\n"),
+	})
+	if err == nil {
+		t.Error("Expected an error for a zero CPU period")
+	}
+}
+
+func TestMaxProcs(t *testing.T) {
+	tests := []struct {
+		quota  float64
+		numCPU int
+		want   int
+	}{
+		{0.5, 8, 1},
+		{1.5, 8, 1},
+		{2, 8, 2},
+		{3.9, 8, 3},
+		{16, 8, 8},
+	}
+	for _, tt := range tests {
+		if got := MaxProcs(tt.quota, tt.numCPU); got != tt.want {
+			t.Errorf("MaxProcs(%v, %d) = %d, want %d", tt.quota, tt.numCPU, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	if got := MemoryLimit(1000, 0); got != 900 {
+		t.Errorf("MemoryLimit(1000, 0) = %d, want the default ratio's 900", got)
+	}
+	if got := MemoryLimit(1000, 0.5); got != 500 {
+		t.Errorf("MemoryLimit(1000, 0.5) = %d, want 500", got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	procs, memoryLimit := Current()
+	t.Cleanup(func() {
+		runtime.GOMAXPROCS(procs)
+		debug.SetMemoryLimit(memoryLimit)
+	})
+	noEnv := func(string) (string, bool) { return "", false }
+	limits := Limits{Cgroup: "v2", CPUQuota: 1, MemoryLimit: 1 << 30}
+
+	applied := apply(Config{AutoMaxProcs: true, AutoMemoryLimit: true, MemoryLimitRatio: 0.5}, limits, noEnv)
+	if applied.GOMAXPROCS != 1 || applied.GOMAXPROCSFrom != SourceCgroup {
+		t.Errorf("Expected GOMAXPROCS 1 from the cgroup, got %d from %s", applied.GOMAXPROCS, applied.GOMAXPROCSFrom)
+	}
+	if applied.GOMEMLIMIT != 512<<20 || applied.GOMEMLIMITFrom != SourceCgroup {
+		t.Errorf("Expected GOMEMLIMIT 512MiB from the cgroup, got %d from %s", applied.GOMEMLIMIT, applied.GOMEMLIMITFrom)
+	}
+	if got, _ := Current(); got != 1 {
+		t.Errorf("Expected the runtime to run with GOMAXPROCS 1, got %d", got)
+	}
+
+	// Variables set by the operator win
+	runtime.GOMAXPROCS(procs)
+	debug.SetMemoryLimit(memoryLimit)
+	setEnv := func(string) (string, bool) { return "4", true }
+	applied = apply(Config{AutoMaxProcs: true, AutoMemoryLimit: true}, limits, setEnv)
+	if applied.GOMAXPROCSFrom != SourceEnv || applied.GOMAXPROCS != procs {
+		t.Errorf("Expected GOMAXPROCS %d from the environment, got %d from %s", procs, applied.GOMAXPROCS, applied.GOMAXPROCSFrom)
+	}
+	if applied.GOMEMLIMITFrom != SourceEnv || applied.GOMEMLIMIT != memoryLimit {
+		t.Errorf("Expected GOMEMLIMIT %d from the environment, got %d from %s", memoryLimit, applied.GOMEMLIMIT, applied.GOMEMLIMITFrom)
+	}
+
+	// Disabled, nothing changes
+	applied = apply(Config{}, limits, noEnv)
+	if applied.GOMAXPROCSFrom != SourceDefault || applied.GOMEMLIMITFrom != SourceDefault {
+		t.Errorf("Expected default sources when disabled, got %s and %s", applied.GOMAXPROCSFrom, applied.GOMEMLIMITFrom)
+	}
+}
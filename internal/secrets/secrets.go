@@ -0,0 +1,224 @@
+// Package secrets resolves credentials from files and external secret managers, so
+// they never have to be set directly in environment variables.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// Prefix marks a setting whose value is a reference to resolve through the provider,
+// e.g. "secret:ipgeo/db#password"
+const Prefix = "secret:"
+
+// DefaultTTL is how long a fetched secret is served from the cache
+const DefaultTTL = 5 * time.Minute
+
+// ErrNotFound is returned by providers for secrets or fields that don't exist
+var ErrNotFound = errors.New("secret not found")
+
+// Provider fetches secrets from an external manager such as Vault or AWS Secrets
+// Manager. A secret's value is a string; structured secrets are JSON objects whose
+// fields are picked with "name#field" references.
+type Provider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// RotateHook is called with the reference of a secret whose value changed
+type RotateHook func(ref string)
+
+// cacheEntry is a fetched secret value
+type cacheEntry struct {
+	value   string
+	fetched time.Time
+}
+
+// Cache resolves references through a provider, serving fetched secrets for a TTL.
+// Refresh refetches every secret resolved so far and calls the rotation hooks for
+// those that changed.
+type Cache struct {
+	provider Provider
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry // Keyed by secret name
+	refs    map[string]bool       // References resolved so far
+	hooks   []RotateHook
+
+	rotations *metrics.Counter
+	failures  *metrics.Counter
+}
+
+// NewCache creates a cache in front of provider; a zero ttl uses DefaultTTL
+func NewCache(provider Provider, ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Cache{
+		provider: provider,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[string]cacheEntry),
+		refs:     make(map[string]bool),
+	}
+}
+
+// RegisterMetrics exposes rotation and refresh failure counts on the registry
+func (c *Cache) RegisterMetrics(registry *metrics.Registry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rotations = registry.NewCounter("ipgeo_secrets_rotations_total",
+		"Secrets whose value changed on refresh")
+	c.failures = registry.NewCounter("ipgeo_secrets_refresh_failures_total",
+		"Secret refreshes that failed")
+}
+
+// OnRotate registers a hook called when a resolved secret changes on refresh
+func (c *Cache) OnRotate(hook RotateHook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, hook)
+}
+
+// Resolve returns the value of a reference, "name" or "name#field"
+func (c *Cache) Resolve(ctx context.Context, ref string) (string, error) {
+	name, field, _ := strings.Cut(ref, "#")
+	value, err := c.get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.refs[ref] = true
+	c.mu.Unlock()
+	return pickField(value, field)
+}
+
+// get returns a secret from the cache, fetching it when missing or expired. A secret
+// that can't be refetched is served stale rather than failing.
+func (c *Cache) get(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && c.now().Sub(entry.fetched) < c.ttl {
+		return entry.value, nil
+	}
+
+	value, err := c.provider.GetSecret(ctx, name)
+	if err != nil {
+		if ok {
+			return entry.value, nil
+		}
+		return "", fmt.Errorf("failed to fetch secret %s: %w", name, err)
+	}
+	c.mu.Lock()
+	c.entries[name] = cacheEntry{value: value, fetched: c.now()}
+	c.mu.Unlock()
+	return value, nil
+}
+
+// Refresh refetches every secret resolved so far and calls the rotation hooks for
+// references whose value changed. Secrets that fail to refetch keep their value.
+func (c *Cache) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	old := make(map[string]cacheEntry, len(c.entries))
+	for name, entry := range c.entries {
+		old[name] = entry
+	}
+	refs := make([]string, 0, len(c.refs))
+	for ref := range c.refs {
+		refs = append(refs, ref)
+	}
+	c.mu.Unlock()
+
+	var errs []error
+	for name := range old {
+		value, err := c.provider.GetSecret(ctx, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to refresh secret %s: %w", name, err))
+			if c.failures != nil {
+				c.failures.Inc()
+			}
+			continue
+		}
+		c.mu.Lock()
+		c.entries[name] = cacheEntry{value: value, fetched: c.now()}
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	hooks := append([]RotateHook(nil), c.hooks...)
+	var rotated []string
+	for _, ref := range refs {
+		name, field, _ := strings.Cut(ref, "#")
+		before, _ := pickField(old[name].value, field)
+		after, _ := pickField(c.entries[name].value, field)
+		if before != after {
+			rotated = append(rotated, ref)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, ref := range rotated {
+		if c.rotations != nil {
+			c.rotations.Inc()
+		}
+		for _, hook := range hooks {
+			hook(ref)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run refreshes the cached secrets every interval until ctx is done
+func (c *Cache) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// pickField returns field of a JSON object secret, or the whole value when field is empty
+func pickField(value, field string) (string, error) {
+	if field == "" {
+		return value, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, so field %s can't be read", field)
+	}
+	v, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("field %s: %w", field, ErrNotFound)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// ReadFile reads a secret from a file, such as a mounted Kubernetes or Docker secret,
+// without its trailing newline
+func ReadFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
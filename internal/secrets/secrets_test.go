@@ -0,0 +1,159 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeProvider serves secrets from a map and counts fetches
+type fakeProvider struct {
+	values  map[string]string
+	err     error
+	fetches int
+}
+
+func (p *fakeProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	p.fetches++
+	if p.err != nil {
+		return "", p.err
+	}
+	value, ok := p.values[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func TestCache_Resolve(t *testing.T) {
+	provider := &fakeProvider{values: map[string]string{
+		"ipgeo/db":    `{"password":"s3cret","port":5432}`,
+		"ipgeo/token": "plain-token",
+	}}
+	cache := NewCache(provider, time.Minute)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"ipgeo/db#password", "s3cret", false},
+		{"ipgeo/db#port", "5432", false},
+		{"ipgeo/token", "plain-token", false},
+		{"ipgeo/db#missing", "", true},
+		{"ipgeo/token#password", "", true},
+		{"ipgeo/unknown", "", true},
+	}
+	for _, tt := range tests {
+		got, err := cache.Resolve(ctx, tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Resolve(%q) = %q, %v; want %q, error %v", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	// Fields of one secret share a fetch while the TTL lasts
+	fetches := provider.fetches
+	cache.Resolve(ctx, "ipgeo/db#password")
+	if provider.fetches != fetches {
+		t.Errorf("Expected a cached secret, got %d fetches", provider.fetches-fetches)
+	}
+
+	// Expired secrets are served stale when the provider is down
+	now = now.Add(2 * time.Minute)
+	provider.err = errors.New("connection refused")
+	if got, err := cache.Resolve(ctx, "ipgeo/db#password"); err != nil || got != "s3cret" {
+		t.Errorf("Expected the stale secret, got %q, %v", got, err)
+	}
+}
+
+func TestCache_RefreshRotation(t *testing.T) {
+	provider := &fakeProvider{values: map[string]string{
+		"ipgeo/db": `{"password":"old","user":"ipgeo"}`,
+	}}
+	cache := NewCache(provider, 0)
+	ctx := context.Background()
+	cache.Resolve(ctx, "ipgeo/db#password")
+	cache.Resolve(ctx, "ipgeo/db#user")
+
+	var rotated []string
+	cache.OnRotate(func(ref string) { rotated = append(rotated, ref) })
+
+	if err := cache.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if len(rotated) != 0 {
+		t.Errorf("Expected no rotation for unchanged secrets, got %v", rotated)
+	}
+
+	provider.values["ipgeo/db"] = `{"password":"new","user":"ipgeo"}`
+	if err := cache.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if len(rotated) != 1 || rotated[0] != "ipgeo/db#password" {
+		t.Errorf("Expected the password to rotate, got %v", rotated)
+	}
+	if got, _ := cache.Resolve(ctx, "ipgeo/db#password"); got != "new" {
+		t.Errorf("Expected the rotated value, got %q", got)
+	}
+
+	provider.err = errors.New("connection refused")
+	if err := cache.Refresh(ctx); err == nil {
+		t.Error("Expected the failed refresh to be reported")
+	}
+	if got, _ := cache.Resolve(ctx, "ipgeo/db#password"); got != "new" {
+		t.Errorf("Expected a failed refresh to keep the value, got %q", got)
+	}
+}
+
+func TestVault_GetSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/data/ipgeo/db":
+			w.Write([]byte(`{"data":{"data":{"password":"s3cret"},"metadata":{"version":3}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	vault := NewVault(VaultConfig{Addr: server.URL + "/", Token: "root", Namespace: "team", Mount: "kv"})
+	cache := NewCache(vault, 0)
+	got, err := cache.Resolve(context.Background(), "ipgeo/db#password")
+	if err != nil || got != "s3cret" {
+		t.Errorf("Resolve() = %q, %v; want s3cret", got, err)
+	}
+	if _, err := vault.GetSecret(context.Background(), "ipgeo/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	denied := NewVault(VaultConfig{Addr: server.URL, Token: "wrong", Namespace: "team", Mount: "kv"})
+	if _, err := denied.GetSecret(context.Background(), "ipgeo/db"); err == nil {
+		t.Error("Expected a permission error")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadFile(path); err != nil || got != "s3cret" {
+		t.Errorf("ReadFile() = %q, %v; want s3cret", got, err)
+	}
+	if _, err := ReadFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultVaultMount is the mount path of Vault's default KV version 2 engine
+const DefaultVaultMount = "secret"
+
+// VaultConfig configures a Vault provider
+type VaultConfig struct {
+	Addr      string            // Vault server, e.g. https://vault.internal:8200
+	Token     string            // Token with read access to the secrets
+	Namespace string            // Enterprise namespace ("" for none)
+	Mount     string            // KV version 2 mount path (default "secret")
+	Transport http.RoundTripper // nil uses http.DefaultTransport
+}
+
+// Vault reads secrets from a HashiCorp Vault KV version 2 engine. A secret's value is
+// its data as a JSON object, so references pick a key with "name#key".
+type Vault struct {
+	cfg    VaultConfig
+	client *http.Client
+}
+
+// NewVault creates a Vault provider
+func NewVault(cfg VaultConfig) *Vault {
+	if cfg.Mount == "" {
+		cfg.Mount = DefaultVaultMount
+	}
+	cfg.Addr = strings.TrimSuffix(cfg.Addr, "/")
+	return &Vault{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second, Transport: cfg.Transport}}
+}
+
+// GetSecret reads the latest version of the secret at name
+func (v *Vault) GetSecret(ctx context.Context, name string) (string, error) {
+	target := v.cfg.Addr + "/v1/" + strings.Trim(v.cfg.Mount, "/") + "/data/" + escapePath(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.cfg.Token)
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("%w (status 404)", ErrNotFound)
+	default:
+		// Vault error bodies never echo secret values
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("vault status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var parsed struct {
+		Data struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&parsed); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+	if len(parsed.Data.Data) == 0 || string(parsed.Data.Data) == "null" {
+		return "", fmt.Errorf("%w (deleted version)", ErrNotFound)
+	}
+	return string(parsed.Data.Data), nil
+}
+
+// escapePath escapes each segment of a slash-separated secret path
+func escapePath(name string) string {
+	segments := strings.Split(strings.Trim(name, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
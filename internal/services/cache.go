@@ -0,0 +1,231 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"ip-geolocation-service/internal/models"
+)
+
+// CacheStats holds lookup cache counters
+type CacheStats struct {
+	Size      int    `json:"size"`
+	Capacity  int    `json:"capacity"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	StaleHits uint64 `json:"stale_hits"` // Hits served past the soft TTL while being refreshed
+}
+
+// cacheEntry is a single cached lookup result
+type cacheEntry struct {
+	key        string
+	location   *models.Location
+	expiresAt  time.Time // Soft TTL: past it the entry is stale
+	staleUntil time.Time // Hard TTL: past it the entry is dropped
+	prefetched bool      // Inserted by the prefetcher and not yet read
+	refreshing bool      // A background refresh has been handed out
+}
+
+// LocationCache is a bounded LRU cache of lookup results keyed by normalized IP.
+// With a hard TTL longer than the TTL, expired entries are still served until the
+// hard TTL while one caller refreshes them in the background (stale-while-revalidate).
+type LocationCache struct {
+	capacity int
+	ttl      time.Duration
+	stale    time.Duration // How long past ttl an entry may be served stale
+	entries  map[string]*list.Element
+	order    *list.List
+	mu       sync.Mutex
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	staleHits uint64
+
+	// onPrefetchHit and onPrefetchWasted report prefetch effectiveness
+	onPrefetchHit    func()
+	onPrefetchWasted func()
+}
+
+// NewLocationCache creates a new LRU cache; a zero ttl disables expiry
+func NewLocationCache(capacity int, ttl time.Duration) *LocationCache {
+	return NewLocationCacheWithHardTTL(capacity, ttl, 0)
+}
+
+// NewLocationCacheWithHardTTL creates an LRU cache whose entries go stale after ttl
+// and are dropped after hardTTL. A hardTTL not above ttl disables stale serving.
+func NewLocationCacheWithHardTTL(capacity int, ttl, hardTTL time.Duration) *LocationCache {
+	var stale time.Duration
+	if ttl > 0 && hardTTL > ttl {
+		stale = hardTTL - ttl
+	}
+	return &LocationCache{
+		capacity: capacity,
+		ttl:      ttl,
+		stale:    stale,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the cached location for key, if present and not expired. Stale
+// entries are returned without claiming their refresh.
+func (c *LocationCache) Get(key string) (*models.Location, bool) {
+	location, _, ok := c.get(key, false)
+	return location, ok
+}
+
+// GetStale is Get for callers able to refresh entries: refresh is true when the
+// entry is stale and no other caller has been asked to refresh it yet. The caller
+// must then Set the new result, or call RefreshFailed.
+func (c *LocationCache) GetStale(key string) (location *models.Location, refresh bool, ok bool) {
+	return c.get(key, true)
+}
+
+func (c *LocationCache) get(key string, claim bool) (*models.Location, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[key]
+	if !exists {
+		c.misses++
+		return nil, false, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	refresh := false
+	if c.ttl > 0 {
+		now := time.Now()
+		if now.After(entry.staleUntil) {
+			c.removeElement(elem)
+			c.misses++
+			return nil, false, false
+		}
+		if now.After(entry.expiresAt) {
+			c.staleHits++
+			if claim && !entry.refreshing {
+				entry.refreshing, refresh = true, true
+			}
+		}
+	}
+
+	if entry.prefetched {
+		entry.prefetched = false
+		if c.onPrefetchHit != nil {
+			c.onPrefetchHit()
+		}
+	}
+
+	c.order.MoveToFront(elem)
+	c.hits++
+	return entry.location, refresh, true
+}
+
+// RefreshFailed releases the refresh of key claimed through GetStale, so a later
+// caller retries it; the stale entry is kept until its hard TTL
+func (c *LocationCache) RefreshFailed(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		elem.Value.(*cacheEntry).refreshing = false
+	}
+}
+
+// Set stores a lookup result
+func (c *LocationCache) Set(key string, location *models.Location) {
+	c.set(key, location, false)
+}
+
+// setPrefetched stores a result warmed by the prefetcher; existing entries are left alone
+func (c *LocationCache) setPrefetched(key string, location *models.Location) bool {
+	return c.set(key, location, true)
+}
+
+func (c *LocationCache) set(key string, location *models.Location, prefetched bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		if prefetched {
+			return false
+		}
+		entry := elem.Value.(*cacheEntry)
+		entry.location = location
+		entry.expiresAt, entry.staleUntil = c.expiry()
+		entry.refreshing = false
+		c.order.MoveToFront(elem)
+		return true
+	}
+
+	entry := &cacheEntry{
+		key:        key,
+		location:   location,
+		prefetched: prefetched,
+	}
+	entry.expiresAt, entry.staleUntil = c.expiry()
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+		c.evictions++
+	}
+
+	return true
+}
+
+// Delete drops the cached result for key, if any
+func (c *LocationCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		c.removeElement(elem)
+	}
+}
+
+// Purge drops every cached result
+func (c *LocationCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.order.Len() > 0 {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *LocationCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Size:      c.order.Len(),
+		Capacity:  c.capacity,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		StaleHits: c.staleHits,
+	}
+}
+
+// removeElement drops an element; caller must hold the lock
+func (c *LocationCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	if entry.prefetched && c.onPrefetchWasted != nil {
+		c.onPrefetchWasted()
+	}
+	c.order.Remove(elem)
+	delete(c.entries, entry.key)
+}
+
+// expiry returns the soft and hard expiry of an entry stored now
+func (c *LocationCache) expiry() (time.Time, time.Time) {
+	if c.ttl <= 0 {
+		return time.Time{}, time.Time{}
+	}
+	soft := time.Now().Add(c.ttl)
+	return soft, soft.Add(c.stale)
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/models"
+)
+
+func TestLocationCache_GetSet(t *testing.T) {
+	cache := NewLocationCache(2, 0)
+	location := &models.Location{Country: "United States", City: "Mountain View"}
+
+	if _, ok := cache.Get("8.8.8.8"); ok {
+		t.Error("Expected miss on empty cache")
+	}
+
+	cache.Set("8.8.8.8", location)
+	got, ok := cache.Get("8.8.8.8")
+	if !ok {
+		t.Fatal("Expected hit after Set")
+	}
+	if got != location {
+		t.Errorf("Expected cached location %v, got %v", location, got)
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %+v", stats)
+	}
+}
+
+func TestLocationCache_Eviction(t *testing.T) {
+	cache := NewLocationCache(2, 0)
+	location := &models.Location{Country: "United States", City: "Mountain View"}
+
+	cache.Set("1.1.1.1", location)
+	cache.Set("1.1.1.2", location)
+
+	// Touch the oldest entry so 1.1.1.2 becomes least recently used
+	cache.Get("1.1.1.1")
+	cache.Set("1.1.1.3", location)
+
+	if _, ok := cache.Get("1.1.1.2"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if _, ok := cache.Get("1.1.1.1"); !ok {
+		t.Error("Expected recently used entry to survive eviction")
+	}
+
+	stats := cache.Stats()
+	if stats.Size != 2 || stats.Evictions != 1 {
+		t.Errorf("Expected size 2 and 1 eviction, got %+v", stats)
+	}
+}
+
+func TestLocationCache_TTL(t *testing.T) {
+	cache := NewLocationCache(10, 10*time.Millisecond)
+	cache.Set("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := cache.Get("8.8.8.8"); ok {
+		t.Error("Expected expired entry to miss")
+	}
+	if cache.Stats().Size != 0 {
+		t.Error("Expected expired entry to be removed")
+	}
+}
+
+func TestLocationCache_StaleWhileRevalidate(t *testing.T) {
+	cache := NewLocationCacheWithHardTTL(10, 10*time.Millisecond, time.Hour)
+	location := &models.Location{Country: "United States", City: "Mountain View"}
+	cache.Set("8.8.8.8", location)
+
+	if _, refresh, ok := cache.GetStale("8.8.8.8"); !ok || refresh {
+		t.Fatalf("Expected a fresh hit without refresh, got ok=%v refresh=%v", ok, refresh)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	// Only the first caller past the TTL is asked to refresh
+	got, refresh, ok := cache.GetStale("8.8.8.8")
+	if !ok || got != location || !refresh {
+		t.Fatalf("Expected a stale hit claiming the refresh, got ok=%v refresh=%v", ok, refresh)
+	}
+	if _, refresh, ok := cache.GetStale("8.8.8.8"); !ok || refresh {
+		t.Errorf("Expected a stale hit without refresh, got ok=%v refresh=%v", ok, refresh)
+	}
+	if _, ok := cache.Get("8.8.8.8"); !ok {
+		t.Error("Expected Get to serve the stale entry")
+	}
+
+	// A failed refresh is handed out again
+	cache.RefreshFailed("8.8.8.8")
+	if _, refresh, _ := cache.GetStale("8.8.8.8"); !refresh {
+		t.Error("Expected the refresh to be claimable after a failure")
+	}
+
+	// A successful refresh makes the entry fresh again
+	cache.Set("8.8.8.8", location)
+	if _, refresh, _ := cache.GetStale("8.8.8.8"); refresh {
+		t.Error("Expected no refresh after Set")
+	}
+
+	if stats := cache.Stats(); stats.StaleHits != 4 || stats.Hits != 6 {
+		t.Errorf("Expected 4 stale hits of 6, got %+v", stats)
+	}
+}
+
+func TestLocationCache_HardTTL(t *testing.T) {
+	cache := NewLocationCacheWithHardTTL(10, 10*time.Millisecond, 20*time.Millisecond)
+	cache.Set("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+
+	time.Sleep(30 * time.Millisecond)
+
+	if _, _, ok := cache.GetStale("8.8.8.8"); ok {
+		t.Error("Expected entry past its hard TTL to miss")
+	}
+	if cache.Stats().Size != 0 {
+		t.Error("Expected entry past its hard TTL to be removed")
+	}
+}
+
+func TestLocationCache_PrefetchAccounting(t *testing.T) {
+	cache := NewLocationCache(1, 0)
+	location := &models.Location{Country: "United States", City: "Mountain View"}
+
+	var hits, wasted int
+	cache.onPrefetchHit = func() { hits++ }
+	cache.onPrefetchWasted = func() { wasted++ }
+
+	cache.setPrefetched("1.1.1.1", location)
+	cache.Get("1.1.1.1")
+	cache.Get("1.1.1.1")
+
+	cache.setPrefetched("1.1.1.2", location)
+	cache.setPrefetched("1.1.1.3", location)
+
+	if hits != 1 {
+		t.Errorf("Expected 1 prefetch hit, got %d", hits)
+	}
+	if wasted != 1 {
+		t.Errorf("Expected 1 wasted prefetch, got %d", wasted)
+	}
+
+	// A prefetch must not overwrite an entry that is already cached
+	if cache.setPrefetched("1.1.1.3", location) {
+		t.Error("Expected setPrefetched to skip existing entries")
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"ip-geolocation-service/internal/models"
+)
+
+// errLookupPanicked is returned to every caller of a shared lookup that panicked
+var errLookupPanicked = errors.New("lookup panicked")
+
+// lookupCall is an in-flight repository lookup shared by concurrent callers
+type lookupCall struct {
+	done     chan struct{} // Closed once location and err are set
+	location *models.Location
+	err      error
+}
+
+// lookupGroup coalesces concurrent lookups for the same key into a single repository call
+type lookupGroup struct {
+	mu    sync.Mutex
+	calls map[string]*lookupCall
+}
+
+// newLookupGroup creates an empty lookup group
+func newLookupGroup() *lookupGroup {
+	return &lookupGroup{
+		calls: make(map[string]*lookupCall),
+	}
+}
+
+// Do runs fn once per key among concurrent callers; shared reports whether the
+// result came from another caller's in-flight call. fn runs on its own goroutine and
+// outlives the callers, so it must bound itself rather than rely on ctx; each caller
+// waits only until its own ctx is done.
+func (g *lookupGroup) Do(ctx context.Context, key string, fn func() (*models.Location, error)) (location *models.Location, err error, shared bool) {
+	g.mu.Lock()
+	call, shared := g.calls[key]
+	if !shared {
+		call = &lookupCall{done: make(chan struct{})}
+		g.calls[key] = call
+		go g.run(key, call, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.location, call.err, shared
+	case <-ctx.Done():
+		return nil, ctx.Err(), shared
+	}
+}
+
+// run calls fn for key and hands the result to its waiting callers. A panic in fn is
+// recorded as the call's error instead of leaving callers with no location and no error.
+func (g *lookupGroup) run(key string, call *lookupCall, fn func() (*models.Location, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			call.location, call.err = nil, fmt.Errorf("%w: %v", errLookupPanicked, r)
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.location, call.err = fn()
+}
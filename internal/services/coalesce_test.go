@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/models"
+)
+
+// A caller that gives up doesn't fail the others waiting on the same lookup
+func TestIPService_CoalescedLookupOutlivesCaller(t *testing.T) {
+	repo := &blockingRepository{MockRepository: NewMockRepository(), release: make(chan struct{})}
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	service := NewIPServiceWithOptions(repo, ServiceOptions{})
+	addr := netip.MustParseAddr("8.8.8.8")
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := service.FindLocation(leaderCtx, addr)
+		leaderErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	var followerLocation *models.Location
+	var followerErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		followerLocation, followerErr = service.FindLocation(context.Background(), addr)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancelLeader()
+	select {
+	case err := <-leaderErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Canceled caller error = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Canceled caller kept waiting on the shared lookup")
+	}
+
+	close(repo.release)
+	wg.Wait()
+	if followerErr != nil || followerLocation.City != "Mountain View" {
+		t.Errorf("Follower = %v, %v, want Mountain View", followerLocation, followerErr)
+	}
+	if repo.calls != 1 {
+		t.Errorf("Expected 1 repository call, got %d", repo.calls)
+	}
+}
+
+func TestLookupGroup_Panic(t *testing.T) {
+	group := newLookupGroup()
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			location, err, _ := group.Do(context.Background(), "key", func() (*models.Location, error) {
+				<-release
+				panic("boom")
+			})
+			if location != nil {
+				t.Errorf("Expected no location, got %v", location)
+			}
+			errs[i] = err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, err := range errs {
+		if !errors.Is(err, errLookupPanicked) {
+			t.Errorf("Caller %d error = %v, want errLookupPanicked", i, err)
+		}
+	}
+
+	// The key is free again for the next lookup
+	location, err, shared := group.Do(context.Background(), "key", func() (*models.Location, error) {
+		return &models.Location{Country: "US"}, nil
+	})
+	if err != nil || shared || location.Country != "US" {
+		t.Errorf("Do() after a panic = %v, %v, %v", location, err, shared)
+	}
+}
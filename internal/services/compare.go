@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+
+	"ip-geolocation-service/internal/models"
+)
+
+// ErrComparisonUnsupported is returned when a dataset can't be sampled for comparison
+var ErrComparisonUnsupported = errors.New("dataset does not support comparison")
+
+// Comparison sample bounds
+const (
+	DefaultComparisonSample = 1000
+	MaxComparisonSample     = 100000
+)
+
+// maxComparisonExamples bounds the differing addresses listed in a report
+const maxComparisonExamples = 20
+
+// DatasetSampler is implemented by services whose data can be sampled and looked up
+// without going through the cache
+type DatasetSampler interface {
+	SampleIPs(n int) []string
+	LookupUncached(ctx context.Context, addr netip.Addr) (*models.Location, error)
+}
+
+// DatasetDifference is one address that resolves differently in two datasets
+type DatasetDifference struct {
+	IP string           `json:"ip"`
+	A  *models.Location `json:"a"`
+	B  *models.Location `json:"b"`
+}
+
+// DatasetComparison reports how a sample of addresses resolves in two datasets
+type DatasetComparison struct {
+	A                string              `json:"a"`
+	AVersion         string              `json:"a_version,omitempty"`
+	B                string              `json:"b"`
+	BVersion         string              `json:"b_version,omitempty"`
+	Sampled          int                 `json:"sampled"`
+	Same             int                 `json:"same"`
+	Different        int                 `json:"different"`
+	CountryChanged   int                 `json:"country_changed"`
+	CityChanged      int                 `json:"city_changed"`
+	OnlyInA          int                 `json:"only_in_a"`
+	OnlyInB          int                 `json:"only_in_b"`
+	DifferentPercent float64             `json:"different_percent"`
+	Examples         []DatasetDifference `json:"examples,omitempty"`
+}
+
+// Compare samples up to sample addresses, half from each dataset, and reports how
+// many resolve differently between datasets a and b. Lookups bypass caches.
+func (d *DatasetService) Compare(ctx context.Context, a, b string, sample int) (DatasetComparison, error) {
+	if sample <= 0 {
+		sample = DefaultComparisonSample
+	}
+	sample = min(sample, MaxComparisonSample)
+
+	infoA, samplerA, err := d.sampler(a)
+	if err != nil {
+		return DatasetComparison{}, err
+	}
+	infoB, samplerB, err := d.sampler(b)
+	if err != nil {
+		return DatasetComparison{}, err
+	}
+
+	// Draw from both sides so addresses added or dropped by either dataset show up
+	fromA := samplerA.SampleIPs((sample + 1) / 2)
+	fromB := samplerB.SampleIPs(sample - len(fromA))
+	seen := make(map[string]struct{}, len(fromA)+len(fromB))
+	ips := make([]string, 0, len(fromA)+len(fromB))
+	for _, ip := range append(fromA, fromB...) {
+		if _, dup := seen[ip]; !dup {
+			seen[ip] = struct{}{}
+			ips = append(ips, ip)
+		}
+	}
+	sort.Strings(ips)
+
+	report := DatasetComparison{A: a, AVersion: infoA.Version, B: b, BVersion: infoB.Version, Sampled: len(ips)}
+	for _, ip := range ips {
+		if err := ctx.Err(); err != nil {
+			return DatasetComparison{}, fmt.Errorf("comparison aborted: %w", err)
+		}
+
+		addr, err := models.ParseIP(ip)
+		if err != nil {
+			continue
+		}
+		locA, errA := samplerA.LookupUncached(ctx, addr)
+		locB, errB := samplerB.LookupUncached(ctx, addr)
+		switch {
+		case errA != nil && errB != nil:
+			report.Same++
+			continue
+		case errB != nil:
+			report.OnlyInA++
+			locB = nil
+		case errA != nil:
+			report.OnlyInB++
+			locA = nil
+		case locA.Country == locB.Country && locA.City == locB.City:
+			report.Same++
+			continue
+		case locA.Country != locB.Country:
+			report.CountryChanged++
+		default:
+			report.CityChanged++
+		}
+
+		report.Different++
+		if len(report.Examples) < maxComparisonExamples {
+			report.Examples = append(report.Examples, DatasetDifference{IP: ip, A: locA, B: locB})
+		}
+	}
+
+	if report.Sampled > 0 {
+		report.DifferentPercent = float64(report.Different) * 100 / float64(report.Sampled)
+	}
+	return report, nil
+}
+
+// sampler returns the info and sampler of a loaded dataset
+func (d *DatasetService) sampler(name string) (DatasetInfo, DatasetSampler, error) {
+	d.mu.RLock()
+	ds, exists := d.datasets[name]
+	d.mu.RUnlock()
+
+	if !exists {
+		return DatasetInfo{}, nil, fmt.Errorf("%w: %s", ErrUnknownDataset, name)
+	}
+	sampler, ok := ds.service.(DatasetSampler)
+	if !ok {
+		return DatasetInfo{}, nil, fmt.Errorf("%w: %s", ErrComparisonUnsupported, name)
+	}
+	return ds.info, sampler, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"ip-geolocation-service/internal/models"
+)
+
+func TestDatasetService_Compare(t *testing.T) {
+	current := NewMockRepository()
+	current.SetLocation("1.1.1.1", &models.Location{Country: "Australia", City: "Sydney"})
+	current.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	current.SetLocation("9.9.9.9", &models.Location{Country: "Switzerland", City: "Zurich"})
+	current.SetLocation("4.4.4.4", &models.Location{Country: "United States", City: "Denver"})
+
+	next := NewMockRepository()
+	next.SetLocation("1.1.1.1", &models.Location{Country: "Australia", City: "Sydney"})
+	next.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "San Jose"})
+	next.SetLocation("9.9.9.9", &models.Location{Country: "Germany", City: "Frankfurt"})
+	next.SetLocation("5.5.5.5", &models.Location{Country: "Germany", City: "Berlin"})
+
+	datasets := NewDatasetService("v1", nil)
+	datasets.Add("v1", "v1.csv", NewIPService(current), nil)
+	datasets.Add("v2", "v2.csv", NewIPService(next), nil)
+
+	report, err := datasets.Compare(context.Background(), "v1", "v2", 100)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+
+	want := DatasetComparison{A: "v1", B: "v2", Sampled: 5, Same: 1, Different: 4, CountryChanged: 1, CityChanged: 1, OnlyInA: 1, OnlyInB: 1, DifferentPercent: 80}
+	report.Examples = nil
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("Compare() = %+v, want %+v", report, want)
+	}
+
+	if _, err := datasets.Compare(context.Background(), "v1", "missing", 10); !errors.Is(err, ErrUnknownDataset) {
+		t.Errorf("Compare() with unknown dataset error = %v, want ErrUnknownDataset", err)
+	}
+
+	// Services that can't enumerate their data can't be compared
+	datasets.Add("opaque", "opaque", NewDatasetService("", nil), nil)
+	if _, err := datasets.Compare(context.Background(), "v1", "opaque", 10); !errors.Is(err, ErrComparisonUnsupported) {
+		t.Errorf("Compare() with unsampled dataset error = %v, want ErrComparisonUnsupported", err)
+	}
+}
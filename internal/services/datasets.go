@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+// ErrUnknownDataset is returned when a request selects a dataset that isn't loaded
+var ErrUnknownDataset = errors.New("unknown dataset")
+
+// ErrDatasetLoading is returned for a dataset whose first load is still being retried
+var ErrDatasetLoading = errors.New("dataset is still loading")
+
+// Load retry backoff bounds
+const (
+	loadRetryInitialInterval = time.Second
+	DefaultLoadRetryInterval = 30 * time.Second
+)
+
+// datasetKey carries the selected dataset name through the request context
+var datasetKey = requestcontext.NewKey[string]("dataset")
+
+// WithDataset returns a context that selects the named dataset for lookups
+func WithDataset(ctx context.Context, name string) context.Context {
+	return datasetKey.With(ctx, name)
+}
+
+// DatasetFromContext returns the dataset selected for the request, or "" for the default
+func DatasetFromContext(ctx context.Context) string {
+	name, _ := datasetKey.Value(ctx)
+	return name
+}
+
+// DatasetLoader loads the named dataset from source, returning its service and a
+// function that releases the underlying repository
+type DatasetLoader func(ctx context.Context, name, source string) (IPService, func() error, error)
+
+// DatasetVersioner is implemented by services that can identify the data they serve
+type DatasetVersioner interface {
+	DatasetVersion() string
+}
+
+// DatasetModTimer is implemented by services that know when the data they serve was
+// last modified
+type DatasetModTimer interface {
+	DatasetModTime() time.Time
+}
+
+// DatasetInfo describes a loaded dataset
+type DatasetInfo struct {
+	Name       string    `json:"name"`
+	Source     string    `json:"source"`
+	Version    string    `json:"version,omitempty"`
+	Default    bool      `json:"default"`
+	LoadedAt   time.Time `json:"loaded_at"`
+	ModifiedAt time.Time `json:"modified_at,omitzero"` // When the data was last modified, if known
+	Stale      bool      `json:"stale,omitempty"`      // Modified longer ago than the maximum dataset age
+}
+
+// dataset is a named dataset served by its own service, cache and prefetcher
+type dataset struct {
+	info    DatasetInfo
+	service IPService
+	close   func() error
+}
+
+// DatasetService serves several named datasets side by side, routing each lookup to
+// the dataset selected in its context. Each dataset keeps its own cache so results
+// from different datasets never mix.
+type DatasetService struct {
+	mu          sync.RWMutex
+	datasets    map[string]*dataset
+	defaultName string
+	loader      DatasetLoader
+	pending     map[string]bool // Datasets whose first load is being retried
+
+	// Freshness, see SetMaxAge
+	maxAge        time.Duration
+	rejectStale   bool
+	staleRejected atomic.Uint64
+	ages          *metrics.GaugeVec
+}
+
+// NewDatasetService creates an empty dataset service; loader may be nil if datasets are only added directly
+func NewDatasetService(defaultName string, loader DatasetLoader) *DatasetService {
+	return &DatasetService{
+		datasets:    make(map[string]*dataset),
+		defaultName: defaultName,
+		loader:      loader,
+		pending:     make(map[string]bool),
+	}
+}
+
+// Add registers an already loaded dataset, replacing (and closing) any dataset with the same name
+func (d *DatasetService) Add(name, source string, service IPService, closeFn func() error) {
+	info := DatasetInfo{Name: name, Source: source, LoadedAt: time.Now()}
+	if versioner, ok := service.(DatasetVersioner); ok {
+		info.Version = versioner.DatasetVersion()
+	}
+	if modTimer, ok := service.(DatasetModTimer); ok {
+		info.ModifiedAt = modTimer.DatasetModTime()
+	}
+
+	d.mu.Lock()
+	previous := d.datasets[name]
+	d.datasets[name] = &dataset{
+		info:    info,
+		service: service,
+		close:   closeFn,
+	}
+	delete(d.pending, name)
+	d.mu.Unlock()
+
+	if previous != nil && previous.close != nil {
+		previous.close()
+	}
+}
+
+// Load loads a dataset through the loader and registers it. Reloading an existing name
+// swaps it in only after the new data loaded successfully.
+func (d *DatasetService) Load(ctx context.Context, name, source string) error {
+	if name == "" {
+		return fmt.Errorf("dataset name cannot be empty")
+	}
+	if d.loader == nil {
+		return fmt.Errorf("dataset loading is not supported")
+	}
+
+	service, closeFn, err := d.loader(ctx, name, source)
+	if err != nil {
+		return fmt.Errorf("failed to load dataset %s: %w", name, err)
+	}
+
+	d.Add(name, source, service, closeFn)
+	return nil
+}
+
+// MarkLoading marks a dataset that isn't loaded yet as loading, so lookups and health
+// checks report it as such until Add or Load succeeds
+func (d *DatasetService) MarkLoading(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, loaded := d.datasets[name]; !loaded {
+		d.pending[name] = true
+	}
+}
+
+// LoadWithRetry loads a dataset whose first load failed, for instance because its
+// volume isn't mounted yet. Until it loads, lookups in it fail with ErrDatasetLoading
+// and health checks report it loading. Attempts back off from one second up to
+// maxInterval, calling onError after each failure, until one succeeds or ctx ends.
+func (d *DatasetService) LoadWithRetry(ctx context.Context, name, source string, maxInterval time.Duration, onError func(err error, wait time.Duration)) error {
+	if maxInterval <= 0 {
+		maxInterval = DefaultLoadRetryInterval
+	}
+	d.MarkLoading(name)
+
+	wait := min(loadRetryInitialInterval, maxInterval)
+	for {
+		err := d.Load(ctx, name, source)
+		if err == nil {
+			return nil
+		}
+		if onError != nil {
+			onError(err, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		wait = min(wait*2, maxInterval)
+	}
+}
+
+// Remove unloads a dataset; the default dataset cannot be removed
+func (d *DatasetService) Remove(name string) error {
+	d.mu.Lock()
+	if name == d.defaultName {
+		d.mu.Unlock()
+		return fmt.Errorf("cannot remove the default dataset: %s", name)
+	}
+	ds, exists := d.datasets[name]
+	if !exists {
+		d.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownDataset, name)
+	}
+	delete(d.datasets, name)
+	d.mu.Unlock()
+
+	if ds.close != nil {
+		return ds.close()
+	}
+	return nil
+}
+
+// SetDefault makes a loaded dataset the default for requests that don't select one
+func (d *DatasetService) SetDefault(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.datasets[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownDataset, name)
+	}
+	d.defaultName = name
+	return nil
+}
+
+// Default returns the name of the default dataset
+func (d *DatasetService) Default() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.defaultName
+}
+
+// Has reports whether the named dataset is loaded
+func (d *DatasetService) Has(name string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, exists := d.datasets[name]
+	return exists
+}
+
+// Info returns the description of a loaded dataset
+func (d *DatasetService) Info(name string) (DatasetInfo, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	ds, exists := d.datasets[name]
+	if !exists {
+		return DatasetInfo{}, false
+	}
+	return d.describe(ds, time.Now()), true
+}
+
+// List returns the loaded datasets sorted by name
+func (d *DatasetService) List() []DatasetInfo {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	now := time.Now()
+	infos := make([]DatasetInfo, 0, len(d.datasets))
+	for _, ds := range d.datasets {
+		infos = append(infos, d.describe(ds, now))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Close releases every loaded dataset
+func (d *DatasetService) Close() error {
+	d.mu.Lock()
+	datasets := d.datasets
+	d.datasets = make(map[string]*dataset)
+	d.mu.Unlock()
+
+	var errs []error
+	for _, ds := range datasets {
+		if ds.close != nil {
+			if err := ds.close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// describe returns the info of a loaded dataset as of now; the caller holds d.mu
+func (d *DatasetService) describe(ds *dataset, now time.Time) DatasetInfo {
+	info := ds.info
+	info.Default = info.Name == d.defaultName
+	info.Stale = d.stale(info, now)
+	return info
+}
+
+// resolve returns the info and service of the dataset selected in ctx
+func (d *DatasetService) resolve(ctx context.Context) (DatasetInfo, IPService, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	name := DatasetFromContext(ctx)
+	if name == "" {
+		name = d.defaultName
+	}
+	ds, exists := d.datasets[name]
+	if !exists {
+		if d.pending[name] {
+			return DatasetInfo{}, nil, fmt.Errorf("%w: %s", ErrDatasetLoading, name)
+		}
+		return DatasetInfo{}, nil, fmt.Errorf("%w: %s", ErrUnknownDataset, name)
+	}
+	if d.rejectStale && d.stale(ds.info, time.Now()) {
+		d.staleRejected.Add(1)
+		return DatasetInfo{}, nil, fmt.Errorf("%w: %s was last modified %s", ErrDatasetStale, name, ds.info.ModifiedAt.Format(time.RFC3339))
+	}
+	return ds.info, ds.service, nil
+}
+
+// FindLocation looks up addr in the dataset selected by the request context
+func (d *DatasetService) FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	dataset, service, err := d.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if info := lookupInfoFromContext(ctx); info != nil {
+		info.Dataset = dataset.Name
+		info.DatasetVersion = dataset.Version
+	}
+	return service.FindLocation(ctx, addr)
+}
+
+// HealthCheck checks every loaded dataset; it fails with ErrDatasetLoading while a
+// dataset's first load is being retried
+func (d *DatasetService) HealthCheck(ctx context.Context) error {
+	d.mu.RLock()
+	services := make(map[string]IPService, len(d.datasets))
+	for name, ds := range d.datasets {
+		services[name] = ds.service
+	}
+	var pending []string
+	for name := range d.pending {
+		pending = append(pending, name)
+	}
+	d.mu.RUnlock()
+
+	if len(pending) > 0 {
+		sort.Strings(pending)
+		return fmt.Errorf("%w: %s", ErrDatasetLoading, strings.Join(pending, ", "))
+	}
+
+	if len(services) == 0 {
+		return fmt.Errorf("no datasets loaded")
+	}
+	for name, service := range services {
+		if err := service.HealthCheck(ctx); err != nil {
+			return fmt.Errorf("dataset %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// LookupStats returns the lookup counters of the default dataset
+func (d *DatasetService) LookupStats() LookupStats {
+	_, service, err := d.resolve(context.Background())
+	if err != nil {
+		return LookupStats{}
+	}
+	if provider, ok := service.(LookupStatsProvider); ok {
+		return provider.LookupStats()
+	}
+	return LookupStats{}
+}
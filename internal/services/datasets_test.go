@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/models"
+)
+
+func newDatasetRepository(country string) *MockRepository {
+	repo := NewMockRepository()
+	repo.SetLocation("8.8.8.8", &models.Location{Country: country, City: "Mountain View"})
+	return repo
+}
+
+func TestDatasetService_RoutesByContext(t *testing.T) {
+	datasets := NewDatasetService("commercial", nil)
+	datasets.Add("commercial", "commercial.csv", NewIPService(newDatasetRepository("United States")), nil)
+	datasets.Add("free", "free.csv", NewIPService(newDatasetRepository("Free Country")), nil)
+
+	location, err := datasets.FindLocation(context.Background(), netip.MustParseAddr("8.8.8.8"))
+	if err != nil || location.Country != "United States" {
+		t.Fatalf("Expected default dataset answer, got %v, %v", location, err)
+	}
+
+	location, err = datasets.FindLocation(WithDataset(context.Background(), "free"), netip.MustParseAddr("8.8.8.8"))
+	if err != nil || location.Country != "Free Country" {
+		t.Fatalf("Expected free dataset answer, got %v, %v", location, err)
+	}
+
+	_, err = datasets.FindLocation(WithDataset(context.Background(), "missing"), netip.MustParseAddr("8.8.8.8"))
+	if !errors.Is(err, ErrUnknownDataset) {
+		t.Errorf("Expected ErrUnknownDataset, got %v", err)
+	}
+}
+
+func TestDatasetService_LoadRemoveAndDefault(t *testing.T) {
+	closed := map[string]bool{}
+	loader := func(ctx context.Context, name, source string) (IPService, func() error, error) {
+		if source == "broken.csv" {
+			return nil, nil, errors.New("file not found")
+		}
+		return NewIPService(newDatasetRepository(source)), func() error {
+			closed[source] = true
+			return nil
+		}, nil
+	}
+
+	datasets := NewDatasetService("a", loader)
+	if err := datasets.Load(context.Background(), "a", "a-v1.csv"); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := datasets.Load(context.Background(), "b", "b.csv"); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// A failed reload keeps the existing data
+	if err := datasets.Load(context.Background(), "a", "broken.csv"); err == nil {
+		t.Error("Expected load of broken dataset to fail")
+	}
+	location, _ := datasets.FindLocation(context.Background(), netip.MustParseAddr("8.8.8.8"))
+	if location.Country != "a-v1.csv" {
+		t.Errorf("Expected original dataset after failed reload, got %s", location.Country)
+	}
+
+	// A successful reload swaps the data and closes the old repository
+	if err := datasets.Load(context.Background(), "a", "a-v2.csv"); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !closed["a-v1.csv"] {
+		t.Error("Expected replaced dataset to be closed")
+	}
+
+	if err := datasets.Remove("a"); err == nil {
+		t.Error("Expected removing the default dataset to fail")
+	}
+	if err := datasets.SetDefault("b"); err != nil {
+		t.Fatalf("SetDefault() error = %v", err)
+	}
+	if err := datasets.Remove("a"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if !closed["a-v2.csv"] {
+		t.Error("Expected removed dataset to be closed")
+	}
+
+	infos := datasets.List()
+	if len(infos) != 1 || infos[0].Name != "b" || !infos[0].Default {
+		t.Errorf("List() = %+v, want only default dataset b", infos)
+	}
+}
+
+func TestDatasetService_HealthCheck(t *testing.T) {
+	datasets := NewDatasetService("default", nil)
+	if err := datasets.HealthCheck(context.Background()); err == nil {
+		t.Error("Expected health check to fail with no datasets loaded")
+	}
+
+	unhealthy := NewMockRepository()
+	unhealthy.SetHealthError(errors.New("repository unhealthy"))
+	datasets.Add("default", "default.csv", NewIPService(NewMockRepository()), nil)
+	datasets.Add("free", "free.csv", NewIPService(unhealthy), nil)
+
+	if err := datasets.HealthCheck(context.Background()); err == nil {
+		t.Error("Expected health check to fail when any dataset is unhealthy")
+	}
+}
+
+func TestDatasetService_LoadWithRetry(t *testing.T) {
+	attempts := 0
+	loader := func(ctx context.Context, name, source string) (IPService, func() error, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, nil, errors.New("file not found")
+		}
+		return NewIPService(newDatasetRepository("United States")), nil, nil
+	}
+	datasets := NewDatasetService("default", loader)
+
+	// Until the first load succeeds the dataset reports loading
+	datasets.MarkLoading("default")
+	if err := datasets.HealthCheck(context.Background()); !errors.Is(err, ErrDatasetLoading) {
+		t.Errorf("Expected ErrDatasetLoading from health check, got %v", err)
+	}
+	if _, err := datasets.FindLocation(context.Background(), netip.MustParseAddr("8.8.8.8")); !errors.Is(err, ErrDatasetLoading) {
+		t.Errorf("Expected ErrDatasetLoading from lookup, got %v", err)
+	}
+
+	var failures int
+	err := datasets.LoadWithRetry(context.Background(), "default", "default.csv", time.Millisecond, func(err error, wait time.Duration) {
+		failures++
+	})
+	if err != nil || failures != 2 {
+		t.Fatalf("LoadWithRetry() = %v after %d failures, want success after 2", err, failures)
+	}
+	if err := datasets.HealthCheck(context.Background()); err != nil {
+		t.Errorf("Expected a healthy dataset once loaded, got %v", err)
+	}
+
+	// Retrying stops with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = -10
+	if err := datasets.LoadWithRetry(ctx, "free", "free.csv", time.Millisecond, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDatasetService_WarmUp(t *testing.T) {
+	repo := NewMockRepository()
+	repo.SetLocation("1.1.1.1", &models.Location{Country: "Australia", City: "Sydney"})
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	cache := NewLocationCache(10, 0)
+
+	datasets := NewDatasetService("default", nil)
+	datasets.Add("default", "default.csv", NewIPServiceWithOptions(repo, ServiceOptions{Cache: cache}), nil)
+	// Embedding hides the sampling methods, so this dataset is skipped
+	datasets.Add("other", "other.csv", struct{ IPService }{NewIPService(repo)}, nil)
+
+	result := datasets.WarmUp(context.Background(), 5)
+	if result.Datasets != 1 || result.Lookups != 5 || !result.Complete {
+		t.Errorf("WarmUp() = %+v, want 5 lookups in 1 dataset", result)
+	}
+	if stats := cache.Stats(); stats.Size != 0 || stats.Misses != 0 {
+		t.Errorf("Expected warm-up to leave the cache alone, got %+v", stats)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result := datasets.WarmUp(ctx, 5); result.Complete || result.Lookups != 0 {
+		t.Errorf("WarmUp() with an ended context = %+v, want an incomplete run", result)
+	}
+}
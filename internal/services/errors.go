@@ -0,0 +1,25 @@
+package services
+
+import (
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/repository"
+)
+
+// Errors returned by lookups. They arrive wrapped with detail, so callers classify
+// them with errors.Is rather than by message, which is meant for logs and may change.
+// Dataset selection adds ErrUnknownDataset, ErrDatasetLoading and ErrDatasetStale,
+// writes ErrReadOnly, and a lookup cut short by its deadline wraps
+// context.DeadlineExceeded.
+var (
+	// ErrNotFound means the dataset has no location for the address
+	ErrNotFound = repository.ErrNotFound
+	// ErrInvalidIP means the input isn't an IP address the service accepts
+	ErrInvalidIP = models.ErrInvalidIP
+	// ErrNonCanonicalIPv4 is an ErrInvalidIP for IPv4 octets with leading zeros or hex
+	ErrNonCanonicalIPv4 = models.ErrNonCanonicalIPv4
+	// ErrNonCanonicalIP is an ErrInvalidIP for an address not written canonically,
+	// returned in strict parse mode
+	ErrNonCanonicalIP = models.ErrNonCanonicalIP
+	// ErrInvalidLocation means the backend returned location data that fails validation
+	ErrInvalidLocation = models.ErrInvalidLocation
+)
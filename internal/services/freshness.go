@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// ErrDatasetStale is returned for lookups in a dataset modified longer ago than the
+// maximum dataset age, when stale datasets are rejected
+var ErrDatasetStale = errors.New("dataset is older than the maximum dataset age")
+
+// FreshnessCheckInterval is how often a running service checks dataset ages
+const FreshnessCheckInterval = time.Minute
+
+// SetMaxAge marks datasets whose data was last modified more than maxAge ago as
+// stale; 0 disables the check. With reject, lookups in a stale dataset fail with
+// ErrDatasetStale until fresher data is loaded. Datasets that don't know when their
+// data was modified, such as the embedded demo dataset, never go stale.
+func (d *DatasetService) SetMaxAge(maxAge time.Duration, reject bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.maxAge = maxAge
+	d.rejectStale = reject
+}
+
+// stale reports whether info's data is older than the maximum age; the caller holds d.mu
+func (d *DatasetService) stale(info DatasetInfo, now time.Time) bool {
+	return d.maxAge > 0 && !info.ModifiedAt.IsZero() && now.Sub(info.ModifiedAt) > d.maxAge
+}
+
+// Stale returns the loaded datasets older than the maximum age, sorted by name
+func (d *DatasetService) Stale() []DatasetInfo {
+	var stale []DatasetInfo
+	for _, info := range d.List() {
+		if info.Stale {
+			stale = append(stale, info)
+		}
+	}
+	return stale
+}
+
+// WatchFreshness checks the age of every dataset now and then every interval until
+// ctx is done, calling onChange with a dataset's info when it goes stale or is fresh
+// again after a reload
+func (d *DatasetService) WatchFreshness(ctx context.Context, interval time.Duration, onChange func(DatasetInfo)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	stale := make(map[string]bool)
+	for {
+		now := time.Now()
+		for _, info := range d.List() {
+			if info.ModifiedAt.IsZero() {
+				continue
+			}
+			if d.ages != nil {
+				d.ages.Set(now.Sub(info.ModifiedAt).Seconds(), info.Name)
+			}
+			if info.Stale != stale[info.Name] {
+				stale[info.Name] = info.Stale
+				if onChange != nil {
+					onChange(info)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RegisterFreshnessMetrics exposes dataset ages, updated by WatchFreshness, and
+// staleness on the registry
+func (d *DatasetService) RegisterFreshnessMetrics(registry *metrics.Registry) {
+	d.ages = registry.NewGaugeVec("ipgeo_dataset_age_seconds", "Time since each dataset's data was last modified", []string{"dataset"})
+	registry.NewGaugeFunc("ipgeo_datasets_stale", "Datasets older than the maximum dataset age", func() float64 {
+		return float64(len(d.Stale()))
+	})
+	registry.NewCounterFunc("ipgeo_dataset_stale_rejections_total", "Lookups rejected because their dataset was stale", func() float64 {
+		return float64(d.staleRejected.Load())
+	})
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// datedService is a service whose data was last modified at a fixed time
+type datedService struct {
+	IPService
+	modified time.Time
+}
+
+func (s datedService) DatasetModTime() time.Time { return s.modified }
+
+func newDatedDatasets(age time.Duration) *DatasetService {
+	datasets := NewDatasetService("commercial", nil)
+	datasets.Add("commercial", "commercial.csv", datedService{NewIPService(newDatasetRepository("United States")), time.Now().Add(-age)}, nil)
+	// The demo dataset doesn't know its age
+	datasets.Add("demo", "embedded", NewIPService(newDatasetRepository("Demo")), nil)
+	return datasets
+}
+
+func TestDatasetService_MaxAge(t *testing.T) {
+	addr := netip.MustParseAddr("8.8.8.8")
+	datasets := newDatedDatasets(48 * time.Hour)
+
+	// Without a maximum age nothing is stale
+	if stale := datasets.Stale(); len(stale) != 0 {
+		t.Fatalf("Stale() = %v without a maximum age", stale)
+	}
+
+	datasets.SetMaxAge(24*time.Hour, false)
+	stale := datasets.Stale()
+	if len(stale) != 1 || stale[0].Name != "commercial" {
+		t.Fatalf("Stale() = %+v, want commercial only", stale)
+	}
+	if info, _ := datasets.Info("demo"); info.Stale || !info.ModifiedAt.IsZero() {
+		t.Errorf("Info(demo) = %+v, want a dataset of unknown age that never goes stale", info)
+	}
+	if _, err := datasets.FindLocation(context.Background(), addr); err != nil {
+		t.Errorf("Expected stale data to be served under the warn policy, got %v", err)
+	}
+
+	// Rejected under the reject policy, while other datasets keep serving
+	datasets.SetMaxAge(24*time.Hour, true)
+	if _, err := datasets.FindLocation(context.Background(), addr); !errors.Is(err, ErrDatasetStale) {
+		t.Errorf("Expected ErrDatasetStale, got %v", err)
+	}
+	if _, err := datasets.FindLocation(WithDataset(context.Background(), "demo"), addr); err != nil {
+		t.Errorf("Expected the demo dataset to keep serving, got %v", err)
+	}
+
+	// Fresh data is served again
+	datasets.Add("commercial", "commercial.csv", datedService{NewIPService(newDatasetRepository("United States")), time.Now()}, nil)
+	if _, err := datasets.FindLocation(context.Background(), addr); err != nil {
+		t.Errorf("Expected reloaded data to be served, got %v", err)
+	}
+}
+
+func TestDatasetService_WatchFreshness(t *testing.T) {
+	datasets := newDatedDatasets(48 * time.Hour)
+	datasets.SetMaxAge(24*time.Hour, true)
+	registry := metrics.NewRegistry()
+	datasets.RegisterFreshnessMetrics(registry)
+	datasets.FindLocation(context.Background(), netip.MustParseAddr("8.8.8.8"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan DatasetInfo, 4)
+	go datasets.WatchFreshness(ctx, time.Millisecond, func(info DatasetInfo) { changes <- info })
+
+	// Reported stale at once
+	select {
+	case info := <-changes:
+		if info.Name != "commercial" || !info.Stale {
+			t.Errorf("onChange got %+v, want commercial stale", info)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the stale dataset to be reported")
+	}
+
+	var buf bytes.Buffer
+	registry.Write(&buf)
+	for _, want := range []string{`ipgeo_dataset_age_seconds{dataset="commercial"} 172800`, "ipgeo_datasets_stale 1", "ipgeo_dataset_stale_rejections_total 1"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	// And fresh again after a reload
+	datasets.Add("commercial", "commercial.csv", datedService{NewIPService(newDatasetRepository("United States")), time.Now()}, nil)
+	select {
+	case info := <-changes:
+		if info.Name != "commercial" || info.Stale {
+			t.Errorf("onChange got %+v, want commercial fresh", info)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the reloaded dataset to be reported fresh")
+	}
+}
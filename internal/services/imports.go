@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"ip-geolocation-service/internal/repository"
+)
+
+// DatasetImport reports a dataset file checked by Import and whether it replaced the
+// dataset's data
+type DatasetImport struct {
+	Dataset        string `json:"dataset"`
+	DryRun         bool   `json:"dry_run"`
+	Applied        bool   `json:"applied"`
+	CurrentRecords int    `json:"current_records"`
+	RecordDelta    int    `json:"record_delta"` // Records in the file minus CurrentRecords
+	*repository.ImportReport
+}
+
+// Import validates a CSV dataset read from body and, unless dryRun is set or the
+// file is invalid, replaces the named dataset's data with it and persists it. The
+// report is returned in every case; an invalid file is not an error.
+func (d *DatasetService) Import(ctx context.Context, name string, body io.Reader, dryRun bool) (*DatasetImport, error) {
+	d.mu.RLock()
+	ds, exists := d.datasets[name]
+	d.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDataset, name)
+	}
+	writer, writable := ds.service.(LocationWriter)
+	writable = writable && writer.Writable()
+	if !dryRun && !writable {
+		return nil, fmt.Errorf("%w: %s", ErrReadOnly, name)
+	}
+
+	report, records, err := repository.ValidateDataset(ctx, body, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := &DatasetImport{Dataset: name, DryRun: dryRun, ImportReport: report}
+	if counter, ok := ds.service.(repository.RecordCounter); ok {
+		result.CurrentRecords = counter.RecordCount()
+	}
+	result.RecordDelta = report.Records - result.CurrentRecords
+	if dryRun || !report.Valid {
+		return result, nil
+	}
+
+	if err := writer.BulkLoad(ctx, records); err != nil {
+		return nil, fmt.Errorf("failed to import dataset %s: %w", name, err)
+	}
+	result.Applied = true
+	if err := writer.Flush(ctx); err != nil {
+		return result, fmt.Errorf("dataset %s imported but not persisted: %w", name, err)
+	}
+
+	d.mu.Lock()
+	ds.info.LoadedAt = time.Now()
+	if versioner, ok := ds.service.(DatasetVersioner); ok {
+		ds.info.Version = versioner.DatasetVersion()
+	}
+	if modTimer, ok := ds.service.(DatasetModTimer); ok {
+		ds.info.ModifiedAt = modTimer.DatasetModTime()
+	}
+	d.mu.Unlock()
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/repository"
+)
+
+func TestDatasetService_Import(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "current.csv")
+	if err := os.WriteFile(path, []byte("ip,city,country\n1.1.1.1,New York,United States\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	repo := repository.NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: path}, slog.Default())
+	ctx := context.Background()
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	datasets := NewDatasetService("main", nil)
+	datasets.Add("main", path, NewIPService(repo), nil)
+	before, _ := datasets.Info("main")
+
+	update := "ip,city,country\n8.8.8.8,Mountain View,United States\n9.9.9.9,Zurich,Switzerland\n"
+
+	// A dry run reports without touching the data
+	result, err := datasets.Import(ctx, "main", strings.NewReader(update), true)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if !result.Valid || result.Applied || result.CurrentRecords != 1 || result.RecordDelta != 1 {
+		t.Errorf("Unexpected dry run result: %+v", result)
+	}
+	if _, err := datasets.FindLocation(ctx, netip.MustParseAddr("8.8.8.8")); err == nil {
+		t.Error("Expected a dry run to leave the data unchanged")
+	}
+
+	// An invalid file is reported, not applied
+	result, err = datasets.Import(ctx, "main", strings.NewReader("ip,city,country\nnot-an-ip,Paris,France\n"), false)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if result.Valid || result.Applied || result.Invalid != 1 {
+		t.Errorf("Unexpected invalid import result: %+v", result)
+	}
+
+	result, err = datasets.Import(ctx, "main", strings.NewReader(update), false)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if !result.Applied {
+		t.Errorf("Expected the import to be applied: %+v", result)
+	}
+	if location, err := datasets.FindLocation(ctx, netip.MustParseAddr("9.9.9.9")); err != nil || location.City != "Zurich" {
+		t.Errorf("FindLocation() after import = %v, %v", location, err)
+	}
+	if after, _ := datasets.Info("main"); after.Version == before.Version {
+		t.Error("Expected the dataset version to change after an import")
+	}
+
+	if _, err := datasets.Import(ctx, "missing", strings.NewReader(update), true); !errors.Is(err, ErrUnknownDataset) {
+		t.Errorf("Expected ErrUnknownDataset, got %v", err)
+	}
+}
+
+func TestDatasetService_Import_ReadOnly(t *testing.T) {
+	datasets := NewDatasetService("main", nil)
+	datasets.Add("main", "mock", NewIPService(NewMockRepository()), nil)
+
+	update := "8.8.8.8,Mountain View,United States\n"
+	if _, err := datasets.Import(context.Background(), "main", strings.NewReader(update), false); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+	if result, err := datasets.Import(context.Background(), "main", strings.NewReader(update), true); err != nil || !result.Valid {
+		t.Errorf("Expected a dry run to validate a read-only dataset, got %+v, %v", result, err)
+	}
+}
@@ -3,64 +3,316 @@ package services
 import (
 	"context"
 	"fmt"
+	"net/netip"
+	"sync/atomic"
 	"time"
 
+	"ip-geolocation-service/internal/experiments"
 	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/privacy"
 	"ip-geolocation-service/internal/repository"
+	"ip-geolocation-service/internal/requestcontext"
 )
 
-// IPService defines the interface for IP location services
+// IPService defines the interface for IP location services. Addresses are parsed
+// once, by the caller, with models.ParseIP.
 type IPService interface {
-	FindLocation(ctx context.Context, ip string) (*models.Location, error)
+	FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error)
 	HealthCheck(ctx context.Context) error
 }
 
+// LookupStatsProvider is implemented by services that expose lookup path counters
+type LookupStatsProvider interface {
+	LookupStats() LookupStats
+}
+
+// LookupStats holds counters for the cache, prefetch and coalescing layers
+type LookupStats struct {
+	Coalesced uint64 `json:"coalesced"`
+	// RefreshFailures counts background refreshes of stale cache entries that failed
+	RefreshFailures uint64         `json:"refresh_failures"`
+	Cache           *CacheStats    `json:"cache,omitempty"`
+	Prefetch        *PrefetchStats `json:"prefetch,omitempty"`
+}
+
+// Default service timeouts
+const (
+	DefaultLookupTimeout = 5 * time.Second
+	DefaultHealthTimeout = 2 * time.Second
+)
+
+// ServiceOptions holds optional components of the lookup path
+type ServiceOptions struct {
+	Cache      *LocationCache
+	Prefetcher *Prefetcher
+	DoNotStore bool // Key the cache and in-flight lookups by a hash of the IP; disables the prefetcher
+	// Translations localizes names for requests that ask for a language (nil serves English only)
+	Translations *Translations
+	// Backend names the repository type in request metrics, e.g. "csv" or "parquet"
+	Backend string
+
+	LookupTimeout     time.Duration // Deadline for a whole lookup (default 5s)
+	RepositoryTimeout time.Duration // Deadline for one repository call (0 inherits the lookup deadline)
+	HealthTimeout     time.Duration // Deadline for health checks (default 2s)
+}
+
 // IPServiceImpl implements IPService
 type IPServiceImpl struct {
-	repository repository.IPRepository
-	validator  *models.IPValidator
+	repository   repository.IPRepository
+	cache        *LocationCache
+	prefetcher   *Prefetcher
+	lookups      *lookupGroup
+	coalesced    atomic.Uint64
+	refreshFails atomic.Uint64
+	keyHasher    *privacy.KeyHasher // Set in do-not-store mode
+	translations *Translations
+	backend      string
+
+	lookupTimeout     time.Duration
+	repositoryTimeout time.Duration
+	healthTimeout     time.Duration
 }
 
 // NewIPService creates a new IP service
 func NewIPService(repo repository.IPRepository) IPService {
+	return NewIPServiceWithOptions(repo, ServiceOptions{})
+}
+
+// NewIPServiceWithOptions creates a new IP service with an optional cache and prefetcher
+func NewIPServiceWithOptions(repo repository.IPRepository, opts ServiceOptions) IPService {
+	if opts.LookupTimeout <= 0 {
+		opts.LookupTimeout = DefaultLookupTimeout
+	}
+	if opts.HealthTimeout <= 0 {
+		opts.HealthTimeout = DefaultHealthTimeout
+	}
+
+	var keyHasher *privacy.KeyHasher
+	if opts.DoNotStore {
+		// The prefetcher remembers raw addresses to detect scans, so it can't run here
+		keyHasher = privacy.NewKeyHasher()
+		opts.Prefetcher = nil
+	}
+
 	return &IPServiceImpl{
-		repository: repo,
-		validator:  models.NewIPValidator(),
+		repository:        repo,
+		cache:             opts.Cache,
+		prefetcher:        opts.Prefetcher,
+		lookups:           newLookupGroup(),
+		keyHasher:         keyHasher,
+		translations:      opts.Translations,
+		backend:           opts.Backend,
+		lookupTimeout:     opts.LookupTimeout,
+		repositoryTimeout: opts.RepositoryTimeout,
+		healthTimeout:     opts.HealthTimeout,
 	}
 }
 
 // FindLocation finds the location for a given IP address
-func (s *IPServiceImpl) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
+func (s *IPServiceImpl) FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
 	// Validate input
-	if err := s.validator.ValidateIP(ip); err != nil {
-		return nil, fmt.Errorf("invalid IP address: %w", err)
+	if !addr.IsValid() {
+		return nil, fmt.Errorf("%w: IP address cannot be empty", models.ErrInvalidIP)
 	}
 
 	// Normalize IP for consistent lookup
-	normalizedIP := s.validator.NormalizeIP(ip)
+	addr = addr.Unmap()
 
-	// Add timeout to context if not already present
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	if s.prefetcher != nil {
+		s.prefetcher.Observe(addr)
+	}
+
+	info := lookupInfoFromContext(ctx)
+	key := s.lookupKey(addr.String())
+
+	// Canary requests can skip the cache to exercise the repository path
+	cache := s.cache
+	if e, ok := experiments.FromContext(ctx); ok && e.BypassCache {
+		cache = nil
+	}
+
+	if cache != nil {
+		if location, refresh, ok := cache.GetStale(key); ok {
+			if refresh {
+				// Serve the stale entry now; the caller's deadline doesn't bound the refresh
+				go s.refresh(context.WithoutCancel(ctx), key, addr)
+			}
+			if info != nil {
+				info.MatchType = MatchExact
+				info.CacheHit = true
+			}
+			s.recordServed(ctx, requestcontext.CacheHit)
+			return s.localize(ctx, location, info), nil
+		}
+	}
+
+	location, shared, err := s.fetch(ctx, key, addr)
+	switch {
+	case cache != nil:
+		s.recordServed(ctx, requestcontext.CacheMiss)
+	case s.cache != nil:
+		s.recordServed(ctx, requestcontext.CacheBypass)
+	default:
+		s.recordServed(ctx, requestcontext.CacheDisabled)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil && !shared {
+		cache.Set(key, location)
+	}
+
+	if info != nil {
+		info.MatchType = MatchExact
+	}
+
+	return s.localize(ctx, location, info), nil
+}
+
+// fetch looks addr up in the repository under the lookup deadline, sharing the
+// result with concurrent lookups of the same key. The shared repository call is
+// detached from the caller that started it, so a client hanging up doesn't fail the
+// lookups waiting on the same call; it gets its own lookup deadline instead.
+func (s *IPServiceImpl) fetch(ctx context.Context, key string, addr netip.Addr) (*models.Location, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.lookupTimeout)
 	defer cancel()
 
-	// Find location in repository
-	location, err := s.repository.FindLocation(ctx, normalizedIP)
+	location, err, shared := s.lookups.Do(ctx, key, func() (*models.Location, error) {
+		callCtx, callCancel := context.WithTimeout(context.WithoutCancel(ctx), s.lookupTimeout)
+		defer callCancel()
+		repoCtx := callCtx
+		if s.repositoryTimeout > 0 {
+			var repoCancel context.CancelFunc
+			repoCtx, repoCancel = context.WithTimeout(callCtx, s.repositoryTimeout)
+			defer repoCancel()
+		}
+		return s.repository.FindLocation(repoCtx, addr)
+	})
+	if shared {
+		s.coalesced.Add(1)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to find location: %w", err)
+		return nil, shared, fmt.Errorf("failed to find location: %w", err)
 	}
 
 	// Validate location data
 	if err := location.ValidateLocation(); err != nil {
-		return nil, fmt.Errorf("invalid location data: %w", err)
+		return nil, shared, fmt.Errorf("%w: %w", models.ErrInvalidLocation, err)
 	}
+	return location, shared, nil
+}
+
+// recordServed notes the backend and cache status of a lookup for request metrics
+func (s *IPServiceImpl) recordServed(ctx context.Context, cache string) {
+	if served := requestcontext.ServedFrom(ctx); served != nil {
+		backend := s.backend
+		if backend == "" {
+			backend = "unknown"
+		}
+		served.Record(backend, cache)
+	}
+}
+
+// refresh replaces a stale cache entry. On failure the stale entry keeps being
+// served until its hard TTL and the next lookup retries.
+func (s *IPServiceImpl) refresh(ctx context.Context, key string, addr netip.Addr) {
+	location, shared, err := s.fetch(ctx, key, addr)
+	switch {
+	case err != nil:
+		s.refreshFails.Add(1)
+		s.cache.RefreshFailed(key)
+	case !shared:
+		s.cache.Set(key, location)
+	}
+}
+
+// localize returns location with names in the language requested by ctx. Cached
+// locations are shared, so translation always works on a copy.
+func (s *IPServiceImpl) localize(ctx context.Context, location *models.Location, info *LookupInfo) *models.Location {
+	lang := LanguageFromContext(ctx)
+	if lang == "" {
+		return location
+	}
+
+	used := DefaultLanguage
+	if s.translations != nil {
+		location, used = s.translations.Localize(location, lang)
+	}
+	if info != nil {
+		info.Language = used
+	}
+	return location
+}
+
+// lookupKey returns the cache and coalescing key for an IP
+func (s *IPServiceImpl) lookupKey(ip string) string {
+	if s.keyHasher != nil {
+		return s.keyHasher.Hash(ip)
+	}
+	return ip
+}
+
+// DatasetVersion returns the version of the data behind the service, if the repository reports one
+func (s *IPServiceImpl) DatasetVersion() string {
+	if provider, ok := s.repository.(repository.VersionProvider); ok {
+		return provider.Version()
+	}
+	return ""
+}
+
+// DatasetModTime returns when the data behind the service was last modified, zero if
+// the repository doesn't know
+func (s *IPServiceImpl) DatasetModTime() time.Time {
+	if provider, ok := s.repository.(repository.ModTimeProvider); ok {
+		return provider.ModTime()
+	}
+	return time.Time{}
+}
 
-	return location, nil
+// RecordCount returns the number of addresses behind the service, if the repository counts them
+func (s *IPServiceImpl) RecordCount() int {
+	if counter, ok := s.repository.(repository.RecordCounter); ok {
+		return counter.RecordCount()
+	}
+	return 0
+}
+
+// SampleIPs returns up to n addresses from the data behind the service, if the repository can enumerate them
+func (s *IPServiceImpl) SampleIPs(n int) []string {
+	if sampler, ok := s.repository.(repository.IPSampler); ok {
+		return sampler.SampleIPs(n)
+	}
+	return nil
+}
+
+// LookupUncached looks addr up in the repository directly, bypassing the cache,
+// prefetcher and translations so bulk inspection doesn't disturb the lookup path
+func (s *IPServiceImpl) LookupUncached(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	return s.repository.FindLocation(ctx, addr.Unmap())
+}
+
+// LookupStats returns counters for the cache, prefetch and coalescing layers
+func (s *IPServiceImpl) LookupStats() LookupStats {
+	stats := LookupStats{
+		Coalesced:       s.coalesced.Load(),
+		RefreshFailures: s.refreshFails.Load(),
+	}
+	if s.cache != nil {
+		cacheStats := s.cache.Stats()
+		stats.Cache = &cacheStats
+	}
+	if s.prefetcher != nil {
+		prefetchStats := s.prefetcher.Stats()
+		stats.Prefetch = &prefetchStats
+	}
+	return stats
 }
 
 // HealthCheck checks if the service is healthy
 func (s *IPServiceImpl) HealthCheck(ctx context.Context) error {
 	// Add timeout to context
-	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, s.healthTimeout)
 	defer cancel()
 
 	// Check repository health
@@ -3,10 +3,14 @@ package services
 import (
 	"context"
 	"errors"
+	"net/netip"
+	"strings"
 	"testing"
 	"time"
 
+	"ip-geolocation-service/internal/experiments"
 	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/requestcontext"
 )
 
 func TestNewIPService(t *testing.T) {
@@ -34,7 +38,7 @@ func TestIPService_FindLocation_Success(t *testing.T) {
 
 	// Test valid IP
 	ctx := context.Background()
-	location, err := service.FindLocation(ctx, "8.8.8.8")
+	location, err := service.FindLocation(ctx, netip.MustParseAddr("8.8.8.8"))
 
 	if err != nil {
 		t.Fatalf("FindLocation() error = %v", err)
@@ -89,13 +93,20 @@ func TestIPService_FindLocation_InvalidIP(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
-			_, err := service.FindLocation(ctx, tt.ip)
+			// Callers parse addresses before looking them up
+			addr, err := models.ParseIP(tt.ip)
+			if err == nil {
+				_, err = service.FindLocation(ctx, addr)
+			}
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("FindLocation() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
+	if _, err := service.FindLocation(context.Background(), netip.Addr{}); err == nil || !strings.Contains(err.Error(), "invalid IP address") {
+		t.Errorf("FindLocation() of the zero address error = %v, want invalid IP address", err)
+	}
 }
 
 func TestIPService_FindLocation_NotFound(t *testing.T) {
@@ -103,7 +114,7 @@ func TestIPService_FindLocation_NotFound(t *testing.T) {
 	service := NewIPService(repo)
 
 	ctx := context.Background()
-	_, err := service.FindLocation(ctx, "1.1.1.1")
+	_, err := service.FindLocation(ctx, netip.MustParseAddr("1.1.1.1"))
 
 	if err == nil {
 		t.Error("FindLocation() expected error for non-existent IP")
@@ -126,7 +137,7 @@ func TestIPService_FindLocation_ContextTimeout(t *testing.T) {
 	// Wait for timeout
 	time.Sleep(1 * time.Millisecond)
 
-	_, err := service.FindLocation(ctx, "8.8.8.8")
+	_, err := service.FindLocation(ctx, netip.MustParseAddr("8.8.8.8"))
 
 	if err == nil {
 		t.Error("FindLocation() expected timeout error")
@@ -150,7 +161,7 @@ func TestIPService_FindLocation_InvalidLocationData(t *testing.T) {
 	repo.SetLocation("8.8.8.8", invalidLocation)
 
 	ctx := context.Background()
-	_, err := service.FindLocation(ctx, "8.8.8.8")
+	_, err := service.FindLocation(ctx, netip.MustParseAddr("8.8.8.8"))
 
 	if err == nil {
 		t.Error("FindLocation() expected error for invalid location data")
@@ -213,3 +224,190 @@ func TestIPService_HealthCheck_ContextTimeout(t *testing.T) {
 		t.Error("HealthCheck() expected timeout error or context cancellation")
 	}
 }
+
+func TestIPService_FindLocation_UsesCache(t *testing.T) {
+	repo := NewMockRepository()
+	cache := NewLocationCache(10, 0)
+	service := NewIPServiceWithOptions(repo, ServiceOptions{Cache: cache})
+
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+
+	ctx := context.Background()
+	if _, err := service.FindLocation(ctx, netip.MustParseAddr("8.8.8.8")); err != nil {
+		t.Fatalf("FindLocation() error = %v", err)
+	}
+
+	// Remove from the repository; the cached value should still be served
+	delete(repo.locations, "8.8.8.8")
+	location, err := service.FindLocation(ctx, netip.MustParseAddr("8.8.8.8"))
+	if err != nil {
+		t.Fatalf("FindLocation() expected cache hit, got error = %v", err)
+	}
+	if location.City != "Mountain View" {
+		t.Errorf("FindLocation() city = %v, want Mountain View", location.City)
+	}
+
+	stats := service.(LookupStatsProvider).LookupStats()
+	if stats.Cache == nil || stats.Cache.Hits != 1 {
+		t.Errorf("Expected 1 cache hit, got %+v", stats.Cache)
+	}
+	if stats.Prefetch != nil {
+		t.Error("Expected no prefetch stats without a prefetcher")
+	}
+}
+
+func TestIPService_FindLocation_ExperimentBypassesCache(t *testing.T) {
+	repo := NewMockRepository()
+	cache := NewLocationCache(10, 0)
+	service := NewIPServiceWithOptions(repo, ServiceOptions{Cache: cache})
+	addr := netip.MustParseAddr("8.8.8.8")
+
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	if _, err := service.FindLocation(context.Background(), addr); err != nil {
+		t.Fatalf("FindLocation() error = %v", err)
+	}
+
+	// The canary reads the repository while other requests keep the cached value
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "San Jose"})
+	ctx := experiments.WithExperiment(context.Background(), experiments.Experiment{Name: "no-cache", BypassCache: true})
+	ctx, served := requestcontext.WithServed(ctx)
+	location, err := service.FindLocation(ctx, addr)
+	if err != nil {
+		t.Fatalf("FindLocation() error = %v", err)
+	}
+	if location.City != "San Jose" {
+		t.Errorf("Experiment lookup city = %v, want San Jose", location.City)
+	}
+	if _, status := served.Labels(); status != requestcontext.CacheBypass {
+		t.Errorf("Cache status = %q, want %q", status, requestcontext.CacheBypass)
+	}
+	if location, _ := service.FindLocation(context.Background(), addr); location.City != "Mountain View" {
+		t.Errorf("Regular lookup city = %v, want the cached Mountain View", location.City)
+	}
+}
+
+func TestIPService_FindLocation_ServesStaleWhileRefreshing(t *testing.T) {
+	repo := &blockingRepository{MockRepository: NewMockRepository(), release: make(chan struct{})}
+	cache := NewLocationCacheWithHardTTL(10, 10*time.Millisecond, time.Hour)
+	service := NewIPServiceWithOptions(repo, ServiceOptions{Cache: cache})
+	addr := netip.MustParseAddr("8.8.8.8")
+	ctx := context.Background()
+
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	go func() { repo.release <- struct{}{} }()
+	if _, err := service.FindLocation(ctx, addr); err != nil {
+		t.Fatalf("FindLocation() error = %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "San Jose"})
+
+	// The repository is blocked, yet stale lookups return at once with one refresh in flight
+	for i := 0; i < 3; i++ {
+		location, err := service.FindLocation(ctx, addr)
+		if err != nil {
+			t.Fatalf("FindLocation() error = %v", err)
+		}
+		if location.City != "Mountain View" {
+			t.Errorf("FindLocation() city = %v, want stale Mountain View", location.City)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	repo.mu.Lock()
+	calls := repo.calls
+	repo.mu.Unlock()
+	if calls != 2 {
+		t.Errorf("Expected one background refresh, got %d repository calls", calls)
+	}
+
+	repo.release <- struct{}{}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		location, err := service.FindLocation(ctx, addr)
+		if err != nil {
+			t.Fatalf("FindLocation() error = %v", err)
+		}
+		if location.City == "San Jose" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the refreshed entry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if stats := cache.Stats(); stats.StaleHits < 3 {
+		t.Errorf("Expected at least 3 stale hits, got %+v", stats)
+	}
+}
+
+func TestIPService_FindLocation_FailedRefreshKeepsStale(t *testing.T) {
+	repo := NewMockRepository()
+	cache := NewLocationCacheWithHardTTL(10, 10*time.Millisecond, time.Hour)
+	service := NewIPServiceWithOptions(repo, ServiceOptions{Cache: cache})
+	addr := netip.MustParseAddr("8.8.8.8")
+
+	cache.Set("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	time.Sleep(20 * time.Millisecond)
+
+	// The repository has no location, so the refresh fails and the stale entry stays
+	location, err := service.FindLocation(context.Background(), addr)
+	if err != nil || location.City != "Mountain View" {
+		t.Fatalf("FindLocation() = %v, %v, want stale Mountain View", location, err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for service.(LookupStatsProvider).LookupStats().RefreshFailures != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the refresh to fail")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, refresh, ok := cache.GetStale("8.8.8.8"); !ok || !refresh {
+		t.Errorf("Expected the stale entry to be kept and its refresh retried, got ok=%v refresh=%v", ok, refresh)
+	}
+}
+
+func TestIPService_DoNotStore(t *testing.T) {
+	repo := NewMockRepository()
+	cache := NewLocationCache(10, 0)
+	prefetcher := NewPrefetcher(repo, cache, 3, 16)
+	service := NewIPServiceWithOptions(repo, ServiceOptions{Cache: cache, Prefetcher: prefetcher, DoNotStore: true})
+
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := service.FindLocation(ctx, netip.MustParseAddr("8.8.8.8")); err != nil {
+			t.Fatalf("FindLocation() error = %v", err)
+		}
+	}
+
+	// The cache still works, but never holds the raw address
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Size != 1 {
+		t.Errorf("Expected one cached entry and one hit, got %+v", stats)
+	}
+	for key := range cache.entries {
+		if strings.Contains(key, "8.8.8.8") {
+			t.Errorf("Cache key holds the raw IP: %s", key)
+		}
+	}
+	if stats := service.(LookupStatsProvider).LookupStats(); stats.Prefetch != nil {
+		t.Error("Expected the prefetcher to be disabled in do-not-store mode")
+	}
+}
+
+func TestIPService_FindLocation_RepositoryTimeout(t *testing.T) {
+	repo := &blockingRepository{MockRepository: NewMockRepository(), release: make(chan struct{})}
+	defer close(repo.release)
+
+	service := NewIPServiceWithOptions(repo, ServiceOptions{RepositoryTimeout: 20 * time.Millisecond})
+
+	start := time.Now()
+	_, err := service.FindLocation(context.Background(), netip.MustParseAddr("8.8.8.8"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected repository timeout to fire quickly, took %v", elapsed)
+	}
+}
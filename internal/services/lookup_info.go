@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+// Lookup answer sources, in precedence order
+const (
+	SourceOverride = "override"
+	SourceDataset  = "dataset"
+)
+
+// Match types reported in LookupInfo
+const (
+	MatchExact    = "exact"
+	MatchCIDR     = "cidr"
+	MatchOverride = "override"
+)
+
+// LookupInfo describes how a lookup was answered. Callers opt in with WithLookupInfo
+// and the service layers fill it in as the lookup passes through them.
+type LookupInfo struct {
+	Source         string `json:"source"`                    // SourceOverride or SourceDataset
+	MatchType      string `json:"match_type,omitempty"`      // MatchExact, MatchCIDR or MatchOverride
+	Dataset        string `json:"dataset,omitempty"`         // Dataset that answered (empty for overrides)
+	DatasetVersion string `json:"dataset_version,omitempty"` // Version of the dataset that answered
+	Override       string `json:"override,omitempty"`        // Override target (IP or CIDR) that matched
+	Language       string `json:"language,omitempty"`        // Language of the returned names when one was requested
+	CacheHit       bool   `json:"cache_hit"`
+}
+
+// lookupInfoKey carries the request's LookupInfo through the context
+var lookupInfoKey = requestcontext.NewKey[*LookupInfo]("lookup_info")
+
+// WithLookupInfo returns a context that collects lookup metadata into the returned LookupInfo
+func WithLookupInfo(ctx context.Context) (context.Context, *LookupInfo) {
+	info := &LookupInfo{Source: SourceDataset}
+	return lookupInfoKey.With(ctx, info), info
+}
+
+// lookupInfoFromContext returns the LookupInfo to fill in, or nil if the caller didn't ask for one
+func lookupInfoFromContext(ctx context.Context) *LookupInfo {
+	info, _ := lookupInfoKey.Value(ctx)
+	return info
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// DefaultMissPrefixes is how many prefixes a MissTracker keeps when unset
+const DefaultMissPrefixes = 1000
+
+// Prefix lengths misses are aggregated to, the same truncation as privacy mode
+const (
+	missPrefixBitsV4 = 24
+	missPrefixBitsV6 = 48
+)
+
+// PrefixMisses is the miss count of one network prefix
+type PrefixMisses struct {
+	Prefix netip.Prefix `json:"prefix"`
+	Misses uint64       `json:"misses"`
+	// Lookups counts lookups in the prefix, found or not, since it was tracked
+	Lookups  uint64  `json:"lookups"`
+	MissRate float64 `json:"miss_rate"`
+	// MaxOvercount bounds how much Misses may be overstated: a prefix that replaced
+	// another when the table was full inherits its count
+	MaxOvercount uint64 `json:"max_overcount,omitempty"`
+}
+
+// missEntry holds the counters of a tracked prefix; lookups is updated under the
+// tracker's read lock
+type missEntry struct {
+	misses    uint64
+	overcount uint64
+	lookups   atomic.Uint64
+}
+
+// MissTracker counts lookups of valid addresses that found no location, aggregated
+// by /24 (IPv4) or /48 (IPv6) prefix so no address is kept. The table holds a
+// bounded number of prefixes using the space-saving algorithm: when full, a new
+// prefix replaces the one with the fewest misses, so the most missed prefixes are
+// always kept.
+type MissTracker struct {
+	capacity int
+	lookups  atomic.Uint64
+	misses   atomic.Uint64
+
+	mu       sync.RWMutex
+	prefixes map[netip.Prefix]*missEntry
+}
+
+// NewMissTracker creates a tracker keeping up to capacity prefixes (0 uses
+// DefaultMissPrefixes)
+func NewMissTracker(capacity int) *MissTracker {
+	if capacity <= 0 {
+		capacity = DefaultMissPrefixes
+	}
+	return &MissTracker{capacity: capacity, prefixes: make(map[netip.Prefix]*missEntry)}
+}
+
+// missPrefix returns the prefix addr is aggregated to
+func missPrefix(addr netip.Addr) netip.Prefix {
+	bits := missPrefixBitsV4
+	if addr.Is6() {
+		bits = missPrefixBitsV6
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix
+}
+
+// Record counts one lookup of addr, found or not
+func (t *MissTracker) Record(addr netip.Addr, found bool) {
+	t.lookups.Add(1)
+	prefix := missPrefix(addr)
+
+	if found {
+		t.mu.RLock()
+		if entry, ok := t.prefixes[prefix]; ok {
+			entry.lookups.Add(1)
+		}
+		t.mu.RUnlock()
+		return
+	}
+
+	t.misses.Add(1)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.prefixes[prefix]
+	if !ok {
+		entry = &missEntry{}
+		if len(t.prefixes) >= t.capacity {
+			victim, fewest := t.fewestMisses()
+			delete(t.prefixes, victim)
+			entry.misses, entry.overcount = fewest.misses, fewest.misses
+			entry.lookups.Store(fewest.misses)
+		}
+		t.prefixes[prefix] = entry
+	}
+	entry.misses++
+	entry.lookups.Add(1)
+}
+
+// fewestMisses returns the tracked prefix with the lowest count; callers hold mu
+func (t *MissTracker) fewestMisses() (netip.Prefix, *missEntry) {
+	var victim netip.Prefix
+	var fewest *missEntry
+	for prefix, entry := range t.prefixes {
+		if fewest == nil || entry.misses < fewest.misses {
+			victim, fewest = prefix, entry
+		}
+	}
+	return victim, fewest
+}
+
+// Totals returns the number of lookups and misses recorded
+func (t *MissTracker) Totals() (lookups, misses uint64) {
+	return t.lookups.Load(), t.misses.Load()
+}
+
+// Top returns up to n prefixes with the most misses, most missed first
+func (t *MissTracker) Top(n int) []PrefixMisses {
+	t.mu.RLock()
+	top := make([]PrefixMisses, 0, len(t.prefixes))
+	for prefix, entry := range t.prefixes {
+		lookups := entry.lookups.Load()
+		top = append(top, PrefixMisses{
+			Prefix:       prefix,
+			Misses:       entry.misses,
+			Lookups:      lookups,
+			MissRate:     float64(entry.misses) / float64(max(lookups, entry.misses)),
+			MaxOvercount: entry.overcount,
+		})
+	}
+	t.mu.RUnlock()
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Misses != top[j].Misses {
+			return top[i].Misses > top[j].Misses
+		}
+		return top[i].Prefix.Addr().Less(top[j].Prefix.Addr())
+	})
+	if n >= 0 && len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// Capacity returns the maximum number of tracked prefixes
+func (t *MissTracker) Capacity() int {
+	return t.capacity
+}
+
+// RegisterMetrics exposes dataset coverage on the registry
+func (t *MissTracker) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewCounterFunc("ipgeo_coverage_lookups_total",
+		"Total lookups of valid addresses counted for dataset coverage",
+		func() float64 { return float64(t.lookups.Load()) })
+	registry.NewCounterFunc("ipgeo_coverage_misses_total",
+		"Total lookups of valid addresses that found no location",
+		func() float64 { return float64(t.misses.Load()) })
+	registry.NewGaugeFunc("ipgeo_coverage_miss_ratio",
+		"Fraction of lookups that found no location since startup",
+		func() float64 {
+			lookups, misses := t.Totals()
+			if lookups == 0 {
+				return 0
+			}
+			return float64(misses) / float64(lookups)
+		})
+	registry.NewGaugeFunc("ipgeo_coverage_tracked_prefixes",
+		"Network prefixes tracked by /admin/misses",
+		func() float64 {
+			t.mu.RLock()
+			defer t.mu.RUnlock()
+			return float64(len(t.prefixes))
+		})
+}
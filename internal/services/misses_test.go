@@ -0,0 +1,68 @@
+package services
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestMissTracker_AggregatesByPrefix(t *testing.T) {
+	tracker := NewMissTracker(10)
+	for _, tc := range []struct {
+		ip    string
+		found bool
+	}{
+		{"203.0.113.7", false},
+		{"203.0.113.200", false},
+		{"203.0.113.9", true},
+		{"198.51.100.1", false},
+		{"2001:db8:1:2::1", false},
+		{"2001:db8:1:ffff::1", true},
+		{"8.8.8.8", true}, // Never missed, so never tracked
+	} {
+		tracker.Record(netip.MustParseAddr(tc.ip), tc.found)
+	}
+
+	lookups, misses := tracker.Totals()
+	if lookups != 7 || misses != 4 {
+		t.Errorf("Totals() = %d, %d, want 7, 4", lookups, misses)
+	}
+
+	top := tracker.Top(10)
+	want := []PrefixMisses{
+		{Prefix: netip.MustParsePrefix("203.0.113.0/24"), Misses: 2, Lookups: 3, MissRate: 2.0 / 3},
+		{Prefix: netip.MustParsePrefix("198.51.100.0/24"), Misses: 1, Lookups: 1, MissRate: 1},
+		{Prefix: netip.MustParsePrefix("2001:db8:1::/48"), Misses: 1, Lookups: 2, MissRate: 0.5},
+	}
+	if len(top) != len(want) {
+		t.Fatalf("Top() = %+v, want %+v", top, want)
+	}
+	for i := range want {
+		if top[i] != want[i] {
+			t.Errorf("Top()[%d] = %+v, want %+v", i, top[i], want[i])
+		}
+	}
+	if got := tracker.Top(1); len(got) != 1 || got[0].Prefix != want[0].Prefix {
+		t.Errorf("Top(1) = %+v", got)
+	}
+}
+
+func TestMissTracker_KeepsMostMissedWhenFull(t *testing.T) {
+	tracker := NewMissTracker(2)
+	heavy := netip.MustParseAddr("203.0.113.1")
+	for range 5 {
+		tracker.Record(heavy, false)
+	}
+	tracker.Record(netip.MustParseAddr("198.51.100.1"), false)
+	tracker.Record(netip.MustParseAddr("192.0.2.1"), false) // Replaces 198.51.100.0/24
+
+	top := tracker.Top(-1)
+	if len(top) != 2 {
+		t.Fatalf("Top() = %+v, want 2 prefixes", top)
+	}
+	if top[0].Prefix != netip.MustParsePrefix("203.0.113.0/24") || top[0].Misses != 5 || top[0].MaxOvercount != 0 {
+		t.Errorf("Top()[0] = %+v, want the heavy prefix kept exactly", top[0])
+	}
+	if top[1].Prefix != netip.MustParsePrefix("192.0.2.0/24") || top[1].Misses != 2 || top[1].MaxOvercount != 1 {
+		t.Errorf("Top()[1] = %+v, want the replacement with an inherited count", top[1])
+	}
+}
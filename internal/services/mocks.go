@@ -2,9 +2,12 @@ package services
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
 
 	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/repository"
 )
 
 // MockRepository implements repository.IPRepository for testing
@@ -21,11 +24,33 @@ func NewMockRepository() *MockRepository {
 	}
 }
 
-func (m *MockRepository) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
-	if location, exists := m.locations[ip]; exists {
+func (m *MockRepository) FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	if location, exists := m.locations[addr.String()]; exists {
 		return location, nil
 	}
-	return nil, errors.New("location not found for IP: " + ip)
+	return nil, fmt.Errorf("%w for IP: %s", ErrNotFound, addr)
+}
+
+func (m *MockRepository) SampleIPs(n int) []string {
+	ips := make([]string, 0, min(n, len(m.locations)))
+	for ip := range m.locations {
+		if len(ips) == n {
+			break
+		}
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+func (m *MockRepository) Records() []repository.Record {
+	records := make([]repository.Record, 0, len(m.locations))
+	for ip, location := range m.locations {
+		records = append(records, repository.Record{IP: ip, Location: *location})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return netip.MustParseAddr(records[i].IP).Less(netip.MustParseAddr(records[j].IP))
+	})
+	return records
 }
 
 func (m *MockRepository) Initialize(ctx context.Context) error {
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+// ErrOverrideNotFound is returned when deleting an override that doesn't exist
+var ErrOverrideNotFound = errors.New("override not found")
+
+// Override is a manual correction for a single IP or a CIDR range
+type Override struct {
+	Target    string    `json:"target"` // Canonical IP or CIDR
+	Country   string    `json:"country"`
+	City      string    `json:"city"`
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OverrideStore holds manual corrections consulted before any dataset.
+// Precedence: an exact IP override beats a CIDR override, and among CIDR
+// overrides the most specific prefix wins.
+//
+// When a file path is configured, every mutation is written back to it as CSV
+// (target,country,city,reason,updated_at) so corrections survive restarts.
+type OverrideStore struct {
+	mu       sync.RWMutex
+	exact    map[netip.Addr]Override
+	prefixes map[netip.Prefix]Override
+	path     string
+}
+
+// NewOverrideStore creates an empty store persisted to path ("" keeps it in memory only)
+func NewOverrideStore(path string) *OverrideStore {
+	return &OverrideStore{
+		exact:    make(map[netip.Addr]Override),
+		prefixes: make(map[netip.Prefix]Override),
+		path:     path,
+	}
+}
+
+// Load reads overrides from the store's file; a missing file is treated as empty
+func (s *OverrideStore) Load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open overrides file %s: %w", s.path, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read overrides file: %w", err)
+		}
+		if line == 1 && record[0] == "target" {
+			continue
+		}
+		if len(record) < 3 {
+			return fmt.Errorf("overrides file line %d: expected at least 3 fields, got %d", line, len(record))
+		}
+
+		override := Override{Target: record[0], Country: record[1], City: record[2]}
+		if len(record) > 3 {
+			override.Reason = record[3]
+		}
+		if len(record) > 4 {
+			override.UpdatedAt, _ = time.Parse(time.RFC3339, record[4])
+		}
+		if err := s.putLocked(override); err != nil {
+			return fmt.Errorf("overrides file line %d: %w", line, err)
+		}
+	}
+	return nil
+}
+
+// Set adds or replaces the override for its target
+func (s *OverrideStore) Set(override Override) (Override, error) {
+	if override.UpdatedAt.IsZero() {
+		override.UpdatedAt = time.Now().UTC()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.putLocked(override); err != nil {
+		return Override{}, err
+	}
+	stored, _ := s.getLocked(override.Target)
+	return stored, s.saveLocked()
+}
+
+// Get returns the override for an exact target
+func (s *OverrideStore) Get(target string) (Override, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getLocked(target)
+}
+
+// Delete removes the override for target
+func (s *OverrideStore) Delete(target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if prefix, err := parseOverridePrefix(target); err == nil {
+		if _, exists := s.prefixes[prefix]; exists {
+			delete(s.prefixes, prefix)
+			return s.saveLocked()
+		}
+	} else if addr, err := netip.ParseAddr(target); err == nil {
+		if _, exists := s.exact[addr.Unmap()]; exists {
+			delete(s.exact, addr.Unmap())
+			return s.saveLocked()
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrOverrideNotFound, target)
+}
+
+// Match returns the override that applies to addr under the precedence rules
+func (s *OverrideStore) Match(addr netip.Addr) (Override, bool) {
+	addr = addr.Unmap()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if override, exists := s.exact[addr]; exists {
+		return override, true
+	}
+
+	var best Override
+	bestBits := -1
+	for prefix, override := range s.prefixes {
+		if prefix.Bits() > bestBits && prefix.Contains(addr) {
+			best = override
+			bestBits = prefix.Bits()
+		}
+	}
+	return best, bestBits >= 0
+}
+
+// List returns all overrides sorted by target
+func (s *OverrideStore) List() []Override {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	overrides := make([]Override, 0, len(s.exact)+len(s.prefixes))
+	for _, override := range s.exact {
+		overrides = append(overrides, override)
+	}
+	for _, override := range s.prefixes {
+		overrides = append(overrides, override)
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Target < overrides[j].Target })
+	return overrides
+}
+
+// Len returns the number of overrides
+func (s *OverrideStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.exact) + len(s.prefixes)
+}
+
+// putLocked validates and stores an override under its canonical target
+func (s *OverrideStore) putLocked(override Override) error {
+	location := models.Location{Country: override.Country, City: override.City}
+	if err := location.ValidateLocation(); err != nil {
+		return fmt.Errorf("%w: %w", models.ErrInvalidLocation, err)
+	}
+
+	target := strings.TrimSpace(override.Target)
+	if strings.Contains(target, "/") {
+		prefix, err := parseOverridePrefix(target)
+		if err != nil {
+			return err
+		}
+		override.Target = prefix.String()
+		s.prefixes[prefix] = override
+		return nil
+	}
+
+	addr, err := netip.ParseAddr(target)
+	if err != nil {
+		return fmt.Errorf("invalid override target %q: must be an IP address or CIDR", override.Target)
+	}
+	addr = addr.Unmap()
+	override.Target = addr.String()
+	s.exact[addr] = override
+	return nil
+}
+
+func (s *OverrideStore) getLocked(target string) (Override, bool) {
+	if prefix, err := parseOverridePrefix(target); err == nil {
+		override, exists := s.prefixes[prefix]
+		return override, exists
+	}
+	if addr, err := netip.ParseAddr(target); err == nil {
+		override, exists := s.exact[addr.Unmap()]
+		return override, exists
+	}
+	return Override{}, false
+}
+
+// saveLocked writes the store to its file atomically (temp file + rename)
+func (s *OverrideStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".overrides-*.csv")
+	if err != nil {
+		return fmt.Errorf("failed to save overrides: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := csv.NewWriter(tmp)
+	writer.Write([]string{"target", "country", "city", "reason", "updated_at"})
+	for _, override := range s.exact {
+		writer.Write(overrideRecord(override))
+	}
+	for _, override := range s.prefixes {
+		writer.Write(overrideRecord(override))
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save overrides: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save overrides: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save overrides: %w", err)
+	}
+	return nil
+}
+
+func overrideRecord(override Override) []string {
+	return []string{override.Target, override.Country, override.City, override.Reason, override.UpdatedAt.Format(time.RFC3339)}
+}
+
+// parseOverridePrefix parses a CIDR target, normalizing it to its network address
+func parseOverridePrefix(target string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(target))
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid override target %q: must be an IP address or CIDR", target)
+	}
+	if prefix.Addr().Is4In6() {
+		if prefix.Bits() < 96 {
+			return netip.Prefix{}, fmt.Errorf("invalid override target %q: IPv4-mapped prefix too short", target)
+		}
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
+
+// OverrideService consults the override store before delegating to the wrapped service
+type OverrideService struct {
+	next      IPService
+	overrides *OverrideStore
+}
+
+// NewOverrideService wraps next so overrides take precedence over any dataset
+func NewOverrideService(next IPService, overrides *OverrideStore) *OverrideService {
+	return &OverrideService{next: next, overrides: overrides}
+}
+
+// FindLocation returns the matching override, or the wrapped service's answer
+func (s *OverrideService) FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	if override, ok := s.overrides.Match(addr); ok {
+		if info := lookupInfoFromContext(ctx); info != nil {
+			info.Source = SourceOverride
+			info.MatchType = MatchOverride
+			info.Override = override.Target
+		}
+		if served := requestcontext.ServedFrom(ctx); served != nil {
+			served.Record(SourceOverride, requestcontext.CacheBypass)
+		}
+		// An operator's correction is authoritative
+		confidence := 100
+		location := &models.Location{Country: override.Country, City: override.City, Confidence: &confidence}
+		location.Enrich()
+		return location, nil
+	}
+	return s.next.FindLocation(ctx, addr)
+}
+
+// HealthCheck checks the wrapped service
+func (s *OverrideService) HealthCheck(ctx context.Context) error {
+	return s.next.HealthCheck(ctx)
+}
+
+// LookupStats returns the wrapped service's lookup counters, if it exposes them
+func (s *OverrideService) LookupStats() LookupStats {
+	if provider, ok := s.next.(LookupStatsProvider); ok {
+		return provider.LookupStats()
+	}
+	return LookupStats{}
+}
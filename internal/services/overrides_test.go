@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ip-geolocation-service/internal/models"
+)
+
+var locationFixture = models.Location{Country: "Australia", City: "Sydney"}
+
+func TestOverrideStore_Precedence(t *testing.T) {
+	store := NewOverrideStore("")
+	for _, override := range []Override{
+		{Target: "10.0.0.0/8", Country: "Wide", City: "A"},
+		{Target: "10.1.0.0/16", Country: "Narrow", City: "B"},
+		{Target: "10.1.2.3", Country: "Exact", City: "C"},
+	} {
+		if _, err := store.Set(override); err != nil {
+			t.Fatalf("Set(%s) error = %v", override.Target, err)
+		}
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"10.1.2.3", "Exact"},
+		{"::ffff:10.1.2.3", "Exact"},
+		{"10.1.9.9", "Narrow"},
+		{"10.200.0.1", "Wide"},
+		{"11.0.0.1", ""},
+	}
+
+	for _, tt := range tests {
+		override, ok := store.Match(netip.MustParseAddr(tt.ip))
+		if got := override.Country; ok != (tt.want != "") || got != tt.want {
+			t.Errorf("Match(%s) = %q, %v; want %q", tt.ip, got, ok, tt.want)
+		}
+	}
+}
+
+func TestOverrideStore_Validation(t *testing.T) {
+	store := NewOverrideStore("")
+
+	invalid := []Override{
+		{Target: "not-an-ip", Country: "X", City: "Y"},
+		{Target: "10.0.0.0/33", Country: "X", City: "Y"},
+		{Target: "10.0.0.1", Country: "", City: "Y"},
+	}
+	for _, override := range invalid {
+		if _, err := store.Set(override); err == nil {
+			t.Errorf("Set(%+v) expected error", override)
+		}
+	}
+
+	stored, err := store.Set(Override{Target: "10.1.2.3/16", Country: "X", City: "Y"})
+	if err != nil || stored.Target != "10.1.0.0/16" {
+		t.Errorf("Expected CIDR to be normalized, got %q, %v", stored.Target, err)
+	}
+
+	if err := store.Delete("10.9.9.9"); !errors.Is(err, ErrOverrideNotFound) {
+		t.Errorf("Delete() error = %v, want ErrOverrideNotFound", err)
+	}
+	if err := store.Delete("10.1.0.0/16"); err != nil || store.Len() != 0 {
+		t.Errorf("Delete() error = %v, len = %d", err, store.Len())
+	}
+}
+
+func TestOverrideStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.csv")
+
+	store := NewOverrideStore(path)
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load() of missing file error = %v", err)
+	}
+	store.Set(Override{Target: "8.8.8.8", Country: "Corrected, Country", City: "City", Reason: "ticket 42"})
+	store.Set(Override{Target: "1.1.0.0/16", Country: "Range", City: "Any"})
+
+	reloaded := NewOverrideStore(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	override, ok := reloaded.Get("8.8.8.8")
+	if !ok || override.Country != "Corrected, Country" || override.Reason != "ticket 42" || override.UpdatedAt.IsZero() {
+		t.Errorf("Reloaded override = %+v", override)
+	}
+	if reloaded.Len() != 2 {
+		t.Errorf("Reloaded %d overrides, want 2", reloaded.Len())
+	}
+
+	os.WriteFile(path, []byte("target,country,city\nbogus,X,Y\n"), 0o644)
+	if err := NewOverrideStore(path).Load(); err == nil {
+		t.Error("Expected Load() to reject an invalid target")
+	}
+}
+
+func TestOverrideService_FindLocation(t *testing.T) {
+	store := NewOverrideStore("")
+	store.Set(Override{Target: "8.8.8.0/24", Country: "Corrected", City: "Fixed"})
+
+	repo := NewMockRepository()
+	repo.SetLocation("1.1.1.1", &locationFixture)
+	datasets := NewDatasetService("default", nil)
+	datasets.Add("default", "default.csv", NewIPService(repo), nil)
+	service := NewOverrideService(datasets, store)
+
+	ctx, info := WithLookupInfo(context.Background())
+	location, err := service.FindLocation(ctx, netip.MustParseAddr("8.8.8.8"))
+	if err != nil || location.Country != "Corrected" {
+		t.Fatalf("Expected override answer, got %v, %v", location, err)
+	}
+	if location.Accuracy != models.AccuracyCity || location.Confidence == nil || *location.Confidence != 100 {
+		t.Errorf("Expected overrides to be fully confident at city level, got %q, %v", location.Accuracy, location.Confidence)
+	}
+	if info.Source != SourceOverride || info.Override != "8.8.8.0/24" || info.Dataset != "" {
+		t.Errorf("LookupInfo = %+v, want override source", info)
+	}
+
+	ctx, info = WithLookupInfo(context.Background())
+	location, err = service.FindLocation(ctx, netip.MustParseAddr("1.1.1.1"))
+	if err != nil || location.Country != locationFixture.Country {
+		t.Fatalf("Expected dataset answer, got %v, %v", location, err)
+	}
+	if info.Source != SourceDataset || info.Dataset != "default" {
+		t.Errorf("LookupInfo = %+v, want dataset source", info)
+	}
+
+	if _, err := service.FindLocation(context.Background(), netip.Addr{}); err == nil {
+		t.Error("Expected the zero address to fall through to validation")
+	}
+}
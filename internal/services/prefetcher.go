@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/repository"
+)
+
+// maxTrackedStreams bounds the sequential-scan detector's memory
+const maxTrackedStreams = 4096
+
+// PrefetchStats holds prefetch effectiveness counters
+type PrefetchStats struct {
+	Triggered  uint64  `json:"triggered"`  // Prefetch batches started
+	Skipped    uint64  `json:"skipped"`    // Batches dropped because the worker pool was busy
+	Prefetched uint64  `json:"prefetched"` // Entries warmed into the cache
+	Hits       uint64  `json:"hits"`       // Prefetched entries later served from cache
+	Wasted     uint64  `json:"wasted"`     // Prefetched entries evicted or expired unread
+	HitRatio   float64 `json:"hit_ratio"`  // Hits / Prefetched
+}
+
+// scanState tracks one sequential scan
+type scanState struct {
+	streak  int
+	horizon netip.Addr // First address past the last prefetched batch
+}
+
+// Prefetcher detects sequential IP scans and warms the cache with the addresses that follow
+type Prefetcher struct {
+	repository repository.IPRepository
+	cache      *LocationCache
+	trigger    int
+	window     int
+	timeout    time.Duration
+
+	// streams maps the next expected address of a scan to its state
+	streams map[netip.Addr]scanState
+	mu      sync.Mutex
+
+	// sem bounds concurrent prefetch batches
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	triggered  atomic.Uint64
+	skipped    atomic.Uint64
+	prefetched atomic.Uint64
+	hits       atomic.Uint64
+	wasted     atomic.Uint64
+}
+
+// NewPrefetcher creates a prefetcher that warms cache from repo once a scan of
+// trigger consecutive addresses is observed, fetching window addresses ahead
+func NewPrefetcher(repo repository.IPRepository, cache *LocationCache, trigger, window int) *Prefetcher {
+	p := &Prefetcher{
+		repository: repo,
+		cache:      cache,
+		trigger:    trigger,
+		window:     window,
+		timeout:    5 * time.Second,
+		streams:    make(map[netip.Addr]scanState),
+		sem:        make(chan struct{}, 4),
+	}
+
+	cache.onPrefetchHit = func() { p.hits.Add(1) }
+	cache.onPrefetchWasted = func() { p.wasted.Add(1) }
+
+	return p
+}
+
+// Observe records a lookup of addr and starts a prefetch when it extends a sequential scan
+func (p *Prefetcher) Observe(addr netip.Addr) {
+	next := addr.Next()
+	if !next.IsValid() {
+		return
+	}
+
+	p.mu.Lock()
+	state := p.streams[addr]
+	state.streak++
+	delete(p.streams, addr)
+	if len(p.streams) >= maxTrackedStreams {
+		// Forget all scans rather than let random traffic grow the map unbounded
+		p.streams = make(map[netip.Addr]scanState)
+	}
+
+	// Prefetch once the scan is established and has moved past the last warmed batch
+	start := state.streak >= p.trigger && (!state.horizon.IsValid() || !next.Less(state.horizon))
+	if start {
+		select {
+		case p.sem <- struct{}{}:
+			state.horizon = advance(next, p.window)
+		default:
+			p.skipped.Add(1)
+			start = false
+		}
+	}
+	p.streams[next] = state
+	p.mu.Unlock()
+
+	if !start {
+		return
+	}
+
+	p.triggered.Add(1)
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.sem
+			p.wg.Done()
+		}()
+		p.prefetch(next)
+	}()
+}
+
+// prefetch warms the cache with window addresses starting at start
+func (p *Prefetcher) prefetch(start netip.Addr) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	addr := start
+	for i := 0; i < p.window && addr.IsValid(); i++ {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if location, err := p.repository.FindLocation(ctx, addr); err == nil {
+			if p.cache.setPrefetched(addr.String(), location) {
+				p.prefetched.Add(1)
+			}
+		}
+		addr = addr.Next()
+	}
+}
+
+// advance returns the address n steps after addr, or the zero Addr on overflow
+func advance(addr netip.Addr, n int) netip.Addr {
+	for i := 0; i < n && addr.IsValid(); i++ {
+		addr = addr.Next()
+	}
+	return addr
+}
+
+// Wait blocks until in-flight prefetch batches finish
+func (p *Prefetcher) Wait() {
+	p.wg.Wait()
+}
+
+// Stats returns a snapshot of the prefetch counters
+func (p *Prefetcher) Stats() PrefetchStats {
+	stats := PrefetchStats{
+		Triggered:  p.triggered.Load(),
+		Skipped:    p.skipped.Load(),
+		Prefetched: p.prefetched.Load(),
+		Hits:       p.hits.Load(),
+		Wasted:     p.wasted.Load(),
+	}
+	if stats.Prefetched > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(stats.Prefetched)
+	}
+	return stats
+}
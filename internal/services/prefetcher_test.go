@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/models"
+)
+
+func newSequentialRepository(prefix string, count int) *MockRepository {
+	repo := NewMockRepository()
+	for i := 1; i <= count; i++ {
+		repo.SetLocation(fmt.Sprintf("%s.%d", prefix, i), &models.Location{
+			Country: "United States",
+			City:    fmt.Sprintf("City %d", i),
+		})
+	}
+	return repo
+}
+
+func TestPrefetcher_SequentialScan(t *testing.T) {
+	repo := newSequentialRepository("10.0.0", 50)
+	cache := NewLocationCache(100, 0)
+	prefetcher := NewPrefetcher(repo, cache, 3, 10)
+	service := NewIPServiceWithOptions(repo, ServiceOptions{Cache: cache, Prefetcher: prefetcher})
+
+	ctx := context.Background()
+	for i := 1; i <= 3; i++ {
+		if _, err := service.FindLocation(ctx, netip.MustParseAddr(fmt.Sprintf("10.0.0.%d", i))); err != nil {
+			t.Fatalf("FindLocation() error = %v", err)
+		}
+	}
+	prefetcher.Wait()
+
+	stats := prefetcher.Stats()
+	if stats.Triggered != 1 {
+		t.Errorf("Expected 1 prefetch batch, got %d", stats.Triggered)
+	}
+	if stats.Prefetched != 10 {
+		t.Errorf("Expected 10 prefetched entries, got %d", stats.Prefetched)
+	}
+
+	// The next addresses in the scan should be served from cache
+	for i := 4; i <= 8; i++ {
+		if _, err := service.FindLocation(ctx, netip.MustParseAddr(fmt.Sprintf("10.0.0.%d", i))); err != nil {
+			t.Fatalf("FindLocation() error = %v", err)
+		}
+	}
+	prefetcher.Wait()
+
+	stats = prefetcher.Stats()
+	if stats.Hits != 5 {
+		t.Errorf("Expected 5 prefetch hits, got %d", stats.Hits)
+	}
+	if stats.Triggered != 1 {
+		t.Errorf("Expected scan inside the warmed window not to re-trigger, got %d batches", stats.Triggered)
+	}
+	if stats.HitRatio != 0.5 {
+		t.Errorf("Expected hit ratio 0.5, got %v", stats.HitRatio)
+	}
+}
+
+func TestPrefetcher_RandomAccessDoesNotTrigger(t *testing.T) {
+	repo := newSequentialRepository("10.0.0", 50)
+	cache := NewLocationCache(100, 0)
+	prefetcher := NewPrefetcher(repo, cache, 3, 10)
+
+	for _, ip := range []string{"10.0.0.5", "10.0.0.1", "10.0.0.9", "10.0.0.2", "10.0.0.30"} {
+		prefetcher.Observe(netip.MustParseAddr(ip))
+	}
+	prefetcher.Wait()
+
+	if stats := prefetcher.Stats(); stats.Triggered != 0 {
+		t.Errorf("Expected no prefetch for random access, got %d batches", stats.Triggered)
+	}
+}
+
+func TestPrefetcher_InvalidIP(t *testing.T) {
+	repo := NewMockRepository()
+	prefetcher := NewPrefetcher(repo, NewLocationCache(10, 0), 1, 1)
+
+	prefetcher.Observe(netip.Addr{})
+	prefetcher.Observe(netip.MustParseAddr("255.255.255.255"))
+	prefetcher.Wait()
+
+	if stats := prefetcher.Stats(); stats.Triggered != 0 {
+		t.Errorf("Expected no prefetch, got %d batches", stats.Triggered)
+	}
+}
+
+// blockingRepository blocks FindLocation until released or the context ends, and counts calls
+type blockingRepository struct {
+	*MockRepository
+	release chan struct{}
+	mu      sync.Mutex
+	calls   int
+}
+
+func (b *blockingRepository) FindLocation(ctx context.Context, addr netip.Addr) (*models.Location, error) {
+	b.mu.Lock()
+	b.calls++
+	b.mu.Unlock()
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return b.MockRepository.FindLocation(ctx, addr)
+}
+
+func TestIPService_CoalescesConcurrentLookups(t *testing.T) {
+	repo := &blockingRepository{MockRepository: NewMockRepository(), release: make(chan struct{})}
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	service := NewIPServiceWithOptions(repo, ServiceOptions{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.FindLocation(context.Background(), netip.MustParseAddr("8.8.8.8")); err != nil {
+				t.Errorf("FindLocation() error = %v", err)
+			}
+		}()
+	}
+
+	// Give all goroutines time to join the in-flight call before releasing it
+	time.Sleep(50 * time.Millisecond)
+	close(repo.release)
+	wg.Wait()
+
+	if repo.calls != 1 {
+		t.Errorf("Expected 1 repository call, got %d", repo.calls)
+	}
+
+	stats := service.(LookupStatsProvider).LookupStats()
+	if stats.Coalesced != 4 {
+		t.Errorf("Expected 4 coalesced lookups, got %d", stats.Coalesced)
+	}
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"ip-geolocation-service/internal/repository"
+)
+
+// ErrListingUnsupported is returned when a dataset's records can't be enumerated
+var ErrListingUnsupported = errors.New("dataset does not support listing its records")
+
+// RecordSource is implemented by services whose data can be enumerated
+type RecordSource interface {
+	// Records returns every address and its location sorted by address, or false
+	// when the data can't be enumerated
+	Records() ([]repository.Record, bool)
+}
+
+// Records returns every address in the data behind the service, if the repository can list them
+func (s *IPServiceImpl) Records() ([]repository.Record, bool) {
+	if lister, ok := s.repository.(repository.RecordLister); ok {
+		return lister.Records(), true
+	}
+	return nil, false
+}
+
+// Records returns every address of the named dataset and its location, sorted by
+// address; an empty name selects the default dataset
+func (d *DatasetService) Records(name string) (DatasetInfo, []repository.Record, error) {
+	d.mu.RLock()
+	if name == "" {
+		name = d.defaultName
+	}
+	ds, exists := d.datasets[name]
+	d.mu.RUnlock()
+
+	if !exists {
+		return DatasetInfo{}, nil, fmt.Errorf("%w: %s", ErrUnknownDataset, name)
+	}
+	if source, ok := ds.service.(RecordSource); ok {
+		if records, ok := source.Records(); ok {
+			return ds.info, records, nil
+		}
+	}
+	return DatasetInfo{}, nil, fmt.Errorf("%w: %s", ErrListingUnsupported, name)
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"ip-geolocation-service/internal/models"
+)
+
+func TestDatasetService_Records(t *testing.T) {
+	repo := NewMockRepository()
+	repo.SetLocation("8.8.8.8", &models.Location{Country: "United States", City: "Mountain View"})
+	repo.SetLocation("1.1.1.1", &models.Location{Country: "Australia", City: "Sydney"})
+
+	datasets := NewDatasetService("v1", nil)
+	datasets.Add("v1", "v1.csv", NewIPService(repo), nil)
+
+	info, records, err := datasets.Records("")
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if info.Name != "v1" || len(records) != 2 || records[0].IP != "1.1.1.1" || records[1].Location.City != "Mountain View" {
+		t.Errorf("Records() = %+v, %+v", info, records)
+	}
+
+	if _, _, err := datasets.Records("missing"); !errors.Is(err, ErrUnknownDataset) {
+		t.Errorf("Records() for an unknown dataset error = %v, want ErrUnknownDataset", err)
+	}
+
+	// Services that can't enumerate their data can't be listed
+	datasets.Add("opaque", "opaque", NewDatasetService("", nil), nil)
+	if _, _, err := datasets.Records("opaque"); !errors.Is(err, ErrListingUnsupported) {
+		t.Errorf("Records() for an opaque dataset error = %v, want ErrListingUnsupported", err)
+	}
+}
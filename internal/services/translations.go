@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/requestcontext"
+)
+
+// DefaultLanguage is the language of the names stored in datasets
+const DefaultLanguage = "en"
+
+// languageKey carries the requested response language through the context
+var languageKey = requestcontext.NewKey[string]("language")
+
+// WithLanguage returns a context that asks for location names in lang (a BCP 47 tag)
+func WithLanguage(ctx context.Context, lang string) context.Context {
+	return languageKey.With(ctx, strings.ToLower(lang))
+}
+
+// LanguageFromContext returns the requested language, or "" when none was requested
+func LanguageFromContext(ctx context.Context) string {
+	lang, _ := languageKey.Value(ctx)
+	return lang
+}
+
+// Translations maps English country and city names to localized names per language
+type Translations struct {
+	names map[string]map[string]string // lang -> English name -> localized name
+}
+
+// TranslationsPath returns the translations file expected next to a dataset file:
+// data/ip_locations.csv -> data/ip_locations.translations.csv. A compressed dataset
+// (data/ip_locations.csv.gz) shares the uncompressed dataset's translations file.
+func TranslationsPath(source string) string {
+	for _, ext := range []string{".gz", ".zst"} {
+		source = strings.TrimSuffix(source, ext)
+	}
+	return strings.TrimSuffix(source, filepath.Ext(source)) + ".translations.csv"
+}
+
+// LoadTranslations reads a name,lang,translation CSV file. A missing file returns nil
+// translations and no error, since translations are optional.
+func LoadTranslations(path string) (*Translations, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open translations file %s: %w", path, err)
+	}
+	defer file.Close()
+	return readTranslations(file, path)
+}
+
+// LoadTranslationsFS reads a translations file from fsys, like LoadTranslations
+func LoadTranslationsFS(fsys fs.FS, path string) (*Translations, error) {
+	file, err := fsys.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open translations file %s: %w", path, err)
+	}
+	defer file.Close()
+	return readTranslations(file, path)
+}
+
+// readTranslations parses the translations file read from file
+func readTranslations(file io.Reader, path string) (*Translations, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 3
+
+	t := &Translations{names: make(map[string]map[string]string)}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("translations file %s: %w", path, err)
+		}
+		if line == 1 && record[0] == "name" {
+			continue // Header
+		}
+
+		name, lang, translation := strings.TrimSpace(record[0]), strings.ToLower(strings.TrimSpace(record[1])), strings.TrimSpace(record[2])
+		if name == "" || lang == "" || translation == "" {
+			return nil, fmt.Errorf("translations file %s: line %d: name, lang and translation are required", path, line)
+		}
+		if t.names[lang] == nil {
+			t.names[lang] = make(map[string]string)
+		}
+		t.names[lang][name] = translation
+	}
+	return t, nil
+}
+
+// Len returns the number of translated names across all languages
+func (t *Translations) Len() int {
+	count := 0
+	for _, names := range t.names {
+		count += len(names)
+	}
+	return count
+}
+
+// Localize returns a copy of location with names in lang, falling back from a regional
+// tag to its base language ("fr-ca" -> "fr") and then to English for each name. It also
+// returns the most specific language that supplied a name.
+func (t *Translations) Localize(location *models.Location, lang string) (*models.Location, string) {
+	chain := languageChain(lang)
+	best := len(chain) // Index in chain of the most specific language used
+
+	translate := func(name string) string {
+		for i, candidate := range chain {
+			if translation, ok := t.names[candidate][name]; ok {
+				best = min(best, i)
+				return translation
+			}
+		}
+		return name
+	}
+
+	localized := *location
+	localized.Country = translate(location.Country)
+	localized.City = translate(location.City)
+	if best == len(chain) {
+		return &localized, DefaultLanguage
+	}
+	return &localized, chain[best]
+}
+
+// languageChain lists lang and its progressively shorter prefixes: "zh-hant-tw" ->
+// ["zh-hant-tw", "zh-hant", "zh"]
+func languageChain(lang string) []string {
+	var chain []string
+	for lang != "" {
+		chain = append(chain, lang)
+		i := strings.LastIndexByte(lang, '-')
+		if i < 0 {
+			break
+		}
+		lang = lang[:i]
+	}
+	return chain
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"ip-geolocation-service/internal/models"
+)
+
+func writeTranslations(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ip_locations.translations.csv")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTranslations(t *testing.T) {
+	for _, source := range []string{"data/ip_locations.csv", "data/ip_locations.csv.gz", "data/ip_locations.csv.zst"} {
+		if got := TranslationsPath(source); got != "data/ip_locations.translations.csv" {
+			t.Errorf("TranslationsPath(%q) = %q", source, got)
+		}
+	}
+
+	translations, err := LoadTranslations(filepath.Join(t.TempDir(), "missing.csv"))
+	if err != nil || translations != nil {
+		t.Errorf("Expected a missing file to load no translations, got %v, %v", translations, err)
+	}
+
+	if _, err := LoadTranslations(writeTranslations(t, "name,lang,translation\nGermany,de,\n")); err == nil {
+		t.Error("Expected an empty translation to be rejected")
+	}
+
+	translations, err = LoadTranslations(writeTranslations(t, "name,lang,translation\nGermany,de,Deutschland\nGermany,FR,Allemagne\n"))
+	if err != nil {
+		t.Fatalf("LoadTranslations() error = %v", err)
+	}
+	if translations.Len() != 2 {
+		t.Errorf("Expected 2 translations, got %d", translations.Len())
+	}
+
+	fsys := fstest.MapFS{"ip_locations.translations.csv": {Data: []byte("name,lang,translation\nGermany,de,Deutschland\n")}}
+	if translations, err := LoadTranslationsFS(fsys, "ip_locations.translations.csv"); err != nil || translations.Len() != 1 {
+		t.Errorf("LoadTranslationsFS() = %v, %v", translations, err)
+	}
+	if translations, err := LoadTranslationsFS(fsys, "missing.csv"); err != nil || translations != nil {
+		t.Errorf("Expected a missing file to load no translations, got %v, %v", translations, err)
+	}
+}
+
+func TestTranslations_Localize(t *testing.T) {
+	translations, err := LoadTranslations(writeTranslations(t, `name,lang,translation
+Germany,de,Deutschland
+Munich,de,München
+Munich,de-at,München (AT)
+Germany,fr,Allemagne
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	location := &models.Location{Country: "Germany", City: "Munich", CountryCode: "DE"}
+
+	tests := []struct {
+		lang        string
+		wantCountry string
+		wantCity    string
+		wantLang    string
+	}{
+		{"de", "Deutschland", "München", "de"},
+		{"de-at", "Deutschland", "München (AT)", "de-at"},
+		{"de-ch", "Deutschland", "München", "de"},
+		{"fr", "Allemagne", "Munich", "fr"},
+		{"he", "Germany", "Munich", DefaultLanguage},
+	}
+	for _, tt := range tests {
+		localized, used := translations.Localize(location, tt.lang)
+		if localized.Country != tt.wantCountry || localized.City != tt.wantCity || used != tt.wantLang {
+			t.Errorf("Localize(%s) = %s/%s (%s), want %s/%s (%s)", tt.lang,
+				localized.Country, localized.City, used, tt.wantCountry, tt.wantCity, tt.wantLang)
+		}
+		if localized.CountryCode != "DE" {
+			t.Errorf("Localize(%s) dropped the country code", tt.lang)
+		}
+	}
+	if location.Country != "Germany" {
+		t.Error("Expected Localize to leave the original location untouched")
+	}
+}
+
+func TestIPService_Localization(t *testing.T) {
+	translations, err := LoadTranslations(writeTranslations(t, "name,lang,translation\nAustralia,fr,Australie\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := NewMockRepository()
+	fixture := locationFixture
+	repo.SetLocation("1.1.1.1", &fixture)
+	service := NewIPServiceWithOptions(repo, ServiceOptions{Cache: NewLocationCache(10, 0), Translations: translations})
+
+	// The second French lookup is served from the cache, which must keep English names
+	for i := 0; i < 2; i++ {
+		ctx, info := WithLookupInfo(WithLanguage(context.Background(), "fr"))
+		location, err := service.FindLocation(ctx, netip.MustParseAddr("1.1.1.1"))
+		if err != nil {
+			t.Fatalf("FindLocation() error = %v", err)
+		}
+		if location.Country != "Australie" || info.Language != "fr" {
+			t.Errorf("Lookup %d: got %s (%s), want Australie (fr)", i+1, location.Country, info.Language)
+		}
+	}
+
+	location, err := service.FindLocation(context.Background(), netip.MustParseAddr("1.1.1.1"))
+	if err != nil {
+		t.Fatalf("FindLocation() error = %v", err)
+	}
+	if location.Country != "Australia" {
+		t.Errorf("Expected English names without a language, got %s", location.Country)
+	}
+}
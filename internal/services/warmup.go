@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"ip-geolocation-service/internal/models"
+)
+
+// WarmUpResult reports a warm-up run
+type WarmUpResult struct {
+	Datasets int           // Datasets that were sampled
+	Lookups  int           // Lookups made across all datasets
+	Duration time.Duration // How long the run took
+	Complete bool          // Every dataset got its lookups before the context ended
+}
+
+// WarmUp makes count lookups in each loaded dataset, cycling through addresses
+// sampled from it, so the data is paged in and hot before traffic arrives. Lookups
+// bypass caches, which are left for real traffic. The run stops early when ctx ends;
+// datasets whose data can't be sampled are skipped.
+func (d *DatasetService) WarmUp(ctx context.Context, count int) WarmUpResult {
+	start := time.Now()
+	result := WarmUpResult{Complete: true}
+
+	d.mu.RLock()
+	samplers := make([]DatasetSampler, 0, len(d.datasets))
+	for _, ds := range d.datasets {
+		if sampler, ok := ds.service.(DatasetSampler); ok {
+			samplers = append(samplers, sampler)
+		}
+	}
+	d.mu.RUnlock()
+
+	for _, sampler := range samplers {
+		var addrs []netip.Addr
+		for _, ip := range sampler.SampleIPs(count) {
+			if addr, err := models.ParseIP(ip); err == nil {
+				addrs = append(addrs, addr)
+			}
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+		result.Datasets++
+
+		for i := 0; i < count; i++ {
+			if ctx.Err() != nil {
+				result.Complete = false
+				result.Duration = time.Since(start)
+				return result
+			}
+			sampler.LookupUncached(ctx, addrs[i%len(addrs)])
+			result.Lookups++
+		}
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
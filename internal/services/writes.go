@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/repository"
+)
+
+// ErrReadOnly is returned when writing through a service whose repository can't
+// persist changes
+var ErrReadOnly = errors.New("repository is read-only")
+
+// LocationWriter is implemented by services that can write to their repository.
+// Writable reports whether writes are supported; when it is false every write
+// returns ErrReadOnly.
+type LocationWriter interface {
+	Writable() bool
+	Upsert(ctx context.Context, addr netip.Addr, location models.Location) error
+	Delete(ctx context.Context, addr netip.Addr) error
+	BulkLoad(ctx context.Context, records []repository.Record) error
+	Flush(ctx context.Context) error
+}
+
+// Writable reports whether the repository implements repository.WritableRepository
+func (s *IPServiceImpl) Writable() bool {
+	_, ok := s.repository.(repository.WritableRepository)
+	return ok
+}
+
+// Upsert stores the location for addr and drops its cached answer. Addresses are
+// normalized as FindLocation does, so a write is seen by the lookups it affects.
+func (s *IPServiceImpl) Upsert(ctx context.Context, addr netip.Addr, location models.Location) error {
+	writable, ok := s.repository.(repository.WritableRepository)
+	if !ok {
+		return ErrReadOnly
+	}
+	if !addr.IsValid() {
+		return fmt.Errorf("%w: IP address cannot be empty", models.ErrInvalidIP)
+	}
+
+	addr = addr.Unmap()
+	if err := writable.Upsert(ctx, addr, location); err != nil {
+		return err
+	}
+	s.invalidate(addr)
+	return nil
+}
+
+// Delete removes addr and drops its cached answer
+func (s *IPServiceImpl) Delete(ctx context.Context, addr netip.Addr) error {
+	writable, ok := s.repository.(repository.WritableRepository)
+	if !ok {
+		return ErrReadOnly
+	}
+	if !addr.IsValid() {
+		return fmt.Errorf("%w: IP address cannot be empty", models.ErrInvalidIP)
+	}
+
+	addr = addr.Unmap()
+	if err := writable.Delete(ctx, addr); err != nil {
+		return err
+	}
+	s.invalidate(addr)
+	return nil
+}
+
+// BulkLoad replaces the repository's data with records and empties the cache
+func (s *IPServiceImpl) BulkLoad(ctx context.Context, records []repository.Record) error {
+	writable, ok := s.repository.(repository.WritableRepository)
+	if !ok {
+		return ErrReadOnly
+	}
+	if err := writable.BulkLoad(ctx, records); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		s.cache.Purge()
+	}
+	return nil
+}
+
+// Flush persists pending writes to the repository's backing store
+func (s *IPServiceImpl) Flush(ctx context.Context) error {
+	writable, ok := s.repository.(repository.WritableRepository)
+	if !ok {
+		return ErrReadOnly
+	}
+	return writable.Flush(ctx)
+}
+
+// invalidate drops the cached answer for a normalized IP address
+func (s *IPServiceImpl) invalidate(addr netip.Addr) {
+	if s.cache != nil {
+		s.cache.Delete(s.lookupKey(addr.String()))
+	}
+}
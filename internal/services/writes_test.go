@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/repository"
+)
+
+func TestIPService_Writes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "writable.csv")
+	if err := os.WriteFile(path, []byte("ip,city,country\n1.1.1.1,New York,United States\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	repo := repository.NewFileRepository(&config.DatabaseConfig{Type: "csv", FilePath: path}, slog.Default())
+	ctx := context.Background()
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	cache := NewLocationCache(10, time.Minute)
+	service := NewIPServiceWithOptions(repo, ServiceOptions{Cache: cache}).(*IPServiceImpl)
+	if !service.Writable() {
+		t.Fatal("Expected a file-backed service to be writable")
+	}
+
+	// Warm the cache, then check writes aren't hidden by it
+	if _, err := service.FindLocation(ctx, netip.MustParseAddr("1.1.1.1")); err != nil {
+		t.Fatalf("FindLocation() error = %v", err)
+	}
+	// Written through its mapped form, like a lookup of it would be normalized
+	if err := service.Upsert(ctx, netip.MustParseAddr("::ffff:1.1.1.1"), models.Location{Country: "France", City: "Paris"}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if location, err := service.FindLocation(ctx, netip.MustParseAddr("1.1.1.1")); err != nil || location.City != "Paris" {
+		t.Errorf("FindLocation() after Upsert = %v, %v", location, err)
+	}
+
+	if err := service.Delete(ctx, netip.MustParseAddr("1.1.1.1")); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := service.FindLocation(ctx, netip.MustParseAddr("1.1.1.1")); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("FindLocation() after Delete error = %v, want ErrNotFound", err)
+	}
+
+	records := []repository.Record{{IP: "8.8.8.8", Location: models.Location{Country: "United States", City: "Mountain View"}}}
+	if err := service.BulkLoad(ctx, records); err != nil {
+		t.Fatalf("BulkLoad() error = %v", err)
+	}
+	if cache.Stats().Size != 0 {
+		t.Error("Expected BulkLoad to purge the cache")
+	}
+	if err := service.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+}
+
+func TestIPService_Writes_ReadOnly(t *testing.T) {
+	service := NewIPService(NewMockRepository()).(*IPServiceImpl)
+	ctx := context.Background()
+
+	if service.Writable() {
+		t.Error("Expected a read-only repository to be reported as such")
+	}
+	if err := service.Upsert(ctx, netip.MustParseAddr("1.1.1.1"), models.Location{Country: "France", City: "Paris"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Upsert() error = %v, want ErrReadOnly", err)
+	}
+	if err := service.Flush(ctx); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Flush() error = %v, want ErrReadOnly", err)
+	}
+}
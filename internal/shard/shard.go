@@ -0,0 +1,147 @@
+// Package shard maps addresses to the instances of a sharded deployment, where each
+// instance holds a partition of the dataset. Instances are placed on a consistent
+// hash ring, so adding or removing one only moves the addresses next to it. The ring
+// is published to clients, which hash an address the same way to send follow-up
+// queries straight to the instance holding it.
+package shard
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Response headers naming the shard of the queried address
+const (
+	KeyHeader   = "X-Shard-Key" // Position of the address on the ring
+	OwnerHeader = "X-Shard"     // Instance whose partition holds the address
+)
+
+// Virtual node bounds; more points per instance spread addresses more evenly
+const (
+	DefaultVirtualNodes = 64
+	MaxVirtualNodes     = 1024
+)
+
+// Hash names how keys and tokens are computed, for clients reimplementing it: the
+// first four bytes, big-endian, of the SHA-256 of the canonical address, or of
+// "<node>#<i>" for the i-th virtual node of an instance
+const Hash = "sha256-32"
+
+// Node is an instance of the deployment
+type Node struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Point is a virtual node: the addresses whose key falls after the previous point, up
+// to and including Token, belong to Node
+type Point struct {
+	Token uint32 `json:"token"`
+	Node  string `json:"node"`
+}
+
+// Map is the ring as published by /v1/shard-map
+type Map struct {
+	Self         string  `json:"self"` // Instance that answered
+	Hash         string  `json:"hash"`
+	VirtualNodes int     `json:"virtual_nodes"`
+	Nodes        []Node  `json:"nodes"`
+	Ring         []Point `json:"ring"` // Sorted by token; keys past the last wrap to the first
+}
+
+// Ring is a consistent hash ring of instances
+type Ring struct {
+	self   string
+	vnodes int
+	nodes  map[string]Node
+	names  []string // Sorted
+	points []Point  // Sorted by token, then node
+}
+
+// New builds the ring of nodes (name -> base URL) as seen from the instance self
+func New(nodes map[string]string, self string, vnodes int) (*Ring, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("shard ring needs at least one node")
+	}
+	if vnodes <= 0 || vnodes > MaxVirtualNodes {
+		return nil, fmt.Errorf("shard virtual nodes must be between 1 and %d, got %d", MaxVirtualNodes, vnodes)
+	}
+	if _, ok := nodes[self]; !ok {
+		return nil, fmt.Errorf("shard %q is not one of the shard nodes", self)
+	}
+
+	r := &Ring{self: self, vnodes: vnodes, nodes: make(map[string]Node, len(nodes))}
+	for name, base := range nodes {
+		u, err := url.Parse(base)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("shard %s: URL must be an absolute http or https URL, got %q", name, base)
+		}
+		r.nodes[name] = Node{Name: name, URL: strings.TrimSuffix(base, "/")}
+		r.names = append(r.names, name)
+		for i := range vnodes {
+			r.points = append(r.points, Point{Token: hash(name + "#" + strconv.Itoa(i)), Node: name})
+		}
+	}
+	slices.Sort(r.names)
+	// Ties between tokens are broken by name, so every client orders the ring the same way
+	slices.SortFunc(r.points, func(a, b Point) int {
+		return cmp.Or(cmp.Compare(a.Token, b.Token), strings.Compare(a.Node, b.Node))
+	})
+	return r, nil
+}
+
+// hash returns the first four bytes of the SHA-256 of s
+func hash(s string) uint32 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// Key returns the position of addr on the ring
+func Key(addr netip.Addr) uint32 {
+	return hash(addr.Unmap().String())
+}
+
+// Owner returns the instance holding the addresses at key: the node of the first
+// point at or after it, wrapping around the ring
+func (r *Ring) Owner(key uint32) Node {
+	i, _ := slices.BinarySearchFunc(r.points, key, func(p Point, key uint32) int {
+		return cmp.Compare(p.Token, key)
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.nodes[r.points[i].Node]
+}
+
+// Locate returns the key of addr and the instance holding it
+func (r *Ring) Locate(addr netip.Addr) (uint32, Node) {
+	key := Key(addr)
+	return key, r.Owner(key)
+}
+
+// Self returns the name of this instance
+func (r *Ring) Self() string {
+	return r.self
+}
+
+// Map returns the ring for publishing
+func (r *Ring) Map() Map {
+	nodes := make([]Node, 0, len(r.names))
+	for _, name := range r.names {
+		nodes = append(nodes, r.nodes[name])
+	}
+	return Map{
+		Self:         r.self,
+		Hash:         Hash,
+		VirtualNodes: r.vnodes,
+		Nodes:        nodes,
+		Ring:         slices.Clone(r.points),
+	}
+}
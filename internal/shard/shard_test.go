@@ -0,0 +1,131 @@
+package shard
+
+import (
+	"cmp"
+	"maps"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+var testNodes = map[string]string{
+	"a": "http://geo-a:8080",
+	"b": "http://geo-b:8080/",
+	"c": "https://geo-c.internal",
+}
+
+// testAddrs returns n distinct IPv4 addresses
+func testAddrs(n int) []netip.Addr {
+	addrs := make([]netip.Addr, n)
+	for i := range addrs {
+		addrs[i] = netip.AddrFrom4([4]byte{10, byte(i >> 16), byte(i >> 8), byte(i)})
+	}
+	return addrs
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		nodes  map[string]string
+		self   string
+		vnodes int
+	}{
+		{"no nodes", nil, "a", DefaultVirtualNodes},
+		{"self not a node", testNodes, "d", DefaultVirtualNodes},
+		{"no virtual nodes", testNodes, "a", 0},
+		{"too many virtual nodes", testNodes, "a", MaxVirtualNodes + 1},
+		{"relative URL", map[string]string{"a": "geo-a:8080"}, "a", DefaultVirtualNodes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.nodes, tt.self, tt.vnodes); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestRing_Map(t *testing.T) {
+	ring, err := New(testNodes, "b", 16)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	m := ring.Map()
+	if m.Self != "b" || m.Hash != Hash || m.VirtualNodes != 16 {
+		t.Errorf("Map() = self %q, hash %q, %d virtual nodes", m.Self, m.Hash, m.VirtualNodes)
+	}
+	want := []Node{{"a", "http://geo-a:8080"}, {"b", "http://geo-b:8080"}, {"c", "https://geo-c.internal"}}
+	if !slices.Equal(m.Nodes, want) {
+		t.Errorf("Nodes = %v, want %v", m.Nodes, want)
+	}
+	if len(m.Ring) != 3*16 || !slices.IsSortedFunc(m.Ring, func(a, b Point) int { return cmp.Compare(a.Token, b.Token) }) {
+		t.Errorf("Expected 48 points sorted by token, got %v", m.Ring)
+	}
+
+	// A key at a point belongs to it, and keys past the last point wrap to the first
+	for _, p := range m.Ring[:3] {
+		if owner := ring.Owner(p.Token); owner.Name != p.Node {
+			t.Errorf("Owner(%d) = %s, want %s", p.Token, owner.Name, p.Node)
+		}
+	}
+	if last := m.Ring[len(m.Ring)-1]; last.Token < ^uint32(0) {
+		if owner := ring.Owner(last.Token + 1); owner.Name != m.Ring[0].Node {
+			t.Errorf("Owner past the last point = %s, want %s", owner.Name, m.Ring[0].Node)
+		}
+	}
+}
+
+func TestRing_Locate(t *testing.T) {
+	ring, err := New(testNodes, "a", DefaultVirtualNodes)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// Mapped addresses hash like the IPv4 address they carry
+	key, owner := ring.Locate(netip.MustParseAddr("8.8.8.8"))
+	if mappedKey, mappedOwner := ring.Locate(netip.MustParseAddr("::ffff:8.8.8.8")); mappedKey != key || mappedOwner != owner {
+		t.Errorf("Locate(::ffff:8.8.8.8) = %d %s, want %d %s", mappedKey, mappedOwner.Name, key, owner.Name)
+	}
+
+	// Addresses spread over every node
+	counts := make(map[string]int)
+	addrs := testAddrs(30000)
+	for _, addr := range addrs {
+		_, owner := ring.Locate(addr)
+		counts[owner.Name]++
+	}
+	for name := range testNodes {
+		if share := float64(counts[name]) / float64(len(addrs)); share < 0.2 || share > 0.47 {
+			t.Errorf("Node %s holds %.0f%% of the addresses, want a roughly even share", name, share*100)
+		}
+	}
+}
+
+func TestRing_AddingANodeOnlyMovesAddressesToIt(t *testing.T) {
+	before, err := New(testNodes, "a", DefaultVirtualNodes)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	grown := map[string]string{"d": "http://geo-d:8080"}
+	maps.Copy(grown, testNodes)
+	after, err := New(grown, "a", DefaultVirtualNodes)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	moved := 0
+	for _, addr := range testAddrs(10000) {
+		_, was := before.Locate(addr)
+		_, is := after.Locate(addr)
+		if was != is {
+			moved++
+			if is.Name != "d" {
+				t.Fatalf("%s moved from %s to %s, want only moves to the new node", addr, was.Name, is.Name)
+			}
+		}
+	}
+	if moved == 0 {
+		t.Error("Expected the new node to take over some addresses")
+	}
+}
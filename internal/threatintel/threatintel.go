@@ -0,0 +1,143 @@
+// Package threatintel flags addresses that belong to anonymizing services (Tor exit
+// nodes, VPNs, open proxies) using pluggable providers.
+package threatintel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Provider reports whether an address belongs to an anonymizing service
+type Provider interface {
+	// Name identifies the provider in responses and logs, e.g. "tor"
+	Name() string
+	IsAnonymizer(addr netip.Addr) bool
+}
+
+// Result is the combined verdict of every provider
+type Result struct {
+	IsAnonymizer bool
+	Sources      []string // Names of the providers that flagged the address
+}
+
+// Checker consults a set of providers
+type Checker struct {
+	providers []Provider
+}
+
+// NewChecker creates a checker over providers
+func NewChecker(providers ...Provider) *Checker {
+	return &Checker{providers: providers}
+}
+
+// Check asks every provider about addr
+func (c *Checker) Check(addr netip.Addr) Result {
+	addr = addr.Unmap()
+	var result Result
+	for _, provider := range c.providers {
+		if provider.IsAnonymizer(addr) {
+			result.IsAnonymizer = true
+			result.Sources = append(result.Sources, provider.Name())
+		}
+	}
+	return result
+}
+
+// AddressSet is an immutable set of addresses and prefixes
+type AddressSet struct {
+	addrs    map[netip.Addr]struct{}
+	prefixes []netip.Prefix
+}
+
+// Contains reports whether addr is in the set
+func (s *AddressSet) Contains(addr netip.Addr) bool {
+	if _, ok := s.addrs[addr]; ok {
+		return true
+	}
+	for _, prefix := range s.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of addresses and prefixes in the set
+func (s *AddressSet) Len() int {
+	return len(s.addrs) + len(s.prefixes)
+}
+
+// ParseAddressList reads one IP or CIDR per line. Blank lines, "#" comments and
+// lines that don't start with an address are skipped; for lines of the form
+// "ExitAddress 1.2.3.4 ..." (Tor's exit-addresses format) the address is used.
+func ParseAddressList(r io.Reader) (*AddressSet, error) {
+	set := &AddressSet{addrs: make(map[netip.Addr]struct{})}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		value := fields[0]
+		if value == "ExitAddress" && len(fields) > 1 {
+			value = fields[1]
+		}
+
+		if strings.Contains(value, "/") {
+			if prefix, err := netip.ParsePrefix(value); err == nil {
+				set.prefixes = append(set.prefixes, prefix.Masked())
+			}
+			continue
+		}
+		if addr, err := netip.ParseAddr(value); err == nil {
+			set.addrs[addr.Unmap()] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// StaticList is a provider backed by a file of addresses and CIDR ranges, e.g. a
+// commercial VPN/proxy export
+type StaticList struct {
+	name string
+	set  atomic.Pointer[AddressSet]
+}
+
+// LoadStaticList reads a provider list from path
+func LoadStaticList(name, path string) (*StaticList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s list %s: %w", name, path, err)
+	}
+	defer file.Close()
+
+	set, err := ParseAddressList(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s list %s: %w", name, path, err)
+	}
+
+	list := &StaticList{name: name}
+	list.set.Store(set)
+	return list, nil
+}
+
+// Name returns the provider name
+func (l *StaticList) Name() string { return l.name }
+
+// IsAnonymizer reports whether addr is on the list
+func (l *StaticList) IsAnonymizer(addr netip.Addr) bool {
+	return l.set.Load().Contains(addr)
+}
+
+// Len returns the number of entries on the list
+func (l *StaticList) Len() int {
+	return l.set.Load().Len()
+}
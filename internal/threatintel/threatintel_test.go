@@ -0,0 +1,103 @@
+package threatintel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAddressList(t *testing.T) {
+	set, err := ParseAddressList(strings.NewReader(`# VPN ranges
+185.220.101.1
+ExitAddress 199.249.230.87 2026-10-15 12:00:00
+10.8.0.0/16
+2a0b:f4c2::/40
+
+not-an-address
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ip := range []string{"185.220.101.1", "199.249.230.87", "10.8.200.1", "2a0b:f4c2:2::1"} {
+		if !set.Contains(netip.MustParseAddr(ip)) {
+			t.Errorf("Expected %s to be on the list", ip)
+		}
+	}
+	if set.Contains(netip.MustParseAddr("8.8.8.8")) {
+		t.Error("Expected 8.8.8.8 not to be on the list")
+	}
+	if set.Len() != 4 {
+		t.Errorf("Expected 4 entries, got %d", set.Len())
+	}
+}
+
+func TestChecker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vpn.txt")
+	if err := os.WriteFile(path, []byte("203.0.113.0/24\n198.51.100.7\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	vpn, err := LoadStaticList("vpn", path)
+	if err != nil {
+		t.Fatalf("LoadStaticList() error = %v", err)
+	}
+	proxy, err := LoadStaticList("proxy", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := NewChecker(vpn, proxy)
+
+	result := checker.Check(netip.MustParseAddr("::ffff:203.0.113.9"))
+	if !result.IsAnonymizer || !reflect.DeepEqual(result.Sources, []string{"vpn", "proxy"}) {
+		t.Errorf("Check() = %+v, want flagged by vpn and proxy", result)
+	}
+	if result := checker.Check(netip.MustParseAddr("8.8.8.8")); result.IsAnonymizer || result.Sources != nil {
+		t.Errorf("Check(8.8.8.8) = %+v, want clean", result)
+	}
+
+	if _, err := LoadStaticList("vpn", filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Expected an error for a missing list")
+	}
+}
+
+func TestTorExitList_Refresh(t *testing.T) {
+	body := "185.220.101.1\n185.220.101.2\n"
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	tor := NewTorExitList(server.URL, 0, nil)
+	exit := netip.MustParseAddr("185.220.101.2")
+	if tor.IsAnonymizer(exit) {
+		t.Error("Expected nothing to be flagged before the first download")
+	}
+
+	if err := tor.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if !tor.IsAnonymizer(exit) || tor.Len() != 2 {
+		t.Errorf("Expected 2 exits including %s, got %d", exit, tor.Len())
+	}
+
+	// Failed or empty downloads keep the previous list
+	status = http.StatusInternalServerError
+	if err := tor.Refresh(context.Background()); err == nil {
+		t.Error("Expected an error for a failed download")
+	}
+	status, body = http.StatusOK, ""
+	if err := tor.Refresh(context.Background()); err == nil {
+		t.Error("Expected an error for an empty list")
+	}
+	if !tor.IsAnonymizer(exit) || tor.failures.Load() != 2 {
+		t.Errorf("Expected previous list to be kept and 2 failures counted, got %d failures", tor.failures.Load())
+	}
+}
@@ -0,0 +1,137 @@
+package threatintel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// Tor exit list defaults
+const (
+	DefaultTorExitListURL = "https://check.torproject.org/torbulkexitlist"
+	DefaultTorRefresh     = time.Hour
+
+	// maxTorListBytes bounds the downloaded list (the real list is well under 1MB)
+	maxTorListBytes = 16 << 20
+)
+
+// TorExitList is a provider that periodically downloads the Tor Project's list of
+// exit node addresses. Until the first successful download it flags nothing.
+type TorExitList struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	set         atomic.Pointer[AddressSet]
+	lastSuccess atomic.Int64 // Unix seconds
+	failures    atomic.Uint64
+}
+
+// NewTorExitList creates a downloader for url, refreshed every refresh and fetched
+// through transport (nil uses http.DefaultTransport)
+func NewTorExitList(url string, refresh time.Duration, transport http.RoundTripper) *TorExitList {
+	if url == "" {
+		url = DefaultTorExitListURL
+	}
+	if refresh <= 0 {
+		refresh = DefaultTorRefresh
+	}
+
+	list := &TorExitList{
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}
+	list.set.Store(&AddressSet{})
+	return list
+}
+
+// Name returns the provider name
+func (t *TorExitList) Name() string { return "tor" }
+
+// IsAnonymizer reports whether addr is a known Tor exit node
+func (t *TorExitList) IsAnonymizer(addr netip.Addr) bool {
+	return t.set.Load().Contains(addr)
+}
+
+// Len returns the number of known exit nodes
+func (t *TorExitList) Len() int {
+	return t.set.Load().Len()
+}
+
+// Refresh downloads the exit list and replaces the current one. On failure the
+// previous list is kept.
+func (t *TorExitList) Refresh(ctx context.Context) error {
+	set, err := t.download(ctx)
+	if err != nil {
+		t.failures.Add(1)
+		return err
+	}
+	t.set.Store(set)
+	t.lastSuccess.Store(time.Now().Unix())
+	return nil
+}
+
+// download fetches and parses the exit list
+func (t *TorExitList) download(ctx context.Context) (*AddressSet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download Tor exit list: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download Tor exit list: status %d", resp.StatusCode)
+	}
+
+	set, err := ParseAddressList(io.LimitReader(resp.Body, maxTorListBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Tor exit list: %w", err)
+	}
+	// An empty list is almost certainly a broken download rather than no exits
+	if set.Len() == 0 {
+		return nil, fmt.Errorf("downloaded Tor exit list is empty")
+	}
+	return set, nil
+}
+
+// Run refreshes the list immediately and then on every interval until ctx is done.
+// Failures are passed to onError (which may be nil).
+func (t *TorExitList) Run(ctx context.Context, onError func(error)) {
+	ticker := time.NewTicker(t.refresh)
+	defer ticker.Stop()
+
+	for {
+		if err := t.Refresh(ctx); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RegisterMetrics exposes Tor exit list metrics on the registry
+func (t *TorExitList) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("ipgeo_threat_intel_tor_exit_nodes",
+		"Tor exit node addresses currently known",
+		func() float64 { return float64(t.Len()) })
+	registry.NewGaugeFunc("ipgeo_threat_intel_tor_last_success_timestamp_seconds",
+		"Unix time of the last successful Tor exit list download",
+		func() float64 { return float64(t.lastSuccess.Load()) })
+	registry.NewCounterFunc("ipgeo_threat_intel_tor_refresh_failures_total",
+		"Failed Tor exit list downloads",
+		func() float64 { return float64(t.failures.Load()) })
+}
@@ -0,0 +1,208 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+)
+
+// Export formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Sink receives usage reports
+type Sink interface {
+	Export(ctx context.Context, report Report) error
+}
+
+// FileSink writes each report to its own file in a directory, named after the
+// window start (usage-20260310T120000Z.csv)
+type FileSink struct {
+	dir    string
+	format string
+}
+
+// NewFileSink creates a sink writing reports to dir in format (csv or json)
+func NewFileSink(dir, format string) (*FileSink, error) {
+	if format != FormatCSV && format != FormatJSON {
+		return nil, fmt.Errorf("unsupported usage export format: %s", format)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create usage export directory: %w", err)
+	}
+	return &FileSink{dir: dir, format: format}, nil
+}
+
+// Export writes report to a new file, replacing it atomically if it exists
+func (s *FileSink) Export(ctx context.Context, report Report) error {
+	var buf bytes.Buffer
+	if s.format == FormatJSON {
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode usage report: %w", err)
+		}
+	} else {
+		writer := csv.NewWriter(&buf)
+		writer.Write([]string{"window_start", "window_end", "client", "requests", "succeeded", "failed"})
+		start, end := report.WindowStart.Format(time.RFC3339), report.WindowEnd.Format(time.RFC3339)
+		for _, line := range report.Clients {
+			writer.Write([]string{
+				start, end, line.Client,
+				strconv.FormatUint(line.Requests, 10),
+				strconv.FormatUint(line.Succeeded, 10),
+				strconv.FormatUint(line.Failed, 10),
+			})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("failed to encode usage report: %w", err)
+		}
+	}
+
+	name := filepath.Join(s.dir, "usage-"+report.WindowStart.UTC().Format("20060102T150405Z")+"."+s.format)
+	tmp, err := os.CreateTemp(s.dir, ".usage-*")
+	if err != nil {
+		return fmt.Errorf("failed to write usage report: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write usage report: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write usage report: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to write usage report: %w", err)
+	}
+	return nil
+}
+
+// HTTPSink POSTs each report as JSON to an endpoint
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink creates a sink posting reports to url through transport (nil uses
+// http.DefaultTransport)
+func NewHTTPSink(url string, timeout time.Duration, transport http.RoundTripper) *HTTPSink {
+	return &HTTPSink{url: url, client: &http.Client{Timeout: timeout, Transport: transport}}
+}
+
+// Export posts report; any non-2xx response is a failure
+func (s *HTTPSink) Export(ctx context.Context, report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode usage report: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push usage report: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to push usage report: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Exporter periodically cuts the recorder's window and sends the report to every
+// sink. A report that any sink rejects is put back into the recorder and sent
+// again with the next window, so counts are never dropped; a sink that did accept
+// it may then see those counts twice.
+type Exporter struct {
+	recorder *Recorder
+	sinks    []Sink
+	interval time.Duration
+
+	exports  atomic.Uint64
+	failures atomic.Uint64
+	lastOK   atomic.Int64
+}
+
+// NewExporter creates an exporter sending recorder's usage to sinks every interval
+func NewExporter(recorder *Recorder, interval time.Duration, sinks ...Sink) *Exporter {
+	return &Exporter{recorder: recorder, sinks: sinks, interval: interval}
+}
+
+// Export sends the current window's usage to every sink. Empty windows are skipped.
+func (e *Exporter) Export(ctx context.Context) error {
+	report := e.recorder.Cut()
+	if len(report.Clients) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, sink := range e.sinks {
+		if err := sink.Export(ctx, report); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		e.failures.Add(1)
+		e.recorder.Restore(report)
+		return err
+	}
+
+	e.exports.Add(1)
+	e.lastOK.Store(time.Now().Unix())
+	return nil
+}
+
+// Run exports every interval until ctx is cancelled, reporting failures to onError.
+// Callers should Export once more after Run returns so the last window isn't lost.
+func (e *Exporter) Run(ctx context.Context, onError func(error)) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Export(ctx); err != nil && onError != nil && ctx.Err() == nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// RegisterMetrics exposes export health on the registry
+func (e *Exporter) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewCounterFunc("ipgeo_usage_exports_total",
+		"Total usage reports exported",
+		func() float64 { return float64(e.exports.Load()) })
+	registry.NewCounterFunc("ipgeo_usage_export_failures_total",
+		"Total usage exports that failed and were retried with the next window",
+		func() float64 { return float64(e.failures.Load()) })
+	registry.NewGaugeFunc("ipgeo_usage_last_export_timestamp_seconds",
+		"Unix time of the last successful usage export",
+		func() float64 { return float64(e.lastOK.Load()) })
+	registry.NewGaugeFunc("ipgeo_usage_pending_clients",
+		"Clients with usage not yet exported",
+		func() float64 { return float64(e.recorder.Clients()) })
+}
@@ -0,0 +1,104 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReport() Report {
+	start := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	return Report{
+		WindowStart: start,
+		WindowEnd:   start.Add(time.Hour),
+		Clients:     []ClientUsage{{Client: "key:0a1b", Counts: Counts{Requests: 5, Succeeded: 4, Failed: 1}}},
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			sink, err := NewFileSink(dir, format)
+			if err != nil {
+				t.Fatalf("NewFileSink() error = %v", err)
+			}
+			if err := sink.Export(context.Background(), testReport()); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "usage-20260310T120000Z."+format))
+			if err != nil {
+				t.Fatalf("Report file not written: %v", err)
+			}
+			want := "2026-03-10T12:00:00Z,2026-03-10T13:00:00Z,key:0a1b,5,4,1"
+			if format == FormatJSON {
+				want = `"client": "key:0a1b"`
+			}
+			if !strings.Contains(string(data), want) {
+				t.Errorf("Report file = %s, want it to contain %s", data, want)
+			}
+		})
+	}
+
+	if _, err := NewFileSink(t.TempDir(), "xml"); err == nil {
+		t.Error("NewFileSink() with unknown format expected error")
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var received Report
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	if err := NewHTTPSink(server.URL, time.Second, nil).Export(context.Background(), testReport()); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if len(received.Clients) != 1 || received.Clients[0].Requests != 5 {
+		t.Errorf("Received report = %+v", received)
+	}
+}
+
+func TestExporter_RetriesFailedWindow(t *testing.T) {
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	recorder := NewRecorder()
+	exporter := NewExporter(recorder, time.Hour, NewHTTPSink(server.URL, time.Second, nil))
+
+	if err := exporter.Export(context.Background()); err != nil {
+		t.Errorf("Export() of an empty window error = %v", err)
+	}
+
+	recorder.Record("key:a", 200)
+	if err := exporter.Export(context.Background()); err == nil {
+		t.Fatal("Export() expected error from failing endpoint")
+	}
+	if recorder.Clients() != 1 {
+		t.Fatalf("Failed export lost usage: %d pending clients", recorder.Clients())
+	}
+
+	fail = false
+	if err := exporter.Export(context.Background()); err != nil {
+		t.Fatalf("Export() retry error = %v", err)
+	}
+	if recorder.Clients() != 0 || exporter.exports.Load() != 1 || exporter.failures.Load() != 1 {
+		t.Errorf("After retry: pending=%d exports=%d failures=%d", recorder.Clients(), exporter.exports.Load(), exporter.failures.Load())
+	}
+}
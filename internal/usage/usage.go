@@ -0,0 +1,113 @@
+// Package usage aggregates per-client request counts and exports them
+// periodically for billing.
+package usage
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Counts holds one client's requests within an export window
+type Counts struct {
+	Requests  uint64 `json:"requests"`
+	Succeeded uint64 `json:"succeeded"` // Responses with a status below 400
+	Failed    uint64 `json:"failed"`
+}
+
+func (c *Counts) add(other Counts) {
+	c.Requests += other.Requests
+	c.Succeeded += other.Succeeded
+	c.Failed += other.Failed
+}
+
+// ClientUsage is one client's line in a report
+type ClientUsage struct {
+	Client string `json:"client"`
+	Counts
+}
+
+// Report is the usage of every client seen during one window
+type Report struct {
+	WindowStart time.Time     `json:"window_start"`
+	WindowEnd   time.Time     `json:"window_end"`
+	Clients     []ClientUsage `json:"clients"`
+}
+
+// Recorder counts requests per client for the current window
+type Recorder struct {
+	mu      sync.Mutex
+	counts  map[string]*Counts
+	started time.Time
+	now     func() time.Time
+}
+
+// NewRecorder creates a recorder whose first window starts now
+func NewRecorder() *Recorder {
+	return &Recorder{
+		counts:  make(map[string]*Counts),
+		started: time.Now().UTC(),
+		now:     time.Now,
+	}
+}
+
+// Record counts one request for client that completed with status
+func (r *Recorder) Record(client string, status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts, exists := r.counts[client]
+	if !exists {
+		counts = &Counts{}
+		r.counts[client] = counts
+	}
+	counts.Requests++
+	if status < 400 {
+		counts.Succeeded++
+	} else {
+		counts.Failed++
+	}
+}
+
+// Clients returns the number of clients seen in the current window
+func (r *Recorder) Clients() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.counts)
+}
+
+// Cut closes the current window and returns its report, sorted by client
+func (r *Recorder) Cut() Report {
+	r.mu.Lock()
+	counts := r.counts
+	report := Report{WindowStart: r.started, WindowEnd: r.now().UTC()}
+	r.counts = make(map[string]*Counts)
+	r.started = report.WindowEnd
+	r.mu.Unlock()
+
+	report.Clients = make([]ClientUsage, 0, len(counts))
+	for client, c := range counts {
+		report.Clients = append(report.Clients, ClientUsage{Client: client, Counts: *c})
+	}
+	sort.Slice(report.Clients, func(i, j int) bool { return report.Clients[i].Client < report.Clients[j].Client })
+	return report
+}
+
+// Restore puts the counts of a report that could not be exported back into the
+// current window, which is extended to start at the report's start
+func (r *Recorder) Restore(report Report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, line := range report.Clients {
+		counts, exists := r.counts[line.Client]
+		if !exists {
+			counts = &Counts{}
+			r.counts[line.Client] = counts
+		}
+		counts.add(line.Counts)
+	}
+	if report.WindowStart.Before(r.started) {
+		r.started = report.WindowStart
+	}
+}
@@ -0,0 +1,42 @@
+package usage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecorder_CutAndRestore(t *testing.T) {
+	recorder := NewRecorder()
+	recorder.Record("key:b", 200)
+	recorder.Record("key:a", 200)
+	recorder.Record("key:a", 404)
+
+	report := recorder.Cut()
+	want := []ClientUsage{
+		{Client: "key:a", Counts: Counts{Requests: 2, Succeeded: 1, Failed: 1}},
+		{Client: "key:b", Counts: Counts{Requests: 1, Succeeded: 1}},
+	}
+	if len(report.Clients) != len(want) {
+		t.Fatalf("Cut() clients = %+v, want %+v", report.Clients, want)
+	}
+	for i := range want {
+		if report.Clients[i] != want[i] {
+			t.Errorf("Cut() client %d = %+v, want %+v", i, report.Clients[i], want[i])
+		}
+	}
+	if recorder.Clients() != 0 {
+		t.Error("Cut() did not start a new window")
+	}
+
+	// A failed export goes back into the next window
+	time.Sleep(time.Millisecond)
+	recorder.Record("key:a", 200)
+	recorder.Restore(report)
+	next := recorder.Cut()
+	if !next.WindowStart.Equal(report.WindowStart) {
+		t.Errorf("Restored window starts at %v, want %v", next.WindowStart, report.WindowStart)
+	}
+	if next.Clients[0].Requests != 3 || next.Clients[1].Requests != 1 {
+		t.Errorf("Restored counts = %+v", next.Clients)
+	}
+}
@@ -0,0 +1,223 @@
+// Package watchdog probes the service from the inside. At a fixed interval it sends a
+// synthetic lookup through the public handler, with its full middleware chain, and
+// marks the instance degraded when lookups keep failing or running slow. This catches
+// what a health probe doesn't exercise, such as a middleware stalling or a backend
+// that answers /health but not lookups.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/middleware"
+)
+
+// Probe outcomes
+const (
+	ResultOK     = "ok"
+	ResultSlow   = "slow"   // Answered, but over the latency threshold
+	ResultFailed = "failed" // Timed out or answered with an unexpected status
+)
+
+// RemoteAddr is the client address probes are sent from, so they can be told apart
+// from real traffic, for instance exempted from rate limiting by CIDR
+const RemoteAddr = "127.0.0.1:0"
+
+// UserAgent identifies probes in request logs
+const UserAgent = "ipgeo-watchdog"
+
+// Config tunes the watchdog
+type Config struct {
+	Interval  time.Duration // Time between probes
+	Timeout   time.Duration // Longest a probe may take before it counts as failed
+	Threshold time.Duration // Latency over which a probe counts as slow
+	Failures  int           // Consecutive bad probes that mark the instance degraded, and good ones that clear it
+	Path      string        // Lookup sent by each probe, e.g. /v1/find-country?ip=8.8.8.8
+	APIKey    string        // Sent as X-API-Key when authentication is required
+}
+
+// ProbePath returns the lookup path of ip under basePath
+func ProbePath(basePath, ip string) string {
+	return strings.TrimSuffix(basePath, "/") + "/v1/find-country?ip=" + url.QueryEscape(ip)
+}
+
+// Result is the outcome of one probe
+type Result struct {
+	Time       time.Time `json:"time"`
+	DurationMS float64   `json:"duration_ms"`
+	Status     int       `json:"status,omitempty"` // HTTP status, 0 when the probe timed out
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// State is a snapshot of the watchdog
+type State struct {
+	Degraded  bool       `json:"degraded"`
+	Since     *time.Time `json:"since,omitempty"` // When the instance was marked degraded
+	LastProbe *Result    `json:"last_probe,omitempty"`
+}
+
+// Watchdog runs the probes and keeps the degraded flag
+type Watchdog struct {
+	cfg Config
+
+	mu       sync.RWMutex
+	degraded bool
+	since    time.Time
+	last     *Result
+	bad      int // Consecutive slow or failed probes
+	good     int // Consecutive probes that passed while degraded
+
+	degradedGauge *metrics.Gauge
+	duration      *metrics.Histogram
+	probes        *metrics.CounterVec
+}
+
+// New creates a watchdog; Failures below 1 is taken as 1
+func New(cfg Config) *Watchdog {
+	cfg.Failures = max(cfg.Failures, 1)
+	return &Watchdog{cfg: cfg}
+}
+
+// Degraded reports whether recent probes kept failing or running slow
+func (w *Watchdog) Degraded() bool {
+	if w == nil {
+		return false
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.degraded
+}
+
+// State returns the degraded flag and the last probe
+func (w *Watchdog) State() State {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	state := State{Degraded: w.degraded}
+	if w.degraded {
+		since := w.since
+		state.Since = &since
+	}
+	if w.last != nil {
+		last := *w.last
+		state.LastProbe = &last
+	}
+	return state
+}
+
+// Run probes handler every interval until ctx is done. onChange is called with the
+// new state whenever the instance becomes degraded or recovers.
+func (w *Watchdog) Run(ctx context.Context, handler http.Handler, onChange func(State)) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if w.record(w.Probe(ctx, handler)) && onChange != nil {
+				onChange(w.State())
+			}
+		}
+	}
+}
+
+// Probe sends one lookup through handler and classifies the answer. A lookup that
+// finds no location still passed through the whole stack, so 404 counts as ok.
+func (w *Watchdog) Probe(ctx context.Context, handler http.Handler) Result {
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, w.cfg.Path, nil).WithContext(ctx)
+	req.RemoteAddr = RemoteAddr
+	req.Header.Set("User-Agent", UserAgent)
+	if w.cfg.APIKey != "" {
+		req.Header.Set(middleware.APIKeyHeader, w.cfg.APIKey)
+	}
+
+	// The handler runs apart so a stalled request can't stall the watchdog
+	start := time.Now()
+	recorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(recorder, req)
+	}()
+
+	result := Result{Time: start}
+	select {
+	case <-done:
+		result.Status = recorder.Code
+	case <-ctx.Done():
+	}
+	elapsed := time.Since(start)
+	result.DurationMS = float64(elapsed.Microseconds()) / 1000
+
+	switch {
+	case result.Status == 0:
+		result.Result, result.Error = ResultFailed, fmt.Sprintf("no answer within %v", w.cfg.Timeout)
+	case result.Status != http.StatusOK && result.Status != http.StatusNotFound:
+		result.Result, result.Error = ResultFailed, fmt.Sprintf("unexpected status %d", result.Status)
+	case elapsed > w.cfg.Threshold:
+		result.Result, result.Error = ResultSlow, fmt.Sprintf("took longer than %v", w.cfg.Threshold)
+	default:
+		result.Result = ResultOK
+	}
+	return result
+}
+
+// record counts a probe and reports whether the degraded flag changed
+func (w *Watchdog) record(result Result) bool {
+	if w.duration != nil {
+		w.duration.Observe(result.DurationMS / 1000)
+		w.probes.Inc(result.Result)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.last = &result
+	changed := false
+	if result.Result == ResultOK {
+		w.bad = 0
+		if w.degraded {
+			if w.good++; w.good >= w.cfg.Failures {
+				w.degraded, w.since, w.good = false, time.Time{}, 0
+				changed = true
+			}
+		}
+	} else {
+		w.good = 0
+		if w.bad++; w.bad >= w.cfg.Failures && !w.degraded {
+			w.degraded, w.since = true, result.Time
+			changed = true
+		}
+	}
+	if changed && w.degradedGauge != nil {
+		w.degradedGauge.Set(boolFloat(w.degraded))
+	}
+	return changed
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// RegisterMetrics exposes the degraded flag and probe outcomes on the registry
+func (w *Watchdog) RegisterMetrics(registry *metrics.Registry) {
+	w.degradedGauge = registry.NewGauge("ipgeo_watchdog_degraded", "Whether synthetic lookups keep failing or running slow (1) or not (0)")
+	w.duration = registry.NewHistogram("ipgeo_watchdog_probe_duration_seconds", "Latency of synthetic lookups through the full stack", nil)
+	w.probes = registry.NewCounterVec("ipgeo_watchdog_probes_total", "Synthetic lookups by outcome (ok, slow or failed)", []string{"result"})
+}
@@ -0,0 +1,160 @@
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"ip-geolocation-service/internal/metrics"
+	"ip-geolocation-service/internal/middleware"
+)
+
+func testConfig() Config {
+	return Config{
+		Interval:  time.Millisecond,
+		Timeout:   100 * time.Millisecond,
+		Threshold: 50 * time.Millisecond,
+		Failures:  2,
+		Path:      ProbePath("/api/", "8.8.8.8"),
+		APIKey:    "probe-key",
+	}
+}
+
+func TestProbePath(t *testing.T) {
+	if got, want := ProbePath("", "2001:db8::1"), "/v1/find-country?ip=2001%3Adb8%3A%3A1"; got != want {
+		t.Errorf("ProbePath() = %q, want %q", got, want)
+	}
+	if got, want := ProbePath("/api/", "8.8.8.8"), "/api/v1/find-country?ip=8.8.8.8"; got != want {
+		t.Errorf("ProbePath() = %q, want %q", got, want)
+	}
+}
+
+func TestWatchdog_Probe(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+		status  int
+	}{
+		{"found", func(w http.ResponseWriter, r *http.Request) {}, ResultOK, http.StatusOK},
+		{"not found", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) }, ResultOK, http.StatusNotFound},
+		{"server error", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }, ResultFailed, http.StatusInternalServerError},
+		{"slow", func(w http.ResponseWriter, r *http.Request) { time.Sleep(60 * time.Millisecond) }, ResultSlow, http.StatusOK},
+		{"stalled", func(w http.ResponseWriter, r *http.Request) { <-release }, ResultFailed, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := New(testConfig()).Probe(context.Background(), tt.handler)
+			if result.Result != tt.want || result.Status != tt.status {
+				t.Errorf("Probe() = %s with status %d, want %s with status %d", result.Result, result.Status, tt.want, tt.status)
+			}
+			if (tt.want == ResultOK) != (result.Error == "") {
+				t.Errorf("Probe() error = %q for result %s", result.Error, result.Result)
+			}
+		})
+	}
+}
+
+func TestWatchdog_ProbeRequest(t *testing.T) {
+	var got *http.Request
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r })
+
+	New(testConfig()).Probe(context.Background(), handler)
+	if got == nil {
+		t.Fatal("Expected the handler to receive the probe")
+	}
+	if got.URL.Path != "/api/v1/find-country" || got.URL.Query().Get("ip") != "8.8.8.8" {
+		t.Errorf("Probe sent %s, want /api/v1/find-country?ip=8.8.8.8", got.URL)
+	}
+	if got.RemoteAddr != RemoteAddr || got.UserAgent() != UserAgent {
+		t.Errorf("Probe sent from %s as %q, want %s as %q", got.RemoteAddr, got.UserAgent(), RemoteAddr, UserAgent)
+	}
+	if key := got.Header.Get(middleware.APIKeyHeader); key != "probe-key" {
+		t.Errorf("Probe sent API key %q, want probe-key", key)
+	}
+}
+
+func TestWatchdog_DegradesAndRecovers(t *testing.T) {
+	w := New(testConfig())
+	steps := []struct {
+		result   string
+		changed  bool
+		degraded bool
+	}{
+		{ResultSlow, false, false},
+		{ResultOK, false, false}, // A good probe resets the run of bad ones
+		{ResultFailed, false, false},
+		{ResultSlow, true, true},
+		{ResultFailed, false, true},
+		{ResultOK, false, true},
+		{ResultOK, true, false},
+	}
+
+	for i, step := range steps {
+		changed := w.record(Result{Time: time.Now(), Result: step.result})
+		if changed != step.changed || w.Degraded() != step.degraded {
+			t.Fatalf("Step %d (%s): changed %v, degraded %v, want %v, %v", i, step.result, changed, w.Degraded(), step.changed, step.degraded)
+		}
+		state := w.State()
+		if state.LastProbe == nil || state.LastProbe.Result != step.result {
+			t.Errorf("Step %d: LastProbe = %+v, want %s", i, state.LastProbe, step.result)
+		}
+		if (state.Since != nil) != step.degraded {
+			t.Errorf("Step %d: Since = %v with degraded %v", i, state.Since, step.degraded)
+		}
+	}
+}
+
+func TestWatchdog_Run(t *testing.T) {
+	w := New(testConfig())
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan State, 1)
+	go w.Run(ctx, handler, func(state State) {
+		select {
+		case changes <- state:
+		default:
+		}
+	})
+
+	select {
+	case state := <-changes:
+		if !state.Degraded || state.LastProbe == nil || state.LastProbe.Status != http.StatusServiceUnavailable {
+			t.Errorf("onChange got %+v, want a degraded state after 503s", state)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the watchdog to report degradation")
+	}
+}
+
+func TestWatchdog_RegisterMetrics(t *testing.T) {
+	w := New(testConfig())
+	registry := metrics.NewRegistry()
+	w.RegisterMetrics(registry)
+
+	w.record(Result{Result: ResultOK, DurationMS: 3})
+	w.record(Result{Result: ResultFailed})
+	w.record(Result{Result: ResultSlow, DurationMS: 80})
+
+	var buf bytes.Buffer
+	registry.Write(&buf)
+	for _, want := range []string{
+		"ipgeo_watchdog_degraded 1",
+		`ipgeo_watchdog_probes_total{result="ok"} 1`,
+		`ipgeo_watchdog_probes_total{result="failed"} 1`,
+		"ipgeo_watchdog_probe_duration_seconds_count 3",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package xlsx
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Columns maps dataset fields to header names in the sheet, matched ignoring case
+// and surrounding spaces. Latitude and Longitude are optional: coordinates are
+// converted when the sheet has both columns.
+type Columns struct {
+	IP        string
+	City      string
+	Country   string
+	Latitude  string
+	Longitude string
+}
+
+// DefaultColumns matches a sheet laid out like a CSV dataset
+var DefaultColumns = Columns{IP: "ip", City: "city", Country: "country", Latitude: "latitude", Longitude: "longitude"}
+
+// ConvertStats counts the rows converted from a sheet
+type ConvertStats struct {
+	Rows      int  // Data rows written
+	Empty     int  // Rows without any dataset field, skipped
+	HasCoords bool // Latitude and longitude columns were written
+}
+
+// Convert reads the first sheet of an xlsx workbook, whose first non-empty row is
+// the header, and writes its rows to w as a CSV dataset (ip,city,country[,latitude,
+// longitude]). Rows aren't validated here; the dataset loader checks them as it
+// does any CSV file.
+func Convert(filePath string, columns Columns, w io.Writer) (ConvertStats, error) {
+	var stats ConvertStats
+	writer := csv.NewWriter(w)
+	var indices []int // Sheet column of each dataset field, in dataset order
+	record := make([]string, 0, 5)
+
+	err := ReadFirstSheet(filePath, func(line int, row []string) error {
+		if indices == nil {
+			if len(row) == 0 {
+				return nil
+			}
+			var err error
+			if indices, err = headerIndices(row, columns); err != nil {
+				return fmt.Errorf("row %d: %w", line, err)
+			}
+			stats.HasCoords = len(indices) == 5
+			header := []string{"ip", "city", "country", "latitude", "longitude"}
+			return writer.Write(header[:len(indices)])
+		}
+
+		record = record[:0]
+		empty := true
+		for i, col := range indices {
+			value := ""
+			if col < len(row) {
+				value = strings.TrimSpace(row[col])
+			}
+			if i >= 3 {
+				value = normalizeNumber(value)
+			}
+			record = append(record, value)
+			empty = empty && value == ""
+		}
+		if empty {
+			stats.Empty++
+			return nil
+		}
+		stats.Rows++
+		return writer.Write(record)
+	})
+	if err != nil {
+		return stats, err
+	}
+	if indices == nil {
+		return stats, errors.New("the first sheet is empty")
+	}
+
+	writer.Flush()
+	return stats, writer.Error()
+}
+
+// headerIndices locates the dataset columns in the header row
+func headerIndices(header []string, columns Columns) ([]int, error) {
+	find := func(name string) int {
+		for i, cell := range header {
+			if name != "" && strings.EqualFold(strings.TrimSpace(cell), strings.TrimSpace(name)) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	var indices []int
+	for _, name := range []string{columns.IP, columns.City, columns.Country} {
+		i := find(name)
+		if i < 0 {
+			return nil, fmt.Errorf("header has no %q column", name)
+		}
+		indices = append(indices, i)
+	}
+
+	lat, lon := find(columns.Latitude), find(columns.Longitude)
+	switch {
+	case lat >= 0 && lon >= 0:
+		indices = append(indices, lat, lon)
+	case lat >= 0 || lon >= 0:
+		return nil, fmt.Errorf("header needs both %q and %q columns for coordinates", columns.Latitude, columns.Longitude)
+	}
+	return indices, nil
+}
+
+// normalizeNumber writes a number stored by Excel in its shortest form, so binary
+// noise such as 37.386099999999999 becomes 37.3861. Other text is kept as is.
+func normalizeNumber(value string) string {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,315 @@
+// Package xlsx reads the cell values of an Excel (.xlsx) workbook's first worksheet
+// using only the standard library, so spreadsheets handed over by operations teams
+// can be converted into datasets.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Workbook bounds
+const (
+	// MaxColumns is the widest row Excel can store (column XFD)
+	MaxColumns = 16384
+	// maxPartBytes bounds each decompressed part of the workbook
+	maxPartBytes = 1 << 30
+)
+
+// ErrInvalidWorkbook is returned (wrapped) for files that aren't readable workbooks
+var ErrInvalidWorkbook = errors.New("invalid xlsx workbook")
+
+// relationshipsNS is the namespace of the r:id attribute linking a sheet to its part
+const relationshipsNS = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+
+// ReadFirstSheet calls fn with the values of each row of the workbook's first
+// worksheet, in order. Empty cells are empty strings; trailing empty cells are
+// dropped, and rows missing from the sheet aren't reported. line is the row's
+// number in the sheet, and row is only valid during the call. Numbers are returned
+// as stored, booleans as TRUE or FALSE.
+func ReadFirstSheet(filePath string, fn func(line int, row []string) error) error {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWorkbook, err)
+	}
+	defer archive.Close()
+
+	parts := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		parts[file.Name] = file
+	}
+
+	sheetPath, err := firstSheetPath(parts)
+	if err != nil {
+		return err
+	}
+	var shared []string
+	if file, ok := parts["xl/sharedStrings.xml"]; ok {
+		if shared, err = readSharedStrings(file); err != nil {
+			return err
+		}
+	}
+
+	sheet, ok := parts[sheetPath]
+	if !ok {
+		return fmt.Errorf("%w: missing worksheet %s", ErrInvalidWorkbook, sheetPath)
+	}
+	return readSheet(sheet, shared, fn)
+}
+
+// openPart opens a part of the workbook for decoding
+func openPart(file *zip.File) (*xml.Decoder, io.Closer, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: %v", ErrInvalidWorkbook, file.Name, err)
+	}
+	return xml.NewDecoder(io.LimitReader(rc, maxPartBytes)), rc, nil
+}
+
+// firstSheetPath finds the part holding the first sheet listed in the workbook
+func firstSheetPath(parts map[string]*zip.File) (string, error) {
+	workbook, ok := parts["xl/workbook.xml"]
+	if !ok {
+		return "", fmt.Errorf("%w: missing xl/workbook.xml", ErrInvalidWorkbook)
+	}
+	var wb struct {
+		Sheets []struct {
+			Name string     `xml:"name,attr"`
+			Attr []xml.Attr `xml:",any,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodePart(workbook, &wb); err != nil {
+		return "", err
+	}
+	if len(wb.Sheets) == 0 {
+		return "", fmt.Errorf("%w: the workbook has no sheets", ErrInvalidWorkbook)
+	}
+	var id string
+	for _, attr := range wb.Sheets[0].Attr {
+		if attr.Name.Space == relationshipsNS && attr.Name.Local == "id" {
+			id = attr.Value
+		}
+	}
+
+	rels, ok := parts["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return "", fmt.Errorf("%w: missing xl/_rels/workbook.xml.rels", ErrInvalidWorkbook)
+	}
+	var relationships struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodePart(rels, &relationships); err != nil {
+		return "", err
+	}
+	for _, rel := range relationships.Relationships {
+		if rel.ID != id {
+			continue
+		}
+		// Targets are relative to xl/ unless they start at the package root
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "", fmt.Errorf("%w: sheet %q has no worksheet part", ErrInvalidWorkbook, wb.Sheets[0].Name)
+}
+
+// decodePart unmarshals a whole (small) part of the workbook
+func decodePart(file *zip.File, v interface{}) error {
+	decoder, closer, err := openPart(file)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidWorkbook, file.Name, err)
+	}
+	return nil
+}
+
+// readSharedStrings reads the table that string cells index into. Rich text runs
+// are joined; phonetic hints are left out.
+func readSharedStrings(file *zip.File) ([]string, error) {
+	decoder, closer, err := openPart(file)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	var shared []string
+	var text strings.Builder
+	inPhonetic := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return shared, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidWorkbook, file.Name, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				text.Reset()
+			case "rPh":
+				inPhonetic = true
+			case "t":
+				if inPhonetic {
+					continue
+				}
+				var s string
+				if err := decoder.DecodeElement(&s, &t); err != nil {
+					return nil, fmt.Errorf("%w: %s: %v", ErrInvalidWorkbook, file.Name, err)
+				}
+				text.WriteString(s)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				shared = append(shared, text.String())
+			case "rPh":
+				inPhonetic = false
+			}
+		}
+	}
+}
+
+// readSheet streams the rows of a worksheet part to fn
+func readSheet(file *zip.File, shared []string, fn func(line int, row []string) error) error {
+	decoder, closer, err := openPart(file)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	var row []string
+	line := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidWorkbook, file.Name, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row = row[:0]
+				line++
+				if r := attr(t, "r"); r != "" {
+					if line, err = strconv.Atoi(r); err != nil {
+						return fmt.Errorf("%w: invalid row number %q", ErrInvalidWorkbook, r)
+					}
+				}
+			case "c":
+				var c cell
+				if err := decoder.DecodeElement(&c, &t); err != nil {
+					return fmt.Errorf("%w: row %d: %v", ErrInvalidWorkbook, line, err)
+				}
+				col := len(row)
+				if c.Ref != "" {
+					if col, err = columnIndex(c.Ref); err != nil {
+						return fmt.Errorf("%w: row %d: %v", ErrInvalidWorkbook, line, err)
+					}
+				}
+				if col < len(row) || col >= MaxColumns {
+					return fmt.Errorf("%w: row %d: cell %s out of order", ErrInvalidWorkbook, line, c.Ref)
+				}
+				value, err := c.value(shared)
+				if err != nil {
+					return fmt.Errorf("%w: row %d: %v", ErrInvalidWorkbook, line, err)
+				}
+				for len(row) < col {
+					row = append(row, "")
+				}
+				row = append(row, value)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				for len(row) > 0 && row[len(row)-1] == "" {
+					row = row[:len(row)-1]
+				}
+				if err := fn(line, row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// cell is a <c> element of a worksheet
+type cell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"is"`
+}
+
+// value returns the cell's text
+func (c *cell) value(shared []string) (string, error) {
+	switch c.Type {
+	case "s":
+		idx, err := strconv.Atoi(c.Value)
+		if err != nil || idx < 0 || idx >= len(shared) {
+			return "", fmt.Errorf("cell %s: invalid shared string %q", c.Ref, c.Value)
+		}
+		return shared[idx], nil
+	case "inlineStr":
+		text := c.Inline.Text
+		for _, run := range c.Inline.Runs {
+			text += run.Text
+		}
+		return text, nil
+	case "b":
+		if c.Value == "1" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	default: // n (number), str (formula result), e (error)
+		return c.Value, nil
+	}
+}
+
+// columnIndex returns the zero-based column of a cell reference such as "AB12"
+func columnIndex(ref string) (int, error) {
+	col := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		col = col*26 + int(ref[i]-'A'+1)
+		if col > MaxColumns {
+			return 0, fmt.Errorf("cell %s is beyond the last column", ref)
+		}
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+// attr returns the value of an element's attribute
+func attr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeWorkbook writes a minimal workbook whose first sheet is sheetXML
+func writeWorkbook(t *testing.T, sheetXML, sharedXML string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "book.xlsx")
+	file, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Data" sheetId="1" r:id="rId7"/><sheet name="Notes" sheetId="2" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId7" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>
+</Relationships>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>wrong sheet</t></is></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": sheetXML,
+	}
+	if sharedXML != "" {
+		parts["xl/sharedStrings.xml"] = sharedXML
+	}
+
+	archive := zip.NewWriter(file)
+	for name, content := range parts {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+const testShared = `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>IP Address</t></si><si><t>City</t></si><si><t>Country</t></si>
+<si><r><t>Mountain </t></r><r><t>View</t></r></si>
+<si><t>東京</t><rPh><t>トウキョウ</t></rPh></si>
+</sst>`
+
+const testSheet = `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="E1" t="inlineStr"><is><t>Lat</t></is></c><c r="F1" t="inlineStr"><is><t>Lon</t></is></c></row>
+<row r="2"><c r="A2" t="inlineStr"><is><t>8.8.8.8</t></is></c><c r="B2" t="s"><v>3</v></c><c r="C2" t="inlineStr"><is><t>United States</t></is></c><c r="E2"><v>37.386099999999999</v></c><c r="F2"><v>-122.0838</v></c></row>
+<row r="4"><c r="A4" t="inlineStr"><is><t>1.0.16.1</t></is></c><c r="B4" t="s"><v>4</v></c><c r="C4" t="inlineStr"><is><t>Japan</t></is></c></row>
+<row r="5"><c r="D5" t="b"><v>1</v></c></row>
+</sheetData></worksheet>`
+
+func TestReadFirstSheet(t *testing.T) {
+	filePath := writeWorkbook(t, testSheet, testShared)
+
+	var got []string
+	err := ReadFirstSheet(filePath, func(line int, row []string) error {
+		got = append(got, strings.Join(append([]string{strconv.Itoa(line)}, row...), "|"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"1|IP Address|City|Country||Lat|Lon",
+		"2|8.8.8.8|Mountain View|United States||37.386099999999999|-122.0838",
+		"4|1.0.16.1|東京|Japan",
+		"5||||TRUE",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Rows:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestReadFirstSheet_Invalid(t *testing.T) {
+	notZip := filepath.Join(t.TempDir(), "book.xlsx")
+	if err := os.WriteFile(notZip, []byte("ip,city,country\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outOfRange := writeWorkbook(t, `<worksheet><sheetData><row r="1"><c r="A1" t="s"><v>9</v></c></row></sheetData></worksheet>`, testShared)
+
+	for _, filePath := range []string{notZip, outOfRange} {
+		err := ReadFirstSheet(filePath, func(int, []string) error { return nil })
+		if !errors.Is(err, ErrInvalidWorkbook) {
+			t.Errorf("%s: expected ErrInvalidWorkbook, got %v", filePath, err)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	filePath := writeWorkbook(t, testSheet, testShared)
+	columns := Columns{IP: "ip address", City: "City", Country: "COUNTRY", Latitude: "lat", Longitude: "lon"}
+
+	var out bytes.Buffer
+	stats, err := Convert(filePath, columns, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ip,city,country,latitude,longitude\n" +
+		"8.8.8.8,Mountain View,United States,37.3861,-122.0838\n" +
+		"1.0.16.1,東京,Japan,,\n"
+	if out.String() != want {
+		t.Errorf("Convert() wrote:\n%s\nwant:\n%s", out.String(), want)
+	}
+	if stats.Rows != 2 || stats.Empty != 1 || !stats.HasCoords {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// Without coordinate columns only the required fields are written
+	out.Reset()
+	if _, err := Convert(filePath, Columns{IP: "IP Address", City: "City", Country: "Country"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "ip,city,country\n8.8.8.8,Mountain View,United States\n") {
+		t.Errorf("Convert() without coordinates wrote:\n%s", out.String())
+	}
+
+	if _, err := Convert(filePath, DefaultColumns, &out); err == nil || !strings.Contains(err.Error(), `no "ip" column`) {
+		t.Errorf("Expected a missing column error, got %v", err)
+	}
+}
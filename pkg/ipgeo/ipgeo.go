@@ -0,0 +1,146 @@
+// Package ipgeo runs the IP geolocation service as a library, for teams that mount
+// its API into an existing server instead of running the standalone binary.
+//
+// A Server is built from the same configuration as the binary and exposes its
+// handlers, with their full middleware stack, and the lookup service behind them:
+//
+//	cfg, err := ipgeo.LoadConfig()
+//	if err != nil {
+//		return err
+//	}
+//	geo, err := ipgeo.NewServer(cfg)
+//	if err != nil {
+//		return err
+//	}
+//	defer geo.Close()
+//	geo.Start()
+//	mux.Handle("/v1/", geo.Handler())
+package ipgeo
+
+import (
+	"net/http"
+	"net/netip"
+	"os"
+
+	"ip-geolocation-service/internal/app"
+	"ip-geolocation-service/internal/config"
+	"ip-geolocation-service/internal/models"
+	"ip-geolocation-service/internal/secrets"
+	"ip-geolocation-service/internal/services"
+)
+
+// Config configures a Server; see the README for every setting and its environment variable
+type Config = config.Config
+
+// IPService looks up the location of an address
+type IPService = services.IPService
+
+// Location is the result of a lookup
+type Location = models.Location
+
+// SecretsProvider fetches credentials from an external secret manager, such as AWS
+// Secrets Manager, for "secret:name#field" settings
+type SecretsProvider = secrets.Provider
+
+// Errors returned by IPService lookups and ParseIP, wrapped with detail; classify
+// them with errors.Is. A lookup that runs out of time wraps context.DeadlineExceeded.
+var (
+	ErrNotFound         = services.ErrNotFound         // The dataset has no location for the address
+	ErrInvalidIP        = services.ErrInvalidIP        // The input isn't an accepted IP address
+	ErrNonCanonicalIPv4 = services.ErrNonCanonicalIPv4 // An ErrInvalidIP for IPv4 octets with leading zeros or hex
+	ErrNonCanonicalIP   = services.ErrNonCanonicalIP   // An ErrInvalidIP for a non-canonical spelling in strict mode
+	ErrInvalidLocation  = services.ErrInvalidLocation  // The dataset holds location data that fails validation
+	ErrUnknownDataset   = services.ErrUnknownDataset   // The requested dataset isn't loaded
+	ErrDatasetLoading   = services.ErrDatasetLoading   // The requested dataset is still loading
+)
+
+// LoadConfig loads and validates the configuration from environment variables,
+// like the standalone binary does. GOMAXPROCS and GOMEMLIMIT belong to the host
+// program, so they are fitted to the container only when AUTO_GOMAXPROCS or
+// AUTO_GOMEMLIMIT is set.
+func LoadConfig() (*Config, error) {
+	return embedded(config.LoadConfig())
+}
+
+// LoadConfigWithSecrets loads the configuration like LoadConfig, resolving secret
+// references through provider. Rotation hooks can then be added on cfg.Secrets.Store.
+func LoadConfigWithSecrets(provider SecretsProvider) (*Config, error) {
+	return embedded(config.LoadConfigWithProvider(provider))
+}
+
+// embedded turns off the runtime settings the host program didn't opt into
+func embedded(cfg *Config, err error) (*Config, error) {
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := os.LookupEnv("AUTO_GOMAXPROCS"); !ok {
+		cfg.Runtime.AutoMaxProcs = false
+	}
+	if _, ok := os.LookupEnv("AUTO_GOMEMLIMIT"); !ok {
+		cfg.Runtime.AutoMemoryLimit = false
+	}
+	return cfg, nil
+}
+
+// ParseIP parses an address into the form IPService lookups take
+func ParseIP(ip string) (netip.Addr, error) {
+	return models.ParseIP(ip)
+}
+
+// Server is the geolocation service with its datasets loaded, ready to be mounted
+type Server struct {
+	app *app.App
+}
+
+// NewServer loads the configured datasets and builds the handlers. It doesn't
+// listen on any port; mount Handler into your own server.
+func NewServer(cfg *Config) (*Server, error) {
+	a, err := app.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{app: a}, nil
+}
+
+// Handler loads the configured datasets, starts the background tasks and returns
+// the API handler, for hosts that only need to mount it. With BASE_PATH set, e.g.
+// to /geo, it serves the routes under that prefix, as forwarded unchanged by a
+// gateway, so it can be mounted with mux.Handle("/geo/", handler). The service
+// runs for the life of the process; use NewServer to close it.
+func Handler(cfg *Config) (http.Handler, error) {
+	s, err := NewServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.Start()
+	return s.Handler(), nil
+}
+
+// Handler returns the API handler with its middleware. It serves the operational
+// endpoints too unless ADMIN_PORT is set, in which case they are on AdminHandler.
+func (s *Server) Handler() http.Handler {
+	return s.app.Handler()
+}
+
+// AdminHandler returns the operational endpoints handler when ADMIN_PORT is set,
+// or nil when Handler serves them
+func (s *Server) AdminHandler() http.Handler {
+	return s.app.AdminHandler()
+}
+
+// Service returns the lookup service, for callers that look up addresses directly
+func (s *Server) Service() IPService {
+	return s.app.Service()
+}
+
+// Start starts the background tasks: feature flag and threat list reloads, usage
+// and report exports, and the startup warm-up. Lookups work without it.
+func (s *Server) Start() {
+	s.app.StartBackground()
+}
+
+// Close stops the background tasks, flushes pending exports and closes the datasets.
+// The handlers must no longer be serving requests.
+func (s *Server) Close() error {
+	return s.app.Stop()
+}
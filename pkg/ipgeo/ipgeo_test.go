@@ -0,0 +1,160 @@
+package ipgeo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestServer_MountedHandler(t *testing.T) {
+	t.Setenv("DATABASE_FILE_PATH", "../../data/ip_locations.csv")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	geo, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer geo.Close()
+	geo.Start()
+
+	// Mounted next to the host application's own routes
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("app"))
+	})
+	mux.Handle("/v1/", geo.Handler())
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/find-country?ip=8.8.8.8", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "United States") {
+		t.Errorf("Expected the lookup result, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/app", nil))
+	if w.Body.String() != "app" {
+		t.Errorf("Expected the host route to be untouched, got %q", w.Body.String())
+	}
+
+	if geo.AdminHandler() != nil {
+		t.Error("Expected no admin handler without ADMIN_PORT")
+	}
+}
+
+func TestServer_Service(t *testing.T) {
+	t.Setenv("DATABASE_FILE_PATH", "../../data/ip_locations.csv")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	geo, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer geo.Close()
+
+	addr, err := ParseIP("1.1.1.1")
+	if err != nil {
+		t.Fatalf("ParseIP: %v", err)
+	}
+	location, err := geo.Service().FindLocation(context.Background(), addr)
+	if err != nil {
+		t.Fatalf("FindLocation: %v", err)
+	}
+	if location.City != "Los Angeles" {
+		t.Errorf("Expected Los Angeles, got %q", location.City)
+	}
+
+	if _, err := geo.Service().FindLocation(context.Background(), netip.MustParseAddr("192.0.2.255")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindLocation() of an unknown address error = %v, want ErrNotFound", err)
+	}
+	if _, err := ParseIP("8.8.8.010"); !errors.Is(err, ErrInvalidIP) || !errors.Is(err, ErrNonCanonicalIPv4) {
+		t.Errorf("ParseIP() error = %v, want ErrInvalidIP and ErrNonCanonicalIPv4", err)
+	}
+}
+
+func TestHandler_BasePath(t *testing.T) {
+	t.Setenv("DATABASE_FILE_PATH", "../../data/ip_locations.csv")
+	t.Setenv("BASE_PATH", "/geo/")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	handler, err := Handler(cfg)
+	if err != nil {
+		t.Fatalf("Handler: %v", err)
+	}
+
+	// Mounted at the prefix a gateway forwards unchanged
+	mux := http.NewServeMux()
+	mux.Handle("/geo/", handler)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/geo/v1/find-country?ip=8.8.8.8", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "United States") {
+		t.Errorf("Expected the lookup result, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/find-country?ip=8.8.8.8", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected routes outside the base path to be not found, got %d", w.Code)
+	}
+}
+
+// Embedding the service leaves the host program's default HTTP transport alone
+func TestNewServer_KeepsDefaultTransport(t *testing.T) {
+	t.Setenv("DATABASE_FILE_PATH", "../../data/ip_locations.csv")
+	t.Setenv("EGRESS_PROXY", "http://proxy.internal:3128")
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	before, _ := http.DefaultTransport.(*http.Transport).Proxy(req)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	geo, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer geo.Close()
+
+	after, _ := http.DefaultTransport.(*http.Transport).Proxy(req)
+	if fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Errorf("Expected the default transport's proxy to stay %v, got %v", before, after)
+	}
+}
+
+// The host program's GOMAXPROCS and GOMEMLIMIT are only changed when it opts in
+func TestLoadConfig_RuntimeLimitsOptIn(t *testing.T) {
+	t.Setenv("DATABASE_FILE_PATH", "../../data/ip_locations.csv")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Runtime.AutoMaxProcs || cfg.Runtime.AutoMemoryLimit {
+		t.Errorf("Expected the runtime limits off by default, got %+v", cfg.Runtime)
+	}
+
+	t.Setenv("AUTO_GOMAXPROCS", "true")
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if !cfg.Runtime.AutoMaxProcs || cfg.Runtime.AutoMemoryLimit {
+		t.Errorf("Expected only AUTO_GOMAXPROCS on, got %+v", cfg.Runtime)
+	}
+}
@@ -0,0 +1,38 @@
+#!/bin/bash
+
+# Compare benchmark results against a baseline and fail on regressions
+# Usage: ./scripts/bench_compare.sh baseline.txt current.txt [max_regression_percent]
+# Both files are `go test -bench` output; repeated runs (-count) are averaged.
+
+BASELINE=$1
+CURRENT=$2
+THRESHOLD=${3:-10}
+
+if [ ! -f "$BASELINE" ] || [ ! -f "$CURRENT" ]; then
+    echo "Usage: $0 baseline.txt current.txt [max_regression_percent]"
+    exit 2
+fi
+
+# Mean ns/op per benchmark: "name ns_per_op"
+mean_ns() {
+    awk '/^Benchmark/ {
+        for (i = 3; i < NF; i++) if ($(i+1) == "ns/op") { sum[$1] += $i; n[$1]++ }
+    }
+    END { for (b in sum) printf "%s %f\n", b, sum[b] / n[b] }' "$1" | sort
+}
+
+echo "⚡ Benchmark comparison (regression threshold ${THRESHOLD}%)"
+echo "=========================================="
+
+join <(mean_ns "$BASELINE") <(mean_ns "$CURRENT") | awk -v threshold="$THRESHOLD" '
+{
+    delta = ($3 - $2) / $2 * 100
+    status = "✅"
+    if (delta > threshold) { status = "❌"; failed++ }
+    printf "%s %-50s %12.1f → %12.1f ns/op (%+.1f%%)\n", status, $1, $2, $3, delta
+}
+END {
+    print "=========================================="
+    if (failed) { printf "❌ %d benchmark(s) regressed by more than %s%%\n", failed, threshold; exit 1 }
+    print "✅ No regressions"
+}'